@@ -0,0 +1,51 @@
+package cli
+
+import (
+	"io"
+	"os"
+
+	"github.com/tus/tusd/v2/pkg/accesslog"
+)
+
+// accessLogger records every request, if enabled.
+var accessLogger *accesslog.Logger
+
+// accessLogFile is the file, to which the access log is written, if it is not
+// written to stdout or stderr.
+var accessLogFile *os.File
+
+func setupAccessLog() {
+	var w io.Writer
+	switch Flags.AccessLog {
+	case "stdout":
+		w = os.Stdout
+	case "stderr":
+		w = os.Stderr
+	default:
+		file, err := os.OpenFile(Flags.AccessLog, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			stderr.Fatalf("Unable to open access log: %s", err)
+		}
+		accessLogFile = file
+		w = file
+	}
+
+	var err error
+	accessLogger, err = accesslog.NewLogger(w, Flags.AccessLogFormat)
+	if err != nil {
+		stderr.Fatalf("Invalid value for -access-log-format: %s", err)
+	}
+
+	stdout.Printf("Writing access log to %s\n", Flags.AccessLog)
+}
+
+// closeAccessLog closes the access log, if it is written to a file.
+func closeAccessLog() {
+	if accessLogFile == nil {
+		return
+	}
+
+	if err := accessLogFile.Close(); err != nil {
+		stderr.Printf("Failed to close access log: %s\n", err)
+	}
+}
@@ -0,0 +1,615 @@
+package cli
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bmizerany/pat"
+	"github.com/tus/tusd/v2/pkg/circuitbreaker"
+	tushandler "github.com/tus/tusd/v2/pkg/handler"
+	"github.com/tus/tusd/v2/pkg/hooks"
+)
+
+//go:embed adminui/index.html
+var adminUIPage []byte
+
+// adminMux is the router for the admin listener. Other components can attach
+// their own endpoints to it before ServeAdmin is called.
+var adminMux = pat.New()
+
+// adminServer is the running admin HTTP server, if enabled. It is shut down
+// together with the main server.
+var adminServer *http.Server
+
+// storeHealthCheckID is the ID of the upload which is looked up to check that
+// the store is reachable. It is not expected to exist.
+const storeHealthCheckID = "tusd-health-check+tusd-health-check"
+
+// storeHealth reports whether the data store could be reached in the last check.
+type storeHealth struct {
+	Healthy      bool   `json:"healthy"`
+	Error        string `json:"error,omitempty"`
+	Latency      string `json:"latency"`
+	Capabilities string `json:"capabilities"`
+	Extensions   string `json:"extensions"`
+}
+
+// storedUploads is one page of unfinished uploads in the data store or, if
+// the upload index is enabled, of the uploads matching the search. Uploads is
+// only set for the latter.
+type storedUploads struct {
+	IDs        []string                `json:"ids"`
+	Uploads    []tushandler.IndexEntry `json:"uploads,omitempty"`
+	NextCursor string                  `json:"next_cursor,omitempty"`
+}
+
+// tagsRequest replaces the tags of an upload in the upload index.
+type tagsRequest struct {
+	Tags []string `json:"tags"`
+}
+
+// downloadTokenRequest configures a download token for sharing an upload.
+type downloadTokenRequest struct {
+	ExpiresIn string `json:"expires_in"`
+	IP        string `json:"ip"`
+}
+
+// downloadTokenResponse contains a download token and the URL using it.
+type downloadTokenResponse struct {
+	Token     string    `json:"token"`
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// uploadInspection describes how the data of an upload is stored. Offset is
+// tusd's view, while Parts and StagedBytes are reported by the store, so a
+// mismatch between them points to data which got lost.
+type uploadInspection struct {
+	ID          string            `json:"id"`
+	Size        int64             `json:"size"`
+	Offset      int64             `json:"offset"`
+	Parts       []inspectedPart   `json:"parts"`
+	StagedBytes int64             `json:"staged_bytes"`
+	Details     map[string]string `json:"details,omitempty"`
+}
+
+// importedUpload is the response to importing an upload checkpoint.
+type importedUpload struct {
+	ID     string `json:"id"`
+	Size   int64  `json:"size"`
+	Offset int64  `json:"offset"`
+}
+
+// ingestionRequest selects an existing object in the storage backend, which
+// is turned into a finished upload. ID is optional and generated if empty.
+type ingestionRequest struct {
+	Bucket        string              `json:"bucket"`
+	Key           string              `json:"key"`
+	VersionID     string              `json:"version_id"`
+	ExpectedOwner string              `json:"expected_owner"`
+	ID            string              `json:"id"`
+	MetaData      tushandler.MetaData `json:"metadata"`
+}
+
+// inspectedPart is a part of an upload committed to the store.
+type inspectedPart struct {
+	Number int64  `json:"number"`
+	Offset int64  `json:"offset"`
+	Size   int64  `json:"size"`
+	ETag   string `json:"etag,omitempty"`
+}
+
+// terminationRequest selects the uploads which are terminated by their metadata.
+type terminationRequest struct {
+	MetaData tushandler.MetaData `json:"metadata"`
+}
+
+// terminatedUploads lists the uploads which have been terminated. If some
+// uploads could not be terminated, Error describes the failures.
+type terminatedUploads struct {
+	IDs   []string `json:"ids"`
+	Error string   `json:"error,omitempty"`
+}
+
+// SetupAdmin installs the admin API and, if enabled, the web interface for
+// monitoring uploads on the admin router. The admin API exposes:
+//
+//	GET    /api/uploads           - list of uploads currently receiving data
+//	DELETE /api/uploads/:id       - terminate an upload
+//	POST   /api/uploads/terminate - terminate all uploads with matching metadata
+//	GET    /api/hooks/errors      - recently failed hook invocations
+//	GET    /api/store             - health and capabilities of the configured store
+//	GET    /api/store/uploads     - unfinished uploads in the store, if it can list them,
+//	                                or uploads matching a search, if the upload index is enabled
+//	PUT    /api/uploads/:id/tags  - replace the tags of an upload in the upload index
+//	POST   /api/uploads/:id/download-token - create a one-time link for downloading a finished upload
+//	GET    /api/uploads/:id/inspect - committed parts and staged bytes of an upload, if the store supports it
+//	GET    /api/uploads/:id/checkpoint - state of an upload for importing it into another deployment
+//	POST   /api/uploads/import    - take over an upload from a checkpoint, if the store supports it
+//	POST   /api/uploads/ingest    - create a finished upload from an existing object, if the store supports it
+//	GET    /api/store/circuit     - state of the stores' circuit breakers, if enabled
+//	PUT    /api/store/circuit     - force a circuit breaker open or closed, or remove the override
+func SetupAdmin(handler *tushandler.Handler) {
+	adminMux.Get("/api/uploads", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeAdminJSON(w, http.StatusOK, handler.ActiveUploads())
+	}))
+
+	adminMux.Del("/api/uploads/:id", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.URL.Query().Get(":id")
+		if err := handler.TerminateUpload(r.Context(), id); err != nil {
+			logAdminAudit(r, "terminate", id, adminError(err).HTTPResponse.StatusCode)
+			writeAdminError(w, err)
+			return
+		}
+
+		logAdminAudit(r, "terminate", id, http.StatusNoContent)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	adminMux.Post("/api/uploads/terminate", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req terminationRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.MetaData) == 0 {
+			writeAdminError(w, tushandler.NewError("ERR_INVALID_REQUEST", "request body must contain a non-empty metadata object", http.StatusBadRequest))
+			return
+		}
+
+		ids, err := handler.TerminateUploadsByMetaData(r.Context(), req.MetaData)
+		for _, id := range ids {
+			logAdminAudit(r, "terminate", id, http.StatusNoContent)
+		}
+		if errors.Is(err, tushandler.ErrNotImplemented) {
+			writeAdminError(w, err)
+			return
+		}
+
+		res := terminatedUploads{IDs: ids}
+		status := http.StatusOK
+		if err != nil {
+			res.Error = err.Error()
+			status = http.StatusInternalServerError
+		}
+		if res.IDs == nil {
+			res.IDs = []string{}
+		}
+		writeAdminJSON(w, status, res)
+	}))
+
+	adminMux.Get("/api/hooks/errors", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeAdminJSON(w, http.StatusOK, hooks.RecentHookErrors())
+	}))
+
+	adminMux.Get("/api/store", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		health := checkStoreHealth(r.Context())
+		health.Capabilities = Composer.Capabilities()
+		health.Extensions = handler.SupportedExtensions()
+
+		status := http.StatusOK
+		if !health.Healthy {
+			status = http.StatusServiceUnavailable
+		}
+		writeAdminJSON(w, status, health)
+	}))
+
+	adminMux.Get("/api/store/circuit", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(storeBreakers) == 0 {
+			writeAdminError(w, tushandler.NewError("ERR_CIRCUIT_BREAKER_DISABLED", "circuit breaker is not enabled", http.StatusNotFound))
+			return
+		}
+
+		writeAdminJSON(w, http.StatusOK, circuitBreakerStatuses())
+	}))
+
+	adminMux.Put("/api/store/circuit", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(storeBreakers) == 0 {
+			writeAdminError(w, tushandler.NewError("ERR_CIRCUIT_BREAKER_DISABLED", "circuit breaker is not enabled", http.StatusNotFound))
+			return
+		}
+
+		var req circuitBreakerOverride
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeAdminError(w, tushandler.NewError("ERR_INVALID_REQUEST", "request body must contain an override", http.StatusBadRequest))
+			return
+		}
+
+		override := circuitbreaker.Override(req.Override)
+		if override != circuitbreaker.OverrideNone && override != circuitbreaker.OverrideOpen && override != circuitbreaker.OverrideClosed {
+			writeAdminError(w, tushandler.NewError("ERR_INVALID_REQUEST", "override must be open, closed or empty", http.StatusBadRequest))
+			return
+		}
+
+		if req.Tenant != "" {
+			store, ok := storeBreakers[req.Tenant]
+			if !ok {
+				writeAdminError(w, tushandler.NewError("ERR_TENANT_NOT_FOUND", "tenant not found", http.StatusNotFound))
+				return
+			}
+			store.SetOverride(override)
+		} else {
+			for _, store := range storeBreakers {
+				store.SetOverride(override)
+			}
+		}
+
+		operation := "circuit-reset"
+		if override != circuitbreaker.OverrideNone {
+			operation = "circuit-" + req.Override
+		}
+		logAdminAudit(r, operation, req.Tenant, http.StatusOK)
+		writeAdminJSON(w, http.StatusOK, circuitBreakerStatuses())
+	}))
+
+	adminMux.Put("/api/uploads/:id/tags", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.URL.Query().Get(":id")
+		if uploadIndex == nil {
+			writeAdminError(w, tushandler.ErrNotImplemented)
+			return
+		}
+
+		var req tagsRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeAdminError(w, tushandler.NewError("ERR_INVALID_REQUEST", "request body must contain a tags array", http.StatusBadRequest))
+			return
+		}
+
+		if err := uploadIndex.SetUploadTags(r.Context(), id, req.Tags); err != nil {
+			logAdminAudit(r, "tag", id, adminError(err).HTTPResponse.StatusCode)
+			writeAdminError(w, err)
+			return
+		}
+
+		logAdminAudit(r, "tag", id, http.StatusNoContent)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	adminMux.Get("/api/uploads/:id/inspect", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.URL.Query().Get(":id")
+
+		info, inspection, err := handler.InspectUpload(r.Context(), id)
+		if err != nil {
+			writeAdminError(w, err)
+			return
+		}
+
+		resp := uploadInspection{
+			ID:          info.ID,
+			Size:        info.Size,
+			Offset:      info.Offset,
+			Parts:       make([]inspectedPart, 0, len(inspection.Parts)),
+			StagedBytes: inspection.StagedBytes,
+			Details:     inspection.Details,
+		}
+		for _, part := range inspection.Parts {
+			resp.Parts = append(resp.Parts, inspectedPart{
+				Number: part.Number,
+				Offset: part.Offset,
+				Size:   part.Size,
+				ETag:   part.ETag,
+			})
+		}
+
+		writeAdminJSON(w, http.StatusOK, resp)
+	}))
+
+	adminMux.Get("/api/uploads/:id/checkpoint", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.URL.Query().Get(":id")
+
+		checkpoint, err := handler.ExportUpload(r.Context(), id)
+		if err != nil {
+			writeAdminError(w, err)
+			return
+		}
+
+		logAdminAudit(r, "export", id, http.StatusOK)
+		writeAdminJSON(w, http.StatusOK, checkpoint)
+	}))
+
+	adminMux.Post("/api/uploads/import", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var checkpoint tushandler.UploadCheckpoint
+		if err := json.NewDecoder(r.Body).Decode(&checkpoint); err != nil {
+			writeAdminError(w, tushandler.NewError("ERR_INVALID_REQUEST", "request body must be an upload checkpoint", http.StatusBadRequest))
+			return
+		}
+
+		info, err := handler.ImportUpload(r.Context(), checkpoint)
+		if err != nil {
+			logAdminAudit(r, "import", checkpoint.Info.ID, adminError(err).HTTPResponse.StatusCode)
+			writeAdminError(w, err)
+			return
+		}
+
+		logAdminAudit(r, "import", info.ID, http.StatusOK)
+		writeAdminJSON(w, http.StatusOK, importedUpload{
+			ID:     info.ID,
+			Size:   info.Size,
+			Offset: info.Offset,
+		})
+	}))
+
+	adminMux.Post("/api/uploads/ingest", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ingestionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Bucket == "" || req.Key == "" {
+			writeAdminError(w, tushandler.NewError("ERR_INVALID_REQUEST", "request body must contain a bucket and key", http.StatusBadRequest))
+			return
+		}
+
+		source := tushandler.IngestSource{
+			Bucket:        req.Bucket,
+			Key:           req.Key,
+			VersionID:     req.VersionID,
+			ExpectedOwner: req.ExpectedOwner,
+		}
+		info, err := handler.IngestObject(r.Context(), source, tushandler.FileInfo{
+			ID:       req.ID,
+			MetaData: req.MetaData,
+		})
+		if err != nil {
+			logAdminAudit(r, "ingest", req.Bucket+"/"+req.Key, adminError(err).HTTPResponse.StatusCode)
+			writeAdminError(w, err)
+			return
+		}
+
+		logAdminAudit(r, "ingest", info.ID, http.StatusOK)
+		writeAdminJSON(w, http.StatusOK, importedUpload{
+			ID:     info.ID,
+			Size:   info.Size,
+			Offset: info.Offset,
+		})
+	}))
+
+	adminMux.Post("/api/uploads/:id/download-token", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.URL.Query().Get(":id")
+
+		// All properties are optional, so an empty body is accepted.
+		var req downloadTokenRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			writeAdminError(w, tushandler.NewError("ERR_INVALID_REQUEST", "request body must be a JSON object", http.StatusBadRequest))
+			return
+		}
+
+		var options tushandler.DownloadTokenOptions
+		if req.ExpiresIn != "" {
+			expiry, err := time.ParseDuration(req.ExpiresIn)
+			if err != nil || expiry <= 0 {
+				writeAdminError(w, tushandler.NewError("ERR_INVALID_REQUEST", "expires_in must be a positive duration, e.g. 15m", http.StatusBadRequest))
+				return
+			}
+			options.Expiry = expiry
+		}
+		options.IP = req.IP
+
+		token, err := handler.NewDownloadToken(r.Context(), id, options)
+		if err != nil {
+			logAdminAudit(r, "download-token", id, adminError(err).HTTPResponse.StatusCode)
+			writeAdminError(w, err)
+			return
+		}
+
+		logAdminAudit(r, "download-token", id, http.StatusOK)
+		writeAdminJSON(w, http.StatusOK, downloadTokenResponse{
+			Token:     token.Token,
+			URL:       token.URL,
+			ExpiresAt: token.ExpiresAt,
+		})
+	}))
+
+	adminMux.Get("/api/store/uploads", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if uploadIndex != nil {
+			searchUploadIndex(w, r)
+			return
+		}
+
+		if !Composer.UsesLister {
+			writeAdminError(w, tushandler.ErrNotImplemented)
+			return
+		}
+
+		ids, nextCursor, err := Composer.Lister.ListUploads(r.Context(), r.URL.Query().Get("cursor"))
+		if err != nil {
+			writeAdminError(w, err)
+			return
+		}
+
+		writeAdminJSON(w, http.StatusOK, storedUploads{IDs: ids, NextCursor: nextCursor})
+	}))
+
+	if Flags.AdminUI {
+		adminMux.Get("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/" {
+				http.NotFound(w, r)
+				return
+			}
+
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write(adminUIPage)
+		}))
+	}
+}
+
+// searchUploadIndex responds with the uploads from the upload index matching
+// the query parameters:
+//
+//	tag=<tag>              - assigned tag, can be repeated
+//	metadata.<key>=<value> - metadata value
+//	state=<state>          - in-progress, finished or terminated
+//	created_after=<time>   - RFC 3339 timestamp
+//	created_before=<time>  - RFC 3339 timestamp
+//	updated_before=<time>  - RFC 3339 timestamp, for finding stalled uploads
+//	limit=<n>              - maximum number of uploads on a page
+//	cursor=<cursor>        - next_cursor from the previous page
+func searchUploadIndex(w http.ResponseWriter, r *http.Request) {
+	query, err := parseIndexQuery(r.URL.Query())
+	if err != nil {
+		writeAdminError(w, tushandler.NewError("ERR_INVALID_REQUEST", err.Error(), http.StatusBadRequest))
+		return
+	}
+
+	entries, nextCursor, err := uploadIndex.SearchUploads(r.Context(), query)
+	if err != nil {
+		writeAdminError(w, err)
+		return
+	}
+
+	ids := make([]string, len(entries))
+	for i, entry := range entries {
+		ids[i] = entry.ID
+	}
+
+	writeAdminJSON(w, http.StatusOK, storedUploads{IDs: ids, Uploads: entries, NextCursor: nextCursor})
+}
+
+func parseIndexQuery(values url.Values) (tushandler.IndexQuery, error) {
+	query := tushandler.IndexQuery{
+		Tags:   values["tag"],
+		State:  tushandler.UploadState(values.Get("state")),
+		Cursor: values.Get("cursor"),
+	}
+
+	switch query.State {
+	case "", tushandler.UploadStateInProgress, tushandler.UploadStateFinished, tushandler.UploadStateTerminated:
+	default:
+		return query, fmt.Errorf("invalid state %q", query.State)
+	}
+
+	for key := range values {
+		if name, ok := strings.CutPrefix(key, "metadata."); ok {
+			if query.MetaData == nil {
+				query.MetaData = make(tushandler.MetaData)
+			}
+			query.MetaData[name] = values.Get(key)
+		}
+	}
+
+	for param, dest := range map[string]*time.Time{
+		"created_after":  &query.CreatedAfter,
+		"created_before": &query.CreatedBefore,
+		"updated_before": &query.UpdatedBefore,
+	} {
+		if value := values.Get(param); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return query, fmt.Errorf("invalid %s: expected RFC 3339 timestamp", param)
+			}
+			*dest = t
+		}
+	}
+
+	if value := values.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			return query, fmt.Errorf("invalid limit: expected positive integer")
+		}
+		query.Limit = limit
+	}
+
+	return query, nil
+}
+
+// ServeAdmin starts the admin HTTP server on the configured address in the
+// background. The server is stopped by ShutdownAdmin.
+func ServeAdmin() {
+	var handler http.Handler = adminMux
+	auth, err := newAdminAuthenticator(context.Background())
+	if err != nil {
+		stderr.Fatalf("Unable to configure admin authentication: %s", err)
+	}
+	if auth != nil {
+		handler = auth.Middleware(adminMux)
+	} else {
+		stdout.Printf("Warning: The admin server is not protected by authentication. Set TUSD_ADMIN_AUTH, TUSD_ADMIN_TOKENS or -admin-oidc-issuer to enable it.\n")
+	}
+	handler = adminResponseHeaders(handler)
+
+	// A socket named "admin" passed by systemd takes precedence over the
+	// configured address.
+	listener := takeSystemdListener(true)
+	if listener == nil {
+		address := Flags.AdminHost + ":" + Flags.AdminPort
+		listener, err = NewListener(address)
+		if err != nil {
+			stderr.Fatalf("Unable to create admin listener: %s", err)
+		}
+	}
+
+	stdout.Printf("Admin server listening on http://%s/\n", listener.Addr())
+
+	adminServer = &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: Flags.NetworkTimeout,
+	}
+
+	go func() {
+		if err := adminServer.Serve(listener); err != nil && err != http.ErrServerClosed {
+			stderr.Fatalf("Unable to serve admin server: %s", err)
+		}
+	}()
+}
+
+// ShutdownAdmin gracefully stops the admin HTTP server, if it is running.
+func ShutdownAdmin(ctx context.Context) error {
+	if adminServer == nil {
+		return nil
+	}
+
+	return adminServer.Shutdown(ctx)
+}
+
+// checkStoreHealth probes the data store by looking up an upload which does not
+// exist. A reachable store answers with ErrNotFound, while any other error
+// indicates that the store cannot be accessed.
+func checkStoreHealth(ctx context.Context) storeHealth {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	upload, err := Composer.Core.GetUpload(ctx, storeHealthCheckID)
+	if err == nil {
+		_, err = upload.GetInfo(ctx)
+	}
+
+	health := storeHealth{
+		Healthy: err == nil || errors.Is(err, tushandler.ErrNotFound),
+		Latency: time.Since(start).Round(time.Millisecond).String(),
+	}
+	if !health.Healthy {
+		health.Error = err.Error()
+	}
+
+	return health
+}
+
+func writeAdminJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+// writeAdminError responds with the details of the error. Errors from the tus
+// handler are sent using their status code and error code.
+func writeAdminError(w http.ResponseWriter, err error) {
+	detailedErr := adminError(err)
+
+	writeAdminJSON(w, detailedErr.HTTPResponse.StatusCode, map[string]string{
+		"code":    detailedErr.ErrorCode,
+		"message": detailedErr.Message,
+	})
+}
+
+// adminError converts err into an error of the tus handler, which carries the
+// status code for the response.
+func adminError(err error) tushandler.Error {
+	var detailedErr tushandler.Error
+	if !errors.As(err, &detailedErr) {
+		detailedErr = tushandler.NewError("ERR_INTERNAL_SERVER_ERROR", err.Error(), http.StatusInternalServerError)
+	}
+
+	return detailedErr
+}
@@ -0,0 +1,220 @@
+package cli
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	tushandler "github.com/tus/tusd/v2/pkg/handler"
+)
+
+// adminRole determines which admin endpoints a user may access. Each role
+// includes the permissions of the roles before it.
+type adminRole int
+
+const (
+	adminRoleNone adminRole = iota
+	// adminRoleReadOnly may list and inspect uploads, e.g. for dashboards.
+	adminRoleReadOnly
+	// adminRoleOperator may additionally terminate, tag and share uploads.
+	adminRoleOperator
+	// adminRoleAdmin may additionally import uploads and use the diagnostics.
+	adminRoleAdmin
+)
+
+var adminRoleNames = map[string]adminRole{
+	"read-only": adminRoleReadOnly,
+	"operator":  adminRoleOperator,
+	"admin":     adminRoleAdmin,
+}
+
+func (role adminRole) String() string {
+	for name, r := range adminRoleNames {
+		if r == role {
+			return name
+		}
+	}
+	return "none"
+}
+
+// adminIdentity is the authenticated user of an admin request.
+type adminIdentity struct {
+	Name string
+	Role adminRole
+}
+
+type adminIdentityKey struct{}
+
+// adminIdentityFromRequest returns the user, who has been authenticated by
+// adminAuthenticator for the request.
+func adminIdentityFromRequest(r *http.Request) (adminIdentity, bool) {
+	identity, ok := r.Context().Value(adminIdentityKey{}).(adminIdentity)
+	return identity, ok
+}
+
+// adminToken is a static bearer token for the admin API.
+type adminToken struct {
+	name  string
+	role  adminRole
+	token string
+}
+
+// adminAuthenticator checks the credentials of admin requests and whether the
+// user's role permits the request. Credentials are accepted using HTTP basic
+// authentication, which grants the admin role, static bearer tokens and, if
+// configured, bearer tokens issued by an OIDC provider.
+type adminAuthenticator struct {
+	basicUser     string
+	basicPassword string
+	tokens        []adminToken
+	oidc          *oidcVerifier
+}
+
+var (
+	errAdminUnauthorized = tushandler.NewError("ERR_UNAUTHORIZED", "missing or invalid credentials", http.StatusUnauthorized)
+	errAdminForbidden    = tushandler.NewError("ERR_FORBIDDEN", "role does not permit this request", http.StatusForbidden)
+)
+
+// newAdminAuthenticator configures the authentication from the TUSD_ADMIN_AUTH
+// and TUSD_ADMIN_TOKENS environment variables and the OIDC flags. It returns
+// nil if no authentication is configured.
+func newAdminAuthenticator(ctx context.Context) (*adminAuthenticator, error) {
+	auth := &adminAuthenticator{}
+	configured := false
+
+	if value := os.Getenv("TUSD_ADMIN_AUTH"); value != "" {
+		parts := strings.SplitN(value, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("TUSD_ADMIN_AUTH must be two values separated by a colon")
+		}
+		auth.basicUser, auth.basicPassword = parts[0], parts[1]
+		configured = true
+	}
+
+	if value := os.Getenv("TUSD_ADMIN_TOKENS"); value != "" {
+		tokens, err := parseAdminTokens(value)
+		if err != nil {
+			return nil, err
+		}
+		auth.tokens = tokens
+		configured = true
+	}
+
+	if Flags.AdminOIDCIssuer != "" {
+		verifier, err := newOIDCVerifier(ctx, Flags.AdminOIDCIssuer, Flags.AdminOIDCAudience, Flags.AdminOIDCRolesClaim)
+		if err != nil {
+			return nil, err
+		}
+		auth.oidc = verifier
+		configured = true
+	}
+
+	if !configured {
+		return nil, nil
+	}
+	return auth, nil
+}
+
+// parseAdminTokens parses a comma-separated list of tokens in the form
+// name:role:token, e.g. dashboard:read-only:0a1b2c.
+func parseAdminTokens(value string) ([]adminToken, error) {
+	var tokens []adminToken
+	for _, entry := range strings.Split(value, ",") {
+		parts := strings.SplitN(strings.TrimSpace(entry), ":", 3)
+		if len(parts) != 3 || parts[0] == "" || parts[2] == "" {
+			return nil, fmt.Errorf("TUSD_ADMIN_TOKENS must be a comma-separated list of name:role:token")
+		}
+
+		role, ok := adminRoleNames[parts[1]]
+		if !ok {
+			return nil, fmt.Errorf("unknown admin role %q, must be read-only, operator or admin", parts[1])
+		}
+
+		tokens = append(tokens, adminToken{
+			name:  parts[0],
+			role:  role,
+			token: parts[2],
+		})
+	}
+
+	return tokens, nil
+}
+
+func (auth *adminAuthenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity, ok := auth.authenticate(r)
+		if !ok {
+			if auth.basicUser != "" {
+				w.Header().Set("WWW-Authenticate", `Basic realm="tusd admin"`)
+			}
+			writeAdminError(w, errAdminUnauthorized)
+			return
+		}
+
+		if identity.Role < requiredAdminRole(r) {
+			writeAdminError(w, errAdminForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), adminIdentityKey{}, identity)))
+	})
+}
+
+func (auth *adminAuthenticator) authenticate(r *http.Request) (adminIdentity, bool) {
+	if user, password, ok := r.BasicAuth(); ok {
+		if auth.basicUser == "" {
+			return adminIdentity{}, false
+		}
+
+		userMatches := subtle.ConstantTimeCompare([]byte(user), []byte(auth.basicUser)) == 1
+		passwordMatches := subtle.ConstantTimeCompare([]byte(password), []byte(auth.basicPassword)) == 1
+		if !userMatches || !passwordMatches {
+			return adminIdentity{}, false
+		}
+		return adminIdentity{Name: user, Role: adminRoleAdmin}, true
+	}
+
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found || token == "" {
+		return adminIdentity{}, false
+	}
+
+	for _, t := range auth.tokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(t.token)) == 1 {
+			return adminIdentity{Name: t.name, Role: t.role}, true
+		}
+	}
+
+	if auth.oidc != nil {
+		identity, err := auth.oidc.verify(r.Context(), token)
+		if err != nil {
+			stderr.Printf("Rejected admin token: %s\n", err)
+			return adminIdentity{}, false
+		}
+		return identity, true
+	}
+
+	return adminIdentity{}, false
+}
+
+// requiredAdminRole returns the role needed for an admin request. Reading is
+// permitted to all roles, while changing uploads requires the operator role.
+// Exporting checkpoints is treated as a change, since it allows taking over an
+// upload. Importing and ingesting uploads and the diagnostics, which expose the process's
+// internals, are reserved for admins.
+func requiredAdminRole(r *http.Request) adminRole {
+	path := r.URL.Path
+	switch {
+	case strings.HasPrefix(path, "/debug/"), path == "/api/diagnostics", path == "/api/uploads/import", path == "/api/uploads/ingest":
+		return adminRoleAdmin
+	case strings.HasPrefix(path, "/api/uploads/") && strings.HasSuffix(path, "/checkpoint"):
+		return adminRoleOperator
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		return adminRoleReadOnly
+	default:
+		return adminRoleOperator
+	}
+}
@@ -0,0 +1,181 @@
+package cli
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdminAuthenticatorTokens(t *testing.T) {
+	a := assert.New(t)
+
+	tokens, err := parseAdminTokens("dashboard:read-only:secret1, oncall:operator:secret2")
+	a.NoError(err)
+
+	auth := &adminAuthenticator{
+		basicUser:     "admin",
+		basicPassword: "secret",
+		tokens:        tokens,
+	}
+
+	var identity adminIdentity
+	handler := auth.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity, _ = adminIdentityFromRequest(r)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	request := func(method, path string, setup func(r *http.Request)) int {
+		r := httptest.NewRequest(method, path, nil)
+		setup(r)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+	bearer := func(token string) func(r *http.Request) {
+		return func(r *http.Request) {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+	}
+
+	a.Equal(http.StatusNoContent, request("GET", "/api/uploads", bearer("secret1")))
+	a.Equal(adminIdentity{Name: "dashboard", Role: adminRoleReadOnly}, identity)
+	a.Equal(http.StatusForbidden, request("DELETE", "/api/uploads/foo", bearer("secret1")))
+	a.Equal(http.StatusForbidden, request("GET", "/api/uploads/foo/checkpoint", bearer("secret1")))
+
+	a.Equal(http.StatusNoContent, request("DELETE", "/api/uploads/foo", bearer("secret2")))
+	a.Equal(http.StatusForbidden, request("POST", "/api/uploads/import", bearer("secret2")))
+	a.Equal(http.StatusForbidden, request("GET", "/debug/vars", bearer("secret2")))
+
+	a.Equal(http.StatusNoContent, request("GET", "/debug/vars", func(r *http.Request) {
+		r.SetBasicAuth("admin", "secret")
+	}))
+	a.Equal(adminIdentity{Name: "admin", Role: adminRoleAdmin}, identity)
+
+	a.Equal(http.StatusUnauthorized, request("GET", "/api/uploads", bearer("wrong")))
+	a.Equal(http.StatusUnauthorized, request("GET", "/api/uploads", func(r *http.Request) {
+		r.SetBasicAuth("admin", "wrong")
+	}))
+	a.Equal(http.StatusUnauthorized, request("GET", "/api/uploads", func(r *http.Request) {}))
+
+	for _, value := range []string{"dashboard:secret1", "dashboard:viewer:secret1", ":admin:secret"} {
+		_, err := parseAdminTokens(value)
+		a.Error(err, value)
+	}
+}
+
+func TestOIDCVerifier(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	a.NoError(err)
+
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                server.URL,
+			"jwks_uri":                              server.URL + "/keys",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(jose.JSONWebKeySet{
+			Keys: []jose.JSONWebKey{{
+				Key:       &key.PublicKey,
+				KeyID:     "key-1",
+				Algorithm: "RS256",
+				Use:       "sig",
+			}},
+		})
+	})
+
+	sign := func(kid string, claims map[string]interface{}) string {
+		signer, err := jose.NewSigner(jose.SigningKey{
+			Algorithm: jose.RS256,
+			Key:       jose.JSONWebKey{Key: key, KeyID: kid},
+		}, nil)
+		a.NoError(err)
+
+		payload, _ := json.Marshal(claims)
+		signature, err := signer.Sign(payload)
+		a.NoError(err)
+		token, err := signature.CompactSerialize()
+		a.NoError(err)
+		return token
+	}
+	claims := func(modify func(claims map[string]interface{})) map[string]interface{} {
+		claims := map[string]interface{}{
+			"iss": server.URL,
+			"aud": []string{"tusd-admin"},
+			"sub": "jane",
+			"exp": time.Now().Add(time.Hour).Unix(),
+			"realm_access": map[string]interface{}{
+				"roles": []string{"offline_access", "read-only", "operator"},
+			},
+		}
+		modify(claims)
+		return claims
+	}
+
+	// Tokens must be verified against an audience.
+	_, err = newOIDCVerifier(ctx, server.URL, "", "realm_access.roles")
+	a.Error(err)
+
+	verifier, err := newOIDCVerifier(ctx, server.URL, "tusd-admin", "realm_access.roles")
+	a.NoError(err)
+
+	identity, err := verifier.verify(ctx, sign("key-1", claims(func(map[string]interface{}) {})))
+	a.NoError(err)
+	a.Equal(adminIdentity{Name: "jane", Role: adminRoleOperator}, identity)
+
+	for name, token := range map[string]string{
+		"Expired":     sign("key-1", claims(func(c map[string]interface{}) { c["exp"] = time.Now().Add(-time.Hour).Unix() })),
+		"OtherIssuer": sign("key-1", claims(func(c map[string]interface{}) { c["iss"] = "https://example.com" })),
+		"OtherAud":    sign("key-1", claims(func(c map[string]interface{}) { c["aud"] = "other" })),
+		"NoAud":       sign("key-1", claims(func(c map[string]interface{}) { delete(c, "aud") })),
+		"NoRole":      sign("key-1", claims(func(c map[string]interface{}) { delete(c, "realm_access") })),
+		"UnknownKey":  sign("key-2", claims(func(map[string]interface{}) {})),
+		"Tampered":    sign("key-1", claims(func(map[string]interface{}) {})) + "x",
+		"NotAJWT":     "secret",
+		"Unsigned":    "eyJhbGciOiJub25lIn0.eyJzdWIiOiJqYW5lIn0.",
+	} {
+		_, err := verifier.verify(ctx, token)
+		a.Error(err, name)
+	}
+}
+
+func TestRequiredAdminRole(t *testing.T) {
+	a := assert.New(t)
+
+	for _, test := range []struct {
+		method string
+		path   string
+		role   adminRole
+	}{
+		{"GET", "/", adminRoleReadOnly},
+		{"GET", "/api/store/uploads", adminRoleReadOnly},
+		{"GET", "/api/uploads/foo/inspect", adminRoleReadOnly},
+		{"GET", "/api/uploads/foo/checkpoint", adminRoleOperator},
+		{"PUT", "/api/uploads/foo/tags", adminRoleOperator},
+		{"POST", "/api/uploads/terminate", adminRoleOperator},
+		{"POST", "/api/uploads/foo/download-token", adminRoleOperator},
+		{"POST", "/api/uploads/import", adminRoleAdmin},
+		{"POST", "/api/uploads/ingest", adminRoleAdmin},
+		{"GET", "/api/diagnostics", adminRoleAdmin},
+		{"GET", "/debug/pprof/", adminRoleAdmin},
+	} {
+		r := httptest.NewRequest(test.method, test.path, nil)
+		a.Equal(test.role, requiredAdminRole(r), test.method+" "+test.path)
+	}
+}
@@ -0,0 +1,104 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+)
+
+// oidcVerifier verifies bearer tokens for the admin API, which are JWTs issued
+// by an OpenID Connect provider. The provider's signing keys are discovered
+// using its configuration document. The user's role is taken from a claim,
+// which contains role names, e.g. a list of groups mapped in the provider.
+type oidcVerifier struct {
+	verifier *oidc.IDTokenVerifier
+	// rolesClaim is the name of the claim containing the roles. Nested claims
+	// are separated using dots, e.g. realm_access.roles.
+	rolesClaim string
+}
+
+func newOIDCVerifier(ctx context.Context, issuer, audience, rolesClaim string) (*oidcVerifier, error) {
+	// Without an audience, tokens issued by the provider for any other client
+	// would be accepted.
+	if audience == "" {
+		return nil, errors.New("the audience of OIDC tokens must be set using -admin-oidc-audience")
+	}
+
+	ctx = oidc.ClientContext(ctx, &http.Client{Timeout: 10 * time.Second})
+	provider, err := oidc.NewProvider(ctx, issuer)
+	if err != nil {
+		return nil, fmt.Errorf("unable to discover OIDC provider: %w", err)
+	}
+
+	return &oidcVerifier{
+		verifier: provider.Verifier(&oidc.Config{
+			ClientID: audience,
+		}),
+		rolesClaim: rolesClaim,
+	}, nil
+}
+
+// verify checks the token's signature, issuer, audience and lifetime and returns
+// the user identified by its subject together with the highest role from the
+// roles claim.
+func (v *oidcVerifier) verify(ctx context.Context, token string) (adminIdentity, error) {
+	idToken, err := v.verifier.Verify(ctx, token)
+	if err != nil {
+		return adminIdentity{}, err
+	}
+
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		return adminIdentity{}, fmt.Errorf("invalid token claims: %w", err)
+	}
+
+	identity := adminIdentity{Name: idToken.Subject}
+	for _, name := range claimStrings(lookupClaim(claims, v.rolesClaim)) {
+		if role := adminRoleNames[name]; role > identity.Role {
+			identity.Role = role
+		}
+	}
+	if identity.Role == adminRoleNone {
+		return adminIdentity{}, fmt.Errorf("token of %q does not grant an admin role", identity.Name)
+	}
+
+	return identity, nil
+}
+
+// lookupClaim returns the value of a claim, whose name may refer to nested
+// objects using dots.
+func lookupClaim(claims map[string]interface{}, name string) interface{} {
+	var value interface{} = claims
+	for _, key := range strings.Split(name, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[key]
+	}
+	return value
+}
+
+// claimStrings returns the strings in a claim, which is either a list or a
+// space-separated string.
+func claimStrings(value interface{}) []string {
+	switch value := value.(type) {
+	case string:
+		return strings.Fields(value)
+	case []interface{}:
+		values := make([]string, 0, len(value))
+		for _, v := range value {
+			if s, ok := v.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,61 @@
+package cli
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/tus/tusd/v2/pkg/audit"
+	tushandler "github.com/tus/tusd/v2/pkg/handler"
+)
+
+// auditLogger records mutating requests and admin actions, if enabled.
+var auditLogger *audit.Logger
+
+func setupAuditLog() {
+	sink, err := audit.Open(Flags.AuditLog)
+	if err != nil {
+		stderr.Fatalf("Unable to open audit log: %s", err)
+	}
+
+	auditLogger, err = audit.NewLogger(sink)
+	if err != nil {
+		stderr.Fatalf("Unable to open audit log: %s", err)
+	}
+
+	stdout.Printf("Writing audit log to %s\n", Flags.AuditLog)
+}
+
+// logAdminAudit records an action performed through the admin API. The admin
+// user, who has been authenticated for the request, is used as the actor.
+func logAdminAudit(r *http.Request, operation string, id string, status int) {
+	if auditLogger == nil {
+		return
+	}
+
+	var actor map[string]string
+	if identity, ok := adminIdentityFromRequest(r); ok {
+		actor = map[string]string{"admin": identity.Name, "role": identity.Role.String()}
+	} else if user, _, ok := r.BasicAuth(); ok {
+		actor = map[string]string{"admin": user}
+	}
+
+	auditLogger.LogAudit(tushandler.AuditRecord{
+		Time:       time.Now().UTC(),
+		Operation:  "admin-" + operation,
+		UploadID:   id,
+		Status:     status,
+		RemoteAddr: r.RemoteAddr,
+		Actor:      actor,
+	})
+}
+
+// closeAuditLog closes the audit log, if it is enabled.
+func closeAuditLog() {
+	if auditLogger == nil {
+		return
+	}
+
+	if err := auditLogger.Close(); err != nil {
+		stderr.Printf("Failed to close audit log: %s\n", err)
+	}
+}
@@ -0,0 +1,310 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// benchFlags holds the options for the `tusd bench` subcommand. They are kept
+// separate from Flags since the benchmark does not start a server.
+var benchFlags struct {
+	Endpoint      string
+	Clients       int
+	Uploads       int
+	UploadSize    int64
+	ChunkSize     int64
+	InterruptRate float64
+	Timeout       time.Duration
+}
+
+// benchRecorder collects the request latencies per operation and the overall
+// results of a benchmark run. It is safe for concurrent use.
+type benchRecorder struct {
+	mutex     sync.Mutex
+	latencies map[string][]time.Duration
+	bytesSent int64
+	completed int
+	failed    int
+	resumed   int
+}
+
+func (r *benchRecorder) observe(op string, d time.Duration) {
+	r.mutex.Lock()
+	r.latencies[op] = append(r.latencies[op], d)
+	r.mutex.Unlock()
+}
+
+func (r *benchRecorder) addBytes(n int64) {
+	r.mutex.Lock()
+	r.bytesSent += n
+	r.mutex.Unlock()
+}
+
+// Bench runs synthetic resumable uploads against a tus server and reports the
+// achieved throughput and latency percentiles. It is invoked using
+// `tusd bench [options]` and exits the process once the run is complete.
+func Bench(args []string) {
+	f := flag.NewFlagSet("tusd bench", flag.ExitOnError)
+	f.StringVar(&benchFlags.Endpoint, "endpoint", "http://localhost:8080/files/", "Upload creation URL of the tus server to benchmark")
+	f.IntVar(&benchFlags.Clients, "clients", 4, "Number of clients uploading in parallel")
+	f.IntVar(&benchFlags.Uploads, "uploads", 20, "Total number of uploads to perform")
+	f.Int64Var(&benchFlags.UploadSize, "upload-size", 10*1024*1024, "Size in bytes of every upload")
+	f.Int64Var(&benchFlags.ChunkSize, "chunk-size", 2*1024*1024, "Size in bytes of the body of every PATCH request")
+	f.Float64Var(&benchFlags.InterruptRate, "interrupt-rate", 0, "Probability (0 to 1) that a PATCH request is aborted midway to simulate an interrupted connection")
+	f.DurationVar(&benchFlags.Timeout, "request-timeout", 60*time.Second, "Timeout for every individual request")
+	f.Parse(args)
+
+	if benchFlags.Clients <= 0 || benchFlags.Uploads <= 0 || benchFlags.ChunkSize <= 0 || benchFlags.UploadSize < 0 {
+		stderr.Fatalf("-clients, -uploads and -chunk-size must be positive and -upload-size must not be negative")
+	}
+	if benchFlags.InterruptRate < 0 || benchFlags.InterruptRate >= 1 {
+		stderr.Fatalf("-interrupt-rate must be in the range [0, 1)")
+	}
+
+	stdout.Printf("Benchmarking %s with %d clients, %d uploads of %d bytes in %d byte chunks\n",
+		benchFlags.Endpoint, benchFlags.Clients, benchFlags.Uploads, benchFlags.UploadSize, benchFlags.ChunkSize)
+
+	recorder := &benchRecorder{latencies: make(map[string][]time.Duration)}
+	client := &http.Client{Timeout: benchFlags.Timeout}
+
+	// Every upload uses the same payload, since the content is irrelevant for
+	// the server's performance.
+	payload := make([]byte, benchFlags.ChunkSize)
+	rand.Read(payload)
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(benchFlags.Clients)
+
+	start := time.Now()
+	for i := 0; i < benchFlags.Clients; i++ {
+		go func() {
+			defer wg.Done()
+			for range jobs {
+				err := runBenchUpload(client, recorder, payload)
+
+				recorder.mutex.Lock()
+				if err != nil {
+					recorder.failed += 1
+					stderr.Printf("Upload failed: %s\n", err)
+				} else {
+					recorder.completed += 1
+				}
+				recorder.mutex.Unlock()
+			}
+		}()
+	}
+
+	for i := 0; i < benchFlags.Uploads; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	printBenchReport(os.Stdout, recorder, time.Since(start))
+}
+
+// runBenchUpload creates a single upload and transfers its data in chunks. If
+// a chunk is interrupted on purpose, the offset is fetched using a HEAD request
+// and the upload is resumed, just like a real client would.
+func runBenchUpload(client *http.Client, recorder *benchRecorder, payload []byte) error {
+	req, err := http.NewRequest("POST", benchFlags.Endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Tus-Resumable", "1.0.0")
+	req.Header.Set("Upload-Length", strconv.FormatInt(benchFlags.UploadSize, 10))
+
+	res, err := timedRequest(client, recorder, "POST", req)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != http.StatusCreated {
+		return fmt.Errorf("unexpected status code for POST: %d", res.StatusCode)
+	}
+
+	uploadURL, err := resolveLocation(benchFlags.Endpoint, res.Header.Get("Location"))
+	if err != nil {
+		return err
+	}
+
+	offset := int64(0)
+	for offset < benchFlags.UploadSize {
+		chunkSize := benchFlags.UploadSize - offset
+		if chunkSize > benchFlags.ChunkSize {
+			chunkSize = benchFlags.ChunkSize
+		}
+
+		if rand.Float64() < benchFlags.InterruptRate {
+			// Send only half of the chunk and then abort the request body. The
+			// server will save the received data and we have to resume from there.
+			if err := interruptedPatch(client, recorder, uploadURL, offset, payload[:chunkSize]); err != nil {
+				return err
+			}
+
+			newOffset, err := fetchOffset(client, recorder, uploadURL)
+			if err != nil {
+				return err
+			}
+
+			// The server keeps the data received before the interruption.
+			recorder.addBytes(newOffset - offset)
+			offset = newOffset
+
+			recorder.mutex.Lock()
+			recorder.resumed += 1
+			recorder.mutex.Unlock()
+			continue
+		}
+
+		req, err := http.NewRequest("PATCH", uploadURL, bytes.NewReader(payload[:chunkSize]))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Tus-Resumable", "1.0.0")
+		req.Header.Set("Content-Type", "application/offset+octet-stream")
+		req.Header.Set("Upload-Offset", strconv.FormatInt(offset, 10))
+
+		res, err := timedRequest(client, recorder, "PATCH", req)
+		if err != nil {
+			return err
+		}
+		if res.StatusCode != http.StatusNoContent {
+			return fmt.Errorf("unexpected status code for PATCH: %d", res.StatusCode)
+		}
+
+		newOffset, err := strconv.ParseInt(res.Header.Get("Upload-Offset"), 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid Upload-Offset in PATCH response: %s", err)
+		}
+
+		recorder.addBytes(newOffset - offset)
+		offset = newOffset
+	}
+
+	return nil
+}
+
+// interruptedPatch sends a PATCH request whose body is cut off after half of
+// the chunk has been transmitted. Errors caused by the interruption itself
+// are expected and therefore not returned. The latency is recorded separately
+// from regular PATCH requests.
+func interruptedPatch(client *http.Client, recorder *benchRecorder, uploadURL string, offset int64, chunk []byte) error {
+	reader, writer := io.Pipe()
+	req, err := http.NewRequest("PATCH", uploadURL, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Tus-Resumable", "1.0.0")
+	req.Header.Set("Content-Type", "application/offset+octet-stream")
+	req.Header.Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	req.ContentLength = int64(len(chunk))
+
+	go func() {
+		writer.Write(chunk[:len(chunk)/2])
+		writer.CloseWithError(errors.New("simulated interruption"))
+	}()
+
+	start := time.Now()
+	res, err := client.Do(req)
+	if err == nil {
+		io.Copy(io.Discard, res.Body)
+		res.Body.Close()
+	}
+	recorder.observe("PATCH-interrupted", time.Since(start))
+
+	return nil
+}
+
+// fetchOffset retrieves the current offset of an upload using a HEAD request.
+func fetchOffset(client *http.Client, recorder *benchRecorder, uploadURL string) (int64, error) {
+	req, err := http.NewRequest("HEAD", uploadURL, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Tus-Resumable", "1.0.0")
+
+	res, err := timedRequest(client, recorder, "HEAD", req)
+	if err != nil {
+		return 0, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("unexpected status code for HEAD: %d", res.StatusCode)
+	}
+
+	return strconv.ParseInt(res.Header.Get("Upload-Offset"), 10, 64)
+}
+
+// timedRequest performs the request, records its latency under the given
+// operation name and discards the response body.
+func timedRequest(client *http.Client, recorder *benchRecorder, op string, req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	io.Copy(io.Discard, res.Body)
+	res.Body.Close()
+	recorder.observe(op, time.Since(start))
+
+	return res, nil
+}
+
+// resolveLocation turns a potentially relative Location header into an
+// absolute URL based on the endpoint.
+func resolveLocation(endpoint, location string) (string, error) {
+	if location == "" {
+		return "", errors.New("missing Location header in POST response")
+	}
+
+	base, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	ref, err := url.Parse(location)
+	if err != nil {
+		return "", err
+	}
+
+	return base.ResolveReference(ref).String(), nil
+}
+
+func printBenchReport(w io.Writer, recorder *benchRecorder, elapsed time.Duration) {
+	throughput := float64(recorder.bytesSent) / 1024 / 1024 / elapsed.Seconds()
+
+	fmt.Fprintf(w, "\nCompleted uploads: %d\n", recorder.completed)
+	fmt.Fprintf(w, "Failed uploads:    %d\n", recorder.failed)
+	fmt.Fprintf(w, "Resumed chunks:    %d\n", recorder.resumed)
+	fmt.Fprintf(w, "Bytes sent:        %d\n", recorder.bytesSent)
+	fmt.Fprintf(w, "Duration:          %s\n", elapsed.Round(time.Millisecond))
+	fmt.Fprintf(w, "Throughput:        %.2f MiB/s\n\n", throughput)
+
+	fmt.Fprintf(w, "%-17s %8s %10s %10s %10s %10s\n", "op", "count", "p50", "p90", "p99", "max")
+	for _, op := range []string{"POST", "PATCH", "PATCH-interrupted", "HEAD"} {
+		latencies := recorder.latencies[op]
+		if len(latencies) == 0 {
+			continue
+		}
+
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		fmt.Fprintf(w, "%-17s %8d %10s %10s %10s %10s\n", op, len(latencies),
+			percentile(latencies, 0.5), percentile(latencies, 0.9), percentile(latencies, 0.99), latencies[len(latencies)-1].Round(time.Microsecond))
+	}
+}
+
+// percentile returns the p-th percentile from a sorted slice of durations.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	index := int(float64(len(sorted)-1) * p)
+	return sorted[index].Round(time.Microsecond)
+}
@@ -0,0 +1,43 @@
+package cli
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPercentile(t *testing.T) {
+	a := assert.New(t)
+
+	sorted := make([]time.Duration, 100)
+	for i := range sorted {
+		sorted[i] = time.Duration(i+1) * time.Millisecond
+	}
+
+	a.Equal(50*time.Millisecond, percentile(sorted, 0.5))
+	a.Equal(90*time.Millisecond, percentile(sorted, 0.9))
+	a.Equal(99*time.Millisecond, percentile(sorted, 0.99))
+	a.Equal(100*time.Millisecond, percentile(sorted, 1))
+
+	a.Equal(time.Millisecond, percentile([]time.Duration{time.Millisecond}, 0.99))
+}
+
+func TestResolveLocation(t *testing.T) {
+	a := assert.New(t)
+
+	location, err := resolveLocation("http://localhost:8080/files/", "/files/abc")
+	a.NoError(err)
+	a.Equal("http://localhost:8080/files/abc", location)
+
+	location, err = resolveLocation("http://localhost:8080/files/", "abc")
+	a.NoError(err)
+	a.Equal("http://localhost:8080/files/abc", location)
+
+	location, err = resolveLocation("http://localhost:8080/files/", "https://cdn.example.com/files/abc")
+	a.NoError(err)
+	a.Equal("https://cdn.example.com/files/abc", location)
+
+	_, err = resolveLocation("http://localhost:8080/files/", "")
+	a.EqualError(err, "missing Location header in POST response")
+}
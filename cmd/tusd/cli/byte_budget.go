@@ -0,0 +1,52 @@
+package cli
+
+import (
+	tushandler "github.com/tus/tusd/v2/pkg/handler"
+)
+
+// byteBudgets contains the transfer budget of each bucket, so that tenants
+// storing their uploads in the same bucket share its budget.
+var byteBudgets = make(map[string]*tushandler.ByteBudget)
+
+// defaultBucket returns the name of the bucket or container configured using
+// the flags. For the file storage, it is the upload directory.
+func defaultBucket() string {
+	switch {
+	case Flags.StorePluginPath != "":
+		return Flags.StorePluginPath
+	case Flags.S3Bucket != "":
+		return Flags.S3Bucket
+	case Flags.GCSBucket != "":
+		return Flags.GCSBucket
+	case Flags.AzStorage != "":
+		return Flags.AzStorage
+	default:
+		return Flags.UploadDir
+	}
+}
+
+// byteBudget returns the transfer budget of the bucket, or nil if neither
+// -byte-budget-soft nor -byte-budget-hard is set. An empty bucket refers to
+// the one configured using the flags.
+func byteBudget(bucket string) *tushandler.ByteBudget {
+	if Flags.ByteBudgetSoft <= 0 && Flags.ByteBudgetHard <= 0 {
+		return nil
+	}
+
+	if bucket == "" {
+		bucket = defaultBucket()
+	}
+
+	budget, ok := byteBudgets[bucket]
+	if !ok {
+		budget = tushandler.NewByteBudget(bucket, tushandler.ByteBudgetLimits{
+			Soft: Flags.ByteBudgetSoft,
+			Hard: Flags.ByteBudgetHard,
+		})
+		byteBudgets[bucket] = budget
+
+		stdout.Printf("Using a monthly transfer budget for bucket '%s' (soft limit: %d bytes, hard limit: %d bytes).\n", bucket, Flags.ByteBudgetSoft, Flags.ByteBudgetHard)
+	}
+
+	return budget
+}
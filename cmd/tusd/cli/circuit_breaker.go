@@ -0,0 +1,132 @@
+package cli
+
+import (
+	"sort"
+	"time"
+
+	"github.com/tus/tusd/v2/pkg/circuitbreaker"
+	"github.com/tus/tusd/v2/pkg/handler"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// storeBreakers contains the circuit breaker for each tenant's store, or for
+// the only store under the empty key, if -store-circuit-breaker is enabled.
+var storeBreakers = make(map[string]*circuitbreaker.CircuitBreakerStore)
+
+// circuitBreakerStatus is the state of a store's circuit breaker.
+type circuitBreakerStatus struct {
+	Tenant         string     `json:"tenant,omitempty"`
+	State          string     `json:"state"`
+	Override       string     `json:"override,omitempty"`
+	Score          float64    `json:"score"`
+	Requests       int64      `json:"requests"`
+	ErrorRate      float64    `json:"error_rate"`
+	SlowRate       float64    `json:"slow_rate"`
+	AverageLatency string     `json:"average_latency"`
+	Trips          int64      `json:"trips"`
+	Rejections     int64      `json:"rejections"`
+	OpenUntil      *time.Time `json:"open_until,omitempty"`
+}
+
+// circuitBreakerOverride replaces the state of a circuit breaker. Override is
+// open, closed or empty to remove the override. If Tenant is empty, the
+// breakers of all stores are affected.
+type circuitBreakerOverride struct {
+	Override string `json:"override"`
+	Tenant   string `json:"tenant"`
+}
+
+// createCircuitBreakerComposer wraps the store in inner, so that new uploads are
+// rejected while it is unhealthy. The breaker's metrics are registered with
+// registerer.
+func createCircuitBreakerComposer(tenant string, inner *handler.StoreComposer, registerer prometheus.Registerer) *handler.StoreComposer {
+	if Flags.StoreCircuitErrorRate < 0 || Flags.StoreCircuitErrorRate > 1 {
+		stderr.Fatalf("Invalid value for -store-circuit-error-rate: must be between 0 and 1")
+	}
+	if Flags.StoreCircuitSlowRate < 0 || Flags.StoreCircuitSlowRate > 1 {
+		stderr.Fatalf("Invalid value for -store-circuit-slow-rate: must be between 0 and 1")
+	}
+
+	store := circuitbreaker.New(inner, circuitbreaker.Config{
+		Window:             Flags.StoreCircuitWindow,
+		MinRequests:        Flags.StoreCircuitMinRequests,
+		ErrorRateThreshold: Flags.StoreCircuitErrorRate,
+		SlowCallDuration:   Flags.StoreCircuitSlowCallDuration,
+		SlowRateThreshold:  Flags.StoreCircuitSlowRate,
+		OpenDuration:       Flags.StoreCircuitOpenDuration,
+	})
+	storeBreakers[tenant] = store
+	registerCircuitBreakerMetrics(store, registerer)
+
+	composer := handler.NewStoreComposer()
+	store.UseIn(composer)
+	return composer
+}
+
+func registerCircuitBreakerMetrics(store *circuitbreaker.CircuitBreakerStore, registerer prometheus.Registerer) {
+	registerer.MustRegister(
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "tusd_store_circuit_state",
+			Help: "State of the store's circuit breaker: 0 for closed, 1 for half-open and 2 for open.",
+		}, func() float64 {
+			return float64(store.Health().State)
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "tusd_store_health_score",
+			Help: "Health of the store between 0 and 1, based on the failed and slow operations in the circuit breaker's window.",
+		}, func() float64 {
+			return store.Health().Score
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "tusd_store_error_rate",
+			Help: "Fraction of failed store operations in the circuit breaker's window.",
+		}, func() float64 {
+			return store.Health().ErrorRate
+		}),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "tusd_store_circuit_trips_total",
+			Help: "Total number of times the store's circuit breaker opened.",
+		}, func() float64 {
+			return float64(store.Health().Trips)
+		}),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "tusd_store_circuit_rejections_total",
+			Help: "Total number of new uploads rejected by the store's circuit breaker.",
+		}, func() float64 {
+			return float64(store.Health().Rejections)
+		}),
+	)
+}
+
+// circuitBreakerStatuses returns the state of all circuit breakers, ordered by
+// tenant.
+func circuitBreakerStatuses() []circuitBreakerStatus {
+	tenants := make([]string, 0, len(storeBreakers))
+	for tenant := range storeBreakers {
+		tenants = append(tenants, tenant)
+	}
+	sort.Strings(tenants)
+
+	statuses := make([]circuitBreakerStatus, 0, len(tenants))
+	for _, tenant := range tenants {
+		health := storeBreakers[tenant].Health()
+		status := circuitBreakerStatus{
+			Tenant:         tenant,
+			State:          health.State.String(),
+			Override:       string(health.Override),
+			Score:          health.Score,
+			Requests:       health.Requests,
+			ErrorRate:      health.ErrorRate,
+			SlowRate:       health.SlowRate,
+			AverageLatency: health.AverageLatency.String(),
+			Trips:          health.Trips,
+			Rejections:     health.Rejections,
+		}
+		if !health.OpenUntil.IsZero() {
+			status.OpenUntil = &health.OpenUntil
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
@@ -6,28 +6,83 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/tus/tusd/v2/pkg/azurestore"
+	"github.com/tus/tusd/v2/pkg/chaosstore"
 	"github.com/tus/tusd/v2/pkg/filelocker"
 	"github.com/tus/tusd/v2/pkg/filestore"
 	"github.com/tus/tusd/v2/pkg/gcsstore"
 	"github.com/tus/tusd/v2/pkg/handler"
+	"github.com/tus/tusd/v2/pkg/instrumentedstore"
 	"github.com/tus/tusd/v2/pkg/memorylocker"
+	"github.com/tus/tusd/v2/pkg/pluginstore"
 	"github.com/tus/tusd/v2/pkg/s3store"
 
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 
 	"github.com/prometheus/client_golang/prometheus"
 )
 
 var Composer *handler.StoreComposer
 
+// startTemporaryFileCleanup ensures that the temporary files of the S3 store are
+// only cleaned up once, even if multiple stores share the same directory.
+var startTemporaryFileCleanup sync.Once
+
+// storageLocation overrides the bucket and extends the object prefix, which are
+// configured using the flags, for a tenant's uploads.
+type storageLocation struct {
+	// Bucket replaces the S3 or GCS bucket or the Azure container, if not empty.
+	Bucket string
+	// ObjectPrefix is appended to the configured object prefix. For the file
+	// store, it is a subdirectory of the upload directory.
+	ObjectPrefix string
+}
+
 func CreateComposer() {
+	if Flags.TenantsConfig != "" {
+		createTenantComposers()
+		return
+	}
+
+	Composer = createComposer(storageLocation{}, prometheus.DefaultRegisterer)
+	if Flags.StoreCircuitBreaker {
+		Composer = createCircuitBreakerComposer("", Composer, prometheus.DefaultRegisterer)
+	}
+	stdout.Printf("Using %.2fMB as maximum size.\n", float64(Flags.MaxSize)/1024/1024)
+}
+
+// createComposer creates the composer for the storage configured using the
+// flags. The store's metrics are registered with registerer.
+func createComposer(location storageLocation, registerer prometheus.Registerer) *handler.StoreComposer {
 	// Attempt to use S3 as a backend if the -s3-bucket option has been supplied.
 	// If not, we default to storing them locally on disk.
-	Composer = handler.NewStoreComposer()
-	if Flags.S3Bucket != "" {
+	composer := handler.NewStoreComposer()
+	if Flags.StorePluginPath != "" {
+		if location != (storageLocation{}) {
+			stderr.Fatalf("Storage plugins do not support custom storage locations for tenants")
+		}
+
+		stdout.Printf("Using '%s' as plugin for storage.\n", Flags.StorePluginPath)
+
+		store, err := pluginstore.New(Flags.StorePluginPath)
+		if err != nil {
+			stderr.Fatalf("Unable to load storage plugin: %s", err)
+		}
+		store.UseIn(composer)
+
+		locker := memorylocker.New()
+		locker.UseIn(composer)
+	} else if Flags.S3Bucket != "" {
+		bucket := Flags.S3Bucket
+		if location.Bucket != "" {
+			bucket = location.Bucket
+		}
+
 		// Derive credentials from default credential chain (env, shared, ec2 instance role)
 		// as per https://github.com/aws/aws-sdk-go#configuring-credentials
 		s3Config, err := config.LoadDefaultConfig(context.Background())
@@ -35,17 +90,45 @@ func CreateComposer() {
 			stderr.Fatalf("Unable to load S3 configuration: %s", err)
 		}
 
+		compatibility, err := s3store.CompatibilityProfile(Flags.S3Compatibility)
+		if err != nil {
+			stderr.Fatalf("Invalid value for -s3-compatibility: %s", err)
+		}
+
+		checksumAlgorithm, err := s3store.ParseChecksumAlgorithm(Flags.S3ChecksumAlgorithm)
+		if err != nil {
+			stderr.Fatalf("Invalid value for -s3-checksum-algorithm: %s", err)
+		}
+
+		isDirectoryBucket := s3store.IsDirectoryBucket(bucket)
+		if isDirectoryBucket && Flags.S3TransferAcceleration {
+			stderr.Fatalf("The S3 bucket '%s' is a directory bucket, which does not support Transfer Acceleration.", bucket)
+		}
+
 		if Flags.S3Endpoint == "" {
-			if Flags.S3TransferAcceleration {
-				stdout.Printf("Using 's3://%s' as S3 bucket for storage with AWS S3 Transfer Acceleration enabled.\n", Flags.S3Bucket)
+			if isDirectoryBucket {
+				stdout.Printf("Using 's3://%s' as S3 Express One Zone directory bucket for storage.\n", bucket)
+			} else if Flags.S3TransferAcceleration {
+				stdout.Printf("Using 's3://%s' as S3 bucket for storage with AWS S3 Transfer Acceleration enabled.\n", bucket)
 			} else {
-				stdout.Printf("Using 's3://%s' as S3 bucket for storage.\n", Flags.S3Bucket)
+				stdout.Printf("Using 's3://%s' as S3 bucket for storage.\n", bucket)
 			}
 		} else {
-			stdout.Printf("Using '%s/%s' as S3 endpoint and bucket for storage.\n", Flags.S3Endpoint, Flags.S3Bucket)
+			stdout.Printf("Using '%s/%s' as S3 endpoint and bucket for storage.\n", Flags.S3Endpoint, bucket)
 		}
 
-		s3Client := s3.NewFromConfig(s3Config, func(o *s3.Options) {
+		httpClient := s3store.NewHTTPClient(s3store.HTTPClientOptions{
+			MaxIdleConns:        Flags.S3MaxIdleConns,
+			MaxIdleConnsPerHost: Flags.S3MaxIdleConnsPerHost,
+			MaxConnsPerHost:     Flags.S3MaxConnsPerHost,
+			IdleConnTimeout:     Flags.S3IdleConnTimeout,
+			DialTimeout:         Flags.S3DialTimeout,
+			TLSHandshakeTimeout: Flags.S3TLSHandshakeTimeout,
+			DisableHTTP2:        Flags.S3DisableHTTP2,
+		})
+
+		s3Options := []func(*s3.Options){func(o *s3.Options) {
+			o.HTTPClient = httpClient
 			o.UseAccelerate = Flags.S3TransferAcceleration
 
 			// Disable HTTPS and only use HTTP (helpful for debugging requests).
@@ -55,25 +138,78 @@ func CreateComposer() {
 				o.BaseEndpoint = &Flags.S3Endpoint
 				o.UsePathStyle = true
 			}
-		})
+		}}
 
-		store := s3store.New(Flags.S3Bucket, s3Client)
-		store.ObjectPrefix = Flags.S3ObjectPrefix
+		// Directory buckets authenticate requests using sessions, which are
+		// created using the credentials from the configuration.
+		if isDirectoryBucket {
+			s3Options = append(s3Options, s3store.UseDirectoryBucketSessions(bucket))
+		}
+
+		s3Client := s3.NewFromConfig(s3Config, s3Options...)
+
+		store := s3store.New(bucket, s3Client)
+		store.ObjectPrefix = Flags.S3ObjectPrefix + location.ObjectPrefix
+		store.PrefixShards = Flags.S3PrefixShards
 		store.PreferredPartSize = Flags.S3PartSize
 		store.MaxBufferedParts = Flags.S3MaxBufferedParts
+		store.MaxTemporaryBytes = Flags.S3TempMaxBytes
+		store.MaxTemporaryFiles = Flags.S3TempMaxFiles
 		store.DisableContentHashes = Flags.S3DisableContentHashes
-		store.SetConcurrentPartUploads(Flags.S3ConcurrentPartUploads)
-		store.UseIn(Composer)
+		store.ChecksumAlgorithm = checksumAlgorithm
+		store.SkipMultipartForSmallUploads = Flags.S3SkipMultipartForSmallUploads
+		store.PreventOverwrite = Flags.S3PreventOverwrite
+		store.ObjectHeadersFromMetadata = Flags.S3ObjectHeadersFromMetadata
+		store.CacheControl = Flags.S3CacheControl
+		store.PointerObjectKey = Flags.S3PointerObjectKey
+		store.StorageClass = types.StorageClass(Flags.S3StorageClass)
+		store.SetCompatibility(compatibility)
+		if Flags.S3InfoObjectChecks > 0 {
+			store.Compatibility.InfoObjectChecks = Flags.S3InfoObjectChecks
+			store.Compatibility.InfoObjectCheckDelay = Flags.S3InfoObjectCheckDelay
+		}
+		store.SetConcurrentDeletes(Flags.S3ConcurrentDeletes)
+		store.ConcurrentDownloadRanges = Flags.S3ConcurrentDownloadRanges
+		store.DownloadRangeSize = Flags.S3DownloadRangeSize
+		if Flags.S3MaxMetadataSize > 0 {
+			store.MaxObjectMetadataSize = Flags.S3MaxMetadataSize
+		}
+		store.MetadataOverflow = Flags.S3MetadataOverflow
+		store.MetadataStore = getS3MetadataStore()
+		store.ConditionalInfoWrites = Flags.S3ConditionalInfoWrites
+		if Flags.S3AdaptivePartUploads {
+			store.SetAdaptiveConcurrentPartUploads(1, Flags.S3ConcurrentPartUploads)
+		} else {
+			store.SetConcurrentPartUploads(Flags.S3ConcurrentPartUploads)
+		}
+		store.UseIn(composer)
 
 		locker := memorylocker.New()
-		locker.UseIn(Composer)
+		locker.UseIn(composer)
 
 		// Attach the metrics from S3 store to the global Prometheus registry
-		store.RegisterMetrics(prometheus.DefaultRegisterer)
+		store.RegisterMetrics(registerer)
+		httpClient.RegisterMetrics(registerer)
+
+		if Flags.S3TempFileMaxAge > 0 {
+			startTemporaryFileCleanup.Do(func() {
+				go removeOrphanedS3TemporaryFiles(store, Flags.S3TempFileMaxAge)
+			})
+		}
+
+		if Flags.S3LifecycleInterval > 0 {
+			go analyzeS3Lifecycle(store, registerer)
+		}
 	} else if Flags.GCSBucket != "" {
-		if Flags.GCSObjectPrefix != "" && strings.Contains(Flags.GCSObjectPrefix, "_") {
+		bucket := Flags.GCSBucket
+		if location.Bucket != "" {
+			bucket = location.Bucket
+		}
+
+		objectPrefix := Flags.GCSObjectPrefix + location.ObjectPrefix
+		if objectPrefix != "" && strings.Contains(objectPrefix, "_") {
 			stderr.Fatalf("gcs-object-prefix value (%s) can't contain underscore. "+
-				"Please remove underscore from the value", Flags.GCSObjectPrefix)
+				"Please remove underscore from the value", objectPrefix)
 		}
 
 		// Derivce credentials from service account file path passed in
@@ -88,15 +224,19 @@ func CreateComposer() {
 			stderr.Fatalf("Unable to create Google Cloud Storage service: %s\n", err)
 		}
 
-		stdout.Printf("Using 'gcs://%s' as GCS bucket for storage.\n", Flags.GCSBucket)
+		stdout.Printf("Using 'gcs://%s' as GCS bucket for storage.\n", bucket)
 
-		store := gcsstore.New(Flags.GCSBucket, service)
-		store.ObjectPrefix = Flags.GCSObjectPrefix
-		store.UseIn(Composer)
+		store := gcsstore.New(bucket, service)
+		store.ObjectPrefix = objectPrefix
+		store.UseIn(composer)
 
 		locker := memorylocker.New()
-		locker.UseIn(Composer)
+		locker.UseIn(composer)
 	} else if Flags.AzStorage != "" {
+		container := Flags.AzStorage
+		if location.Bucket != "" {
+			container = location.Bucket
+		}
 
 		accountName := os.Getenv("AZURE_STORAGE_ACCOUNT")
 		if accountName == "" {
@@ -122,7 +262,7 @@ func CreateComposer() {
 		azConfig := &azurestore.AzConfig{
 			AccountName:         accountName,
 			AccountKey:          accountKey,
-			ContainerName:       Flags.AzStorage,
+			ContainerName:       container,
 			ContainerAccessType: Flags.AzContainerAccessType,
 			BlobAccessTier:      Flags.AzBlobAccessTier,
 			Endpoint:            azureEndpoint,
@@ -134,14 +274,18 @@ func CreateComposer() {
 		}
 
 		store := azurestore.New(azService)
-		store.ObjectPrefix = Flags.AzObjectPrefix
-		store.Container = Flags.AzStorage
-		store.UseIn(Composer)
+		store.ObjectPrefix = Flags.AzObjectPrefix + location.ObjectPrefix
+		store.Container = container
+		store.UseIn(composer)
 
 		locker := memorylocker.New()
-		locker.UseIn(Composer)
+		locker.UseIn(composer)
 	} else {
-		dir, err := filepath.Abs(Flags.UploadDir)
+		if location.Bucket != "" {
+			stderr.Fatalf("The file storage does not support buckets for tenants, use an object prefix instead")
+		}
+
+		dir, err := filepath.Abs(filepath.Join(Flags.UploadDir, location.ObjectPrefix))
 		if err != nil {
 			stderr.Fatalf("Unable to make absolute path: %s", err)
 		}
@@ -152,13 +296,109 @@ func CreateComposer() {
 		}
 
 		store := filestore.New(dir)
-		store.UseIn(Composer)
+		store.UseIn(composer)
 
 		locker := filelocker.New(dir)
 		locker.AcquirerPollInterval = Flags.FilelockAcquirerPollInterval
 		locker.HolderPollInterval = Flags.FilelockHolderPollInterval
-		locker.UseIn(Composer)
+		locker.UseIn(composer)
 	}
 
-	stdout.Printf("Using %.2fMB as maximum size.\n", float64(Flags.MaxSize)/1024/1024)
+	if Flags.ChaosLatency > 0 || Flags.ChaosLatencyJitter > 0 || Flags.ChaosErrorRate > 0 || Flags.ChaosPartialWriteRate > 0 {
+		composer = createChaosComposer(composer)
+	}
+
+	if Flags.ExposeMetrics {
+		composer = createInstrumentedComposer(composer, registerer)
+	}
+
+	return composer
+}
+
+// usesFileStore reports whether the uploads are saved using the file store.
+func usesFileStore() bool {
+	return Flags.StorePluginPath == "" && Flags.S3Bucket == "" && Flags.GCSBucket == "" && Flags.AzStorage == ""
+}
+
+// storeName returns the name of the package implementing the storage, which is
+// configured using the flags.
+func storeName() string {
+	switch {
+	case Flags.StorePluginPath != "":
+		return "pluginstore"
+	case Flags.S3Bucket != "":
+		return "s3store"
+	case Flags.GCSBucket != "":
+		return "gcsstore"
+	case Flags.AzStorage != "":
+		return "azurestore"
+	default:
+		return "filestore"
+	}
+}
+
+// createInstrumentedComposer wraps the store in inner, so that the latency and
+// errors of its operations are exposed using the same metrics for all stores.
+// The metrics are registered with registerer.
+func createInstrumentedComposer(inner *handler.StoreComposer, registerer prometheus.Registerer) *handler.StoreComposer {
+	store := instrumentedstore.New(inner, storeName())
+	store.RegisterMetrics(registerer)
+
+	composer := handler.NewStoreComposer()
+	store.UseIn(composer)
+	return composer
+}
+
+// createChaosComposer wraps the store in composer, so that faults are injected
+// into its operations as configured using the -chaos-* flags.
+func createChaosComposer(inner *handler.StoreComposer) *handler.StoreComposer {
+	if Flags.ChaosErrorRate < 0 || Flags.ChaosErrorRate > 1 {
+		stderr.Fatalf("Invalid value for -chaos-error-rate: must be between 0 and 1")
+	}
+	if Flags.ChaosPartialWriteRate < 0 || Flags.ChaosPartialWriteRate > 1 {
+		stderr.Fatalf("Invalid value for -chaos-partial-write-rate: must be between 0 and 1")
+	}
+
+	var operations []string
+	if Flags.ChaosOperations != "" {
+		for _, operation := range strings.Split(Flags.ChaosOperations, ",") {
+			operations = append(operations, strings.TrimSpace(operation))
+		}
+	}
+
+	stdout.Printf("Injecting faults into storage operations. Do not use this in production!\n")
+
+	composer := handler.NewStoreComposer()
+	chaosstore.New(inner, chaosstore.Config{
+		Latency:          Flags.ChaosLatency,
+		LatencyJitter:    Flags.ChaosLatencyJitter,
+		ErrorRate:        Flags.ChaosErrorRate,
+		PartialWriteRate: Flags.ChaosPartialWriteRate,
+		Operations:       operations,
+	}).UseIn(composer)
+	return composer
+}
+
+// removeOrphanedS3TemporaryFiles removes temporary files, which were left behind
+// by previous runs of tusd, on startup and then periodically.
+func removeOrphanedS3TemporaryFiles(store s3store.S3Store, maxAge time.Duration) {
+	interval := maxAge / 2
+	if interval > time.Hour {
+		interval = time.Hour
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		removed, err := store.RemoveOrphanedTemporaryFiles(maxAge)
+		if err != nil {
+			stderr.Printf("Unable to remove orphaned temporary files of S3 store: %s\n", err)
+		}
+		if removed > 0 {
+			stdout.Printf("Removed %d orphaned temporary files of S3 store.\n", removed)
+		}
+
+		<-ticker.C
+	}
 }
@@ -0,0 +1,142 @@
+package cli
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	runtimepprof "runtime/pprof"
+	"sync"
+
+	"github.com/felixge/fgprof"
+	tushandler "github.com/tus/tusd/v2/pkg/handler"
+)
+
+// diagnosticsState describes whether the diagnostics endpoints on the admin
+// listener are enabled and how detailed the blocking and mutex profiles are.
+type diagnosticsState struct {
+	Enabled              bool `json:"enabled"`
+	BlockProfileRate     int  `json:"block_profile_rate"`
+	MutexProfileFraction int  `json:"mutex_profile_fraction"`
+}
+
+// diagnosticsUpdate changes the diagnostics state. Omitted fields are kept.
+type diagnosticsUpdate struct {
+	Enabled              *bool `json:"enabled"`
+	BlockProfileRate     *int  `json:"block_profile_rate"`
+	MutexProfileFraction *int  `json:"mutex_profile_fraction"`
+}
+
+var (
+	diagnosticsLock sync.Mutex
+	diagnostics     diagnosticsState
+)
+
+// SetupAdminDiagnostics installs endpoints for profiling tusd on the admin
+// router. They can be enabled and disabled at runtime, so that a running
+// instance can be profiled without restarting it:
+//
+//	GET /api/diagnostics    - whether the diagnostics endpoints are enabled
+//	PUT /api/diagnostics    - enable or disable them and set the profiling rates
+//	GET /debug/pprof/       - net/http/pprof and fgprof
+//	GET /debug/vars         - expvar
+//	GET /debug/goroutines   - stacks of all goroutines and contended locks
+func SetupAdminDiagnostics() {
+	setDiagnostics(diagnosticsState{
+		Enabled:              Flags.AdminDiagnostics,
+		BlockProfileRate:     Flags.PprofBlockProfileRate,
+		MutexProfileFraction: Flags.PprofMutexProfileRate,
+	})
+
+	adminMux.Get("/api/diagnostics", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeAdminJSON(w, http.StatusOK, getDiagnostics())
+	}))
+
+	adminMux.Put("/api/diagnostics", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var update diagnosticsUpdate
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			writeAdminError(w, tushandler.NewError("ERR_INVALID_REQUEST", "request body must be a JSON object", http.StatusBadRequest))
+			return
+		}
+
+		state := getDiagnostics()
+		if update.Enabled != nil {
+			state.Enabled = *update.Enabled
+		}
+		if update.BlockProfileRate != nil {
+			state.BlockProfileRate = *update.BlockProfileRate
+		}
+		if update.MutexProfileFraction != nil {
+			state.MutexProfileFraction = *update.MutexProfileFraction
+		}
+		setDiagnostics(state)
+
+		logAdminAudit(r, "diagnostics", "", http.StatusOK)
+		writeAdminJSON(w, http.StatusOK, state)
+	}))
+
+	adminMux.Get("/debug/pprof/fgprof", requireDiagnostics(fgprof.Handler()))
+	adminMux.Get("/debug/pprof/cmdline", requireDiagnostics(http.HandlerFunc(pprof.Cmdline)))
+	adminMux.Get("/debug/pprof/profile", requireDiagnostics(http.HandlerFunc(pprof.Profile)))
+	adminMux.Get("/debug/pprof/symbol", requireDiagnostics(http.HandlerFunc(pprof.Symbol)))
+	adminMux.Get("/debug/pprof/trace", requireDiagnostics(http.HandlerFunc(pprof.Trace)))
+	// pprof.Index also serves the named profiles, such as /debug/pprof/heap.
+	adminMux.Get("/debug/pprof/", requireDiagnostics(http.HandlerFunc(pprof.Index)))
+	adminMux.Get("/debug/vars", requireDiagnostics(expvar.Handler()))
+	adminMux.Get("/debug/goroutines", requireDiagnostics(http.HandlerFunc(serveGoroutineDump)))
+}
+
+func getDiagnostics() diagnosticsState {
+	diagnosticsLock.Lock()
+	defer diagnosticsLock.Unlock()
+
+	return diagnostics
+}
+
+// setDiagnostics changes the state and applies the profiling rates. The rates
+// are only applied while the diagnostics are enabled, since collecting the
+// profiles has a cost. Otherwise, the rates for the pprof endpoint on the main
+// listener are restored, if it is exposed.
+func setDiagnostics(state diagnosticsState) {
+	diagnosticsLock.Lock()
+	defer diagnosticsLock.Unlock()
+
+	diagnostics = state
+	switch {
+	case state.Enabled:
+		runtime.SetBlockProfileRate(state.BlockProfileRate)
+		runtime.SetMutexProfileFraction(state.MutexProfileFraction)
+	case Flags.ExposePprof:
+		runtime.SetBlockProfileRate(Flags.PprofBlockProfileRate)
+		runtime.SetMutexProfileFraction(Flags.PprofMutexProfileRate)
+	default:
+		runtime.SetBlockProfileRate(0)
+		runtime.SetMutexProfileFraction(0)
+	}
+}
+
+// requireDiagnostics responds with 404 Not Found unless the diagnostics are enabled.
+func requireDiagnostics(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !getDiagnostics().Enabled {
+			http.NotFound(w, r)
+			return
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// serveGoroutineDump writes the stacks of all goroutines, including how long
+// they have been blocked, followed by the contended mutexes. This helps to find
+// stalls in the upload pipeline, for example locks which are never released.
+func serveGoroutineDump(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	runtimepprof.Lookup("goroutine").WriteTo(w, 2)
+	w.Write([]byte("\n"))
+	runtimepprof.Lookup("mutex").WriteTo(w, 1)
+	w.Write([]byte("\n"))
+	runtimepprof.Lookup("block").WriteTo(w, 1)
+}
@@ -21,6 +21,30 @@ var Flags struct {
 	ShowGreeting                     bool
 	DisableDownload                  bool
 	DisableTermination               bool
+	HandlerMode                      string
+	RedirectDownloads                bool
+	DownloadURLExpiry                time.Duration
+	PresignCompletedUploads          bool
+	CompletedUploadURLExpiry         time.Duration
+	DirectPartUploads                bool
+	RequireDownloadTokens            bool
+	PartURLExpiry                    time.Duration
+	UploadExpiry                     time.Duration
+	PriorityMetadataKey              string
+	ChecksumMetadataKey              string
+	DeduplicateChunks                bool
+	DeduplicationTTL                 time.Duration
+	SkipReceivedPrefix               bool
+	PipelinedPatches                 bool
+	AcceptPartialBodies              bool
+	ClientAbortStatusCodes           bool
+	EstimateUploadRate               bool
+	MetadataRules                    string
+	ResponseHeadersConfig            string
+	MaxUploadWait                    time.Duration
+	RemoteFetch                      bool
+	RemoteFetchAllowedHosts          string
+	RemoteFetchRetries               int
 	DisableCors                      bool
 	CorsAllowOrigin                  string
 	CorsAllowCredentials             bool
@@ -31,12 +55,44 @@ var Flags struct {
 	NetworkTimeout                   time.Duration
 	S3Bucket                         string
 	S3ObjectPrefix                   string
+	S3PrefixShards                   int
 	S3Endpoint                       string
 	S3PartSize                       int64
 	S3MaxBufferedParts               int64
+	S3TempMaxBytes                   int64
+	S3TempMaxFiles                   int64
+	S3TempFileMaxAge                 time.Duration
+	S3LifecycleInterval              time.Duration
+	S3LifecycleMaxAge                time.Duration
+	S3LifecycleApply                 bool
 	S3DisableContentHashes           bool
+	S3ChecksumAlgorithm              string
+	S3SkipMultipartForSmallUploads   bool
+	S3PreventOverwrite               bool
+	S3ObjectHeadersFromMetadata      bool
+	S3CacheControl                   string
+	S3PointerObjectKey               string
+	S3StorageClass                   string
+	S3MaxMetadataSize                int
+	S3MetadataOverflow               bool
+	S3Compatibility                  string
+	S3InfoObjectChecks               int
+	S3InfoObjectCheckDelay           time.Duration
+	S3MetadataStore                  string
+	S3ConditionalInfoWrites          bool
 	S3DisableSSL                     bool
 	S3ConcurrentPartUploads          int
+	S3ConcurrentDeletes              int
+	S3ConcurrentDownloadRanges       int
+	S3DownloadRangeSize              int64
+	S3AdaptivePartUploads            bool
+	S3MaxIdleConns                   int
+	S3MaxIdleConnsPerHost            int
+	S3MaxConnsPerHost                int
+	S3IdleConnTimeout                time.Duration
+	S3DialTimeout                    time.Duration
+	S3TLSHandshakeTimeout            time.Duration
+	S3DisableHTTP2                   bool
 	GCSBucket                        string
 	GCSObjectPrefix                  string
 	AzStorage                        string
@@ -44,13 +100,19 @@ var Flags struct {
 	AzBlobAccessTier                 string
 	AzObjectPrefix                   string
 	AzEndpoint                       string
+	StorePluginPath                  string
 	EnabledHooksString               string
 	PluginHookPath                   string
 	FileHooksDir                     string
+	HooksPayloadVersion              int
 	HttpHooksEndpoint                string
+	HttpHooksEndpoints               string
 	HttpHooksForwardHeaders          string
 	HttpHooksRetry                   int
 	HttpHooksBackoff                 time.Duration
+	HttpHooksTLSCertFile             string
+	HttpHooksTLSKeyFile              string
+	HttpHooksTLSCAFile               string
 	GrpcHooksEndpoint                string
 	GrpcHooksRetry                   int
 	GrpcHooksBackoff                 time.Duration
@@ -59,11 +121,19 @@ var Flags struct {
 	ShowVersion                      bool
 	ExposeMetrics                    bool
 	MetricsPath                      string
+	MetricsPushGateway               string
+	MetricsStatsdAddress             string
+	MetricsStatsdTags                bool
+	MetricsPushInterval              time.Duration
+	MetricsPushPrefix                string
 	ExposePprof                      bool
 	PprofPath                        string
 	PprofBlockProfileRate            int
 	PprofMutexProfileRate            int
 	BehindProxy                      bool
+	StrictRequests                   bool
+	IPv6PrefixLength                 int
+	MaxHeaderSize                    int
 	VerboseOutput                    bool
 	S3TransferAcceleration           bool
 	TLSCertFile                      string
@@ -75,6 +145,53 @@ var Flags struct {
 	FilelockAcquirerPollInterval     time.Duration
 	GracefulRequestCompletionTimeout time.Duration
 	ExperimentalProtocol             bool
+	AdminHost                        string
+	AdminPort                        string
+	AdminUI                          bool
+	AdminDiagnostics                 bool
+	AdminOIDCIssuer                  string
+	AdminOIDCAudience                string
+	AdminOIDCRolesClaim              string
+	IdempotencyKeyTTL                time.Duration
+	CaptureHeaders                   string
+	ProtocolVersions                 string
+	StoreCapturedHeaders             bool
+	AcceptEncryptionKeys             bool
+	DecompressRequestBodies          bool
+	MaxDecompressionRatio            int64
+	SampleUploadsEndpoint            string
+	SampleUploadsRate                float64
+	SampleUploadsSize                int64
+	SampleUploadsMetadata            string
+	SampleUploadsOptOutKey           string
+	AuditLog                         string
+	AccessLog                        string
+	AccessLogFormat                  string
+	UploadIndex                      string
+	ResumeDiscovery                  bool
+	Principal                        string
+	AllowUnverifiedJWTClaims         bool
+	TenantsConfig                    string
+	Maintenance                      bool
+	MaintenanceMessage               string
+	MaintenanceRetryAfter            time.Duration
+	MaintenanceWindows               string
+	ByteBudgetSoft                   int64
+	ByteBudgetHard                   int64
+	StoreCircuitBreaker              bool
+	StoreCircuitWindow               time.Duration
+	StoreCircuitMinRequests          int
+	StoreCircuitErrorRate            float64
+	StoreCircuitSlowCallDuration     time.Duration
+	StoreCircuitSlowRate             float64
+	StoreCircuitOpenDuration         time.Duration
+	ChaosLatency                     time.Duration
+	ChaosLatencyJitter               time.Duration
+	ChaosErrorRate                   float64
+	ChaosPartialWriteRate            float64
+	ChaosOperations                  string
+	TestScenarios                    bool
+	WindowsServiceName               string
 }
 
 func ParseFlags() {
@@ -86,6 +203,9 @@ func ParseFlags() {
 		f.StringVar(&Flags.HttpSock, "unix-sock", "", "If set, will listen to a UNIX socket at this location instead of a TCP socket")
 		f.StringVar(&Flags.Basepath, "base-path", "/files/", "Basepath of the HTTP server")
 		f.BoolVar(&Flags.BehindProxy, "behind-proxy", false, "Respect X-Forwarded-* and similar headers which may be set by proxies")
+		f.IntVar(&Flags.IPv6PrefixLength, "ipv6-prefix-length", 64, "Number of leading bits of IPv6 addresses, by which clients are combined in logs and per-client limits, since clients can usually choose any address in their network's prefix. Use 128 to treat every address as its own client")
+		f.BoolVar(&Flags.StrictRequests, "strict-requests", false, "Reject requests with an ambiguous body, such as HTTP/1.0 requests with a body or GET and DELETE requests including one, and requests repeating tus headers with differing values. Recommended if tusd is directly exposed to the internet or runs behind proxies parsing requests differently")
+		f.IntVar(&Flags.MaxHeaderSize, "max-header-size", 0, "Maximum size of the request headers in bytes. Larger requests are rejected with 431 Request Header Fields Too Large. If zero, Go's default limit of 1MB applies")
 	})
 
 	fs.AddGroup("TLS options", func(f *flag.FlagSet) {
@@ -98,7 +218,41 @@ func ParseFlags() {
 		f.BoolVar(&Flags.ExperimentalProtocol, "enable-experimental-protocol", false, "Enable support for the new resumable upload protocol draft from the IETF's HTTP working group, next to the current tus v1 protocol. (experimental and may be removed/changed in the future)")
 		f.BoolVar(&Flags.DisableDownload, "disable-download", false, "Disable the download endpoint")
 		f.BoolVar(&Flags.DisableTermination, "disable-termination", false, "Disable the termination endpoint")
+		f.StringVar(&Flags.HandlerMode, "handler-mode", "read-write", "Endpoints served by this instance: read-write for all, write-only for creating, resuming and terminating uploads without downloads, or read-only for downloads and HEAD requests only")
+		f.BoolVar(&Flags.RedirectDownloads, "redirect-downloads", false, "Redirect downloads of finished uploads to a pre-signed URL of the storage instead of serving them through tusd (only supported by the S3 storage)")
+		f.DurationVar(&Flags.DownloadURLExpiry, "download-url-expiry", 15*time.Minute, "Duration for which the pre-signed URLs used by -redirect-downloads are valid")
+		f.BoolVar(&Flags.PresignCompletedUploads, "presign-completed-uploads", false, "Include pre-signed GET and HEAD URLs for the uploaded object in the post-finish hook, so consumers do not need credentials for the storage (only supported by the S3 storage)")
+		f.DurationVar(&Flags.CompletedUploadURLExpiry, "completed-upload-url-expiry", 15*time.Minute, "Duration for which the pre-signed URLs included because of -presign-completed-uploads are valid")
+		f.BoolVar(&Flags.RequireDownloadTokens, "require-download-tokens", false, "Only allow downloads using one-time links created with the admin API. Requires the TUSD_DOWNLOAD_TOKEN_SECRET environment variable to be set")
+		f.BoolVar(&Flags.DirectPartUploads, "enable-direct-part-uploads", false, "Allow clients to request pre-signed URLs for uploading parts directly to the storage instead of sending them through tusd (only supported by the S3 storage and for clients using protocol version 1.1.0, experimental and may be removed/changed in the future)")
+		f.DurationVar(&Flags.PartURLExpiry, "part-url-expiry", 15*time.Minute, "Duration for which the pre-signed URLs used by -enable-direct-part-uploads are valid")
+		f.DurationVar(&Flags.UploadExpiry, "upload-expiry", 0, "Duration after which unfinished uploads expire. The expiration is extended while the upload receives data and by PATCH requests without a body. A zero value disables expiration")
+		f.StringVar(&Flags.PriorityMetadataKey, "priority-metadata-key", "", "Metadata key from which the priority of new uploads is read. Clients can only lower the priority of their uploads, higher priorities must be assigned by the pre-create hook. An empty value disables reading the priority from the metadata")
+		f.StringVar(&Flags.ChecksumMetadataKey, "checksum-metadata-key", "", "Metadata key in which clients can declare the checksum of the whole file when creating an upload, e.g. 'sha256 <base64>'. Completed uploads not matching the checksum are rejected with 460 Checksum Mismatch. An empty value disables the verification")
+		f.BoolVar(&Flags.DeduplicateChunks, "deduplicate-chunks", false, "Remember a hash of the last chunk written to each upload, so that identical data retransmitted by clients after a failed PATCH request is acknowledged without writing it to the storage again")
+		f.DurationVar(&Flags.DeduplicationTTL, "deduplication-ttl", 1*time.Hour, "Duration for which -deduplicate-chunks remembers the hash of an upload's last chunk")
+		f.BoolVar(&Flags.SkipReceivedPrefix, "skip-received-prefix", false, "Accept PATCH requests whose offset lies before the upload's offset by discarding the data the upload already contains, without comparing it. Only enable this if clients always send the same data for an offset")
+		f.BoolVar(&Flags.PipelinedPatches, "enable-pipelined-patches", false, "Let PATCH requests, which continue where another request still in progress on this instance ends, wait for it instead of interrupting it or failing with 409 Conflict. This allows clients to send the next chunk before the previous one has been acknowledged")
+		f.BoolVar(&Flags.AcceptPartialBodies, "accept-partial-bodies", false, "Acknowledge PATCH requests whose body ended prematurely, e.g. because a CDN cut off the request, with 204 No Content and the offset of the stored data instead of an error. Responses include the number of stored bytes in the Upload-Received header")
+		f.BoolVar(&Flags.ClientAbortStatusCodes, "client-abort-status-codes", false, "Respond to PATCH requests aborted by the client with 499 Client Closed Request and to PATCH requests whose body timed out with 598 Network Read Timeout instead of 400 or 500, as expected by many CDNs")
+		f.BoolVar(&Flags.EstimateUploadRate, "estimate-upload-rate", false, "Include the rate at which an unfinished upload recently received data and its estimated completion time in the Upload-Rate and Upload-Estimated-Completion headers of responses to PATCH and HEAD requests")
+		f.DurationVar(&Flags.MaxUploadWait, "max-upload-wait", 0, "Maximum duration for which HEAD requests with the Upload-Wait header wait for the upload to be finished. A zero value disables waiting")
+		f.BoolVar(&Flags.RemoteFetch, "enable-remote-fetch", false, "Allow clients to create uploads from a URL in the Upload-Source-Url header, whose content is downloaded by tusd. Connections to loopback, private and link-local addresses are refused")
+		f.StringVar(&Flags.RemoteFetchAllowedHosts, "remote-fetch-allowed-hosts", "", "Comma-separated list of hosts from which -enable-remote-fetch may download content. Entries starting with a dot also match all subdomains. If empty, all hosts are allowed")
+		f.IntVar(&Flags.RemoteFetchRetries, "remote-fetch-retries", 3, "Number of times an interrupted download of -enable-remote-fetch is resumed")
+		f.StringVar(&Flags.MetadataRules, "metadata-rules", "", "Path to a JSON file containing a list of rules, which rename, default, coerce or drop metadata keys of new uploads before the pre-create hook is invoked. Disabled if empty")
+		f.StringVar(&Flags.ResponseHeadersConfig, "response-headers-config", "", "Path to a JSON file containing additional headers, e.g. security headers, for all responses or for the creation, upload, download and admin requests. Disabled if empty")
 		f.Int64Var(&Flags.MaxSize, "max-size", 0, "Maximum size of a single upload in bytes")
+		f.DurationVar(&Flags.IdempotencyKeyTTL, "idempotency-key-ttl", 0, "Duration for which the Idempotency-Key header of upload creation requests is remembered, so that retried requests return the existing upload. A zero value disables support for the header")
+		f.BoolVar(&Flags.ResumeDiscovery, "enable-resume-discovery", false, "Allow clients to look up the URLs of their unfinished uploads of a file by posting its filename, size and hash to the resume endpoint, e.g. after being reinstalled. Requires -upload-index and -principal")
+		f.StringVar(&Flags.Principal, "principal", "", "How the user on whose behalf a request is made is identified, so that uploads can be attributed to them in the upload index: header:<name> or jwt-claim:<claim> (requires -allow-unverified-jwt-claims). The header or token must be verified by a proxy in front of tusd. Disabled if empty")
+		f.BoolVar(&Flags.AllowUnverifiedJWTClaims, "allow-unverified-jwt-claims", false, "Allow -principal and the resolver of -tenants-config to read a claim of a JSON Web Token (jwt-claim:<claim>), whose signature tusd does not verify. Only set this if a proxy in front of tusd verifies the token and rejects requests with invalid tokens")
+		f.StringVar(&Flags.ProtocolVersions, "protocol-versions", "1.0.0", "Comma-separated list of tus protocol versions accepted from clients in order of preference. Version 1.1.0 is a draft, which enables experimental extensions, such as -enable-direct-part-uploads, for clients using it")
+		f.StringVar(&Flags.CaptureHeaders, "capture-headers", "", "Comma-separated list of request headers which are captured and made available to hooks and storages")
+		f.BoolVar(&Flags.StoreCapturedHeaders, "store-captured-headers", false, "Store the captured headers of the upload creation request in the upload's metadata using the header- prefix, e.g. header-x-tenant-id. Metadata is visible to clients, so do not store sensitive headers")
+		f.BoolVar(&Flags.AcceptEncryptionKeys, "accept-encryption-keys", false, "Allow clients to encrypt their uploads with their own key sent in the Upload-Encryption-Key header of every request. The key is passed to the storage, but never persisted. Only supported by the S3 storage (SSE-C)")
+		f.BoolVar(&Flags.DecompressRequestBodies, "decompress-request-bodies", false, "Accept PATCH requests whose body is compressed using gzip, as indicated by the Content-Encoding header. Offsets refer to the decompressed data")
+		f.Int64Var(&Flags.MaxDecompressionRatio, "max-decompression-ratio", 100, "Maximum ratio between the decompressed and compressed size of a request body when using -decompress-request-bodies. Protects against decompression bombs")
 	})
 
 	fs.AddGroup("CORS options", func(f *flag.FlagSet) {
@@ -120,12 +274,44 @@ func ParseFlags() {
 	fs.AddGroup("AWS S3 storage options", func(f *flag.FlagSet) {
 		f.StringVar(&Flags.S3Bucket, "s3-bucket", "", "Use AWS S3 with this bucket as storage backend (requires the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_REGION environment variables to be set)")
 		f.StringVar(&Flags.S3ObjectPrefix, "s3-object-prefix", "", "Prefix for S3 object names")
+		f.IntVar(&Flags.S3PrefixShards, "s3-prefix-shards", 0, "Distribute the objects of new uploads across this many hashed prefixes below -s3-object-prefix, e.g. 16 for the prefixes 0/ to f/, to avoid S3's request rate limits per prefix. Can only be changed while sharded uploads exist if -s3-metadata-store is used. Use 0 to disable sharding")
 		f.StringVar(&Flags.S3Endpoint, "s3-endpoint", "", "Endpoint to use S3 compatible implementations like minio (requires s3-bucket to be pass)")
 		f.Int64Var(&Flags.S3PartSize, "s3-part-size", 50*1024*1024, "Size in bytes of the individual upload requests made to the S3 API. Defaults to 50MiB (experimental and may be removed in the future)")
 		f.Int64Var(&Flags.S3MaxBufferedParts, "s3-max-buffered-parts", 20, "Size in bytes of the individual upload requests made to the S3 API. Defaults to 50MiB (experimental and may be removed in the future)")
+		f.Int64Var(&Flags.S3TempMaxBytes, "s3-temp-max-bytes", 0, "Maximum number of bytes staged in temporary files on disk across all uploads. Part uploads wait until enough space is free. Defaults to no limit")
+		f.Int64Var(&Flags.S3TempMaxFiles, "s3-temp-max-files", 0, "Maximum number of temporary files staged on disk across all uploads. Part uploads wait until a file is removed. Defaults to no limit")
+		f.DurationVar(&Flags.S3TempFileMaxAge, "s3-temp-file-max-age", 24*time.Hour, "Remove temporary files left behind by previous runs once they are older than this duration, on startup and periodically. Use 0 to disable the removal")
+		f.DurationVar(&Flags.S3LifecycleInterval, "s3-lifecycle-interval", 0, "Analyze the unfinished multipart uploads in the bucket on startup and then at this interval, and report those older than -s3-lifecycle-max-age together with the estimated reclaimable storage as metrics, log entries and in the admin API. Use 0 to disable the analysis")
+		f.DurationVar(&Flags.S3LifecycleMaxAge, "s3-lifecycle-max-age", 7*24*time.Hour, "Age after which unfinished multipart uploads are considered stale by -s3-lifecycle-interval. Should be longer than -upload-expiry")
+		f.BoolVar(&Flags.S3LifecycleApply, "s3-lifecycle-apply", false, "Terminate the stale uploads found by -s3-lifecycle-interval, including their parts and .info and .part objects. Clients can no longer resume them")
 		f.BoolVar(&Flags.S3DisableContentHashes, "s3-disable-content-hashes", false, "Disable the calculation of MD5 and SHA256 hashes for the content that gets uploaded to S3 for minimized CPU usage (experimental and may be removed in the future)")
+		f.StringVar(&Flags.S3ChecksumAlgorithm, "s3-checksum-algorithm", "", "Checksum calculated for every part while it is sent to S3 and verified when the upload is finished, either crc32, crc32c, sha1 or sha256. crc32c requires the least CPU. If empty, the SHA256 hash is calculated before sending the part")
+		f.BoolVar(&Flags.S3SkipMultipartForSmallUploads, "s3-skip-multipart-for-small-uploads", false, "Store uploads smaller than the minimum part size using a single PutObject request instead of a multipart upload (experimental and may be removed in the future)")
+		f.BoolVar(&Flags.S3PreventOverwrite, "s3-prevent-overwrite", false, "Reject upload creation if an object with the upload's ID already exists, useful if IDs are assigned by the pre-create hook")
+		f.BoolVar(&Flags.S3ObjectHeadersFromMetadata, "s3-object-headers-from-metadata", false, "Set the Cache-Control, Content-Disposition and Content-Encoding headers of finished objects from the upload's metadata (cache-control, content-disposition, content-encoding and filename)")
+		f.StringVar(&Flags.S3CacheControl, "s3-cache-control", "", "Cache-Control header for finished objects, unless provided by the upload's metadata")
+		f.StringVar(&Flags.S3PointerObjectKey, "s3-pointer-object-key", "", "Key below -s3-object-prefix of a JSON object, which is written once an upload is finished and points to the upload's object, e.g. by-name/{{user}}/{{filename}}. The placeholders are replaced with the upload's metadata. Disabled if empty")
+		f.StringVar(&Flags.S3StorageClass, "s3-storage-class", "", "Storage class of finished objects, e.g. STANDARD_IA, GLACIER or DEEP_ARCHIVE. Finished uploads in GLACIER or DEEP_ARCHIVE must be restored before they can be downloaded and cannot be terminated. Defaults to the bucket's default class")
+		f.IntVar(&Flags.S3MaxMetadataSize, "s3-max-metadata-size", 0, "Maximum size of the object metadata in bytes. Uploads with larger metadata are rejected at creation, unless -s3-metadata-overflow is set. Should be set to the limit of the S3 server, e.g. 2048 for AWS S3 or 8192 for Cloudflare R2. Disabled if zero")
+		f.BoolVar(&Flags.S3MetadataOverflow, "s3-metadata-overflow", false, "Accept uploads whose metadata exceeds -s3-max-metadata-size. The complete metadata is only stored in the .info object, while the final object receives as many keys as fit")
+		f.StringVar(&Flags.S3Compatibility, "s3-compatibility", "aws", "Adjust requests to the behavior of the S3 server, either aws, minio (uses trailing checksums and works around differences of some MinIO versions), r2 (adjusts limits and part handling for Cloudflare R2) or generic (conservative profile for other S3-compatible servers)")
+		f.IntVar(&Flags.S3InfoObjectChecks, "s3-info-object-checks", 0, "Check up to this many times whether the .info object of a new upload is visible before responding to its creation, for S3 servers which are not read-after-write consistent for new objects. Defaults to no checks")
+		f.DurationVar(&Flags.S3InfoObjectCheckDelay, "s3-info-object-check-delay", 200*time.Millisecond, "Duration to wait between checks for the .info object of a new upload, see -s3-info-object-checks")
+		f.StringVar(&Flags.S3MetadataStore, "s3-metadata-store", "", "Keep the information about uploads in a database instead of .info objects, so that concurrent requests cannot overwrite each other's changes: memory, dynamodb:<table> for an Amazon DynamoDB table, or <driver>:<data source name> for an SQLite or PostgreSQL database, e.g. postgres:postgres://tusd@localhost/tusd. The SQL driver must be linked into the binary. Defaults to .info objects")
+		f.BoolVar(&Flags.S3ConditionalInfoWrites, "s3-conditional-info-writes", false, "Replace .info objects only if they have not been changed by another request since they were read, using If-Match. Conflicting requests fail with ERR_INFO_CONFLICT instead of overwriting each other's changes. Requires an S3 server supporting conditional writes")
 		f.BoolVar(&Flags.S3DisableSSL, "s3-disable-ssl", false, "Disable SSL and only use HTTP for communication with S3 (experimental and may be removed in the future)")
 		f.IntVar(&Flags.S3ConcurrentPartUploads, "s3-concurrent-part-uploads", 10, "Number of concurrent part uploads to S3 (experimental and may be removed in the future)")
+		f.IntVar(&Flags.S3ConcurrentDownloadRanges, "s3-concurrent-download-ranges", 1, "Number of ranges fetched concurrently from S3 ahead of the client when downloading finished uploads through tusd, which improves the throughput if the latency to S3 is high. Up to this number of ranges is buffered in memory per download")
+		f.Int64Var(&Flags.S3DownloadRangeSize, "s3-download-range-size", 16*1024*1024, "Size in bytes of the ranges fetched concurrently from S3, see -s3-concurrent-download-ranges")
+		f.BoolVar(&Flags.S3AdaptivePartUploads, "s3-adaptive-part-uploads", false, "Adjust the number of concurrent part uploads to S3 between 1 and -s3-concurrent-part-uploads based on the observed speed and errors (experimental and may be removed in the future)")
+		f.IntVar(&Flags.S3ConcurrentDeletes, "s3-concurrent-deletes", 4, "Number of concurrent delete requests to S3 when terminating uploads, shared by all terminations")
+		f.IntVar(&Flags.S3MaxIdleConns, "s3-max-idle-conns", 100, "Maximum number of idle connections to S3 kept in the connection pool")
+		f.IntVar(&Flags.S3MaxIdleConnsPerHost, "s3-max-idle-conns-per-host", 10, "Maximum number of idle connections to each S3 host kept in the connection pool. Raise this value together with -s3-concurrent-part-uploads, so that part uploads reuse connections")
+		f.IntVar(&Flags.S3MaxConnsPerHost, "s3-max-conns-per-host", 0, "Maximum number of connections to each S3 host, including those in use. Defaults to no limit")
+		f.DurationVar(&Flags.S3IdleConnTimeout, "s3-idle-conn-timeout", 90*time.Second, "Duration after which idle connections to S3 are closed")
+		f.DurationVar(&Flags.S3DialTimeout, "s3-dial-timeout", 30*time.Second, "Timeout for establishing a connection to S3")
+		f.DurationVar(&Flags.S3TLSHandshakeTimeout, "s3-tls-handshake-timeout", 10*time.Second, "Timeout for the TLS handshake with S3")
+		f.BoolVar(&Flags.S3DisableHTTP2, "s3-disable-http2", false, "Use HTTP/1.1 instead of HTTP/2 for connections to S3")
 		f.BoolVar(&Flags.S3TransferAcceleration, "s3-transfer-acceleration", false, "Use AWS S3 transfer acceleration endpoint (requires -s3-bucket option and Transfer Acceleration property on S3 bucket to be set)")
 	})
 
@@ -142,9 +328,24 @@ func ParseFlags() {
 		f.StringVar(&Flags.AzEndpoint, "azure-endpoint", "", "Custom Endpoint to use for Azure BlockBlob Storage (requires azure-storage to be pass)")
 	})
 
+	fs.AddGroup("Plugin storage options", func(f *flag.FlagSet) {
+		f.StringVar(&Flags.StorePluginPath, "store-plugin", "", "Path to an executable which implements the storage backend as a plugin, communicating with tusd over gRPC")
+	})
+
+	fs.AddGroup("Storage circuit breaker options", func(f *flag.FlagSet) {
+		f.BoolVar(&Flags.StoreCircuitBreaker, "store-circuit-breaker", false, "Reject new uploads with 503 Service Unavailable while too many storage operations fail or are slow. Uploads in progress are not affected")
+		f.DurationVar(&Flags.StoreCircuitWindow, "store-circuit-window", 1*time.Minute, "Duration over which the storage operations are considered by the circuit breaker")
+		f.IntVar(&Flags.StoreCircuitMinRequests, "store-circuit-min-requests", 20, "Number of storage operations within the window, which are required before the circuit breaker can open")
+		f.Float64Var(&Flags.StoreCircuitErrorRate, "store-circuit-error-rate", 0.5, "Fraction between 0 and 1 of failed storage operations, at which the circuit breaker opens")
+		f.DurationVar(&Flags.StoreCircuitSlowCallDuration, "store-circuit-slow-call-duration", 10*time.Second, "Duration after which a storage operation is considered slow. Transfers of upload data are never considered slow")
+		f.Float64Var(&Flags.StoreCircuitSlowRate, "store-circuit-slow-rate", 0, "Fraction between 0 and 1 of slow storage operations, at which the circuit breaker opens. Slow operations are ignored if zero")
+		f.DurationVar(&Flags.StoreCircuitOpenDuration, "store-circuit-open-duration", 30*time.Second, "Duration for which new uploads are rejected after the circuit breaker opened, before new uploads are accepted again to probe the storage")
+	})
+
 	fs.AddGroup("General hook options", func(f *flag.FlagSet) {
 		f.StringVar(&Flags.EnabledHooksString, "hooks-enabled-events", "pre-create,post-create,post-receive,post-terminate,post-finish", "Comma separated list of enabled hook events (e.g. post-create,post-finish). Leave empty to enable default events")
 		f.DurationVar(&Flags.ProgressHooksInterval, "progress-hooks-interval", 1*time.Second, "Interval at which the post-receive progress hooks are emitted for each active upload")
+		f.IntVar(&Flags.HooksPayloadVersion, "hooks-payload-version", 1, "Version of the JSON payload sent to file and HTTP hooks (1 or 2)")
 	})
 
 	fs.AddGroup("File hook options", func(f *flag.FlagSet) {
@@ -153,9 +354,13 @@ func ParseFlags() {
 
 	fs.AddGroup("HTTP hook options", func(f *flag.FlagSet) {
 		f.StringVar(&Flags.HttpHooksEndpoint, "hooks-http", "", "An HTTP endpoint to which hook events will be sent to")
+		f.StringVar(&Flags.HttpHooksEndpoints, "hooks-http-endpoints", "", "Path to a JSON file mapping hook events to the HTTP endpoints, to which they are sent instead of -hooks-http. The URLs may contain placeholders, such as {{tenant}}, which are replaced with the upload's metadata. An empty URL disables the event")
 		f.StringVar(&Flags.HttpHooksForwardHeaders, "hooks-http-forward-headers", "", "List of HTTP request headers to be forwarded from the client request to the hook endpoint")
 		f.IntVar(&Flags.HttpHooksRetry, "hooks-http-retry", 3, "Number of times to retry on a 500 or network timeout")
 		f.DurationVar(&Flags.HttpHooksBackoff, "hooks-http-backoff", 1*time.Second, "Wait period before retrying each retry")
+		f.StringVar(&Flags.HttpHooksTLSCertFile, "hooks-http-tls-certificate", "", "Path to the file containing the x509 client certificate presented to the hook endpoint for mutual TLS")
+		f.StringVar(&Flags.HttpHooksTLSKeyFile, "hooks-http-tls-key", "", "Path to the file containing the key for the hook client certificate")
+		f.StringVar(&Flags.HttpHooksTLSCAFile, "hooks-http-tls-ca", "", "Path to the file containing the CA certificates used to verify the hook endpoint's certificate instead of the system's CAs")
 	})
 
 	fs.AddGroup("gRPC hook options", func(f *flag.FlagSet) {
@@ -168,9 +373,30 @@ func ParseFlags() {
 		f.StringVar(&Flags.PluginHookPath, "hooks-plugin", "", "Path to a Go plugin for loading hook functions")
 	})
 
+	fs.AddGroup("Multi-tenancy options", func(f *flag.FlagSet) {
+		f.StringVar(&Flags.TenantsConfig, "tenants-config", "", "Path to a JSON file configuring the tenants, which share this tusd instance, including how requests are assigned to them and their storage locations, limits and hook endpoints. Can not be combined with -admin-port, since the admin interface serves a single handler. Disabled if empty")
+	})
+
+	fs.AddGroup("Maintenance options", func(f *flag.FlagSet) {
+		f.BoolVar(&Flags.Maintenance, "maintenance", false, "Reject new uploads with 503 Service Unavailable, while uploads which have already been created can finish. Can also be changed at runtime using the admin API")
+		f.StringVar(&Flags.MaintenanceMessage, "maintenance-message", "", "Message sent to clients whose uploads are rejected during maintenance, instead of the default one")
+		f.DurationVar(&Flags.MaintenanceRetryAfter, "maintenance-retry-after", 0, "Duration sent in the Retry-After header while -maintenance is enabled. Omitted if zero")
+		f.StringVar(&Flags.MaintenanceWindows, "maintenance-windows", "", "Comma-separated list of periods, in which new uploads are rejected, as RFC 3339 start and end times separated by a slash, e.g. 2024-03-01T22:00:00Z/2024-03-02T02:00:00Z")
+	})
+
+	fs.AddGroup("Transfer budget options", func(f *flag.FlagSet) {
+		f.Int64Var(&Flags.ByteBudgetSoft, "byte-budget-soft", 0, "Number of bytes written to and read from each bucket per calendar month (UTC), after which the budget-exceeded hook is invoked once. The counters are kept in memory per instance. Disabled if zero")
+		f.Int64Var(&Flags.ByteBudgetHard, "byte-budget-hard", 0, "Number of bytes written to and read from each bucket per calendar month (UTC), after which new uploads are rejected with 429 Too Many Requests until the next month. Existing uploads can still be resumed and downloaded. Disabled if zero")
+	})
+
 	fs.AddGroup("Monitoring, profiling, logging options", func(f *flag.FlagSet) {
 		f.BoolVar(&Flags.ExposeMetrics, "expose-metrics", true, "Expose metrics about tusd usage")
 		f.StringVar(&Flags.MetricsPath, "metrics-path", "/metrics", "Path under which the metrics endpoint will be accessible")
+		f.StringVar(&Flags.MetricsPushGateway, "metrics-push-gateway", "", "URL of a Prometheus Pushgateway, to which the metrics are pushed periodically, e.g. http://pushgateway:9091. Disabled if empty")
+		f.StringVar(&Flags.MetricsStatsdAddress, "metrics-statsd", "", "Address of a StatsD or Datadog agent, to which the metrics are sent periodically using UDP, e.g. localhost:8125. Disabled if empty")
+		f.BoolVar(&Flags.MetricsStatsdTags, "metrics-statsd-tags", false, "Send metric labels as DogStatsD tags instead of appending them to the metric names")
+		f.DurationVar(&Flags.MetricsPushInterval, "metrics-push-interval", 15*time.Second, "Interval in which metrics are pushed to the Pushgateway or StatsD agent")
+		f.StringVar(&Flags.MetricsPushPrefix, "metrics-push-prefix", "tusd", "Prefix of the metric names sent to the StatsD agent")
 		f.BoolVar(&Flags.ExposePprof, "expose-pprof", false, "Expose the pprof interface over HTTP for profiling tusd")
 		f.StringVar(&Flags.PprofPath, "pprof-path", "/debug/pprof/", "Path under which the pprof endpoint will be accessible")
 		f.IntVar(&Flags.PprofBlockProfileRate, "pprof-block-profile-rate", 0, "Fraction of goroutine blocking events that are reported in the blocking profile")
@@ -178,6 +404,41 @@ func ParseFlags() {
 		f.BoolVar(&Flags.ShowGreeting, "show-greeting", true, "Show the greeting message")
 		f.BoolVar(&Flags.ShowVersion, "version", false, "Print tusd version information")
 		f.BoolVar(&Flags.VerboseOutput, "verbose", true, "Enable verbose logging output")
+		f.StringVar(&Flags.AccessLog, "access-log", "", "Destination for a log entry per request containing its method, upload ID, status, transferred bytes and durations, independent of -verbose: stdout, stderr or a file path. Disabled if empty")
+		f.StringVar(&Flags.AccessLogFormat, "access-log-format", "json", "Format of the access log: json or combined (Apache's combined log format, which omits the upload ID and durations)")
+		f.StringVar(&Flags.AuditLog, "audit-log", "", "Destination for a tamper-evident log of all POST, PATCH and DELETE requests and admin actions: a file path, syslog, syslog://host:port, syslog+tcp://host:port or an http(s):// URL. Disabled if empty")
+	})
+
+	fs.AddGroup("Upload sampling options", func(f *flag.FlagSet) {
+		f.StringVar(&Flags.SampleUploadsEndpoint, "sample-uploads-endpoint", "", "URL to which the beginning of a fraction of uploads is sent in the background, e.g. for classifying their content. Disabled if empty")
+		f.Float64Var(&Flags.SampleUploadsRate, "sample-uploads-rate", 0.01, "Fraction of uploads, which are sampled, between 0 and 1")
+		f.Int64Var(&Flags.SampleUploadsSize, "sample-uploads-size", 64*1024, "Number of bytes sampled from the beginning of an upload")
+		f.StringVar(&Flags.SampleUploadsMetadata, "sample-uploads-metadata", "", "Comma-separated list of metadata keys, which are included in samples. No metadata is included by default")
+		f.StringVar(&Flags.SampleUploadsOptOutKey, "sample-uploads-opt-out-key", "no-sampling", "Metadata key, which excludes an upload from sampling if it is present. Can be set by clients or pre-create hooks. Disabled if empty")
+	})
+
+	fs.AddGroup("Admin options", func(f *flag.FlagSet) {
+		f.StringVar(&Flags.AdminHost, "admin-host", "127.0.0.1", "Host to bind the admin HTTP server to")
+		f.StringVar(&Flags.AdminPort, "admin-port", "", "Port to bind the admin HTTP server to. The admin server is disabled if no port is set. Credentials can be set using the TUSD_ADMIN_AUTH environment variable in the form of user:password and TUSD_ADMIN_TOKENS in the form of name:role:token")
+		f.BoolVar(&Flags.AdminUI, "admin-ui", true, "Serve a web interface for monitoring uploads on the admin HTTP server")
+		f.BoolVar(&Flags.AdminDiagnostics, "admin-diagnostics", false, "Enable the pprof, expvar and goroutine dump endpoints on the admin HTTP server at startup. They can also be enabled at runtime using the admin API")
+		f.StringVar(&Flags.AdminOIDCIssuer, "admin-oidc-issuer", "", "URL of an OpenID Connect provider, whose tokens are accepted as bearer tokens by the admin API, e.g. https://accounts.example.com. Disabled if empty")
+		f.StringVar(&Flags.AdminOIDCAudience, "admin-oidc-audience", "", "Audience, which must be included in the tokens of the OpenID Connect provider, e.g. the client ID. Required if -admin-oidc-issuer is set")
+		f.StringVar(&Flags.AdminOIDCRolesClaim, "admin-oidc-roles-claim", "roles", "Claim of the OpenID Connect tokens containing the admin roles (read-only, operator or admin). Nested claims are separated using dots, e.g. realm_access.roles")
+		f.StringVar(&Flags.UploadIndex, "upload-index", "", "Keep an index of all uploads, which can be searched by tags, metadata, state and creation time using the admin API: memory, bolt:<path> for an embedded BoltDB file or <driver>:<data source name> for an SQLite or PostgreSQL database, e.g. sqlite3:/var/lib/tusd/index.db. The SQL driver must be linked into the binary. Disabled if empty")
+	})
+
+	fs.AddGroup("Fault injection options (for testing only)", func(f *flag.FlagSet) {
+		f.DurationVar(&Flags.ChaosLatency, "chaos-latency", 0, "Delay added to every storage operation")
+		f.DurationVar(&Flags.ChaosLatencyJitter, "chaos-latency-jitter", 0, "Maximum random delay added to -chaos-latency")
+		f.Float64Var(&Flags.ChaosErrorRate, "chaos-error-rate", 0, "Probability between 0 and 1 with which a storage operation fails with 500 Internal Server Error")
+		f.Float64Var(&Flags.ChaosPartialWriteRate, "chaos-partial-write-rate", 0, "Probability between 0 and 1 with which a PATCH request is cut off after a part of its data has been stored")
+		f.StringVar(&Flags.ChaosOperations, "chaos-operations", "", "Comma-separated list of storage operations affected by fault injection, e.g. WriteChunk,GetInfo. Leave empty to affect all operations")
+		f.BoolVar(&Flags.TestScenarios, "test-scenarios", false, "Let clients simulate failures, such as dropped connections, delays and error responses, using the Tusd-Test request header, for testing tus client implementations")
+	})
+
+	fs.AddGroup("Windows service options", func(f *flag.FlagSet) {
+		f.StringVar(&Flags.WindowsServiceName, "windows-service-name", "tusd", "Name of the Windows service and the event log source, to which tusd writes its output when started by the service control manager. Set by tusd service install")
 	})
 
 	fs.AddGroup("Timeout options", func(f *flag.FlagSet) {
@@ -191,6 +452,10 @@ func ParseFlags() {
 
 	SetEnabledHooks()
 
+	if err := hooks.ValidatePayloadVersion(Flags.HooksPayloadVersion); err != nil {
+		stderr.Fatalf("Invalid -hooks-payload-version flag: %s", err)
+	}
+
 	if Flags.FileHooksDir != "" {
 		Flags.FileHooksDir, _ = filepath.Abs(Flags.FileHooksDir)
 	}
@@ -0,0 +1,45 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/tus/tusd/v2/pkg/hooks"
+)
+
+// HookSchemas writes the JSON Schemas of all hook payload versions into a
+// directory. It is invoked using `tusd hook-schemas [-dir ./schemas]` and is
+// used to update the schemas published in docs/schemas.
+func HookSchemas(args []string) {
+	f := flag.NewFlagSet("tusd hook-schemas", flag.ExitOnError)
+	dir := f.String("dir", ".", "Directory to write the schemas to")
+	f.Parse(args)
+
+	if err := os.MkdirAll(*dir, 0755); err != nil {
+		stderr.Fatalf("Unable to create directory: %s", err)
+	}
+
+	for _, version := range []int{hooks.PayloadV1, hooks.PayloadV2} {
+		request, err := hooks.RequestSchema(version)
+		if err != nil {
+			stderr.Fatalf("Unable to generate request schema: %s", err)
+		}
+		response, err := hooks.ResponseSchema(version)
+		if err != nil {
+			stderr.Fatalf("Unable to generate response schema: %s", err)
+		}
+
+		for name, schema := range map[string][]byte{
+			fmt.Sprintf("hook-request-v%d.json", version):  request,
+			fmt.Sprintf("hook-response-v%d.json", version): response,
+		} {
+			path := filepath.Join(*dir, name)
+			if err := os.WriteFile(path, schema, 0644); err != nil {
+				stderr.Fatalf("Unable to write schema: %s", err)
+			}
+			stdout.Printf("Wrote %s", path)
+		}
+	}
+}
@@ -1,6 +1,11 @@
 package cli
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"os"
 	"strings"
 
 	"github.com/tus/tusd/v2/pkg/handler"
@@ -16,17 +21,29 @@ func getHookHandler(config *handler.Config) hooks.HookHandler {
 		stdout.Printf("Using '%s' for hooks", Flags.FileHooksDir)
 
 		return &file.FileHook{
-			Directory: Flags.FileHooksDir,
+			Directory:      Flags.FileHooksDir,
+			PayloadVersion: Flags.HooksPayloadVersion,
+		}
+	} else if Flags.HttpHooksEndpoint != "" || Flags.HttpHooksEndpoints != "" {
+		hook := newHttpHook(Flags.HttpHooksEndpoint)
+		if Flags.HttpHooksEndpoint != "" {
+			stdout.Printf("Using '%s' as the endpoint for hooks", Flags.HttpHooksEndpoint)
 		}
-	} else if Flags.HttpHooksEndpoint != "" {
-		stdout.Printf("Using '%s' as the endpoint for hooks", Flags.HttpHooksEndpoint)
 
-		return &http.HttpHook{
-			Endpoint:       Flags.HttpHooksEndpoint,
-			MaxRetries:     Flags.HttpHooksRetry,
-			Backoff:        Flags.HttpHooksBackoff,
-			ForwardHeaders: strings.Split(Flags.HttpHooksForwardHeaders, ","),
+		if Flags.HttpHooksEndpoints != "" {
+			endpoints, err := loadHttpHookEndpoints(Flags.HttpHooksEndpoints)
+			if err != nil {
+				stderr.Fatalf("Unable to load hook endpoints from %s: %s", Flags.HttpHooksEndpoints, err)
+			}
+			for _, hookType := range hooks.AvailableHooks {
+				if endpoint, ok := endpoints[hookType]; ok {
+					stdout.Printf("Using '%s' as the endpoint for %s hooks", endpoint, hookType)
+				}
+			}
+			hook.Endpoints = endpoints
 		}
+
+		return hook
 	} else if Flags.GrpcHooksEndpoint != "" {
 		stdout.Printf("Using '%s' as the endpoint for gRPC hooks", Flags.GrpcHooksEndpoint)
 
@@ -45,3 +62,84 @@ func getHookHandler(config *handler.Config) hooks.HookHandler {
 		return nil
 	}
 }
+
+// newHttpHook creates a hook handler for the given endpoint using the options
+// of the -hooks-http-* flags.
+func newHttpHook(endpoint string) *http.HttpHook {
+	hook := &http.HttpHook{
+		Endpoint:       endpoint,
+		MaxRetries:     Flags.HttpHooksRetry,
+		Backoff:        Flags.HttpHooksBackoff,
+		ForwardHeaders: strings.Split(Flags.HttpHooksForwardHeaders, ","),
+		PayloadVersion: Flags.HooksPayloadVersion,
+	}
+
+	// Like the download token secret, the signing secret is not passed as a
+	// flag, so that it does not appear in the process list.
+	if secret := os.Getenv("TUSD_HOOKS_HTTP_SECRET"); secret != "" {
+		hook.Secret = []byte(secret)
+	}
+
+	tlsConfig, err := httpHookTLSConfig()
+	if err != nil {
+		stderr.Fatalf("Unable to load TLS configuration for HTTP hooks: %s", err)
+	}
+	hook.TLSConfig = tlsConfig
+
+	return hook
+}
+
+// loadHttpHookEndpoints reads the per-event endpoints for HTTP hooks from the
+// JSON file at the given path.
+func loadHttpHookEndpoints(filePath string) (map[hooks.HookType]string, error) {
+	var endpoints map[hooks.HookType]string
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	if err := json.NewDecoder(file).Decode(&endpoints); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	if err := http.ValidateEndpoints(endpoints); err != nil {
+		return nil, err
+	}
+
+	return endpoints, nil
+}
+
+// httpHookTLSConfig loads the client certificate and CA certificates for HTTP
+// hooks. It returns nil if neither is configured.
+func httpHookTLSConfig() (*tls.Config, error) {
+	if Flags.HttpHooksTLSCertFile == "" && Flags.HttpHooksTLSKeyFile == "" && Flags.HttpHooksTLSCAFile == "" {
+		return nil, nil
+	}
+
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if Flags.HttpHooksTLSCertFile != "" || Flags.HttpHooksTLSKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(Flags.HttpHooksTLSCertFile, Flags.HttpHooksTLSKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	if Flags.HttpHooksTLSCAFile != "" {
+		pem, err := os.ReadFile(Flags.HttpHooksTLSCAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", Flags.HttpHooksTLSCAFile)
+		}
+		config.RootCAs = pool
+	}
+
+	return config, nil
+}
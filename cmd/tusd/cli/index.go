@@ -0,0 +1,149 @@
+package cli
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tus/tusd/v2/pkg/boltindex"
+	"github.com/tus/tusd/v2/pkg/dynamometa"
+	tushandler "github.com/tus/tusd/v2/pkg/handler"
+	"github.com/tus/tusd/v2/pkg/sqlindex"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+// expirationSweepInterval is the interval in which expired uploads are looked
+// up in the upload index and terminated.
+const expirationSweepInterval = time.Minute
+
+// uploadIndex records the uploads for searching them using the admin API, if
+// enabled.
+var uploadIndex tushandler.UploadIndex
+
+// sqlDialects maps the names of common database/sql drivers to the dialect
+// they speak.
+var sqlDialects = map[string]sqlindex.Dialect{
+	"sqlite":   sqlindex.SQLite,
+	"sqlite3":  sqlindex.SQLite,
+	"postgres": sqlindex.Postgres,
+	"pgx":      sqlindex.Postgres,
+}
+
+func setupUploadIndex() {
+	if Flags.UploadIndex == "memory" {
+		stdout.Printf("Using in-memory upload index.\n")
+		uploadIndex = tushandler.NewMemoryUploadIndex()
+		return
+	}
+
+	if path, ok := strings.CutPrefix(Flags.UploadIndex, "bolt:"); ok {
+		index, err := boltindex.Open(path)
+		if err != nil {
+			stderr.Fatalf("Unable to open upload index: %s", err)
+		}
+
+		stdout.Printf("Using '%s' as upload index.\n", path)
+		uploadIndex = index
+		return
+	}
+
+	db, dialect := openDatabase("upload-index", Flags.UploadIndex)
+	index := sqlindex.New(db, dialect)
+	if err := index.CreateTables(context.Background()); err != nil {
+		stderr.Fatalf("Unable to set up upload index: %s", err)
+	}
+
+	stdout.Printf("Using %s database as upload index.\n", dialect)
+	uploadIndex = index
+}
+
+// terminateExpiredUploads periodically terminates the uploads, which the upload
+// index reports as expired, until ctx is cancelled.
+func terminateExpiredUploads(ctx context.Context, handler *tushandler.Handler) {
+	ticker := time.NewTicker(expirationSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		ids, err := handler.TerminateExpiredUploads(ctx)
+		if len(ids) > 0 {
+			stdout.Printf("Terminated %d expired uploads.\n", len(ids))
+		}
+		if err != nil {
+			stderr.Printf("Unable to terminate expired uploads: %s\n", err)
+		}
+	}
+}
+
+var (
+	s3MetadataStore     tushandler.MetadataStore
+	s3MetadataStoreOnce sync.Once
+)
+
+// getS3MetadataStore returns the metadata store configured using
+// -s3-metadata-store, or nil. It is shared by all S3 stores, including those of
+// tenants, since the info is stored under the upload's object ID.
+func getS3MetadataStore() tushandler.MetadataStore {
+	s3MetadataStoreOnce.Do(func() {
+		if Flags.S3MetadataStore == "" {
+			return
+		}
+
+		if Flags.S3MetadataStore == "memory" {
+			stdout.Printf("Using in-memory metadata store for S3 uploads.\n")
+			s3MetadataStore = tushandler.NewMemoryMetadataStore()
+			return
+		}
+
+		if table, ok := strings.CutPrefix(Flags.S3MetadataStore, "dynamodb:"); ok {
+			// The client uses the same credential chain and region as the S3
+			// client, but not its endpoint.
+			awsConfig, err := config.LoadDefaultConfig(context.Background())
+			if err != nil {
+				stderr.Fatalf("Unable to load DynamoDB configuration: %s", err)
+			}
+
+			stdout.Printf("Using DynamoDB table '%s' as metadata store for S3 uploads.\n", table)
+			s3MetadataStore = dynamometa.New(table, dynamodb.NewFromConfig(awsConfig))
+			return
+		}
+
+		db, dialect := openDatabase("s3-metadata-store", Flags.S3MetadataStore)
+		store := sqlindex.NewMetadataStore(db, dialect)
+		if err := store.CreateTables(context.Background()); err != nil {
+			stderr.Fatalf("Unable to set up metadata store: %s", err)
+		}
+
+		stdout.Printf("Using %s database as metadata store for S3 uploads.\n", dialect)
+		s3MetadataStore = store
+	})
+
+	return s3MetadataStore
+}
+
+// openDatabase opens the database given as <driver>:<data source name> in the
+// flag with the given name.
+func openDatabase(flagName string, value string) (*sql.DB, sqlindex.Dialect) {
+	driver, dataSource, ok := strings.Cut(value, ":")
+	dialect, known := sqlDialects[driver]
+	if !ok || !known {
+		stderr.Fatalf("Invalid value for -%s: expected memory, sqlite3:<path> or postgres:<url>, got %q", flagName, value)
+	}
+
+	// sql.Open only fails if the driver is not registered.
+	db, err := sql.Open(driver, dataSource)
+	if err != nil {
+		stderr.Fatalf("Unable to open database for -%s: %s. This tusd binary does not include SQL drivers, they must be added in a custom build", flagName, err)
+	}
+
+	return db, dialect
+}
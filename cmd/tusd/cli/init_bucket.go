@@ -0,0 +1,399 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// initBucketFlags holds the options for the `tusd init-bucket` subcommand.
+var initBucketFlags struct {
+	Bucket         string
+	ObjectPrefix   string
+	Endpoint       string
+	Region         string
+	CorsOrigins    string
+	AbortAfterDays int
+	Fix            bool
+	DryRun         bool
+}
+
+// These IDs identify the CORS and lifecycle rules managed by `tusd init-bucket`,
+// so that they are replaced instead of duplicated when the bucket is updated.
+const (
+	bucketCorsRuleID      = "tusd"
+	bucketLifecycleRuleID = "tusd-abort-incomplete-multipart-uploads"
+)
+
+// bucketAPI contains the S3 operations used for checking and configuring a bucket.
+type bucketAPI interface {
+	HeadBucket(ctx context.Context, input *s3.HeadBucketInput, opt ...func(*s3.Options)) (*s3.HeadBucketOutput, error)
+	CreateBucket(ctx context.Context, input *s3.CreateBucketInput, opt ...func(*s3.Options)) (*s3.CreateBucketOutput, error)
+	GetBucketLocation(ctx context.Context, input *s3.GetBucketLocationInput, opt ...func(*s3.Options)) (*s3.GetBucketLocationOutput, error)
+	GetBucketCors(ctx context.Context, input *s3.GetBucketCorsInput, opt ...func(*s3.Options)) (*s3.GetBucketCorsOutput, error)
+	PutBucketCors(ctx context.Context, input *s3.PutBucketCorsInput, opt ...func(*s3.Options)) (*s3.PutBucketCorsOutput, error)
+	GetBucketLifecycleConfiguration(ctx context.Context, input *s3.GetBucketLifecycleConfigurationInput, opt ...func(*s3.Options)) (*s3.GetBucketLifecycleConfigurationOutput, error)
+	PutBucketLifecycleConfiguration(ctx context.Context, input *s3.PutBucketLifecycleConfigurationInput, opt ...func(*s3.Options)) (*s3.PutBucketLifecycleConfigurationOutput, error)
+}
+
+// bucketIssue is a deviation of the bucket's configuration from what tusd
+// requires. If fix is nil, the issue cannot be resolved automatically.
+type bucketIssue struct {
+	description string
+	action      string
+	fix         func(ctx context.Context) error
+}
+
+// bucketChecker compares the configuration of a bucket with tusd's requirements.
+type bucketChecker struct {
+	api          bucketAPI
+	bucket       string
+	objectPrefix string
+	// region is the expected region of the bucket. It is not checked if empty.
+	region string
+	// corsOrigins are the origins of browsers, which must be allowed to upload
+	// directly to and download from the bucket.
+	corsOrigins    []string
+	abortAfterDays int32
+}
+
+// InitBucket verifies that an S3 bucket exists and is configured as required by
+// tusd, and optionally creates or updates it. It is invoked using
+// `tusd init-bucket [options]` and exits with a non-zero status if issues remain.
+func InitBucket(args []string) {
+	f := flag.NewFlagSet("tusd init-bucket", flag.ExitOnError)
+	f.StringVar(&initBucketFlags.Bucket, "s3-bucket", "", "Name of the bucket to check")
+	f.StringVar(&initBucketFlags.ObjectPrefix, "s3-object-prefix", "", "Prefix of the objects stored by tusd, to which the lifecycle rule must apply")
+	f.StringVar(&initBucketFlags.Endpoint, "s3-endpoint", "", "Endpoint to use for S3 compatible implementations")
+	f.StringVar(&initBucketFlags.Region, "s3-region", "", "Expected region of the bucket, in which it is also created. Defaults to the region from the AWS configuration, e.g. AWS_REGION")
+	f.StringVar(&initBucketFlags.CorsOrigins, "cors-origins", "*", "Comma-separated list of origins, from which browsers upload to or download from the bucket directly, e.g. using -enable-direct-part-uploads or -redirect-downloads. The CORS rules are not checked if empty")
+	f.IntVar(&initBucketFlags.AbortAfterDays, "abort-incomplete-after", 7, "Number of days after which S3 aborts incomplete multipart uploads. Should be longer than -upload-expiry")
+	f.BoolVar(&initBucketFlags.Fix, "fix", false, "Create the bucket and update its CORS and lifecycle rules if they do not meet the requirements")
+	f.BoolVar(&initBucketFlags.DryRun, "dry-run", false, "Only print the changes, which -fix would make")
+	f.Parse(args)
+
+	if initBucketFlags.Bucket == "" {
+		stderr.Fatalf("-s3-bucket must be specified")
+	}
+	if initBucketFlags.AbortAfterDays <= 0 {
+		stderr.Fatalf("-abort-incomplete-after must be positive")
+	}
+
+	ctx := context.Background()
+
+	s3Config, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		stderr.Fatalf("Unable to load S3 configuration: %s", err)
+	}
+	if initBucketFlags.Region != "" {
+		s3Config.Region = initBucketFlags.Region
+	}
+
+	s3Client := s3.NewFromConfig(s3Config, func(o *s3.Options) {
+		if initBucketFlags.Endpoint != "" {
+			o.BaseEndpoint = &initBucketFlags.Endpoint
+			o.UsePathStyle = true
+		}
+	})
+
+	checker := bucketChecker{
+		api:            s3Client,
+		bucket:         initBucketFlags.Bucket,
+		objectPrefix:   initBucketFlags.ObjectPrefix,
+		region:         s3Config.Region,
+		abortAfterDays: int32(initBucketFlags.AbortAfterDays),
+	}
+	if initBucketFlags.CorsOrigins != "" {
+		checker.corsOrigins = strings.Split(initBucketFlags.CorsOrigins, ",")
+	}
+
+	issues, err := checker.check(ctx)
+	if err != nil {
+		stderr.Fatalf("Unable to check bucket: %s", err)
+	}
+
+	if len(issues) == 0 {
+		stdout.Printf("Bucket %s is configured correctly.\n", checker.bucket)
+		return
+	}
+
+	unresolved := 0
+	for _, issue := range issues {
+		stdout.Printf("Issue: %s\n", issue.description)
+
+		switch {
+		case issue.fix == nil || !initBucketFlags.Fix:
+			unresolved++
+		case initBucketFlags.DryRun:
+			stdout.Printf("Would %s.\n", issue.action)
+		default:
+			if err := issue.fix(ctx); err != nil {
+				stderr.Fatalf("Unable to %s: %s", issue.action, err)
+			}
+			stdout.Printf("Did %s.\n", issue.action)
+		}
+	}
+
+	if unresolved > 0 {
+		stderr.Printf("%d issues have not been resolved. Use -fix to resolve them, if possible.\n", unresolved)
+		os.Exit(1)
+	}
+}
+
+// check returns the issues of the bucket's configuration. If the bucket does
+// not exist, the issues include its creation followed by the rules, which must
+// be added to the new bucket.
+func (c bucketChecker) check(ctx context.Context) ([]bucketIssue, error) {
+	var issues []bucketIssue
+	var corsRules []types.CORSRule
+	var lifecycleRules []types.LifecycleRule
+
+	_, err := c.api.HeadBucket(ctx, &s3.HeadBucketInput{
+		Bucket: aws.String(c.bucket),
+	})
+	switch {
+	case isAPIErrorCode(err, "NotFound", "NoSuchBucket"):
+		issues = append(issues, bucketIssue{
+			description: fmt.Sprintf("bucket %s does not exist", c.bucket),
+			action:      fmt.Sprintf("create bucket %s", c.bucket),
+			fix:         c.createBucket,
+		})
+	case err != nil:
+		return nil, err
+	default:
+		if issue, err := c.checkRegion(ctx); err != nil {
+			return nil, err
+		} else if issue != nil {
+			issues = append(issues, *issue)
+		}
+
+		cors, err := c.api.GetBucketCors(ctx, &s3.GetBucketCorsInput{
+			Bucket: aws.String(c.bucket),
+		})
+		if err != nil && !isAPIErrorCode(err, "NoSuchCORSConfiguration") {
+			return nil, err
+		}
+		if err == nil {
+			corsRules = cors.CORSRules
+		}
+
+		lifecycle, err := c.api.GetBucketLifecycleConfiguration(ctx, &s3.GetBucketLifecycleConfigurationInput{
+			Bucket: aws.String(c.bucket),
+		})
+		if err != nil && !isAPIErrorCode(err, "NoSuchLifecycleConfiguration") {
+			return nil, err
+		}
+		if err == nil {
+			lifecycleRules = lifecycle.Rules
+		}
+	}
+
+	if issue := c.checkCors(corsRules); issue != nil {
+		issues = append(issues, *issue)
+	}
+	if issue := c.checkLifecycle(lifecycleRules); issue != nil {
+		issues = append(issues, *issue)
+	}
+
+	return issues, nil
+}
+
+func (c bucketChecker) createBucket(ctx context.Context) error {
+	input := &s3.CreateBucketInput{
+		Bucket: aws.String(c.bucket),
+	}
+	// Buckets in us-east-1 must be created without a location constraint.
+	if c.region != "" && c.region != "us-east-1" {
+		input.CreateBucketConfiguration = &types.CreateBucketConfiguration{
+			LocationConstraint: types.BucketLocationConstraint(c.region),
+		}
+	}
+
+	_, err := c.api.CreateBucket(ctx, input)
+	return err
+}
+
+func (c bucketChecker) checkRegion(ctx context.Context) (*bucketIssue, error) {
+	if c.region == "" {
+		return nil, nil
+	}
+
+	location, err := c.api.GetBucketLocation(ctx, &s3.GetBucketLocationInput{
+		Bucket: aws.String(c.bucket),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The location constraint is empty for us-east-1 and EU for eu-west-1 in
+	// buckets created using legacy APIs.
+	region := string(location.LocationConstraint)
+	switch region {
+	case "":
+		region = "us-east-1"
+	case "EU":
+		region = "eu-west-1"
+	}
+
+	if region == c.region {
+		return nil, nil
+	}
+
+	return &bucketIssue{
+		description: fmt.Sprintf("bucket %s is located in %s instead of %s, which adds latency and transfer costs", c.bucket, region, c.region),
+	}, nil
+}
+
+// checkCors ensures that browsers can upload parts to pre-signed URLs using PUT
+// requests and read their ETag, as well as download the uploads.
+func (c bucketChecker) checkCors(rules []types.CORSRule) *bucketIssue {
+	if len(c.corsOrigins) == 0 {
+		return nil
+	}
+
+	for _, rule := range rules {
+		if corsRuleAllows(rule, c.corsOrigins) {
+			return nil
+		}
+	}
+
+	corsRules := []types.CORSRule{}
+	for _, rule := range rules {
+		if aws.ToString(rule.ID) != bucketCorsRuleID {
+			corsRules = append(corsRules, rule)
+		}
+	}
+	corsRules = append(corsRules, types.CORSRule{
+		ID:             aws.String(bucketCorsRuleID),
+		AllowedOrigins: c.corsOrigins,
+		AllowedMethods: []string{"GET", "HEAD", "PUT"},
+		AllowedHeaders: []string{"*"},
+		ExposeHeaders:  []string{"ETag"},
+		MaxAgeSeconds:  aws.Int32(86400),
+	})
+
+	return &bucketIssue{
+		description: fmt.Sprintf("no CORS rule allows GET and PUT requests from %s and exposes the ETag header", strings.Join(c.corsOrigins, ", ")),
+		action:      fmt.Sprintf("add CORS rule %s", bucketCorsRuleID),
+		fix: func(ctx context.Context) error {
+			_, err := c.api.PutBucketCors(ctx, &s3.PutBucketCorsInput{
+				Bucket: aws.String(c.bucket),
+				CORSConfiguration: &types.CORSConfiguration{
+					CORSRules: corsRules,
+				},
+			})
+			return err
+		},
+	}
+}
+
+func corsRuleAllows(rule types.CORSRule, origins []string) bool {
+	if !containsFold(rule.AllowedMethods, "GET") || !containsFold(rule.AllowedMethods, "PUT") {
+		return false
+	}
+	if !containsFold(rule.ExposeHeaders, "ETag") {
+		return false
+	}
+
+	for _, origin := range origins {
+		if !containsFold(rule.AllowedOrigins, "*") && !containsFold(rule.AllowedOrigins, origin) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// checkLifecycle ensures that incomplete multipart uploads, e.g. of terminated
+// or abandoned uploads, are eventually aborted, so their parts do not incur
+// storage costs forever.
+func (c bucketChecker) checkLifecycle(rules []types.LifecycleRule) *bucketIssue {
+	for _, rule := range rules {
+		if rule.Status != types.ExpirationStatusEnabled {
+			continue
+		}
+		if rule.AbortIncompleteMultipartUpload == nil || aws.ToInt32(rule.AbortIncompleteMultipartUpload.DaysAfterInitiation) <= 0 {
+			continue
+		}
+		if prefix, ok := lifecycleRulePrefix(rule); ok && strings.HasPrefix(c.objectPrefix, prefix) {
+			return nil
+		}
+	}
+
+	lifecycleRules := []types.LifecycleRule{}
+	for _, rule := range rules {
+		if aws.ToString(rule.ID) != bucketLifecycleRuleID {
+			lifecycleRules = append(lifecycleRules, rule)
+		}
+	}
+	lifecycleRules = append(lifecycleRules, types.LifecycleRule{
+		ID:     aws.String(bucketLifecycleRuleID),
+		Status: types.ExpirationStatusEnabled,
+		Filter: &types.LifecycleRuleFilter{
+			Prefix: aws.String(c.objectPrefix),
+		},
+		AbortIncompleteMultipartUpload: &types.AbortIncompleteMultipartUpload{
+			DaysAfterInitiation: aws.Int32(c.abortAfterDays),
+		},
+	})
+
+	return &bucketIssue{
+		description: "no lifecycle rule aborts incomplete multipart uploads",
+		action:      fmt.Sprintf("add lifecycle rule %s aborting incomplete multipart uploads after %d days", bucketLifecycleRuleID, c.abortAfterDays),
+		fix: func(ctx context.Context) error {
+			_, err := c.api.PutBucketLifecycleConfiguration(ctx, &s3.PutBucketLifecycleConfigurationInput{
+				Bucket: aws.String(c.bucket),
+				LifecycleConfiguration: &types.BucketLifecycleConfiguration{
+					Rules: lifecycleRules,
+				},
+			})
+			return err
+		},
+	}
+}
+
+// lifecycleRulePrefix returns the prefix of the objects, to which a rule applies.
+// Rules filtering by other criteria, such as tags, are not considered.
+func lifecycleRulePrefix(rule types.LifecycleRule) (string, bool) {
+	filter := rule.Filter
+	switch {
+	case filter == nil:
+		return aws.ToString(rule.Prefix), true
+	case filter.And == nil && filter.Tag == nil && filter.ObjectSizeGreaterThan == nil && filter.ObjectSizeLessThan == nil:
+		return aws.ToString(filter.Prefix), true
+	default:
+		return "", false
+	}
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func isAPIErrorCode(err error, codes ...string) bool {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+
+	for _, code := range codes {
+		if apiErr.ErrorCode() == code {
+			return true
+		}
+	}
+	return false
+}
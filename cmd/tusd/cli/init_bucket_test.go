@@ -0,0 +1,162 @@
+package cli
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeBucket implements bucketAPI for a single bucket held in memory.
+type fakeBucket struct {
+	exists         bool
+	location       types.BucketLocationConstraint
+	corsRules      []types.CORSRule
+	lifecycleRules []types.LifecycleRule
+}
+
+func (b *fakeBucket) HeadBucket(ctx context.Context, input *s3.HeadBucketInput, opt ...func(*s3.Options)) (*s3.HeadBucketOutput, error) {
+	if !b.exists {
+		return nil, &types.NotFound{}
+	}
+	return &s3.HeadBucketOutput{}, nil
+}
+
+func (b *fakeBucket) CreateBucket(ctx context.Context, input *s3.CreateBucketInput, opt ...func(*s3.Options)) (*s3.CreateBucketOutput, error) {
+	b.exists = true
+	if input.CreateBucketConfiguration != nil {
+		b.location = input.CreateBucketConfiguration.LocationConstraint
+	}
+	return &s3.CreateBucketOutput{}, nil
+}
+
+func (b *fakeBucket) GetBucketLocation(ctx context.Context, input *s3.GetBucketLocationInput, opt ...func(*s3.Options)) (*s3.GetBucketLocationOutput, error) {
+	return &s3.GetBucketLocationOutput{LocationConstraint: b.location}, nil
+}
+
+func (b *fakeBucket) GetBucketCors(ctx context.Context, input *s3.GetBucketCorsInput, opt ...func(*s3.Options)) (*s3.GetBucketCorsOutput, error) {
+	if b.corsRules == nil {
+		return nil, &smithy.GenericAPIError{Code: "NoSuchCORSConfiguration"}
+	}
+	return &s3.GetBucketCorsOutput{CORSRules: b.corsRules}, nil
+}
+
+func (b *fakeBucket) PutBucketCors(ctx context.Context, input *s3.PutBucketCorsInput, opt ...func(*s3.Options)) (*s3.PutBucketCorsOutput, error) {
+	b.corsRules = input.CORSConfiguration.CORSRules
+	return &s3.PutBucketCorsOutput{}, nil
+}
+
+func (b *fakeBucket) GetBucketLifecycleConfiguration(ctx context.Context, input *s3.GetBucketLifecycleConfigurationInput, opt ...func(*s3.Options)) (*s3.GetBucketLifecycleConfigurationOutput, error) {
+	if b.lifecycleRules == nil {
+		return nil, &smithy.GenericAPIError{Code: "NoSuchLifecycleConfiguration"}
+	}
+	return &s3.GetBucketLifecycleConfigurationOutput{Rules: b.lifecycleRules}, nil
+}
+
+func (b *fakeBucket) PutBucketLifecycleConfiguration(ctx context.Context, input *s3.PutBucketLifecycleConfigurationInput, opt ...func(*s3.Options)) (*s3.PutBucketLifecycleConfigurationOutput, error) {
+	b.lifecycleRules = input.LifecycleConfiguration.Rules
+	return &s3.PutBucketLifecycleConfigurationOutput{}, nil
+}
+
+func TestBucketChecker(t *testing.T) {
+	ctx := context.Background()
+
+	newChecker := func(bucket *fakeBucket) bucketChecker {
+		return bucketChecker{
+			api:            bucket,
+			bucket:         "uploads",
+			objectPrefix:   "tusd/",
+			region:         "eu-west-1",
+			corsOrigins:    []string{"https://example.com"},
+			abortAfterDays: 7,
+		}
+	}
+
+	t.Run("CreateBucket", func(t *testing.T) {
+		a := assert.New(t)
+		bucket := &fakeBucket{}
+		checker := newChecker(bucket)
+
+		issues, err := checker.check(ctx)
+		a.NoError(err)
+		a.Len(issues, 3)
+		for _, issue := range issues {
+			a.NoError(issue.fix(ctx))
+		}
+
+		a.True(bucket.exists)
+		a.Equal(types.BucketLocationConstraint("eu-west-1"), bucket.location)
+
+		issues, err = checker.check(ctx)
+		a.NoError(err)
+		a.Empty(issues)
+	})
+
+	t.Run("PreserveRules", func(t *testing.T) {
+		a := assert.New(t)
+		otherCors := types.CORSRule{
+			ID:             aws.String("other"),
+			AllowedOrigins: []string{"https://other.example.com"},
+			AllowedMethods: []string{"GET"},
+		}
+		otherLifecycle := types.LifecycleRule{
+			ID:     aws.String("other"),
+			Status: types.ExpirationStatusEnabled,
+			Filter: &types.LifecycleRuleFilter{Prefix: aws.String("logs/")},
+			AbortIncompleteMultipartUpload: &types.AbortIncompleteMultipartUpload{
+				DaysAfterInitiation: aws.Int32(1),
+			},
+		}
+		bucket := &fakeBucket{
+			exists:         true,
+			location:       "EU",
+			corsRules:      []types.CORSRule{otherCors},
+			lifecycleRules: []types.LifecycleRule{otherLifecycle},
+		}
+		checker := newChecker(bucket)
+
+		issues, err := checker.check(ctx)
+		a.NoError(err)
+		a.Len(issues, 2)
+		for _, issue := range issues {
+			a.NoError(issue.fix(ctx))
+		}
+
+		a.Len(bucket.corsRules, 2)
+		a.Equal(otherCors, bucket.corsRules[0])
+		a.Equal(bucketCorsRuleID, aws.ToString(bucket.corsRules[1].ID))
+		a.Len(bucket.lifecycleRules, 2)
+		a.Equal(otherLifecycle, bucket.lifecycleRules[0])
+		a.Equal(bucketLifecycleRuleID, aws.ToString(bucket.lifecycleRules[1].ID))
+	})
+
+	t.Run("WrongRegion", func(t *testing.T) {
+		a := assert.New(t)
+		bucket := &fakeBucket{
+			exists: true,
+			corsRules: []types.CORSRule{{
+				AllowedOrigins: []string{"*"},
+				AllowedMethods: []string{"GET", "PUT"},
+				ExposeHeaders:  []string{"ETag"},
+			}},
+			lifecycleRules: []types.LifecycleRule{{
+				Status: types.ExpirationStatusEnabled,
+				Filter: &types.LifecycleRuleFilter{Prefix: aws.String("")},
+				AbortIncompleteMultipartUpload: &types.AbortIncompleteMultipartUpload{
+					DaysAfterInitiation: aws.Int32(3),
+				},
+			}},
+		}
+		checker := newChecker(bucket)
+
+		issues, err := checker.check(ctx)
+		a.NoError(err)
+		a.Len(issues, 1)
+		a.Equal("bucket uploads is located in us-east-1 instead of eu-west-1, which adds latency and transfer costs", issues[0].description)
+		a.Nil(issues[0].fix)
+	})
+}
@@ -0,0 +1,172 @@
+package cli
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tus/tusd/v2/pkg/s3store"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// lifecycleReports contains the latest report of each S3 store analyzed using
+// -s3-lifecycle-interval, keyed by its bucket and object prefix.
+var lifecycleReports = struct {
+	sync.Mutex
+	reports map[string]lifecycleReport
+}{
+	reports: make(map[string]lifecycleReport),
+}
+
+// lifecycleReport is the JSON representation of an s3store.LifecycleReport,
+// including the outcome of applying it.
+type lifecycleReport struct {
+	Bucket           string                    `json:"bucket"`
+	ObjectPrefix     string                    `json:"object_prefix"`
+	GeneratedAt      time.Time                 `json:"generated_at"`
+	MaxAge           string                    `json:"max_age"`
+	Uploads          int                       `json:"uploads"`
+	StaleUploads     []string                  `json:"stale_uploads"`
+	OrphanedUploads  int                       `json:"orphaned_uploads"`
+	ReclaimableBytes int64                     `json:"reclaimable_bytes"`
+	Recommendations  []lifecycleRecommendation `json:"recommendations"`
+	// Terminated is the number of stale uploads terminated because of
+	// -s3-lifecycle-apply.
+	Terminated int    `json:"terminated"`
+	ApplyError string `json:"apply_error,omitempty"`
+}
+
+type lifecycleRecommendation struct {
+	Action      string `json:"action"`
+	Description string `json:"description"`
+	Automatic   bool   `json:"automatic"`
+}
+
+// lifecycleMetrics exposes the latest report of an S3 store.
+type lifecycleMetrics struct {
+	staleUploads     prometheus.Gauge
+	orphanedUploads  prometheus.Gauge
+	reclaimableBytes prometheus.Gauge
+	terminated       prometheus.Counter
+}
+
+func newLifecycleMetrics(registerer prometheus.Registerer) lifecycleMetrics {
+	metrics := lifecycleMetrics{
+		staleUploads: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "tusd_s3_lifecycle_stale_uploads",
+			Help: "Number of unfinished multipart uploads older than -s3-lifecycle-max-age at the last analysis.",
+		}),
+		orphanedUploads: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "tusd_s3_lifecycle_orphaned_uploads",
+			Help: "Number of stale multipart uploads without an .info object at the last analysis.",
+		}),
+		reclaimableBytes: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "tusd_s3_lifecycle_reclaimable_bytes",
+			Help: "Estimated number of bytes stored for stale multipart uploads at the last analysis.",
+		}),
+		terminated: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "tusd_s3_lifecycle_terminated_uploads_total",
+			Help: "Total number of stale uploads terminated because of -s3-lifecycle-apply.",
+		}),
+	}
+
+	registerer.MustRegister(metrics.staleUploads, metrics.orphanedUploads, metrics.reclaimableBytes, metrics.terminated)
+	return metrics
+}
+
+// analyzeS3Lifecycle analyzes the unfinished uploads of the store on startup
+// and then periodically, exposes the results as metrics and, if enabled using
+// -s3-lifecycle-apply, terminates the stale uploads.
+func analyzeS3Lifecycle(store s3store.S3Store, registerer prometheus.Registerer) {
+	metrics := newLifecycleMetrics(registerer)
+
+	ticker := time.NewTicker(Flags.S3LifecycleInterval)
+	defer ticker.Stop()
+
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), Flags.S3LifecycleInterval)
+		report, err := store.AnalyzeLifecycle(ctx, Flags.S3LifecycleMaxAge)
+		if err != nil {
+			stderr.Printf("Unable to analyze unfinished uploads in S3 bucket %s: %s\n", store.Bucket, err)
+		} else {
+			metrics.staleUploads.Set(float64(len(report.StaleUploads)))
+			metrics.orphanedUploads.Set(float64(report.OrphanedUploads))
+			metrics.reclaimableBytes.Set(float64(report.ReclaimableBytes))
+
+			result := newLifecycleReport(report)
+			for _, recommendation := range report.Recommendations {
+				stdout.Printf("Recommendation for S3 bucket %s: %s.\n", store.Bucket, recommendation.Description)
+			}
+
+			if Flags.S3LifecycleApply && len(report.StaleUploads) > 0 {
+				terminated, err := store.ApplyLifecycleReport(ctx, report)
+				metrics.terminated.Add(float64(terminated))
+				result.Terminated = terminated
+				if err != nil {
+					result.ApplyError = err.Error()
+					stderr.Printf("Unable to terminate some stale uploads in S3 bucket %s: %s\n", store.Bucket, err)
+				}
+				stdout.Printf("Terminated %d stale uploads in S3 bucket %s.\n", terminated, store.Bucket)
+			}
+
+			lifecycleReports.Lock()
+			lifecycleReports.reports[store.Bucket+"/"+store.ObjectPrefix] = result
+			lifecycleReports.Unlock()
+		}
+		cancel()
+
+		<-ticker.C
+	}
+}
+
+func newLifecycleReport(report s3store.LifecycleReport) lifecycleReport {
+	result := lifecycleReport{
+		Bucket:           report.Bucket,
+		ObjectPrefix:     report.ObjectPrefix,
+		GeneratedAt:      report.GeneratedAt,
+		MaxAge:           report.MaxAge.String(),
+		Uploads:          report.Uploads,
+		StaleUploads:     report.StaleUploads,
+		OrphanedUploads:  report.OrphanedUploads,
+		ReclaimableBytes: report.ReclaimableBytes,
+		Recommendations:  make([]lifecycleRecommendation, 0, len(report.Recommendations)),
+	}
+	for _, recommendation := range report.Recommendations {
+		result.Recommendations = append(result.Recommendations, lifecycleRecommendation{
+			Action:      recommendation.Action,
+			Description: recommendation.Description,
+			Automatic:   recommendation.Automatic,
+		})
+	}
+
+	return result
+}
+
+// SetupAdminLifecycle installs the endpoint for the lifecycle reports on the
+// admin router:
+//
+//	GET /api/lifecycle - latest analysis of the unfinished uploads in each S3 bucket
+func SetupAdminLifecycle() {
+	adminMux.Get("/api/lifecycle", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lifecycleReports.Lock()
+		reports := make([]lifecycleReport, 0, len(lifecycleReports.reports))
+		for _, report := range lifecycleReports.reports {
+			reports = append(reports, report)
+		}
+		lifecycleReports.Unlock()
+
+		sort.Slice(reports, func(i, j int) bool {
+			if reports[i].Bucket != reports[j].Bucket {
+				return reports[i].Bucket < reports[j].Bucket
+			}
+			return reports[i].ObjectPrefix < reports[j].ObjectPrefix
+		})
+
+		writeAdminJSON(w, http.StatusOK, map[string]interface{}{
+			"reports": reports,
+		})
+	}))
+}
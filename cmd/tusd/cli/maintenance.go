@@ -0,0 +1,180 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	tushandler "github.com/tus/tusd/v2/pkg/handler"
+)
+
+// maintenance controls whether new uploads are rejected. It is configured
+// using the -maintenance flags and can be changed using the admin API.
+var maintenance *tushandler.Maintenance
+
+// maintenanceWindow is a period in which new uploads are rejected.
+type maintenanceWindow struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// maintenanceStatus describes the maintenance settings and whether new uploads
+// are currently rejected. Until is the time at which they are expected to be
+// accepted again, if known.
+type maintenanceStatus struct {
+	Enabled    bool                `json:"enabled"`
+	Message    string              `json:"message,omitempty"`
+	RetryAfter string              `json:"retry_after,omitempty"`
+	Windows    []maintenanceWindow `json:"windows"`
+	Active     bool                `json:"active"`
+	Until      *time.Time          `json:"until,omitempty"`
+}
+
+// maintenanceUpdate changes the maintenance settings. Omitted fields are kept,
+// while an empty windows array removes all windows.
+type maintenanceUpdate struct {
+	Enabled    *bool                `json:"enabled"`
+	Message    *string              `json:"message"`
+	RetryAfter *string              `json:"retry_after"`
+	Windows    *[]maintenanceWindow `json:"windows"`
+}
+
+// setupMaintenance creates the maintenance controller from the flags.
+func setupMaintenance() {
+	windows, err := parseMaintenanceWindows(Flags.MaintenanceWindows)
+	if err != nil {
+		stderr.Fatalf("Invalid value for -maintenance-windows: %s", err)
+	}
+	if Flags.MaintenanceRetryAfter < 0 {
+		stderr.Fatalf("Invalid value for -maintenance-retry-after: must not be negative")
+	}
+
+	maintenance = tushandler.NewMaintenance(tushandler.MaintenanceSettings{
+		Enabled:    Flags.Maintenance,
+		Message:    Flags.MaintenanceMessage,
+		RetryAfter: Flags.MaintenanceRetryAfter,
+		Windows:    windows,
+	})
+
+	if Flags.Maintenance {
+		stdout.Printf("Maintenance mode is enabled. New uploads are rejected.\n")
+	}
+}
+
+// parseMaintenanceWindows parses a comma-separated list of windows, each
+// consisting of an RFC 3339 start and end time separated by a slash.
+func parseMaintenanceWindows(value string) ([]tushandler.MaintenanceWindow, error) {
+	var windows []tushandler.MaintenanceWindow
+	if value == "" {
+		return windows, nil
+	}
+
+	for _, period := range strings.Split(value, ",") {
+		start, end, ok := strings.Cut(strings.TrimSpace(period), "/")
+		if !ok {
+			return nil, fmt.Errorf("window %q must contain a start and end time separated by a slash", period)
+		}
+
+		var window tushandler.MaintenanceWindow
+		var err error
+		if window.Start, err = time.Parse(time.RFC3339, start); err != nil {
+			return nil, fmt.Errorf("invalid start of window %q: %w", period, err)
+		}
+		if window.End, err = time.Parse(time.RFC3339, end); err != nil {
+			return nil, fmt.Errorf("invalid end of window %q: %w", period, err)
+		}
+		if !window.End.After(window.Start) {
+			return nil, fmt.Errorf("window %q must end after it starts", period)
+		}
+
+		windows = append(windows, window)
+	}
+
+	return windows, nil
+}
+
+// SetupAdminMaintenance installs the endpoints for the maintenance mode on the
+// admin router:
+//
+//	GET /api/maintenance - maintenance settings and whether new uploads are rejected
+//	PUT /api/maintenance - enable or disable the maintenance mode and schedule windows
+func SetupAdminMaintenance() {
+	adminMux.Get("/api/maintenance", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeAdminJSON(w, http.StatusOK, currentMaintenanceStatus())
+	}))
+
+	adminMux.Put("/api/maintenance", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var update maintenanceUpdate
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			writeAdminError(w, tushandler.NewError("ERR_INVALID_REQUEST", "request body must be a JSON object", http.StatusBadRequest))
+			return
+		}
+
+		settings := maintenance.Settings()
+		if update.Enabled != nil {
+			settings.Enabled = *update.Enabled
+		}
+		if update.Message != nil {
+			settings.Message = *update.Message
+		}
+		if update.RetryAfter != nil {
+			retryAfter := time.Duration(0)
+			if *update.RetryAfter != "" {
+				var err error
+				retryAfter, err = time.ParseDuration(*update.RetryAfter)
+				if err != nil || retryAfter < 0 {
+					writeAdminError(w, tushandler.NewError("ERR_INVALID_REQUEST", "retry_after must be a duration, e.g. 10m", http.StatusBadRequest))
+					return
+				}
+			}
+			settings.RetryAfter = retryAfter
+		}
+		if update.Windows != nil {
+			settings.Windows = make([]tushandler.MaintenanceWindow, 0, len(*update.Windows))
+			for _, window := range *update.Windows {
+				if !window.End.After(window.Start) {
+					writeAdminError(w, tushandler.NewError("ERR_INVALID_REQUEST", "windows must end after they start", http.StatusBadRequest))
+					return
+				}
+				settings.Windows = append(settings.Windows, tushandler.MaintenanceWindow{
+					Start: window.Start,
+					End:   window.End,
+				})
+			}
+		}
+		maintenance.Set(settings)
+
+		logAdminAudit(r, "maintenance", "", http.StatusOK)
+		writeAdminJSON(w, http.StatusOK, currentMaintenanceStatus())
+	}))
+}
+
+// currentMaintenanceStatus returns the maintenance settings and whether new
+// uploads are rejected at the moment.
+func currentMaintenanceStatus() maintenanceStatus {
+	settings := maintenance.Settings()
+	active, until := maintenance.Active(time.Now())
+
+	status := maintenanceStatus{
+		Enabled: settings.Enabled,
+		Message: settings.Message,
+		Windows: make([]maintenanceWindow, 0, len(settings.Windows)),
+		Active:  active,
+	}
+	if settings.RetryAfter > 0 {
+		status.RetryAfter = settings.RetryAfter.String()
+	}
+	for _, window := range settings.Windows {
+		status.Windows = append(status.Windows, maintenanceWindow{
+			Start: window.Start,
+			End:   window.End,
+		})
+	}
+	if !until.IsZero() {
+		status.Until = &until
+	}
+
+	return status
+}
@@ -0,0 +1,32 @@
+package cli
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMaintenanceWindows(t *testing.T) {
+	a := assert.New(t)
+
+	windows, err := parseMaintenanceWindows("")
+	a.NoError(err)
+	a.Empty(windows)
+
+	windows, err = parseMaintenanceWindows("2024-03-01T22:00:00Z/2024-03-02T02:00:00Z, 2024-04-01T22:00:00+02:00/2024-04-01T23:00:00+02:00")
+	a.NoError(err)
+	a.Len(windows, 2)
+	a.True(windows[0].Start.Equal(time.Date(2024, 3, 1, 22, 0, 0, 0, time.UTC)))
+	a.True(windows[0].End.Equal(time.Date(2024, 3, 2, 2, 0, 0, 0, time.UTC)))
+	a.True(windows[1].Start.Equal(time.Date(2024, 4, 1, 20, 0, 0, 0, time.UTC)))
+
+	for _, value := range []string{
+		"2024-03-01T22:00:00Z",
+		"2024-03-01/2024-03-02",
+		"2024-03-02T02:00:00Z/2024-03-01T22:00:00Z",
+	} {
+		_, err := parseMaintenanceWindows(value)
+		a.Error(err, value)
+	}
+}
@@ -0,0 +1,29 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	tushandler "github.com/tus/tusd/v2/pkg/handler"
+)
+
+// loadMetadataRules reads the metadata rules from the JSON file at the given
+// path. The rules are validated by the handler.
+func loadMetadataRules(filePath string) ([]tushandler.MetadataRule, error) {
+	var rules []tushandler.MetadataRule
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	decoder := json.NewDecoder(file)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&rules); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	return rules, nil
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/tus/tusd/v2/pkg/handler"
 	"github.com/tus/tusd/v2/pkg/hooks"
 	"github.com/tus/tusd/v2/pkg/prometheuscollector"
+	"github.com/tus/tusd/v2/pkg/tenant"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -16,12 +17,28 @@ var MetricsOpenConnections = prometheus.NewGauge(prometheus.GaugeOpts{
 	Help: "Current number of open connections.",
 })
 
+// SetupMetrics registers the metrics and exposes them on mux. The metrics of
+// handler are only registered if it is not nil. Otherwise, they are registered
+// for each tenant by createTenantRouter.
 func SetupMetrics(mux *http.ServeMux, handler *handler.Handler) {
 	prometheus.MustRegister(MetricsOpenConnections)
 	prometheus.MustRegister(hooks.MetricsHookErrorsTotal)
 	prometheus.MustRegister(hooks.MetricsHookInvocationsTotal)
-	prometheus.MustRegister(prometheuscollector.New(handler.Metrics))
+	prometheus.MustRegister(MetricsUploadSamplesTotal)
+	prometheus.MustRegister(MetricsUploadSampleBytesTotal)
+	if handler != nil {
+		prometheus.MustRegister(prometheuscollector.New(handler.Metrics))
+	} else {
+		prometheus.MustRegister(tenant.MetricsRequestsRejectedTotal)
+	}
 
 	stdout.Printf("Using %s as the metrics path.\n", Flags.MetricsPath)
-	mux.Handle(Flags.MetricsPath, promhttp.Handler())
+	// The OpenMetrics format is offered, since exemplars linking the S3 request
+	// durations to traces are only exposed in this format.
+	mux.Handle(Flags.MetricsPath, promhttp.InstrumentMetricHandler(
+		prometheus.DefaultRegisterer,
+		promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{
+			EnableOpenMetrics: true,
+		}),
+	))
 }
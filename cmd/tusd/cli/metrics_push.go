@@ -0,0 +1,240 @@
+package cli
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// maxStatsdPacketSize is the maximum size of a UDP packet sent to the StatsD
+// agent, which avoids fragmentation on common networks.
+const maxStatsdPacketSize = 1432
+
+// SetupMetricsPush periodically pushes the registered metrics to a Prometheus
+// Pushgateway or a StatsD agent, for environments in which the tusd instances
+// cannot be scraped. It must be called after the metrics have been registered
+// using SetupMetrics.
+func SetupMetricsPush() {
+	if Flags.MetricsPushGateway == "" && Flags.MetricsStatsdAddress == "" {
+		return
+	}
+
+	if Flags.MetricsPushInterval <= 0 {
+		stderr.Fatalf("The interval for pushing metrics must be positive")
+	}
+
+	var pushers []func() error
+
+	if Flags.MetricsPushGateway != "" {
+		instance, err := os.Hostname()
+		if err != nil {
+			stderr.Fatalf("Unable to determine hostname for the Pushgateway: %s", err)
+		}
+
+		pusher := push.New(Flags.MetricsPushGateway, "tusd").
+			Gatherer(prometheus.DefaultGatherer).
+			Grouping("instance", instance)
+		pushers = append(pushers, pusher.Push)
+
+		stdout.Printf("Pushing metrics to Pushgateway at %s every %s.\n", Flags.MetricsPushGateway, Flags.MetricsPushInterval)
+	}
+
+	if Flags.MetricsStatsdAddress != "" {
+		sink, err := newStatsdSink(Flags.MetricsStatsdAddress, Flags.MetricsPushPrefix, Flags.MetricsStatsdTags)
+		if err != nil {
+			stderr.Fatalf("Unable to connect to StatsD agent: %s", err)
+		}
+		pushers = append(pushers, func() error {
+			return sink.push(prometheus.DefaultGatherer)
+		})
+
+		stdout.Printf("Pushing metrics to StatsD agent at %s every %s.\n", Flags.MetricsStatsdAddress, Flags.MetricsPushInterval)
+	}
+
+	go func() {
+		ticker := time.NewTicker(Flags.MetricsPushInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			for _, pushMetrics := range pushers {
+				if err := pushMetrics(); err != nil {
+					stderr.Printf("Unable to push metrics: %s\n", err)
+				}
+			}
+		}
+	}()
+}
+
+// statsdSink sends tusd's metrics to a StatsD agent using UDP. Counters are sent
+// as the difference to the previous push, since StatsD aggregates counters itself.
+// Gauges are sent as is. For histograms and summaries, the count and sum of the
+// observations are sent as counters.
+type statsdSink struct {
+	conn   net.Conn
+	prefix string
+	// tags enables the tag extension of DogStatsD, e.g. `|#method:POST`. Without
+	// it, labels are appended to the metric's name instead.
+	tags bool
+	// last contains the previously pushed values of counters.
+	last map[string]float64
+}
+
+func newStatsdSink(address, prefix string, tags bool) (*statsdSink, error) {
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	return &statsdSink{
+		conn:   conn,
+		prefix: prefix,
+		tags:   tags,
+		last:   make(map[string]float64),
+	}, nil
+}
+
+func (s *statsdSink) push(gatherer prometheus.Gatherer) error {
+	families, err := gatherer.Gather()
+	if err != nil {
+		return err
+	}
+
+	var packet []byte
+	for _, line := range s.lines(families) {
+		if len(packet) > 0 && len(packet)+len(line)+1 > maxStatsdPacketSize {
+			if _, err := s.conn.Write(packet); err != nil {
+				return err
+			}
+			packet = packet[:0]
+		}
+		if len(packet) > 0 {
+			packet = append(packet, '\n')
+		}
+		packet = append(packet, line...)
+	}
+
+	if len(packet) > 0 {
+		if _, err := s.conn.Write(packet); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// lines converts the tusd metrics into StatsD lines. Metrics from other sources,
+// such as the Go runtime, are not pushed.
+func (s *statsdSink) lines(families []*dto.MetricFamily) []string {
+	lines := []string{}
+	for _, family := range families {
+		if !strings.HasPrefix(family.GetName(), "tusd_") {
+			continue
+		}
+
+		name := statsdName(strings.TrimPrefix(family.GetName(), "tusd_"))
+		if s.prefix != "" {
+			name = s.prefix + "." + name
+		}
+
+		for _, metric := range family.GetMetric() {
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				lines = s.appendCounter(lines, name, metric.GetLabel(), metric.GetCounter().GetValue())
+			case dto.MetricType_GAUGE:
+				lines = s.appendGauge(lines, name, metric.GetLabel(), metric.GetGauge().GetValue())
+			case dto.MetricType_UNTYPED:
+				lines = s.appendGauge(lines, name, metric.GetLabel(), metric.GetUntyped().GetValue())
+			case dto.MetricType_HISTOGRAM:
+				lines = s.appendCounter(lines, name+".count", metric.GetLabel(), float64(metric.GetHistogram().GetSampleCount()))
+				lines = s.appendCounter(lines, name+".sum", metric.GetLabel(), metric.GetHistogram().GetSampleSum())
+			case dto.MetricType_SUMMARY:
+				lines = s.appendCounter(lines, name+".count", metric.GetLabel(), float64(metric.GetSummary().GetSampleCount()))
+				lines = s.appendCounter(lines, name+".sum", metric.GetLabel(), metric.GetSummary().GetSampleSum())
+			}
+		}
+	}
+
+	return lines
+}
+
+func (s *statsdSink) appendCounter(lines []string, name string, labels []*dto.LabelPair, value float64) []string {
+	name, tags := s.nameAndTags(name, labels)
+	key := name + tags
+
+	delta := value - s.last[key]
+	if delta < 0 {
+		// The counter has been reset.
+		delta = value
+	}
+	s.last[key] = value
+
+	if delta == 0 {
+		return lines
+	}
+	return append(lines, fmt.Sprintf("%s:%s|c%s", name, formatStatsdValue(delta), tags))
+}
+
+func (s *statsdSink) appendGauge(lines []string, name string, labels []*dto.LabelPair, value float64) []string {
+	name, tags := s.nameAndTags(name, labels)
+	// StatsD interprets gauge values with a sign as relative changes, so negative
+	// values must be sent as a reset to zero followed by a decrement.
+	if value < 0 {
+		lines = append(lines, fmt.Sprintf("%s:0|g%s", name, tags))
+	}
+	return append(lines, fmt.Sprintf("%s:%s|g%s", name, formatStatsdValue(value), tags))
+}
+
+// nameAndTags returns the name of the metric and the tags in the DogStatsD format.
+// If tags are disabled, the label values are appended to the name instead.
+func (s *statsdSink) nameAndTags(name string, labels []*dto.LabelPair) (string, string) {
+	if len(labels) == 0 {
+		return name, ""
+	}
+
+	labels = append([]*dto.LabelPair(nil), labels...)
+	sort.Slice(labels, func(i, j int) bool {
+		return labels[i].GetName() < labels[j].GetName()
+	})
+
+	if !s.tags {
+		for _, label := range labels {
+			name += "." + statsdName(label.GetName()) + "." + statsdName(label.GetValue())
+		}
+		return name, ""
+	}
+
+	tags := make([]string, len(labels))
+	for i, label := range labels {
+		tags[i] = statsdName(label.GetName()) + ":" + statsdTagValue(label.GetValue())
+	}
+	return name, "|#" + strings.Join(tags, ",")
+}
+
+func formatStatsdValue(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// statsdName replaces characters, which are not allowed in StatsD names.
+func statsdName(value string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-':
+			return r
+		default:
+			return '_'
+		}
+	}, value)
+}
+
+// statsdTagValue replaces characters, which separate the fields of a DogStatsD line.
+func statsdTagValue(value string) string {
+	return strings.NewReplacer("|", "_", ",", "_", "#", "_", "\n", "_").Replace(value)
+}
@@ -0,0 +1,74 @@
+package cli
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatsdSink(t *testing.T) {
+	a := assert.New(t)
+
+	registry := prometheus.NewRegistry()
+	requests := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "tusd_requests_total",
+	}, []string{"method"})
+	connections := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "tusd_connections_open",
+	})
+	other := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "go_other_total",
+	})
+	registry.MustRegister(requests, connections, other)
+
+	requests.WithLabelValues("POST").Add(3)
+	connections.Set(2)
+	other.Inc()
+
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	a.NoError(err)
+	defer listener.Close()
+
+	read := func() []string {
+		buf := make([]byte, maxStatsdPacketSize)
+		listener.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := listener.ReadFrom(buf)
+		a.NoError(err)
+		return strings.Split(string(buf[:n]), "\n")
+	}
+
+	sink, err := newStatsdSink(listener.LocalAddr().String(), "tusd", false)
+	a.NoError(err)
+
+	a.NoError(sink.push(registry))
+	a.Equal([]string{
+		"tusd.connections_open:2|g",
+		"tusd.requests_total.method.POST:3|c",
+	}, read())
+
+	// Counters are sent as the difference to the previous push and omitted if
+	// they did not change.
+	requests.WithLabelValues("POST").Add(2)
+	connections.Set(-1)
+	a.NoError(sink.push(registry))
+	a.Equal([]string{
+		"tusd.connections_open:0|g",
+		"tusd.connections_open:-1|g",
+		"tusd.requests_total.method.POST:2|c",
+	}, read())
+
+	sink.tags = true
+	sink.prefix = "uploads"
+	requests.WithLabelValues("PATCH").Inc()
+	a.NoError(sink.push(registry))
+	a.Equal([]string{
+		"uploads.connections_open:0|g",
+		"uploads.connections_open:-1|g",
+		"uploads.requests_total:1|c|#method:PATCH",
+		"uploads.requests_total:5|c|#method:POST",
+	}, read())
+}
@@ -0,0 +1,396 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/tus/tusd/v2/pkg/filestore"
+	"github.com/tus/tusd/v2/pkg/handler"
+	"github.com/tus/tusd/v2/pkg/s3store"
+)
+
+// migrateFlags holds the options for the `tusd migrate` subcommand.
+var migrateFlags struct {
+	Source       string
+	Target       string
+	S3Endpoint   string
+	IDsFile      string
+	ProgressFile string
+	Parallel     int
+	Verify       bool
+	Overwrite    bool
+}
+
+// errSourceIncomplete is returned by migrateUpload if the data of an unfinished
+// upload cannot be read from the source store.
+var errSourceIncomplete = errors.New("source store cannot provide the data of unfinished uploads")
+
+// Migrate copies uploads, including their state and meta data, from one store
+// to another. It is invoked using `tusd migrate [options]`. Progress is
+// recorded in a file, so an interrupted migration can be resumed by invoking
+// the same command again.
+func Migrate(args []string) {
+	f := flag.NewFlagSet("tusd migrate", flag.ExitOnError)
+	f.StringVar(&migrateFlags.Source, "source", "", "Store to read uploads from, e.g. file:///srv/tusd-data or s3://bucket/prefix")
+	f.StringVar(&migrateFlags.Target, "target", "", "Store to write uploads to, using the same format as -source")
+	f.StringVar(&migrateFlags.S3Endpoint, "s3-endpoint", "", "Endpoint to use for S3 compatible implementations in -source and -target")
+	f.StringVar(&migrateFlags.IDsFile, "ids-file", "", "File containing one upload ID per line. Required unless the source is a file store, whose uploads are discovered automatically")
+	f.StringVar(&migrateFlags.ProgressFile, "progress-file", "tusd-migrate.progress", "File recording already migrated uploads, allowing to resume the migration")
+	f.IntVar(&migrateFlags.Parallel, "parallel", 4, "Number of uploads to migrate concurrently")
+	f.BoolVar(&migrateFlags.Verify, "verify", true, "Compare the SHA-256 checksum of the data in the source and target after copying")
+	f.BoolVar(&migrateFlags.Overwrite, "overwrite", false, "Replace uploads which already exist in the target store, for example leftovers of an aborted migration")
+	f.Parse(args)
+
+	if migrateFlags.Source == "" || migrateFlags.Target == "" {
+		stderr.Fatalf("Both -source and -target must be specified")
+	}
+	if migrateFlags.Parallel <= 0 {
+		stderr.Fatalf("-parallel must be positive")
+	}
+
+	ctx := context.Background()
+
+	source, err := newStoreFromURL(ctx, migrateFlags.Source)
+	if err != nil {
+		stderr.Fatalf("Unable to create source store: %s", err)
+	}
+	target, err := newStoreFromURL(ctx, migrateFlags.Target)
+	if err != nil {
+		stderr.Fatalf("Unable to create target store: %s", err)
+	}
+
+	ids, err := migrationUploadIDs(migrateFlags.Source, migrateFlags.IDsFile)
+	if err != nil {
+		stderr.Fatalf("Unable to determine uploads to migrate: %s", err)
+	}
+
+	done, err := readMigrationProgress(migrateFlags.ProgressFile)
+	if err != nil {
+		stderr.Fatalf("Unable to read progress file: %s", err)
+	}
+
+	progressFile, err := os.OpenFile(migrateFlags.ProgressFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		stderr.Fatalf("Unable to open progress file: %s", err)
+	}
+	defer progressFile.Close()
+
+	var progressMutex sync.Mutex
+	var failed, incomplete int
+	jobs := make(chan string)
+	var wg sync.WaitGroup
+	wg.Add(migrateFlags.Parallel)
+
+	for i := 0; i < migrateFlags.Parallel; i++ {
+		go func() {
+			defer wg.Done()
+			for id := range jobs {
+				targetID, err := migrateUpload(ctx, source, target, id, migrateFlags.Verify, migrateFlags.Overwrite)
+
+				progressMutex.Lock()
+				if errors.Is(err, errSourceIncomplete) {
+					// Not recorded as migrated, so it is retried once the upload is finished.
+					incomplete += 1
+					stdout.Printf("Skipped unfinished upload %s: %s\n", id, err)
+				} else if err != nil {
+					failed += 1
+					stderr.Printf("Failed to migrate upload %s: %s\n", id, err)
+				} else {
+					// Record the ID mapping, since the target store might assign a different ID.
+					fmt.Fprintf(progressFile, "%s %s\n", id, targetID)
+					stdout.Printf("Migrated upload %s to %s\n", id, targetID)
+				}
+				progressMutex.Unlock()
+			}
+		}()
+	}
+
+	skipped := 0
+	for _, id := range ids {
+		if _, ok := done[id]; ok {
+			skipped += 1
+			continue
+		}
+		jobs <- id
+	}
+	close(jobs)
+	wg.Wait()
+
+	stdout.Printf("Migration finished: %d uploads, %d skipped as already migrated, %d skipped as unfinished, %d failed\n", len(ids), skipped, incomplete, failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// migrateUpload copies a single upload from the source to the target store
+// and returns the ID of the upload in the target store. In-progress uploads
+// are copied up to their current offset, so they can be resumed on the target.
+// If the source store cannot provide their data, errSourceIncomplete is returned.
+// An upload that was partially created in the target store is terminated again
+// if the migration fails, so it can be retried.
+func migrateUpload(ctx context.Context, source, target handler.DataStore, id string, verify bool, overwrite bool) (targetID string, err error) {
+	srcUpload, err := source.GetUpload(ctx, id)
+	if err != nil {
+		return "", err
+	}
+
+	info, err := srcUpload.GetInfo(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	// The Storage map is specific to the source store and will be filled in
+	// by the target store. S3Store's IDs consist of the object ID and the
+	// multipart ID, separated by a plus sign. Only the former is reused, since
+	// the target store creates its own multipart upload.
+	newInfo := handler.FileInfo{
+		ID:             strings.SplitN(info.ID, "+", 2)[0],
+		Size:           info.Size,
+		SizeIsDeferred: info.SizeIsDeferred,
+		MetaData:       info.MetaData,
+		IsPartial:      info.IsPartial,
+		IsFinal:        info.IsFinal,
+		PartialUploads: info.PartialUploads,
+	}
+
+	// The data is opened before anything is created in the target store, so
+	// uploads whose data is not available are skipped without side effects.
+	// S3Store, for example, is not able to read the parts of unfinished uploads.
+	var reader io.ReadCloser
+	if info.Offset > 0 {
+		reader, err = srcUpload.GetReader(ctx)
+		if err != nil {
+			var detailedErr handler.Error
+			if errors.As(err, &detailedErr) && detailedErr.ErrorCode == "ERR_INCOMPLETE_UPLOAD" {
+				return "", errSourceIncomplete
+			}
+			return "", fmt.Errorf("unable to read source data: %w", err)
+		}
+		defer reader.Close()
+	}
+
+	// Stores which assign IDs themselves, such as S3Store, never return an
+	// existing upload here.
+	if existing, err := target.GetUpload(ctx, newInfo.ID); err == nil {
+		if !overwrite {
+			return "", fmt.Errorf("upload %s already exists in the target store, use -overwrite to replace it", newInfo.ID)
+		}
+		if err := terminateTargetUpload(ctx, target, existing); err != nil {
+			return "", fmt.Errorf("unable to remove existing target upload: %w", err)
+		}
+	} else if !errors.Is(err, handler.ErrNotFound) {
+		return "", err
+	}
+
+	dstUpload, err := target.NewUpload(ctx, newInfo)
+	if err != nil {
+		return "", err
+	}
+
+	defer func() {
+		if err == nil {
+			return
+		}
+		// Remove the incomplete copy, so that retrying does not append to it.
+		if terminateErr := terminateTargetUpload(ctx, target, dstUpload); terminateErr != nil {
+			stderr.Printf("Unable to clean up target upload for %s: %s\n", id, terminateErr)
+		}
+	}()
+
+	dstInfo, err := dstUpload.GetInfo(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	srcHash := sha256.New()
+	if reader != nil {
+		src := io.TeeReader(io.LimitReader(reader, info.Offset), srcHash)
+		n, err := dstUpload.WriteChunk(ctx, 0, src)
+		if err != nil {
+			return "", fmt.Errorf("unable to write target data: %w", err)
+		}
+		if n != info.Offset {
+			return "", fmt.Errorf("short copy: wrote %d of %d bytes", n, info.Offset)
+		}
+	}
+
+	if !info.SizeIsDeferred && info.Offset == info.Size {
+		if err := dstUpload.FinishUpload(ctx); err != nil {
+			return "", err
+		}
+	}
+
+	if verify {
+		if err := verifyMigratedUpload(ctx, target, dstInfo.ID, info, srcHash.Sum(nil)); err != nil {
+			return "", err
+		}
+	}
+
+	return dstInfo.ID, nil
+}
+
+// terminateTargetUpload removes an upload from the target store, if the store
+// supports termination.
+func terminateTargetUpload(ctx context.Context, target handler.DataStore, upload handler.Upload) error {
+	terminater, ok := target.(handler.TerminaterDataStore)
+	if !ok {
+		return errors.New("target store does not support termination")
+	}
+
+	return terminater.AsTerminatableUpload(upload).Terminate(ctx)
+}
+
+// verifyMigratedUpload checks that the upload in the target store has the same
+// state as in the source store. The data itself is only compared if the target
+// store is able to provide it, which is not always the case for unfinished uploads.
+func verifyMigratedUpload(ctx context.Context, target handler.DataStore, id string, expected handler.FileInfo, expectedHash []byte) error {
+	upload, err := target.GetUpload(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	info, err := upload.GetInfo(ctx)
+	if err != nil {
+		return err
+	}
+
+	if info.Offset != expected.Offset || info.Size != expected.Size || info.SizeIsDeferred != expected.SizeIsDeferred {
+		return fmt.Errorf("verification failed: target has offset %d and size %d, expected offset %d and size %d", info.Offset, info.Size, expected.Offset, expected.Size)
+	}
+
+	if info.Offset == 0 || info.Offset != info.Size {
+		return nil
+	}
+
+	reader, err := upload.GetReader(ctx)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, reader); err != nil {
+		return err
+	}
+
+	if !bytes.Equal(hash.Sum(nil), expectedHash) {
+		return errors.New("verification failed: checksum of target data does not match source")
+	}
+
+	return nil
+}
+
+// newStoreFromURL constructs a data store from a URL-like specification:
+// file:///path/to/dir for a file store or s3://bucket/prefix for an S3 store.
+func newStoreFromURL(ctx context.Context, spec string) (handler.DataStore, error) {
+	u, err := url.Parse(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "file":
+		dir, err := filepath.Abs(u.Host + u.Path)
+		if err != nil {
+			return nil, err
+		}
+		return filestore.New(dir), nil
+	case "s3":
+		s3Config, err := config.LoadDefaultConfig(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		s3Client := s3.NewFromConfig(s3Config, func(o *s3.Options) {
+			if migrateFlags.S3Endpoint != "" {
+				o.BaseEndpoint = &migrateFlags.S3Endpoint
+				o.UsePathStyle = true
+			}
+		})
+
+		store := s3store.New(u.Host, s3Client)
+		store.ObjectPrefix = strings.TrimPrefix(u.Path, "/")
+		return store, nil
+	default:
+		return nil, fmt.Errorf("unsupported store scheme %q, must be file or s3", u.Scheme)
+	}
+}
+
+// migrationUploadIDs returns the IDs of all uploads to migrate. They are read
+// from idsFile, if provided, or discovered from the .info files if the source
+// is a file store.
+func migrationUploadIDs(source string, idsFile string) ([]string, error) {
+	if idsFile != "" {
+		file, err := os.Open(idsFile)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+
+		var ids []string
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			if id := strings.TrimSpace(scanner.Text()); id != "" {
+				ids = append(ids, id)
+			}
+		}
+		return ids, scanner.Err()
+	}
+
+	u, err := url.Parse(source)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "file" {
+		return nil, errors.New("-ids-file is required for sources other than a file store")
+	}
+
+	matches, err := filepath.Glob(filepath.Join(u.Host+u.Path, "*.info"))
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(matches))
+	for _, match := range matches {
+		ids = append(ids, strings.TrimSuffix(filepath.Base(match), ".info"))
+	}
+	return ids, nil
+}
+
+// readMigrationProgress returns the set of source upload IDs which have already
+// been migrated according to the progress file. A missing file is not an error.
+func readMigrationProgress(path string) (map[string]struct{}, error) {
+	done := make(map[string]struct{})
+
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return done, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) > 0 {
+			done[fields[0]] = struct{}{}
+		}
+	}
+
+	return done, scanner.Err()
+}
@@ -0,0 +1,224 @@
+package cli
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tus/tusd/v2/pkg/filestore"
+	"github.com/tus/tusd/v2/pkg/handler"
+)
+
+// createUpload creates an upload in the store containing the given data.
+func createUpload(t *testing.T, store filestore.FileStore, info handler.FileInfo, data string) {
+	ctx := context.Background()
+	upload, err := store.NewUpload(ctx, info)
+	assert.NoError(t, err)
+
+	_, err = upload.WriteChunk(ctx, 0, strings.NewReader(data))
+	assert.NoError(t, err)
+
+	if int64(len(data)) == info.Size {
+		assert.NoError(t, upload.FinishUpload(ctx))
+	}
+}
+
+func readUpload(t *testing.T, store filestore.FileStore, id string) (handler.FileInfo, string) {
+	ctx := context.Background()
+	upload, err := store.GetUpload(ctx, id)
+	assert.NoError(t, err)
+
+	info, err := upload.GetInfo(ctx)
+	assert.NoError(t, err)
+
+	reader, err := upload.GetReader(ctx)
+	assert.NoError(t, err)
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	assert.NoError(t, err)
+
+	return info, string(data)
+}
+
+func TestMigrateUpload(t *testing.T) {
+	ctx := context.Background()
+	source := filestore.New(t.TempDir())
+	target := filestore.New(t.TempDir())
+
+	createUpload(t, source, handler.FileInfo{
+		ID:       "finished",
+		Size:     11,
+		MetaData: handler.MetaData{"filename": "hello.txt"},
+	}, "hello world")
+	createUpload(t, source, handler.FileInfo{
+		ID:   "unfinished",
+		Size: 100,
+	}, "hello")
+
+	t.Run("Finished", func(t *testing.T) {
+		a := assert.New(t)
+
+		id, err := migrateUpload(ctx, source, target, "finished", true, false)
+		a.NoError(err)
+		a.Equal("finished", id)
+
+		info, data := readUpload(t, target, "finished")
+		a.Equal(int64(11), info.Offset)
+		a.Equal(int64(11), info.Size)
+		a.Equal("hello.txt", info.MetaData["filename"])
+		a.Equal("hello world", data)
+	})
+
+	t.Run("Unfinished", func(t *testing.T) {
+		a := assert.New(t)
+
+		id, err := migrateUpload(ctx, source, target, "unfinished", true, false)
+		a.NoError(err)
+		a.Equal("unfinished", id)
+
+		info, data := readUpload(t, target, "unfinished")
+		a.Equal(int64(5), info.Offset)
+		a.Equal(int64(100), info.Size)
+		a.Equal("hello", data)
+	})
+
+	t.Run("ExistingTargetUpload", func(t *testing.T) {
+		a := assert.New(t)
+		target := filestore.New(t.TempDir())
+
+		// Leftover of an aborted migration containing stale data.
+		createUpload(t, target, handler.FileInfo{
+			ID:   "finished",
+			Size: 11,
+		}, "stale")
+
+		_, err := migrateUpload(ctx, source, target, "finished", true, false)
+		a.ErrorContains(err, "already exists in the target store")
+
+		_, err = migrateUpload(ctx, source, target, "finished", true, true)
+		a.NoError(err)
+
+		info, data := readUpload(t, target, "finished")
+		a.Equal(int64(11), info.Offset)
+		a.Equal("hello world", data)
+	})
+
+	t.Run("CleanupOnFailure", func(t *testing.T) {
+		a := assert.New(t)
+		target := filestore.New(t.TempDir())
+
+		_, err := migrateUpload(ctx, truncatedSource{source}, target, "finished", true, false)
+		a.EqualError(err, "short copy: wrote 5 of 11 bytes")
+
+		// The partial copy must have been removed, so the migration can be retried.
+		_, err = target.GetUpload(ctx, "finished")
+		a.ErrorIs(err, handler.ErrNotFound)
+
+		_, err = migrateUpload(ctx, source, target, "finished", true, false)
+		a.NoError(err)
+
+		_, data := readUpload(t, target, "finished")
+		a.Equal("hello world", data)
+	})
+
+	t.Run("IncompleteSource", func(t *testing.T) {
+		a := assert.New(t)
+		target := filestore.New(t.TempDir())
+
+		_, err := migrateUpload(ctx, incompleteSource{source}, target, "unfinished", true, false)
+		a.ErrorIs(err, errSourceIncomplete)
+
+		// Nothing must have been created in the target store.
+		_, err = target.GetUpload(ctx, "unfinished")
+		a.ErrorIs(err, handler.ErrNotFound)
+	})
+}
+
+// incompleteSource behaves like S3Store, which cannot provide the data of
+// unfinished uploads.
+type incompleteSource struct {
+	filestore.FileStore
+}
+
+func (store incompleteSource) GetUpload(ctx context.Context, id string) (handler.Upload, error) {
+	upload, err := store.FileStore.GetUpload(ctx, id)
+	return incompleteUpload{upload}, err
+}
+
+type incompleteUpload struct {
+	handler.Upload
+}
+
+func (upload incompleteUpload) GetReader(ctx context.Context) (io.ReadCloser, error) {
+	return nil, handler.NewError("ERR_INCOMPLETE_UPLOAD", "cannot stream non-finished upload", http.StatusBadRequest)
+}
+
+// truncatedSource provides only the first five bytes of every upload, simulating
+// a connection that is dropped while copying.
+type truncatedSource struct {
+	filestore.FileStore
+}
+
+func (store truncatedSource) GetUpload(ctx context.Context, id string) (handler.Upload, error) {
+	upload, err := store.FileStore.GetUpload(ctx, id)
+	return truncatedUpload{upload}, err
+}
+
+type truncatedUpload struct {
+	handler.Upload
+}
+
+func (upload truncatedUpload) GetReader(ctx context.Context) (io.ReadCloser, error) {
+	reader, err := upload.Upload.GetReader(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(reader, 5), reader}, nil
+}
+
+func TestMigrationUploadIDs(t *testing.T) {
+	a := assert.New(t)
+	dir := t.TempDir()
+
+	for _, name := range []string{"a.info", "a", "b.info", "b", "c"} {
+		a.NoError(os.WriteFile(filepath.Join(dir, name), nil, 0644))
+	}
+
+	ids, err := migrationUploadIDs("file://"+dir, "")
+	a.NoError(err)
+	a.Equal([]string{"a", "b"}, ids)
+
+	idsFile := filepath.Join(t.TempDir(), "ids")
+	a.NoError(os.WriteFile(idsFile, []byte("x\n\n  y  \n"), 0644))
+
+	ids, err = migrationUploadIDs("s3://bucket", idsFile)
+	a.NoError(err)
+	a.Equal([]string{"x", "y"}, ids)
+
+	_, err = migrationUploadIDs("s3://bucket", "")
+	a.EqualError(err, "-ids-file is required for sources other than a file store")
+}
+
+func TestReadMigrationProgress(t *testing.T) {
+	a := assert.New(t)
+	path := filepath.Join(t.TempDir(), "progress")
+
+	done, err := readMigrationProgress(path)
+	a.NoError(err)
+	a.Empty(done)
+
+	a.NoError(os.WriteFile(path, []byte("a a\nb+123 b+456\n\n"), 0644))
+
+	done, err = readMigrationProgress(path)
+	a.NoError(err)
+	a.Equal(map[string]struct{}{"a": {}, "b+123": {}}, done)
+}
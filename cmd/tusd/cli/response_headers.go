@@ -0,0 +1,66 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+
+	tushandler "github.com/tus/tusd/v2/pkg/handler"
+)
+
+// responseHeaders contains the headers for the admin server, which are loaded
+// using -response-headers-config. The other groups are passed to the handler.
+var responseHeaders responseHeaderConfig
+
+// responseHeaderConfig extends the handler's groups of response headers by a
+// group for the admin server.
+type responseHeaderConfig struct {
+	tushandler.ResponseHeaderConfig
+	// Admin is added to the responses of the admin server, in addition to All.
+	Admin tushandler.HTTPHeader `json:"admin,omitempty"`
+}
+
+// loadResponseHeaders reads the response headers from the JSON file at the
+// given path. The headers for the handler are validated by the handler.
+func loadResponseHeaders(filePath string) (responseHeaderConfig, error) {
+	var config responseHeaderConfig
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return config, err
+	}
+	defer file.Close()
+
+	decoder := json.NewDecoder(file)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&config); err != nil {
+		return config, fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	if err := tushandler.ValidateHeaders(config.Admin); err != nil {
+		return config, fmt.Errorf("invalid admin header: %w", err)
+	}
+
+	return config, nil
+}
+
+// adminResponseHeaders adds the configured headers to the responses of the
+// admin server.
+func adminResponseHeaders(h http.Handler) http.Handler {
+	if len(responseHeaders.All) == 0 && len(responseHeaders.Admin) == 0 {
+		return h
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := w.Header()
+		for key, value := range responseHeaders.All {
+			header.Set(key, value)
+		}
+		for key, value := range responseHeaders.Admin {
+			header.Set(key, value)
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
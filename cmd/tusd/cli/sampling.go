@@ -0,0 +1,152 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	tushandler "github.com/tus/tusd/v2/pkg/handler"
+)
+
+var MetricsUploadSamplesTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "tusd_upload_samples_total",
+		Help: "Total number of upload samples by result (sent, dropped or failed).",
+	},
+	[]string{"result"},
+)
+
+var MetricsUploadSampleBytesTotal = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "tusd_upload_sample_bytes_total",
+	Help: "Total number of bytes sent in upload samples.",
+})
+
+// uploadSamplerQueueSize is the number of samples waiting to be sent. If the
+// endpoint is slower than new samples arrive, further samples are dropped.
+const uploadSamplerQueueSize = 64
+
+// uploadSampler sends the beginning of a fraction of uploads to an HTTP
+// endpoint, e.g. for classifying their content. Samples are sent by a single
+// goroutine in the background, so uploads are never delayed by the endpoint.
+type uploadSampler struct {
+	endpoint string
+	// rate is the fraction of uploads, which are sampled, between 0 and 1.
+	rate float64
+	// size is the number of bytes sampled from the beginning of an upload.
+	size int64
+	// metadataKeys lists the metadata, which is included in samples. Other
+	// metadata is withheld, since it might identify the user.
+	metadataKeys []string
+	// optOutKey is the metadata key, which excludes an upload from sampling if
+	// it is present, e.g. set by the client or the pre-create hook.
+	optOutKey string
+	client    *http.Client
+	queue     chan tushandler.UploadSample
+}
+
+func setupUploadSampler() *uploadSampler {
+	if Flags.SampleUploadsRate <= 0 || Flags.SampleUploadsRate > 1 {
+		stderr.Fatalf("Invalid value for -sample-uploads-rate: must be greater than 0 and at most 1")
+	}
+	if Flags.SampleUploadsSize <= 0 {
+		stderr.Fatalf("Invalid value for -sample-uploads-size: must be greater than 0")
+	}
+
+	sampler := &uploadSampler{
+		endpoint:  Flags.SampleUploadsEndpoint,
+		rate:      Flags.SampleUploadsRate,
+		size:      Flags.SampleUploadsSize,
+		optOutKey: Flags.SampleUploadsOptOutKey,
+		client:    &http.Client{Timeout: 10 * time.Second},
+		queue:     make(chan tushandler.UploadSample, uploadSamplerQueueSize),
+	}
+	for _, key := range strings.Split(Flags.SampleUploadsMetadata, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			sampler.metadataKeys = append(sampler.metadataKeys, key)
+		}
+	}
+
+	go sampler.run()
+
+	stdout.Printf("Sending the first %d bytes of %g%% of uploads to %s\n", sampler.size, sampler.rate*100, sampler.endpoint)
+	return sampler
+}
+
+// SampleBytes selects uploads based on a hash of their ID, so that all requests
+// for an upload make the same decision, even on different instances.
+func (s *uploadSampler) SampleBytes(info tushandler.FileInfo) int64 {
+	if _, ok := info.MetaData[s.optOutKey]; ok && s.optOutKey != "" {
+		return 0
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(info.ID))
+	if float64(h.Sum32())/float64(1<<32) >= s.rate {
+		return 0
+	}
+
+	return s.size
+}
+
+func (s *uploadSampler) Sample(sample tushandler.UploadSample) {
+	select {
+	case s.queue <- sample:
+	default:
+		MetricsUploadSamplesTotal.WithLabelValues("dropped").Inc()
+	}
+}
+
+func (s *uploadSampler) run() {
+	for sample := range s.queue {
+		if err := s.send(sample); err != nil {
+			MetricsUploadSamplesTotal.WithLabelValues("failed").Inc()
+			stderr.Printf("Unable to send sample of upload %s: %s\n", sample.Upload.ID, err)
+			continue
+		}
+
+		MetricsUploadSamplesTotal.WithLabelValues("sent").Inc()
+		MetricsUploadSampleBytesTotal.Add(float64(len(sample.Data)))
+	}
+}
+
+// send posts the sampled data to the endpoint. The upload is identified using
+// headers named like the corresponding tus headers.
+func (s *uploadSampler) send(sample tushandler.UploadSample) error {
+	req, err := http.NewRequest(http.MethodPost, s.endpoint, bytes.NewReader(sample.Data))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Upload-Id", sample.Upload.ID)
+	req.Header.Set("Upload-Offset", strconv.FormatInt(sample.Offset, 10))
+	if !sample.Upload.SizeIsDeferred {
+		req.Header.Set("Upload-Length", strconv.FormatInt(sample.Upload.Size, 10))
+	}
+
+	metadata := make(map[string]string, len(s.metadataKeys))
+	for _, key := range s.metadataKeys {
+		if value, ok := sample.Upload.MetaData[key]; ok {
+			metadata[key] = value
+		}
+	}
+	if len(metadata) > 0 {
+		req.Header.Set("Upload-Metadata", tushandler.SerializeMetadataHeader(metadata))
+	}
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("unexpected response code %d", res.StatusCode)
+	}
+	return nil
+}
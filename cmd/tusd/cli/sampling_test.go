@@ -0,0 +1,80 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	tushandler "github.com/tus/tusd/v2/pkg/handler"
+)
+
+func TestUploadSamplerSampleBytes(t *testing.T) {
+	a := assert.New(t)
+
+	sampler := &uploadSampler{rate: 0.25, size: 100, optOutKey: "no-sampling"}
+
+	sampled := 0
+	for i := 0; i < 1000; i++ {
+		info := tushandler.FileInfo{ID: fmt.Sprintf("upload-%d", i)}
+		n := sampler.SampleBytes(info)
+		if n > 0 {
+			a.Equal(int64(100), n)
+			sampled++
+		}
+
+		// The decision does not change between requests.
+		a.Equal(n, sampler.SampleBytes(info))
+	}
+	a.InDelta(250, sampled, 50)
+
+	// Uploads can opt out of sampling.
+	sampler.rate = 1
+	a.Equal(int64(100), sampler.SampleBytes(tushandler.FileInfo{ID: "a"}))
+	a.Equal(int64(0), sampler.SampleBytes(tushandler.FileInfo{
+		ID:       "a",
+		MetaData: tushandler.MetaData{"no-sampling": ""},
+	}))
+}
+
+func TestUploadSamplerSend(t *testing.T) {
+	a := assert.New(t)
+
+	var req *http.Request
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req = r
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	sampler := &uploadSampler{
+		endpoint:     server.URL,
+		metadataKeys: []string{"filetype"},
+		client:       server.Client(),
+	}
+
+	err := sampler.send(tushandler.UploadSample{
+		Upload: tushandler.FileInfo{
+			ID:   "upload",
+			Size: 100,
+			MetaData: tushandler.MetaData{
+				"filetype": "image/png",
+				"filename": "secret.png",
+			},
+		},
+		Offset: 5,
+		Data:   []byte("hello"),
+	})
+	a.NoError(err)
+	a.Equal("hello", string(body))
+	a.Equal("upload", req.Header.Get("Upload-Id"))
+	a.Equal("5", req.Header.Get("Upload-Offset"))
+	a.Equal("100", req.Header.Get("Upload-Length"))
+
+	// Only the allowed metadata is included.
+	metadata := tushandler.ParseMetadataHeader(req.Header.Get("Upload-Metadata"))
+	a.Equal(map[string]string{"filetype": "image/png"}, metadata)
+}
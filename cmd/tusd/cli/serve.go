@@ -4,8 +4,10 @@ import (
 	"context"
 	"crypto/tls"
 	"errors"
+	"fmt"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
 	"regexp"
@@ -15,6 +17,7 @@ import (
 	tushandler "github.com/tus/tusd/v2/pkg/handler"
 	"github.com/tus/tusd/v2/pkg/hooks"
 	"github.com/tus/tusd/v2/pkg/hooks/plugin"
+	"github.com/tus/tusd/v2/pkg/tenant"
 )
 
 const (
@@ -35,9 +38,32 @@ func Serve() {
 		BasePath:                         Flags.Basepath,
 		Cors:                             getCorsConfig(),
 		RespectForwardedHeaders:          Flags.BehindProxy,
+		IPv6PrefixLength:                 Flags.IPv6PrefixLength,
+		StrictRequests:                   Flags.StrictRequests,
+		MaxHeaderSize:                    Flags.MaxHeaderSize,
 		EnableExperimentalProtocol:       Flags.ExperimentalProtocol,
 		DisableDownload:                  Flags.DisableDownload,
 		DisableTermination:               Flags.DisableTermination,
+		RedirectDownloads:                Flags.RedirectDownloads,
+		DownloadURLExpiry:                Flags.DownloadURLExpiry,
+		PresignCompletedUploads:          Flags.PresignCompletedUploads,
+		CompletedUploadURLExpiry:         Flags.CompletedUploadURLExpiry,
+		EnableDirectPartUploads:          Flags.DirectPartUploads,
+		PartURLExpiry:                    Flags.PartURLExpiry,
+		UploadExpiry:                     Flags.UploadExpiry,
+		PriorityMetadataKey:              Flags.PriorityMetadataKey,
+		ChecksumMetadataKey:              Flags.ChecksumMetadataKey,
+		DeduplicateChunks:                Flags.DeduplicateChunks,
+		DeduplicationTTL:                 Flags.DeduplicationTTL,
+		SkipReceivedPrefix:               Flags.SkipReceivedPrefix,
+		EnablePipelinedPatches:           Flags.PipelinedPatches,
+		AcceptPartialBodies:              Flags.AcceptPartialBodies,
+		ClientAbortStatusCodes:           Flags.ClientAbortStatusCodes,
+		EstimateUploadRate:               Flags.EstimateUploadRate,
+		MaxUploadWait:                    Flags.MaxUploadWait,
+		AcceptEncryptionKeys:             Flags.AcceptEncryptionKeys,
+		DecompressRequestBodies:          Flags.DecompressRequestBodies,
+		MaxDecompressionRatio:            Flags.MaxDecompressionRatio,
 		StoreComposer:                    Composer,
 		UploadProgressInterval:           Flags.ProgressHooksInterval,
 		AcquireLockTimeout:               Flags.AcquireLockTimeout,
@@ -45,27 +71,129 @@ func Serve() {
 		NetworkTimeout:                   Flags.NetworkTimeout,
 	}
 
-	var handler *tushandler.Handler
-	var err error
-	hookHandler := getHookHandler(&config)
-	if hookHandler != nil {
-		handler, err = hooks.NewHandlerWithHooks(&config, hookHandler, Flags.EnabledHooks)
+	// Download tokens are signed using a secret shared by all instances, which
+	// is therefore not passed as a flag, so that it does not appear in the
+	// process list.
+	if secret := os.Getenv("TUSD_DOWNLOAD_TOKEN_SECRET"); secret != "" {
+		config.DownloadTokenSecret = []byte(secret)
+	}
+	config.RequireDownloadTokens = Flags.RequireDownloadTokens
 
-		var enabledHooksString []string
-		for _, h := range Flags.EnabledHooks {
-			enabledHooksString = append(enabledHooksString, string(h))
+	if Flags.ProtocolVersions != "" {
+		config.ProtocolVersions = strings.Split(Flags.ProtocolVersions, ",")
+	}
+	if Flags.RemoteFetch {
+		config.EnableRemoteFetch = true
+		config.RemoteFetchRetries = Flags.RemoteFetchRetries
+		if config.RemoteFetchRetries == 0 {
+			// Zero would select the handler's default.
+			config.RemoteFetchRetries = -1
+		}
+		if Flags.RemoteFetchAllowedHosts != "" {
+			config.RemoteFetchAllowURL = allowedHosts(strings.Split(Flags.RemoteFetchAllowedHosts, ","))
+		}
+	}
+	if Flags.CaptureHeaders != "" {
+		config.CaptureHeaders = strings.Split(Flags.CaptureHeaders, ",")
+		config.StoreCapturedHeaders = Flags.StoreCapturedHeaders
+	}
+
+	if Flags.MetadataRules != "" {
+		rules, err := loadMetadataRules(Flags.MetadataRules)
+		if err != nil {
+			stderr.Fatalf("Unable to load metadata rules from %s: %s", Flags.MetadataRules, err)
 		}
+		config.MetadataRules = rules
+	}
 
-		stdout.Printf("Enabled hook events: %s", strings.Join(enabledHooksString, ", "))
+	if Flags.ResponseHeadersConfig != "" {
+		headers, err := loadResponseHeaders(Flags.ResponseHeadersConfig)
+		if err != nil {
+			stderr.Fatalf("Unable to load response headers from %s: %s", Flags.ResponseHeadersConfig, err)
+		}
+		responseHeaders = headers
+		config.ResponseHeaders = headers.ResponseHeaderConfig
+	}
 
-	} else {
-		handler, err = tushandler.NewHandler(config)
+	if Flags.IdempotencyKeyTTL > 0 {
+		config.IdempotencyCache = tushandler.NewMemoryIdempotencyCache(Flags.IdempotencyKeyTTL)
+	}
+
+	if Flags.AuditLog != "" {
+		setupAuditLog()
+		config.AuditLogger = auditLogger
+	}
+
+	if Flags.AccessLog != "" {
+		setupAccessLog()
+		config.AccessLogger = accessLogger
 	}
+
+	if Flags.SampleUploadsEndpoint != "" {
+		config.UploadSampler = setupUploadSampler()
+	}
+
+	if Flags.UploadIndex != "" {
+		setupUploadIndex()
+		config.UploadIndex = uploadIndex
+
+		// The file store lists unfinished uploads by reading the info of every
+		// upload, while a Bolt index keeps track of them itself.
+		if lister, ok := uploadIndex.(tushandler.ListableDataStore); ok && Composer != nil && usesFileStore() {
+			Composer.UseLister(lister)
+		}
+	}
+
+	if Flags.Principal != "" {
+		// Principals are identified in the same way as tenants.
+		resolver, err := tenant.ParseResolver(Flags.Principal, Flags.AllowUnverifiedJWTClaims)
+		if errors.Is(err, tenant.ErrUnverifiedJWT) {
+			stderr.Fatalf("Invalid value for -principal: jwt-claim does not verify the token's signature. Set -allow-unverified-jwt-claims if a proxy in front of tusd verifies it")
+		}
+		if err != nil {
+			stderr.Fatalf("Invalid value for -principal: %s", err)
+		}
+		config.ResolvePrincipal = resolver
+	}
+	config.EnableResumeDiscovery = Flags.ResumeDiscovery
+
+	mode, err := tushandler.ParseHandlerMode(Flags.HandlerMode)
 	if err != nil {
-		stderr.Fatalf("Unable to create handler: %s", err)
+		stderr.Fatalf("Invalid value for -handler-mode: %s", Flags.HandlerMode)
+	}
+	config.Mode = mode
+	if mode != tushandler.ModeReadWrite {
+		stdout.Printf("Serving only %s endpoints.\n", mode)
 	}
 
-	stdout.Printf("Supported tus extensions: %s\n", handler.SupportedExtensions())
+	setupMaintenance()
+	config.Maintenance = maintenance
+
+	if Flags.ByteBudgetSoft < 0 || Flags.ByteBudgetHard < 0 {
+		stderr.Fatalf("Invalid value for -byte-budget-soft or -byte-budget-hard: must not be negative")
+	}
+	config.ByteBudget = byteBudget("")
+
+	if Flags.TestScenarios {
+		stdout.Printf("Clients can simulate failures using the Tusd-Test header. Do not use this in production!\n")
+		config.EnableTestScenarios = true
+	}
+
+	// handler serves the tus requests. With -tenants-config, it passes them to
+	// the handlers of the tenants in tenantHandlers and tusHandler is nil.
+	var handler http.Handler
+	var tusHandler *tushandler.Handler
+	var tenantHandlers map[string]*tushandler.Handler
+	if Flags.TenantsConfig != "" {
+		if Flags.AdminPort != "" {
+			stderr.Fatalf("The admin interface is not supported together with -tenants-config")
+		}
+
+		handler, tenantHandlers = createTenantRouter(config)
+	} else {
+		tusHandler = createHandler(config, getHookHandler(&config))
+		handler = tusHandler
+	}
 
 	basepath := Flags.Basepath
 	address := ""
@@ -101,16 +229,35 @@ func Serve() {
 	}
 
 	if Flags.ExposeMetrics {
-		SetupMetrics(mux, handler)
+		SetupMetrics(mux, tusHandler)
 		hooks.SetupHookMetrics()
+		SetupMetricsPush()
 	}
 
 	if Flags.ExposePprof {
 		SetupPprof(mux)
 	}
 
-	var listener net.Listener
-	if Flags.HttpSock != "" {
+	// The sockets passed by systemd are inherited before the admin server is
+	// started, since it may use one of them.
+	setupSystemdListeners()
+
+	if Flags.AdminPort != "" {
+		// The diagnostics endpoints are installed first, since the web interface
+		// is served for all remaining paths.
+		SetupAdminDiagnostics()
+		SetupAdminMaintenance()
+		if Flags.S3LifecycleInterval > 0 {
+			SetupAdminLifecycle()
+		}
+		SetupAdmin(tusHandler)
+		ServeAdmin()
+	}
+
+	listener := takeSystemdListener(false)
+	if listener != nil {
+		stdout.Printf("Using socket passed by systemd instead of %s.\n", address)
+	} else if Flags.HttpSock != "" {
 		listener, err = NewUnixListener(address)
 	} else {
 		listener, err = NewListener(address)
@@ -142,7 +289,7 @@ func Serve() {
 		ReadTimeout:    0,
 		WriteTimeout:   0,
 		IdleTimeout:    Flags.NetworkTimeout,
-		MaxHeaderBytes: http.DefaultMaxHeaderBytes,
+		MaxHeaderBytes: maxHeaderBytes(),
 		ConnState: func(_ net.Conn, cs http.ConnState) {
 			switch cs {
 			case http.StateNew:
@@ -156,8 +303,27 @@ func Serve() {
 		},
 	}
 
+	// Without an index keeping track of expirations, expired uploads must be
+	// removed by an external job. Read-only instances leave this to the
+	// instances receiving the uploads.
+	if _, ok := uploadIndex.(tushandler.ExpiringUploadIndex); ok && Flags.UploadExpiry > 0 && mode != tushandler.ModeReadOnly {
+		if tusHandler != nil && Composer.UsesTerminater {
+			go terminateExpiredUploads(serverCtx, tusHandler)
+		}
+		for id, tenantHandler := range tenantHandlers {
+			if tenantComposers[id].UsesTerminater {
+				go terminateExpiredUploads(serverCtx, tenantHandler)
+			}
+		}
+	}
+
 	shutdownComplete := setupSignalHandler(server, cancelServerCtx)
 
+	// The listener is already accepting connections, so systemd can consider
+	// tusd ready, even though serving starts just below.
+	sdNotify("READY=1")
+	startSystemdWatchdog()
+
 	if protocol == "http" {
 		// Non-TLS mode
 		err = server.Serve(listener)
@@ -178,6 +344,33 @@ func Serve() {
 	}
 }
 
+// createHandler creates the tus handler for config, which invokes the hooks
+// using hookHandler if it is not nil.
+func createHandler(config tushandler.Config, hookHandler hooks.HookHandler) *tushandler.Handler {
+	var handler *tushandler.Handler
+	var err error
+	if hookHandler != nil {
+		handler, err = hooks.NewHandlerWithHooks(&config, hookHandler, Flags.EnabledHooks)
+
+		var enabledHooksString []string
+		for _, h := range Flags.EnabledHooks {
+			enabledHooksString = append(enabledHooksString, string(h))
+		}
+
+		stdout.Printf("Enabled hook events: %s", strings.Join(enabledHooksString, ", "))
+
+	} else {
+		handler, err = tushandler.NewHandler(config)
+	}
+	if err != nil {
+		stderr.Fatalf("Unable to create handler: %s", err)
+	}
+
+	stdout.Printf("Supported tus extensions: %s\n", handler.SupportedExtensions())
+
+	return handler
+}
+
 func serveTLS(server *http.Server, listener net.Listener) error {
 	switch Flags.TLSMode {
 	case TLS13:
@@ -224,14 +417,17 @@ func serveTLS(server *http.Server, listener net.Listener) error {
 	return server.ServeTLS(listener, Flags.TLSCertFile, Flags.TLSKeyFile)
 }
 
+// shutdownSignals receives the signals, which initiate a graceful shutdown. We
+// read up to two signals, so use a capacity of 2 here to not miss any signal.
+// When running as a Windows service, stopping the service sends to it as well.
+var shutdownSignals = make(chan os.Signal, 2)
+
 func setupSignalHandler(server *http.Server, cancelServerCtx context.CancelCauseFunc) <-chan struct{} {
 	shutdownComplete := make(chan struct{})
-
-	// We read up to two signals, so use a capacity of 2 here to not miss any signal
-	c := make(chan os.Signal, 2)
+	c := shutdownSignals
 
 	// os.Interrupt is mapped to SIGINT on Unix and to the termination instructions on Windows.
-	// On Unix we also listen to SIGTERM.
+	// SIGTERM is sent on Unix and, on Windows, when the console window is closed.
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 
 	// When closing the server, cancel its context so all open requests shut down as well.
@@ -244,6 +440,7 @@ func setupSignalHandler(server *http.Server, cancelServerCtx context.CancelCause
 		// First interrupt signal
 		<-c
 		stdout.Println("Received interrupt signal. Shutting down tusd...")
+		sdNotify("STOPPING=1")
 
 		// Wait for second interrupt signal, while also shutting down the existing server
 		go func() {
@@ -258,6 +455,14 @@ func setupSignalHandler(server *http.Server, cancelServerCtx context.CancelCause
 
 		err := server.Shutdown(ctx)
 
+		// The admin server only serves short requests, so it can share the timeout.
+		if adminErr := ShutdownAdmin(ctx); adminErr != nil {
+			stderr.Printf("Failed to shutdown admin server: %s\n", adminErr)
+		}
+
+		closeAuditLog()
+		closeAccessLog()
+
 		if err == nil {
 			stdout.Println("Shutdown completed. Goodbye!")
 		} else if errors.Is(err, context.DeadlineExceeded) {
@@ -275,6 +480,17 @@ func setupSignalHandler(server *http.Server, cancelServerCtx context.CancelCause
 	return shutdownComplete
 }
 
+// maxHeaderBytes returns the limit for http.Server.MaxHeaderBytes. If
+// -max-header-size is set, the server stops reading headers beyond it, while
+// the handler responds with 431 to requests exceeding the exact limit.
+func maxHeaderBytes() int {
+	if Flags.MaxHeaderSize > 0 {
+		return Flags.MaxHeaderSize
+	}
+
+	return http.DefaultMaxHeaderBytes
+}
+
 func getCorsConfig() *tushandler.CorsConfig {
 	config := tushandler.DefaultCorsConfig
 	config.Disable = Flags.DisableCors
@@ -301,3 +517,20 @@ func getCorsConfig() *tushandler.CorsConfig {
 
 	return &config
 }
+
+// allowedHosts returns a function for Config.RemoteFetchAllowURL, which only
+// accepts URLs whose host is one of the given hosts. Hosts starting with a dot
+// also match all of their subdomains.
+func allowedHosts(hosts []string) func(u *url.URL) error {
+	return func(u *url.URL) error {
+		hostname := strings.ToLower(u.Hostname())
+		for _, host := range hosts {
+			host = strings.ToLower(strings.TrimSpace(host))
+			if hostname == host || (strings.HasPrefix(host, ".") && (strings.HasSuffix(hostname, host) || hostname == host[1:])) {
+				return nil
+			}
+		}
+
+		return fmt.Errorf("host %s is not allowed", hostname)
+	}
+}
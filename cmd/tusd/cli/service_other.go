@@ -0,0 +1,14 @@
+//go:build !windows
+
+package cli
+
+// Service always fails, since Windows services are not available on this
+// platform.
+func Service(args []string) {
+	stderr.Fatalf("The service subcommand is only supported on Windows")
+}
+
+// RunService calls run, which serves tusd until it is shut down.
+func RunService(run func()) {
+	run()
+}
@@ -0,0 +1,243 @@
+//go:build windows
+
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/eventlog"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// serviceFlags holds the options for the `tusd service` subcommand.
+var serviceFlags struct {
+	Name        string
+	DisplayName string
+}
+
+// Service installs, removes, starts or stops tusd as a Windows service. Flags
+// following the install action are passed to tusd when the service starts:
+//
+//	tusd service install -name=tusd -- -upload-dir=C:\tusd\data -port=8080
+func Service(args []string) {
+	if len(args) == 0 {
+		stderr.Fatalf("Usage: tusd service install|uninstall|start|stop [options] [-- tusd options]")
+	}
+	action := args[0]
+
+	f := flag.NewFlagSet("tusd service "+action, flag.ExitOnError)
+	f.StringVar(&serviceFlags.Name, "name", "tusd", "Name of the Windows service")
+	f.StringVar(&serviceFlags.DisplayName, "display-name", "tusd", "Name of the service shown in the Services console")
+	f.Parse(args[1:])
+
+	m, err := mgr.Connect()
+	if err != nil {
+		stderr.Fatalf("Unable to connect to the service control manager: %s", err)
+	}
+	defer m.Disconnect()
+
+	switch action {
+	case "install":
+		err = installService(m, f.Args())
+	case "uninstall":
+		err = uninstallService(m)
+	case "start":
+		err = startService(m)
+	case "stop":
+		err = stopService(m)
+	default:
+		stderr.Fatalf("Unknown action %q, must be install, uninstall, start or stop", action)
+	}
+	if err != nil {
+		stderr.Fatalf("Unable to %s service %s: %s", action, serviceFlags.Name, err)
+	}
+
+	stdout.Printf("Service %s: %s completed.\n", serviceFlags.Name, action)
+}
+
+func installService(m *mgr.Mgr, args []string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	if s, err := m.OpenService(serviceFlags.Name); err == nil {
+		s.Close()
+		return fmt.Errorf("service already exists")
+	}
+
+	// The name is passed to tusd, so that it reports to the event log source
+	// registered below.
+	args = append([]string{"-windows-service-name=" + serviceFlags.Name}, args...)
+	s, err := m.CreateService(serviceFlags.Name, exe, mgr.Config{
+		DisplayName: serviceFlags.DisplayName,
+		Description: "tus resumable upload server",
+		StartType:   mgr.StartAutomatic,
+	}, args...)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	// Restart tusd if it exits unexpectedly. The failure count is reset after a
+	// day without failures.
+	err = s.SetRecoveryActions([]mgr.RecoveryAction{
+		{Type: mgr.ServiceRestart, Delay: 5 * time.Second},
+		{Type: mgr.ServiceRestart, Delay: 30 * time.Second},
+		{Type: mgr.ServiceRestart, Delay: time.Minute},
+	}, uint32((24 * time.Hour).Seconds()))
+	if err != nil {
+		s.Delete()
+		return err
+	}
+
+	if err := eventlog.InstallAsEventCreate(serviceFlags.Name, eventlog.Error|eventlog.Warning|eventlog.Info); err != nil {
+		s.Delete()
+		return fmt.Errorf("unable to register event log source: %w", err)
+	}
+
+	return nil
+}
+
+func uninstallService(m *mgr.Mgr) error {
+	s, err := m.OpenService(serviceFlags.Name)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	if err := s.Delete(); err != nil {
+		return err
+	}
+
+	return eventlog.Remove(serviceFlags.Name)
+}
+
+func startService(m *mgr.Mgr) error {
+	s, err := m.OpenService(serviceFlags.Name)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	return s.Start()
+}
+
+// stopService stops the service and waits until tusd has shut down gracefully.
+func stopService(m *mgr.Mgr) error {
+	s, err := m.OpenService(serviceFlags.Name)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	status, err := s.Control(svc.Stop)
+	if err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(time.Minute)
+	for status.State != svc.Stopped {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("service did not stop within a minute")
+		}
+
+		time.Sleep(300 * time.Millisecond)
+		status, err = s.Query()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RunService calls run, which serves tusd until it is shut down. If tusd has
+// been started by the service control manager, the log output is written to
+// the event log and stopping the service initiates a graceful shutdown.
+func RunService(run func()) {
+	isService, err := svc.IsWindowsService()
+	if err != nil {
+		stderr.Fatalf("Unable to determine whether tusd runs as a Windows service: %s", err)
+	}
+	if !isService {
+		run()
+		return
+	}
+
+	elog, err := eventlog.Open(Flags.WindowsServiceName)
+	if err != nil {
+		stderr.Fatalf("Unable to open event log: %s", err)
+	}
+	defer elog.Close()
+
+	// The event log records the time itself.
+	stdout.SetOutput(eventLogWriter{elog.Info})
+	stdout.SetFlags(0)
+	stderr.SetOutput(eventLogWriter{elog.Error})
+	stderr.SetFlags(0)
+
+	if err := svc.Run(Flags.WindowsServiceName, windowsService{run}); err != nil {
+		stderr.Fatalf("Unable to run Windows service: %s", err)
+	}
+}
+
+// windowsService implements svc.Handler by running tusd until the service is
+// stopped.
+type windowsService struct {
+	run func()
+}
+
+func (s windowsService) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+
+	done := make(chan struct{})
+	go func() {
+		s.run()
+		close(done)
+	}()
+
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+
+	stopping := false
+	for {
+		select {
+		case <-done:
+			return false, 0
+		case req := <-requests:
+			switch req.Cmd {
+			case svc.Interrogate:
+				status <- req.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				// Repeated requests are ignored, since a second interrupt would cause
+				// tusd to exit immediately.
+				if stopping {
+					continue
+				}
+				stopping = true
+
+				status <- svc.Status{
+					State:    svc.StopPending,
+					WaitHint: uint32((Flags.ShutdownTimeout + 5*time.Second).Milliseconds()),
+				}
+				shutdownSignals <- os.Interrupt
+			}
+		}
+	}
+}
+
+// eventLogWriter is an io.Writer, which writes each log line to the event log.
+type eventLogWriter struct {
+	write func(eid uint32, msg string) error
+}
+
+func (w eventLogWriter) Write(msg []byte) (int, error) {
+	if err := w.write(1, string(msg)); err != nil {
+		return 0, err
+	}
+	return len(msg), nil
+}
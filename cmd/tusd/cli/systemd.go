@@ -0,0 +1,161 @@
+package cli
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// systemdListenFdsStart is the first file descriptor passed by systemd using
+// socket activation. See sd_listen_fds(3).
+const systemdListenFdsStart = 3
+
+// systemdAdminSocketName is the FileDescriptorName= of the socket, which is
+// used for the admin server instead of the tus server.
+const systemdAdminSocketName = "admin"
+
+// systemdListener is a listener inherited from systemd together with its name.
+type systemdListener struct {
+	name     string
+	listener net.Listener
+}
+
+// systemdListeners holds the listeners inherited from systemd, which have not
+// been taken yet. See setupSystemdListeners.
+var systemdListeners []systemdListener
+
+// setupSystemdListeners inherits the sockets passed by systemd if tusd has been
+// started using socket activation. Since systemd keeps the sockets open while
+// tusd is restarted, connections are queued instead of refused during restarts.
+// The environment variables are removed afterwards, so that they are not passed
+// on to hooks or plugins.
+func setupSystemdListeners() {
+	n, names := parseListenFds(os.Getenv("LISTEN_PID"), os.Getenv("LISTEN_FDS"), os.Getenv("LISTEN_FDNAMES"), os.Getpid())
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	for i := 0; i < n; i++ {
+		file := os.NewFile(uintptr(systemdListenFdsStart+i), names[i])
+		listener, err := net.FileListener(file)
+		// net.FileListener duplicates the file descriptor, so the original one is
+		// not needed anymore.
+		file.Close()
+		if err != nil {
+			stderr.Fatalf("Unable to use socket %q passed by systemd: %s", names[i], err)
+		}
+
+		systemdListeners = append(systemdListeners, systemdListener{
+			name:     names[i],
+			listener: listener,
+		})
+	}
+
+	if n > 0 {
+		stdout.Printf("Using %d socket(s) passed by systemd.\n", n)
+	}
+}
+
+// parseListenFds returns the number and names of the file descriptors passed by
+// systemd, if they are intended for the process with the given PID. Names,
+// which are not provided, are empty.
+func parseListenFds(listenPid, listenFds, listenFdNames string, pid int) (int, []string) {
+	if listenPid != strconv.Itoa(pid) {
+		return 0, nil
+	}
+
+	n, err := strconv.Atoi(listenFds)
+	if err != nil || n <= 0 {
+		return 0, nil
+	}
+
+	names := make([]string, n)
+	if listenFdNames != "" {
+		copy(names, strings.Split(listenFdNames, ":"))
+	}
+
+	return n, names
+}
+
+// takeSystemdListener returns the inherited listener for the admin server or,
+// if admin is false, for the tus server. It returns nil if no such listener
+// has been passed by systemd.
+func takeSystemdListener(admin bool) net.Listener {
+	for i, l := range systemdListeners {
+		if (l.name == systemdAdminSocketName) == admin {
+			systemdListeners = append(systemdListeners[:i], systemdListeners[i+1:]...)
+			return l.listener
+		}
+	}
+
+	return nil
+}
+
+// sdNotify sends a state change, such as READY=1, to systemd if tusd is running
+// as a service of Type=notify. See sd_notify(3).
+func sdNotify(state string) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return
+	}
+
+	// Sockets in the abstract namespace are prefixed with @ in the variable.
+	if strings.HasPrefix(socket, "@") {
+		socket = "\x00" + socket[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		stderr.Printf("Unable to notify systemd: %s\n", err)
+		return
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte(state)); err != nil {
+		stderr.Printf("Unable to notify systemd: %s\n", err)
+	}
+}
+
+// startSystemdWatchdog periodically notifies systemd that tusd is alive, if the
+// service has WatchdogSec= set. Notifications are sent twice per interval, as
+// recommended by sd_watchdog_enabled(3).
+func startSystemdWatchdog() {
+	interval, err := parseWatchdogInterval(os.Getenv("WATCHDOG_PID"), os.Getenv("WATCHDOG_USEC"), os.Getpid())
+	if err != nil {
+		stderr.Printf("Unable to enable systemd watchdog: %s\n", err)
+		return
+	}
+	if interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval / 2)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			sdNotify("WATCHDOG=1")
+		}
+	}()
+}
+
+// parseWatchdogInterval returns the watchdog interval for the process with the
+// given PID, or zero if the watchdog is disabled.
+func parseWatchdogInterval(watchdogPid, watchdogUsec string, pid int) (time.Duration, error) {
+	if watchdogUsec == "" {
+		return 0, nil
+	}
+	if watchdogPid != "" && watchdogPid != strconv.Itoa(pid) {
+		return 0, nil
+	}
+
+	usec, err := strconv.ParseInt(watchdogUsec, 10, 64)
+	if err != nil || usec <= 0 {
+		return 0, fmt.Errorf("invalid WATCHDOG_USEC %q", watchdogUsec)
+	}
+
+	return time.Duration(usec) * time.Microsecond, nil
+}
@@ -0,0 +1,72 @@
+package cli
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseListenFds(t *testing.T) {
+	a := assert.New(t)
+
+	n, names := parseListenFds("42", "2", "tusd.socket:admin", 42)
+	a.Equal(2, n)
+	a.Equal([]string{"tusd.socket", "admin"}, names)
+
+	n, names = parseListenFds("42", "2", "", 42)
+	a.Equal(2, n)
+	a.Equal([]string{"", ""}, names)
+
+	// The sockets are intended for another process.
+	n, _ = parseListenFds("41", "2", "", 42)
+	a.Equal(0, n)
+
+	n, _ = parseListenFds("", "", "", 42)
+	a.Equal(0, n)
+}
+
+func TestParseWatchdogInterval(t *testing.T) {
+	a := assert.New(t)
+
+	interval, err := parseWatchdogInterval("42", "30000000", 42)
+	a.NoError(err)
+	a.Equal(30*time.Second, interval)
+
+	interval, err = parseWatchdogInterval("", "1000", 42)
+	a.NoError(err)
+	a.Equal(time.Millisecond, interval)
+
+	interval, err = parseWatchdogInterval("41", "1000", 42)
+	a.NoError(err)
+	a.Equal(time.Duration(0), interval)
+
+	interval, err = parseWatchdogInterval("", "", 42)
+	a.NoError(err)
+	a.Equal(time.Duration(0), interval)
+
+	_, err = parseWatchdogInterval("", "soon", 42)
+	a.Error(err)
+}
+
+func TestSdNotify(t *testing.T) {
+	a := assert.New(t)
+
+	path := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Skipf("unixgram sockets are not supported: %s", err)
+	}
+	defer conn.Close()
+
+	t.Setenv("NOTIFY_SOCKET", path)
+	sdNotify("READY=1")
+
+	buf := make([]byte, 64)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	a.NoError(err)
+	a.Equal("READY=1", string(buf[:n]))
+}
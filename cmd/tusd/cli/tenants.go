@@ -0,0 +1,306 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	tushandler "github.com/tus/tusd/v2/pkg/handler"
+	"github.com/tus/tusd/v2/pkg/hooks"
+	"github.com/tus/tusd/v2/pkg/prometheuscollector"
+	"github.com/tus/tusd/v2/pkg/tenant"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/exp/slices"
+)
+
+// tenantsConfig is the content of the file passed to -tenants-config.
+type tenantsConfig struct {
+	// Resolver determines the tenant of a request, see tenant.ParseResolver,
+	// e.g. "header:X-Tenant-Id", "jwt-claim:tenant" or "host:.example.com".
+	Resolver string `json:"resolver"`
+	// Tenants maps the IDs of the tenants to their configuration.
+	Tenants map[string]tenantConfig `json:"tenants"`
+}
+
+type tenantConfig struct {
+	// Bucket replaces the bucket or container configured using the flags.
+	Bucket string `json:"bucket"`
+	// ObjectPrefix is appended to the object prefix configured using the flags.
+	// For the file storage, it is a subdirectory of the upload directory.
+	// Defaults to the tenant's ID followed by a slash if no bucket is set, so
+	// that the uploads of different tenants are kept apart.
+	ObjectPrefix string `json:"objectPrefix"`
+	// MaxSize replaces the maximum size of uploads configured using -max-size.
+	MaxSize int64 `json:"maxSize"`
+	// RequestsPerSecond, Burst and MaxConcurrentUploads limit the requests of
+	// the tenant, see tenant.Limits.
+	RequestsPerSecond    float64 `json:"requestsPerSecond"`
+	Burst                int     `json:"burst"`
+	MaxConcurrentUploads int     `json:"maxConcurrentUploads"`
+	// ClientRequestsPerSecond, ClientBurst and MaxConcurrentUploadsPerClient
+	// limit the requests of each of the tenant's clients, see tenant.Limits.
+	ClientRequestsPerSecond       float64 `json:"clientRequestsPerSecond"`
+	ClientBurst                   int     `json:"clientBurst"`
+	MaxConcurrentUploadsPerClient int     `json:"maxConcurrentUploadsPerClient"`
+	// HooksHttpEndpoint replaces the hook handler configured using the flags
+	// with HTTP hooks sent to this endpoint.
+	HooksHttpEndpoint string `json:"hooksHttpEndpoint"`
+}
+
+var tenants tenantsConfig
+var tenantComposers = make(map[string]*tushandler.StoreComposer)
+
+// loadTenantsConfig reads and validates the tenants' configuration from the
+// file at the given path.
+func loadTenantsConfig(filePath string) (tenantsConfig, error) {
+	var config tenantsConfig
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return config, err
+	}
+	defer file.Close()
+
+	decoder := json.NewDecoder(file)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&config); err != nil {
+		return config, fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	if _, err := tenant.ParseResolver(config.Resolver, Flags.AllowUnverifiedJWTClaims); err != nil {
+		if errors.Is(err, tenant.ErrUnverifiedJWT) {
+			return config, fmt.Errorf("%w. Set -allow-unverified-jwt-claims if a proxy in front of tusd verifies it", err)
+		}
+		return config, err
+	}
+
+	if len(config.Tenants) == 0 {
+		return config, fmt.Errorf("no tenants configured")
+	}
+
+	// Uploads are only kept apart by their storage location, so tenants must
+	// not share one.
+	locations := make(map[storageLocation]string)
+	for _, id := range sortedTenantIDs(config.Tenants) {
+		t := config.Tenants[id]
+		if id == "" || strings.Contains(id, "/") || id == "." || id == ".." {
+			return config, fmt.Errorf("invalid tenant ID %q", id)
+		}
+
+		if t.Bucket == "" && t.ObjectPrefix == "" {
+			t.ObjectPrefix = id + "/"
+		}
+		if path.IsAbs(t.ObjectPrefix) || strings.HasPrefix(path.Clean(t.ObjectPrefix), "..") {
+			return config, fmt.Errorf("object prefix of tenant %q must be relative", id)
+		}
+
+		location := storageLocation{Bucket: t.Bucket, ObjectPrefix: t.ObjectPrefix}
+		if other, ok := locations[location]; ok {
+			return config, fmt.Errorf("tenants %q and %q use the same storage location", other, id)
+		}
+		locations[location] = id
+
+		config.Tenants[id] = t
+	}
+
+	return config, nil
+}
+
+// createTenantComposers creates a composer for each tenant configured using
+// -tenants-config. The stores' metrics carry the tenant's ID as label.
+func createTenantComposers() {
+	var err error
+	tenants, err = loadTenantsConfig(Flags.TenantsConfig)
+	if err != nil {
+		stderr.Fatalf("Unable to load tenants from %s: %s", Flags.TenantsConfig, err)
+	}
+
+	for _, id := range sortedTenantIDs(tenants.Tenants) {
+		t := tenants.Tenants[id]
+		stdout.Printf("Setting up storage for tenant '%s'.\n", id)
+
+		registerer := prometheus.WrapRegistererWith(prometheus.Labels{"tenant": id}, prometheus.DefaultRegisterer)
+		composer := createComposer(storageLocation{
+			Bucket:       t.Bucket,
+			ObjectPrefix: t.ObjectPrefix,
+		}, registerer)
+		if Flags.StoreCircuitBreaker {
+			composer = createCircuitBreakerComposer(id, composer, registerer)
+		}
+		tenantComposers[id] = composer
+	}
+}
+
+// createTenantRouter creates a handler for each tenant based on config and
+// returns the router, which passes the requests to them, and the handlers by
+// the tenants' IDs.
+func createTenantRouter(config tushandler.Config) (*tenant.Router, map[string]*tushandler.Handler) {
+	resolve, _ := tenant.ParseResolver(tenants.Resolver, Flags.AllowUnverifiedJWTClaims)
+	router := tenant.NewRouter(resolve)
+	handlers := make(map[string]*tushandler.Handler, len(tenants.Tenants))
+
+	for _, id := range sortedTenantIDs(tenants.Tenants) {
+		t := tenants.Tenants[id]
+
+		tenantConfig := config
+		tenantConfig.StoreComposer = tenantComposers[id]
+		if t.MaxSize > 0 {
+			tenantConfig.MaxSize = t.MaxSize
+		}
+		if t.Bucket != "" {
+			tenantConfig.ByteBudget = byteBudget(t.Bucket)
+		}
+		if config.UploadIndex != nil {
+			tenantConfig.UploadIndex = newTenantUploadIndex(config.UploadIndex, id)
+		}
+		// Idempotency keys are chosen by clients, so each tenant needs its
+		// own cache to prevent collisions.
+		if Flags.IdempotencyKeyTTL > 0 {
+			tenantConfig.IdempotencyCache = tushandler.NewMemoryIdempotencyCache(Flags.IdempotencyKeyTTL)
+		}
+
+		var hookHandler hooks.HookHandler
+		if t.HooksHttpEndpoint != "" {
+			stdout.Printf("Using '%s' as the endpoint for hooks of tenant '%s'", t.HooksHttpEndpoint, id)
+
+			hookHandler = newHttpHook(t.HooksHttpEndpoint)
+		} else {
+			hookHandler = getHookHandler(&tenantConfig)
+		}
+
+		handler := createHandler(tenantConfig, hookHandler)
+
+		limiter := tenant.NewLimiter(id, tenant.Limits{
+			RequestsPerSecond:    t.RequestsPerSecond,
+			Burst:                t.Burst,
+			MaxConcurrentUploads: t.MaxConcurrentUploads,
+
+			ClientRequestsPerSecond:       t.ClientRequestsPerSecond,
+			ClientBurst:                   t.ClientBurst,
+			MaxConcurrentUploadsPerClient: t.MaxConcurrentUploadsPerClient,
+		})
+		handler.Use(tushandler.PostAuthStage, limiter.Middleware)
+
+		if Flags.ExposeMetrics {
+			registerer := prometheus.WrapRegistererWith(prometheus.Labels{"tenant": id}, prometheus.DefaultRegisterer)
+			registerer.MustRegister(prometheuscollector.New(handler.Metrics))
+		}
+
+		router.Add(id, handler)
+		handlers[id] = handler
+	}
+
+	stdout.Printf("Serving %d tenants.\n", len(tenants.Tenants))
+
+	return router, handlers
+}
+
+// tenantUploadIndex is the part of the upload index, which is shared by all
+// tenants, belonging to a single tenant. Since uploads of different tenants may
+// have the same ID, their IDs are prefixed with the tenant's ID in the index.
+// They also carry the tenant's tag, so that searches, for example for resume
+// discovery, and the expiration of uploads only consider the tenant's uploads.
+type tenantUploadIndex struct {
+	index tushandler.UploadIndex
+	id    string
+}
+
+// expiringTenantUploadIndex is a tenantUploadIndex for an index implementing
+// tushandler.ExpiringUploadIndex.
+type expiringTenantUploadIndex struct {
+	tenantUploadIndex
+}
+
+// newTenantUploadIndex returns the part of index belonging to the tenant with
+// the given ID. It implements tushandler.ExpiringUploadIndex if index does.
+func newTenantUploadIndex(index tushandler.UploadIndex, id string) tushandler.UploadIndex {
+	scoped := tenantUploadIndex{index: index, id: id}
+	if _, ok := index.(tushandler.ExpiringUploadIndex); ok {
+		return expiringTenantUploadIndex{scoped}
+	}
+
+	return scoped
+}
+
+func (t tenantUploadIndex) prefix() string {
+	return t.id + "/"
+}
+
+func (t tenantUploadIndex) tag() string {
+	return "tenant:" + t.id
+}
+
+// withTag returns a copy of tags including the tenant's tag.
+func (t tenantUploadIndex) withTag(tags []string) []string {
+	return append(slices.Clone(tags), t.tag())
+}
+
+func (t tenantUploadIndex) AddUpload(ctx context.Context, entry tushandler.IndexEntry) error {
+	entry.ID = t.prefix() + entry.ID
+	entry.Tags = t.withTag(entry.Tags)
+	return t.index.AddUpload(ctx, entry)
+}
+
+func (t tenantUploadIndex) UpdateUpload(ctx context.Context, id string, offset int64, state tushandler.UploadState, at time.Time) error {
+	return t.index.UpdateUpload(ctx, t.prefix()+id, offset, state, at)
+}
+
+func (t tenantUploadIndex) SetUploadTags(ctx context.Context, id string, tags []string) error {
+	return t.index.SetUploadTags(ctx, t.prefix()+id, t.withTag(tags))
+}
+
+func (t tenantUploadIndex) SearchUploads(ctx context.Context, query tushandler.IndexQuery) ([]tushandler.IndexEntry, string, error) {
+	query.Tags = t.withTag(query.Tags)
+	entries, nextCursor, err := t.index.SearchUploads(ctx, query)
+	if err != nil {
+		return nil, "", err
+	}
+
+	for i := range entries {
+		entries[i].ID = strings.TrimPrefix(entries[i].ID, t.prefix())
+		if j := slices.Index(entries[i].Tags, t.tag()); j >= 0 {
+			entries[i].Tags = slices.Delete(entries[i].Tags, j, j+1)
+		}
+	}
+
+	return entries, nextCursor, nil
+}
+
+func (t expiringTenantUploadIndex) SetUploadExpiration(ctx context.Context, id string, expiresAt time.Time) error {
+	return t.index.(tushandler.ExpiringUploadIndex).SetUploadExpiration(ctx, t.prefix()+id, expiresAt)
+}
+
+func (t expiringTenantUploadIndex) ExpiredUploads(ctx context.Context, before time.Time) ([]string, error) {
+	ids, err := t.index.(tushandler.ExpiringUploadIndex).ExpiredUploads(ctx, before)
+	if err != nil {
+		return nil, err
+	}
+
+	var tenantIDs []string
+	for _, id := range ids {
+		if id, ok := strings.CutPrefix(id, t.prefix()); ok {
+			tenantIDs = append(tenantIDs, id)
+		}
+	}
+
+	return tenantIDs, nil
+}
+
+// sortedTenantIDs returns the IDs of the tenants in alphabetical order, so that
+// the tenants are set up in a predictable order.
+func sortedTenantIDs(tenants map[string]tenantConfig) []string {
+	ids := make([]string, 0, len(tenants))
+	for id := range tenants {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	return ids
+}
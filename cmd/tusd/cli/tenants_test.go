@@ -0,0 +1,111 @@
+package cli
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	tushandler "github.com/tus/tusd/v2/pkg/handler"
+	"github.com/tus/tusd/v2/pkg/tenant"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadTenantsConfig(t *testing.T) {
+	a := assert.New(t)
+
+	load := func(content string) (tenantsConfig, error) {
+		path := filepath.Join(t.TempDir(), "tenants.json")
+		a.NoError(os.WriteFile(path, []byte(content), 0644))
+		return loadTenantsConfig(path)
+	}
+
+	config, err := load(`{
+		"resolver": "header:X-Tenant-Id",
+		"tenants": {
+			"acme": {"maxSize": 1024, "requestsPerSecond": 5},
+			"globex": {"bucket": "globex-uploads"},
+			"initech": {"objectPrefix": "customers/initech/"}
+		}
+	}`)
+	a.NoError(err)
+	a.Equal("acme/", config.Tenants["acme"].ObjectPrefix)
+	a.Equal(int64(1024), config.Tenants["acme"].MaxSize)
+	a.Equal("", config.Tenants["globex"].ObjectPrefix)
+	a.Equal("customers/initech/", config.Tenants["initech"].ObjectPrefix)
+
+	for name, content := range map[string]string{
+		"UnknownResolver": `{"resolver": "cookie:tenant", "tenants": {"acme": {}}}`,
+		"NoTenants":       `{"resolver": "header:X-Tenant-Id", "tenants": {}}`,
+		"UnknownField":    `{"resolver": "header:X-Tenant-Id", "tenants": {"acme": {"prefix": "acme/"}}}`,
+		"SharedLocation":  `{"resolver": "header:X-Tenant-Id", "tenants": {"acme": {}, "globex": {"objectPrefix": "acme/"}}}`,
+		"EscapingPrefix":  `{"resolver": "header:X-Tenant-Id", "tenants": {"acme": {"objectPrefix": "../acme/"}}}`,
+		"InvalidID":       `{"resolver": "header:X-Tenant-Id", "tenants": {"..": {}}}`,
+	} {
+		_, err := load(content)
+		a.Error(err, name)
+	}
+}
+
+func TestLoadTenantsConfigUnverifiedJWT(t *testing.T) {
+	a := assert.New(t)
+
+	path := filepath.Join(t.TempDir(), "tenants.json")
+	a.NoError(os.WriteFile(path, []byte(`{"resolver": "jwt-claim:tenant", "tenants": {"acme": {}}}`), 0644))
+
+	_, err := loadTenantsConfig(path)
+	a.ErrorIs(err, tenant.ErrUnverifiedJWT)
+
+	Flags.AllowUnverifiedJWTClaims = true
+	defer func() { Flags.AllowUnverifiedJWTClaims = false }()
+
+	_, err = loadTenantsConfig(path)
+	a.NoError(err)
+}
+
+func TestTenantUploadIndex(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+
+	shared := tushandler.NewMemoryUploadIndex()
+	acme := newTenantUploadIndex(shared, "acme").(tushandler.ExpiringUploadIndex)
+	globex := newTenantUploadIndex(shared, "globex").(tushandler.ExpiringUploadIndex)
+
+	expiresAt := time.Now().Add(-time.Minute)
+	for _, index := range []tushandler.ExpiringUploadIndex{acme, globex} {
+		a.NoError(index.AddUpload(ctx, tushandler.IndexEntry{
+			ID:        "upload",
+			Tags:      []string{"principal:alice"},
+			State:     tushandler.UploadStateInProgress,
+			ExpiresAt: expiresAt,
+		}))
+	}
+
+	// Both uploads are kept apart in the shared index.
+	entries, _, err := shared.SearchUploads(ctx, tushandler.IndexQuery{})
+	a.NoError(err)
+	a.Len(entries, 2)
+
+	entries, _, err = acme.SearchUploads(ctx, tushandler.IndexQuery{Tags: []string{"principal:alice"}})
+	a.NoError(err)
+	a.Len(entries, 1)
+	a.Equal("upload", entries[0].ID)
+	a.Equal([]string{"principal:alice"}, entries[0].Tags)
+
+	ids, err := acme.ExpiredUploads(ctx, time.Now())
+	a.NoError(err)
+	a.Equal([]string{"upload"}, ids)
+
+	// Terminating the tenant's upload does not affect the other tenant.
+	a.NoError(acme.UpdateUpload(ctx, "upload", 0, tushandler.UploadStateTerminated, time.Now()))
+
+	ids, err = acme.ExpiredUploads(ctx, time.Now())
+	a.NoError(err)
+	a.Empty(ids)
+
+	ids, err = globex.ExpiredUploads(ctx, time.Now())
+	a.NoError(err)
+	a.Equal([]string{"upload"}, ids)
+}
@@ -1,10 +1,34 @@
 package main
 
 import (
+	"os"
+
 	"github.com/tus/tusd/v2/cmd/tusd/cli"
 )
 
 func main() {
+	// Subcommands are dispatched before the regular flags are parsed, since
+	// they come with their own set of options.
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "bench":
+			cli.Bench(os.Args[2:])
+			return
+		case "migrate":
+			cli.Migrate(os.Args[2:])
+			return
+		case "hook-schemas":
+			cli.HookSchemas(os.Args[2:])
+			return
+		case "init-bucket":
+			cli.InitBucket(os.Args[2:])
+			return
+		case "service":
+			cli.Service(os.Args[2:])
+			return
+		}
+	}
+
 	cli.ParseFlags()
 	cli.PrepareGreeting()
 
@@ -13,7 +37,11 @@ func main() {
 	if cli.Flags.ShowVersion {
 		cli.ShowVersion()
 	} else {
-		cli.CreateComposer()
-		cli.Serve()
+		// When started by the Windows service control manager, tusd reports its
+		// status to it and shuts down gracefully when the service is stopped.
+		cli.RunService(func() {
+			cli.CreateComposer()
+			cli.Serve()
+		})
 	}
 }
@@ -0,0 +1,30 @@
+// This example shows how a data store is run as a plugin for tusd, which can be
+// loaded using `tusd -store-plugin=./store_plugin`. It serves the file store,
+// but any implementation of handler.DataStore can be used instead.
+package main
+
+import (
+	"log"
+	"os"
+
+	"github.com/tus/tusd/v2/pkg/filestore"
+	"github.com/tus/tusd/v2/pkg/handler"
+	"github.com/tus/tusd/v2/pkg/pluginstore"
+)
+
+func main() {
+	// Use the log package to write debug messages. Do not write to stdout
+	// directly, as this is used for communication between tusd and the plugin.
+	log.Println("Store plugin is starting")
+
+	dir := "./data"
+	if err := os.MkdirAll(dir, 0774); err != nil {
+		log.Fatalf("Unable to ensure directory exists: %s", err)
+	}
+
+	composer := handler.NewStoreComposer()
+	store := filestore.New(dir)
+	store.UseIn(composer)
+
+	pluginstore.Serve(composer)
+}
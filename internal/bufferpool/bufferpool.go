@@ -0,0 +1,91 @@
+// Package bufferpool provides pools of buffers, which are shared across the
+// data path to reduce allocations and garbage collection pauses when many
+// uploads are transferred concurrently.
+package bufferpool
+
+import (
+	"bytes"
+	"io"
+	"math/bits"
+	"sync"
+)
+
+// CopyBufferSize is the size of the buffers used by Copy, which matches the
+// size of the buffers allocated by io.Copy.
+const CopyBufferSize = 32 * 1024
+
+// MaxBufferSize is the capacity up to which buffers are pooled. Larger
+// buffers are left to the garbage collector.
+const MaxBufferSize = 256 * 1024 * 1024
+
+var copyBuffers = sync.Pool{
+	New: func() any {
+		buf := make([]byte, CopyBufferSize)
+		return &buf
+	},
+}
+
+// buffers holds one pool per size class. Class i contains buffers with a
+// capacity of at least 1<<i bytes.
+var buffers [bits.UintSize]sync.Pool
+
+// GetCopyBuffer returns a buffer of CopyBufferSize bytes. It should be
+// returned using PutCopyBuffer once it is no longer used.
+func GetCopyBuffer() *[]byte {
+	return copyBuffers.Get().(*[]byte)
+}
+
+// PutCopyBuffer returns a buffer obtained from GetCopyBuffer to the pool.
+func PutCopyBuffer(buf *[]byte) {
+	copyBuffers.Put(buf)
+}
+
+// Copy copies from src to dst like io.Copy, but uses a pooled buffer. The
+// io.ReaderFrom and io.WriterTo implementations of dst and src are not used,
+// because many of them allocate their own buffer, for example *os.File when
+// reading from a request body. Use io.CopyBuffer with GetCopyBuffer if these
+// implementations allow copying without a buffer, for example using sendfile.
+func Copy(dst io.Writer, src io.Reader) (int64, error) {
+	buf := GetCopyBuffer()
+	defer PutCopyBuffer(buf)
+
+	return io.CopyBuffer(writerOnly{dst}, readerOnly{src}, *buf)
+}
+
+// GetBuffer returns an empty buffer, which can hold at least size bytes
+// without growing. It should be returned using PutBuffer once neither the
+// buffer nor its contents are used anymore.
+func GetBuffer(size int64) *bytes.Buffer {
+	if size <= 0 || size > MaxBufferSize {
+		return new(bytes.Buffer)
+	}
+
+	class := bits.Len64(uint64(size - 1))
+	if buf, ok := buffers[class].Get().(*bytes.Buffer); ok {
+		return buf
+	}
+
+	return bytes.NewBuffer(make([]byte, 0, 1<<class))
+}
+
+// PutBuffer resets the buffer and returns it to the pool of its size class.
+func PutBuffer(buf *bytes.Buffer) {
+	capacity := buf.Cap()
+	if capacity == 0 || capacity > MaxBufferSize {
+		return
+	}
+
+	buf.Reset()
+	// The buffer is placed in the largest class whose size it can hold.
+	buffers[bits.Len64(uint64(capacity))-1].Put(buf)
+}
+
+// writerOnly hides the io.ReaderFrom implementation of a writer.
+type writerOnly struct {
+	io.Writer
+}
+
+// readerOnly hides the io.WriterTo implementation of a reader.
+type readerOnly struct {
+	io.Reader
+}
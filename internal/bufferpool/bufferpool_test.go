@@ -0,0 +1,106 @@
+package bufferpool
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCopy(t *testing.T) {
+	a := assert.New(t)
+
+	data := bytes.Repeat([]byte("tusd"), CopyBufferSize)
+	dst := new(bytes.Buffer)
+
+	n, err := Copy(dst, bytes.NewReader(data))
+	a.NoError(err)
+	a.Equal(int64(len(data)), n)
+	a.Equal(data, dst.Bytes())
+}
+
+func TestGetBuffer(t *testing.T) {
+	a := assert.New(t)
+
+	buf := GetBuffer(1000)
+	a.Equal(0, buf.Len())
+	a.GreaterOrEqual(buf.Cap(), 1000)
+
+	buf.WriteString("hello")
+	PutBuffer(buf)
+
+	// Pooled buffers are reset and always large enough.
+	for _, size := range []int64{1, 1000, 1024, 1025, 5 * 1024 * 1024} {
+		buf := GetBuffer(size)
+		a.Equal(0, buf.Len())
+		a.GreaterOrEqual(int64(buf.Cap()), size)
+		PutBuffer(buf)
+	}
+
+	// Sizes outside of the pooled range result in unpooled buffers.
+	a.Equal(0, GetBuffer(0).Cap())
+	a.Equal(0, GetBuffer(MaxBufferSize+1).Cap())
+}
+
+// BenchmarkCopy and BenchmarkStdlibCopy compare the allocations when staging
+// a request body in a temporary file.
+func BenchmarkCopy(b *testing.B) {
+	benchmarkCopyToFile(b, Copy)
+}
+
+func BenchmarkStdlibCopy(b *testing.B) {
+	benchmarkCopyToFile(b, io.Copy)
+}
+
+func benchmarkCopyToFile(b *testing.B, copy func(io.Writer, io.Reader) (int64, error)) {
+	data := bytes.Repeat([]byte("x"), 1024*1024)
+	file, err := os.Create(filepath.Join(b.TempDir(), "part"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer file.Close()
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			b.Fatal(err)
+		}
+		// The LimitReader mimics how stores read from the request body.
+		if _, err := copy(file, io.LimitReader(requestBody{bytes.NewReader(data)}, int64(len(data)))); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGetBuffer(b *testing.B) {
+	benchmarkBuffer(b, func(size int64) *bytes.Buffer { return GetBuffer(size) }, PutBuffer)
+}
+
+func BenchmarkNewBuffer(b *testing.B) {
+	benchmarkBuffer(b, func(size int64) *bytes.Buffer { return bytes.NewBuffer(make([]byte, 0, size)) }, func(*bytes.Buffer) {})
+}
+
+func benchmarkBuffer(b *testing.B, get func(int64) *bytes.Buffer, put func(*bytes.Buffer)) {
+	const size = 5 * 1024 * 1024
+
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			buf := get(size)
+			buf.WriteByte(1)
+			put(buf)
+		}
+	})
+}
+
+// requestBody hides the io.WriterTo implementation of bytes.Reader, since
+// request bodies do not implement it either.
+type requestBody struct {
+	io.Reader
+}
@@ -0,0 +1,138 @@
+// Package jsonschema generates JSON Schemas from Go types, following the rules
+// of encoding/json for field names and omitted fields. It supports the subset
+// of types, which is used in tusd's public payloads.
+package jsonschema
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Draft is the JSON Schema version of the generated schemas.
+const Draft = "https://json-schema.org/draft/2020-12/schema"
+
+// Schema is a JSON Schema. Type is either a string or, if the value may also
+// be null, a slice of strings.
+type Schema struct {
+	Schema               string             `json:"$schema,omitempty"`
+	ID                   string             `json:"$id,omitempty"`
+	Title                string             `json:"title,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Type                 interface{}        `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Const                interface{}        `json:"const,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+// Generate returns the schema for values of the type of v, as they are encoded
+// by encoding/json. Objects allow additional properties, so that consumers
+// validating against the schema do not break if fields are added.
+func Generate(v interface{}) *Schema {
+	schema := generate(reflect.TypeOf(v))
+	schema.Schema = Draft
+	return schema
+}
+
+// Marshal encodes the schema as indented JSON, ending with a newline.
+func (schema *Schema) Marshal() ([]byte, error) {
+	data, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func generate(t reflect.Type) *Schema {
+	if t == timeType {
+		return &Schema{Type: "string", Format: "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		schema := generate(t.Elem())
+		schema.Type = nullable(schema.Type)
+		return schema
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		// Nil slices are encoded as null.
+		return &Schema{Type: nullable("array"), Items: generate(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: nullable("object"), AdditionalProperties: generate(t.Elem())}
+	case reflect.Struct:
+		return generateStruct(t)
+	default:
+		// Interfaces and other types can hold any value.
+		return &Schema{}
+	}
+}
+
+func generateStruct(t reflect.Type) *Schema {
+	schema := &Schema{
+		Type:       "object",
+		Properties: make(map[string]*Schema),
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" && options == "" {
+			continue
+		}
+
+		// Fields of embedded structs without a name are promoted, even if the
+		// embedded type is unexported.
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			embedded := generateStruct(field.Type)
+			for key, property := range embedded.Properties {
+				schema.Properties[key] = property
+			}
+			schema.Required = append(schema.Required, embedded.Required...)
+			continue
+		}
+
+		if !field.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		schema.Properties[name] = generate(field.Type)
+		if !strings.Contains(","+options+",", ",omitempty,") {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+
+	sort.Strings(schema.Required)
+	return schema
+}
+
+func nullable(typ interface{}) interface{} {
+	switch typ := typ.(type) {
+	case string:
+		return []string{typ, "null"}
+	case []string:
+		return typ
+	default:
+		// A schema without type accepts null already.
+		return typ
+	}
+}
@@ -0,0 +1,43 @@
+package jsonschema
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type embedded struct {
+	Embedded string
+}
+
+type example struct {
+	embedded
+	Name     string            `json:"name"`
+	Count    int               `json:"count,omitempty"`
+	Tags     []string          `json:"tags"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	Deadline *time.Time        `json:"deadline,omitempty"`
+	Ignored  string            `json:"-"`
+	Untagged bool
+	private  string
+}
+
+func TestGenerate(t *testing.T) {
+	a := assert.New(t)
+	schema := Generate(example{})
+
+	a.Equal(Draft, schema.Schema)
+	a.Equal("object", schema.Type)
+	a.Equal([]string{"Embedded", "Untagged", "name", "tags"}, schema.Required)
+
+	a.Equal(&Schema{Type: "string"}, schema.Properties["name"])
+	a.Equal(&Schema{Type: "integer"}, schema.Properties["count"])
+	a.Equal(&Schema{Type: "boolean"}, schema.Properties["Untagged"])
+	a.Equal(&Schema{Type: "string"}, schema.Properties["Embedded"])
+	a.Equal(&Schema{Type: []string{"array", "null"}, Items: &Schema{Type: "string"}}, schema.Properties["tags"])
+	a.Equal(&Schema{Type: []string{"object", "null"}, AdditionalProperties: &Schema{Type: "string"}}, schema.Properties["labels"])
+	a.Equal(&Schema{Type: []string{"string", "null"}, Format: "date-time"}, schema.Properties["deadline"])
+	a.NotContains(schema.Properties, "Ignored")
+	a.NotContains(schema.Properties, "private")
+}
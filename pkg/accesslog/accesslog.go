@@ -0,0 +1,154 @@
+// Package accesslog writes a line for every request handled by tusd, either
+// as JSON or in the combined log format known from Apache and nginx, so that
+// the traffic can be analyzed using common tools.
+//
+// A Logger implements handler.AccessLogger and can be used in the handler's
+// configuration:
+//
+//	logger, err := accesslog.NewLogger(os.Stdout, accesslog.FormatJSON)
+//	if err != nil {
+//		return err
+//	}
+//	config.AccessLogger = logger
+package accesslog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/tus/tusd/v2/pkg/handler"
+	"golang.org/x/exp/slog"
+)
+
+// The formats supported by NewLogger.
+const (
+	// FormatJSON writes every record as a JSON object on its own line.
+	FormatJSON = "json"
+	// FormatCombined writes every record in the combined log format. Fields
+	// which are not part of the format, such as the upload ID and durations,
+	// are omitted.
+	FormatCombined = "combined"
+)
+
+// combinedTimeFormat is the format of the timestamp in the combined log format.
+const combinedTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+// entry is the JSON representation of a record.
+type entry struct {
+	Time            time.Time `json:"time"`
+	Method          string    `json:"method"`
+	URI             string    `json:"uri"`
+	Proto           string    `json:"proto"`
+	UploadID        string    `json:"upload_id,omitempty"`
+	Status          int       `json:"status"`
+	BytesReceived   int64     `json:"bytes_received"`
+	BytesSent       int64     `json:"bytes_sent"`
+	DurationMs      float64   `json:"duration_ms"`
+	StoreDurationMs float64   `json:"store_duration_ms"`
+	RemoteAddr      string    `json:"remote_addr"`
+	ClientNetwork   string    `json:"client_network,omitempty"`
+	UserAgent       string    `json:"user_agent,omitempty"`
+	Referer         string    `json:"referer,omitempty"`
+	RequestID       string    `json:"request_id,omitempty"`
+}
+
+// Logger writes access log records to an io.Writer. It is safe for concurrent
+// use.
+type Logger struct {
+	format string
+
+	mutex sync.Mutex
+	w     io.Writer
+}
+
+// NewLogger creates a Logger writing records in the given format to w.
+func NewLogger(w io.Writer, format string) (*Logger, error) {
+	if format != FormatJSON && format != FormatCombined {
+		return nil, fmt.Errorf("accesslog: unknown format %q", format)
+	}
+
+	return &Logger{
+		format: format,
+		w:      w,
+	}, nil
+}
+
+// LogAccess implements handler.AccessLogger. Since the request has already
+// been finished, errors are only logged.
+func (logger *Logger) LogAccess(record handler.AccessRecord) {
+	var line []byte
+	if logger.format == FormatJSON {
+		var err error
+		line, err = json.Marshal(entry{
+			Time:            record.Time,
+			Method:          record.Method,
+			URI:             record.URI,
+			Proto:           record.Proto,
+			UploadID:        record.UploadID,
+			Status:          record.Status,
+			BytesReceived:   record.BytesReceived,
+			BytesSent:       record.BytesSent,
+			DurationMs:      milliseconds(record.Duration),
+			StoreDurationMs: milliseconds(record.StoreDuration),
+			RemoteAddr:      record.RemoteAddr,
+			ClientNetwork:   record.ClientNetwork,
+			UserAgent:       record.UserAgent,
+			Referer:         record.Referer,
+			RequestID:       record.RequestID,
+		})
+		if err != nil {
+			slog.Error("AccessLogError", "error", err)
+			return
+		}
+	} else {
+		line = []byte(formatCombined(record))
+	}
+
+	logger.mutex.Lock()
+	defer logger.mutex.Unlock()
+
+	if _, err := logger.w.Write(append(line, '\n')); err != nil {
+		slog.Error("AccessLogError", "error", err)
+	}
+}
+
+// formatCombined formats the record in the combined log format:
+//
+//	host - - [time] "method uri proto" status bytes "referer" "user-agent"
+func formatCombined(record handler.AccessRecord) string {
+	host, _, err := net.SplitHostPort(record.RemoteAddr)
+	if err != nil {
+		host = record.RemoteAddr
+	}
+
+	bytes := "-"
+	if record.BytesSent > 0 {
+		bytes = strconv.FormatInt(record.BytesSent, 10)
+	}
+
+	return fmt.Sprintf("%s - - [%s] %s %d %s %s %s",
+		orDash(host),
+		record.Time.Format(combinedTimeFormat),
+		strconv.Quote(record.Method+" "+record.URI+" "+record.Proto),
+		record.Status,
+		bytes,
+		strconv.Quote(orDash(record.Referer)),
+		strconv.Quote(orDash(record.UserAgent)),
+	)
+}
+
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,60 @@
+package accesslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tus/tusd/v2/pkg/handler"
+)
+
+var _ handler.AccessLogger = &Logger{}
+
+var record = handler.AccessRecord{
+	Time:          time.Date(2023, 10, 5, 13, 55, 36, 0, time.UTC),
+	Method:        "PATCH",
+	URI:           "/files/foo",
+	Proto:         "HTTP/1.1",
+	UploadID:      "foo",
+	Status:        204,
+	BytesReceived: 1024,
+	Duration:      1500 * time.Millisecond,
+	StoreDuration: 20 * time.Millisecond,
+	RemoteAddr:    "192.0.2.1:51234",
+	UserAgent:     "tus-js-client",
+}
+
+func TestCombined(t *testing.T) {
+	a := assert.New(t)
+
+	var buf bytes.Buffer
+	logger, err := NewLogger(&buf, FormatCombined)
+	a.NoError(err)
+
+	logger.LogAccess(record)
+	a.Equal(`192.0.2.1 - - [05/Oct/2023:13:55:36 +0000] "PATCH /files/foo HTTP/1.1" 204 - "-" "tus-js-client"`+"\n", buf.String())
+}
+
+func TestJSON(t *testing.T) {
+	a := assert.New(t)
+
+	var buf bytes.Buffer
+	logger, err := NewLogger(&buf, FormatJSON)
+	a.NoError(err)
+
+	logger.LogAccess(record)
+
+	var e map[string]any
+	a.NoError(json.Unmarshal(buf.Bytes(), &e))
+	a.Equal("foo", e["upload_id"])
+	a.Equal(float64(1024), e["bytes_received"])
+	a.Equal(float64(1500), e["duration_ms"])
+	a.Equal(float64(20), e["store_duration_ms"])
+}
+
+func TestUnknownFormat(t *testing.T) {
+	_, err := NewLogger(&bytes.Buffer{}, "common")
+	assert.EqualError(t, err, `accesslog: unknown format "common"`)
+}
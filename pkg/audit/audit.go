@@ -0,0 +1,199 @@
+// Package audit provides an append-only, tamper-evident log of the operations
+// which modify uploads.
+//
+// Each record is written as a single line of JSON to a Sink. Records are
+// chained together by including the hash of the previous record in the hash of
+// the next record, similar to a blockchain. Removing, reordering or modifying a
+// record therefore breaks the chain, which can be detected using Verify. The
+// hash does not prevent an attacker with write access from rewriting the whole
+// log, so sinks should ship records to a separate system if this is a concern.
+//
+// A Logger implements handler.AuditLogger and can be used in the handler's
+// configuration:
+//
+//	sink, err := audit.Open("/var/log/tusd/audit.log")
+//	if err != nil {
+//		return err
+//	}
+//	logger, err := audit.NewLogger(sink)
+//	if err != nil {
+//		return err
+//	}
+//	config.AuditLogger = logger
+package audit
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/tus/tusd/v2/pkg/handler"
+	"golang.org/x/exp/slog"
+)
+
+// Record is a single entry in the audit log.
+type Record struct {
+	// Seq is the position of the record in the log, starting at 1.
+	Seq        uint64            `json:"seq"`
+	Time       time.Time         `json:"time"`
+	Operation  string            `json:"operation"`
+	UploadID   string            `json:"upload_id,omitempty"`
+	Status     int               `json:"status,omitempty"`
+	Bytes      int64             `json:"bytes"`
+	RemoteAddr string            `json:"remote_addr,omitempty"`
+	Actor      map[string]string `json:"actor,omitempty"`
+	// PrevHash is the hash of the previous record, or empty for the first
+	// record of the log.
+	PrevHash string `json:"prev_hash"`
+	// Hash is the hex-encoded SHA-256 hash of PrevHash and the record's JSON
+	// encoding with an empty Hash field.
+	Hash string `json:"hash"`
+}
+
+// computeHash calculates the hash of the record, which covers the hash of the
+// previous record.
+func (record Record) computeHash() (string, error) {
+	record.Hash = ""
+	data, err := json.Marshal(record)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.New()
+	io.WriteString(sum, record.PrevHash)
+	sum.Write(data)
+	return hex.EncodeToString(sum.Sum(nil)), nil
+}
+
+// Sink stores the encoded audit records, one line at a time. Write must only
+// return once the record has been persisted.
+type Sink interface {
+	Write(line []byte) error
+	Close() error
+}
+
+// resumableSink is implemented by sinks which already contain records, so that
+// the chain can be continued after a restart.
+type resumableSink interface {
+	LastRecord() (Record, bool)
+}
+
+// Logger appends records to a Sink and maintains the hash chain. It is safe for
+// concurrent use.
+type Logger struct {
+	sink Sink
+
+	mutex    sync.Mutex
+	seq      uint64
+	lastHash string
+}
+
+// NewLogger creates a Logger writing to the sink. If the sink already contains
+// records, the chain is continued from the last one.
+func NewLogger(sink Sink) (*Logger, error) {
+	logger := &Logger{
+		sink: sink,
+	}
+
+	if resumable, ok := sink.(resumableSink); ok {
+		if last, ok := resumable.LastRecord(); ok {
+			logger.seq = last.Seq
+			logger.lastHash = last.Hash
+		}
+	}
+
+	return logger, nil
+}
+
+// Log appends the record to the log. The fields Seq, PrevHash and Hash are
+// filled in by the Logger.
+func (logger *Logger) Log(record Record) error {
+	logger.mutex.Lock()
+	defer logger.mutex.Unlock()
+
+	record.Seq = logger.seq + 1
+	record.PrevHash = logger.lastHash
+
+	hash, err := record.computeHash()
+	if err != nil {
+		return err
+	}
+	record.Hash = hash
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	if err := logger.sink.Write(append(line, '\n')); err != nil {
+		return err
+	}
+
+	logger.seq = record.Seq
+	logger.lastHash = record.Hash
+	return nil
+}
+
+// LogAudit implements handler.AuditLogger. Since requests cannot be failed
+// after their response has been sent, errors are only logged.
+func (logger *Logger) LogAudit(event handler.AuditRecord) {
+	err := logger.Log(Record{
+		Time:       event.Time,
+		Operation:  event.Operation,
+		UploadID:   event.UploadID,
+		Status:     event.Status,
+		Bytes:      event.Bytes,
+		RemoteAddr: event.RemoteAddr,
+		Actor:      event.Actor,
+	})
+	if err != nil {
+		slog.Error("AuditLogError", "operation", event.Operation, "id", event.UploadID, "error", err)
+	}
+}
+
+// Close closes the underlying sink.
+func (logger *Logger) Close() error {
+	logger.mutex.Lock()
+	defer logger.mutex.Unlock()
+
+	return logger.sink.Close()
+}
+
+// Verify reads an audit log and checks that its hash chain is intact. An error
+// describing the first broken record is returned otherwise.
+func Verify(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+
+	var seq uint64
+	var lastHash string
+	for scanner.Scan() {
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return fmt.Errorf("audit: record after %d cannot be parsed: %w", seq, err)
+		}
+
+		// The first record can continue a log which has been rotated.
+		if seq != 0 && (record.Seq != seq+1 || record.PrevHash != lastHash) {
+			return fmt.Errorf("audit: record %d does not follow record %d", record.Seq, seq)
+		}
+
+		hash, err := record.computeHash()
+		if err != nil {
+			return err
+		}
+		if hash != record.Hash {
+			return fmt.Errorf("audit: record %d has been modified", record.Seq)
+		}
+
+		seq = record.Seq
+		lastHash = record.Hash
+	}
+
+	return scanner.Err()
+}
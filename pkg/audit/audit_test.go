@@ -0,0 +1,69 @@
+package audit
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tus/tusd/v2/pkg/handler"
+)
+
+var _ handler.AuditLogger = &Logger{}
+
+func TestHashChain(t *testing.T) {
+	a := assert.New(t)
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	sink, err := OpenFile(path)
+	a.NoError(err)
+	logger, err := NewLogger(sink)
+	a.NoError(err)
+
+	logger.LogAudit(handler.AuditRecord{
+		Time:      time.Now(),
+		Operation: "create",
+		UploadID:  "foo",
+		Status:    201,
+		Actor:     map[string]string{"X-User-Id": "alice"},
+	})
+	logger.LogAudit(handler.AuditRecord{
+		Time:      time.Now(),
+		Operation: "write",
+		UploadID:  "foo",
+		Status:    204,
+		Bytes:     100,
+	})
+	a.NoError(logger.Close())
+
+	// Reopening the file continues the chain.
+	sink, err = OpenFile(path)
+	a.NoError(err)
+	logger, err = NewLogger(sink)
+	a.NoError(err)
+	a.NoError(logger.Log(Record{
+		Time:      time.Now(),
+		Operation: "terminate",
+		UploadID:  "foo",
+		Status:    204,
+	}))
+	a.NoError(logger.Close())
+
+	content, err := os.ReadFile(path)
+	a.NoError(err)
+	a.Equal(3, bytes.Count(content, []byte("\n")))
+	a.NoError(Verify(bytes.NewReader(content)))
+
+	// Modifying a record is detected ...
+	modified := bytes.Replace(content, []byte(`"bytes":100`), []byte(`"bytes":10`), 1)
+	err = Verify(bytes.NewReader(modified))
+	a.EqualError(err, "audit: record 2 has been modified")
+
+	// ... as well as removing one.
+	lines := strings.SplitAfter(string(content), "\n")
+	err = Verify(strings.NewReader(lines[0] + lines[2]))
+	a.EqualError(err, "audit: record 3 does not follow record 1")
+}
@@ -0,0 +1,72 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+)
+
+// FileSink appends records to a local file. Every record is synced to disk
+// before Write returns.
+type FileSink struct {
+	file *os.File
+	last *Record
+}
+
+// OpenFile opens the audit log at the given path for appending, creating it if
+// necessary. If the file already contains records, the last one is remembered
+// so that a Logger can continue the chain.
+func OpenFile(path string) (*FileSink, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	sink := &FileSink{
+		file: file,
+	}
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1024*1024)
+	var line []byte
+	for scanner.Scan() {
+		line = append(line[:0], scanner.Bytes()...)
+	}
+	if err := scanner.Err(); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	if len(line) > 0 {
+		var record Record
+		if err := json.Unmarshal(line, &record); err != nil {
+			file.Close()
+			return nil, err
+		}
+		sink.last = &record
+	}
+
+	return sink, nil
+}
+
+func (sink *FileSink) Write(line []byte) error {
+	if _, err := sink.file.Write(line); err != nil {
+		return err
+	}
+
+	return sink.file.Sync()
+}
+
+func (sink *FileSink) Close() error {
+	return sink.file.Close()
+}
+
+// LastRecord returns the last record which was contained in the file when it
+// was opened.
+func (sink *FileSink) LastRecord() (Record, bool) {
+	if sink.last == nil {
+		return Record{}, false
+	}
+
+	return *sink.last, true
+}
@@ -0,0 +1,46 @@
+package audit
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// HTTPSink sends every record in a separate POST request to an endpoint, for
+// example the ingestion API of a log management system. Any response status
+// other than 2xx is treated as a failure.
+type HTTPSink struct {
+	Endpoint string
+	Client   *http.Client
+}
+
+// NewHTTPSink creates a sink for the given endpoint with a client using a
+// timeout of 10s.
+func NewHTTPSink(endpoint string) *HTTPSink {
+	return &HTTPSink{
+		Endpoint: endpoint,
+		Client: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+	}
+}
+
+func (sink *HTTPSink) Write(line []byte) error {
+	res, err := sink.Client.Post(sink.Endpoint, "application/json", bytes.NewReader(line))
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("audit: endpoint responded with status %d", res.StatusCode)
+	}
+
+	return nil
+}
+
+func (sink *HTTPSink) Close() error {
+	sink.Client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,28 @@
+package audit
+
+import (
+	"strings"
+)
+
+// Open creates a sink from its description:
+//
+//   - "syslog" sends records to the local syslog daemon, while
+//     syslog://host:port and syslog+tcp://host:port send them to a remote
+//     daemon using UDP or TCP,
+//   - http:// and https:// URLs receive each record in a POST request,
+//   - anything else is the path of a local file, optionally prefixed with
+//     file://.
+func Open(target string) (Sink, error) {
+	switch {
+	case target == "syslog":
+		return OpenSyslog("", "")
+	case strings.HasPrefix(target, "syslog://"):
+		return OpenSyslog("udp", strings.TrimPrefix(target, "syslog://"))
+	case strings.HasPrefix(target, "syslog+tcp://"):
+		return OpenSyslog("tcp", strings.TrimPrefix(target, "syslog+tcp://"))
+	case strings.HasPrefix(target, "http://"), strings.HasPrefix(target, "https://"):
+		return NewHTTPSink(target), nil
+	default:
+		return OpenFile(strings.TrimPrefix(target, "file://"))
+	}
+}
@@ -0,0 +1,32 @@
+//go:build !windows && !plan9
+
+package audit
+
+import (
+	"log/syslog"
+)
+
+// SyslogSink sends records to a syslog daemon using the LOG_AUTHPRIV facility.
+type SyslogSink struct {
+	writer *syslog.Writer
+}
+
+// OpenSyslog connects to the syslog daemon at the given address. If network
+// and address are empty, the local daemon is used.
+func OpenSyslog(network, address string) (*SyslogSink, error) {
+	writer, err := syslog.Dial(network, address, syslog.LOG_INFO|syslog.LOG_AUTHPRIV, "tusd")
+	if err != nil {
+		return nil, err
+	}
+
+	return &SyslogSink{writer}, nil
+}
+
+func (sink *SyslogSink) Write(line []byte) error {
+	_, err := sink.writer.Write(line)
+	return err
+}
+
+func (sink *SyslogSink) Close() error {
+	return sink.writer.Close()
+}
@@ -0,0 +1,23 @@
+//go:build windows || plan9
+
+package audit
+
+import (
+	"errors"
+)
+
+// SyslogSink is not supported on this platform.
+type SyslogSink struct{}
+
+// OpenSyslog always fails, since syslog is not available on this platform.
+func OpenSyslog(network, address string) (*SyslogSink, error) {
+	return nil, errors.New("audit: syslog is not supported on this platform")
+}
+
+func (sink *SyslogSink) Write(line []byte) error {
+	return errors.New("audit: syslog is not supported on this platform")
+}
+
+func (sink *SyslogSink) Close() error {
+	return nil
+}
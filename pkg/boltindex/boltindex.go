@@ -0,0 +1,340 @@
+// Package boltindex provides an UploadIndex which keeps its entries in an
+// embedded BoltDB file. It is meant for single tusd instances, especially
+// those using the file store, which otherwise have to read the info of every
+// upload to list, expire or discover uploads:
+//
+//	index, err := boltindex.Open("/var/lib/tusd/index.db")
+//	if err != nil {
+//		return err
+//	}
+//	defer index.Close()
+//	config.UploadIndex = index
+//	composer.UseLister(index)
+//
+// BoltDB locks the file, so that it can only be opened by a single process at
+// a time. For sharing an index between multiple instances, use the sqlindex
+// package instead.
+package boltindex
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/tus/tusd/v2/pkg/handler"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// defaultQueryLimit is used for queries without a limit. It matches the
+// default of the in-memory index.
+const defaultQueryLimit = 100
+
+// listPageSize is the number of uploads returned per ListUploads call.
+const listPageSize = 1000
+
+var (
+	// uploadsBucket maps the IDs of the uploads to their JSON encoded entry.
+	uploadsBucket = []byte("uploads")
+	// createdBucket contains a key for every upload, which orders the uploads
+	// by their creation time, most recent first, and their ID.
+	createdBucket = []byte("created")
+	// unfinishedBucket contains the IDs of the unfinished uploads.
+	unfinishedBucket = []byte("unfinished")
+	// expiresBucket contains a key for every unfinished upload with an
+	// expiration, which orders the uploads by their expiration time.
+	expiresBucket = []byte("expires")
+
+	buckets = [][]byte{uploadsBucket, createdBucket, unfinishedBucket, expiresBucket}
+)
+
+// Index is a handler.ExpiringUploadIndex, which keeps its entries in a BoltDB
+// file. It also implements handler.ListableDataStore, so that it can list the
+// unfinished uploads instead of the data store. Timestamps are stored with
+// nanosecond precision, expiration times with second precision.
+type Index struct {
+	db *bolt.DB
+}
+
+// Open opens the index stored in the file at path, which is created if it does
+// not exist yet. If another process has opened the file, Open fails after
+// waiting for one second.
+func Open(path string) (*Index, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range buckets {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Index{db: db}, nil
+}
+
+// Close closes the file. The index must not be used afterwards.
+func (index *Index) Close() error {
+	return index.db.Close()
+}
+
+func (index *Index) AddUpload(ctx context.Context, entry handler.IndexEntry) error {
+	return index.db.Update(func(tx *bolt.Tx) error {
+		// Remove the keys of a previous entry with the same ID, which would
+		// otherwise point to the new entry.
+		if previous, err := getEntry(tx, entry.ID); err == nil {
+			if err := deleteKeys(tx, previous); err != nil {
+				return err
+			}
+		} else if !errors.Is(err, handler.ErrNotFound) {
+			return err
+		}
+
+		if err := tx.Bucket(createdBucket).Put(createdKey(entry), nil); err != nil {
+			return err
+		}
+
+		return putEntry(tx, entry)
+	})
+}
+
+func (index *Index) UpdateUpload(ctx context.Context, id string, offset int64, state handler.UploadState, at time.Time) error {
+	return index.update(id, func(entry *handler.IndexEntry) {
+		entry.Offset = offset
+		entry.State = state
+		entry.UpdatedAt = at
+	})
+}
+
+func (index *Index) SetUploadTags(ctx context.Context, id string, tags []string) error {
+	return index.update(id, func(entry *handler.IndexEntry) {
+		entry.Tags = tags
+	})
+}
+
+func (index *Index) SetUploadExpiration(ctx context.Context, id string, expiresAt time.Time) error {
+	return index.update(id, func(entry *handler.IndexEntry) {
+		entry.ExpiresAt = expiresAt
+	})
+}
+
+func (index *Index) ExpiredUploads(ctx context.Context, before time.Time) ([]string, error) {
+	end := timeKey(uint64(before.Unix()))
+
+	var ids []string
+	err := index.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(expiresBucket).Cursor()
+		for k, _ := c.First(); k != nil && bytes.Compare(k[:8], end) < 0; k, _ = c.Next() {
+			ids = append(ids, string(k[8:]))
+		}
+		return nil
+	})
+
+	return ids, err
+}
+
+// ListUploads returns the IDs of unfinished uploads, ordered by their ID. The
+// cursor is the last ID that has been returned. Uploads are listed as long as
+// they are recorded as unfinished, even if they have been removed from the
+// data store without the handler.
+func (index *Index) ListUploads(ctx context.Context, cursor string) ([]string, string, error) {
+	ids := make([]string, 0)
+	nextCursor := ""
+	err := index.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(unfinishedBucket).Cursor()
+
+		k, _ := c.Seek([]byte(cursor))
+		if k != nil && string(k) == cursor {
+			k, _ = c.Next()
+		}
+
+		for ; k != nil; k, _ = c.Next() {
+			if len(ids) == listPageSize {
+				nextCursor = ids[len(ids)-1]
+				break
+			}
+			ids = append(ids, string(k))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	return ids, nextCursor, nil
+}
+
+// SearchUploads returns the matching uploads by walking through all uploads in
+// the order of their creation. The cursor is the encoded position of the last
+// upload, which has been returned.
+func (index *Index) SearchUploads(ctx context.Context, query handler.IndexQuery) ([]handler.IndexEntry, string, error) {
+	var start []byte
+	if query.Cursor != "" {
+		var err error
+		start, err = base64.RawURLEncoding.DecodeString(query.Cursor)
+		if err != nil || len(start) < 8 {
+			return nil, "", handler.ErrInvalidIndexCursor
+		}
+	}
+
+	limit := query.Limit
+	if limit <= 0 {
+		limit = defaultQueryLimit
+	}
+
+	entries := make([]handler.IndexEntry, 0)
+	nextCursor := ""
+	err := index.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(createdBucket).Cursor()
+
+		var k []byte
+		if start == nil {
+			k, _ = c.First()
+		} else {
+			k, _ = c.Seek(start)
+			if k != nil && bytes.Equal(k, start) {
+				k, _ = c.Next()
+			}
+		}
+
+		var last []byte
+		for ; k != nil; k, _ = c.Next() {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			entry, err := getEntry(tx, string(k[8:]))
+			if err != nil {
+				return err
+			}
+			if !query.Matches(entry) {
+				continue
+			}
+
+			// Another match exists, so the client has to fetch the next page.
+			if len(entries) == limit {
+				nextCursor = base64.RawURLEncoding.EncodeToString(last)
+				break
+			}
+
+			entries = append(entries, entry)
+			last = append(last[:0], k...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	return entries, nextCursor, nil
+}
+
+// update applies fn to the entry of the upload with the given ID and updates
+// the keys referring to it.
+func (index *Index) update(id string, fn func(entry *handler.IndexEntry)) error {
+	return index.db.Update(func(tx *bolt.Tx) error {
+		entry, err := getEntry(tx, id)
+		if err != nil {
+			return err
+		}
+
+		// The creation time does not change, so the key in createdBucket can
+		// be kept.
+		if err := deleteStateKeys(tx, entry); err != nil {
+			return err
+		}
+
+		fn(&entry)
+		return putEntry(tx, entry)
+	})
+}
+
+func getEntry(tx *bolt.Tx, id string) (handler.IndexEntry, error) {
+	var entry handler.IndexEntry
+
+	data := tx.Bucket(uploadsBucket).Get([]byte(id))
+	if data == nil {
+		return entry, handler.ErrNotFound
+	}
+
+	err := json.Unmarshal(data, &entry)
+	return entry, err
+}
+
+// putEntry stores the entry and adds it to the buckets depending on its state.
+func putEntry(tx *bolt.Tx, entry handler.IndexEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Bucket(uploadsBucket).Put([]byte(entry.ID), data); err != nil {
+		return err
+	}
+
+	if entry.State != handler.UploadStateInProgress {
+		return nil
+	}
+
+	if err := tx.Bucket(unfinishedBucket).Put([]byte(entry.ID), nil); err != nil {
+		return err
+	}
+
+	if !entry.ExpiresAt.IsZero() {
+		return tx.Bucket(expiresBucket).Put(expiresKey(entry), nil)
+	}
+
+	return nil
+}
+
+// deleteKeys removes all keys referring to the entry.
+func deleteKeys(tx *bolt.Tx, entry handler.IndexEntry) error {
+	if err := tx.Bucket(createdBucket).Delete(createdKey(entry)); err != nil {
+		return err
+	}
+
+	return deleteStateKeys(tx, entry)
+}
+
+// deleteStateKeys removes the keys, which depend on the entry's state.
+func deleteStateKeys(tx *bolt.Tx, entry handler.IndexEntry) error {
+	if err := tx.Bucket(unfinishedBucket).Delete([]byte(entry.ID)); err != nil {
+		return err
+	}
+
+	if entry.ExpiresAt.IsZero() {
+		return nil
+	}
+
+	return tx.Bucket(expiresBucket).Delete(expiresKey(entry))
+}
+
+// createdKey returns the key of the entry in createdBucket. The creation time
+// is inverted, so that the most recent uploads come first.
+func createdKey(entry handler.IndexEntry) []byte {
+	return append(timeKey(^uint64(entry.CreatedAt.UnixNano())), entry.ID...)
+}
+
+// expiresKey returns the key of the entry in expiresBucket.
+func expiresKey(entry handler.IndexEntry) []byte {
+	return append(timeKey(uint64(entry.ExpiresAt.Unix())), entry.ID...)
+}
+
+// timeKey encodes the timestamp, so that the keys are sorted by it.
+func timeKey(value uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, value)
+	return key
+}
@@ -0,0 +1,116 @@
+package boltindex
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tus/tusd/v2/pkg/handler"
+)
+
+func openTestIndex(t *testing.T) *Index {
+	index, err := Open(filepath.Join(t.TempDir(), "index.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { index.Close() })
+	return index
+}
+
+func TestIndex(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	index := openTestIndex(t)
+
+	created := time.Date(2023, 10, 5, 13, 0, 0, 0, time.UTC)
+	for i, id := range []string{"a", "b", "c"} {
+		a.NoError(index.AddUpload(ctx, handler.IndexEntry{
+			ID:        id,
+			Size:      100,
+			MetaData:  handler.MetaData{"filename": id + ".txt"},
+			Tags:      []string{"user:alice"},
+			State:     handler.UploadStateInProgress,
+			CreatedAt: created.Add(time.Duration(i) * time.Minute),
+			UpdatedAt: created.Add(time.Duration(i) * time.Minute),
+			ExpiresAt: created.Add(time.Duration(i+1) * time.Hour),
+		}))
+	}
+
+	a.NoError(index.UpdateUpload(ctx, "b", 100, handler.UploadStateFinished, created.Add(time.Hour)))
+	a.NoError(index.SetUploadTags(ctx, "c", []string{"user:bob"}))
+	a.ErrorIs(index.UpdateUpload(ctx, "d", 0, handler.UploadStateFinished, created), handler.ErrNotFound)
+
+	// The most recent uploads are returned first.
+	entries, cursor, err := index.SearchUploads(ctx, handler.IndexQuery{Limit: 2})
+	a.NoError(err)
+	a.Len(entries, 2)
+	a.Equal("c", entries[0].ID)
+	a.Equal([]string{"user:bob"}, entries[0].Tags)
+	a.Equal("b", entries[1].ID)
+	a.Equal(int64(100), entries[1].Offset)
+	a.Equal(handler.UploadStateFinished, entries[1].State)
+	a.NotEmpty(cursor)
+
+	entries, cursor, err = index.SearchUploads(ctx, handler.IndexQuery{Limit: 2, Cursor: cursor})
+	a.NoError(err)
+	a.Len(entries, 1)
+	a.Equal("a", entries[0].ID)
+	a.Equal(handler.MetaData{"filename": "a.txt"}, entries[0].MetaData)
+	a.Empty(cursor)
+
+	entries, _, err = index.SearchUploads(ctx, handler.IndexQuery{Tags: []string{"user:alice"}, State: handler.UploadStateInProgress})
+	a.NoError(err)
+	a.Len(entries, 1)
+	a.Equal("a", entries[0].ID)
+
+	_, _, err = index.SearchUploads(ctx, handler.IndexQuery{Cursor: "!"})
+	a.ErrorIs(err, handler.ErrInvalidIndexCursor)
+
+	// Finished uploads are neither listed nor expire.
+	ids, cursor, err := index.ListUploads(ctx, "")
+	a.NoError(err)
+	a.Equal([]string{"a", "c"}, ids)
+	a.Empty(cursor)
+
+	ids, err = index.ExpiredUploads(ctx, created.Add(4*time.Hour))
+	a.NoError(err)
+	a.Equal([]string{"a", "c"}, ids)
+
+	a.NoError(index.SetUploadExpiration(ctx, "a", created.Add(5*time.Hour)))
+	ids, err = index.ExpiredUploads(ctx, created.Add(4*time.Hour))
+	a.NoError(err)
+	a.Equal([]string{"c"}, ids)
+
+	a.NoError(index.UpdateUpload(ctx, "c", 20, handler.UploadStateTerminated, created.Add(4*time.Hour)))
+	ids, err = index.ExpiredUploads(ctx, created.Add(4*time.Hour))
+	a.NoError(err)
+	a.Empty(ids)
+	ids, _, err = index.ListUploads(ctx, "")
+	a.NoError(err)
+	a.Equal([]string{"a"}, ids)
+}
+
+func TestIndexListUploadsPages(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	index := openTestIndex(t)
+
+	for i := 0; i < listPageSize+1; i++ {
+		a.NoError(index.AddUpload(ctx, handler.IndexEntry{
+			ID:    string(rune('a'+i/26/26%26)) + string(rune('a'+i/26%26)) + string(rune('a'+i%26)),
+			State: handler.UploadStateInProgress,
+		}))
+	}
+
+	ids, cursor, err := index.ListUploads(ctx, "")
+	a.NoError(err)
+	a.Len(ids, listPageSize)
+	a.Equal(ids[listPageSize-1], cursor)
+
+	ids, cursor, err = index.ListUploads(ctx, cursor)
+	a.NoError(err)
+	a.Len(ids, 1)
+	a.Empty(cursor)
+}
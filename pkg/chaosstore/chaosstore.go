@@ -0,0 +1,395 @@
+// Package chaosstore provides a wrapper for data stores, which injects faults.
+//
+// ChaosStore delays operations, lets them fail and interrupts writes after a
+// part of the data has been stored. This allows testing how clients retry
+// failed requests and how the handler recovers, for example in a staging
+// environment. It must not be used in production.
+//
+// The wrapped store is passed as composer, so that all of its extensions are
+// preserved:
+//
+//	inner := handler.NewStoreComposer()
+//	filestore.New("./uploads").UseIn(inner)
+//	memorylocker.New().UseIn(inner)
+//
+//	composer := handler.NewStoreComposer()
+//	chaosstore.New(inner, chaosstore.Config{
+//		Latency:          100 * time.Millisecond,
+//		ErrorRate:        0.05,
+//		PartialWriteRate: 0.1,
+//	}).UseIn(composer)
+package chaosstore
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/tus/tusd/v2/pkg/handler"
+)
+
+// ErrInjected is returned by operations, which fail because of an injected
+// fault. Clients should treat it like any other server error and retry.
+var ErrInjected = handler.NewError("ERR_INJECTED_FAULT", "fault injected by chaos store", http.StatusInternalServerError)
+
+// Config controls which faults are injected.
+type Config struct {
+	// Latency is added to every affected operation.
+	Latency time.Duration
+	// LatencyJitter is the maximum random duration, which is added to Latency.
+	LatencyJitter time.Duration
+	// ErrorRate is the probability between 0 and 1, with which an affected
+	// operation fails with ErrInjected without reaching the wrapped store.
+	ErrorRate float64
+	// PartialWriteRate is the probability between 0 and 1, with which a chunk
+	// is cut off after a random number of bytes, as if the client's connection
+	// dropped. The wrapped store receives the data up to this point and the
+	// write fails with ErrInjected.
+	PartialWriteRate float64
+	// PartialWriteMaxBytes is the maximum number of bytes, which are written
+	// before a chunk is cut off. Chunks smaller than the random cut are written
+	// completely. Defaults to 1MiB.
+	PartialWriteMaxBytes int64
+	// Operations restricts the injected faults to the operations with these
+	// names, e.g. "WriteChunk" or "GetInfo". The names are those of the methods
+	// of handler.DataStore, handler.Upload and the extension interfaces. If
+	// empty, all operations are affected.
+	Operations []string
+	// Seed initializes the random number generator, so that the injected
+	// faults can be reproduced. If zero, the current time is used.
+	Seed int64
+}
+
+// ChaosStore wraps a data store and injects faults into its operations. It
+// must be created using New.
+type ChaosStore struct {
+	inner      *handler.StoreComposer
+	config     Config
+	operations map[string]bool
+
+	randLock sync.Mutex
+	rand     *rand.Rand
+}
+
+// New creates a store, which forwards all operations to the store in inner
+// after injecting the faults described by config.
+func New(inner *handler.StoreComposer, config Config) *ChaosStore {
+	if config.PartialWriteMaxBytes <= 0 {
+		config.PartialWriteMaxBytes = 1024 * 1024
+	}
+	if config.Seed == 0 {
+		config.Seed = time.Now().UnixNano()
+	}
+
+	var operations map[string]bool
+	if len(config.Operations) > 0 {
+		operations = make(map[string]bool, len(config.Operations))
+		for _, operation := range config.Operations {
+			operations[operation] = true
+		}
+	}
+
+	return &ChaosStore{
+		inner:      inner,
+		config:     config,
+		operations: operations,
+		rand:       rand.New(rand.NewSource(config.Seed)),
+	}
+}
+
+// UseIn sets this store as the core data store in the passed composer and adds
+// all extensions, which are provided by the wrapped store.
+func (store *ChaosStore) UseIn(composer *handler.StoreComposer) {
+	handler.UseWrapper(composer, store, store.inner)
+}
+
+// inject waits for the configured latency and decides whether the operation
+// fails. It returns nil if the operation should be forwarded.
+func (store *ChaosStore) inject(ctx context.Context, operation string) error {
+	if !store.affects(operation) {
+		return nil
+	}
+
+	delay := store.config.Latency
+	if store.config.LatencyJitter > 0 {
+		delay += time.Duration(store.int63n(int64(store.config.LatencyJitter)))
+	}
+	if delay > 0 {
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	if store.chance(store.config.ErrorRate) {
+		return ErrInjected
+	}
+
+	return nil
+}
+
+func (store *ChaosStore) affects(operation string) bool {
+	return store.operations == nil || store.operations[operation]
+}
+
+func (store *ChaosStore) chance(probability float64) bool {
+	if probability <= 0 {
+		return false
+	}
+
+	store.randLock.Lock()
+	defer store.randLock.Unlock()
+	return store.rand.Float64() < probability
+}
+
+func (store *ChaosStore) int63n(n int64) int64 {
+	store.randLock.Lock()
+	defer store.randLock.Unlock()
+	return store.rand.Int63n(n)
+}
+
+func (store *ChaosStore) NewUpload(ctx context.Context, info handler.FileInfo) (handler.Upload, error) {
+	if err := store.inject(ctx, "NewUpload"); err != nil {
+		return nil, err
+	}
+
+	upload, err := store.inner.Core.NewUpload(ctx, info)
+	if err != nil {
+		return nil, err
+	}
+
+	return &chaosUpload{store: store, upload: upload}, nil
+}
+
+func (store *ChaosStore) GetUpload(ctx context.Context, id string) (handler.Upload, error) {
+	if err := store.inject(ctx, "GetUpload"); err != nil {
+		return nil, err
+	}
+
+	upload, err := store.inner.Core.GetUpload(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &chaosUpload{store: store, upload: upload}, nil
+}
+
+func (store *ChaosStore) ListUploads(ctx context.Context, cursor string) ([]string, string, error) {
+	if err := store.inject(ctx, "ListUploads"); err != nil {
+		return nil, "", err
+	}
+
+	return store.inner.Lister.ListUploads(ctx, cursor)
+}
+
+func (store *ChaosStore) ImportUpload(ctx context.Context, info handler.FileInfo) (handler.Upload, error) {
+	if err := store.inject(ctx, "ImportUpload"); err != nil {
+		return nil, err
+	}
+
+	upload, err := store.inner.Importer.ImportUpload(ctx, info)
+	if err != nil {
+		return nil, err
+	}
+
+	return &chaosUpload{store: store, upload: upload}, nil
+}
+
+func (store *ChaosStore) IngestObject(ctx context.Context, info handler.FileInfo, source handler.IngestSource) (handler.Upload, error) {
+	if err := store.inject(ctx, "IngestObject"); err != nil {
+		return nil, err
+	}
+
+	upload, err := store.inner.Ingester.IngestObject(ctx, info, source)
+	if err != nil {
+		return nil, err
+	}
+
+	return &chaosUpload{store: store, upload: upload}, nil
+}
+
+func (store *ChaosStore) AsTerminatableUpload(upload handler.Upload) handler.TerminatableUpload {
+	return upload.(*chaosUpload)
+}
+
+func (store *ChaosStore) AsConcatableUpload(upload handler.Upload) handler.ConcatableUpload {
+	return upload.(*chaosUpload)
+}
+
+func (store *ChaosStore) AsLengthDeclarableUpload(upload handler.Upload) handler.LengthDeclarableUpload {
+	return upload.(*chaosUpload)
+}
+
+func (store *ChaosStore) AsPresignableUpload(upload handler.Upload) handler.PresignableUpload {
+	return upload.(*chaosUpload)
+}
+
+func (store *ChaosStore) AsPartPresignableUpload(upload handler.Upload) handler.PartPresignableUpload {
+	return upload.(*chaosUpload)
+}
+
+func (store *ChaosStore) AsExpirableUpload(upload handler.Upload) handler.ExpirableUpload {
+	return upload.(*chaosUpload)
+}
+
+func (store *ChaosStore) AsInspectableUpload(upload handler.Upload) handler.InspectableUpload {
+	return upload.(*chaosUpload)
+}
+
+func (store *ChaosStore) AsPartialAppendableUpload(upload handler.Upload) handler.PartialAppendableUpload {
+	return upload.(*chaosUpload)
+}
+
+func (store *ChaosStore) AsChecksumRecordableUpload(upload handler.Upload) handler.ChecksumRecordableUpload {
+	return upload.(*chaosUpload)
+}
+
+// chaosUpload wraps an upload of the inner store. The extensions of the inner
+// store expect their own uploads, so the wrapped upload is passed to them.
+type chaosUpload struct {
+	store  *ChaosStore
+	upload handler.Upload
+}
+
+func (upload *chaosUpload) WriteChunk(ctx context.Context, offset int64, src io.Reader) (int64, error) {
+	store := upload.store
+	if err := store.inject(ctx, "WriteChunk"); err != nil {
+		return 0, err
+	}
+
+	if store.affects("WriteChunk") && store.chance(store.config.PartialWriteRate) {
+		src = &cutReader{
+			src:       src,
+			remaining: store.int63n(store.config.PartialWriteMaxBytes),
+		}
+	}
+
+	return upload.upload.WriteChunk(ctx, offset, src)
+}
+
+func (upload *chaosUpload) GetInfo(ctx context.Context) (handler.FileInfo, error) {
+	if err := upload.store.inject(ctx, "GetInfo"); err != nil {
+		return handler.FileInfo{}, err
+	}
+
+	return upload.upload.GetInfo(ctx)
+}
+
+func (upload *chaosUpload) GetReader(ctx context.Context) (io.ReadCloser, error) {
+	if err := upload.store.inject(ctx, "GetReader"); err != nil {
+		return nil, err
+	}
+
+	return upload.upload.GetReader(ctx)
+}
+
+func (upload *chaosUpload) FinishUpload(ctx context.Context) error {
+	if err := upload.store.inject(ctx, "FinishUpload"); err != nil {
+		return err
+	}
+
+	return upload.upload.FinishUpload(ctx)
+}
+
+func (upload *chaosUpload) Terminate(ctx context.Context) error {
+	if err := upload.store.inject(ctx, "Terminate"); err != nil {
+		return err
+	}
+
+	return upload.store.inner.Terminater.AsTerminatableUpload(upload.upload).Terminate(ctx)
+}
+
+func (upload *chaosUpload) ConcatUploads(ctx context.Context, partialUploads []handler.Upload) error {
+	if err := upload.store.inject(ctx, "ConcatUploads"); err != nil {
+		return err
+	}
+
+	innerUploads := make([]handler.Upload, len(partialUploads))
+	for i, partialUpload := range partialUploads {
+		innerUploads[i] = partialUpload.(*chaosUpload).upload
+	}
+
+	return upload.store.inner.Concater.AsConcatableUpload(upload.upload).ConcatUploads(ctx, innerUploads)
+}
+
+func (upload *chaosUpload) DeclareLength(ctx context.Context, length int64) error {
+	if err := upload.store.inject(ctx, "DeclareLength"); err != nil {
+		return err
+	}
+
+	return upload.store.inner.LengthDeferrer.AsLengthDeclarableUpload(upload.upload).DeclareLength(ctx, length)
+}
+
+func (upload *chaosUpload) PresignDownloadURL(ctx context.Context, options handler.PresignOptions) (string, error) {
+	if err := upload.store.inject(ctx, "PresignDownloadURL"); err != nil {
+		return "", err
+	}
+
+	return upload.store.inner.Presigner.AsPresignableUpload(upload.upload).PresignDownloadURL(ctx, options)
+}
+
+func (upload *chaosUpload) PresignPart(ctx context.Context, offset int64, expiry time.Duration) (string, int64, error) {
+	if err := upload.store.inject(ctx, "PresignPart"); err != nil {
+		return "", 0, err
+	}
+
+	return upload.store.inner.PartPresigner.AsPartPresignableUpload(upload.upload).PresignPart(ctx, offset, expiry)
+}
+
+func (upload *chaosUpload) SetExpiration(ctx context.Context, expiresAt time.Time) error {
+	if err := upload.store.inject(ctx, "SetExpiration"); err != nil {
+		return err
+	}
+
+	return upload.store.inner.Expirer.AsExpirableUpload(upload.upload).SetExpiration(ctx, expiresAt)
+}
+
+func (upload *chaosUpload) AppendPartialUploads(ctx context.Context, ids []string) error {
+	if err := upload.store.inject(ctx, "AppendPartialUploads"); err != nil {
+		return err
+	}
+
+	return upload.store.inner.PartialAppender.AsPartialAppendableUpload(upload.upload).AppendPartialUploads(ctx, ids)
+}
+
+func (upload *chaosUpload) RecordChecksum(ctx context.Context, checksum handler.UploadChecksum) error {
+	if err := upload.store.inject(ctx, "RecordChecksum"); err != nil {
+		return err
+	}
+
+	return upload.store.inner.ChecksumRecorder.AsChecksumRecordableUpload(upload.upload).RecordChecksum(ctx, checksum)
+}
+
+func (upload *chaosUpload) Inspect(ctx context.Context) (handler.UploadInspection, error) {
+	if err := upload.store.inject(ctx, "Inspect"); err != nil {
+		return handler.UploadInspection{}, err
+	}
+
+	return upload.store.inner.Inspector.AsInspectableUpload(upload.upload).Inspect(ctx)
+}
+
+// cutReader passes through the data from src until remaining bytes have been
+// read and then fails with ErrInjected, as a dropped connection would.
+type cutReader struct {
+	src       io.Reader
+	remaining int64
+}
+
+func (r *cutReader) Read(p []byte) (int, error) {
+	if r.remaining <= 0 {
+		return 0, ErrInjected
+	}
+
+	if int64(len(p)) > r.remaining {
+		p = p[:r.remaining]
+	}
+	n, err := r.src.Read(p)
+	r.remaining -= int64(n)
+	return n, err
+}
@@ -0,0 +1,105 @@
+package chaosstore
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tus/tusd/v2/pkg/filestore"
+	"github.com/tus/tusd/v2/pkg/handler"
+	"github.com/tus/tusd/v2/pkg/storetest"
+)
+
+// Test interface implementation of ChaosStore
+var _ handler.DataStore = &ChaosStore{}
+var _ handler.TerminaterDataStore = &ChaosStore{}
+var _ handler.ConcaterDataStore = &ChaosStore{}
+var _ handler.LengthDeferrerDataStore = &ChaosStore{}
+var _ handler.ListableDataStore = &ChaosStore{}
+var _ handler.PresignerDataStore = &ChaosStore{}
+var _ handler.PartPresignerDataStore = &ChaosStore{}
+var _ handler.ExpirerDataStore = &ChaosStore{}
+var _ handler.InspectorDataStore = &ChaosStore{}
+var _ handler.ImporterDataStore = &ChaosStore{}
+var _ handler.IngesterDataStore = &ChaosStore{}
+
+func newComposer(t *testing.T, config Config) *handler.StoreComposer {
+	inner := handler.NewStoreComposer()
+	filestore.New(t.TempDir()).UseIn(inner)
+
+	composer := handler.NewStoreComposer()
+	New(inner, config).UseIn(composer)
+	return composer
+}
+
+// TestConformance checks that the wrapped store behaves like the inner one if
+// no faults are injected.
+func TestConformance(t *testing.T) {
+	storetest.Run(t, newComposer(t, Config{}), storetest.Options{})
+}
+
+func TestUseIn(t *testing.T) {
+	composer := newComposer(t, Config{})
+
+	a := assert.New(t)
+	a.True(composer.UsesTerminater)
+	a.True(composer.UsesConcater)
+	a.True(composer.UsesLengthDeferrer)
+	a.True(composer.UsesLister)
+	a.True(composer.UsesExpirer)
+	a.False(composer.UsesPresigner)
+	a.False(composer.UsesInspector)
+	a.False(composer.UsesImporter)
+}
+
+func TestErrorRate(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	composer := newComposer(t, Config{
+		ErrorRate:  1,
+		Operations: []string{"GetInfo"},
+	})
+
+	upload, err := composer.Core.NewUpload(ctx, handler.FileInfo{Size: 5})
+	a.NoError(err)
+
+	_, err = upload.GetInfo(ctx)
+	a.Equal(ErrInjected, err)
+}
+
+func TestPartialWrite(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	composer := newComposer(t, Config{
+		PartialWriteRate:     1,
+		PartialWriteMaxBytes: 5,
+		Operations:           []string{"WriteChunk"},
+	})
+
+	upload, err := composer.Core.NewUpload(ctx, handler.FileInfo{Size: 11})
+	a.NoError(err)
+
+	n, err := upload.WriteChunk(ctx, 0, strings.NewReader("hello world"))
+	a.Equal(ErrInjected, err)
+	a.Less(n, int64(5))
+
+	// The data up to the cut has been stored.
+	info, err := upload.GetInfo(ctx)
+	a.NoError(err)
+	a.Equal(n, info.Offset)
+}
+
+func TestLatency(t *testing.T) {
+	a := assert.New(t)
+	composer := newComposer(t, Config{
+		Latency: time.Hour,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := composer.Core.NewUpload(ctx, handler.FileInfo{Size: 5})
+	a.ErrorIs(err, context.DeadlineExceeded)
+}
@@ -0,0 +1,284 @@
+package circuitbreaker
+
+import (
+	"sync"
+	"time"
+)
+
+// State is the state of a circuit breaker.
+type State int
+
+const (
+	// StateClosed is the normal state, in which all operations are forwarded.
+	StateClosed State = iota
+	// StateHalfOpen is entered once OpenDuration has passed after the breaker
+	// tripped. New uploads are accepted again to probe the store, but a single
+	// failure opens the breaker again.
+	StateHalfOpen
+	// StateOpen is entered if the store is unhealthy. New uploads are rejected,
+	// while operations on existing uploads are still forwarded.
+	StateOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateHalfOpen:
+		return "half-open"
+	case StateOpen:
+		return "open"
+	default:
+		return "unknown"
+	}
+}
+
+// Override replaces the automatic state of a breaker, e.g. during an incident
+// or maintenance of the storage backend.
+type Override string
+
+const (
+	// OverrideNone lets the breaker determine its state from the observed
+	// operations.
+	OverrideNone Override = ""
+	// OverrideOpen rejects all new uploads until the override is removed.
+	OverrideOpen Override = "open"
+	// OverrideClosed accepts all new uploads until the override is removed,
+	// regardless of the store's health.
+	OverrideClosed Override = "closed"
+)
+
+// numBuckets is the number of buckets, into which the window is divided. The
+// oldest bucket is dropped as a whole, so the window slides in steps of
+// Window / numBuckets.
+const numBuckets = 10
+
+// bucket holds the outcomes of the operations started in a part of the window.
+type bucket struct {
+	start    time.Time
+	total    int64
+	failures int64
+	slow     int64
+	timed    int64
+	latency  time.Duration
+}
+
+// Health summarizes the operations in the current window and the breaker's
+// state.
+type Health struct {
+	// State is the effective state, taking the override into account.
+	State State
+	// Override is the override set using SetOverride, if any.
+	Override Override
+	// Requests is the number of operations in the window.
+	Requests int64
+	// ErrorRate is the fraction of failed operations in the window.
+	ErrorRate float64
+	// SlowRate is the fraction of operations in the window, which took longer
+	// than Config.SlowCallDuration.
+	SlowRate float64
+	// AverageLatency is the average duration of the operations in the window,
+	// excluding transfers of upload data, whose duration depends on the client.
+	AverageLatency time.Duration
+	// Score is between 0 for an unhealthy and 1 for a healthy store. It is one
+	// minus the larger of ErrorRate and SlowRate, or 1 if there have not been
+	// enough operations to judge the store.
+	Score float64
+	// Trips is the number of times the breaker has opened.
+	Trips int64
+	// Rejections is the number of new uploads, which have been rejected.
+	Rejections int64
+	// OpenUntil is the time at which an open breaker becomes half-open.
+	OpenUntil time.Time
+}
+
+// breaker tracks the outcome of operations in a sliding window and decides
+// whether new uploads are accepted. It is safe for concurrent use.
+type breaker struct {
+	config Config
+	now    func() time.Time
+
+	lock              sync.Mutex
+	buckets           [numBuckets]bucket
+	state             State
+	override          Override
+	openedAt          time.Time
+	halfOpenSuccesses int
+	trips             int64
+	rejections        int64
+}
+
+func newBreaker(config Config) *breaker {
+	return &breaker{
+		config: config,
+		now:    time.Now,
+	}
+}
+
+// record adds the outcome of an operation to the window and updates the state.
+// If timed is false, the duration is not known or not meaningful, e.g. for
+// transfers, and the operation is not considered for the latency.
+func (b *breaker) record(failed bool, timed bool, duration time.Duration) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	now := b.now()
+	b.updateState(now)
+
+	current := b.bucketAt(now)
+	current.total++
+	if failed {
+		current.failures++
+	}
+	if timed {
+		current.timed++
+		current.latency += duration
+		if b.config.SlowCallDuration > 0 && duration >= b.config.SlowCallDuration {
+			current.slow++
+		}
+	}
+
+	switch b.state {
+	case StateHalfOpen:
+		if failed {
+			b.trip(now)
+			return
+		}
+
+		b.halfOpenSuccesses++
+		if b.halfOpenSuccesses >= b.config.HalfOpenSuccesses {
+			b.state = StateClosed
+		}
+	case StateClosed:
+		health := b.health(now)
+		if health.Requests < int64(b.config.MinRequests) {
+			return
+		}
+
+		if health.ErrorRate >= b.config.ErrorRateThreshold || (b.config.SlowRateThreshold > 0 && health.SlowRate >= b.config.SlowRateThreshold) {
+			b.trip(now)
+		}
+	}
+}
+
+// allow reports whether a new upload may be created. If not, it returns the
+// duration after which the client should retry.
+func (b *breaker) allow() (bool, time.Duration) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	now := b.now()
+	b.updateState(now)
+
+	switch {
+	case b.override == OverrideClosed:
+		return true, 0
+	case b.override == OverrideOpen:
+		b.rejections++
+		return false, b.config.OpenDuration
+	case b.state == StateOpen:
+		b.rejections++
+		return false, b.openedAt.Add(b.config.OpenDuration).Sub(now)
+	default:
+		return true, 0
+	}
+}
+
+func (b *breaker) setOverride(override Override) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.override = override
+	if override == OverrideNone {
+		// Start over, so that failures from before the override do not trip
+		// the breaker immediately.
+		b.state = StateClosed
+		b.buckets = [numBuckets]bucket{}
+	}
+}
+
+func (b *breaker) currentHealth() Health {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	now := b.now()
+	b.updateState(now)
+	return b.health(now)
+}
+
+// health sums up the buckets within the window. The lock must be held.
+func (b *breaker) health(now time.Time) Health {
+	health := Health{
+		State:      b.state,
+		Override:   b.override,
+		Trips:      b.trips,
+		Rejections: b.rejections,
+		Score:      1,
+	}
+	switch b.override {
+	case OverrideOpen:
+		health.State = StateOpen
+	case OverrideClosed:
+		health.State = StateClosed
+	}
+	if b.state == StateOpen && b.override == OverrideNone {
+		health.OpenUntil = b.openedAt.Add(b.config.OpenDuration)
+	}
+
+	var failures, slow, timed int64
+	var latency time.Duration
+	windowStart := now.Add(-b.config.Window)
+	for _, bucket := range b.buckets {
+		if bucket.start.After(windowStart) {
+			health.Requests += bucket.total
+			failures += bucket.failures
+			slow += bucket.slow
+			timed += bucket.timed
+			latency += bucket.latency
+		}
+	}
+
+	if health.Requests > 0 {
+		health.ErrorRate = float64(failures) / float64(health.Requests)
+		health.SlowRate = float64(slow) / float64(health.Requests)
+	}
+	if timed > 0 {
+		health.AverageLatency = latency / time.Duration(timed)
+	}
+	if health.Requests >= int64(b.config.MinRequests) {
+		health.Score = 1 - max(health.ErrorRate, health.SlowRate)
+	}
+
+	return health
+}
+
+// bucketAt returns the bucket for operations started at now, clearing it if it
+// belongs to an earlier window. The lock must be held.
+func (b *breaker) bucketAt(now time.Time) *bucket {
+	size := b.config.Window / numBuckets
+	start := now.Truncate(size)
+	current := &b.buckets[(start.UnixNano()/int64(size))%numBuckets]
+	if !current.start.Equal(start) {
+		*current = bucket{start: start}
+	}
+	return current
+}
+
+// trip opens the breaker. The lock must be held.
+func (b *breaker) trip(now time.Time) {
+	b.state = StateOpen
+	b.openedAt = now
+	b.trips++
+	// The failures which tripped the breaker must not trip it again once it
+	// is half-open.
+	b.buckets = [numBuckets]bucket{}
+}
+
+// updateState moves an open breaker into the half-open state once OpenDuration
+// has passed. The lock must be held.
+func (b *breaker) updateState(now time.Time) {
+	if b.state == StateOpen && now.Sub(b.openedAt) >= b.config.OpenDuration {
+		b.state = StateHalfOpen
+		b.halfOpenSuccesses = 0
+	}
+}
@@ -0,0 +1,131 @@
+package circuitbreaker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestBreaker() (*breaker, *time.Time) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := newBreaker(Config{
+		Window:             10 * time.Second,
+		MinRequests:        4,
+		ErrorRateThreshold: 0.5,
+		SlowCallDuration:   time.Second,
+		SlowRateThreshold:  0.75,
+		OpenDuration:       5 * time.Second,
+		HalfOpenSuccesses:  2,
+	})
+	b.now = func() time.Time { return now }
+	return b, &now
+}
+
+func TestBreakerTrip(t *testing.T) {
+	a := assert.New(t)
+	b, now := newTestBreaker()
+
+	// Not enough requests to judge the store.
+	b.record(true, true, 0)
+	b.record(true, true, 0)
+	b.record(true, true, 0)
+	ok, _ := b.allow()
+	a.True(ok)
+	a.Equal(1.0, b.currentHealth().Score)
+
+	b.record(false, true, 0)
+	ok, retryAfter := b.allow()
+	a.False(ok)
+	a.Equal(5*time.Second, retryAfter)
+
+	health := b.currentHealth()
+	a.Equal(StateOpen, health.State)
+	a.EqualValues(1, health.Trips)
+	a.EqualValues(1, health.Rejections)
+
+	*now = now.Add(2 * time.Second)
+	_, retryAfter = b.allow()
+	a.Equal(3*time.Second, retryAfter)
+
+	// A failure in the half-open state trips the breaker again.
+	*now = now.Add(3 * time.Second)
+	ok, _ = b.allow()
+	a.True(ok)
+	a.Equal(StateHalfOpen, b.currentHealth().State)
+	b.record(true, true, 0)
+	a.Equal(StateOpen, b.currentHealth().State)
+	a.EqualValues(2, b.currentHealth().Trips)
+
+	// Enough successes close it.
+	*now = now.Add(5 * time.Second)
+	b.record(false, true, 0)
+	a.Equal(StateHalfOpen, b.currentHealth().State)
+	b.record(false, true, 0)
+	a.Equal(StateClosed, b.currentHealth().State)
+}
+
+func TestBreakerSlowCalls(t *testing.T) {
+	a := assert.New(t)
+	b, _ := newTestBreaker()
+
+	// Untimed operations are never slow.
+	b.record(false, false, 0)
+	b.record(false, true, 0)
+	b.record(false, true, 3*time.Second)
+	b.record(false, true, 3*time.Second)
+
+	health := b.currentHealth()
+	a.Equal(StateClosed, health.State)
+	a.Equal(0.5, health.SlowRate)
+	a.Equal(2*time.Second, health.AverageLatency)
+
+	b.record(false, true, 3*time.Second)
+	b.record(false, true, 3*time.Second)
+	a.Equal(StateClosed, b.currentHealth().State)
+	b.record(false, true, 3*time.Second)
+	b.record(false, true, 3*time.Second)
+	a.Equal(StateOpen, b.currentHealth().State)
+}
+
+func TestBreakerWindow(t *testing.T) {
+	a := assert.New(t)
+	b, now := newTestBreaker()
+
+	b.record(true, true, 0)
+	b.record(true, true, 0)
+	b.record(true, true, 0)
+
+	// The failures have left the window.
+	*now = now.Add(11 * time.Second)
+	b.record(true, true, 0)
+
+	health := b.currentHealth()
+	a.Equal(StateClosed, health.State)
+	a.EqualValues(1, health.Requests)
+}
+
+func TestBreakerOverride(t *testing.T) {
+	a := assert.New(t)
+	b, _ := newTestBreaker()
+
+	b.setOverride(OverrideOpen)
+	ok, retryAfter := b.allow()
+	a.False(ok)
+	a.Equal(5*time.Second, retryAfter)
+	a.Equal(StateOpen, b.currentHealth().State)
+
+	for i := 0; i < 4; i++ {
+		b.record(true, true, 0)
+	}
+	b.setOverride(OverrideClosed)
+	ok, _ = b.allow()
+	a.True(ok)
+	a.Equal(StateClosed, b.currentHealth().State)
+
+	// Removing the override discards the previous failures.
+	b.setOverride(OverrideNone)
+	ok, _ = b.allow()
+	a.True(ok)
+	a.EqualValues(0, b.currentHealth().Requests)
+}
@@ -0,0 +1,385 @@
+// Package circuitbreaker provides a wrapper for data stores, which rejects new
+// uploads while the store is unhealthy.
+//
+// CircuitBreakerStore observes the outcome and latency of all operations of the wrapped
+// store. If too many of them fail or are slow, the circuit breaker trips and
+// new uploads are rejected with ErrCircuitOpen, which responds with 503 Service
+// Unavailable and a Retry-After header, instead of letting clients wait for a
+// failing backend. Operations on existing uploads are still forwarded, so that
+// uploads in progress can continue once the backend recovers. After
+// Config.OpenDuration, new uploads are accepted again to probe the store.
+//
+// The wrapped store is passed as composer, so that all of its extensions are
+// preserved:
+//
+//	inner := handler.NewStoreComposer()
+//	store := s3store.New("bucket", s3Client)
+//	store.UseIn(inner)
+//
+//	composer := handler.NewStoreComposer()
+//	circuitbreaker.New(inner, circuitbreaker.Config{}).UseIn(composer)
+package circuitbreaker
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/tus/tusd/v2/pkg/handler"
+)
+
+// ErrCircuitOpen is returned when creating an upload while the breaker is open.
+// The returned error additionally contains the Retry-After header.
+var ErrCircuitOpen = handler.NewError("ERR_STORAGE_UNAVAILABLE", "storage is currently unavailable, please retry later", http.StatusServiceUnavailable)
+
+// Config controls when the breaker trips.
+type Config struct {
+	// Window is the duration over which the outcomes of operations are
+	// considered.
+	// Defaults to 1min.
+	Window time.Duration
+	// MinRequests is the number of operations in the window, which are required
+	// before the breaker can trip, so that a few failures during low traffic do
+	// not reject all uploads.
+	// Defaults to 20.
+	MinRequests int
+	// ErrorRateThreshold is the fraction of failed operations between 0 and 1,
+	// at which the breaker trips. Errors caused by clients, such as requests
+	// for missing uploads or interrupted transfers, are not counted.
+	// Defaults to 0.5.
+	ErrorRateThreshold float64
+	// SlowCallDuration is the duration after which an operation is considered
+	// slow. Transfers of upload data are never considered slow.
+	// Defaults to 10s.
+	SlowCallDuration time.Duration
+	// SlowRateThreshold is the fraction of slow operations between 0 and 1, at
+	// which the breaker trips. If zero, slow operations do not trip the breaker.
+	SlowRateThreshold float64
+	// OpenDuration is the duration for which new uploads are rejected after
+	// the breaker tripped.
+	// Defaults to 30s.
+	OpenDuration time.Duration
+	// HalfOpenSuccesses is the number of successful operations after
+	// OpenDuration, which close the breaker again.
+	// Defaults to 10.
+	HalfOpenSuccesses int
+}
+
+// CircuitBreakerStore wraps a data store and rejects new uploads while it is unhealthy. It
+// must be created using New.
+type CircuitBreakerStore struct {
+	inner   *handler.StoreComposer
+	breaker *breaker
+}
+
+// New creates a store, which forwards all operations to the store in inner and
+// observes their outcomes.
+func New(inner *handler.StoreComposer, config Config) *CircuitBreakerStore {
+	if config.Window <= 0 {
+		config.Window = 1 * time.Minute
+	}
+	if config.MinRequests <= 0 {
+		config.MinRequests = 20
+	}
+	if config.ErrorRateThreshold <= 0 {
+		config.ErrorRateThreshold = 0.5
+	}
+	if config.SlowCallDuration <= 0 {
+		config.SlowCallDuration = 10 * time.Second
+	}
+	if config.OpenDuration <= 0 {
+		config.OpenDuration = 30 * time.Second
+	}
+	if config.HalfOpenSuccesses <= 0 {
+		config.HalfOpenSuccesses = 10
+	}
+
+	return &CircuitBreakerStore{
+		inner:   inner,
+		breaker: newBreaker(config),
+	}
+}
+
+// UseIn sets this store as the core data store in the passed composer and adds
+// all extensions, which are provided by the wrapped store.
+func (store *CircuitBreakerStore) UseIn(composer *handler.StoreComposer) {
+	handler.UseWrapper(composer, store, store.inner)
+}
+
+// Health returns the breaker's state and the statistics of the current window.
+func (store *CircuitBreakerStore) Health() Health {
+	return store.breaker.currentHealth()
+}
+
+// SetOverride replaces the breaker's automatic state until it is called again
+// with OverrideNone. Removing an override also discards the statistics of the
+// current window.
+func (store *CircuitBreakerStore) SetOverride(override Override) {
+	store.breaker.setOverride(override)
+}
+
+// admit checks whether a new upload may be created.
+func (store *CircuitBreakerStore) admit() error {
+	ok, retryAfter := store.breaker.allow()
+	if ok {
+		return nil
+	}
+
+	err := ErrCircuitOpen
+	err.HTTPResponse = err.HTTPResponse.MergeWith(handler.HTTPResponse{
+		Header: handler.HTTPHeader{
+			"Retry-After": strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))),
+		},
+	})
+	return err
+}
+
+// observe records the outcome of an operation, which started at start.
+func (store *CircuitBreakerStore) observe(start time.Time, err error) {
+	store.breaker.record(isFailure(err), true, time.Since(start))
+}
+
+// isFailure reports whether err indicates a problem of the store. Errors
+// caused by clients or by tusd interrupting a request are not counted.
+func isFailure(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var detailedErr handler.Error
+	if errors.As(err, &detailedErr) {
+		if detailedErr.HTTPResponse.StatusCode < 500 {
+			return false
+		}
+
+		switch {
+		case errors.Is(err, handler.ErrServerShutdown), errors.Is(err, handler.ErrReadTimeout), errors.Is(err, handler.ErrConnectionReset):
+			return false
+		}
+	}
+
+	return true
+}
+
+func (store *CircuitBreakerStore) NewUpload(ctx context.Context, info handler.FileInfo) (handler.Upload, error) {
+	if err := store.admit(); err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	upload, err := store.inner.Core.NewUpload(ctx, info)
+	store.observe(start, err)
+	if err != nil {
+		return nil, err
+	}
+
+	return &breakerUpload{store: store, upload: upload}, nil
+}
+
+func (store *CircuitBreakerStore) GetUpload(ctx context.Context, id string) (handler.Upload, error) {
+	start := time.Now()
+	upload, err := store.inner.Core.GetUpload(ctx, id)
+	store.observe(start, err)
+	if err != nil {
+		return nil, err
+	}
+
+	return &breakerUpload{store: store, upload: upload}, nil
+}
+
+func (store *CircuitBreakerStore) ListUploads(ctx context.Context, cursor string) ([]string, string, error) {
+	start := time.Now()
+	ids, next, err := store.inner.Lister.ListUploads(ctx, cursor)
+	store.observe(start, err)
+	return ids, next, err
+}
+
+func (store *CircuitBreakerStore) ImportUpload(ctx context.Context, info handler.FileInfo) (handler.Upload, error) {
+	if err := store.admit(); err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	upload, err := store.inner.Importer.ImportUpload(ctx, info)
+	store.observe(start, err)
+	if err != nil {
+		return nil, err
+	}
+
+	return &breakerUpload{store: store, upload: upload}, nil
+}
+
+func (store *CircuitBreakerStore) IngestObject(ctx context.Context, info handler.FileInfo, source handler.IngestSource) (handler.Upload, error) {
+	if err := store.admit(); err != nil {
+		return nil, err
+	}
+
+	// The duration depends on the size of the object, so it is not timed.
+	upload, err := store.inner.Ingester.IngestObject(ctx, info, source)
+	store.breaker.record(isFailure(err), false, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return &breakerUpload{store: store, upload: upload}, nil
+}
+
+func (store *CircuitBreakerStore) AsTerminatableUpload(upload handler.Upload) handler.TerminatableUpload {
+	return upload.(*breakerUpload)
+}
+
+func (store *CircuitBreakerStore) AsConcatableUpload(upload handler.Upload) handler.ConcatableUpload {
+	return upload.(*breakerUpload)
+}
+
+func (store *CircuitBreakerStore) AsLengthDeclarableUpload(upload handler.Upload) handler.LengthDeclarableUpload {
+	return upload.(*breakerUpload)
+}
+
+func (store *CircuitBreakerStore) AsPresignableUpload(upload handler.Upload) handler.PresignableUpload {
+	return upload.(*breakerUpload)
+}
+
+func (store *CircuitBreakerStore) AsPartPresignableUpload(upload handler.Upload) handler.PartPresignableUpload {
+	return upload.(*breakerUpload)
+}
+
+func (store *CircuitBreakerStore) AsExpirableUpload(upload handler.Upload) handler.ExpirableUpload {
+	return upload.(*breakerUpload)
+}
+
+func (store *CircuitBreakerStore) AsInspectableUpload(upload handler.Upload) handler.InspectableUpload {
+	return upload.(*breakerUpload)
+}
+
+func (store *CircuitBreakerStore) AsPartialAppendableUpload(upload handler.Upload) handler.PartialAppendableUpload {
+	return upload.(*breakerUpload)
+}
+
+func (store *CircuitBreakerStore) AsChecksumRecordableUpload(upload handler.Upload) handler.ChecksumRecordableUpload {
+	return upload.(*breakerUpload)
+}
+
+// breakerUpload wraps an upload of the inner store. The extensions of the inner
+// store expect their own uploads, so the wrapped upload is passed to them.
+type breakerUpload struct {
+	store  *CircuitBreakerStore
+	upload handler.Upload
+}
+
+func (upload *breakerUpload) WriteChunk(ctx context.Context, offset int64, src io.Reader) (int64, error) {
+	reader := &trackingReader{src: src}
+	n, err := upload.upload.WriteChunk(ctx, offset, reader)
+
+	// Failures to receive the data from the client are not the store's fault.
+	// The duration depends on the client, so it is not timed either.
+	upload.store.breaker.record(reader.err == nil && isFailure(err), false, 0)
+	return n, err
+}
+
+func (upload *breakerUpload) GetInfo(ctx context.Context) (handler.FileInfo, error) {
+	start := time.Now()
+	info, err := upload.upload.GetInfo(ctx)
+	upload.store.observe(start, err)
+	return info, err
+}
+
+func (upload *breakerUpload) GetReader(ctx context.Context) (io.ReadCloser, error) {
+	start := time.Now()
+	reader, err := upload.upload.GetReader(ctx)
+	upload.store.observe(start, err)
+	return reader, err
+}
+
+func (upload *breakerUpload) FinishUpload(ctx context.Context) error {
+	start := time.Now()
+	err := upload.upload.FinishUpload(ctx)
+	upload.store.observe(start, err)
+	return err
+}
+
+func (upload *breakerUpload) Terminate(ctx context.Context) error {
+	start := time.Now()
+	err := upload.store.inner.Terminater.AsTerminatableUpload(upload.upload).Terminate(ctx)
+	upload.store.observe(start, err)
+	return err
+}
+
+func (upload *breakerUpload) ConcatUploads(ctx context.Context, partialUploads []handler.Upload) error {
+	innerUploads := make([]handler.Upload, len(partialUploads))
+	for i, partialUpload := range partialUploads {
+		innerUploads[i] = partialUpload.(*breakerUpload).upload
+	}
+
+	// The duration depends on the size of the partial uploads, so it is not timed.
+	err := upload.store.inner.Concater.AsConcatableUpload(upload.upload).ConcatUploads(ctx, innerUploads)
+	upload.store.breaker.record(isFailure(err), false, 0)
+	return err
+}
+
+func (upload *breakerUpload) DeclareLength(ctx context.Context, length int64) error {
+	start := time.Now()
+	err := upload.store.inner.LengthDeferrer.AsLengthDeclarableUpload(upload.upload).DeclareLength(ctx, length)
+	upload.store.observe(start, err)
+	return err
+}
+
+func (upload *breakerUpload) PresignDownloadURL(ctx context.Context, options handler.PresignOptions) (string, error) {
+	start := time.Now()
+	url, err := upload.store.inner.Presigner.AsPresignableUpload(upload.upload).PresignDownloadURL(ctx, options)
+	upload.store.observe(start, err)
+	return url, err
+}
+
+func (upload *breakerUpload) PresignPart(ctx context.Context, offset int64, expiry time.Duration) (string, int64, error) {
+	start := time.Now()
+	url, size, err := upload.store.inner.PartPresigner.AsPartPresignableUpload(upload.upload).PresignPart(ctx, offset, expiry)
+	upload.store.observe(start, err)
+	return url, size, err
+}
+
+func (upload *breakerUpload) SetExpiration(ctx context.Context, expiresAt time.Time) error {
+	start := time.Now()
+	err := upload.store.inner.Expirer.AsExpirableUpload(upload.upload).SetExpiration(ctx, expiresAt)
+	upload.store.observe(start, err)
+	return err
+}
+
+func (upload *breakerUpload) AppendPartialUploads(ctx context.Context, ids []string) error {
+	start := time.Now()
+	err := upload.store.inner.PartialAppender.AsPartialAppendableUpload(upload.upload).AppendPartialUploads(ctx, ids)
+	upload.store.observe(start, err)
+	return err
+}
+
+func (upload *breakerUpload) RecordChecksum(ctx context.Context, checksum handler.UploadChecksum) error {
+	start := time.Now()
+	err := upload.store.inner.ChecksumRecorder.AsChecksumRecordableUpload(upload.upload).RecordChecksum(ctx, checksum)
+	upload.store.observe(start, err)
+	return err
+}
+
+func (upload *breakerUpload) Inspect(ctx context.Context) (handler.UploadInspection, error) {
+	start := time.Now()
+	inspection, err := upload.store.inner.Inspector.AsInspectableUpload(upload.upload).Inspect(ctx)
+	upload.store.observe(start, err)
+	return inspection, err
+}
+
+// trackingReader remembers whether reading from src failed.
+type trackingReader struct {
+	src io.Reader
+	err error
+}
+
+func (r *trackingReader) Read(p []byte) (int, error) {
+	n, err := r.src.Read(p)
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return n, err
+}
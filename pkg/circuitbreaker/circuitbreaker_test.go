@@ -0,0 +1,125 @@
+package circuitbreaker
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tus/tusd/v2/pkg/filestore"
+	"github.com/tus/tusd/v2/pkg/handler"
+	"github.com/tus/tusd/v2/pkg/storetest"
+)
+
+// Test interface implementation of CircuitBreakerStore
+var _ handler.DataStore = &CircuitBreakerStore{}
+var _ handler.TerminaterDataStore = &CircuitBreakerStore{}
+var _ handler.ConcaterDataStore = &CircuitBreakerStore{}
+var _ handler.LengthDeferrerDataStore = &CircuitBreakerStore{}
+var _ handler.ListableDataStore = &CircuitBreakerStore{}
+var _ handler.PresignerDataStore = &CircuitBreakerStore{}
+var _ handler.PartPresignerDataStore = &CircuitBreakerStore{}
+var _ handler.ExpirerDataStore = &CircuitBreakerStore{}
+var _ handler.InspectorDataStore = &CircuitBreakerStore{}
+var _ handler.ImporterDataStore = &CircuitBreakerStore{}
+var _ handler.IngesterDataStore = &CircuitBreakerStore{}
+
+func newStore(t *testing.T, config Config) (*CircuitBreakerStore, *handler.StoreComposer) {
+	inner := handler.NewStoreComposer()
+	filestore.New(t.TempDir()).UseIn(inner)
+
+	composer := handler.NewStoreComposer()
+	store := New(inner, config)
+	store.UseIn(composer)
+	return store, composer
+}
+
+// TestConformance checks that the wrapped store behaves like the inner one while
+// the breaker is closed.
+func TestConformance(t *testing.T) {
+	_, composer := newStore(t, Config{})
+	storetest.Run(t, composer, storetest.Options{})
+}
+
+func TestUseIn(t *testing.T) {
+	_, composer := newStore(t, Config{})
+
+	a := assert.New(t)
+	a.True(composer.UsesTerminater)
+	a.True(composer.UsesConcater)
+	a.True(composer.UsesLengthDeferrer)
+	a.True(composer.UsesLister)
+	a.True(composer.UsesExpirer)
+	a.False(composer.UsesPresigner)
+	a.False(composer.UsesInspector)
+	a.False(composer.UsesImporter)
+}
+
+func TestRejectNewUploads(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	store, composer := newStore(t, Config{})
+
+	upload, err := composer.Core.NewUpload(ctx, handler.FileInfo{Size: 5})
+	a.NoError(err)
+
+	store.SetOverride(OverrideOpen)
+	_, err = composer.Core.NewUpload(ctx, handler.FileInfo{Size: 5})
+	a.ErrorIs(err, ErrCircuitOpen)
+
+	var detailedErr handler.Error
+	a.True(errors.As(err, &detailedErr))
+	a.Equal(http.StatusServiceUnavailable, detailedErr.HTTPResponse.StatusCode)
+	a.Equal("30", detailedErr.HTTPResponse.Header["Retry-After"])
+
+	// Uploads in progress can continue.
+	n, err := upload.WriteChunk(ctx, 0, strings.NewReader("hello"))
+	a.NoError(err)
+	a.EqualValues(5, n)
+	a.EqualValues(1, store.Health().Rejections)
+}
+
+func TestClientErrorsAreIgnored(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	store, composer := newStore(t, Config{
+		MinRequests: 1,
+	})
+
+	_, err := composer.Core.GetUpload(ctx, "missing")
+	a.ErrorIs(err, handler.ErrNotFound)
+
+	upload, err := composer.Core.NewUpload(ctx, handler.FileInfo{Size: 5})
+	a.NoError(err)
+	_, err = upload.WriteChunk(ctx, 0, &failingReader{})
+	a.Error(err)
+
+	health := store.Health()
+	a.Equal(StateClosed, health.State)
+	a.EqualValues(0, health.ErrorRate)
+	a.EqualValues(3, health.Requests)
+}
+
+func TestIsFailure(t *testing.T) {
+	a := assert.New(t)
+	a.False(isFailure(nil))
+	a.False(isFailure(context.Canceled))
+	a.False(isFailure(handler.ErrNotFound))
+	a.False(isFailure(handler.ErrReadTimeout))
+	a.False(isFailure(handler.ErrServerShutdown))
+	a.True(isFailure(errors.New("connection refused")))
+	a.True(isFailure(context.DeadlineExceeded))
+	a.True(isFailure(handler.NewError("ERR_BACKEND", "backend failed", http.StatusInternalServerError)))
+}
+
+// failingReader fails after a short delay, like a client whose connection
+// breaks.
+type failingReader struct{}
+
+func (failingReader) Read(p []byte) (int, error) {
+	time.Sleep(time.Millisecond)
+	return 0, errors.New("connection reset by peer")
+}
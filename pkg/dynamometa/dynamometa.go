@@ -0,0 +1,190 @@
+// Package dynamometa provides a handler.MetadataStore which keeps the info of
+// uploads in an Amazon DynamoDB table, for data stores supporting a metadata
+// store, such as s3store.S3Store:
+//
+//	cfg, err := config.LoadDefaultConfig(ctx)
+//	if err != nil {
+//		return err
+//	}
+//	store := s3store.New(bucket, s3.NewFromConfig(cfg))
+//	store.MetadataStore = dynamometa.New("tusd_upload_info", dynamodb.NewFromConfig(cfg))
+//
+// The table must exist and have a partition key named id of type string. No
+// sort key or secondary indexes are used. Each item contains the JSON encoded
+// info in the attribute info and a counter in the attribute version, which is
+// used for conditional writes. Reads are strongly consistent, so that all
+// tusd instances see the latest info of an upload.
+package dynamometa
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/tus/tusd/v2/pkg/handler"
+)
+
+// maxUpdateAttempts limits how often UpdateInfo retries if concurrent updates
+// of the same info keep interfering.
+const maxUpdateAttempts = 10
+
+// ErrUpdateConflict is returned by UpdateInfo if the info was changed
+// concurrently in every attempt.
+var ErrUpdateConflict = errors.New("dynamometa: too many concurrent updates of upload info")
+
+// DynamoDBAPI contains the methods of dynamodb.Client used by the store.
+type DynamoDBAPI interface {
+	GetItem(ctx context.Context, input *dynamodb.GetItemInput, opt ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+	PutItem(ctx context.Context, input *dynamodb.PutItemInput, opt ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	UpdateItem(ctx context.Context, input *dynamodb.UpdateItemInput, opt ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error)
+	DeleteItem(ctx context.Context, input *dynamodb.DeleteItemInput, opt ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error)
+}
+
+// DynamoDBMetadataStore is a handler.MetadataStore which keeps the JSON encoded
+// info of uploads in a DynamoDB table. Updates are conditional writes on a
+// version attribute, so concurrent updates from multiple tusd instances do not
+// overwrite each other.
+type DynamoDBMetadataStore struct {
+	// Table is the name of the DynamoDB table.
+	Table string
+	// Service specifies an interface used to communicate with DynamoDB,
+	// usually a *dynamodb.Client.
+	Service DynamoDBAPI
+}
+
+// New creates a new metadata store using the given table.
+func New(table string, service DynamoDBAPI) *DynamoDBMetadataStore {
+	return &DynamoDBMetadataStore{
+		Table:   table,
+		Service: service,
+	}
+}
+
+// The attribute names are passed as placeholders, since expressions must not
+// contain DynamoDB's reserved words.
+var attributeNames = map[string]string{
+	"#info":    "info",
+	"#version": "version",
+}
+
+func (store *DynamoDBMetadataStore) GetInfo(ctx context.Context, key string) (handler.FileInfo, error) {
+	info, _, err := store.get(ctx, key)
+	return info, err
+}
+
+func (store *DynamoDBMetadataStore) PutInfo(ctx context.Context, key string, info handler.FileInfo) error {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+
+	// ADD starts the version at 1 for new items, and increments it for existing
+	// ones, so that pending conditional writes of the replaced info fail.
+	_, err = store.Service.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                aws.String(store.Table),
+		Key:                      store.key(key),
+		UpdateExpression:         aws.String("SET #info = :info ADD #version :one"),
+		ExpressionAttributeNames: attributeNames,
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":info": &types.AttributeValueMemberS{Value: string(data)},
+			":one":  &types.AttributeValueMemberN{Value: "1"},
+		},
+	})
+	return err
+}
+
+func (store *DynamoDBMetadataStore) UpdateInfo(ctx context.Context, key string, update func(info *handler.FileInfo) error) (handler.FileInfo, error) {
+	for attempt := 0; attempt < maxUpdateAttempts; attempt++ {
+		info, version, err := store.get(ctx, key)
+		if err != nil {
+			return handler.FileInfo{}, err
+		}
+
+		if err := update(&info); err != nil {
+			return handler.FileInfo{}, err
+		}
+
+		data, err := json.Marshal(info)
+		if err != nil {
+			return handler.FileInfo{}, err
+		}
+
+		_, err = store.Service.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName: aws.String(store.Table),
+			Item: map[string]types.AttributeValue{
+				"id":      &types.AttributeValueMemberS{Value: key},
+				"info":    &types.AttributeValueMemberS{Value: string(data)},
+				"version": &types.AttributeValueMemberN{Value: strconv.FormatInt(version+1, 10)},
+			},
+			ConditionExpression:      aws.String("#version = :version"),
+			ExpressionAttributeNames: map[string]string{"#version": "version"},
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":version": &types.AttributeValueMemberN{Value: strconv.FormatInt(version, 10)},
+			},
+		})
+		if err == nil {
+			return info, nil
+		}
+
+		var conditionErr *types.ConditionalCheckFailedException
+		if !errors.As(err, &conditionErr) {
+			return handler.FileInfo{}, err
+		}
+
+		// Another update changed or deleted the info since it was read, so
+		// start over with the latest info.
+	}
+
+	return handler.FileInfo{}, ErrUpdateConflict
+}
+
+func (store *DynamoDBMetadataStore) DeleteInfo(ctx context.Context, key string) error {
+	_, err := store.Service.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(store.Table),
+		Key:       store.key(key),
+	})
+	return err
+}
+
+// get returns the info stored under key together with its version.
+func (store *DynamoDBMetadataStore) get(ctx context.Context, key string) (info handler.FileInfo, version int64, err error) {
+	res, err := store.Service.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(store.Table),
+		Key:            store.key(key),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return info, 0, err
+	}
+	if res.Item == nil {
+		return info, 0, handler.ErrNotFound
+	}
+
+	data, ok := res.Item["info"].(*types.AttributeValueMemberS)
+	if !ok {
+		return info, 0, fmt.Errorf("dynamometa: item %s has no info attribute of type string", key)
+	}
+	number, ok := res.Item["version"].(*types.AttributeValueMemberN)
+	if !ok {
+		return info, 0, fmt.Errorf("dynamometa: item %s has no version attribute of type number", key)
+	}
+
+	version, err = strconv.ParseInt(number.Value, 10, 64)
+	if err != nil {
+		return info, 0, err
+	}
+
+	err = json.Unmarshal([]byte(data.Value), &info)
+	return info, version, err
+}
+
+func (store *DynamoDBMetadataStore) key(key string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"id": &types.AttributeValueMemberS{Value: key},
+	}
+}
@@ -0,0 +1,151 @@
+package dynamometa
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/tus/tusd/v2/pkg/handler"
+)
+
+// fakeTable implements the requests made by the store on an in-memory table.
+// beforePut is called before each conditional PutItem to simulate concurrent
+// updates.
+type fakeTable struct {
+	mutex     sync.Mutex
+	items     map[string]map[string]types.AttributeValue
+	beforePut func()
+}
+
+func newFakeTable() *fakeTable {
+	return &fakeTable{
+		items: make(map[string]map[string]types.AttributeValue),
+	}
+}
+
+func (table *fakeTable) GetItem(ctx context.Context, input *dynamodb.GetItemInput, opt ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	table.mutex.Lock()
+	defer table.mutex.Unlock()
+
+	if !aws.ToBool(input.ConsistentRead) {
+		panic("eventually consistent read")
+	}
+
+	return &dynamodb.GetItemOutput{Item: table.items[table.id(input.Key)]}, nil
+}
+
+func (table *fakeTable) PutItem(ctx context.Context, input *dynamodb.PutItemInput, opt ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	if table.beforePut != nil {
+		table.beforePut()
+	}
+
+	table.mutex.Lock()
+	defer table.mutex.Unlock()
+
+	id := table.id(input.Item)
+	expected := input.ExpressionAttributeValues[":version"].(*types.AttributeValueMemberN).Value
+	if item, ok := table.items[id]; !ok || item["version"].(*types.AttributeValueMemberN).Value != expected {
+		return nil, &types.ConditionalCheckFailedException{}
+	}
+
+	table.items[id] = input.Item
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (table *fakeTable) UpdateItem(ctx context.Context, input *dynamodb.UpdateItemInput, opt ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	table.mutex.Lock()
+	defer table.mutex.Unlock()
+
+	id := table.id(input.Key)
+	version := int64(0)
+	if item, ok := table.items[id]; ok {
+		version, _ = strconv.ParseInt(item["version"].(*types.AttributeValueMemberN).Value, 10, 64)
+	}
+
+	table.items[id] = map[string]types.AttributeValue{
+		"id":      input.Key["id"],
+		"info":    input.ExpressionAttributeValues[":info"],
+		"version": &types.AttributeValueMemberN{Value: strconv.FormatInt(version+1, 10)},
+	}
+	return &dynamodb.UpdateItemOutput{}, nil
+}
+
+func (table *fakeTable) DeleteItem(ctx context.Context, input *dynamodb.DeleteItemInput, opt ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	table.mutex.Lock()
+	defer table.mutex.Unlock()
+
+	delete(table.items, table.id(input.Key))
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+func (table *fakeTable) id(item map[string]types.AttributeValue) string {
+	return item["id"].(*types.AttributeValueMemberS).Value
+}
+
+func TestMetadataStore(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	store := New("tusd_upload_info", newFakeTable())
+
+	_, err := store.GetInfo(ctx, "foo")
+	a.ErrorIs(err, handler.ErrNotFound)
+	_, err = store.UpdateInfo(ctx, "foo", func(info *handler.FileInfo) error { return nil })
+	a.ErrorIs(err, handler.ErrNotFound)
+
+	a.NoError(store.PutInfo(ctx, "foo", handler.FileInfo{ID: "foo", Size: 10}))
+	info, err := store.UpdateInfo(ctx, "foo", func(info *handler.FileInfo) error {
+		info.Offset = 5
+		return nil
+	})
+	a.NoError(err)
+	a.Equal(int64(5), info.Offset)
+
+	info, err = store.GetInfo(ctx, "foo")
+	a.NoError(err)
+	a.Equal(handler.FileInfo{ID: "foo", Size: 10, Offset: 5}, info)
+
+	a.NoError(store.DeleteInfo(ctx, "foo"))
+	_, err = store.GetInfo(ctx, "foo")
+	a.ErrorIs(err, handler.ErrNotFound)
+}
+
+func TestMetadataStoreConcurrentUpdate(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	table := newFakeTable()
+	store := New("tusd_upload_info", table)
+
+	a.NoError(store.PutInfo(ctx, "foo", handler.FileInfo{ID: "foo", MetaData: handler.MetaData{}}))
+
+	// The first attempt is interrupted by another update, whose change must not
+	// be lost.
+	interrupted := false
+	table.beforePut = func() {
+		if !interrupted {
+			interrupted = true
+			a.NoError(store.PutInfo(ctx, "foo", handler.FileInfo{ID: "foo", MetaData: handler.MetaData{"a": "1"}}))
+		}
+	}
+
+	calls := 0
+	info, err := store.UpdateInfo(ctx, "foo", func(info *handler.FileInfo) error {
+		calls++
+		info.MetaData["b"] = "2"
+		return nil
+	})
+	a.NoError(err)
+	a.Equal(2, calls)
+	a.Equal(handler.MetaData{"a": "1", "b": "2"}, info.MetaData)
+
+	// An update which is always interrupted eventually fails.
+	table.beforePut = func() {
+		a.NoError(store.PutInfo(ctx, "foo", handler.FileInfo{ID: "foo"}))
+	}
+	_, err = store.UpdateInfo(ctx, "foo", func(info *handler.FileInfo) error { return nil })
+	a.ErrorIs(err, ErrUpdateConflict)
+}
@@ -5,16 +5,21 @@
 // `[id].info` files are used to store the fileinfo in JSON format. The
 // `[id]` files without an extension contain the raw binary data uploaded.
 // No cleanup is performed so you may want to run a cronjob to ensure your disk
-// is not filled up with old and finished uploads.
+// is not filled up with old and finished uploads. The expiration time of an
+// upload, if any, is stored as ExpiresAt in the `[id].info` file.
 package filestore
 
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/tus/tusd/v2/internal/uid"
 	"github.com/tus/tusd/v2/pkg/handler"
@@ -22,6 +27,9 @@ import (
 
 var defaultFilePerm = os.FileMode(0664)
 
+// listPageSize is the number of uploads inspected per ListUploads call.
+const listPageSize = 1000
+
 // See the handler.DataStore interface for documentation about the different
 // methods.
 type FileStore struct {
@@ -45,6 +53,10 @@ func (store FileStore) UseIn(composer *handler.StoreComposer) {
 	composer.UseTerminater(store)
 	composer.UseConcater(store)
 	composer.UseLengthDeferrer(store)
+	composer.UseLister(store)
+	composer.UseExpirer(store)
+	composer.UsePartialAppender(store)
+	composer.UseChecksumRecorder(store)
 }
 
 func (store FileStore) NewUpload(ctx context.Context, info handler.FileInfo) (handler.Upload, error) {
@@ -119,6 +131,57 @@ func (store FileStore) GetUpload(ctx context.Context, id string) (handler.Upload
 	}, nil
 }
 
+// ListUploads returns the IDs of unfinished uploads, ordered by their ID. The
+// cursor is the last ID that has been inspected.
+func (store FileStore) ListUploads(ctx context.Context, cursor string) ([]string, string, error) {
+	entries, err := os.ReadDir(store.Path)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var candidates []string
+	for _, entry := range entries {
+		id, isInfo := strings.CutSuffix(entry.Name(), ".info")
+		if isInfo && !entry.IsDir() && id > cursor {
+			candidates = append(candidates, id)
+		}
+	}
+	sort.Strings(candidates)
+
+	nextCursor := ""
+	if len(candidates) > listPageSize {
+		candidates = candidates[:listPageSize]
+		nextCursor = candidates[listPageSize-1]
+	}
+
+	ids := make([]string, 0, len(candidates))
+	for _, id := range candidates {
+		if err := ctx.Err(); err != nil {
+			return nil, "", err
+		}
+
+		upload, err := store.GetUpload(ctx, id)
+		if errors.Is(err, handler.ErrNotFound) {
+			// The upload has been removed in the meantime.
+			continue
+		}
+		if err != nil {
+			return nil, "", err
+		}
+
+		info, err := upload.GetInfo(ctx)
+		if err != nil {
+			return nil, "", err
+		}
+
+		if info.SizeIsDeferred || info.Offset < info.Size {
+			ids = append(ids, id)
+		}
+	}
+
+	return ids, nextCursor, nil
+}
+
 func (store FileStore) AsTerminatableUpload(upload handler.Upload) handler.TerminatableUpload {
 	return upload.(*fileUpload)
 }
@@ -132,6 +195,18 @@ func (store FileStore) AsConcatableUpload(upload handler.Upload) handler.Concata
 }
 
 // binPath returns the path to the file storing the binary data.
+func (store FileStore) AsExpirableUpload(upload handler.Upload) handler.ExpirableUpload {
+	return upload.(*fileUpload)
+}
+
+func (store FileStore) AsPartialAppendableUpload(upload handler.Upload) handler.PartialAppendableUpload {
+	return upload.(*fileUpload)
+}
+
+func (store FileStore) AsChecksumRecordableUpload(upload handler.Upload) handler.ChecksumRecordableUpload {
+	return upload.(*fileUpload)
+}
+
 func (store FileStore) binPath(id string) string {
 	return filepath.Join(store.Path, id)
 }
@@ -222,6 +297,21 @@ func (upload *fileUpload) DeclareLength(ctx context.Context, length int64) error
 	return upload.writeInfo()
 }
 
+func (upload *fileUpload) SetExpiration(ctx context.Context, expiresAt time.Time) error {
+	upload.info.ExpiresAt = &expiresAt
+	return upload.writeInfo()
+}
+
+func (upload *fileUpload) AppendPartialUploads(ctx context.Context, ids []string) error {
+	upload.info.PartialUploads = append(upload.info.PartialUploads, ids...)
+	return upload.writeInfo()
+}
+
+func (upload *fileUpload) RecordChecksum(ctx context.Context, checksum handler.UploadChecksum) error {
+	upload.info.Checksum = &checksum
+	return upload.writeInfo()
+}
+
 // writeInfo updates the entire information. Everything will be overwritten.
 func (upload *fileUpload) writeInfo() error {
 	data, err := json.Marshal(upload.info)
@@ -7,9 +7,11 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/tus/tusd/v2/pkg/handler"
+	"github.com/tus/tusd/v2/pkg/storetest"
 )
 
 // Test interface implementation of Filestore
@@ -17,6 +19,8 @@ var _ handler.DataStore = FileStore{}
 var _ handler.TerminaterDataStore = FileStore{}
 var _ handler.ConcaterDataStore = FileStore{}
 var _ handler.LengthDeferrerDataStore = FileStore{}
+var _ handler.ListableDataStore = FileStore{}
+var _ handler.ExpirerDataStore = FileStore{}
 
 func TestFilestore(t *testing.T) {
 	a := assert.New(t)
@@ -187,3 +191,146 @@ func TestDeclareLength(t *testing.T) {
 	a.EqualValues(100, updatedInfo.Size)
 	a.Equal(false, updatedInfo.SizeIsDeferred)
 }
+
+func TestSetExpiration(t *testing.T) {
+	a := assert.New(t)
+
+	tmp, err := os.MkdirTemp("", "tusd-filestore-set-expiration-")
+	a.NoError(err)
+
+	store := FileStore{tmp}
+	ctx := context.Background()
+
+	upload, err := store.NewUpload(ctx, handler.FileInfo{
+		Size: 100,
+	})
+	a.NoError(err)
+
+	info, err := upload.GetInfo(ctx)
+	a.NoError(err)
+	a.Nil(info.ExpiresAt)
+
+	expiresAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	err = store.AsExpirableUpload(upload).SetExpiration(ctx, expiresAt)
+	a.NoError(err)
+
+	// The expiration must be persisted in the info file
+	upload, err = store.GetUpload(ctx, info.ID)
+	a.NoError(err)
+
+	updatedInfo, err := upload.GetInfo(ctx)
+	a.NoError(err)
+	a.True(expiresAt.Equal(*updatedInfo.ExpiresAt))
+}
+
+func TestAppendPartialUploads(t *testing.T) {
+	a := assert.New(t)
+
+	tmp, err := os.MkdirTemp("", "tusd-filestore-append-partial-uploads-")
+	a.NoError(err)
+
+	store := FileStore{tmp}
+	ctx := context.Background()
+
+	upload, err := store.NewUpload(ctx, handler.FileInfo{
+		SizeIsDeferred: true,
+		IsFinal:        true,
+	})
+	a.NoError(err)
+
+	err = store.AsPartialAppendableUpload(upload).AppendPartialUploads(ctx, []string{"a", "b"})
+	a.NoError(err)
+	err = store.AsPartialAppendableUpload(upload).AppendPartialUploads(ctx, []string{"c"})
+	a.NoError(err)
+
+	info, err := upload.GetInfo(ctx)
+	a.NoError(err)
+
+	// The partial uploads must be persisted in the info file
+	upload, err = store.GetUpload(ctx, info.ID)
+	a.NoError(err)
+
+	updatedInfo, err := upload.GetInfo(ctx)
+	a.NoError(err)
+	a.Equal([]string{"a", "b", "c"}, updatedInfo.PartialUploads)
+}
+
+func TestRecordChecksum(t *testing.T) {
+	a := assert.New(t)
+
+	tmp, err := os.MkdirTemp("", "tusd-filestore-record-checksum-")
+	a.NoError(err)
+
+	store := FileStore{tmp}
+	ctx := context.Background()
+
+	upload, err := store.NewUpload(ctx, handler.FileInfo{
+		Size: 5,
+		Checksum: &handler.UploadChecksum{
+			Algorithm: "sha256",
+			Expected:  "k2oYXKqiZrucvpgengXLeM1zKwsygOuURBK7b4+PB68=",
+		},
+	})
+	a.NoError(err)
+
+	checksum := handler.UploadChecksum{
+		Algorithm: "sha256",
+		Expected:  "k2oYXKqiZrucvpgengXLeM1zKwsygOuURBK7b4+PB68=",
+		Actual:    "LPJNul+wow4m6DsqxbninhsWHlwfp0JecwQzYpOLmCQ=",
+		Verified:  false,
+	}
+	err = store.AsChecksumRecordableUpload(upload).RecordChecksum(ctx, checksum)
+	a.NoError(err)
+
+	info, err := upload.GetInfo(ctx)
+	a.NoError(err)
+
+	// The checksum must be persisted in the info file
+	upload, err = store.GetUpload(ctx, info.ID)
+	a.NoError(err)
+
+	updatedInfo, err := upload.GetInfo(ctx)
+	a.NoError(err)
+	a.Equal(&checksum, updatedInfo.Checksum)
+}
+
+func TestListUploads(t *testing.T) {
+	a := assert.New(t)
+
+	tmp, err := os.MkdirTemp("", "tusd-filestore-list-")
+	a.NoError(err)
+	defer os.RemoveAll(tmp)
+
+	store := FileStore{tmp}
+	ctx := context.Background()
+
+	for _, info := range []handler.FileInfo{
+		{ID: "finished", Size: 5},
+		{ID: "unfinished", Size: 10},
+		{ID: "deferred", SizeIsDeferred: true},
+	} {
+		upload, err := store.NewUpload(ctx, info)
+		a.NoError(err)
+		_, err = upload.WriteChunk(ctx, 0, strings.NewReader("hello"))
+		a.NoError(err)
+	}
+
+	ids, nextCursor, err := store.ListUploads(ctx, "")
+	a.NoError(err)
+	a.Equal([]string{"deferred", "unfinished"}, ids)
+	a.Equal("", nextCursor)
+
+	ids, nextCursor, err = store.ListUploads(ctx, "finished")
+	a.NoError(err)
+	a.Equal([]string{"unfinished"}, ids)
+	a.Equal("", nextCursor)
+}
+
+func TestConformance(t *testing.T) {
+	composer := handler.NewStoreComposer()
+	New(t.TempDir()).UseIn(composer)
+
+	storetest.Run(t, composer, storetest.Options{
+		LargeUploadSize: 32 * 1024 * 1024,
+	})
+}
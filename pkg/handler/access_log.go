@@ -0,0 +1,154 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+	"time"
+)
+
+// AccessRecord describes a request handled by the handler.
+type AccessRecord struct {
+	// Time is when the request was received.
+	Time time.Time
+	// Method is the request's method before X-HTTP-Method-Override is applied.
+	Method string
+	// URI is the request's URI as sent by the client.
+	URI string
+	// Proto is the request's protocol version, e.g. HTTP/1.1.
+	Proto string
+	// UploadID is the ID of the upload which the request targets or created.
+	// It is empty if the request does not target an upload.
+	UploadID string
+	// Status is the HTTP status code of the response.
+	Status int
+	// BytesReceived is the number of bytes read from the request body.
+	BytesReceived int64
+	// BytesSent is the number of bytes written to the response body.
+	BytesSent int64
+	// Duration is the time from receiving the request until the handler
+	// finished it.
+	Duration time.Duration
+	// StoreDuration is the time spent in the data store for creating, looking up
+	// and finishing the upload. The transfer of the upload's content is not
+	// included, since it is bound by the client's connection.
+	StoreDuration time.Duration
+	// RemoteAddr is the network address of the client.
+	RemoteAddr string
+	// ClientNetwork is the network of the client, which combines the addresses
+	// of IPv6 clients by their prefix, see ClientNetwork.
+	ClientNetwork string
+	// UserAgent is the value of the User-Agent header.
+	UserAgent string
+	// Referer is the value of the Referer header.
+	Referer string
+	// RequestID is the value of the X-Request-ID header.
+	RequestID string
+}
+
+// AccessLogger receives a record for every request after the handler has
+// finished it. LogAccess is called from the request's goroutine and should not
+// block for long.
+type AccessLogger interface {
+	LogAccess(record AccessRecord)
+}
+
+// accessLogWriter counts the bytes written to the response and remembers its
+// status code for the access log.
+type accessLogWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *accessLogWriter) WriteHeader(status int) {
+	// Informational responses, such as 104 Upload Resumption Supported, are
+	// followed by the final response, whose status is logged.
+	if w.status == 0 && (status < 100 || status >= 200) {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *accessLogWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// ReadFrom keeps the underlying writer's optimizations, such as sendfile, for
+// downloads.
+func (w *accessLogWriter) ReadFrom(src io.Reader) (int64, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	var n int64
+	var err error
+	if rf, ok := w.ResponseWriter.(io.ReaderFrom); ok {
+		n, err = rf.ReadFrom(src)
+	} else {
+		n, err = io.Copy(w.ResponseWriter, src)
+	}
+	w.bytes += n
+	return n, err
+}
+
+// Unwrap allows http.ResponseController to access the underlying writer.
+func (w *accessLogWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// logAccess passes a record for the finished request to Config.AccessLogger.
+func (handler *UnroutedHandler) logAccess(c *httpContext, w *accessLogWriter, method string, start time.Time) {
+	r := c.req
+
+	// Creation requests receive the upload's ID in the Location header.
+	id, _ := extractIDFromRequest(r)
+	if location := w.Header().Get("Location"); location != "" && (method == "POST" || id == "") {
+		id, _ = extractIDFromPath(location)
+	}
+
+	var bytesReceived int64
+	if c.body != nil {
+		bytesReceived = c.body.bytesRead()
+	}
+
+	handler.config.AccessLogger.LogAccess(AccessRecord{
+		Time:          start.UTC(),
+		Method:        method,
+		URI:           r.RequestURI,
+		Proto:         r.Proto,
+		UploadID:      id,
+		Status:        w.status,
+		BytesReceived: bytesReceived,
+		BytesSent:     w.bytes,
+		Duration:      time.Since(start),
+		StoreDuration: time.Duration(c.storeDuration.Load()),
+		RemoteAddr:    r.RemoteAddr,
+		ClientNetwork: ClientNetwork(r.Context()),
+		UserAgent:     r.UserAgent(),
+		Referer:       r.Referer(),
+		RequestID:     getRequestId(r),
+	})
+}
+
+// getUpload fetches the upload and its information from the data store. The
+// time spent is included in the access log.
+func (handler *UnroutedHandler) getUpload(c *httpContext, id string) (Upload, FileInfo, error) {
+	defer c.trackStore(time.Now())
+
+	upload, err := handler.composer.Core.GetUpload(c, id)
+	if err != nil {
+		return nil, FileInfo{}, err
+	}
+
+	info, err := upload.GetInfo(c)
+	if err != nil {
+		return nil, FileInfo{}, err
+	}
+
+	return upload, info, nil
+}
@@ -0,0 +1,99 @@
+package handler_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/tus/tusd/v2/pkg/handler"
+)
+
+type accessRecorder struct {
+	records []AccessRecord
+}
+
+func (r *accessRecorder) LogAccess(record AccessRecord) {
+	r.records = append(r.records, record)
+}
+
+func TestAccessLog(t *testing.T) {
+	SubTest(t, "Create", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().NewUpload(gomock.Any(), gomock.Any()).Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:   "foo",
+				Size: 300,
+			}, nil),
+		)
+
+		recorder := &accessRecorder{}
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+			BasePath:      "/files/",
+			AccessLogger:  recorder,
+		})
+
+		(&httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Upload-Length": "300",
+				"User-Agent":    "tus-js-client",
+			},
+			Code: http.StatusCreated,
+		}).Run(handler, t)
+
+		a := assert.New(t)
+		a.Len(recorder.records, 1)
+		record := recorder.records[0]
+		a.Equal("POST", record.Method)
+		a.Equal("foo", record.UploadID)
+		a.Equal(http.StatusCreated, record.Status)
+		a.Equal("tus-js-client", record.UserAgent)
+		a.Greater(record.Duration, record.StoreDuration)
+	})
+
+	SubTest(t, "Download", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				Offset: 5,
+				Size:   5,
+			}, nil),
+			upload.EXPECT().GetReader(gomock.Any()).Return(&closingStringReader{
+				Reader: strings.NewReader("hello"),
+			}, nil),
+		)
+
+		recorder := &accessRecorder{}
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+			AccessLogger:  recorder,
+		})
+
+		(&httpTest{
+			Method:  "GET",
+			URL:     "yes",
+			Code:    http.StatusOK,
+			ResBody: "hello",
+		}).Run(handler, t)
+
+		a := assert.New(t)
+		a.Len(recorder.records, 1)
+		record := recorder.records[0]
+		a.Equal("yes", record.UploadID)
+		a.Equal(http.StatusOK, record.Status)
+		a.Equal(int64(5), record.BytesSent)
+	})
+}
@@ -0,0 +1,24 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccessLogWriterStatus(t *testing.T) {
+	a := assert.New(t)
+
+	// Informational responses are followed by the final response.
+	w := &accessLogWriter{ResponseWriter: httptest.NewRecorder()}
+	w.WriteHeader(104)
+	w.WriteHeader(http.StatusCreated)
+	a.Equal(http.StatusCreated, w.status)
+
+	w = &accessLogWriter{ResponseWriter: httptest.NewRecorder()}
+	w.Write([]byte("hello"))
+	a.Equal(http.StatusOK, w.status)
+	a.Equal(int64(5), w.bytes)
+}
@@ -0,0 +1,234 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ActiveUpload describes an upload which is currently receiving data from a
+// client in a PATCH or POST request.
+type ActiveUpload struct {
+	// ID is the upload's identifier.
+	ID string
+	// Offset is the upload's offset when the request started plus the number
+	// of bytes received since then. It may be higher than the number of bytes
+	// which have been saved by the data store.
+	Offset int64
+	// Size is the upload's total size, if it is not deferred.
+	Size int64
+	// SizeIsDeferred indicates whether the upload's size is not yet known.
+	SizeIsDeferred bool
+	// BytesReceived is the number of bytes received in the current request.
+	BytesReceived int64
+	// StartedAt is the time at which the current request began transferring data.
+	StartedAt time.Time
+	// RemoteAddr is the network address of the client.
+	RemoteAddr string
+}
+
+// activeUploadRegistry keeps track of all requests which are currently
+// transferring data into an upload. It is safe for concurrent use.
+type activeUploadRegistry struct {
+	lock    sync.Mutex
+	entries map[*httpContext]activeUploadEntry
+}
+
+type activeUploadEntry struct {
+	info      FileInfo
+	startedAt time.Time
+}
+
+func newActiveUploadRegistry() *activeUploadRegistry {
+	return &activeUploadRegistry{
+		entries: make(map[*httpContext]activeUploadEntry),
+	}
+}
+
+func (r *activeUploadRegistry) add(c *httpContext, info FileInfo) {
+	r.lock.Lock()
+	r.entries[c] = activeUploadEntry{
+		info:      info,
+		startedAt: time.Now(),
+	}
+	r.lock.Unlock()
+}
+
+func (r *activeUploadRegistry) remove(c *httpContext) {
+	r.lock.Lock()
+	delete(r.entries, c)
+	r.lock.Unlock()
+}
+
+// interrupt cancels all requests which are currently writing to the upload
+// with the given ID using the provided cause.
+func (r *activeUploadRegistry) interrupt(id string, cause error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for c, entry := range r.entries {
+		if entry.info.ID == id {
+			c.cancel(cause)
+		}
+	}
+}
+
+func (r *activeUploadRegistry) list() []ActiveUpload {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	uploads := make([]ActiveUpload, 0, len(r.entries))
+	for c, entry := range r.entries {
+		received := c.body.bytesRead()
+		uploads = append(uploads, ActiveUpload{
+			ID:             entry.info.ID,
+			Offset:         entry.info.Offset + received,
+			Size:           entry.info.Size,
+			SizeIsDeferred: entry.info.SizeIsDeferred,
+			BytesReceived:  received,
+			StartedAt:      entry.startedAt,
+			RemoteAddr:     c.req.RemoteAddr,
+		})
+	}
+
+	return uploads
+}
+
+// ActiveUploads returns a snapshot of all uploads which are currently receiving
+// data. This can be used to monitor the ongoing transfers on this instance.
+func (handler *UnroutedHandler) ActiveUploads() []ActiveUpload {
+	return handler.activeUploads.list()
+}
+
+// TerminateUpload terminates the upload with the given ID from the server-side,
+// for example as part of an administrative action. If requests are currently
+// writing to the upload, they are interrupted before the upload is terminated.
+// The termination is announced on the TerminatedUploads channel, if enabled,
+// but the event does not contain details about an HTTP request.
+func (handler *UnroutedHandler) TerminateUpload(ctx context.Context, id string) error {
+	if !handler.composer.UsesTerminater {
+		return ErrNotImplemented
+	}
+
+	if handler.composer.UsesLocker {
+		// Acquiring the lock asks the requests currently holding it to stop.
+		lock, err := handler.acquireLock(ctx, id, func() {})
+		if err != nil {
+			return err
+		}
+		defer lock.Unlock()
+	} else {
+		// Without a locker, we have to interrupt the requests ourselves. Just
+		// like for DELETE requests, nothing prevents a new request from starting
+		// in the meantime in this case.
+		handler.activeUploads.interrupt(id, ErrUploadInterrupted)
+	}
+
+	upload, err := handler.composer.Core.GetUpload(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	// The info is only needed for the hooks and the upload index.
+	var info FileInfo
+	if handler.config.NotifyTerminatedUploads || handler.config.UploadIndex != nil {
+		info, err = upload.GetInfo(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	return handler.terminate(ctx, handler.logger.With("id", id), upload, HookEvent{
+		Context: ctx,
+		Upload:  info,
+	})
+}
+
+// TerminateUploadsByMetaData terminates all unfinished uploads whose metadata
+// contains every key-value pair of the given metadata, for example all uploads of
+// a user whose account has been closed. Requests which are currently writing to
+// these uploads are interrupted, just like for TerminateUpload. The IDs of the
+// terminated uploads are returned. This requires a data store implementing
+// ListableDataStore and TerminaterDataStore. Uploads which cannot be inspected
+// or terminated do not stop the process, but their errors are returned together.
+func (handler *UnroutedHandler) TerminateUploadsByMetaData(ctx context.Context, metaData MetaData) ([]string, error) {
+	if !handler.composer.UsesTerminater || !handler.composer.UsesLister {
+		return nil, ErrNotImplemented
+	}
+
+	// Without any criteria, every upload would match.
+	if len(metaData) == 0 {
+		return nil, errors.New("tusd: metadata for matching uploads must not be empty")
+	}
+
+	var terminated []string
+	var errs []error
+	cursor := ""
+	for {
+		ids, nextCursor, err := handler.composer.Lister.ListUploads(ctx, cursor)
+		if err != nil {
+			errs = append(errs, err)
+			break
+		}
+
+		for _, id := range ids {
+			matches, err := handler.uploadMatchesMetaData(ctx, id, metaData)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			if !matches {
+				continue
+			}
+
+			err = handler.TerminateUpload(ctx, id)
+			if errors.Is(err, ErrNotFound) {
+				// The upload has been removed in the meantime.
+				continue
+			}
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+
+			handler.logger.Info("UploadTerminatedByMetaData", "id", id)
+			terminated = append(terminated, id)
+		}
+
+		if nextCursor == "" {
+			break
+		}
+		cursor = nextCursor
+	}
+
+	return terminated, errors.Join(errs...)
+}
+
+// uploadMatchesMetaData checks whether the upload's metadata contains all given
+// key-value pairs. Uploads which have been removed in the meantime do not match.
+func (handler *UnroutedHandler) uploadMatchesMetaData(ctx context.Context, id string, metaData MetaData) (bool, error) {
+	upload, err := handler.composer.Core.GetUpload(ctx, id)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	info, err := upload.GetInfo(ctx)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	for key, value := range metaData {
+		if actual, ok := info.MetaData[key]; !ok || actual != value {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
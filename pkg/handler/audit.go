@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"time"
+)
+
+// AuditRecord describes a request which attempted to modify an upload.
+type AuditRecord struct {
+	// Time is when the response was sent.
+	Time time.Time
+	// Operation is the kind of modification, for example "create", "write",
+	// "part" or "terminate". Administrative actions use an "admin-" prefix.
+	Operation string
+	// UploadID is the ID of the affected upload. It is empty if the request
+	// was rejected before the upload could be identified.
+	UploadID string
+	// Status is the HTTP status code of the response.
+	Status int
+	// Bytes is the number of bytes read from the request body.
+	Bytes int64
+	// RemoteAddr is the network address of the client.
+	RemoteAddr string
+	// Actor contains the headers listed in Config.CaptureHeaders, which
+	// identify the user or tenant behind the request, for example.
+	Actor map[string]string
+}
+
+// AuditLogger receives a record for every request which attempts to modify an
+// upload. LogAudit is called after the response has been sent, from the
+// request's goroutine, and should not block for long.
+type AuditLogger interface {
+	LogAudit(record AuditRecord)
+}
+
+// auditOperations maps the methods of mutating requests to their operation.
+var auditOperations = map[string]string{
+	"POST":   "create",
+	"PATCH":  "write",
+	"DELETE": "terminate",
+}
+
+// logAudit passes a record for the request to Config.AuditLogger, if the
+// request attempts to modify an upload.
+func (handler *UnroutedHandler) logAudit(c *httpContext, resp HTTPResponse) {
+	if handler.config.AuditLogger == nil {
+		return
+	}
+
+	r := c.req
+	method := r.Method
+	if override := r.Header.Get("X-HTTP-Method-Override"); method == "POST" && override != "" {
+		method = override
+	}
+
+	operation, ok := auditOperations[method]
+	if !ok {
+		return
+	}
+
+	// The ID is part of the URL, except for creation requests, which receive
+	// it in the Location header.
+	id, _ := extractIDFromRequest(r)
+	if operation == "create" {
+		if id != "" {
+			operation = "part"
+		} else {
+			id, _ = extractIDFromPath(resp.Header["Location"])
+		}
+	}
+
+	var bytes int64
+	if c.body != nil {
+		bytes = c.body.bytesRead()
+	}
+
+	handler.config.AuditLogger.LogAudit(AuditRecord{
+		Time:       time.Now().UTC(),
+		Operation:  operation,
+		UploadID:   id,
+		Status:     resp.StatusCode,
+		Bytes:      bytes,
+		RemoteAddr: r.RemoteAddr,
+		Actor:      CapturedHeaders(c),
+	})
+}
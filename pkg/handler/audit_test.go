@@ -0,0 +1,110 @@
+package handler_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/tus/tusd/v2/pkg/handler"
+)
+
+type auditRecorder struct {
+	records []AuditRecord
+}
+
+func (r *auditRecorder) LogAudit(record AuditRecord) {
+	r.records = append(r.records, record)
+}
+
+func TestAudit(t *testing.T) {
+	SubTest(t, "Create", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().NewUpload(gomock.Any(), gomock.Any()).Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:   "foo",
+				Size: 300,
+			}, nil),
+		)
+
+		recorder := &auditRecorder{}
+		handler, _ := NewHandler(Config{
+			StoreComposer:  composer,
+			BasePath:       "/files/",
+			AuditLogger:    recorder,
+			CaptureHeaders: []string{"X-User-Id"},
+		})
+
+		(&httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Upload-Length": "300",
+				"X-User-Id":     "alice",
+			},
+			Code: http.StatusCreated,
+		}).Run(handler, t)
+
+		a := assert.New(t)
+		a.Len(recorder.records, 1)
+		record := recorder.records[0]
+		a.Equal("create", record.Operation)
+		a.Equal("foo", record.UploadID)
+		a.Equal(http.StatusCreated, record.Status)
+		a.Equal(map[string]string{"X-User-Id": "alice"}, record.Actor)
+	})
+
+	SubTest(t, "Write", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 5,
+				Size:   20,
+			}, nil),
+			upload.EXPECT().WriteChunk(gomock.Any(), int64(5), NewReaderMatcher("hello")).Return(int64(5), nil),
+		)
+
+		recorder := &auditRecorder{}
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+			AuditLogger:   recorder,
+		})
+
+		(&httpTest{
+			Method: "PATCH",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": "5",
+			},
+			ReqBody: strings.NewReader("hello"),
+			Code:    http.StatusNoContent,
+		}).Run(handler, t)
+
+		// Requests which do not modify uploads are not recorded.
+		(&httpTest{
+			Method: "OPTIONS",
+			Code:   http.StatusOK,
+		}).Run(handler, t)
+
+		a := assert.New(t)
+		a.Len(recorder.records, 1)
+		record := recorder.records[0]
+		a.Equal("write", record.Operation)
+		a.Equal("yes", record.UploadID)
+		a.Equal(http.StatusNoContent, record.Status)
+		a.Equal(int64(5), record.Bytes)
+	})
+}
@@ -2,13 +2,17 @@ package handler
 
 import (
 	"errors"
+	"hash"
 	"io"
 	"net"
 	"net/http"
 	"os"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
+
+	"github.com/tus/tusd/v2/internal/bufferpool"
 )
 
 // bodyReader is an io.Reader, which is intended to wrap the request
@@ -19,11 +23,24 @@ import (
 // the error but this can instead be done in the handler.
 // In addition, the bodyReader keeps track of how many bytes were read.
 type bodyReader struct {
-	ctx          *httpContext
-	reader       io.ReadCloser
+	ctx    *httpContext
+	reader io.ReadCloser
+	// err is guarded by errLock, since closeWithError may be called while the
+	// body is read.
 	err          error
+	errLock      sync.Mutex
 	bytesCounter int64
 	onReadDone   func()
+	// truncated is set if the client closed the request before sending the
+	// entire body.
+	truncated bool
+	// hash, if set, receives all data read from the body.
+	hash hash.Hash
+	// digest, if set, receives all data read from the body as well, see
+	// UploadChecksum.
+	digest hash.Hash
+	// sample, if set, receives the beginning of the data read from the body.
+	sample *sampleBuffer
 }
 
 func newBodyReader(c *httpContext, maxSize int64) *bodyReader {
@@ -35,12 +52,21 @@ func newBodyReader(c *httpContext, maxSize int64) *bodyReader {
 }
 
 func (r *bodyReader) Read(b []byte) (int, error) {
-	if r.err != nil {
+	if r.loadErr() != nil {
 		return 0, io.EOF
 	}
 
 	n, err := r.reader.Read(b)
 	atomic.AddInt64(&r.bytesCounter, int64(n))
+	if r.hash != nil {
+		r.hash.Write(b[:n])
+	}
+	if r.digest != nil {
+		r.digest.Write(b[:n])
+	}
+	if r.sample != nil {
+		r.sample.write(b[:n])
+	}
 	if !errors.Is(err, os.ErrDeadlineExceeded) {
 		// If the timeout wasn't exceeded (due to SetReadDeadline), invoke
 		// the callback so the deadline can be extended
@@ -57,6 +83,10 @@ func (r *bodyReader) Read(b []byte) (int, error) {
 		// In all of those cases, we do not forward the error to the storage,
 		// but act like the body just ended naturally.
 		if err == io.EOF || err == io.ErrClosedPipe || err == http.ErrBodyReadAfterClose || err == io.ErrUnexpectedEOF {
+			if err == io.ErrUnexpectedEOF {
+				r.truncated = true
+				r.clientDisconnected()
+			}
 			return n, io.EOF
 		}
 
@@ -65,6 +95,7 @@ func (r *bodyReader) Read(b []byte) (int, error) {
 		// which is unnecessary to be included in the response.
 		if strings.HasSuffix(err.Error(), "read: connection reset by peer") {
 			err = ErrConnectionReset
+			r.clientDisconnected()
 		}
 
 		// For timeouts, we also send a nicer response to the clients.
@@ -81,19 +112,49 @@ func (r *bodyReader) Read(b []byte) (int, error) {
 
 		// Other errors are stored for retrival with hasError, but is not returned
 		// to the consumer. We do not overwrite an error if it has been set already.
+		r.errLock.Lock()
 		if r.err == nil {
 			r.err = err
 		}
+		r.errLock.Unlock()
 	}
 
 	return n, nil
 }
 
-func (r bodyReader) hasError() error {
-	if r.err == io.EOF {
+// WriteTo implements io.WriterTo, so that io.Copy uses a pooled buffer when
+// reading the body instead of allocating a new one for every request. The
+// data is read using Read, so errors are handled in the same way.
+func (r *bodyReader) WriteTo(w io.Writer) (int64, error) {
+	buf := bufferpool.GetCopyBuffer()
+	defer bufferpool.PutCopyBuffer(buf)
+
+	return io.CopyBuffer(w, struct{ io.Reader }{r}, *buf)
+}
+
+// clientDisconnected cancels the request context with ErrClientDisconnected,
+// so that the data store can tell that no more data will arrive. The data
+// store's context is only cancelled after GracefulRequestCompletionTimeout,
+// which gives it time to save the data received up to this point.
+func (r *bodyReader) clientDisconnected() {
+	if r.ctx != nil && r.ctx.cancel != nil {
+		r.ctx.cancel(ErrClientDisconnected)
+	}
+}
+
+func (r *bodyReader) hasError() error {
+	err := r.loadErr()
+	if err == io.EOF {
 		return nil
 	}
 
+	return err
+}
+
+func (r *bodyReader) loadErr() error {
+	r.errLock.Lock()
+	defer r.errLock.Unlock()
+
 	return r.err
 }
 
@@ -102,7 +163,9 @@ func (r *bodyReader) bytesRead() int64 {
 }
 
 func (r *bodyReader) closeWithError(err error) {
+	r.errLock.Lock()
 	r.err = err
+	r.errLock.Unlock()
 
 	// SetReadDeadline with the current time causes concurrent reads to the body to time out,
 	// so the body will be closed sooner with less delay.
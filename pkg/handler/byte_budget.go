@@ -0,0 +1,167 @@
+package handler
+
+import (
+	"math"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ByteBudgetLimits are the numbers of bytes, which may be written to and read
+// from a bucket per calendar month. Written and read bytes are counted
+// together. A zero value disables the respective limit.
+type ByteBudgetLimits struct {
+	// Soft is the number of bytes, after which a ByteBudgetWarnings
+	// notification is sent once per month. Requests are not affected.
+	Soft int64
+	// Hard is the number of bytes, after which new uploads are rejected with
+	// ErrByteBudgetExceeded until the next month begins. Existing uploads can
+	// still be resumed and downloaded.
+	Hard int64
+}
+
+// ByteBudgetUsage describes the bytes transferred to and from a bucket in the
+// current month.
+type ByteBudgetUsage struct {
+	// Bucket is the name of the bucket, to which the budget applies.
+	Bucket string
+	// Month is the calendar month in UTC, e.g. 2024-03.
+	Month        string
+	BytesWritten int64
+	BytesRead    int64
+	SoftLimit    int64
+	HardLimit    int64
+}
+
+// ByteBudget counts the bytes written to and read from a bucket per calendar
+// month in UTC and enforces the ByteBudgetLimits. The counters are kept in
+// memory, so they start at zero whenever the process is started and only
+// include the traffic of this instance. A ByteBudget can be shared by multiple
+// handlers storing uploads in the same bucket.
+type ByteBudget struct {
+	bucket string
+	limits ByteBudgetLimits
+
+	lock    sync.Mutex
+	month   string
+	written int64
+	read    int64
+	warned  bool
+}
+
+// NewByteBudget creates a ByteBudget for the named bucket.
+func NewByteBudget(bucket string, limits ByteBudgetLimits) *ByteBudget {
+	return &ByteBudget{
+		bucket: bucket,
+		limits: limits,
+	}
+}
+
+// Usage returns the bytes transferred in the month containing now.
+func (b *ByteBudget) Usage(now time.Time) ByteBudgetUsage {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.rollOver(now)
+	return b.usage()
+}
+
+// add counts the transferred bytes. warn is true if the soft limit has been
+// exceeded by this call for the first time in the month.
+func (b *ByteBudget) add(now time.Time, written int64, read int64) (usage ByteBudgetUsage, warn bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.rollOver(now)
+	b.written += written
+	b.read += read
+
+	if b.limits.Soft > 0 && !b.warned && b.written+b.read >= b.limits.Soft {
+		b.warned = true
+		warn = true
+	}
+
+	return b.usage(), warn
+}
+
+// check returns ErrByteBudgetExceeded, including the Retry-After header
+// pointing to the next month, if the hard limit has been reached.
+func (b *ByteBudget) check(now time.Time) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.rollOver(now)
+	if b.limits.Hard <= 0 || b.written+b.read < b.limits.Hard {
+		return nil
+	}
+
+	now = now.UTC()
+	nextMonth := time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+
+	err := ErrByteBudgetExceeded
+	err.HTTPResponse = err.HTTPResponse.MergeWith(HTTPResponse{
+		Header: HTTPHeader{
+			"Retry-After": strconv.Itoa(int(math.Ceil(nextMonth.Sub(now).Seconds()))),
+		},
+	})
+	return err
+}
+
+// rollOver resets the counters if now lies in another month than the one
+// counted so far. The caller must hold the lock.
+func (b *ByteBudget) rollOver(now time.Time) {
+	month := now.UTC().Format("2006-01")
+	if month == b.month {
+		return
+	}
+
+	b.month = month
+	b.written = 0
+	b.read = 0
+	b.warned = false
+}
+
+// usage returns the current counters. The caller must hold the lock.
+func (b *ByteBudget) usage() ByteBudgetUsage {
+	return ByteBudgetUsage{
+		Bucket:       b.bucket,
+		Month:        b.month,
+		BytesWritten: b.written,
+		BytesRead:    b.read,
+		SoftLimit:    b.limits.Soft,
+		HardLimit:    b.limits.Hard,
+	}
+}
+
+// checkByteBudget returns ErrByteBudgetExceeded if new uploads are rejected
+// because the bucket's hard limit has been reached.
+func (handler *UnroutedHandler) checkByteBudget() error {
+	if handler.config.ByteBudget == nil {
+		return nil
+	}
+
+	return handler.config.ByteBudget.check(time.Now())
+}
+
+// recordByteBudget counts the bytes written to or read from the upload and
+// sends a notification on the ByteBudgetWarnings channel once the soft limit
+// has been exceeded.
+func (handler *UnroutedHandler) recordByteBudget(c *httpContext, info FileInfo, written int64, read int64) {
+	budget := handler.config.ByteBudget
+	if budget == nil || written+read <= 0 {
+		return
+	}
+
+	usage, warn := budget.add(time.Now(), written, read)
+	if !warn {
+		return
+	}
+
+	c.log.Warn("ByteBudgetSoftLimitExceeded", "bucket", usage.Bucket, "month", usage.Month, "bytesWritten", usage.BytesWritten, "bytesRead", usage.BytesRead, "softLimit", usage.SoftLimit)
+
+	if handler.config.NotifyByteBudgetWarnings {
+		event := newHookEvent(c, info)
+		event.ByteBudget = &usage
+		handler.ByteBudgetWarnings <- event
+	}
+}
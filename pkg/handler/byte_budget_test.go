@@ -0,0 +1,146 @@
+package handler_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/tus/tusd/v2/pkg/handler"
+)
+
+func TestByteBudget(t *testing.T) {
+	SubTest(t, "SoftLimitWarning", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil).Times(2)
+		gomock.InOrder(
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 0,
+				Size:   20,
+			}, nil),
+			upload.EXPECT().WriteChunk(gomock.Any(), int64(0), NewReaderMatcher("hello")).Return(int64(5), nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 5,
+				Size:   20,
+			}, nil),
+			upload.EXPECT().WriteChunk(gomock.Any(), int64(5), NewReaderMatcher("world")).Return(int64(5), nil),
+		)
+
+		budget := NewByteBudget("uploads", ByteBudgetLimits{Soft: 8})
+		handler, _ := NewHandler(Config{
+			StoreComposer:            composer,
+			ByteBudget:               budget,
+			NotifyByteBudgetWarnings: true,
+		})
+
+		c := make(chan HookEvent, 1)
+		handler.ByteBudgetWarnings = c
+
+		for i, body := range []string{"hello", "world"} {
+			(&httpTest{
+				Method: "PATCH",
+				URL:    "yes",
+				ReqHeader: map[string]string{
+					"Tus-Resumable": "1.0.0",
+					"Content-Type":  "application/offset+octet-stream",
+					"Upload-Offset": strconv.Itoa(i * 5),
+				},
+				ReqBody: strings.NewReader(body),
+				Code:    http.StatusNoContent,
+			}).Run(handler, t)
+		}
+
+		a := assert.New(t)
+		event := <-c
+		a.Equal("yes", event.Upload.ID)
+		a.Equal(&ByteBudgetUsage{
+			Bucket:       "uploads",
+			Month:        time.Now().UTC().Format("2006-01"),
+			BytesWritten: 10,
+			SoftLimit:    8,
+		}, event.ByteBudget)
+		a.Len(c, 0)
+	})
+
+	SubTest(t, "HardLimitRejectsCreation", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 0,
+				Size:   20,
+			}, nil),
+			upload.EXPECT().WriteChunk(gomock.Any(), int64(0), NewReaderMatcher("hello")).Return(int64(5), nil),
+			// Existing uploads can still be resumed.
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 5,
+				Size:   20,
+			}, nil),
+			upload.EXPECT().WriteChunk(gomock.Any(), int64(5), NewReaderMatcher("world")).Return(int64(5), nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+			BasePath:      "/files/",
+			ByteBudget:    NewByteBudget("uploads", ByteBudgetLimits{Hard: 5}),
+		})
+
+		for i, body := range []string{"hello", "world"} {
+			(&httpTest{
+				Method: "PATCH",
+				URL:    "yes",
+				ReqHeader: map[string]string{
+					"Tus-Resumable": "1.0.0",
+					"Content-Type":  "application/offset+octet-stream",
+					"Upload-Offset": strconv.Itoa(i * 5),
+				},
+				ReqBody: strings.NewReader(body),
+				Code:    http.StatusNoContent,
+			}).Run(handler, t)
+		}
+
+		req, _ := http.NewRequest("POST", "", nil)
+		req.Header.Set("Tus-Resumable", "1.0.0")
+		req.Header.Set("Upload-Length", "300")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		a := assert.New(t)
+		a.Equal(http.StatusTooManyRequests, w.Code)
+		a.NotEmpty(w.Header().Get("Retry-After"))
+		a.Contains(w.Body.String(), "ERR_BYTE_BUDGET_EXCEEDED")
+	})
+}
+
+func TestByteBudgetUsage(t *testing.T) {
+	a := assert.New(t)
+
+	budget := NewByteBudget("uploads", ByteBudgetLimits{Soft: 10, Hard: 20})
+	march := time.Date(2024, 3, 31, 23, 0, 0, 0, time.UTC)
+
+	usage := budget.Usage(march)
+	a.Equal("2024-03", usage.Month)
+	a.Zero(usage.BytesWritten)
+
+	// The counters start over with each month.
+	usage = budget.Usage(march.Add(2 * time.Hour))
+	a.Equal("2024-04", usage.Month)
+	a.Equal(int64(10), usage.SoftLimit)
+	a.Equal(int64(20), usage.HardLimit)
+}
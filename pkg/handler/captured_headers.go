@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// CapturedHeaderMetadataPrefix is prepended to the lower-cased header name when
+// captured headers are stored in the upload's metadata, e.g. "header-x-tenant-id".
+const CapturedHeaderMetadataPrefix = "header-"
+
+type capturedHeadersKey struct{}
+
+// CapturedHeaders returns the values of the headers listed in Config.CaptureHeaders,
+// which were included in the request associated with the context. The map is keyed
+// by the canonical header name. It can be used by data stores and hooks, which
+// receive the request's context, but not the request itself.
+func CapturedHeaders(ctx context.Context) map[string]string {
+	headers, _ := ctx.Value(capturedHeadersKey{}).(map[string]string)
+	return headers
+}
+
+// captureHeaders attaches the configured headers from the request to its context,
+// so they can be retrieved using CapturedHeaders.
+func (handler *UnroutedHandler) captureHeaders(r *http.Request) *http.Request {
+	if len(handler.config.CaptureHeaders) == 0 {
+		return r
+	}
+
+	headers := make(map[string]string, len(handler.config.CaptureHeaders))
+	for _, name := range handler.config.CaptureHeaders {
+		if value := r.Header.Get(name); value != "" {
+			headers[http.CanonicalHeaderKey(name)] = value
+		}
+	}
+
+	return r.WithContext(context.WithValue(r.Context(), capturedHeadersKey{}, headers))
+}
+
+// storeCapturedHeaders copies the captured headers of the creation request into
+// the metadata, if enabled. Values for the captured headers which have been
+// supplied by the client as metadata are removed, so that they cannot be spoofed.
+func (handler *UnroutedHandler) storeCapturedHeaders(c *httpContext, meta MetaData) {
+	if !handler.config.StoreCapturedHeaders {
+		return
+	}
+
+	captured := CapturedHeaders(c)
+	for _, name := range handler.config.CaptureHeaders {
+		key := CapturedHeaderMetadataPrefix + strings.ToLower(name)
+		delete(meta, key)
+
+		if value, ok := captured[http.CanonicalHeaderKey(name)]; ok {
+			meta[key] = value
+		}
+	}
+}
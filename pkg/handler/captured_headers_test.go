@@ -0,0 +1,123 @@
+package handler_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/tus/tusd/v2/pkg/handler"
+)
+
+func TestCapturedHeaders(t *testing.T) {
+	SubTest(t, "Capture", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		var storeHeaders map[string]string
+		gomock.InOrder(
+			store.EXPECT().NewUpload(gomock.Any(), FileInfo{
+				Size: 300,
+				MetaData: map[string]string{
+					"filename": "cat.jpg",
+				},
+			}).DoAndReturn(func(ctx context.Context, info FileInfo) (Upload, error) {
+				storeHeaders = CapturedHeaders(ctx)
+				return upload, nil
+			}),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:   "foo",
+				Size: 300,
+			}, nil),
+		)
+
+		var hookHeaders map[string]string
+		handler, _ := NewHandler(Config{
+			StoreComposer:  composer,
+			BasePath:       "/files/",
+			CaptureHeaders: []string{"x-tenant-id", "Authorization"},
+			PreUploadCreateCallback: func(hook HookEvent) (HTTPResponse, FileInfoChanges, error) {
+				hookHeaders = CapturedHeaders(hook.Context)
+				return HTTPResponse{}, FileInfoChanges{}, nil
+			},
+		})
+
+		(&httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable":   "1.0.0",
+				"Upload-Length":   "300",
+				"Upload-Metadata": "filename Y2F0LmpwZw==",
+				"X-Tenant-Id":     "acme",
+			},
+			Code: http.StatusCreated,
+		}).Run(handler, t)
+
+		a := assert.New(t)
+		a.Equal(map[string]string{"X-Tenant-Id": "acme"}, hookHeaders)
+		a.Equal(map[string]string{"X-Tenant-Id": "acme"}, storeHeaders)
+	})
+
+	SubTest(t, "Store", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			// The value of the header is stored in the metadata
+			store.EXPECT().NewUpload(gomock.Any(), FileInfo{
+				Size: 300,
+				MetaData: map[string]string{
+					"filename":           "cat.jpg",
+					"header-x-tenant-id": "acme",
+				},
+			}).Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:   "foo",
+				Size: 300,
+			}, nil),
+			// A value supplied by the client in the metadata must be removed
+			store.EXPECT().NewUpload(gomock.Any(), FileInfo{
+				Size: 300,
+				MetaData: map[string]string{
+					"filename": "cat.jpg",
+				},
+			}).Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:   "bar",
+				Size: 300,
+			}, nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:        composer,
+			BasePath:             "/files/",
+			CaptureHeaders:       []string{"X-Tenant-Id"},
+			StoreCapturedHeaders: true,
+		})
+
+		(&httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable":   "1.0.0",
+				"Upload-Length":   "300",
+				"Upload-Metadata": "filename Y2F0LmpwZw==",
+				"X-Tenant-Id":     "acme",
+			},
+			Code: http.StatusCreated,
+		}).Run(handler, t)
+
+		(&httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable":   "1.0.0",
+				"Upload-Length":   "300",
+				"Upload-Metadata": "filename Y2F0LmpwZw==,header-x-tenant-id b3RoZXI=",
+			},
+			Code: http.StatusCreated,
+		}).Run(handler, t)
+	})
+}
@@ -0,0 +1,163 @@
+package handler
+
+import (
+	"context"
+	"time"
+)
+
+// checkpointVersion is the version of the UploadCheckpoint format.
+const checkpointVersion = 1
+
+// UploadCheckpoint is the state of an upload, which is exported from one tusd
+// deployment and imported into another one using the same storage backend,
+// for example when switching between clusters in a blue/green deployment.
+type UploadCheckpoint struct {
+	// Version is the version of the checkpoint format.
+	Version int
+	// Info is the upload's information as returned by the data store.
+	Info FileInfo
+	// Parts are the parts, which have been committed to the storage backend at
+	// the time of the export. It is only set if the data store implements
+	// InspectorDataStore.
+	Parts []InspectedPart `json:",omitempty"`
+	// StagedBytes is the number of bytes, which have been received but not yet
+	// committed as a part, see UploadInspection.
+	StagedBytes int64
+	// ExportedAt is the time at which the checkpoint has been created.
+	ExportedAt time.Time
+}
+
+// ExportUpload returns a checkpoint for the upload with the given ID, which can
+// be passed to ImportUpload of another handler using the same storage backend.
+// The upload is not locked, so the checkpoint should only be created once
+// clients have stopped writing to the upload on this deployment, e.g. because
+// traffic has been switched to the other one.
+func (handler *UnroutedHandler) ExportUpload(ctx context.Context, id string) (UploadCheckpoint, error) {
+	upload, err := handler.composer.Core.GetUpload(ctx, id)
+	if err != nil {
+		return UploadCheckpoint{}, err
+	}
+
+	info, err := upload.GetInfo(ctx)
+	if err != nil {
+		return UploadCheckpoint{}, err
+	}
+
+	checkpoint := UploadCheckpoint{
+		Version:    checkpointVersion,
+		Info:       info,
+		ExportedAt: time.Now().UTC(),
+	}
+
+	if handler.composer.UsesInspector {
+		inspection, err := handler.composer.Inspector.AsInspectableUpload(upload).Inspect(ctx)
+		if err != nil {
+			return UploadCheckpoint{}, err
+		}
+
+		checkpoint.Parts = inspection.Parts
+		checkpoint.StagedBytes = inspection.StagedBytes
+	}
+
+	return checkpoint, nil
+}
+
+// ImportUpload makes the upload from a checkpoint, which has been created by
+// ExportUpload of another deployment, available in this handler, so that
+// clients can resume it here using the same ID. This requires a data store
+// implementing ImporterDataStore. ErrInvalidCheckpoint is returned if the
+// storage does not contain the data recorded in the checkpoint, e.g. because
+// the parts have been removed in the meantime. If an upload index is
+// configured, the upload is added to it, without any tags.
+func (handler *UnroutedHandler) ImportUpload(ctx context.Context, checkpoint UploadCheckpoint) (FileInfo, error) {
+	if !handler.composer.UsesImporter {
+		return FileInfo{}, ErrNotImplemented
+	}
+
+	if checkpoint.Version != checkpointVersion || checkpoint.Info.ID == "" {
+		return FileInfo{}, ErrInvalidCheckpoint
+	}
+
+	id := checkpoint.Info.ID
+	if handler.composer.UsesLocker {
+		lock, err := handler.acquireLock(ctx, id, func() {})
+		if err != nil {
+			return FileInfo{}, err
+		}
+		defer lock.Unlock()
+	}
+
+	upload, err := handler.composer.Importer.ImportUpload(ctx, checkpoint.Info)
+	if err != nil {
+		return FileInfo{}, err
+	}
+
+	info, err := upload.GetInfo(ctx)
+	if err != nil {
+		return FileInfo{}, err
+	}
+
+	// The upload may have received more data after the export, but none of the
+	// exported data may be missing.
+	if info.ID != id || info.Offset < checkpoint.Info.Offset {
+		return FileInfo{}, ErrInvalidCheckpoint
+	}
+
+	if handler.composer.UsesInspector && len(checkpoint.Parts) > 0 {
+		inspection, err := handler.composer.Inspector.AsInspectableUpload(upload).Inspect(ctx)
+		if err != nil {
+			return FileInfo{}, err
+		}
+
+		if !containsParts(inspection.Parts, checkpoint.Parts) {
+			return FileInfo{}, ErrInvalidCheckpoint
+		}
+	}
+
+	if handler.config.UploadIndex != nil {
+		now := time.Now().UTC()
+		state := UploadStateInProgress
+		if !info.SizeIsDeferred && info.Offset == info.Size {
+			state = UploadStateFinished
+		}
+
+		err := handler.config.UploadIndex.AddUpload(ctx, IndexEntry{
+			ID:        info.ID,
+			Size:      info.Size,
+			Offset:    info.Offset,
+			MetaData:  info.MetaData,
+			State:     state,
+			CreatedAt: now,
+			UpdatedAt: now,
+			ExpiresAt: indexedExpiration(info),
+		})
+		if err != nil {
+			handler.logger.Warn("UploadIndexError", "id", info.ID, "error", err)
+		}
+	}
+
+	handler.logger.Info("UploadImported", "id", info.ID, "offset", info.Offset, "exportedAt", checkpoint.ExportedAt)
+
+	return info, nil
+}
+
+// containsParts reports whether every expected part is contained in parts with
+// the same offset, size and, if known on both sides, entity tag.
+func containsParts(parts []InspectedPart, expected []InspectedPart) bool {
+	byNumber := make(map[int64]InspectedPart, len(parts))
+	for _, part := range parts {
+		byNumber[part.Number] = part
+	}
+
+	for _, want := range expected {
+		got, ok := byNumber[want.Number]
+		if !ok || got.Offset != want.Offset || got.Size != want.Size {
+			return false
+		}
+		if got.ETag != "" && want.ETag != "" && got.ETag != want.ETag {
+			return false
+		}
+	}
+
+	return true
+}
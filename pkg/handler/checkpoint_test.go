@@ -0,0 +1,132 @@
+package handler_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/tus/tusd/v2/pkg/handler"
+)
+
+func TestCheckpoint(t *testing.T) {
+	info := FileInfo{
+		ID:     "yes",
+		Offset: 120,
+		Size:   500,
+	}
+	inspection := UploadInspection{
+		Parts: []InspectedPart{
+			{Number: 1, Offset: 0, Size: 100, ETag: "a"},
+		},
+		StagedBytes: 20,
+	}
+
+	SubTest(t, "ExportImport", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(info, nil),
+			store.EXPECT().AsInspectableUpload(upload).Return(upload),
+			upload.EXPECT().Inspect(gomock.Any()).Return(inspection, nil),
+			store.EXPECT().ImportUpload(gomock.Any(), info).Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(info, nil),
+			store.EXPECT().AsInspectableUpload(upload).Return(upload),
+			upload.EXPECT().Inspect(gomock.Any()).Return(inspection, nil),
+		)
+
+		composer.UseInspector(store)
+		composer.UseImporter(store)
+		index := NewMemoryUploadIndex()
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+			UploadIndex:   index,
+		})
+
+		a := assert.New(t)
+		checkpoint, err := handler.ExportUpload(context.Background(), "yes")
+		a.NoError(err)
+		a.Equal(1, checkpoint.Version)
+		a.Equal(info, checkpoint.Info)
+		a.Equal(inspection.Parts, checkpoint.Parts)
+		a.EqualValues(20, checkpoint.StagedBytes)
+
+		imported, err := handler.ImportUpload(context.Background(), checkpoint)
+		a.NoError(err)
+		a.Equal(info, imported)
+
+		entries, _, err := index.SearchUploads(context.Background(), IndexQuery{})
+		a.NoError(err)
+		a.Equal(1, len(entries))
+		a.Equal("yes", entries[0].ID)
+	})
+
+	SubTest(t, "MissingPart", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().ImportUpload(gomock.Any(), info).Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(info, nil),
+			store.EXPECT().AsInspectableUpload(upload).Return(upload),
+			// The part has been replaced with different data since the export.
+			upload.EXPECT().Inspect(gomock.Any()).Return(UploadInspection{
+				Parts: []InspectedPart{
+					{Number: 1, Offset: 0, Size: 100, ETag: "b"},
+				},
+			}, nil),
+		)
+
+		composer.UseInspector(store)
+		composer.UseImporter(store)
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+		})
+
+		_, err := handler.ImportUpload(context.Background(), UploadCheckpoint{
+			Version: 1,
+			Info:    info,
+			Parts:   inspection.Parts,
+		})
+		assert.Equal(t, ErrInvalidCheckpoint, err)
+	})
+
+	SubTest(t, "MissingData", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().ImportUpload(gomock.Any(), info).Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{ID: "yes", Offset: 100, Size: 500}, nil),
+		)
+
+		composer.UseImporter(store)
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+		})
+
+		_, err := handler.ImportUpload(context.Background(), UploadCheckpoint{
+			Version: 1,
+			Info:    info,
+		})
+		assert.Equal(t, ErrInvalidCheckpoint, err)
+	})
+
+	SubTest(t, "NotImplemented", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+		})
+
+		_, err := handler.ImportUpload(context.Background(), UploadCheckpoint{
+			Version: 1,
+			Info:    info,
+		})
+		assert.Equal(t, ErrNotImplemented, err)
+	})
+}
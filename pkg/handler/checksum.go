@@ -0,0 +1,249 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding"
+	"encoding/base64"
+	"hash"
+	"io"
+	"strings"
+	"sync"
+)
+
+// StatusChecksumMismatch is the status code defined by the checksum extension
+// of the tus protocol for data not matching its checksum. It is returned if an
+// upload does not match the checksum declared in Config.ChecksumMetadataKey.
+const StatusChecksumMismatch = 460
+
+// checksumAlgorithms contains the algorithms, which clients can use for the
+// checksum of the whole file.
+var checksumAlgorithms = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// UploadChecksum is the checksum of the whole file, which the client declared
+// when creating the upload, see Config.ChecksumMetadataKey.
+type UploadChecksum struct {
+	// Algorithm is the hash algorithm, e.g. sha256.
+	Algorithm string
+	// Expected is the base64-encoded checksum declared by the client.
+	Expected string
+	// Actual is the base64-encoded checksum of the received data. It is only
+	// set once the upload has been completed.
+	Actual string `json:",omitempty"`
+	// Verified indicates whether Actual matches Expected.
+	Verified bool
+}
+
+// checksumFromMetadata returns the checksum declared by the client in the
+// metadata key Config.ChecksumMetadataKey, formatted like the Upload-Checksum
+// header, e.g. "sha256 LCa0a2j/xo/5m0U8HTBBNBNCLXBkg7+g+YpeiGJm564=". It is
+// nil if the key is not configured or not included in the metadata.
+func (handler *UnroutedHandler) checksumFromMetadata(meta MetaData) (*UploadChecksum, error) {
+	if handler.config.ChecksumMetadataKey == "" {
+		return nil, nil
+	}
+
+	value, ok := meta[handler.config.ChecksumMetadataKey]
+	if !ok {
+		return nil, nil
+	}
+
+	algorithm, expected, ok := strings.Cut(value, " ")
+	if _, supported := checksumAlgorithms[algorithm]; !ok || !supported {
+		return nil, ErrInvalidChecksum
+	}
+
+	sum, err := base64.StdEncoding.DecodeString(expected)
+	if err != nil || len(sum) != checksumAlgorithms[algorithm]().Size() {
+		return nil, ErrInvalidChecksum
+	}
+
+	return &UploadChecksum{
+		Algorithm: algorithm,
+		Expected:  expected,
+	}, nil
+}
+
+// uploadDigest is the state of the hash over the data of an upload, which has
+// been written so far.
+type uploadDigest struct {
+	offset int64
+	state  []byte
+}
+
+// digestRegistry keeps the digests of the uploads with a declared checksum,
+// so that the data does not have to be read again for verifying the checksum.
+// The digests are only kept in memory. If an upload is resumed on another
+// instance or after a restart, its data is read again once it is complete.
+type digestRegistry struct {
+	lock    sync.Mutex
+	digests map[string]uploadDigest
+}
+
+func newDigestRegistry() *digestRegistry {
+	return &digestRegistry{
+		digests: make(map[string]uploadDigest),
+	}
+}
+
+// resume returns a hash containing the data of the upload up to offset, or nil
+// if its digest is unknown.
+func (registry *digestRegistry) resume(id string, algorithm string, offset int64) hash.Hash {
+	registry.lock.Lock()
+	digest, ok := registry.digests[id]
+	registry.lock.Unlock()
+
+	h := checksumAlgorithms[algorithm]()
+	if !ok {
+		if offset == 0 {
+			return h
+		}
+		return nil
+	}
+
+	if digest.offset != offset {
+		return nil
+	}
+	if err := h.(encoding.BinaryUnmarshaler).UnmarshalBinary(digest.state); err != nil {
+		return nil
+	}
+	return h
+}
+
+// save records h as the digest of the upload's data up to offset.
+func (registry *digestRegistry) save(id string, offset int64, h hash.Hash) {
+	state, err := h.(encoding.BinaryMarshaler).MarshalBinary()
+
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+
+	if err != nil {
+		delete(registry.digests, id)
+		return
+	}
+	registry.digests[id] = uploadDigest{
+		offset: offset,
+		state:  state,
+	}
+}
+
+// remove forgets the digest of the upload.
+func (registry *digestRegistry) remove(id string) {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+
+	delete(registry.digests, id)
+}
+
+// startDigest makes the request's body feed the digest of the upload, if it
+// has a declared checksum and its digest up to the offset is known.
+func (handler *UnroutedHandler) startDigest(c *httpContext, info FileInfo) {
+	if info.Checksum == nil {
+		return
+	}
+
+	c.body.digest = handler.digests.resume(info.ID, info.Checksum.Algorithm, info.Offset)
+}
+
+// saveDigest records the digest of the upload after bytesWritten bytes have
+// been written at offset. If the store did not write exactly the data read
+// from the body, the digest is discarded.
+func (handler *UnroutedHandler) saveDigest(c *httpContext, info FileInfo, offset int64, bytesWritten int64) {
+	if info.Checksum == nil {
+		return
+	}
+
+	if c.body.digest == nil || bytesWritten != c.body.bytesRead() {
+		if bytesWritten > 0 {
+			handler.digests.remove(info.ID)
+		}
+		return
+	}
+
+	handler.digests.save(info.ID, offset+bytesWritten, c.body.digest)
+}
+
+// uploadDigest returns the digest of the complete upload's data, or nil if it
+// has no declared checksum or its digest is unknown.
+func (handler *UnroutedHandler) uploadDigest(info FileInfo) hash.Hash {
+	if info.Checksum == nil {
+		return nil
+	}
+
+	return handler.digests.resume(info.ID, info.Checksum.Algorithm, info.Size)
+}
+
+// verifyChecksum compares the data of the completed upload with the checksum
+// declared by the client and records the result in info.Checksum. h is the
+// digest of the upload's data. If it is nil, the data is read from the data
+// store.
+func (handler *UnroutedHandler) verifyChecksum(c *httpContext, upload Upload, info *FileInfo, h hash.Hash) error {
+	if info.Checksum == nil {
+		return nil
+	}
+	defer handler.digests.remove(info.ID)
+
+	if h == nil {
+		c.log.Info("ChecksumRecomputed", "algorithm", info.Checksum.Algorithm)
+
+		h = checksumAlgorithms[info.Checksum.Algorithm]()
+		reader, err := upload.GetReader(c)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(h, reader)
+		reader.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	expected, _ := base64.StdEncoding.DecodeString(info.Checksum.Expected)
+	actual := h.Sum(nil)
+
+	checksum := *info.Checksum
+	checksum.Actual = base64.StdEncoding.EncodeToString(actual)
+	checksum.Verified = bytes.Equal(expected, actual)
+	info.Checksum = &checksum
+
+	if err := handler.recordChecksum(c, upload, *info); err != nil {
+		return err
+	}
+
+	if !checksum.Verified {
+		c.log.Warn("ChecksumMismatch", "algorithm", checksum.Algorithm, "expected", checksum.Expected, "actual", checksum.Actual)
+		return ErrChecksumMismatch
+	}
+
+	c.log.Info("ChecksumVerified", "algorithm", checksum.Algorithm)
+	return nil
+}
+
+// recordChecksum persists the result of verifying the upload's checksum, so
+// that requests retrying to complete an upload, which does not match its
+// checksum, fail as well. If the data store cannot record it, such uploads are
+// terminated instead, if possible.
+func (handler *UnroutedHandler) recordChecksum(c *httpContext, upload Upload, info FileInfo) error {
+	if handler.composer.UsesChecksumRecorder {
+		return handler.composer.ChecksumRecorder.AsChecksumRecordableUpload(upload).RecordChecksum(c, *info.Checksum)
+	}
+
+	if !info.Checksum.Verified && handler.composer.UsesTerminater {
+		return handler.terminateUpload(c, upload, info)
+	}
+	return nil
+}
+
+// checksumMismatched reports whether the upload has been completed, but did not
+// match its checksum.
+func checksumMismatched(info FileInfo) bool {
+	return info.Checksum != nil && info.Checksum.Actual != "" && !info.Checksum.Verified
+}
@@ -0,0 +1,295 @@
+package handler_test
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/tus/tusd/v2/pkg/handler"
+)
+
+func TestChecksum(t *testing.T) {
+	// Checksums of "hello" and "helloworld".
+	helloSum := "LPJNul+wow4m6DsqxbninhsWHlwfp0JecwQzYpOLmCQ="
+	helloWorldSum := "k2oYXKqiZrucvpgengXLeM1zKwsygOuURBK7b4+PB68="
+
+	SubTest(t, "Create", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().NewUpload(gomock.Any(), FileInfo{
+				Size: 5,
+				MetaData: map[string]string{
+					"checksum": "sha256 " + helloSum,
+				},
+				Checksum: &UploadChecksum{
+					Algorithm: "sha256",
+					Expected:  helloSum,
+				},
+			}).Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:   "foo",
+				Size: 5,
+			}, nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:       composer,
+			BasePath:            "/files/",
+			ChecksumMetadataKey: "checksum",
+		})
+
+		(&httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Upload-Length": "5",
+				// Base64 of "sha256 LPJNul+wow4m6DsqxbninhsWHlwfp0JecwQzYpOLmCQ="
+				"Upload-Metadata": "checksum c2hhMjU2IExQSk51bCt3b3c0bTZEc3F4Ym5pbmhzV0hsd2ZwMEplY3dRellwT0xtQ1E9",
+			},
+			Code: http.StatusCreated,
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "InvalidChecksum", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		handler, _ := NewHandler(Config{
+			StoreComposer:       composer,
+			BasePath:            "/files/",
+			ChecksumMetadataKey: "checksum",
+		})
+
+		(&httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Upload-Length": "5",
+				// Base64 of "sha256 x"
+				"Upload-Metadata": "checksum c2hhMjU2IHg=",
+			},
+			Code: http.StatusBadRequest,
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "Verified", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		composer.UseChecksumRecorder(store)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 0,
+				Size:   5,
+				Checksum: &UploadChecksum{
+					Algorithm: "sha256",
+					Expected:  helloSum,
+				},
+			}, nil),
+			upload.EXPECT().WriteChunk(gomock.Any(), int64(0), NewReaderMatcher("hello")).Return(int64(5), nil),
+			// The checksum is verified and recorded before the upload is finished.
+			store.EXPECT().AsChecksumRecordableUpload(upload).Return(upload),
+			upload.EXPECT().RecordChecksum(gomock.Any(), UploadChecksum{
+				Algorithm: "sha256",
+				Expected:  helloSum,
+				Actual:    helloSum,
+				Verified:  true,
+			}),
+			upload.EXPECT().FinishUpload(gomock.Any()),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:         composer,
+			ChecksumMetadataKey:   "checksum",
+			NotifyCompleteUploads: true,
+		})
+
+		c := make(chan HookEvent, 1)
+		handler.CompleteUploads = c
+
+		(&httpTest{
+			Method: "PATCH",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": "0",
+			},
+			ReqBody: strings.NewReader("hello"),
+			Code:    http.StatusNoContent,
+		}).Run(handler, t)
+
+		event := <-c
+		assert.Equal(t, &UploadChecksum{
+			Algorithm: "sha256",
+			Expected:  helloSum,
+			Actual:    helloSum,
+			Verified:  true,
+		}, event.Upload.Checksum)
+	})
+
+	SubTest(t, "Mismatch", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		composer.UseChecksumRecorder(store)
+
+		mismatch := UploadChecksum{
+			Algorithm: "sha256",
+			Expected:  helloWorldSum,
+			Actual:    helloSum,
+			Verified:  false,
+		}
+
+		// The upload is not finished and the result is recorded, so that a
+		// retried request fails as well.
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 0,
+				Size:   5,
+				Checksum: &UploadChecksum{
+					Algorithm: "sha256",
+					Expected:  helloWorldSum,
+				},
+			}, nil),
+			upload.EXPECT().WriteChunk(gomock.Any(), int64(0), NewReaderMatcher("hello")).Return(int64(5), nil),
+			store.EXPECT().AsChecksumRecordableUpload(upload).Return(upload),
+			upload.EXPECT().RecordChecksum(gomock.Any(), mismatch),
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:       "yes",
+				Offset:   5,
+				Size:     5,
+				Checksum: &mismatch,
+			}, nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:         composer,
+			ChecksumMetadataKey:   "checksum",
+			NotifyCompleteUploads: true,
+		})
+
+		c := make(chan HookEvent, 1)
+		handler.CompleteUploads = c
+
+		(&httpTest{
+			Method: "PATCH",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": "0",
+			},
+			ReqBody: strings.NewReader("hello"),
+			Code:    StatusChecksumMismatch,
+		}).Run(handler, t)
+
+		(&httpTest{
+			Method: "PATCH",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": "5",
+			},
+			ReqBody: strings.NewReader(""),
+			Code:    StatusChecksumMismatch,
+		}).Run(handler, t)
+
+		// The upload is not reported as finished.
+		assert.Len(t, c, 0)
+	})
+
+	SubTest(t, "MismatchTerminated", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		// Without a checksum recorder, the upload is terminated instead.
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 0,
+				Size:   5,
+				Checksum: &UploadChecksum{
+					Algorithm: "sha256",
+					Expected:  helloWorldSum,
+				},
+			}, nil),
+			upload.EXPECT().WriteChunk(gomock.Any(), int64(0), NewReaderMatcher("hello")).Return(int64(5), nil),
+			store.EXPECT().AsTerminatableUpload(upload).Return(upload),
+			upload.EXPECT().Terminate(gomock.Any()),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:       composer,
+			ChecksumMetadataKey: "checksum",
+		})
+
+		(&httpTest{
+			Method: "PATCH",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": "0",
+			},
+			ReqBody: strings.NewReader("hello"),
+			Code:    StatusChecksumMismatch,
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "Recomputed", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		// The first half of the upload has been received by another instance,
+		// so the data is read again once the upload is complete.
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 5,
+				Size:   10,
+				Checksum: &UploadChecksum{
+					Algorithm: "sha256",
+					Expected:  helloWorldSum,
+				},
+			}, nil),
+			upload.EXPECT().WriteChunk(gomock.Any(), int64(5), NewReaderMatcher("world")).Return(int64(5), nil),
+			upload.EXPECT().FinishUpload(gomock.Any()),
+			upload.EXPECT().GetReader(gomock.Any()).Return(io.NopCloser(strings.NewReader("helloworld")), nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:       composer,
+			ChecksumMetadataKey: "checksum",
+		})
+
+		(&httpTest{
+			Method: "PATCH",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": "5",
+			},
+			ReqBody: strings.NewReader("world"),
+			Code:    http.StatusNoContent,
+		}).Run(handler, t)
+	})
+}
@@ -0,0 +1,17 @@
+package handler
+
+import (
+	"strconv"
+)
+
+// setChunkSizeHint adds the Upload-Preferred-Chunk-Size header to the response,
+// if the data store prefers a certain chunk size for the upload.
+func (handler *UnroutedHandler) setChunkSizeHint(resp HTTPResponse, info FileInfo) {
+	if !handler.composer.UsesChunkSizeHinter {
+		return
+	}
+
+	if size := handler.composer.ChunkSizeHinter.PreferredChunkSize(info); size > 0 {
+		resp.Header["Upload-Preferred-Chunk-Size"] = strconv.FormatInt(size, 10)
+	}
+}
@@ -0,0 +1,48 @@
+package handler_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	. "github.com/tus/tusd/v2/pkg/handler"
+)
+
+func TestChunkSize(t *testing.T) {
+	SubTest(t, "Hint", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		info := FileInfo{
+			ID:     "yes",
+			Offset: 5,
+			Size:   100,
+		}
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(info, nil),
+			store.EXPECT().PreferredChunkSize(info).Return(int64(50)),
+		)
+
+		composer.UseChunkSizeHinter(store)
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+		})
+
+		(&httpTest{
+			Method: "HEAD",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+			},
+			Code: http.StatusOK,
+			ResHeader: map[string]string{
+				"Upload-Offset":               "5",
+				"Upload-Preferred-Chunk-Size": "50",
+			},
+		}).Run(handler, t)
+	})
+}
@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+type clientNetworkKey struct{}
+
+// ClientNetwork returns the network of the client, which sent the request
+// associated with the context. For IPv4 clients, it is their address, e.g.
+// 203.0.113.7. For IPv6 clients, it is the prefix of their address with the
+// length of Config.IPv6PrefixLength, e.g. 2001:db8:1:2::/64, so that all
+// addresses a client can choose from are treated as one client. It can be used
+// by middlewares to limit or account the requests of clients. If the address
+// is not known, an empty string is returned.
+func ClientNetwork(ctx context.Context) string {
+	network, _ := ctx.Value(clientNetworkKey{}).(string)
+	return network
+}
+
+// captureClientNetwork attaches the network of the client to the request's
+// context, so it can be retrieved using ClientNetwork.
+func (handler *UnroutedHandler) captureClientNetwork(r *http.Request) *http.Request {
+	network := clientNetwork(clientIP(r, handler.config.RespectForwardedHeaders), handler.config.IPv6PrefixLength)
+	if network == "" {
+		return r
+	}
+
+	return r.WithContext(context.WithValue(r.Context(), clientNetworkKey{}, network))
+}
+
+// clientNetwork returns the network of the client with the given IP address.
+// IPv4 addresses, including IPv4-mapped IPv6 addresses, are returned as they
+// are, while IPv6 addresses are reduced to their prefix of the given length.
+// Addresses which cannot be parsed are returned unchanged.
+func clientNetwork(ip string, ipv6PrefixLength int) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ip
+	}
+
+	addr = addr.Unmap().WithZone("")
+	if addr.Is4() || ipv6PrefixLength >= 128 {
+		return addr.String()
+	}
+
+	prefix, err := addr.Prefix(ipv6PrefixLength)
+	if err != nil {
+		return addr.String()
+	}
+
+	return prefix.String()
+}
+
+// clientIP returns the IP address of the client, which sent the request. If
+// respectForwardedHeaders is set, the first address in the X-Forwarded-For
+// header is preferred.
+func clientIP(r *http.Request, respectForwardedHeaders bool) string {
+	if respectForwardedHeaders {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			first, _, _ := strings.Cut(forwarded, ",")
+			return strings.TrimSpace(first)
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
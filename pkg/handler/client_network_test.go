@@ -0,0 +1,21 @@
+package handler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientNetwork(t *testing.T) {
+	a := assert.New(t)
+
+	a.Equal("203.0.113.7", clientNetwork("203.0.113.7", 64))
+	a.Equal("203.0.113.7", clientNetwork("::ffff:203.0.113.7", 64))
+	a.Equal("2001:db8:1:2::/64", clientNetwork("2001:db8:1:2:3:4:5:6", 64))
+	a.Equal("2001:db8:1:2::/64", clientNetwork("2001:db8:1:2:ffff::1", 64))
+	a.Equal("2001:db8::/48", clientNetwork("2001:db8:0:2:3:4:5:6", 48))
+	a.Equal("2001:db8:1:2:3:4:5:6", clientNetwork("2001:db8:1:2:3:4:5:6", 128))
+	a.Equal("fe80::/64", clientNetwork("fe80::1%eth0", 64))
+	a.Equal("", clientNetwork("", 64))
+	a.Equal("unix", clientNetwork("unix", 64))
+}
@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// completionWaiters lets HEAD requests wait until an upload has been finished
+// or terminated by another request handled by this instance. It is safe for
+// concurrent use.
+type completionWaiters struct {
+	lock    sync.Mutex
+	waiters map[string]map[chan struct{}]struct{}
+}
+
+func newCompletionWaiters() *completionWaiters {
+	return &completionWaiters{
+		waiters: make(map[string]map[chan struct{}]struct{}),
+	}
+}
+
+// subscribe returns a channel, which is closed once notify is called for the
+// upload. The returned function must be called once the caller stops waiting.
+func (w *completionWaiters) subscribe(id string) (<-chan struct{}, func()) {
+	ch := make(chan struct{})
+
+	w.lock.Lock()
+	if w.waiters[id] == nil {
+		w.waiters[id] = make(map[chan struct{}]struct{})
+	}
+	w.waiters[id][ch] = struct{}{}
+	w.lock.Unlock()
+
+	return ch, func() {
+		w.lock.Lock()
+		defer w.lock.Unlock()
+
+		delete(w.waiters[id], ch)
+		if len(w.waiters[id]) == 0 {
+			delete(w.waiters, id)
+		}
+	}
+}
+
+// notify wakes up all requests waiting for the upload with the given ID.
+func (w *completionWaiters) notify(id string) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	for ch := range w.waiters[id] {
+		close(ch)
+	}
+	delete(w.waiters, id)
+}
+
+// requestedWait returns the duration for which the client asked the HEAD
+// request to wait for the upload's completion using the Upload-Wait header,
+// limited to Config.MaxUploadWait.
+func (handler *UnroutedHandler) requestedWait(r *http.Request) (time.Duration, error) {
+	header := r.Header.Get("Upload-Wait")
+	if header == "" || handler.config.MaxUploadWait <= 0 {
+		return 0, nil
+	}
+
+	seconds, err := strconv.ParseInt(header, 10, 64)
+	if err != nil || seconds < 0 {
+		return 0, ErrInvalidUploadWait
+	}
+
+	wait := time.Duration(seconds) * time.Second
+	// Large values may overflow into negative durations.
+	if wait > handler.config.MaxUploadWait || wait < 0 {
+		wait = handler.config.MaxUploadWait
+	}
+
+	return wait, nil
+}
+
+// waitForCompletion blocks until the upload has been finished or terminated,
+// the duration requested by the client has passed or the request has been
+// cancelled. It returns immediately if the upload is already finished.
+func (handler *UnroutedHandler) waitForCompletion(c *httpContext, id string) error {
+	wait, err := handler.requestedWait(c.req)
+	if err != nil || wait == 0 {
+		return err
+	}
+
+	// Subscribe before fetching the upload's state, so that a completion in
+	// between is not missed.
+	done, unsubscribe := handler.completions.subscribe(id)
+	defer unsubscribe()
+
+	upload, err := handler.composer.Core.GetUpload(c, id)
+	if err != nil {
+		return err
+	}
+
+	info, err := upload.GetInfo(c)
+	if err != nil {
+		return err
+	}
+
+	if (!info.SizeIsDeferred && info.Offset == info.Size) || handler.isExpired(info) {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-done:
+	case <-timer.C:
+	case <-c.req.Context().Done():
+	}
+
+	return nil
+}
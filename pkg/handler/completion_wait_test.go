@@ -0,0 +1,99 @@
+package handler_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/tus/tusd/v2/pkg/handler"
+)
+
+func TestUploadWait(t *testing.T) {
+	SubTest(t, "Finished", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		info := FileInfo{
+			ID:     "yes",
+			Offset: 44,
+			Size:   44,
+		}
+		store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil).Times(2)
+		upload.EXPECT().GetInfo(gomock.Any()).Return(info, nil).Times(2)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+			MaxUploadWait: time.Minute,
+		})
+
+		start := time.Now()
+		(&httpTest{
+			Method: "HEAD",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Upload-Wait":   "30",
+			},
+			Code: http.StatusOK,
+			ResHeader: map[string]string{
+				"Upload-Offset": "44",
+			},
+		}).Run(handler, t)
+		assert.Less(t, time.Since(start), time.Second)
+	})
+
+	SubTest(t, "Timeout", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		info := FileInfo{
+			ID:     "yes",
+			Offset: 11,
+			Size:   44,
+		}
+		store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil).Times(2)
+		upload.EXPECT().GetInfo(gomock.Any()).Return(info, nil).Times(2)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+			MaxUploadWait: 50 * time.Millisecond,
+		})
+
+		start := time.Now()
+		(&httpTest{
+			Method: "HEAD",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Upload-Wait":   "30",
+			},
+			Code: http.StatusOK,
+			ResHeader: map[string]string{
+				"Upload-Offset": "11",
+			},
+		}).Run(handler, t)
+		assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+	})
+
+	SubTest(t, "InvalidHeader", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+			MaxUploadWait: time.Minute,
+		})
+
+		(&httpTest{
+			Method: "HEAD",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Upload-Wait":   "soon",
+			},
+			Code: http.StatusBadRequest,
+		}).Run(handler, t)
+	})
+}
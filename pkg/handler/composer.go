@@ -6,14 +6,34 @@ package handler
 type StoreComposer struct {
 	Core DataStore
 
-	UsesTerminater     bool
-	Terminater         TerminaterDataStore
-	UsesLocker         bool
-	Locker             Locker
-	UsesConcater       bool
-	Concater           ConcaterDataStore
-	UsesLengthDeferrer bool
-	LengthDeferrer     LengthDeferrerDataStore
+	UsesTerminater       bool
+	Terminater           TerminaterDataStore
+	UsesLocker           bool
+	Locker               Locker
+	UsesConcater         bool
+	Concater             ConcaterDataStore
+	UsesLengthDeferrer   bool
+	LengthDeferrer       LengthDeferrerDataStore
+	UsesLister           bool
+	Lister               ListableDataStore
+	UsesPresigner        bool
+	Presigner            PresignerDataStore
+	UsesPartPresigner    bool
+	PartPresigner        PartPresignerDataStore
+	UsesChunkSizeHinter  bool
+	ChunkSizeHinter      ChunkSizeHinterDataStore
+	UsesExpirer          bool
+	Expirer              ExpirerDataStore
+	UsesInspector        bool
+	Inspector            InspectorDataStore
+	UsesImporter         bool
+	Importer             ImporterDataStore
+	UsesIngester         bool
+	Ingester             IngesterDataStore
+	UsesPartialAppender  bool
+	PartialAppender      PartialAppenderDataStore
+	UsesChecksumRecorder bool
+	ChecksumRecorder     ChecksumRecorderDataStore
 }
 
 // NewStoreComposer creates a new and empty store composer.
@@ -56,6 +76,66 @@ func (store *StoreComposer) Capabilities() string {
 	} else {
 		str += "✗"
 	}
+	str += ` Lister: `
+	if store.UsesLister {
+		str += "✓"
+	} else {
+		str += "✗"
+	}
+	str += ` Presigner: `
+	if store.UsesPresigner {
+		str += "✓"
+	} else {
+		str += "✗"
+	}
+	str += ` PartPresigner: `
+	if store.UsesPartPresigner {
+		str += "✓"
+	} else {
+		str += "✗"
+	}
+	str += ` ChunkSizeHinter: `
+	if store.UsesChunkSizeHinter {
+		str += "✓"
+	} else {
+		str += "✗"
+	}
+	str += ` Expirer: `
+	if store.UsesExpirer {
+		str += "✓"
+	} else {
+		str += "✗"
+	}
+	str += ` Inspector: `
+	if store.UsesInspector {
+		str += "✓"
+	} else {
+		str += "✗"
+	}
+	str += ` Importer: `
+	if store.UsesImporter {
+		str += "✓"
+	} else {
+		str += "✗"
+	}
+	str += ` Ingester: `
+	if store.UsesIngester {
+		str += "✓"
+	} else {
+		str += "✗"
+	}
+	str += ` PartialAppender: `
+	if store.UsesPartialAppender {
+		str += "✓"
+	} else {
+		str += "✗"
+	}
+	str += ` ChecksumRecorder: `
+	if store.UsesChecksumRecorder {
+		str += "✓"
+	} else {
+		str += "✗"
+	}
 
 	return str
 }
@@ -85,3 +165,53 @@ func (store *StoreComposer) UseLengthDeferrer(ext LengthDeferrerDataStore) {
 	store.UsesLengthDeferrer = ext != nil
 	store.LengthDeferrer = ext
 }
+
+func (store *StoreComposer) UseLister(ext ListableDataStore) {
+	store.UsesLister = ext != nil
+	store.Lister = ext
+}
+
+func (store *StoreComposer) UsePresigner(ext PresignerDataStore) {
+	store.UsesPresigner = ext != nil
+	store.Presigner = ext
+}
+
+func (store *StoreComposer) UsePartPresigner(ext PartPresignerDataStore) {
+	store.UsesPartPresigner = ext != nil
+	store.PartPresigner = ext
+}
+
+func (store *StoreComposer) UseChunkSizeHinter(ext ChunkSizeHinterDataStore) {
+	store.UsesChunkSizeHinter = ext != nil
+	store.ChunkSizeHinter = ext
+}
+
+func (store *StoreComposer) UseExpirer(ext ExpirerDataStore) {
+	store.UsesExpirer = ext != nil
+	store.Expirer = ext
+}
+
+func (store *StoreComposer) UseInspector(ext InspectorDataStore) {
+	store.UsesInspector = ext != nil
+	store.Inspector = ext
+}
+
+func (store *StoreComposer) UseImporter(ext ImporterDataStore) {
+	store.UsesImporter = ext != nil
+	store.Importer = ext
+}
+
+func (store *StoreComposer) UseIngester(ext IngesterDataStore) {
+	store.UsesIngester = ext != nil
+	store.Ingester = ext
+}
+
+func (store *StoreComposer) UsePartialAppender(ext PartialAppenderDataStore) {
+	store.UsesPartialAppender = ext != nil
+	store.PartialAppender = ext
+}
+
+func (store *StoreComposer) UseChecksumRecorder(ext ChecksumRecorderDataStore) {
+	store.UsesChecksumRecorder = ext != nil
+	store.ChecksumRecorder = ext
+}
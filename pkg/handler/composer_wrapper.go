@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"fmt"
+
+	"golang.org/x/exp/slices"
+)
+
+// composerExtensions contains the names of the extensions, which can be
+// excluded in UseWrapper.
+var composerExtensions = []string{
+	"Terminater",
+	"Locker",
+	"Concater",
+	"LengthDeferrer",
+	"Lister",
+	"Presigner",
+	"PartPresigner",
+	"ChunkSizeHinter",
+	"Expirer",
+	"Inspector",
+	"Importer",
+	"Ingester",
+	"PartialAppender",
+	"ChecksumRecorder",
+}
+
+// UseWrapper sets wrapper as the core data store in composer and adds the
+// extensions provided by the store in inner, for data stores which wrap
+// another store, e.g. for instrumentation. This way, extensions added to
+// StoreComposer are forwarded by all wrappers without changing each of them.
+//
+// The extensions are provided by wrapper, which must implement their
+// interfaces. Only the Locker, Lister and ChunkSizeHinter extensions, which do
+// not operate on uploads, are taken from inner if wrapper does not implement
+// them. Extensions, which the wrapper intentionally does not provide, are
+// named in exclude, e.g. "Concater". UseWrapper panics if wrapper does not
+// implement an extension provided by inner, which is not excluded, so that a
+// missing method is noticed when the store is set up instead of silently
+// disabling the extension.
+func UseWrapper(composer *StoreComposer, wrapper DataStore, inner *StoreComposer, exclude ...string) {
+	for _, name := range exclude {
+		if !slices.Contains(composerExtensions, name) {
+			panic(fmt.Sprintf("handler: unknown extension %s excluded by %T", name, wrapper))
+		}
+	}
+	uses := func(name string, provided bool) bool {
+		return provided && !slices.Contains(exclude, name)
+	}
+
+	composer.UseCore(wrapper)
+	if uses("Terminater", inner.UsesTerminater) {
+		composer.UseTerminater(wrapperExtension[TerminaterDataStore](wrapper, "Terminater"))
+	}
+	if uses("Locker", inner.UsesLocker) {
+		if locker, ok := wrapper.(Locker); ok {
+			composer.UseLocker(locker)
+		} else {
+			composer.UseLocker(inner.Locker)
+		}
+	}
+	if uses("Concater", inner.UsesConcater) {
+		composer.UseConcater(wrapperExtension[ConcaterDataStore](wrapper, "Concater"))
+	}
+	if uses("LengthDeferrer", inner.UsesLengthDeferrer) {
+		composer.UseLengthDeferrer(wrapperExtension[LengthDeferrerDataStore](wrapper, "LengthDeferrer"))
+	}
+	if uses("Lister", inner.UsesLister) {
+		if lister, ok := wrapper.(ListableDataStore); ok {
+			composer.UseLister(lister)
+		} else {
+			composer.UseLister(inner.Lister)
+		}
+	}
+	if uses("Presigner", inner.UsesPresigner) {
+		composer.UsePresigner(wrapperExtension[PresignerDataStore](wrapper, "Presigner"))
+	}
+	if uses("PartPresigner", inner.UsesPartPresigner) {
+		composer.UsePartPresigner(wrapperExtension[PartPresignerDataStore](wrapper, "PartPresigner"))
+	}
+	if uses("ChunkSizeHinter", inner.UsesChunkSizeHinter) {
+		if hinter, ok := wrapper.(ChunkSizeHinterDataStore); ok {
+			composer.UseChunkSizeHinter(hinter)
+		} else {
+			composer.UseChunkSizeHinter(inner.ChunkSizeHinter)
+		}
+	}
+	if uses("Expirer", inner.UsesExpirer) {
+		composer.UseExpirer(wrapperExtension[ExpirerDataStore](wrapper, "Expirer"))
+	}
+	if uses("Inspector", inner.UsesInspector) {
+		composer.UseInspector(wrapperExtension[InspectorDataStore](wrapper, "Inspector"))
+	}
+	if uses("Importer", inner.UsesImporter) {
+		composer.UseImporter(wrapperExtension[ImporterDataStore](wrapper, "Importer"))
+	}
+	if uses("Ingester", inner.UsesIngester) {
+		composer.UseIngester(wrapperExtension[IngesterDataStore](wrapper, "Ingester"))
+	}
+	if uses("PartialAppender", inner.UsesPartialAppender) {
+		composer.UsePartialAppender(wrapperExtension[PartialAppenderDataStore](wrapper, "PartialAppender"))
+	}
+	if uses("ChecksumRecorder", inner.UsesChecksumRecorder) {
+		composer.UseChecksumRecorder(wrapperExtension[ChecksumRecorderDataStore](wrapper, "ChecksumRecorder"))
+	}
+}
+
+// wrapperExtension returns wrapper as the interface of the named extension and
+// panics if it does not implement it.
+func wrapperExtension[T any](wrapper DataStore, name string) T {
+	ext, ok := wrapper.(T)
+	if !ok {
+		panic(fmt.Sprintf("handler: %T does not implement the %s extension of the wrapped store", wrapper, name))
+	}
+	return ext
+}
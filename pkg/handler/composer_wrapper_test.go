@@ -0,0 +1,79 @@
+package handler_test
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tus/tusd/v2/pkg/handler"
+	"github.com/tus/tusd/v2/pkg/memorylocker"
+)
+
+// fullWrapper provides all extensions of the wrapped store.
+type fullWrapper struct {
+	FullDataStore
+}
+
+// terminaterWrapper only provides the termination extension.
+type terminaterWrapper struct {
+	handler.DataStore
+	handler.TerminaterDataStore
+}
+
+func TestUseWrapper(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	a := assert.New(t)
+
+	store := NewMockFullDataStore(ctrl)
+	locker := memorylocker.New()
+
+	inner := handler.NewStoreComposer()
+	inner.UseCore(store)
+	inner.UseTerminater(store)
+	inner.UseLocker(locker)
+	inner.UseConcater(store)
+	inner.UseLengthDeferrer(store)
+	inner.UseLister(store)
+	inner.UsePresigner(store)
+	inner.UsePartPresigner(store)
+	inner.UseChunkSizeHinter(store)
+	inner.UseExpirer(store)
+	inner.UseInspector(store)
+	inner.UseImporter(store)
+	inner.UseIngester(store)
+	inner.UsePartialAppender(store)
+
+	wrapper := fullWrapper{store}
+	composer := handler.NewStoreComposer()
+	handler.UseWrapper(composer, wrapper, inner)
+
+	a.Equal(wrapper, composer.Core)
+	a.Equal(wrapper, composer.Terminater)
+	a.Equal(locker, composer.Locker)
+	a.Equal(wrapper, composer.Concater)
+	a.Equal(wrapper, composer.Lister)
+	a.Equal(wrapper, composer.ChunkSizeHinter)
+	a.Equal(wrapper, composer.PartialAppender)
+	a.Equal(inner.Capabilities(), composer.Capabilities())
+
+	// Extensions not implemented by the wrapper must be excluded explicitly.
+	partial := terminaterWrapper{store, store}
+	a.PanicsWithValue("handler: handler_test.terminaterWrapper does not implement the Concater extension of the wrapped store", func() {
+		handler.UseWrapper(handler.NewStoreComposer(), partial, inner)
+	})
+	a.Panics(func() {
+		handler.UseWrapper(handler.NewStoreComposer(), partial, inner, "Unknown")
+	})
+
+	composer = handler.NewStoreComposer()
+	handler.UseWrapper(composer, partial, inner, "Concater", "LengthDeferrer", "Presigner", "PartPresigner", "Expirer", "Inspector", "Importer", "Ingester", "PartialAppender")
+	a.Equal(partial, composer.Terminater)
+	a.False(composer.UsesConcater)
+	a.False(composer.UsesPartialAppender)
+	// Extensions not operating on uploads are taken from the wrapped store.
+	a.Equal(locker, composer.Locker)
+	a.Equal(store, composer.Lister)
+	a.Equal(store, composer.ChunkSizeHinter)
+}
@@ -2,10 +2,12 @@ package handler
 
 import (
 	"errors"
+	"net/http"
 	"net/url"
 	"regexp"
 	"time"
 
+	"golang.org/x/exp/slices"
 	"golang.org/x/exp/slog"
 )
 
@@ -33,6 +35,10 @@ type Config struct {
 	// DisableTermination indicates whether the server will refuse termination
 	// requests of the uploaded file, by not mounting the DELETE handler.
 	DisableTermination bool
+	// Mode restricts the endpoints mounted by the handler to those for writing
+	// or reading uploads, for example to run separate handlers for receiving
+	// and downloading uploads. Defaults to ModeReadWrite.
+	Mode HandlerMode
 	// Cors can be used to customize the handling of Cross-Origin Resource Sharing (CORS).
 	// See the CorsConfig struct for more details.
 	// Defaults to DefaultCorsConfig.
@@ -53,6 +59,300 @@ type Config struct {
 	// notifications are sent to the UploadProgress channel, if enabled.
 	// Defaults to 1s.
 	UploadProgressInterval time.Duration
+	// IdempotencyCache enables support for the Idempotency-Key header on upload
+	// creation requests. If a client repeats a creation request with the same key,
+	// for example because the previous response got lost, the previously created
+	// upload is returned instead of creating a new one. If nil, the header is ignored.
+	// Only applies to the tus v1 protocol.
+	IdempotencyCache IdempotencyCache
+	// AuditLogger receives a record for every POST, PATCH and DELETE request
+	// after its response has been sent, including rejected requests. If nil,
+	// no records are created.
+	AuditLogger AuditLogger
+	// AccessLogger receives a record for every request, including its status,
+	// the number of bytes received and sent, and the time spent in the data
+	// store, once the handler has finished it. Unlike the log entries written
+	// to Logger, the records are meant for monitoring the traffic. If nil, no
+	// records are created.
+	AccessLogger AccessLogger
+	// UploadIndex keeps a searchable record of all uploads, including their tags
+	// assigned using FileInfoChanges.Tags, their state and when they last received
+	// data. If nil, no record is kept.
+	UploadIndex UploadIndex
+	// ResolvePrincipal returns the ID of the principal, e.g. the authenticated
+	// user, on whose behalf a request is made. If set and an UploadIndex is
+	// configured, new uploads are tagged with PrincipalTagPrefix followed by the
+	// ID of their creator. Errors are treated as an unknown principal.
+	ResolvePrincipal func(r *http.Request) (string, error)
+	// EnableResumeDiscovery enables the endpoint at BasePath + "resume", where
+	// clients can look up the URLs of their unfinished uploads of a file using
+	// its fingerprint, see PostResume. Requires UploadIndex and ResolvePrincipal.
+	EnableResumeDiscovery bool
+	// ResumeHashMetadataKey is the metadata key, under which clients supply the
+	// hash of the file's content when creating an upload, so that it can be found
+	// using resume discovery.
+	// Defaults to "filehash".
+	ResumeHashMetadataKey string
+	// FilenamePolicy controls how the file name from the upload's metadata is
+	// sanitized before it is included in the Content-Disposition header of GET
+	// responses. See FilenamePolicy for the defaults.
+	FilenamePolicy FilenamePolicy
+	// CaptureHeaders lists request headers, e.g. X-Tenant-Id, whose values are
+	// captured from every request. Data stores and hooks can retrieve them from the
+	// request's context using CapturedHeaders.
+	CaptureHeaders []string
+	// StoreCapturedHeaders instructs the handler to copy the captured headers of the
+	// creation request into the upload's metadata, so that they are persisted and
+	// available to hooks for later requests, e.g. in the post-finish hook. The keys
+	// are the lower-cased header names prefixed with CapturedHeaderMetadataPrefix.
+	// Please note that metadata is included in responses to HEAD requests, so
+	// sensitive headers, such as Authorization, should not be stored.
+	StoreCapturedHeaders bool
+	// AcceptEncryptionKeys allows clients to supply their own encryption key for an
+	// upload using the Upload-Encryption-Key header. The key is passed to the data
+	// store in the request's context, see EncryptionKeyFromContext, but it is never
+	// persisted, so it must be included in every request for the upload. If disabled,
+	// requests including the header are rejected.
+	AcceptEncryptionKeys bool
+	// DecompressRequestBodies enables accepting PATCH requests, whose body is
+	// compressed using gzip, or an encoding from ContentDecoders, as indicated by
+	// the Content-Encoding header.
+	// The body is decompressed before it is passed to the data store, so the
+	// Upload-Offset and Upload-Length headers refer to the decompressed data.
+	// Requests using other encodings are rejected. If disabled, the header is
+	// ignored and the body is stored as received.
+	DecompressRequestBodies bool
+	// MaxDecompressionRatio limits how much larger a decompressed request body may
+	// be than the compressed data received, to protect against decompression bombs.
+	// The first megabyte of decompressed data is always allowed. Defaults to 100.
+	MaxDecompressionRatio int64
+	// ContentDecoders adds support for further values of the Content-Encoding
+	// header when DecompressRequestBodies is enabled. The keys are lower-cased
+	// encoding names, such as zstd, and the values create a decompressing reader.
+	// This allows using codecs, which are not included in the standard library,
+	// without tusd depending on them. Decoders should limit the memory they
+	// allocate as requested by the client, e.g. zstd's window size.
+	ContentDecoders map[string]ContentDecoder
+	// IPv6PrefixLength is the number of leading bits of an IPv6 address, which
+	// identify a client in logs and per-client limits, see ClientNetwork. Mobile
+	// networks and ISPs commonly assign a /64 prefix to each subscriber, from
+	// which the client may use any address, so that counting addresses alone
+	// would be meaningless. IPv4 addresses are always used as a whole. Defaults
+	// to 64.
+	IPv6PrefixLength int
+	// StrictRequests hardens the handler for deployments directly exposed to the
+	// internet. HTTP/1.0 requests with a body are rejected, since the server
+	// ignores their Transfer-Encoding header, which a proxy might have followed.
+	// Requests using methods without a body, such as GET or DELETE, are rejected
+	// if they include one. Tus headers sent multiple times are reduced to a
+	// single value, or rejected if the values differ. Go's HTTP server already
+	// rejects differing Content-Length headers and unsupported transfer codings.
+	StrictRequests bool
+	// MaxHeaderSize limits the total size of the request headers in bytes.
+	// Larger requests are rejected with 431 Request Header Fields Too Large.
+	// Servers should also set http.Server.MaxHeaderBytes, so that such requests
+	// are not read entirely. If zero, only the server's limit applies.
+	MaxHeaderSize int
+	// Maintenance, if set, rejects new uploads with ErrMaintenance while the
+	// maintenance mode is enabled or a scheduled window is active. Existing
+	// uploads can still be resumed and downloaded.
+	Maintenance *Maintenance
+	// ByteBudget, if set, counts the bytes written to and read from the bucket
+	// per month. Once its soft limit is exceeded, a notification is sent on the
+	// ByteBudgetWarnings channel, and once its hard limit is reached, new uploads
+	// are rejected with ErrByteBudgetExceeded. See ByteBudget.
+	ByteBudget *ByteBudget
+	// NotifyByteBudgetWarnings indicates whether sending notifications about
+	// the exceeded soft limit of ByteBudget using the ByteBudgetWarnings channel
+	// should be enabled.
+	NotifyByteBudgetWarnings bool
+	// EnableTestScenarios lets clients simulate failures, such as dropped
+	// connections, delayed responses or sequences of error responses, using the
+	// TestScenarioHeader. This allows authors of tus clients to verify their
+	// retry and resumption logic against a real server. It must never be
+	// enabled in production, since any client can make requests fail.
+	EnableTestScenarios bool
+	// EstimateUploadRate instructs the handler to measure the recent rate at which
+	// each upload receives data on this instance. Responses to PATCH and HEAD
+	// requests for unfinished uploads then include the rate in bytes per second
+	// in the Upload-Rate header and, if the upload's size is known, the time at
+	// which the upload will be complete at this rate in the
+	// Upload-Estimated-Completion header. Clients can show these values instead
+	// of computing their own estimates. No estimate is made for uploads, which
+	// have not received data on this instance within the last minute.
+	EstimateUploadRate bool
+	// UploadSampler, if set, receives copies of the data at the beginning of
+	// selected uploads, e.g. for content classification. See UploadSampler.
+	UploadSampler UploadSampler
+	// RedirectDownloads instructs the handler to respond to GET requests for finished
+	// uploads with a redirect to a URL generated by the data store, from which the
+	// content can be downloaded directly. This avoids passing the content through
+	// tusd. Requires a data store implementing PresignerDataStore and is ignored
+	// otherwise.
+	RedirectDownloads bool
+	// DownloadURLExpiry is the duration for which the URLs used for redirecting
+	// downloads are valid.
+	// Defaults to 15min.
+	DownloadURLExpiry time.Duration
+	// PresignCompletedUploads instructs the handler to include pre-signed URLs for
+	// reading the content of completed uploads in the notifications sent on the
+	// CompleteUploads channel, see HookEvent.PresignedURLs. Consumers of these
+	// notifications, such as post-finish hooks, can then process the upload
+	// without credentials for the entire storage. Requires a data store
+	// implementing PresignerDataStore and is ignored otherwise.
+	PresignCompletedUploads bool
+	// CompletedUploadURLExpiry is the duration for which the URLs created for
+	// PresignCompletedUploads are valid.
+	// Defaults to 15min.
+	CompletedUploadURLExpiry time.Duration
+	// DownloadTokenSecret is the key for signing the tokens created using
+	// NewDownloadToken. A GET request including a valid token in the token query
+	// parameter can download the upload once, until the token expires. Each token
+	// is bound to a single upload and optionally to the client's IP address. Used
+	// tokens are remembered in memory, so a token can be used once per instance if
+	// multiple instances share the secret. If empty, tokens are disabled.
+	DownloadTokenSecret []byte
+	// RequireDownloadTokens rejects GET requests without a download token, so that
+	// uploads can only be downloaded using links shared with NewDownloadToken.
+	// Requires DownloadTokenSecret.
+	RequireDownloadTokens bool
+	// EnableDirectPartUploads enables the experimental direct part uploads. Instead
+	// of sending the upload's content in PATCH requests, clients request pre-signed
+	// URLs for the individual parts using POST requests to the upload URL and send
+	// the parts directly to the storage backend. The handler only coordinates the
+	// upload and finishes it once the client reports that all parts have been sent.
+	// Both ways of uploading must not be mixed for the same upload. Requires a data
+	// store implementing PartPresignerDataStore and is ignored otherwise.
+	// Direct part uploads are only available to clients using ProtocolVersion1_1,
+	// which is added to ProtocolVersions if necessary.
+	EnableDirectPartUploads bool
+	// ProtocolVersions lists the tus protocol versions accepted by the handler in
+	// order of preference. They are advertised in the Tus-Version header and
+	// requests using a different version in their Tus-Resumable header are
+	// rejected. Extensions which require a newer version are neither advertised
+	// to nor usable by clients requesting an older one.
+	// Defaults to ProtocolVersion1_0 only.
+	ProtocolVersions []string
+	// PartURLExpiry is the duration for which the URLs used for direct part uploads
+	// are valid.
+	// Defaults to 15min.
+	PartURLExpiry time.Duration
+	// UploadExpiry enables the expiration extension. Unfinished uploads expire this
+	// long after their creation and requests for expired uploads are rejected. The
+	// expiration time is announced to clients using the Upload-Expires header. If
+	// the data store implements ExpirerDataStore, the expiration is extended while
+	// the upload receives data. Clients can also extend it explicitly by sending a
+	// PATCH request without a body, for example while the upload is paused. Hooks
+	// can adjust the expiration of new uploads using FileInfoChanges.ExpiresAt.
+	// Please note that expired uploads are not removed from the data store.
+	UploadExpiry time.Duration
+	// PriorityMetadataKey is the metadata key, from which the priority of new uploads
+	// is read, see FileInfo.Priority. Clients can only lower the priority of their
+	// uploads this way, for example for batch transfers, since positive values are
+	// ignored. Higher priorities can be assigned by hooks using FileInfoChanges.Priority.
+	// Defaults to an empty string, in which case the metadata is not considered.
+	PriorityMetadataKey string
+	// ChecksumMetadataKey is the metadata key, in which clients can declare the
+	// checksum of the whole file when creating an upload, see UploadChecksum.
+	// The value is formatted like the Upload-Checksum header, i.e. the algorithm
+	// (md5, sha1, sha256 or sha512) followed by a space and the base64-encoded
+	// checksum. Once the upload is complete, the received data is compared with
+	// the checksum, before the data store finishes the upload if the handler
+	// has kept track of the data's digest. On mismatch, the upload is not
+	// reported as finished and the request is answered with
+	// StatusChecksumMismatch. The result is recorded in FileInfo.Checksum by
+	// data stores implementing ChecksumRecorderDataStore, so that retried
+	// requests fail as well. Otherwise, uploads not matching their checksum are
+	// terminated. Final uploads of the concatenation extension are not
+	// verified. Defaults to an empty string, in which case no checksums are
+	// verified.
+	ChecksumMetadataKey string
+	// DeduplicateChunks instructs the handler to remember a hash of the last chunk
+	// written to each upload. If a client did not receive the response to a PATCH
+	// request, for example due to a flaky network, and sends the same data again
+	// at the previous offset, the data is compared against this hash instead of
+	// causing a 409 Conflict response. Identical data is acknowledged without being
+	// written to the data store again, while the remaining data of the request, if
+	// any, is appended to the upload. The hashes are kept in memory only.
+	DeduplicateChunks bool
+	// DeduplicationTTL is the duration for which the hash of an upload's last chunk
+	// is remembered.
+	// Defaults to 1h.
+	DeduplicationTTL time.Duration
+	// SkipReceivedPrefix instructs the handler to accept PATCH requests whose
+	// Upload-Offset lies before the upload's offset instead of responding with
+	// 409 Conflict. The part of the body, which the upload already contains, is
+	// discarded and only the remaining data is appended. Unlike DeduplicateChunks,
+	// the discarded data is not compared against the stored data, so this must
+	// only be enabled if clients always send the same data for an offset. If
+	// both are enabled, SkipReceivedPrefix takes precedence.
+	SkipReceivedPrefix bool
+	// EnablePipelinedPatches supports clients sending the next PATCH request for
+	// an upload before the previous one has been answered, e.g. over HTTP/2. A
+	// request, whose Upload-Offset equals the end of a request still in progress
+	// on this instance, waits until that request has been handled instead of
+	// interrupting it or failing with 409 Conflict. Each response acknowledges
+	// only the offset committed by its own request. If the previous request
+	// stores less data than announced, the queued one fails as usual. Requests
+	// wait at most for AcquireLockTimeout. Since the state is kept in memory,
+	// pipelined requests must reach the same instance.
+	EnablePipelinedPatches bool
+	// AcceptPartialBodies acknowledges PATCH requests whose body ended
+	// prematurely, for example because a CDN in front of tusd cut off or split
+	// the request, or the connection was reset or timed out. Instead of an error,
+	// the response is 204 No Content with the Upload-Offset of the data which has
+	// been stored, so that the client or CDN can continue from there without an
+	// additional HEAD request. In addition, responses to PATCH requests include
+	// the Upload-Received header with the number of bytes stored from the request.
+	AcceptPartialBodies bool
+	// ClientAbortStatusCodes sets the status codes of PATCH requests aborted by
+	// the client to the non-standard 499 Client Closed Request and of PATCH
+	// requests whose body could not be read in time to 598 Network Read Timeout,
+	// instead of 400 or 500. Many CDNs and log pipelines treat these as failures
+	// on the client's side, which are not retried against the origin and not
+	// counted as server errors. The responses include the Upload-Offset header.
+	// Requests acknowledged due to AcceptPartialBodies are not affected.
+	ClientAbortStatusCodes bool
+	// MaxUploadWait enables long-polling using HEAD requests. If a client sends
+	// the Upload-Wait header with a number of seconds, the response is delayed
+	// until the upload has been finished or terminated, or the duration, limited
+	// to MaxUploadWait, has passed. This allows post-processing services to wait
+	// for an upload without polling its offset. Only completions handled by this
+	// instance end the wait early. If zero, the header is ignored.
+	MaxUploadWait time.Duration
+	// EnableRemoteFetch allows clients to create uploads from a URL using the
+	// Upload-Source-Url header instead of sending the content themselves. The
+	// handler downloads the content in the background and writes it to the data
+	// store like the data of regular uploads, so MaxSize, the hooks and the
+	// finish notifications apply. If the source does not report its size, the
+	// data store must implement LengthDeferrerDataStore. Clients can follow the
+	// progress using HEAD requests, whose responses include the Upload-Source-Status
+	// header, or using server-sent events, see GetFile. Downloads are only
+	// tracked by the instance which received the creation request.
+	EnableRemoteFetch bool
+	// RemoteFetchClient is the HTTP client used for downloading the content of
+	// uploads from their source URL.
+	// Defaults to a client, which refuses to connect to loopback, private and
+	// link-local addresses, so that clients cannot make tusd access internal services.
+	RemoteFetchClient *http.Client
+	// RemoteFetchAllowURL decides whether content may be fetched from a URL, for
+	// example by comparing its host against a list of allowed hosts. It is also
+	// applied to the targets of redirects. If it returns an error, the creation
+	// request is rejected with ErrRemoteSourceNotAllowed. If nil, all http and
+	// https URLs are allowed.
+	RemoteFetchAllowURL func(u *url.URL) error
+	// RemoteFetchRetries is the number of times an interrupted download from a
+	// source URL is resumed, using a Range request if the source supports it.
+	// Defaults to 3. Negative values disable retries.
+	RemoteFetchRetries int
+	// MetadataRules are applied in order to the metadata of new uploads before
+	// the pre-create hook is invoked, see MetadataRule. Uploads whose metadata
+	// violates a rule are rejected with ErrInvalidMetadata.
+	MetadataRules []MetadataRule
+	// ResponseHeaders are included in the responses to requests for creating,
+	// uploading and downloading files, for example to add security headers
+	// without a proxy in front of tusd.
+	ResponseHeaders ResponseHeaderConfig
 	// Logger is the logger to use internally, mostly for printing requests.
 	Logger *slog.Logger
 	// Respect the X-Forwarded-Host, X-Forwarded-Proto and Forwarded headers
@@ -79,7 +379,8 @@ type Config struct {
 	// request has ended (successfully or by error). For example, if an HTTP request is interrupted,
 	// instead of stopping immediately, the handler and data store will be given some additional
 	// time to wrap up their operations and save any uploaded data. GracefulRequestCompletionTimeout
-	// controls this time.
+	// controls this time. Once it has passed, the context is cancelled and context.Cause
+	// returns the reason, for example ErrClientDisconnected if the client disconnected.
 	// See HookEvent.Context for more details.
 	// Defaults to 10s.
 	GracefulRequestCompletionTimeout time.Duration
@@ -135,9 +436,9 @@ var DefaultCorsConfig = CorsConfig{
 	AllowOrigin:      regexp.MustCompile(".*"),
 	AllowCredentials: false,
 	AllowMethods:     "POST, HEAD, PATCH, OPTIONS, GET, DELETE",
-	AllowHeaders:     "Authorization, Origin, X-Requested-With, X-Request-ID, X-HTTP-Method-Override, Content-Type, Upload-Length, Upload-Offset, Tus-Resumable, Upload-Metadata, Upload-Defer-Length, Upload-Concat, Upload-Incomplete, Upload-Draft-Interop-Version",
+	AllowHeaders:     "Authorization, Origin, X-Requested-With, X-Request-ID, X-HTTP-Method-Override, Content-Type, Upload-Length, Upload-Offset, Tus-Resumable, Upload-Metadata, Upload-Defer-Length, Upload-Concat, Upload-Incomplete, Upload-Draft-Interop-Version, Idempotency-Key, Upload-Part-Offset, Upload-Parts-Complete, Upload-Wait, Traceparent, Upload-Encryption-Key, Upload-Encryption-Algorithm, Content-Encoding, Upload-Source-Url",
 	MaxAge:           "86400",
-	ExposeHeaders:    "Upload-Offset, Location, Upload-Length, Tus-Version, Tus-Resumable, Tus-Max-Size, Tus-Extension, Upload-Metadata, Upload-Defer-Length, Upload-Concat, Upload-Incomplete, Upload-Draft-Interop-Version",
+	ExposeHeaders:    "Upload-Offset, Location, Upload-Length, Tus-Version, Tus-Resumable, Tus-Max-Size, Tus-Extension, Upload-Metadata, Upload-Defer-Length, Upload-Concat, Upload-Incomplete, Upload-Draft-Interop-Version, Upload-Part-Url, Upload-Part-Length, Upload-Part-Expires, Upload-Preferred-Chunk-Size, Upload-Expires, Upload-Source-Status, Upload-Source-Error, Upload-Received, Upload-Rate, Upload-Estimated-Completion",
 }
 
 func (config *Config) validate() error {
@@ -171,10 +472,83 @@ func (config *Config) validate() error {
 		return errors.New("tusd: StoreComposer in Config needs to contain a non-nil core")
 	}
 
+	mode, err := ParseHandlerMode(string(config.Mode))
+	if err != nil {
+		return err
+	}
+	config.Mode = mode
+
+	if len(config.ProtocolVersions) == 0 {
+		config.ProtocolVersions = []string{ProtocolVersion1_0}
+	}
+	if err := validateProtocolVersions(config.ProtocolVersions); err != nil {
+		return err
+	}
+	if config.EnableDirectPartUploads && !slices.Contains(config.ProtocolVersions, ProtocolVersion1_1) {
+		// Copy the slice to not modify the caller's one.
+		versions := make([]string, 0, len(config.ProtocolVersions)+1)
+		config.ProtocolVersions = append(append(versions, config.ProtocolVersions...), ProtocolVersion1_1)
+	}
+
+	if config.EnableResumeDiscovery && (config.UploadIndex == nil || config.ResolvePrincipal == nil) {
+		return errors.New("tusd: EnableResumeDiscovery requires UploadIndex and ResolvePrincipal")
+	}
+
+	if config.RequireDownloadTokens && len(config.DownloadTokenSecret) == 0 {
+		return errors.New("tusd: RequireDownloadTokens requires DownloadTokenSecret")
+	}
+
+	if err := validateMetadataRules(config.MetadataRules); err != nil {
+		return err
+	}
+
+	if err := validateResponseHeaders(config.ResponseHeaders); err != nil {
+		return err
+	}
+
+	if config.IPv6PrefixLength == 0 {
+		config.IPv6PrefixLength = 64
+	}
+	if config.IPv6PrefixLength < 1 || config.IPv6PrefixLength > 128 {
+		return errors.New("tusd: IPv6PrefixLength must be between 1 and 128")
+	}
+
+	if config.ResumeHashMetadataKey == "" {
+		config.ResumeHashMetadataKey = "filehash"
+	}
+
+	if config.EnableRemoteFetch && config.RemoteFetchClient == nil {
+		config.RemoteFetchClient = newRemoteFetchClient()
+	}
+
+	if config.RemoteFetchRetries == 0 {
+		config.RemoteFetchRetries = 3
+	}
+
+	if config.MaxDecompressionRatio <= 0 {
+		config.MaxDecompressionRatio = 100
+	}
+
 	if config.UploadProgressInterval <= 0 {
 		config.UploadProgressInterval = 1 * time.Second
 	}
 
+	if config.DownloadURLExpiry <= 0 {
+		config.DownloadURLExpiry = 15 * time.Minute
+	}
+
+	if config.CompletedUploadURLExpiry <= 0 {
+		config.CompletedUploadURLExpiry = 15 * time.Minute
+	}
+
+	if config.PartURLExpiry <= 0 {
+		config.PartURLExpiry = 15 * time.Minute
+	}
+
+	if config.DeduplicationTTL <= 0 {
+		config.DeduplicationTTL = 1 * time.Hour
+	}
+
 	if config.GracefulRequestCompletionTimeout <= 0 {
 		config.GracefulRequestCompletionTimeout = 10 * time.Second
 	}
@@ -191,5 +565,12 @@ func (config *Config) validate() error {
 		config.Cors = &DefaultCorsConfig
 	}
 
+	if config.EnableTestScenarios && !config.Cors.Disable {
+		// Copy the configuration to not modify the caller's one.
+		cors := *config.Cors
+		cors.AllowHeaders += ", " + TestScenarioHeader
+		config.Cors = &cors
+	}
+
 	return nil
 }
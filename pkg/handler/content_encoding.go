@@ -0,0 +1,153 @@
+package handler
+
+import (
+	"compress/gzip"
+	"io"
+	"strings"
+)
+
+// decompressionAllowance is the amount of decompressed data, which is accepted
+// regardless of MaxDecompressionRatio, so that small, well-compressible chunks
+// are not rejected.
+const decompressionAllowance = 1024 * 1024
+
+// ContentDecoder creates a reader, which decompresses the data read from r.
+type ContentDecoder func(r io.Reader) (io.ReadCloser, error)
+
+// contentDecoders holds the values for the Content-Encoding header, which are
+// supported without configuring Config.ContentDecoders.
+var contentDecoders = map[string]ContentDecoder{
+	"gzip":   newGzipDecoder,
+	"x-gzip": newGzipDecoder,
+}
+
+func newGzipDecoder(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+// contentDecoder returns the decoder for the given Content-Encoding. Decoders
+// from the configuration take precedence over the built-in ones.
+func (handler *UnroutedHandler) contentDecoder(encoding string) (ContentDecoder, bool) {
+	if newDecoder, ok := handler.config.ContentDecoders[encoding]; ok {
+		return newDecoder, true
+	}
+	newDecoder, ok := contentDecoders[encoding]
+	return newDecoder, ok
+}
+
+// decompressRequestBody replaces the request body with its decompressed data,
+// if the Content-Encoding header indicates a supported compression. The length
+// of the decompressed data is not known in advance, so the Content-Length is
+// reset and the request is handled as if the body was sent without it.
+func (handler *UnroutedHandler) decompressRequestBody(c *httpContext) error {
+	encoding := strings.ToLower(strings.TrimSpace(c.req.Header.Get("Content-Encoding")))
+	if encoding == "" || encoding == "identity" {
+		return nil
+	}
+
+	newDecoder, ok := handler.contentDecoder(encoding)
+	if !ok {
+		return ErrUnsupportedContentEncoding
+	}
+	if c.req.Body == nil {
+		return nil
+	}
+
+	c.log = c.log.With("contentEncoding", encoding)
+	c.req.Body = &decompressingReader{
+		body:       &countingBody{ReadCloser: c.req.Body},
+		newDecoder: newDecoder,
+		maxRatio:   handler.config.MaxDecompressionRatio,
+	}
+	c.req.ContentLength = -1
+	c.req.Header.Del("Content-Encoding")
+	c.req.Header.Del("Content-Length")
+
+	return nil
+}
+
+// countingBody counts the bytes read from the compressed request body and
+// remembers the error, which ended reading.
+type countingBody struct {
+	io.ReadCloser
+	n   int64
+	err error
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	if err != nil {
+		b.err = err
+	}
+	return n, err
+}
+
+// decompressingReader decompresses the request body. The decoder is created
+// on the first read, since it already reads from the body, which should only
+// happen once the data store consumes the data.
+type decompressingReader struct {
+	body       *countingBody
+	newDecoder ContentDecoder
+	decoder    io.ReadCloser
+	maxRatio   int64
+	n          int64
+	err        error
+}
+
+func (r *decompressingReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+
+	if r.decoder == nil {
+		decoder, err := r.newDecoder(r.body)
+		if err != nil {
+			r.fail(err)
+			return 0, r.err
+		}
+		r.decoder = decoder
+	}
+
+	n, err := r.decoder.Read(p)
+	r.n += int64(n)
+	if r.n > decompressionAllowance && r.n > r.body.n*r.maxRatio {
+		r.err = ErrDecompressionRatioExceeded
+		r.decoder.Close()
+		return n, r.err
+	}
+	if err != nil {
+		r.fail(err)
+		return n, r.err
+	}
+
+	return n, nil
+}
+
+// fail records the error, which ended decompression. Errors from reading the
+// request body, such as a disconnecting client, are passed on as they are, so
+// that they are handled as for uncompressed bodies. Other errors are caused by
+// invalid compressed data.
+func (r *decompressingReader) fail(err error) {
+	switch {
+	case err == io.EOF:
+		r.err = io.EOF
+	case r.body.err != nil && r.body.err != io.EOF:
+		r.err = r.body.err
+	case r.body.n == 0 && r.body.err == io.EOF:
+		// An empty body contains no data, even if it is not valid compressed data.
+		r.err = io.EOF
+	default:
+		r.err = ErrInvalidCompressedBody
+	}
+
+	if r.decoder != nil {
+		r.decoder.Close()
+	}
+}
+
+// Close closes the request body. The decoder is closed once reading ends, since
+// Close may be called concurrently to Read to interrupt the upload.
+func (r *decompressingReader) Close() error {
+	return r.body.Close()
+}
@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newDeflateDecoder is used for testing decoders supplied by the configuration.
+func newDeflateDecoder(r io.Reader) (io.ReadCloser, error) {
+	return flate.NewReader(r), nil
+}
+
+func TestContentDecoder(t *testing.T) {
+	a := assert.New(t)
+
+	handler := &UnroutedHandler{config: Config{}}
+	_, ok := handler.contentDecoder("gzip")
+	a.True(ok)
+	_, ok = handler.contentDecoder("deflate")
+	a.False(ok)
+
+	handler.config.ContentDecoders = map[string]ContentDecoder{
+		"deflate": newDeflateDecoder,
+	}
+	_, ok = handler.contentDecoder("deflate")
+	a.True(ok)
+	_, ok = handler.contentDecoder("gzip")
+	a.True(ok)
+}
+
+func TestDecompressingReader(t *testing.T) {
+	decoders := map[string]ContentDecoder{
+		"gzip":    newGzipDecoder,
+		"deflate": newDeflateDecoder,
+	}
+
+	newReader := func(encoding string, body io.Reader) *decompressingReader {
+		return &decompressingReader{
+			body:       &countingBody{ReadCloser: io.NopCloser(body)},
+			newDecoder: decoders[encoding],
+			maxRatio:   100,
+		}
+	}
+
+	compress := func(encoding string, data []byte) []byte {
+		var buf bytes.Buffer
+		var w io.WriteCloser
+		if encoding == "deflate" {
+			w, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+		} else {
+			w = gzip.NewWriter(&buf)
+		}
+		w.Write(data)
+		w.Close()
+		return buf.Bytes()
+	}
+
+	text := []byte(strings.Repeat("hello world, ", 1000))
+
+	for _, encoding := range []string{"gzip", "deflate"} {
+		t.Run(encoding, func(t *testing.T) {
+			a := assert.New(t)
+
+			data, err := io.ReadAll(newReader(encoding, bytes.NewReader(compress(encoding, text))))
+			a.NoError(err)
+			a.Equal(text, data)
+
+			// Corrupted data is rejected.
+			compressed := compress(encoding, text)
+			_, err = io.ReadAll(newReader(encoding, bytes.NewReader(compressed[:len(compressed)/2])))
+			a.Equal(ErrInvalidCompressedBody, err)
+
+			_, err = io.ReadAll(newReader(encoding, strings.NewReader("not compressed")))
+			a.Equal(ErrInvalidCompressedBody, err)
+
+			// Errors from the request body are passed on.
+			_, err = io.ReadAll(newReader(encoding, io.MultiReader(bytes.NewReader(compressed[:10]), failingReader{io.ErrUnexpectedEOF})))
+			a.Equal(io.ErrUnexpectedEOF, err)
+
+			// An empty body is empty after decompression.
+			data, err = io.ReadAll(newReader(encoding, strings.NewReader("")))
+			a.NoError(err)
+			a.Empty(data)
+
+			// Decompression bombs are stopped.
+			bomb := compress(encoding, make([]byte, 10*1024*1024))
+			_, err = io.ReadAll(newReader(encoding, bytes.NewReader(bomb)))
+			a.Equal(ErrDecompressionRatioExceeded, err)
+		})
+	}
+}
+
+// failingReader is a reader, which fails with the given error.
+type failingReader struct {
+	err error
+}
+
+func (r failingReader) Read(p []byte) (int, error) {
+	return 0, r.err
+}
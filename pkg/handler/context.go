@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"net/http"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/exp/slog"
@@ -20,13 +22,23 @@ type httpContext struct {
 	resC *http.ResponseController
 	req  *http.Request
 
-	// body is nil by default and set by the user if the request body is consumed.
+	// body is nil by default and set using setBody if the request body is consumed.
 	body *bodyReader
+	// bodyLock guards body against the goroutine closing it on cancellation.
+	bodyLock sync.Mutex
 
 	// cancel allows a user to cancel the internal request context, causing
 	// the request body to be closed.
 	cancel context.CancelCauseFunc
 
+	// version is the tus protocol version negotiated for this request. It is
+	// empty for requests using the IETF resumable upload draft.
+	version string
+
+	// storeDuration is the time spent in the data store in nanoseconds, see
+	// AccessRecord.StoreDuration.
+	storeDuration atomic.Int64
+
 	// log is the logger for this request. It gets extended with more properties as the
 	// request progresses and is identified.
 	log *slog.Logger
@@ -54,7 +66,7 @@ func (h UnroutedHandler) newContext(w http.ResponseWriter, r *http.Request) *htt
 		req:     r,
 		body:    nil, // body can be filled later for PATCH requests
 		cancel:  cancelHandling,
-		log:     h.logger.With("method", r.Method, "path", r.URL.Path, "requestId", getRequestId(r)),
+		log:     h.logger.With("method", r.Method, "path", r.URL.Path, "requestId", getRequestId(r), "client", ClientNetwork(r.Context())),
 	}
 
 	go func() {
@@ -62,14 +74,31 @@ func (h UnroutedHandler) newContext(w http.ResponseWriter, r *http.Request) *htt
 
 		// If the cause is one of our own errors, close a potential body and relay the error.
 		cause := context.Cause(cancellableCtx)
-		if (errors.Is(cause, ErrServerShutdown) || errors.Is(cause, ErrUploadInterrupted) || errors.Is(cause, ErrUploadStoppedByServer)) && ctx.body != nil {
-			ctx.body.closeWithError(cause)
+		ctx.bodyLock.Lock()
+		body := ctx.body
+		ctx.bodyLock.Unlock()
+		if (errors.Is(cause, ErrServerShutdown) || errors.Is(cause, ErrUploadInterrupted) || errors.Is(cause, ErrUploadStoppedByServer)) && body != nil {
+			body.closeWithError(cause)
 		}
 	}()
 
 	return ctx
 }
 
+// setBody sets the reader for the request body, which is closed if the request
+// is cancelled.
+func (c *httpContext) setBody(body *bodyReader) {
+	c.bodyLock.Lock()
+	defer c.bodyLock.Unlock()
+
+	c.body = body
+}
+
+// trackStore adds the time since start to the time spent in the data store.
+func (c *httpContext) trackStore(start time.Time) {
+	c.storeDuration.Add(int64(time.Since(start)))
+}
+
 // getContext tries to retrieve a httpContext from the request or constructs a new one.
 func (h UnroutedHandler) getContext(w http.ResponseWriter, r *http.Request) *httpContext {
 	c, ok := r.Context().(*httpContext)
@@ -80,22 +109,35 @@ func (h UnroutedHandler) getContext(w http.ResponseWriter, r *http.Request) *htt
 	return c
 }
 
-func (c httpContext) Value(key any) any {
+func (c *httpContext) Value(key any) any {
 	// We overwrite the Value function to ensure that the values from the request
-	// context are returned because c.Context does not contain any values.
+	// context are returned because c.Context does not contain any values. The only
+	// exception is the internal key used by context.Cause, which must resolve to
+	// c.Context, so that its cancellation cause is reported.
+	if value := c.Context.Value(key); value != nil {
+		return value
+	}
 	return c.req.Context().Value(key)
 }
 
 // newDelayedContext returns a context that is cancelled with a delay. If the parent context
 // is done, the new context will also be cancelled but only after waiting the specified delay.
+// The cause of the parent is retained, so data stores can use context.Cause to tell why they
+// are cancelled. Since the request context is cancelled without a cause if the client
+// disconnects, this case is reported as ErrClientDisconnected.
 // Note: The parent context MUST be cancelled or otherwise this will leak resources. In the
 // case of http.Request.Context, the net/http package ensures that the context is always cancelled.
 func newDelayedContext(parent context.Context, delay time.Duration) context.Context {
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancelCause(context.Background())
 	go func() {
 		<-parent.Done()
 		<-time.After(delay)
-		cancel()
+
+		cause := context.Cause(parent)
+		if cause == context.Canceled {
+			cause = ErrClientDisconnected
+		}
+		cancel(cause)
 	}()
 
 	return ctx
@@ -3,9 +3,11 @@ package handler_test
 import (
 	"context"
 	"fmt"
+	"io"
 	"net/http"
 	"strings"
 	"testing"
+	"testing/iotest"
 	"time"
 
 	"github.com/golang/mock/gomock"
@@ -155,4 +157,93 @@ func TestContext(t *testing.T) {
 			},
 		}).Run(handler, t)
 	})
+
+	SubTest(t, "ClientDisconnected", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				Offset: 10,
+				Size:   40,
+			}, nil),
+			upload.EXPECT().WriteChunk(gomock.Any(), int64(10), gomock.Any()).DoAndReturn(func(ctx context.Context, offset int64, src io.Reader) (int64, error) {
+				<-ctx.Done()
+				assert.ErrorIs(t, context.Cause(ctx), ErrClientDisconnected)
+				return 0, nil
+			}),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:                    composer,
+			GracefulRequestCompletionTimeout: 10 * time.Millisecond,
+		})
+
+		// The request context is cancelled without a cause if the client disconnects.
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			<-time.After(50 * time.Millisecond)
+			cancel()
+		}()
+
+		(&httpTest{
+			Context: ctx,
+			Method:  "PATCH",
+			URL:     "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Upload-Offset": "10",
+				"Content-Type":  "application/offset+octet-stream",
+			},
+			ReqBody: strings.NewReader("hello"),
+			Code:    http.StatusNoContent,
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "BodyAborted", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				Offset: 10,
+				Size:   40,
+			}, nil),
+			upload.EXPECT().WriteChunk(gomock.Any(), int64(10), gomock.Any()).DoAndReturn(func(ctx context.Context, offset int64, src io.Reader) (int64, error) {
+				// The body ends without an error, so the store can save the
+				// received data, and the context is cancelled with a delay.
+				data, err := io.ReadAll(src)
+				assert.NoError(t, err)
+				assert.Equal(t, "hel", string(data))
+
+				<-ctx.Done()
+				assert.ErrorIs(t, context.Cause(ctx), ErrClientDisconnected)
+				return int64(len(data)), nil
+			}),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:                    composer,
+			GracefulRequestCompletionTimeout: 10 * time.Millisecond,
+		})
+
+		(&httpTest{
+			Method: "PATCH",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Upload-Offset": "10",
+				"Content-Type":  "application/offset+octet-stream",
+			},
+			ReqBody: io.MultiReader(strings.NewReader("hel"), iotest.ErrReader(io.ErrUnexpectedEOF)),
+			Code:    http.StatusNoContent,
+			ResHeader: map[string]string{
+				"Upload-Offset": "13",
+			},
+		}).Run(handler, t)
+	})
 }
@@ -23,7 +23,7 @@ func TestCORS(t *testing.T) {
 			},
 			Code: http.StatusOK,
 			ResHeader: map[string]string{
-				"Access-Control-Allow-Headers":     "Authorization, Origin, X-Requested-With, X-Request-ID, X-HTTP-Method-Override, Content-Type, Upload-Length, Upload-Offset, Tus-Resumable, Upload-Metadata, Upload-Defer-Length, Upload-Concat, Upload-Incomplete, Upload-Draft-Interop-Version",
+				"Access-Control-Allow-Headers":     "Authorization, Origin, X-Requested-With, X-Request-ID, X-HTTP-Method-Override, Content-Type, Upload-Length, Upload-Offset, Tus-Resumable, Upload-Metadata, Upload-Defer-Length, Upload-Concat, Upload-Incomplete, Upload-Draft-Interop-Version, Idempotency-Key, Upload-Part-Offset, Upload-Parts-Complete, Upload-Wait, Traceparent, Upload-Encryption-Key, Upload-Encryption-Algorithm, Content-Encoding, Upload-Source-Url",
 				"Access-Control-Allow-Methods":     "POST, HEAD, PATCH, OPTIONS, GET, DELETE",
 				"Access-Control-Max-Age":           "86400",
 				"Access-Control-Allow-Origin":      "https://tus.io",
@@ -40,7 +40,7 @@ func TestCORS(t *testing.T) {
 			},
 			ResHeader: map[string]string{
 				"Access-Control-Allow-Origin":      "https://tus.io",
-				"Access-Control-Expose-Headers":    "Upload-Offset, Location, Upload-Length, Tus-Version, Tus-Resumable, Tus-Max-Size, Tus-Extension, Upload-Metadata, Upload-Defer-Length, Upload-Concat, Upload-Incomplete, Upload-Draft-Interop-Version",
+				"Access-Control-Expose-Headers":    "Upload-Offset, Location, Upload-Length, Tus-Version, Tus-Resumable, Tus-Max-Size, Tus-Extension, Upload-Metadata, Upload-Defer-Length, Upload-Concat, Upload-Incomplete, Upload-Draft-Interop-Version, Upload-Part-Url, Upload-Part-Length, Upload-Part-Expires, Upload-Preferred-Chunk-Size, Upload-Expires, Upload-Source-Status, Upload-Source-Error, Upload-Received, Upload-Rate, Upload-Estimated-Completion",
 				"Vary":                             "Origin",
 				"Access-Control-Allow-Methods":     "",
 				"Access-Control-Allow-Headers":     "",
@@ -72,7 +72,7 @@ func TestCORS(t *testing.T) {
 			},
 			Code: http.StatusOK,
 			ResHeader: map[string]string{
-				"Access-Control-Allow-Headers":     "Authorization, Origin, X-Requested-With, X-Request-ID, X-HTTP-Method-Override, Content-Type, Upload-Length, Upload-Offset, Tus-Resumable, Upload-Metadata, Upload-Defer-Length, Upload-Concat, Upload-Incomplete, Upload-Draft-Interop-Version",
+				"Access-Control-Allow-Headers":     "Authorization, Origin, X-Requested-With, X-Request-ID, X-HTTP-Method-Override, Content-Type, Upload-Length, Upload-Offset, Tus-Resumable, Upload-Metadata, Upload-Defer-Length, Upload-Concat, Upload-Incomplete, Upload-Draft-Interop-Version, Idempotency-Key, Upload-Part-Offset, Upload-Parts-Complete, Upload-Wait, Traceparent, Upload-Encryption-Key, Upload-Encryption-Algorithm, Content-Encoding, Upload-Source-Url",
 				"Access-Control-Allow-Methods":     "POST, HEAD, PATCH, OPTIONS, GET, DELETE",
 				"Access-Control-Max-Age":           "86400",
 				"Access-Control-Allow-Origin":      "http://tus.io",
@@ -89,7 +89,7 @@ func TestCORS(t *testing.T) {
 			},
 			ResHeader: map[string]string{
 				"Access-Control-Allow-Origin":      "http://tus.io",
-				"Access-Control-Expose-Headers":    "Upload-Offset, Location, Upload-Length, Tus-Version, Tus-Resumable, Tus-Max-Size, Tus-Extension, Upload-Metadata, Upload-Defer-Length, Upload-Concat, Upload-Incomplete, Upload-Draft-Interop-Version",
+				"Access-Control-Expose-Headers":    "Upload-Offset, Location, Upload-Length, Tus-Version, Tus-Resumable, Tus-Max-Size, Tus-Extension, Upload-Metadata, Upload-Defer-Length, Upload-Concat, Upload-Incomplete, Upload-Draft-Interop-Version, Upload-Part-Url, Upload-Part-Length, Upload-Part-Expires, Upload-Preferred-Chunk-Size, Upload-Expires, Upload-Source-Status, Upload-Source-Error, Upload-Received, Upload-Rate, Upload-Estimated-Completion",
 				"Vary":                             "Origin",
 				"Access-Control-Allow-Methods":     "",
 				"Access-Control-Allow-Headers":     "",
@@ -3,6 +3,7 @@ package handler
 import (
 	"context"
 	"io"
+	"time"
 )
 
 type MetaData map[string]string
@@ -28,6 +29,20 @@ type FileInfo struct {
 	// ordered slice containing the ids of the uploads of which the final upload
 	// will consist after concatenation.
 	PartialUploads []string
+	// ExpiresAt is the time after which the upload expires, unless it has been
+	// finished by then. It is nil if the upload does not expire. See
+	// Config.UploadExpiry for details.
+	ExpiresAt *time.Time `json:",omitempty"`
+	// Priority influences the order in which data stores process the writes of
+	// concurrent uploads, so that small interactive uploads are not held up by
+	// large batch transfers. Uploads with a higher priority are preferred. It
+	// is zero by default and can be set using FileInfoChanges.Priority or
+	// Config.PriorityMetadataKey. See UploadPriority for details.
+	Priority int `json:",omitempty"`
+	// Checksum is the checksum of the whole file declared by the client and the
+	// result of its verification once the upload is complete. It is nil if no
+	// checksum has been declared. See Config.ChecksumMetadataKey for details.
+	Checksum *UploadChecksum `json:",omitempty"`
 	// Storage contains information about where the data storage saves the upload,
 	// for example a file path. The available values vary depending on what data
 	// store is used. This map may also be nil.
@@ -76,6 +91,20 @@ type FileInfoChanges struct {
 	// Please be aware that this behavior is currently not supported by any data store in
 	// the github.com/tus/tusd package.
 	Storage map[string]string
+
+	// If ExpiresAt is not nil, it replaces the expiration time of the upload, which
+	// is derived from Config.UploadExpiry. This can be used to grant certain uploads
+	// more time. It has no effect if Config.UploadExpiry is not set.
+	ExpiresAt *time.Time
+
+	// If Priority is not nil, it replaces the priority of the upload. This can be
+	// used to prefer interactive uploads over batch transfers. See FileInfo.Priority.
+	Priority *int
+
+	// Tags are assigned to the upload in Config.UploadIndex, so that it can be
+	// found using them later, for example by the ID of the user. They have no
+	// effect if no index is configured.
+	Tags []string
 }
 
 type Upload interface {
@@ -160,6 +189,201 @@ type LengthDeclarableUpload interface {
 	DeclareLength(ctx context.Context, length int64) error
 }
 
+// ListableDataStore is the interface that can be implemented if the data store
+// is able to enumerate its unfinished uploads. It is not used by the handler
+// itself, but allows tools, such as an admin API or a cleanup job, to find
+// uploads without knowing their IDs in advance.
+type ListableDataStore interface {
+	// ListUploads returns the IDs of uploads which have not been finished yet.
+	// The IDs are returned in pages, starting with the first page for an empty
+	// cursor. nextCursor must be passed to the next call and is empty once all
+	// uploads have been listed. A page may contain fewer IDs than others, or
+	// none at all, while nextCursor is not empty.
+	ListUploads(ctx context.Context, cursor string) (ids []string, nextCursor string, err error)
+}
+
+// PresignerDataStore is the interface that can be implemented if the data store
+// is able to provide URLs for downloading an upload's content directly from the
+// storage backend. It is used to redirect download requests, see
+// Config.RedirectDownloads.
+type PresignerDataStore interface {
+	AsPresignableUpload(upload Upload) PresignableUpload
+}
+
+type PresignableUpload interface {
+	// PresignDownloadURL returns a URL from which the content of the finished
+	// upload can be downloaded without further authentication until the URL
+	// expires. Responses from this URL should contain the Content-Type and
+	// Content-Disposition headers from the options.
+	PresignDownloadURL(ctx context.Context, options PresignOptions) (url string, err error)
+}
+
+// PresignOptions contains the parameters for generating a download URL using
+// PresignableUpload.
+type PresignOptions struct {
+	// Method is the HTTP method, for which the URL is valid, either GET or HEAD.
+	// Defaults to GET.
+	Method string
+	// Expiry is the duration for which the URL is valid.
+	Expiry time.Duration
+	// ContentType and ContentDisposition should be used for the respective
+	// headers in responses from the URL.
+	ContentType        string
+	ContentDisposition string
+}
+
+// PartPresignerDataStore is the interface that can be implemented if the data
+// store allows clients to upload the content of an upload directly to the
+// storage backend, while the handler only coordinates the upload. It is used
+// for direct part uploads, see Config.EnableDirectPartUploads. This feature is
+// experimental and its interface may change in the future.
+type PartPresignerDataStore interface {
+	AsPartPresignableUpload(upload Upload) PartPresignableUpload
+}
+
+type PartPresignableUpload interface {
+	// PresignPart returns a URL to which the client can send the part of the
+	// upload starting at the given offset using a PUT request, without further
+	// authentication until the URL expires. The data store decides how the
+	// upload is split into parts, so the offset must be the start of a part and
+	// the part's length is returned alongside the URL. Once the data has been
+	// uploaded to the URL, it must be reflected in the offset reported by
+	// GetInfo.
+	PresignPart(ctx context.Context, offset int64, expiry time.Duration) (url string, length int64, err error)
+}
+
+// ChunkSizeHinterDataStore is the interface that can be implemented if the data
+// store works best when receiving an upload's data in chunks of a certain size,
+// for example because it is split into parts of this size. The handler
+// advertises this size to clients using the Upload-Preferred-Chunk-Size header
+// in responses to creation and HEAD requests.
+type ChunkSizeHinterDataStore interface {
+	// PreferredChunkSize returns the preferred number of bytes per PATCH request
+	// for the given upload. A value of zero indicates no preference.
+	PreferredChunkSize(info FileInfo) int64
+}
+
+// ExpirerDataStore is the interface that can be implemented if the data store
+// is able to change the expiration time of an existing upload. It is used to
+// extend the expiration of uploads which are still being worked on, see
+// Config.UploadExpiry.
+type ExpirerDataStore interface {
+	AsExpirableUpload(upload Upload) ExpirableUpload
+}
+
+type ExpirableUpload interface {
+	// SetExpiration persists the new expiration time of the upload, so that it
+	// is included as FileInfo.ExpiresAt in subsequent calls to GetInfo.
+	SetExpiration(ctx context.Context, expiresAt time.Time) error
+}
+
+// InspectorDataStore is the interface that can be implemented if the data store
+// is able to describe how the data of an unfinished upload is stored, for
+// example to diagnose uploads which do not make progress. It is used by
+// UnroutedHandler.InspectUpload.
+type InspectorDataStore interface {
+	AsInspectableUpload(upload Upload) InspectableUpload
+}
+
+type InspectableUpload interface {
+	// Inspect returns the upload's current storage state. It must query the
+	// storage backend instead of relying on cached information.
+	Inspect(ctx context.Context) (UploadInspection, error)
+}
+
+// UploadInspection describes how the data of an upload is stored.
+type UploadInspection struct {
+	// Parts are the parts of the upload, which have been committed to the
+	// storage backend, ordered by their offset.
+	Parts []InspectedPart
+	// StagedBytes is the number of bytes, which have been received but are kept
+	// separately until enough data for another part is available.
+	StagedBytes int64
+	// Details contains further store-specific information, such as the ID of
+	// the multipart upload.
+	Details map[string]string
+}
+
+// ImporterDataStore is the interface that can be implemented if the data store
+// is able to take over an upload, whose data has been written to the storage
+// backend by another tusd deployment. It is used by UnroutedHandler.ImportUpload.
+type ImporterDataStore interface {
+	// ImportUpload records the upload described by info, which must have been
+	// created by the same kind of data store, using the ID and storage details
+	// from info. It must verify that the upload's data is available to this
+	// store and return ErrInvalidCheckpoint otherwise. Data, which has already
+	// been written, must not be modified.
+	ImportUpload(ctx context.Context, info FileInfo) (Upload, error)
+}
+
+// IngesterDataStore is the interface that can be implemented if the data store
+// is able to create an upload from an existing object in the storage backend
+// without transferring the data through tusd, e.g. using server-side copies. It
+// is used by UnroutedHandler.IngestObject.
+type IngesterDataStore interface {
+	// IngestObject creates a finished upload described by info, whose data is
+	// copied from the object identified by source. The size is taken from the
+	// source object. ErrIngestSourceNotFound must be returned if the object does
+	// not exist. If copying fails, the created upload must be removed again.
+	IngestObject(ctx context.Context, info FileInfo, source IngestSource) (Upload, error)
+}
+
+// IngestSource identifies an existing object, from which an upload is created
+// by IngesterDataStore.
+type IngestSource struct {
+	// Bucket is the bucket or container holding the object. It may belong to
+	// another account than the data store's bucket, if access is granted.
+	Bucket string
+	// Key is the object's key in Bucket.
+	Key string
+	// VersionID selects a specific version of the object. If empty, the current
+	// version is copied.
+	VersionID string
+	// ExpectedOwner is the account, which must own Bucket. If set, copying fails
+	// if the bucket belongs to another account. Not every data store supports it.
+	ExpectedOwner string
+}
+
+// InspectedPart is a committed part of an upload in an UploadInspection.
+type InspectedPart struct {
+	// Number is the part's number as used by the storage backend.
+	Number int64
+	// Offset is the position of the part's first byte in the upload.
+	Offset int64
+	// Size is the part's length in bytes.
+	Size int64
+	// ETag is the part's entity tag, if provided by the storage backend.
+	ETag string
+}
+
+// PartialAppenderDataStore is the interface that can be implemented if the data
+// store is able to record further partial uploads for a final upload after its
+// creation. It is required for final uploads, which are created before their
+// partial uploads are known, see UnroutedHandler.PatchFile.
+type PartialAppenderDataStore interface {
+	AsPartialAppendableUpload(upload Upload) PartialAppendableUpload
+}
+
+type PartialAppendableUpload interface {
+	// AppendPartialUploads persists the IDs of further partial uploads, so that
+	// they are appended to FileInfo.PartialUploads in subsequent calls to GetInfo.
+	AppendPartialUploads(ctx context.Context, ids []string) error
+}
+
+// ChecksumRecorderDataStore is the interface that can be implemented if the data
+// store is able to record the result of verifying the checksum declared by the
+// client, see Config.ChecksumMetadataKey. Without it, uploads not matching
+// their checksum are terminated, if the data store supports termination.
+type ChecksumRecorderDataStore interface {
+	AsChecksumRecordableUpload(upload Upload) ChecksumRecordableUpload
+}
+
+type ChecksumRecordableUpload interface {
+	// RecordChecksum persists the verified checksum of the upload, so that it
+	// is included as FileInfo.Checksum in subsequent calls to GetInfo.
+	RecordChecksum(ctx context.Context, checksum UploadChecksum) error
+}
+
 // Locker is the interface required for custom lock persisting mechanisms.
 // Common ways to store this information is in memory, on disk or using an
 // external service, such as Redis.
@@ -0,0 +1,121 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"sync"
+	"time"
+)
+
+// chunkHashCache remembers the hash of the last chunk written to each upload,
+// see Config.DeduplicateChunks. It is safe for concurrent use.
+type chunkHashCache struct {
+	ttl time.Duration
+
+	lock      sync.Mutex
+	entries   map[string]chunkHash
+	lastPrune time.Time
+}
+
+// chunkHash describes the data which has been written to an upload at offset.
+type chunkHash struct {
+	offset    int64
+	length    int64
+	sum       []byte
+	expiresAt time.Time
+}
+
+func newChunkHashCache(ttl time.Duration) *chunkHashCache {
+	return &chunkHashCache{
+		ttl:       ttl,
+		entries:   make(map[string]chunkHash),
+		lastPrune: time.Now(),
+	}
+}
+
+func (cache *chunkHashCache) get(id string) (chunkHash, bool) {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	entry, ok := cache.entries[id]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return chunkHash{}, false
+	}
+
+	return entry, true
+}
+
+func (cache *chunkHashCache) set(id string, entry chunkHash) {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	now := time.Now()
+	entry.expiresAt = now.Add(cache.ttl)
+	cache.entries[id] = entry
+
+	// Remove expired entries from time to time, so that the map does not grow
+	// indefinitely with abandoned uploads.
+	if now.Sub(cache.lastPrune) > cache.ttl {
+		for k, e := range cache.entries {
+			if now.After(e.expiresAt) {
+				delete(cache.entries, k)
+			}
+		}
+		cache.lastPrune = now
+	}
+}
+
+// skipRetransmission is called for PATCH requests whose offset lies before the
+// upload's offset, which happens if a client did not receive the response to its
+// previous request and sends the same data again. If the request starts with
+// the last chunk written to the upload, this part of the body is compared to
+// the chunk's hash instead of being written again. The remaining body, if any,
+// can then be written at the upload's offset. Otherwise, ErrMismatchOffset is
+// returned.
+func (handler *UnroutedHandler) skipRetransmission(c *httpContext, info FileInfo, offset int64) error {
+	entry, ok := handler.chunkHashes.get(info.ID)
+	if !ok || entry.offset != offset || entry.offset+entry.length != info.Offset || c.req.ContentLength < entry.length || c.req.Body == nil {
+		return ErrMismatchOffset
+	}
+
+	// Read only the retransmitted part. http.MaxBytesReader, which is used by
+	// newBodyReader, would consume an additional byte.
+	body := &bodyReader{
+		ctx:        c,
+		reader:     io.NopCloser(io.LimitReader(c.req.Body, entry.length)),
+		onReadDone: func() { handler.extendNetworkDeadlines(c) },
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, body); err != nil {
+		return err
+	}
+	if err := body.hasError(); err != nil {
+		return err
+	}
+
+	if body.bytesRead() != entry.length || !bytes.Equal(hash.Sum(nil), entry.sum) {
+		return ErrMismatchOffset
+	}
+
+	c.log.Info("RetransmissionSkipped", "offset", offset, "size", entry.length)
+
+	// The remaining body is handled like a request starting at the upload's offset.
+	c.req.ContentLength -= entry.length
+	return nil
+}
+
+// recordChunkHash remembers the hash of the chunk written by the request, if
+// the whole request body has been written.
+func (handler *UnroutedHandler) recordChunkHash(c *httpContext, id string, offset int64, bytesWritten int64) {
+	if c.body.hash == nil || bytesWritten == 0 || bytesWritten != c.body.bytesRead() {
+		return
+	}
+
+	handler.chunkHashes.set(id, chunkHash{
+		offset: offset,
+		length: bytesWritten,
+		sum:    c.body.hash.Sum(nil),
+	})
+}
@@ -0,0 +1,108 @@
+package handler_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	. "github.com/tus/tusd/v2/pkg/handler"
+)
+
+func TestDeduplication(t *testing.T) {
+	// patch sends a PATCH request with the given offset and body.
+	patch := func(handler *Handler, t *testing.T, offset string, body string, code int, resOffset string) {
+		test := &httpTest{
+			Method: "PATCH",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": offset,
+			},
+			ReqBody: strings.NewReader(body),
+			Code:    code,
+		}
+		if resOffset != "" {
+			test.ResHeader = map[string]string{
+				"Upload-Offset": resOffset,
+			}
+		}
+		test.Run(handler, t)
+	}
+
+	SubTest(t, "Retransmission", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{ID: "yes", Offset: 5, Size: 20}, nil),
+			upload.EXPECT().WriteChunk(gomock.Any(), int64(5), NewReaderMatcher("hello")).Return(int64(5), nil),
+			// The same data is sent again and not passed to the data store.
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{ID: "yes", Offset: 10, Size: 20}, nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:     composer,
+			DeduplicateChunks: true,
+		})
+
+		patch(handler, t, "5", "hello", http.StatusNoContent, "10")
+		patch(handler, t, "5", "hello", http.StatusNoContent, "10")
+	})
+
+	SubTest(t, "RetransmissionWithNewData", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{ID: "yes", Offset: 5, Size: 20}, nil),
+			upload.EXPECT().WriteChunk(gomock.Any(), int64(5), NewReaderMatcher("hello")).Return(int64(5), nil),
+			// Only the data following the retransmitted chunk is written.
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{ID: "yes", Offset: 10, Size: 20}, nil),
+			upload.EXPECT().WriteChunk(gomock.Any(), int64(10), NewReaderMatcher("world")).Return(int64(5), nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:     composer,
+			DeduplicateChunks: true,
+		})
+
+		patch(handler, t, "5", "hello", http.StatusNoContent, "10")
+		patch(handler, t, "5", "helloworld", http.StatusNoContent, "15")
+	})
+
+	SubTest(t, "DifferentData", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{ID: "yes", Offset: 5, Size: 20}, nil),
+			upload.EXPECT().WriteChunk(gomock.Any(), int64(5), NewReaderMatcher("hello")).Return(int64(5), nil),
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{ID: "yes", Offset: 10, Size: 20}, nil),
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{ID: "yes", Offset: 10, Size: 20}, nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:     composer,
+			DeduplicateChunks: true,
+		})
+
+		patch(handler, t, "5", "hello", http.StatusNoContent, "10")
+		// The data differs from the previous request ...
+		patch(handler, t, "5", "HELLO", http.StatusConflict, "")
+		// ... or does not start at the previous request's offset.
+		patch(handler, t, "0", "hello", http.StatusConflict, "")
+	})
+}
@@ -0,0 +1,176 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ConcatManifestContentType is the Content-Type of PATCH requests, which attach
+// partial uploads to a final upload, whose partial uploads have been deferred.
+const ConcatManifestContentType = "application/vnd.tusd.concat-manifest+json"
+
+// maxConcatManifestSize limits the size of request bodies containing a manifest.
+const maxConcatManifestSize = 1024 * 1024
+
+// ConcatManifest is the body of PATCH requests, which attach partial uploads to
+// a final upload created using `Upload-Concat: final` without a list of partial
+// uploads. This is not part of the specification.
+type ConcatManifest struct {
+	// Partials are the URLs of the partial uploads, which are appended to the
+	// final upload. The partial uploads must be finished.
+	Partials []string `json:"partials"`
+	// Complete indicates that no further partial uploads will be attached. The
+	// partial uploads are then concatenated and the final upload is finished.
+	Complete bool `json:"complete"`
+}
+
+// attachPartialUploads handles PATCH requests containing a ConcatManifest. It
+// records the partial uploads for the final upload and concatenates them once
+// the manifest is complete. This allows streaming workflows, in which the number
+// of segments is not known when the final upload is created.
+func (handler *UnroutedHandler) attachPartialUploads(c *httpContext) {
+	r := c.req
+
+	id, err := extractIDFromRequest(r)
+	if err != nil {
+		handler.sendError(c, err)
+		return
+	}
+	c.log = c.log.With("id", id)
+
+	var manifest ConcatManifest
+	decoder := json.NewDecoder(io.LimitReader(r.Body, maxConcatManifestSize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&manifest); err != nil {
+		handler.sendError(c, ErrInvalidConcatManifest)
+		return
+	}
+
+	ids := make([]string, 0, len(manifest.Partials))
+	for _, value := range manifest.Partials {
+		partialID, err := extractIDFromPath(strings.TrimSpace(value))
+		if err != nil {
+			handler.sendError(c, err)
+			return
+		}
+		ids = append(ids, partialID)
+	}
+
+	if handler.composer.UsesLocker {
+		lock, err := handler.lockUpload(c, id)
+		if err != nil {
+			handler.sendError(c, err)
+			return
+		}
+
+		defer lock.Unlock()
+	}
+
+	upload, info, err := handler.getUpload(c, id)
+	if err != nil {
+		handler.sendError(c, err)
+		return
+	}
+
+	// Only final uploads, which are still waiting for their partial uploads,
+	// accept a manifest.
+	if !info.IsFinal || !info.SizeIsDeferred {
+		handler.sendError(c, ErrModifyFinal)
+		return
+	}
+
+	if handler.isExpired(info) {
+		handler.sendError(c, ErrUploadExpired)
+		return
+	}
+
+	if len(ids) > 0 {
+		// Check that the new partial uploads are finished before recording them.
+		if _, _, err := handler.sizeOfUploads(c, ids); err != nil {
+			handler.sendError(c, err)
+			return
+		}
+
+		storeStart := time.Now()
+		err := handler.composer.PartialAppender.AsPartialAppendableUpload(upload).AppendPartialUploads(c, ids)
+		c.trackStore(storeStart)
+		if err != nil {
+			handler.sendError(c, err)
+			return
+		}
+		info.PartialUploads = append(info.PartialUploads, ids...)
+		c.log.Info("PartialUploadsAttached", "partials", ids)
+	}
+
+	resp := HTTPResponse{
+		StatusCode: http.StatusNoContent,
+		Header:     HTTPHeader{},
+	}
+
+	if manifest.Complete {
+		if len(info.PartialUploads) == 0 {
+			handler.sendError(c, ErrInvalidConcat)
+			return
+		}
+
+		partialUploads, size, err := handler.sizeOfUploads(c, info.PartialUploads)
+		if err != nil {
+			handler.sendError(c, err)
+			return
+		}
+
+		if handler.config.MaxSize > 0 && size > handler.config.MaxSize {
+			handler.sendError(c, ErrMaxSizeExceeded)
+			return
+		}
+
+		storeStart := time.Now()
+		err = handler.composer.LengthDeferrer.AsLengthDeclarableUpload(upload).DeclareLength(c, size)
+		if err == nil {
+			err = handler.composer.Concater.AsConcatableUpload(upload).ConcatUploads(c, partialUploads)
+		}
+		c.trackStore(storeStart)
+		if err != nil {
+			handler.sendError(c, err)
+			return
+		}
+
+		info.Size = size
+		info.SizeIsDeferred = false
+		info.Offset = size
+		resp.Header["Upload-Length"] = strconv.FormatInt(size, 10)
+
+		c.log.Info("UploadFinished", "size", size)
+		handler.Metrics.incUploadsFinished()
+		handler.Metrics.trackUploadFinished(info.ID, info.Size)
+		handler.updateIndexedUpload(c, c.log, info.ID, info.Offset, UploadStateFinished)
+		handler.completions.notify(info.ID)
+
+		if handler.config.NotifyCompleteUploads {
+			handler.CompleteUploads <- handler.completedUploadEvent(c, upload, info)
+		}
+	}
+
+	resp.Header["Upload-Offset"] = strconv.FormatInt(info.Offset, 10)
+	resp.Header["Upload-Concat"] = handler.concatHeader(r, info)
+
+	handler.sendResp(c, resp)
+}
+
+// concatHeader returns the value of the Upload-Concat header for a final upload.
+// The list of partial uploads is omitted, if none have been attached yet.
+func (handler *UnroutedHandler) concatHeader(r *http.Request, info FileInfo) string {
+	urls := make([]string, len(info.PartialUploads))
+	for i, uploadID := range info.PartialUploads {
+		urls[i] = handler.absFileURL(r, uploadID)
+	}
+
+	if len(urls) == 0 {
+		return "final"
+	}
+	return "final;" + strings.Join(urls, " ")
+}
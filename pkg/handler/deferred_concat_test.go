@@ -0,0 +1,210 @@
+package handler_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	. "github.com/tus/tusd/v2/pkg/handler"
+)
+
+func TestDeferredConcat(t *testing.T) {
+	SubTest(t, "Create", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		composer.UsePartialAppender(store)
+
+		gomock.InOrder(
+			store.EXPECT().NewUpload(gomock.Any(), FileInfo{
+				SizeIsDeferred: true,
+				IsFinal:        true,
+				MetaData:       make(map[string]string),
+			}).Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:             "foo",
+				SizeIsDeferred: true,
+				IsFinal:        true,
+			}, nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			BasePath:      "files",
+			StoreComposer: composer,
+		})
+
+		(&httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Upload-Concat": "final",
+			},
+			Code: http.StatusCreated,
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "CreateWithoutPartialAppender", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		handler, _ := NewHandler(Config{
+			BasePath:      "files",
+			StoreComposer: composer,
+		})
+
+		(&httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Upload-Concat": "final",
+			},
+			Code: http.StatusBadRequest,
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "AttachPartialUploads", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+		uploadB := NewMockFullUpload(ctrl)
+
+		composer.UsePartialAppender(store)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "foo").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:             "foo",
+				SizeIsDeferred: true,
+				IsFinal:        true,
+				PartialUploads: []string{"a"},
+			}, nil),
+			store.EXPECT().GetUpload(gomock.Any(), "b").Return(uploadB, nil),
+			uploadB.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				IsPartial: true,
+				Size:      5,
+				Offset:    5,
+			}, nil),
+			store.EXPECT().AsPartialAppendableUpload(upload).Return(upload),
+			upload.EXPECT().AppendPartialUploads(gomock.Any(), []string{"b"}).Return(nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			BasePath:      "files",
+			StoreComposer: composer,
+		})
+
+		(&httpTest{
+			Method: "PATCH",
+			URL:    "foo",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Content-Type":  ConcatManifestContentType,
+			},
+			ReqBody: strings.NewReader(`{"partials":["http://tus.io/files/b"]}`),
+			Code:    http.StatusNoContent,
+			ResHeader: map[string]string{
+				"Upload-Offset": "0",
+				"Upload-Concat": "final;http://tus.io/files/a http://tus.io/files/b",
+			},
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "Complete", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+		uploadA := NewMockFullUpload(ctrl)
+		uploadB := NewMockFullUpload(ctrl)
+
+		composer.UsePartialAppender(store)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "foo").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:             "foo",
+				SizeIsDeferred: true,
+				IsFinal:        true,
+				PartialUploads: []string{"a", "b"},
+			}, nil),
+			store.EXPECT().GetUpload(gomock.Any(), "a").Return(uploadA, nil),
+			uploadA.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				IsPartial: true,
+				Size:      5,
+				Offset:    5,
+			}, nil),
+			store.EXPECT().GetUpload(gomock.Any(), "b").Return(uploadB, nil),
+			uploadB.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				IsPartial: true,
+				Size:      3,
+				Offset:    3,
+			}, nil),
+			store.EXPECT().AsLengthDeclarableUpload(upload).Return(upload),
+			upload.EXPECT().DeclareLength(gomock.Any(), int64(8)).Return(nil),
+			store.EXPECT().AsConcatableUpload(upload).Return(upload),
+			upload.EXPECT().ConcatUploads(gomock.Any(), []Upload{uploadA, uploadB}).Return(nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			BasePath:              "files",
+			StoreComposer:         composer,
+			NotifyCompleteUploads: true,
+		})
+
+		c := make(chan HookEvent, 1)
+		handler.CompleteUploads = c
+
+		(&httpTest{
+			Method: "PATCH",
+			URL:    "foo",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Content-Type":  ConcatManifestContentType,
+			},
+			ReqBody: strings.NewReader(`{"complete":true}`),
+			Code:    http.StatusNoContent,
+			ResHeader: map[string]string{
+				"Upload-Offset": "8",
+				"Upload-Length": "8",
+			},
+		}).Run(handler, t)
+
+		event := <-c
+		if event.Upload.Size != 8 || event.Upload.SizeIsDeferred {
+			t.Errorf("unexpected upload in event: %+v", event.Upload)
+		}
+	})
+
+	SubTest(t, "NotDeferred", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		composer.UsePartialAppender(store)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "foo").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:             "foo",
+				Size:           10,
+				IsFinal:        true,
+				PartialUploads: []string{"a", "b"},
+			}, nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			BasePath:      "files",
+			StoreComposer: composer,
+		})
+
+		(&httpTest{
+			Method: "PATCH",
+			URL:    "foo",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Content-Type":  ConcatManifestContentType,
+			},
+			ReqBody: strings.NewReader(`{"complete":true}`),
+			Code:    http.StatusForbidden,
+		}).Run(handler, t)
+	})
+}
@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// PostPart handles requests for direct part uploads, see Config.EnableDirectPartUploads.
+// This is not part of the specification and is experimental. It is advertised
+// as the parts extension and only available to clients using ProtocolVersion1_1.
+//
+// A request with the Upload-Part-Offset header asks for a pre-signed URL for the
+// part starting at the given offset. The response contains the URL in the
+// Upload-Part-Url header, the number of bytes which must be sent to it in the
+// Upload-Part-Length header and the URL's expiration in the Upload-Part-Expires
+// header. The part's length must be added to the offset to obtain the offset of
+// the next part.
+//
+// A request with the Upload-Parts-Complete: ?1 header reports that all parts
+// have been sent. The upload is then finished, if the data store has received
+// all of its content.
+func (handler *UnroutedHandler) PostPart(w http.ResponseWriter, r *http.Request) {
+	c := handler.getContext(w, r)
+
+	// Abort the request handling if the required interface is not implemented
+	if !handler.config.EnableDirectPartUploads || !handler.composer.UsesPartPresigner {
+		handler.sendError(c, ErrNotImplemented)
+		return
+	}
+
+	// Direct part uploads are only available to clients using the 1.1 draft
+	if !versionAtLeast(c.version, ProtocolVersion1_1) {
+		handler.sendVersionError(c)
+		return
+	}
+
+	id, err := extractIDFromRequest(r)
+	if err != nil {
+		handler.sendError(c, err)
+		return
+	}
+	c.log = c.log.With("id", id)
+
+	if handler.composer.UsesLocker {
+		lock, err := handler.lockUpload(c, id)
+		if err != nil {
+			handler.sendError(c, err)
+			return
+		}
+
+		defer lock.Unlock()
+	}
+
+	upload, info, err := handler.getUpload(c, id)
+	if err != nil {
+		handler.sendError(c, err)
+		return
+	}
+
+	// Modifying a final upload is not allowed
+	if info.IsFinal {
+		handler.sendError(c, ErrModifyFinal)
+		return
+	}
+
+	if info.SizeIsDeferred {
+		handler.sendError(c, ErrPartUploadDeferredLength)
+		return
+	}
+
+	if r.Header.Get("Upload-Parts-Complete") == "?1" {
+		handler.completeParts(c, upload, info)
+		return
+	}
+
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Part-Offset"), 10, 64)
+	if err != nil || offset < 0 || offset >= info.Size {
+		handler.sendError(c, ErrInvalidPartOffset)
+		return
+	}
+
+	expiry := handler.config.PartURLExpiry
+	url, length, err := handler.composer.PartPresigner.AsPartPresignableUpload(upload).PresignPart(c, offset, expiry)
+	if err != nil {
+		handler.sendError(c, err)
+		return
+	}
+
+	c.log.Info("PartPresigned", "offset", offset, "length", length)
+
+	handler.sendResp(c, HTTPResponse{
+		StatusCode: http.StatusOK,
+		Header: HTTPHeader{
+			"Upload-Part-Url":     url,
+			"Upload-Part-Length":  strconv.FormatInt(length, 10),
+			"Upload-Part-Expires": time.Now().Add(expiry).UTC().Format(http.TimeFormat),
+		},
+	})
+}
+
+// completeParts finishes an upload whose parts have been sent directly to the
+// data store. The upload must not be finished twice, so an upload is only
+// considered complete once the client reports it and not already when the
+// offset reaches the size.
+func (handler *UnroutedHandler) completeParts(c *httpContext, upload Upload, info FileInfo) {
+	if info.Offset != info.Size {
+		handler.sendError(c, ErrUploadIncomplete)
+		return
+	}
+
+	resp := HTTPResponse{
+		StatusCode: http.StatusNoContent,
+		Header: HTTPHeader{
+			"Upload-Offset": strconv.FormatInt(info.Offset, 10),
+		},
+	}
+
+	resp, err := handler.finishUploadIfComplete(c, resp, upload, info)
+	if err != nil {
+		handler.sendError(c, err)
+		return
+	}
+
+	handler.sendResp(c, resp)
+}
@@ -0,0 +1,147 @@
+package handler_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+
+	. "github.com/tus/tusd/v2/pkg/handler"
+)
+
+func TestDirectParts(t *testing.T) {
+	SubTest(t, "Presign", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 5,
+				Size:   20,
+			}, nil),
+			store.EXPECT().AsPartPresignableUpload(upload).Return(upload),
+			upload.EXPECT().PresignPart(gomock.Any(), int64(5), 10*time.Minute).Return("https://bucket.example.com/yes?partNumber=2", int64(5), nil),
+		)
+
+		composer.UsePartPresigner(store)
+		handler, _ := NewHandler(Config{
+			StoreComposer:           composer,
+			EnableDirectPartUploads: true,
+			PartURLExpiry:           10 * time.Minute,
+		})
+
+		(&httpTest{
+			Method: "POST",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable":      "1.1.0",
+				"Upload-Part-Offset": "5",
+			},
+			Code: http.StatusOK,
+			ResHeader: map[string]string{
+				"Upload-Part-Url":    "https://bucket.example.com/yes?partNumber=2",
+				"Upload-Part-Length": "5",
+			},
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "InvalidOffset", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:   "yes",
+				Size: 20,
+			}, nil),
+		)
+
+		composer.UsePartPresigner(store)
+		handler, _ := NewHandler(Config{
+			StoreComposer:           composer,
+			EnableDirectPartUploads: true,
+		})
+
+		(&httpTest{
+			Method: "POST",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable":      "1.1.0",
+				"Upload-Part-Offset": "20",
+			},
+			Code: http.StatusBadRequest,
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "Complete", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 20,
+				Size:   20,
+			}, nil),
+			upload.EXPECT().FinishUpload(gomock.Any()).Return(nil),
+		)
+
+		composer.UsePartPresigner(store)
+		handler, _ := NewHandler(Config{
+			StoreComposer:           composer,
+			EnableDirectPartUploads: true,
+		})
+
+		(&httpTest{
+			Method: "POST",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable":         "1.1.0",
+				"Upload-Parts-Complete": "?1",
+			},
+			Code: http.StatusNoContent,
+			ResHeader: map[string]string{
+				"Upload-Offset": "20",
+			},
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "Incomplete", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 15,
+				Size:   20,
+			}, nil),
+		)
+
+		composer.UsePartPresigner(store)
+		handler, _ := NewHandler(Config{
+			StoreComposer:           composer,
+			EnableDirectPartUploads: true,
+		})
+
+		(&httpTest{
+			Method: "POST",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable":         "1.1.0",
+				"Upload-Parts-Complete": "?1",
+			},
+			Code: http.StatusConflict,
+		}).Run(handler, t)
+	})
+}
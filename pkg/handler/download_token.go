@@ -0,0 +1,227 @@
+package handler
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DownloadTokenOptions configures a download token created by NewDownloadToken.
+type DownloadTokenOptions struct {
+	// Expiry is the duration for which the token is valid.
+	// Defaults to 15min.
+	Expiry time.Duration
+	// IP restricts the token to requests from the network of this client IP
+	// address, see ClientNetwork, so that IPv6 clients can use any address of
+	// their prefix. If empty, the token can be used from any address.
+	IP string
+}
+
+// DownloadToken grants a single GET request for a finished upload, see
+// Config.DownloadTokenSecret.
+type DownloadToken struct {
+	// Token is the signed token, which is sent in the token query parameter.
+	Token string
+	// ExpiresAt is the time after which the token is no longer accepted.
+	ExpiresAt time.Time
+	// URL is the upload's URL including the token. It is relative to the host
+	// serving tusd, unless Config.BasePath is an absolute URL.
+	URL string
+}
+
+// downloadTokenClaims is the signed content of a download token.
+type downloadTokenClaims struct {
+	ID        string `json:"id"`
+	ExpiresAt int64  `json:"exp"`
+	IP        string `json:"ip,omitempty"`
+	// Nonce makes every token unique, so that its use can be recorded.
+	Nonce string `json:"n"`
+}
+
+// NewDownloadToken creates a token, which allows downloading the finished upload
+// with the given ID once using a GET request, without knowing any other
+// credentials. This allows sharing uploads using short-lived links. Requires
+// Config.DownloadTokenSecret.
+func (handler *UnroutedHandler) NewDownloadToken(ctx context.Context, id string, options DownloadTokenOptions) (DownloadToken, error) {
+	if len(handler.config.DownloadTokenSecret) == 0 || handler.config.DisableDownload {
+		return DownloadToken{}, ErrNotImplemented
+	}
+
+	upload, err := handler.composer.Core.GetUpload(ctx, id)
+	if err != nil {
+		return DownloadToken{}, err
+	}
+
+	info, err := upload.GetInfo(ctx)
+	if err != nil {
+		return DownloadToken{}, err
+	}
+
+	if info.SizeIsDeferred || info.Offset != info.Size {
+		return DownloadToken{}, ErrDownloadNotFinished
+	}
+
+	if options.Expiry <= 0 {
+		options.Expiry = 15 * time.Minute
+	}
+
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return DownloadToken{}, err
+	}
+
+	expiresAt := time.Now().Add(options.Expiry)
+	payload, err := json.Marshal(downloadTokenClaims{
+		ID:        id,
+		ExpiresAt: expiresAt.Unix(),
+		IP:        options.IP,
+		Nonce:     hex.EncodeToString(nonce),
+	})
+	if err != nil {
+		return DownloadToken{}, err
+	}
+
+	encodedPayload := base64.RawURLEncoding.EncodeToString(payload)
+	token := encodedPayload + "." + base64.RawURLEncoding.EncodeToString(handler.signDownloadToken(encodedPayload))
+
+	return DownloadToken{
+		Token:     token,
+		ExpiresAt: expiresAt.Truncate(time.Second),
+		URL:       handler.basePath + id + "?token=" + url.QueryEscape(token),
+	}, nil
+}
+
+func (handler *UnroutedHandler) signDownloadToken(encodedPayload string) []byte {
+	mac := hmac.New(sha256.New, handler.config.DownloadTokenSecret)
+	mac.Write([]byte(encodedPayload))
+	return mac.Sum(nil)
+}
+
+// checkDownloadToken verifies the token in the query of a GET request for the
+// upload with the given ID and returns its claims, which must be passed to
+// useDownloadToken once the response starts. Requests without a token are only
+// rejected if Config.RequireDownloadTokens is set. Otherwise, nil claims are
+// returned for them.
+func (handler *UnroutedHandler) checkDownloadToken(c *httpContext, id string) (*downloadTokenClaims, error) {
+	if len(handler.config.DownloadTokenSecret) == 0 {
+		return nil, nil
+	}
+
+	token := c.req.URL.Query().Get("token")
+	if token == "" {
+		if handler.config.RequireDownloadTokens {
+			return nil, ErrDownloadTokenRequired
+		}
+		return nil, nil
+	}
+
+	encodedPayload, encodedSignature, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrInvalidDownloadToken
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil || !hmac.Equal(signature, handler.signDownloadToken(encodedPayload)) {
+		return nil, ErrInvalidDownloadToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return nil, ErrInvalidDownloadToken
+	}
+
+	var claims downloadTokenClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, ErrInvalidDownloadToken
+	}
+
+	if claims.ID != id {
+		return nil, ErrInvalidDownloadToken
+	}
+
+	if time.Now().After(time.Unix(claims.ExpiresAt, 0)) {
+		return nil, ErrDownloadTokenExpired
+	}
+
+	if claims.IP != "" && clientNetwork(claims.IP, handler.config.IPv6PrefixLength) != ClientNetwork(c) {
+		return nil, ErrInvalidDownloadToken
+	}
+
+	if handler.usedTokens.used(claims.Nonce) {
+		return nil, ErrDownloadTokenUsed
+	}
+
+	return &claims, nil
+}
+
+// useDownloadToken marks the token as used, so that failed requests do not
+// consume it. If a concurrent request has used it in the meantime,
+// ErrDownloadTokenUsed is returned. Nil claims are ignored.
+func (handler *UnroutedHandler) useDownloadToken(claims *downloadTokenClaims) error {
+	if claims == nil {
+		return nil
+	}
+
+	if !handler.usedTokens.use(claims.Nonce, time.Unix(claims.ExpiresAt, 0)) {
+		return ErrDownloadTokenUsed
+	}
+
+	return nil
+}
+
+// usedTokenRegistry remembers the download tokens, which have been used, until
+// they expire. It is safe for concurrent use.
+type usedTokenRegistry struct {
+	lock      sync.Mutex
+	tokens    map[string]time.Time
+	lastPrune time.Time
+}
+
+func newUsedTokenRegistry() *usedTokenRegistry {
+	return &usedTokenRegistry{
+		tokens:    make(map[string]time.Time),
+		lastPrune: time.Now(),
+	}
+}
+
+// used returns whether the token with the given nonce has been used.
+func (registry *usedTokenRegistry) used(nonce string) bool {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+
+	_, ok := registry.tokens[nonce]
+	return ok
+}
+
+// use marks the token with the given nonce as used and returns false if it has
+// been used before.
+func (registry *usedTokenRegistry) use(nonce string, expiresAt time.Time) bool {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+
+	if _, ok := registry.tokens[nonce]; ok {
+		return false
+	}
+
+	// Expired tokens are rejected anyway, so they do not need to be remembered.
+	now := time.Now()
+	if now.Sub(registry.lastPrune) > time.Minute {
+		for n, e := range registry.tokens {
+			if now.After(e) {
+				delete(registry.tokens, n)
+			}
+		}
+		registry.lastPrune = now
+	}
+
+	registry.tokens[nonce] = expiresAt
+	return true
+}
@@ -0,0 +1,170 @@
+package handler_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/tus/tusd/v2/pkg/handler"
+)
+
+func TestDownloadTokens(t *testing.T) {
+	SubTest(t, "OneShot", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		finished := FileInfo{ID: "yes", Offset: 5, Size: 5}
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(finished, nil),
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(finished, nil),
+			upload.EXPECT().GetReader(gomock.Any()).Return(io.NopCloser(strings.NewReader("hello")), nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:         composer,
+			BasePath:              "/files/",
+			DownloadTokenSecret:   []byte("secret"),
+			RequireDownloadTokens: true,
+		})
+
+		token, err := handler.NewDownloadToken(context.Background(), "yes", DownloadTokenOptions{
+			Expiry: time.Minute,
+		})
+		a := assert.New(t)
+		a.NoError(err)
+		a.Equal("/files/yes?token="+url.QueryEscape(token.Token), token.URL)
+		a.WithinDuration(time.Now().Add(time.Minute), token.ExpiresAt, 2*time.Second)
+
+		(&httpTest{
+			Method:  "GET",
+			URL:     "yes?token=" + url.QueryEscape(token.Token),
+			Code:    http.StatusOK,
+			ResBody: "hello",
+		}).Run(handler, t)
+
+		// The token can only be used once.
+		(&httpTest{
+			Method: "GET",
+			URL:    "yes?token=" + url.QueryEscape(token.Token),
+			Code:   http.StatusForbidden,
+		}).Run(handler, t)
+
+		(&httpTest{
+			Method: "GET",
+			URL:    "yes",
+			Code:   http.StatusForbidden,
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "InvalidToken", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{ID: "yes", Offset: 5, Size: 5}, nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:       composer,
+			DownloadTokenSecret: []byte("secret"),
+		})
+
+		token, err := handler.NewDownloadToken(context.Background(), "yes", DownloadTokenOptions{
+			IP: "10.0.0.1",
+		})
+		assert.NoError(t, err)
+
+		// The token is bound to another upload.
+		(&httpTest{
+			Method: "GET",
+			URL:    "no?token=" + url.QueryEscape(token.Token),
+			Code:   http.StatusForbidden,
+		}).Run(handler, t)
+
+		// The request does not originate from the token's IP address.
+		(&httpTest{
+			Method: "GET",
+			URL:    "yes?token=" + url.QueryEscape(token.Token),
+			Code:   http.StatusForbidden,
+		}).Run(handler, t)
+
+		// The signature does not match.
+		tampered := strings.Replace(token.Token, ".", ".x", 1)
+		(&httpTest{
+			Method: "GET",
+			URL:    "yes?token=" + url.QueryEscape(tampered),
+			Code:   http.StatusForbidden,
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "KeptOnFailure", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		finished := FileInfo{ID: "yes", Offset: 5, Size: 5}
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(finished, nil),
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(finished, nil),
+			upload.EXPECT().GetReader(gomock.Any()).Return(nil, ErrNotFound),
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(finished, nil),
+			upload.EXPECT().GetReader(gomock.Any()).Return(io.NopCloser(strings.NewReader("hello")), nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:       composer,
+			DownloadTokenSecret: []byte("secret"),
+		})
+
+		token, err := handler.NewDownloadToken(context.Background(), "yes", DownloadTokenOptions{})
+		assert.NoError(t, err)
+
+		// The failed download does not use up the token.
+		(&httpTest{
+			Method: "GET",
+			URL:    "yes?token=" + url.QueryEscape(token.Token),
+			Code:   http.StatusNotFound,
+		}).Run(handler, t)
+
+		(&httpTest{
+			Method:  "GET",
+			URL:     "yes?token=" + url.QueryEscape(token.Token),
+			Code:    http.StatusOK,
+			ResBody: "hello",
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "UnfinishedUpload", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{ID: "yes", Offset: 2, Size: 5}, nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:       composer,
+			DownloadTokenSecret: []byte("secret"),
+		})
+
+		_, err := handler.NewDownloadToken(context.Background(), "yes", DownloadTokenOptions{})
+		assert.Equal(t, ErrDownloadNotFinished, err)
+	})
+}
@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"strings"
+)
+
+// EncryptionAlgorithmAES256 is the only algorithm, which clients can request for
+// their own encryption keys. It is also the default if the client does not send
+// the Upload-Encryption-Algorithm header.
+const EncryptionAlgorithmAES256 = "AES256"
+
+// EncryptionKey is an encryption key supplied by the client for a single request.
+// Data stores supporting customer-provided keys, such as the s3store using SSE-C,
+// use it to encrypt and decrypt the upload's content.
+type EncryptionKey struct {
+	// Algorithm is the encryption algorithm, e.g. AES256.
+	Algorithm string
+	// Key is the raw 256-bit key.
+	Key []byte
+}
+
+type encryptionKeyKey struct{}
+
+// WithEncryptionKey returns a copy of ctx, which carries the encryption key.
+func WithEncryptionKey(ctx context.Context, key EncryptionKey) context.Context {
+	return context.WithValue(ctx, encryptionKeyKey{}, key)
+}
+
+// EncryptionKeyFromContext returns the encryption key, which the client included
+// in the request associated with the context. The key is never persisted by tusd,
+// so data stores must not write it into the upload's info.
+func EncryptionKeyFromContext(ctx context.Context) (EncryptionKey, bool) {
+	key, ok := ctx.Value(encryptionKeyKey{}).(EncryptionKey)
+	return key, ok
+}
+
+// captureEncryptionKey attaches the key from the Upload-Encryption-Key header to
+// the request's context. The headers are removed from the request afterwards, so
+// that the key does not reach hooks, captured headers or logs.
+func (handler *UnroutedHandler) captureEncryptionKey(r *http.Request) (*http.Request, error) {
+	value := r.Header.Get("Upload-Encryption-Key")
+	algorithm := r.Header.Get("Upload-Encryption-Algorithm")
+	r.Header.Del("Upload-Encryption-Key")
+	r.Header.Del("Upload-Encryption-Algorithm")
+
+	if value == "" {
+		if algorithm != "" {
+			return r, ErrInvalidEncryptionKey
+		}
+		return r, nil
+	}
+
+	if !handler.config.AcceptEncryptionKeys {
+		return r, ErrEncryptionKeyNotAccepted
+	}
+
+	if algorithm == "" {
+		algorithm = EncryptionAlgorithmAES256
+	}
+	if algorithm != EncryptionAlgorithmAES256 {
+		return r, ErrInvalidEncryptionKey
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+	if err != nil || len(key) != 32 {
+		return r, ErrInvalidEncryptionKey
+	}
+
+	return r.WithContext(WithEncryptionKey(r.Context(), EncryptionKey{
+		Algorithm: algorithm,
+		Key:       key,
+	})), nil
+}
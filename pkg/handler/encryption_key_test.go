@@ -0,0 +1,108 @@
+package handler_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"net/http"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/tus/tusd/v2/pkg/handler"
+)
+
+func TestEncryptionKey(t *testing.T) {
+	key := bytes.Repeat([]byte{0x42}, 32)
+	encodedKey := base64.StdEncoding.EncodeToString(key)
+
+	SubTest(t, "Forward", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		var receivedKey EncryptionKey
+		gomock.InOrder(
+			store.EXPECT().NewUpload(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, info FileInfo) (Upload, error) {
+				receivedKey, _ = EncryptionKeyFromContext(ctx)
+				return upload, nil
+			}),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:   "foo",
+				Size: 300,
+			}, nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:        composer,
+			BasePath:             "/files/",
+			AcceptEncryptionKeys: true,
+			NotifyCreatedUploads: true,
+		})
+
+		c := make(chan HookEvent, 1)
+		handler.CreatedUploads = c
+
+		(&httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable":               "1.0.0",
+				"Upload-Length":               "300",
+				"Upload-Encryption-Key":       encodedKey,
+				"Upload-Encryption-Algorithm": "AES256",
+			},
+			Code: http.StatusCreated,
+		}).Run(handler, t)
+
+		event := <-c
+
+		a := assert.New(t)
+		a.Equal(EncryptionKey{Algorithm: "AES256", Key: key}, receivedKey)
+		a.Empty(event.HTTPRequest.Header.Get("Upload-Encryption-Key"))
+		a.Empty(event.HTTPRequest.Header.Get("Upload-Encryption-Algorithm"))
+	})
+
+	SubTest(t, "Invalid", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		handler, _ := NewHandler(Config{
+			StoreComposer:        composer,
+			BasePath:             "/files/",
+			AcceptEncryptionKeys: true,
+		})
+
+		for _, headers := range []map[string]string{
+			{"Upload-Encryption-Key": "not base64"},
+			{"Upload-Encryption-Key": base64.StdEncoding.EncodeToString(key[:16])},
+			{"Upload-Encryption-Key": encodedKey, "Upload-Encryption-Algorithm": "aws:kms"},
+			{"Upload-Encryption-Algorithm": "AES256"},
+		} {
+			headers["Tus-Resumable"] = "1.0.0"
+			headers["Upload-Length"] = "300"
+
+			(&httpTest{
+				Method:    "POST",
+				ReqHeader: headers,
+				Code:      http.StatusBadRequest,
+				ResBody:   "ERR_INVALID_ENCRYPTION_KEY: invalid Upload-Encryption-Key or Upload-Encryption-Algorithm header\n",
+			}).Run(handler, t)
+		}
+	})
+
+	SubTest(t, "NotAccepted", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+			BasePath:      "/files/",
+		})
+
+		(&httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable":         "1.0.0",
+				"Upload-Length":         "300",
+				"Upload-Encryption-Key": encodedKey,
+			},
+			Code:    http.StatusBadRequest,
+			ResBody: "ERR_ENCRYPTION_KEY_NOT_ACCEPTED: server does not accept encryption keys from clients\n",
+		}).Run(handler, t)
+	})
+}
@@ -1,5 +1,13 @@
 package handler
 
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
 // Error represents an error with the intent to be sent in the HTTP
 // response to the client. Therefore, it also contains a HTTPResponse,
 // next to an error code and error message.
@@ -18,6 +26,19 @@ func (e1 Error) Is(target error) bool {
 	return ok && e1.ErrorCode == e2.ErrorCode
 }
 
+// Retryable reports whether the client can expect the request to succeed if
+// it is repeated later, for example after the upload has been unlocked or
+// the storage backend is no longer overloaded. This is derived from the status code.
+func (e Error) Retryable() bool {
+	switch e.HTTPResponse.StatusCode {
+	case http.StatusRequestTimeout, http.StatusLocked, http.StatusTooManyRequests, StatusClientClosedRequest,
+		http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout, StatusNetworkReadTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
 // NewError constructs a new Error object with the given error code and message.
 // The corresponding HTTP response will have the provided status code
 // and a body consisting of the error details.
@@ -35,3 +56,59 @@ func NewError(errCode string, message string, statusCode int) Error {
 		},
 	}
 }
+
+// jsonErrorBody is the representation of an Error for clients which accept
+// JSON responses.
+type jsonErrorBody struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Retryable bool   `json:"retryable"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// jsonResponse returns the error's HTTP response with a JSON body instead of
+// plain text. Bodies that have been customized, for example by a hook, are
+// left untouched.
+func (e Error) jsonResponse(requestID string) HTTPResponse {
+	if e.HTTPResponse.Body != e.ErrorCode+": "+e.Message+"\n" {
+		return e.HTTPResponse
+	}
+
+	body, err := json.Marshal(jsonErrorBody{
+		Code:      e.ErrorCode,
+		Message:   e.Message,
+		Retryable: e.Retryable(),
+		RequestID: requestID,
+	})
+	if err != nil {
+		return e.HTTPResponse
+	}
+
+	return e.HTTPResponse.MergeWith(HTTPResponse{
+		Body: string(body) + "\n",
+		Header: HTTPHeader{
+			"Content-Type": "application/json",
+		},
+	})
+}
+
+// acceptsJSON checks whether the Accept header of the request lists JSON as
+// an acceptable media type.
+func acceptsJSON(r *http.Request) bool {
+	for _, value := range r.Header.Values("Accept") {
+		for _, mediaRange := range strings.Split(value, ",") {
+			mediaType, params, err := mime.ParseMediaType(mediaRange)
+			if err != nil {
+				continue
+			}
+			if q, err := strconv.ParseFloat(params["q"], 64); err == nil && q == 0 {
+				continue
+			}
+			if mediaType == "application/json" {
+				return true
+			}
+		}
+	}
+
+	return false
+}
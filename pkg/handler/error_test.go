@@ -0,0 +1,107 @@
+package handler_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/tus/tusd/v2/pkg/handler"
+)
+
+func TestErrorResponse(t *testing.T) {
+	SubTest(t, "PlainText", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		store.EXPECT().GetUpload(gomock.Any(), "no").Return(nil, ErrNotFound)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+		})
+
+		(&httpTest{
+			Method: "GET",
+			URL:    "no",
+			Code:   http.StatusNotFound,
+			ResHeader: map[string]string{
+				"Content-Type": "text/plain; charset=utf-8",
+			},
+			ResBody: "ERR_UPLOAD_NOT_FOUND: upload not found\n",
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "JSON", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		store.EXPECT().GetUpload(gomock.Any(), "no").Return(nil, ErrNotFound)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+		})
+
+		(&httpTest{
+			Method: "GET",
+			URL:    "no",
+			ReqHeader: map[string]string{
+				"Accept":       "text/html, application/json;q=0.9",
+				"X-Request-ID": "request-123",
+			},
+			Code: http.StatusNotFound,
+			ResHeader: map[string]string{
+				"Content-Type": "application/json",
+			},
+			ResBody: `{"code":"ERR_UPLOAD_NOT_FOUND","message":"upload not found","retryable":false,"request_id":"request-123"}` + "\n",
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "JSONRetryable", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		store.EXPECT().GetUpload(gomock.Any(), "locked").Return(nil, ErrFileLocked)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+		})
+
+		(&httpTest{
+			Method: "GET",
+			URL:    "locked",
+			ReqHeader: map[string]string{
+				"Accept": "application/json",
+			},
+			Code:    http.StatusLocked,
+			ResBody: `{"code":"ERR_UPLOAD_LOCKED","message":"file currently locked","retryable":true}` + "\n",
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "JSONRejected", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		store.EXPECT().GetUpload(gomock.Any(), "no").Return(nil, ErrNotFound)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+		})
+
+		(&httpTest{
+			Method: "GET",
+			URL:    "no",
+			ReqHeader: map[string]string{
+				"Accept": "application/json;q=0, text/plain",
+			},
+			Code:    http.StatusNotFound,
+			ResBody: "ERR_UPLOAD_NOT_FOUND: upload not found\n",
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "JSONCustomBody", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		err := NewError("ERR_CUSTOM", "custom error", http.StatusForbidden)
+		err.HTTPResponse.Body = "custom body"
+		store.EXPECT().GetUpload(gomock.Any(), "no").Return(nil, err)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+		})
+
+		(&httpTest{
+			Method: "GET",
+			URL:    "no",
+			ReqHeader: map[string]string{
+				"Accept": "application/json",
+			},
+			Code:    http.StatusForbidden,
+			ResBody: "custom body",
+		}).Run(handler, t)
+	})
+}
@@ -0,0 +1,155 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// newExpiration returns the expiration time for an upload, which is created or
+// extended now, or nil if uploads do not expire.
+func (handler *UnroutedHandler) newExpiration() *time.Time {
+	if handler.config.UploadExpiry <= 0 {
+		return nil
+	}
+
+	// Upload-Expires only has a precision of seconds.
+	expiresAt := time.Now().Add(handler.config.UploadExpiry).UTC().Truncate(time.Second)
+	return &expiresAt
+}
+
+// isExpired returns whether the upload has not been finished before its
+// expiration time.
+func (handler *UnroutedHandler) isExpired(info FileInfo) bool {
+	if handler.config.UploadExpiry <= 0 || info.ExpiresAt == nil {
+		return false
+	}
+
+	isFinished := !info.SizeIsDeferred && info.Offset == info.Size
+	return !isFinished && time.Now().After(*info.ExpiresAt)
+}
+
+// setExpiresHeader adds the Upload-Expires header to the response, if the
+// upload is unfinished and expires.
+func (handler *UnroutedHandler) setExpiresHeader(resp HTTPResponse, info FileInfo) {
+	if handler.config.UploadExpiry <= 0 || info.ExpiresAt == nil {
+		return
+	}
+
+	if !info.SizeIsDeferred && info.Offset == info.Size {
+		return
+	}
+
+	resp.Header["Upload-Expires"] = info.ExpiresAt.UTC().Format(http.TimeFormat)
+}
+
+// renewExpiration extends the expiration of an unfinished upload while it receives
+// data. To avoid updating the data store for every request, this only happens
+// once less than half of Config.UploadExpiry remains, or if the request has no
+// body, which clients can use to explicitly keep a paused upload alive.
+func (handler *UnroutedHandler) renewExpiration(c *httpContext, upload Upload, info *FileInfo) error {
+	if handler.config.UploadExpiry <= 0 || !handler.composer.UsesExpirer || info.ExpiresAt == nil {
+		return nil
+	}
+
+	length := c.req.ContentLength
+	if !info.SizeIsDeferred && info.Offset+length >= info.Size {
+		// The request finishes the upload, so it will not expire anymore.
+		return nil
+	}
+
+	if length != 0 && time.Until(*info.ExpiresAt) > handler.config.UploadExpiry/2 {
+		return nil
+	}
+
+	expiresAt := handler.newExpiration()
+	if err := handler.composer.Expirer.AsExpirableUpload(upload).SetExpiration(c, *expiresAt); err != nil {
+		return err
+	}
+
+	info.ExpiresAt = expiresAt
+	c.log.Info("UploadExpirationExtended", "expiresAt", *expiresAt)
+	handler.updateIndexedExpiration(c, c.log, info.ID, *expiresAt)
+	return nil
+}
+
+// ExtendUpload sets the expiration time of the upload with the given ID from the
+// server-side, for example from a hook or as part of an administrative action.
+// This requires a data store implementing ExpirerDataStore. The upload's lock is
+// not acquired, so that requests which are currently writing to the upload are
+// not interrupted.
+func (handler *UnroutedHandler) ExtendUpload(ctx context.Context, id string, expiresAt time.Time) error {
+	if !handler.composer.UsesExpirer {
+		return ErrNotImplemented
+	}
+
+	upload, err := handler.composer.Core.GetUpload(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := handler.composer.Expirer.AsExpirableUpload(upload).SetExpiration(ctx, expiresAt.UTC()); err != nil {
+		return err
+	}
+
+	handler.updateIndexedExpiration(ctx, handler.logger.With("id", id), id, expiresAt)
+	return nil
+}
+
+// TerminateExpiredUploads terminates the unfinished uploads, which have
+// expired, and returns their IDs. The expired uploads are looked up in
+// Config.UploadIndex, which must implement ExpiringUploadIndex, and their
+// expiration is verified using the data store before they are terminated. This
+// requires a data store implementing TerminaterDataStore. Uploads which cannot
+// be inspected or terminated do not stop the process, but their errors are
+// returned together.
+func (handler *UnroutedHandler) TerminateExpiredUploads(ctx context.Context) ([]string, error) {
+	index, ok := handler.config.UploadIndex.(ExpiringUploadIndex)
+	if !ok || !handler.composer.UsesTerminater || handler.config.UploadExpiry <= 0 {
+		return nil, ErrNotImplemented
+	}
+
+	ids, err := index.ExpiredUploads(ctx, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	var terminated []string
+	var errs []error
+	for _, id := range ids {
+		upload, err := handler.composer.Core.GetUpload(ctx, id)
+		if errors.Is(err, ErrNotFound) {
+			// The upload has been removed from the data store without the
+			// handler, so the index can forget about it.
+			handler.updateIndexedUpload(ctx, handler.logger.With("id", id), id, 0, UploadStateTerminated)
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", id, err))
+			continue
+		}
+
+		info, err := upload.GetInfo(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", id, err))
+			continue
+		}
+
+		// The expiration may have been extended without the index noticing.
+		if !handler.isExpired(info) {
+			handler.updateIndexedExpiration(ctx, handler.logger.With("id", id), id, indexedExpiration(info))
+			continue
+		}
+
+		if err := handler.TerminateUpload(ctx, id); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", id, err))
+			continue
+		}
+
+		terminated = append(terminated, id)
+	}
+
+	return terminated, errors.Join(errs...)
+}
@@ -0,0 +1,225 @@
+package handler_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/tus/tusd/v2/pkg/handler"
+)
+
+func TestExpiration(t *testing.T) {
+	SubTest(t, "Create", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		var expiresAt time.Time
+		gomock.InOrder(
+			store.EXPECT().NewUpload(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, info FileInfo) (Upload, error) {
+				expiresAt = *info.ExpiresAt
+				return upload, nil
+			}),
+			upload.EXPECT().GetInfo(gomock.Any()).DoAndReturn(func(ctx context.Context) (FileInfo, error) {
+				return FileInfo{
+					ID:        "foo",
+					Size:      300,
+					ExpiresAt: &expiresAt,
+				}, nil
+			}),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+			BasePath:      "/files/",
+			UploadExpiry:  time.Hour,
+		})
+
+		res := (&httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Upload-Length": "300",
+			},
+			Code: http.StatusCreated,
+		}).Run(handler, t)
+
+		a := assert.New(t)
+		a.WithinDuration(time.Now().Add(time.Hour), expiresAt, time.Minute)
+		a.Equal(expiresAt.Format(http.TimeFormat), res.Header().Get("Upload-Expires"))
+	})
+
+	SubTest(t, "Expired", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		expiresAt := time.Now().Add(-time.Minute)
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:        "yes",
+				Offset:    5,
+				Size:      20,
+				ExpiresAt: &expiresAt,
+			}, nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+			UploadExpiry:  time.Hour,
+		})
+
+		(&httpTest{
+			Method: "HEAD",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+			},
+			Code: http.StatusGone,
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "Extend", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		expiresAt := time.Now().Add(50 * time.Minute)
+		var extendedAt time.Time
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:        "yes",
+				Offset:    5,
+				Size:      20,
+				ExpiresAt: &expiresAt,
+			}, nil),
+			store.EXPECT().AsExpirableUpload(upload).Return(upload),
+			upload.EXPECT().SetExpiration(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, expiresAt time.Time) error {
+				extendedAt = expiresAt
+				return nil
+			}),
+			upload.EXPECT().WriteChunk(gomock.Any(), int64(5), NewReaderMatcher("")).Return(int64(0), nil),
+		)
+
+		composer.UseExpirer(store)
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+			UploadExpiry:  time.Hour,
+		})
+
+		// A request without a body extends the expiration ...
+		res := (&httpTest{
+			Method: "PATCH",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": "5",
+			},
+			ReqBody: strings.NewReader(""),
+			Code:    http.StatusNoContent,
+		}).Run(handler, t)
+
+		a := assert.New(t)
+		a.WithinDuration(time.Now().Add(time.Hour), extendedAt, time.Minute)
+		a.Equal(extendedAt.Format(http.TimeFormat), res.Header().Get("Upload-Expires"))
+
+		// ... while a request with a body only does so once less than half of
+		// the expiry remains.
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:        "yes",
+				Offset:    5,
+				Size:      20,
+				ExpiresAt: &expiresAt,
+			}, nil),
+			upload.EXPECT().WriteChunk(gomock.Any(), int64(5), NewReaderMatcher("hello")).Return(int64(5), nil),
+		)
+
+		(&httpTest{
+			Method: "PATCH",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": "5",
+			},
+			ReqBody: strings.NewReader("hello"),
+			Code:    http.StatusNoContent,
+			ResHeader: map[string]string{
+				"Upload-Expires": expiresAt.UTC().Format(http.TimeFormat),
+			},
+		}).Run(handler, t)
+	})
+	SubTest(t, "TerminateExpired", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		expired := NewMockFullUpload(ctrl)
+		extended := NewMockFullUpload(ctrl)
+
+		ctx := context.Background()
+		past := time.Now().Add(-time.Minute).UTC()
+		future := time.Now().Add(time.Hour).UTC()
+
+		index := NewMemoryUploadIndex()
+		for _, id := range []string{"expired", "extended", "removed"} {
+			index.AddUpload(ctx, IndexEntry{
+				ID:        id,
+				Size:      20,
+				State:     UploadStateInProgress,
+				ExpiresAt: past,
+			})
+		}
+
+		expiredInfo := FileInfo{
+			ID:        "expired",
+			Offset:    5,
+			Size:      20,
+			ExpiresAt: &past,
+		}
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "expired").Return(expired, nil),
+			expired.EXPECT().GetInfo(gomock.Any()).Return(expiredInfo, nil),
+			store.EXPECT().GetUpload(gomock.Any(), "expired").Return(expired, nil),
+			expired.EXPECT().GetInfo(gomock.Any()).Return(expiredInfo, nil),
+			store.EXPECT().AsTerminatableUpload(expired).Return(expired),
+			expired.EXPECT().Terminate(gomock.Any()).Return(nil),
+			store.EXPECT().GetUpload(gomock.Any(), "extended").Return(extended, nil),
+			extended.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:        "extended",
+				Offset:    5,
+				Size:      20,
+				ExpiresAt: &future,
+			}, nil),
+			store.EXPECT().GetUpload(gomock.Any(), "removed").Return(nil, ErrNotFound),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+			UploadExpiry:  time.Hour,
+			UploadIndex:   index,
+		})
+
+		a := assert.New(t)
+		ids, err := handler.TerminateExpiredUploads(ctx)
+		a.NoError(err)
+		a.Equal([]string{"expired"}, ids)
+
+		// The index is updated, so that the uploads are not returned again.
+		ids, err = index.ExpiredUploads(ctx, time.Now())
+		a.NoError(err)
+		a.Empty(ids)
+
+		entries, _, err := index.SearchUploads(ctx, IndexQuery{State: UploadStateTerminated})
+		a.NoError(err)
+		a.Len(entries, 2)
+	})
+}
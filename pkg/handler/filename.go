@@ -0,0 +1,131 @@
+package handler
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// defaultMaxFilenameLength is the maximum length of sanitized file names in bytes,
+// matching the limit of most file systems.
+const defaultMaxFilenameLength = 255
+
+// FilenamePolicy controls how file names provided by clients, usually in the
+// "filename" metadata key, are sanitized before they are used in response headers
+// or for deriving object keys in a storage backend.
+type FilenamePolicy struct {
+	// DisableNormalization disables the Unicode NFC normalization of file names.
+	// Without normalization, visually identical names, such as those sent by
+	// macOS clients in decomposed form, are not considered equal.
+	DisableNormalization bool
+	// AllowDirectories keeps directory components, so that "photos/cat.jpg" is
+	// not reduced to "cat.jpg". Empty, "." and ".." components are removed in
+	// any case, so that a name can never point outside of its parent directory.
+	AllowDirectories bool
+	// MaxLength is the maximum length of a sanitized file name in bytes. Longer
+	// names are shortened while preserving their extension.
+	// Defaults to 255.
+	MaxLength int
+}
+
+// Sanitize returns a cleaned-up version of the file name, which is safe for
+// use in headers and object keys. Control characters and invalid UTF-8
+// sequences are removed, path components that could be used for path traversal
+// are stripped and the result is normalized and shortened according to the
+// policy. If nothing remains of the name, an empty string is returned.
+func (policy FilenamePolicy) Sanitize(filename string) string {
+	filename = strings.ToValidUTF8(filename, "")
+	if !policy.DisableNormalization {
+		filename = norm.NFC.String(filename)
+	}
+
+	filename = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, filename)
+
+	// Clients on Windows might use backslashes as separators.
+	components := strings.FieldsFunc(filename, func(r rune) bool {
+		return r == '/' || r == '\\'
+	})
+
+	cleaned := make([]string, 0, len(components))
+	for _, component := range components {
+		component = strings.TrimSpace(component)
+		if component == "" || component == "." || component == ".." {
+			continue
+		}
+		cleaned = append(cleaned, component)
+	}
+
+	if len(cleaned) == 0 {
+		return ""
+	}
+	if !policy.AllowDirectories {
+		cleaned = cleaned[len(cleaned)-1:]
+	}
+
+	maxLength := policy.MaxLength
+	if maxLength <= 0 {
+		maxLength = defaultMaxFilenameLength
+	}
+
+	return truncateFilename(strings.Join(cleaned, "/"), maxLength)
+}
+
+// truncateFilename shortens the file name to at most maxLength bytes without
+// splitting a UTF-8 sequence. The extension is kept if possible.
+func truncateFilename(filename string, maxLength int) string {
+	if len(filename) <= maxLength {
+		return filename
+	}
+
+	ext := ""
+	if i := strings.LastIndexByte(filename, '.'); i > 0 && len(filename)-i < maxLength/2 {
+		ext = filename[i:]
+		filename = filename[:i]
+	}
+
+	filename = filename[:maxLength-len(ext)]
+	for len(filename) > 0 && !utf8.ValidString(filename) {
+		filename = filename[:len(filename)-1]
+	}
+
+	return filename + ext
+}
+
+// ContentDisposition returns the value for a Content-Disposition header with
+// the given disposition type (e.g. "inline" or "attachment") and file name.
+// Names with characters outside of printable ASCII are additionally encoded
+// according to RFC 5987 using the filename* parameter, while the filename
+// parameter contains an ASCII fallback for older clients.
+// See https://datatracker.ietf.org/doc/html/rfc6266#section-4.3
+func ContentDisposition(disposition string, filename string) string {
+	if filename == "" {
+		return disposition
+	}
+
+	fallback := strings.Map(func(r rune) rune {
+		if r < 0x20 || r > 0x7e {
+			return '_'
+		}
+		return r
+	}, filename)
+
+	value := disposition + ";filename=" + strconv.Quote(fallback)
+	if fallback != filename {
+		// PathEscape leaves a few characters unescaped which are not allowed
+		// as attr-chars in RFC 5987, so these are escaped manually.
+		encoded := url.PathEscape(filename)
+		encoded = strings.NewReplacer(":", "%3A", "=", "%3D", "@", "%40").Replace(encoded)
+		value += ";filename*=UTF-8''" + encoded
+	}
+
+	return value
+}
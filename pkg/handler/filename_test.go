@@ -0,0 +1,44 @@
+package handler_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/tus/tusd/v2/pkg/handler"
+)
+
+func TestFilenamePolicy(t *testing.T) {
+	a := assert.New(t)
+	policy := FilenamePolicy{}
+
+	a.Equal("report.pdf", policy.Sanitize("report.pdf"))
+	a.Equal("passwd", policy.Sanitize("../../etc/passwd"))
+	a.Equal("boot.ini", policy.Sanitize("..\\..\\boot.ini"))
+	a.Equal("", policy.Sanitize("../.."))
+	a.Equal("invoice.pdf", policy.Sanitize("in\x00voi\nce.pdf"))
+	a.Equal("写真 2023.jpg", policy.Sanitize("写真 2023.jpg"))
+	a.Equal("😀🎉.png", policy.Sanitize("😀🎉.png"))
+
+	// Decomposed characters, as sent by macOS clients, are composed
+	a.Equal("caf\u00e9.txt", policy.Sanitize("cafe\u0301.txt"))
+	a.Equal("cafe\u0301.txt", FilenamePolicy{DisableNormalization: true}.Sanitize("cafe\u0301.txt"))
+
+	a.Equal("photos/cat.jpg", FilenamePolicy{AllowDirectories: true}.Sanitize("../photos//./cat.jpg"))
+
+	// Long names are shortened without splitting characters and keep their extension
+	long := policy.Sanitize(strings.Repeat("日", 100) + ".txt")
+	a.Equal(strings.Repeat("日", 83)+".txt", long)
+	a.Equal("abcdef.txt", FilenamePolicy{MaxLength: 10}.Sanitize("abcdefgh.txt"))
+}
+
+func TestContentDisposition(t *testing.T) {
+	a := assert.New(t)
+
+	a.Equal("attachment", ContentDisposition("attachment", ""))
+	a.Equal(`inline;filename="cat.jpg"`, ContentDisposition("inline", "cat.jpg"))
+	a.Equal(`attachment;filename="a\"b.txt"`, ContentDisposition("attachment", `a"b.txt`))
+	a.Equal(`attachment;filename="__.txt";filename*=UTF-8''%E5%86%99%E7%9C%9F.txt`, ContentDisposition("attachment", "写真.txt"))
+	a.Equal(`attachment;filename="_ a=b.png";filename*=UTF-8''%F0%9F%98%80%20a%3Db.png`, ContentDisposition("attachment", "😀 a=b.png"))
+}
@@ -1,9 +1,11 @@
 package handler_test
 
 import (
+	"io"
 	"net/http"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	. "github.com/tus/tusd/v2/pkg/handler"
@@ -164,4 +166,102 @@ func TestGet(t *testing.T) {
 			ResBody: "",
 		}).Run(handler, t)
 	})
+
+	SubTest(t, "SanitizedFilename", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				Offset: 0,
+				MetaData: map[string]string{
+					"filename": "../../Berichtu\u0308ber.pdf",
+				},
+			}, nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+		})
+
+		(&httpTest{
+			Method: "GET",
+			URL:    "yes",
+			ResHeader: map[string]string{
+				"Content-Disposition": `attachment;filename="Bericht_ber.pdf";filename*=UTF-8''Bericht%C3%BCber.pdf`,
+			},
+			Code:    http.StatusNoContent,
+			ResBody: "",
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "Redirect", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				Offset: 5,
+				Size:   5,
+				MetaData: map[string]string{
+					"filetype": "image/jpeg",
+					"filename": "cat.jpg",
+				},
+			}, nil),
+			store.EXPECT().AsPresignableUpload(upload).Return(upload),
+			upload.EXPECT().PresignDownloadURL(gomock.Any(), PresignOptions{
+				Expiry:             15 * time.Minute,
+				ContentType:        "image/jpeg",
+				ContentDisposition: `inline;filename="cat.jpg"`,
+			}).Return("https://bucket.example.com/yes?signature=abc", nil),
+		)
+
+		composer.UsePresigner(store)
+		handler, _ := NewHandler(Config{
+			StoreComposer:     composer,
+			RedirectDownloads: true,
+		})
+
+		(&httpTest{
+			Method: "GET",
+			URL:    "yes",
+			Code:   http.StatusFound,
+			ResHeader: map[string]string{
+				"Location": "https://bucket.example.com/yes?signature=abc",
+			},
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "RedirectUnfinished", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				Offset: 5,
+				Size:   20,
+			}, nil),
+			upload.EXPECT().GetReader(gomock.Any()).Return(io.NopCloser(strings.NewReader("hello")), nil),
+		)
+
+		composer.UsePresigner(store)
+		handler, _ := NewHandler(Config{
+			StoreComposer:     composer,
+			RedirectDownloads: true,
+		})
+
+		// Unfinished uploads are still served by tusd
+		(&httpTest{
+			Method:  "GET",
+			URL:     "yes",
+			Code:    http.StatusOK,
+			ResBody: "hello",
+		}).Run(handler, t)
+	})
 }
@@ -37,16 +37,8 @@ func NewHandler(config Config) (*Handler, error) {
 
 	routedHandler.Handler = handler.Middleware(mux)
 
-	mux.Post("", http.HandlerFunc(handler.PostFile))
-	mux.Head(":id", http.HandlerFunc(handler.HeadFile))
-	mux.Add("PATCH", ":id", http.HandlerFunc(handler.PatchFile))
-	if !config.DisableDownload {
-		mux.Get(":id", http.HandlerFunc(handler.GetFile))
-	}
-
-	// Only attach the DELETE handler if the Terminate() method is provided
-	if config.StoreComposer.UsesTerminater && !config.DisableTermination {
-		mux.Del(":id", http.HandlerFunc(handler.DelFile))
+	for _, route := range handler.routes(":id") {
+		mux.Add(route.Method, route.Pattern, route.Handler)
 	}
 
 	return routedHandler, nil
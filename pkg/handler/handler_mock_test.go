@@ -8,6 +8,7 @@ import (
 	context "context"
 	io "io"
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 	handler "github.com/tus/tusd/v2/pkg/handler"
@@ -36,6 +37,20 @@ func (m *MockFullDataStore) EXPECT() *MockFullDataStoreMockRecorder {
 	return m.recorder
 }
 
+// AsChecksumRecordableUpload mocks base method.
+func (m *MockFullDataStore) AsChecksumRecordableUpload(upload handler.Upload) handler.ChecksumRecordableUpload {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AsChecksumRecordableUpload", upload)
+	ret0, _ := ret[0].(handler.ChecksumRecordableUpload)
+	return ret0
+}
+
+// AsChecksumRecordableUpload indicates an expected call of AsChecksumRecordableUpload.
+func (mr *MockFullDataStoreMockRecorder) AsChecksumRecordableUpload(upload interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AsChecksumRecordableUpload", reflect.TypeOf((*MockFullDataStore)(nil).AsChecksumRecordableUpload), upload)
+}
+
 // AsConcatableUpload mocks base method.
 func (m *MockFullDataStore) AsConcatableUpload(upload handler.Upload) handler.ConcatableUpload {
 	m.ctrl.T.Helper()
@@ -50,6 +65,34 @@ func (mr *MockFullDataStoreMockRecorder) AsConcatableUpload(upload interface{})
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AsConcatableUpload", reflect.TypeOf((*MockFullDataStore)(nil).AsConcatableUpload), upload)
 }
 
+// AsExpirableUpload mocks base method.
+func (m *MockFullDataStore) AsExpirableUpload(upload handler.Upload) handler.ExpirableUpload {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AsExpirableUpload", upload)
+	ret0, _ := ret[0].(handler.ExpirableUpload)
+	return ret0
+}
+
+// AsExpirableUpload indicates an expected call of AsExpirableUpload.
+func (mr *MockFullDataStoreMockRecorder) AsExpirableUpload(upload interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AsExpirableUpload", reflect.TypeOf((*MockFullDataStore)(nil).AsExpirableUpload), upload)
+}
+
+// AsInspectableUpload mocks base method.
+func (m *MockFullDataStore) AsInspectableUpload(upload handler.Upload) handler.InspectableUpload {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AsInspectableUpload", upload)
+	ret0, _ := ret[0].(handler.InspectableUpload)
+	return ret0
+}
+
+// AsInspectableUpload indicates an expected call of AsInspectableUpload.
+func (mr *MockFullDataStoreMockRecorder) AsInspectableUpload(upload interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AsInspectableUpload", reflect.TypeOf((*MockFullDataStore)(nil).AsInspectableUpload), upload)
+}
+
 // AsLengthDeclarableUpload mocks base method.
 func (m *MockFullDataStore) AsLengthDeclarableUpload(upload handler.Upload) handler.LengthDeclarableUpload {
 	m.ctrl.T.Helper()
@@ -64,6 +107,48 @@ func (mr *MockFullDataStoreMockRecorder) AsLengthDeclarableUpload(upload interfa
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AsLengthDeclarableUpload", reflect.TypeOf((*MockFullDataStore)(nil).AsLengthDeclarableUpload), upload)
 }
 
+// AsPartPresignableUpload mocks base method.
+func (m *MockFullDataStore) AsPartPresignableUpload(upload handler.Upload) handler.PartPresignableUpload {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AsPartPresignableUpload", upload)
+	ret0, _ := ret[0].(handler.PartPresignableUpload)
+	return ret0
+}
+
+// AsPartPresignableUpload indicates an expected call of AsPartPresignableUpload.
+func (mr *MockFullDataStoreMockRecorder) AsPartPresignableUpload(upload interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AsPartPresignableUpload", reflect.TypeOf((*MockFullDataStore)(nil).AsPartPresignableUpload), upload)
+}
+
+// AsPartialAppendableUpload mocks base method.
+func (m *MockFullDataStore) AsPartialAppendableUpload(upload handler.Upload) handler.PartialAppendableUpload {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AsPartialAppendableUpload", upload)
+	ret0, _ := ret[0].(handler.PartialAppendableUpload)
+	return ret0
+}
+
+// AsPartialAppendableUpload indicates an expected call of AsPartialAppendableUpload.
+func (mr *MockFullDataStoreMockRecorder) AsPartialAppendableUpload(upload interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AsPartialAppendableUpload", reflect.TypeOf((*MockFullDataStore)(nil).AsPartialAppendableUpload), upload)
+}
+
+// AsPresignableUpload mocks base method.
+func (m *MockFullDataStore) AsPresignableUpload(upload handler.Upload) handler.PresignableUpload {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AsPresignableUpload", upload)
+	ret0, _ := ret[0].(handler.PresignableUpload)
+	return ret0
+}
+
+// AsPresignableUpload indicates an expected call of AsPresignableUpload.
+func (mr *MockFullDataStoreMockRecorder) AsPresignableUpload(upload interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AsPresignableUpload", reflect.TypeOf((*MockFullDataStore)(nil).AsPresignableUpload), upload)
+}
+
 // AsTerminatableUpload mocks base method.
 func (m *MockFullDataStore) AsTerminatableUpload(upload handler.Upload) handler.TerminatableUpload {
 	m.ctrl.T.Helper()
@@ -93,6 +178,52 @@ func (mr *MockFullDataStoreMockRecorder) GetUpload(ctx, id interface{}) *gomock.
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUpload", reflect.TypeOf((*MockFullDataStore)(nil).GetUpload), ctx, id)
 }
 
+// ImportUpload mocks base method.
+func (m *MockFullDataStore) ImportUpload(ctx context.Context, info handler.FileInfo) (handler.Upload, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ImportUpload", ctx, info)
+	ret0, _ := ret[0].(handler.Upload)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ImportUpload indicates an expected call of ImportUpload.
+func (mr *MockFullDataStoreMockRecorder) ImportUpload(ctx, info interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ImportUpload", reflect.TypeOf((*MockFullDataStore)(nil).ImportUpload), ctx, info)
+}
+
+// IngestObject mocks base method.
+func (m *MockFullDataStore) IngestObject(ctx context.Context, info handler.FileInfo, source handler.IngestSource) (handler.Upload, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IngestObject", ctx, info, source)
+	ret0, _ := ret[0].(handler.Upload)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// IngestObject indicates an expected call of IngestObject.
+func (mr *MockFullDataStoreMockRecorder) IngestObject(ctx, info, source interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IngestObject", reflect.TypeOf((*MockFullDataStore)(nil).IngestObject), ctx, info, source)
+}
+
+// ListUploads mocks base method.
+func (m *MockFullDataStore) ListUploads(ctx context.Context, cursor string) ([]string, string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListUploads", ctx, cursor)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(string)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// ListUploads indicates an expected call of ListUploads.
+func (mr *MockFullDataStoreMockRecorder) ListUploads(ctx, cursor interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListUploads", reflect.TypeOf((*MockFullDataStore)(nil).ListUploads), ctx, cursor)
+}
+
 // NewUpload mocks base method.
 func (m *MockFullDataStore) NewUpload(ctx context.Context, info handler.FileInfo) (handler.Upload, error) {
 	m.ctrl.T.Helper()
@@ -108,6 +239,20 @@ func (mr *MockFullDataStoreMockRecorder) NewUpload(ctx, info interface{}) *gomoc
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NewUpload", reflect.TypeOf((*MockFullDataStore)(nil).NewUpload), ctx, info)
 }
 
+// PreferredChunkSize mocks base method.
+func (m *MockFullDataStore) PreferredChunkSize(info handler.FileInfo) int64 {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PreferredChunkSize", info)
+	ret0, _ := ret[0].(int64)
+	return ret0
+}
+
+// PreferredChunkSize indicates an expected call of PreferredChunkSize.
+func (mr *MockFullDataStoreMockRecorder) PreferredChunkSize(info interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PreferredChunkSize", reflect.TypeOf((*MockFullDataStore)(nil).PreferredChunkSize), info)
+}
+
 // MockFullUpload is a mock of FullUpload interface.
 type MockFullUpload struct {
 	ctrl     *gomock.Controller
@@ -131,6 +276,20 @@ func (m *MockFullUpload) EXPECT() *MockFullUploadMockRecorder {
 	return m.recorder
 }
 
+// AppendPartialUploads mocks base method.
+func (m *MockFullUpload) AppendPartialUploads(ctx context.Context, ids []string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AppendPartialUploads", ctx, ids)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AppendPartialUploads indicates an expected call of AppendPartialUploads.
+func (mr *MockFullUploadMockRecorder) AppendPartialUploads(ctx, ids interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AppendPartialUploads", reflect.TypeOf((*MockFullUpload)(nil).AppendPartialUploads), ctx, ids)
+}
+
 // ConcatUploads mocks base method.
 func (m *MockFullUpload) ConcatUploads(ctx context.Context, partialUploads []handler.Upload) error {
 	m.ctrl.T.Helper()
@@ -203,6 +362,80 @@ func (mr *MockFullUploadMockRecorder) GetReader(ctx interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetReader", reflect.TypeOf((*MockFullUpload)(nil).GetReader), ctx)
 }
 
+// Inspect mocks base method.
+func (m *MockFullUpload) Inspect(ctx context.Context) (handler.UploadInspection, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Inspect", ctx)
+	ret0, _ := ret[0].(handler.UploadInspection)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Inspect indicates an expected call of Inspect.
+func (mr *MockFullUploadMockRecorder) Inspect(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Inspect", reflect.TypeOf((*MockFullUpload)(nil).Inspect), ctx)
+}
+
+// PresignDownloadURL mocks base method.
+func (m *MockFullUpload) PresignDownloadURL(ctx context.Context, options handler.PresignOptions) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PresignDownloadURL", ctx, options)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PresignDownloadURL indicates an expected call of PresignDownloadURL.
+func (mr *MockFullUploadMockRecorder) PresignDownloadURL(ctx, options interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PresignDownloadURL", reflect.TypeOf((*MockFullUpload)(nil).PresignDownloadURL), ctx, options)
+}
+
+// PresignPart mocks base method.
+func (m *MockFullUpload) PresignPart(ctx context.Context, offset int64, expiry time.Duration) (string, int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PresignPart", ctx, offset, expiry)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(int64)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// PresignPart indicates an expected call of PresignPart.
+func (mr *MockFullUploadMockRecorder) PresignPart(ctx, offset, expiry interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PresignPart", reflect.TypeOf((*MockFullUpload)(nil).PresignPart), ctx, offset, expiry)
+}
+
+// RecordChecksum mocks base method.
+func (m *MockFullUpload) RecordChecksum(ctx context.Context, checksum handler.UploadChecksum) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RecordChecksum", ctx, checksum)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RecordChecksum indicates an expected call of RecordChecksum.
+func (mr *MockFullUploadMockRecorder) RecordChecksum(ctx, checksum interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RecordChecksum", reflect.TypeOf((*MockFullUpload)(nil).RecordChecksum), ctx, checksum)
+}
+
+// SetExpiration mocks base method.
+func (m *MockFullUpload) SetExpiration(ctx context.Context, expiresAt time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetExpiration", ctx, expiresAt)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetExpiration indicates an expected call of SetExpiration.
+func (mr *MockFullUploadMockRecorder) SetExpiration(ctx, expiresAt interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetExpiration", reflect.TypeOf((*MockFullUpload)(nil).SetExpiration), ctx, expiresAt)
+}
+
 // Terminate mocks base method.
 func (m *MockFullUpload) Terminate(ctx context.Context) error {
 	m.ctrl.T.Helper()
@@ -26,6 +26,14 @@ type HookEvent struct {
 	// HTTPRequest contains details about the HTTP request that reached
 	// tusd.
 	HTTPRequest HTTPRequest
+	// ByteBudget contains the usage of the bucket's transfer budget for
+	// notifications sent on the ByteBudgetWarnings channel. It is nil for
+	// other events.
+	ByteBudget *ByteBudgetUsage `json:",omitempty"`
+	// PresignedURLs contains URLs for reading the upload's content for
+	// notifications sent on the CompleteUploads channel, if
+	// Config.PresignCompletedUploads is enabled. It is nil otherwise.
+	PresignedURLs *PresignedURLs `json:",omitempty"`
 }
 
 func newHookEvent(c *httpContext, info FileInfo) HookEvent {
@@ -5,6 +5,17 @@ import (
 	"strconv"
 )
 
+// Non-standard status codes, which are used by CDNs and reverse proxies and are
+// returned if Config.ClientAbortStatusCodes is enabled.
+const (
+	// StatusClientClosedRequest indicates that the client closed the connection
+	// before the request was complete.
+	StatusClientClosedRequest = 499
+	// StatusNetworkReadTimeout indicates that the request's body did not arrive
+	// in time.
+	StatusNetworkReadTimeout = 598
+)
+
 // HTTPRequest contains basic details of an incoming HTTP request.
 type HTTPRequest struct {
 	// Method is the HTTP method, e.g. POST or PATCH.
@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// IdempotencyCache remembers which upload has been created for an Idempotency-Key
+// header, so that retried creation requests can be answered with the existing
+// upload instead of creating a duplicate. Entries should be forgotten after a
+// reasonable amount of time.
+//
+// The keys passed to the cache are derived from the header, the principal making
+// the request and the headers describing the upload, so that a key sent by one
+// client cannot be used to look up the upload of another client.
+type IdempotencyCache interface {
+	// Reserve atomically claims the key for a creation request. If an upload
+	// has already been created for the key, its ID is returned and reserved is
+	// false. If the key is unknown or has expired, it is reserved for the caller
+	// and reserved is true. If another request holds the reservation, id is
+	// empty and reserved is false.
+	Reserve(ctx context.Context, key string) (id string, reserved bool, err error)
+	// Set records that the upload with the given ID was created for the key,
+	// completing its reservation.
+	Set(ctx context.Context, key string, id string) error
+	// Release forgets the key, for example because creating the upload failed or
+	// the upload recorded for it does not exist anymore.
+	Release(ctx context.Context, key string) error
+}
+
+// MemoryIdempotencyCache is an IdempotencyCache which keeps the keys in memory.
+// It is only suitable if a single tusd instance handles all requests.
+type MemoryIdempotencyCache struct {
+	ttl time.Duration
+
+	mutex   sync.Mutex
+	entries map[string]idempotencyEntry
+}
+
+type idempotencyEntry struct {
+	// id is empty while the key is reserved by a request creating the upload.
+	id        string
+	expiresAt time.Time
+}
+
+// NewMemoryIdempotencyCache creates a new in-memory cache whose entries expire
+// after the given TTL.
+func NewMemoryIdempotencyCache(ttl time.Duration) *MemoryIdempotencyCache {
+	return &MemoryIdempotencyCache{
+		ttl:     ttl,
+		entries: make(map[string]idempotencyEntry),
+	}
+}
+
+func (cache *MemoryIdempotencyCache) Reserve(ctx context.Context, key string) (string, bool, error) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	now := time.Now()
+	entry, ok := cache.entries[key]
+	if ok && now.Before(entry.expiresAt) {
+		return entry.id, false, nil
+	}
+
+	// Remove expired entries, so that the map does not grow indefinitely.
+	for k, entry := range cache.entries {
+		if now.After(entry.expiresAt) {
+			delete(cache.entries, k)
+		}
+	}
+
+	cache.entries[key] = idempotencyEntry{
+		expiresAt: now.Add(cache.ttl),
+	}
+
+	return "", true, nil
+}
+
+func (cache *MemoryIdempotencyCache) Set(ctx context.Context, key string, id string) error {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	cache.entries[key] = idempotencyEntry{
+		id:        id,
+		expiresAt: time.Now().Add(cache.ttl),
+	}
+
+	return nil
+}
+
+func (cache *MemoryIdempotencyCache) Release(ctx context.Context, key string) error {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	delete(cache.entries, key)
+	return nil
+}
@@ -0,0 +1,240 @@
+package handler_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/tus/tusd/v2/pkg/handler"
+)
+
+func TestIdempotencyKey(t *testing.T) {
+	SubTest(t, "Replay", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().NewUpload(gomock.Any(), FileInfo{
+				Size:     300,
+				MetaData: map[string]string{},
+			}).Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:   "foo",
+				Size: 300,
+			}, nil),
+			store.EXPECT().GetUpload(gomock.Any(), "foo").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:     "foo",
+				Size:   300,
+				Offset: 100,
+			}, nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:    composer,
+			BasePath:         "/files/",
+			IdempotencyCache: NewMemoryIdempotencyCache(time.Minute),
+		})
+
+		test := &httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable":   "1.0.0",
+				"Upload-Length":   "300",
+				"Idempotency-Key": "abc",
+			},
+			Code: http.StatusCreated,
+			ResHeader: map[string]string{
+				"Location": "http://tus.io/files/foo",
+			},
+		}
+		test.Run(handler, t)
+
+		// The retried request must not create a new upload
+		test.ResHeader["Upload-Offset"] = "100"
+		test.Run(handler, t)
+	})
+
+	SubTest(t, "ReplayUploadNotFound", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().NewUpload(gomock.Any(), gomock.Any()).Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:   "gone",
+				Size: 300,
+			}, nil),
+			store.EXPECT().GetUpload(gomock.Any(), "gone").Return(nil, ErrNotFound),
+			store.EXPECT().NewUpload(gomock.Any(), gomock.Any()).Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:   "foo",
+				Size: 300,
+			}, nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:    composer,
+			BasePath:         "/files/",
+			IdempotencyCache: NewMemoryIdempotencyCache(time.Minute),
+		})
+
+		test := &httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable":   "1.0.0",
+				"Upload-Length":   "300",
+				"Idempotency-Key": "abc",
+			},
+			Code: http.StatusCreated,
+			ResHeader: map[string]string{
+				"Location": "http://tus.io/files/gone",
+			},
+		}
+		test.Run(handler, t)
+
+		// The first upload has been removed, so a new one is created.
+		test.ResHeader["Location"] = "http://tus.io/files/foo"
+		test.Run(handler, t)
+	})
+
+	SubTest(t, "ScopedToPrincipalAndRequest", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().NewUpload(gomock.Any(), gomock.Any()).Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{ID: "alice-upload", Size: 300}, nil),
+			store.EXPECT().NewUpload(gomock.Any(), gomock.Any()).Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{ID: "bob-upload", Size: 300}, nil),
+			store.EXPECT().NewUpload(gomock.Any(), gomock.Any()).Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{ID: "other-upload", Size: 400}, nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:    composer,
+			BasePath:         "/files/",
+			IdempotencyCache: NewMemoryIdempotencyCache(time.Minute),
+			ResolvePrincipal: func(r *http.Request) (string, error) {
+				return r.Header.Get("X-User"), nil
+			},
+		})
+
+		for _, test := range []struct {
+			user     string
+			length   string
+			location string
+		}{
+			{"alice", "300", "http://tus.io/files/alice-upload"},
+			// Another principal sending the same key gets its own upload.
+			{"bob", "300", "http://tus.io/files/bob-upload"},
+			// A request for a different upload does not replay the first one.
+			{"alice", "400", "http://tus.io/files/other-upload"},
+		} {
+			(&httpTest{
+				Method: "POST",
+				ReqHeader: map[string]string{
+					"Tus-Resumable":   "1.0.0",
+					"Upload-Length":   test.length,
+					"Idempotency-Key": "abc",
+					"X-User":          test.user,
+				},
+				Code: http.StatusCreated,
+				ResHeader: map[string]string{
+					"Location": test.location,
+				},
+			}).Run(handler, t)
+		}
+	})
+
+	SubTest(t, "ReleasedOnFailure", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().NewUpload(gomock.Any(), gomock.Any()).Return(nil, errors.New("unavailable")),
+			store.EXPECT().NewUpload(gomock.Any(), gomock.Any()).Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{ID: "foo", Size: 300}, nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:    composer,
+			BasePath:         "/files/",
+			IdempotencyCache: NewMemoryIdempotencyCache(time.Minute),
+		})
+
+		test := &httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable":   "1.0.0",
+				"Upload-Length":   "300",
+				"Idempotency-Key": "abc",
+			},
+			Code: http.StatusInternalServerError,
+		}
+		test.Run(handler, t)
+
+		// The retry is not blocked by the reservation of the failed request.
+		test.Code = http.StatusCreated
+		test.ResHeader = map[string]string{
+			"Location": "http://tus.io/files/foo",
+		}
+		test.Run(handler, t)
+	})
+
+	SubTest(t, "InvalidKey", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		handler, _ := NewHandler(Config{
+			StoreComposer:    composer,
+			IdempotencyCache: NewMemoryIdempotencyCache(time.Minute),
+		})
+
+		(&httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable":   "1.0.0",
+				"Upload-Length":   "300",
+				"Idempotency-Key": strings.Repeat("a", 256),
+			},
+			Code: http.StatusBadRequest,
+		}).Run(handler, t)
+	})
+
+	t.Run("CacheReservation", func(t *testing.T) {
+		a := assert.New(t)
+		ctx := context.Background()
+		cache := NewMemoryIdempotencyCache(10 * time.Millisecond)
+
+		id, reserved, err := cache.Reserve(ctx, "abc")
+		a.NoError(err)
+		a.True(reserved)
+		a.Equal("", id)
+
+		// The key is held by the first request.
+		id, reserved, err = cache.Reserve(ctx, "abc")
+		a.NoError(err)
+		a.False(reserved)
+		a.Equal("", id)
+
+		a.NoError(cache.Set(ctx, "abc", "foo"))
+		id, reserved, err = cache.Reserve(ctx, "abc")
+		a.NoError(err)
+		a.False(reserved)
+		a.Equal("foo", id)
+
+		time.Sleep(20 * time.Millisecond)
+
+		_, reserved, err = cache.Reserve(ctx, "abc")
+		a.NoError(err)
+		a.True(reserved)
+	})
+}
@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"context"
+	"time"
+)
+
+// IngestObject creates a finished upload from an existing object in the storage
+// backend, e.g. in another bucket, without routing the data through tusd or a
+// client. This requires a data store implementing IngesterDataStore. The
+// upload's size is taken from the source object, while its metadata is taken
+// from info. The new upload is added to the upload index, if one is configured.
+// Hooks are not invoked, since no client is involved.
+func (handler *UnroutedHandler) IngestObject(ctx context.Context, source IngestSource, info FileInfo) (FileInfo, error) {
+	if !handler.composer.UsesIngester {
+		return FileInfo{}, ErrNotImplemented
+	}
+
+	// Ingested uploads are finished, so they do not expire.
+	upload, err := handler.composer.Ingester.IngestObject(ctx, FileInfo{
+		ID:       info.ID,
+		MetaData: info.MetaData,
+		Priority: info.Priority,
+	}, source)
+	if err != nil {
+		return FileInfo{}, err
+	}
+
+	info, err = upload.GetInfo(ctx)
+	if err != nil {
+		return FileInfo{}, err
+	}
+
+	if handler.config.UploadIndex != nil {
+		now := time.Now().UTC()
+		err := handler.config.UploadIndex.AddUpload(ctx, IndexEntry{
+			ID:        info.ID,
+			Size:      info.Size,
+			Offset:    info.Offset,
+			MetaData:  info.MetaData,
+			State:     UploadStateFinished,
+			CreatedAt: now,
+			UpdatedAt: now,
+		})
+		if err != nil {
+			handler.logger.Warn("UploadIndexError", "id", info.ID, "error", err)
+		}
+	}
+
+	handler.Metrics.incUploadsCreated()
+	handler.Metrics.incUploadsFinished()
+	handler.logger.Info("UploadIngested", "id", info.ID, "size", info.Size, "sourceBucket", source.Bucket, "sourceKey", source.Key)
+
+	return info, nil
+}
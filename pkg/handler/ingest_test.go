@@ -0,0 +1,77 @@
+package handler_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/tus/tusd/v2/pkg/handler"
+)
+
+func TestIngestObject(t *testing.T) {
+	source := IngestSource{
+		Bucket: "other-bucket",
+		Key:    "videos/intro.mp4",
+	}
+
+	SubTest(t, "Success", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		info := FileInfo{
+			ID:       "yes",
+			Size:     500,
+			Offset:   500,
+			MetaData: MetaData{"filename": "intro.mp4"},
+		}
+		gomock.InOrder(
+			store.EXPECT().IngestObject(gomock.Any(), FileInfo{
+				MetaData: MetaData{"filename": "intro.mp4"},
+			}, source).Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(info, nil),
+		)
+
+		composer.UseIngester(store)
+		index := NewMemoryUploadIndex()
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+			UploadIndex:   index,
+		})
+
+		a := assert.New(t)
+		ingested, err := handler.IngestObject(context.Background(), source, FileInfo{
+			MetaData: MetaData{"filename": "intro.mp4"},
+		})
+		a.NoError(err)
+		a.Equal(info, ingested)
+
+		entries, _, err := index.SearchUploads(context.Background(), IndexQuery{})
+		a.NoError(err)
+		a.Equal(1, len(entries))
+		a.Equal(UploadStateFinished, entries[0].State)
+	})
+
+	SubTest(t, "SourceNotFound", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		store.EXPECT().IngestObject(gomock.Any(), FileInfo{}, source).Return(nil, ErrIngestSourceNotFound)
+
+		composer.UseIngester(store)
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+		})
+
+		_, err := handler.IngestObject(context.Background(), source, FileInfo{})
+		assert.Equal(t, ErrIngestSourceNotFound, err)
+	})
+
+	SubTest(t, "NotImplemented", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+		})
+
+		_, err := handler.IngestObject(context.Background(), source, FileInfo{})
+		assert.Equal(t, ErrNotImplemented, err)
+	})
+}
@@ -0,0 +1,33 @@
+package handler
+
+import "context"
+
+// InspectUpload returns the information about the upload with the given ID
+// together with a description of how its data is stored, such as the parts
+// committed to the storage backend and the bytes staged for the next part. This
+// helps diagnosing uploads which do not make progress. The upload is not locked,
+// so requests writing to it are not interrupted, but the result may be outdated
+// by the time it is returned. This requires a data store implementing
+// InspectorDataStore.
+func (handler *UnroutedHandler) InspectUpload(ctx context.Context, id string) (FileInfo, UploadInspection, error) {
+	if !handler.composer.UsesInspector {
+		return FileInfo{}, UploadInspection{}, ErrNotImplemented
+	}
+
+	upload, err := handler.composer.Core.GetUpload(ctx, id)
+	if err != nil {
+		return FileInfo{}, UploadInspection{}, err
+	}
+
+	info, err := upload.GetInfo(ctx)
+	if err != nil {
+		return FileInfo{}, UploadInspection{}, err
+	}
+
+	inspection, err := handler.composer.Inspector.AsInspectableUpload(upload).Inspect(ctx)
+	if err != nil {
+		return FileInfo{}, UploadInspection{}, err
+	}
+
+	return info, inspection, nil
+}
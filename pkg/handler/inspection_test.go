@@ -0,0 +1,57 @@
+package handler_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/tus/tusd/v2/pkg/handler"
+)
+
+func TestInspectUpload(t *testing.T) {
+	SubTest(t, "Inspect", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		inspection := UploadInspection{
+			Parts: []InspectedPart{
+				{Number: 1, Offset: 0, Size: 100},
+			},
+			StagedBytes: 20,
+		}
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 120,
+				Size:   500,
+			}, nil),
+			store.EXPECT().AsInspectableUpload(upload).Return(upload),
+			upload.EXPECT().Inspect(gomock.Any()).Return(inspection, nil),
+		)
+
+		composer.UseInspector(store)
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+		})
+
+		info, result, err := handler.InspectUpload(context.Background(), "yes")
+		a := assert.New(t)
+		a.NoError(err)
+		a.Equal(int64(120), info.Offset)
+		a.Equal(inspection, result)
+	})
+
+	SubTest(t, "NotImplemented", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+		})
+
+		_, _, err := handler.InspectUpload(context.Background(), "yes")
+		assert.Equal(t, ErrNotImplemented, err)
+	})
+}
@@ -0,0 +1,136 @@
+package handler
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// MaintenanceWindow is a period in which new uploads are rejected, for example
+// while the storage is migrated.
+type MaintenanceWindow struct {
+	Start time.Time
+	End   time.Time
+}
+
+// MaintenanceSettings configures when new uploads are rejected.
+type MaintenanceSettings struct {
+	// Enabled rejects new uploads until the maintenance mode is disabled again.
+	Enabled bool
+	// Message replaces the message of ErrMaintenance in the responses, e.g. to
+	// tell users when uploads will be possible again.
+	Message string
+	// RetryAfter is sent to clients in the Retry-After header while Enabled is
+	// set. If zero, the header is omitted. Within a window, the time until its
+	// end is sent instead.
+	RetryAfter time.Duration
+	// Windows are scheduled periods in which new uploads are rejected, even if
+	// Enabled is not set.
+	Windows []MaintenanceWindow
+}
+
+// Maintenance controls whether new uploads are rejected with ErrMaintenance.
+// Uploads which have already been created can still be resumed, so that they
+// can finish before the maintenance starts. The settings can be changed while
+// the handler is running and a Maintenance can be shared by multiple handlers.
+type Maintenance struct {
+	lock     sync.RWMutex
+	settings MaintenanceSettings
+}
+
+// NewMaintenance creates a Maintenance using the given settings.
+func NewMaintenance(settings MaintenanceSettings) *Maintenance {
+	m := &Maintenance{}
+	m.Set(settings)
+	return m
+}
+
+// Settings returns the current settings.
+func (m *Maintenance) Settings() MaintenanceSettings {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	settings := m.settings
+	settings.Windows = append([]MaintenanceWindow(nil), settings.Windows...)
+	return settings
+}
+
+// Set replaces the settings.
+func (m *Maintenance) Set(settings MaintenanceSettings) {
+	windows := append([]MaintenanceWindow(nil), settings.Windows...)
+	sort.Slice(windows, func(i, j int) bool {
+		return windows[i].Start.Before(windows[j].Start)
+	})
+	settings.Windows = windows
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.settings = settings
+}
+
+// Active reports whether new uploads are rejected at the given time. If the
+// rejection ends at a known time, it is returned as until.
+func (m *Maintenance) Active(now time.Time) (active bool, until time.Time) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	// The windows are sorted by their start, so overlapping and adjacent
+	// windows can be merged by walking through them once.
+	for _, window := range m.settings.Windows {
+		if window.Start.After(now) && (!active || window.Start.After(until)) {
+			break
+		}
+		if !window.End.After(now) {
+			continue
+		}
+		if !active || window.End.After(until) {
+			active = true
+			until = window.End
+		}
+	}
+
+	if m.settings.Enabled {
+		if m.settings.RetryAfter > 0 {
+			return true, now.Add(m.settings.RetryAfter)
+		}
+		return true, time.Time{}
+	}
+
+	return active, until
+}
+
+// check returns ErrMaintenance, including the configured message and the
+// Retry-After header, if new uploads are rejected at the given time.
+func (m *Maintenance) check(now time.Time) error {
+	active, until := m.Active(now)
+	if !active {
+		return nil
+	}
+
+	err := ErrMaintenance
+	if message := m.Settings().Message; message != "" {
+		err = NewError(err.ErrorCode, message, err.HTTPResponse.StatusCode)
+	}
+
+	if !until.IsZero() {
+		err.HTTPResponse = err.HTTPResponse.MergeWith(HTTPResponse{
+			Header: HTTPHeader{
+				"Retry-After": strconv.Itoa(int(math.Ceil(until.Sub(now).Seconds()))),
+			},
+		})
+	}
+
+	return err
+}
+
+// checkMaintenance returns ErrMaintenance if new uploads are currently rejected.
+func (handler *UnroutedHandler) checkMaintenance() error {
+	if handler.config.Maintenance == nil {
+		return nil
+	}
+
+	return handler.config.Maintenance.check(time.Now())
+}
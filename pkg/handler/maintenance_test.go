@@ -0,0 +1,128 @@
+package handler_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/tus/tusd/v2/pkg/handler"
+)
+
+func TestMaintenance(t *testing.T) {
+	SubTest(t, "RejectCreation", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+			BasePath:      "/files/",
+			Maintenance: NewMaintenance(MaintenanceSettings{
+				Enabled:    true,
+				Message:    "migrating storage until 10:00 UTC",
+				RetryAfter: 10 * time.Minute,
+			}),
+		})
+
+		req, _ := http.NewRequest("POST", "", nil)
+		req.Header.Set("Tus-Resumable", "1.0.0")
+		req.Header.Set("Upload-Length", "300")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.Equal(t, "600", w.Header().Get("Retry-After"))
+		assert.Equal(t, "ERR_MAINTENANCE: migrating storage until 10:00 UTC\n", w.Body.String())
+	})
+
+	SubTest(t, "ResumeUpload", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				Offset: 11,
+				Size:   44,
+			}, nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+			Maintenance:   NewMaintenance(MaintenanceSettings{Enabled: true}),
+		})
+
+		(&httpTest{
+			Method: "HEAD",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+			},
+			Code: http.StatusOK,
+			ResHeader: map[string]string{
+				"Upload-Offset": "11",
+			},
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "Window", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		now := time.Now()
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+			BasePath:      "/files/",
+			Maintenance: NewMaintenance(MaintenanceSettings{
+				Windows: []MaintenanceWindow{
+					{Start: now.Add(-time.Minute), End: now.Add(time.Hour)},
+				},
+			}),
+		})
+
+		req, _ := http.NewRequest("POST", "", nil)
+		req.Header.Set("Tus-Resumable", "1.0.0")
+		req.Header.Set("Upload-Length", "300")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.Equal(t, "3600", w.Header().Get("Retry-After"))
+	})
+}
+
+func TestMaintenanceActive(t *testing.T) {
+	a := assert.New(t)
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	m := NewMaintenance(MaintenanceSettings{})
+	active, _ := m.Active(now)
+	a.False(active)
+
+	// Overlapping and adjacent windows are combined, while windows after a
+	// gap are not.
+	m.Set(MaintenanceSettings{
+		Windows: []MaintenanceWindow{
+			{Start: now.Add(time.Hour), End: now.Add(2 * time.Hour)},
+			{Start: now.Add(-time.Hour), End: now.Add(30 * time.Minute)},
+			{Start: now.Add(4 * time.Hour), End: now.Add(5 * time.Hour)},
+			{Start: now.Add(10 * time.Minute), End: now.Add(time.Hour)},
+		},
+	})
+	active, until := m.Active(now)
+	a.True(active)
+	a.Equal(now.Add(2*time.Hour), until)
+
+	active, _ = m.Active(now.Add(3 * time.Hour))
+	a.False(active)
+
+	active, until = m.Active(now.Add(4 * time.Hour))
+	a.True(active)
+	a.Equal(now.Add(5*time.Hour), until)
+
+	// The windows are returned ordered by their start.
+	a.Equal(now.Add(-time.Hour), m.Settings().Windows[0].Start)
+
+	m.Set(MaintenanceSettings{Enabled: true})
+	active, until = m.Active(now)
+	a.True(active)
+	a.True(until.IsZero())
+}
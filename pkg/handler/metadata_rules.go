@@ -0,0 +1,148 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// The actions of a MetadataRule.
+const (
+	// MetadataRename moves the value of Key to To, unless To is already set.
+	MetadataRename = "rename"
+	// MetadataDefault sets Key to Value if the client did not provide a
+	// non-empty value.
+	MetadataDefault = "default"
+	// MetadataCoerce converts the value of Key into Format. Uploads whose value
+	// cannot be converted are rejected with ErrInvalidMetadata.
+	MetadataCoerce = "coerce"
+	// MetadataDrop removes Key.
+	MetadataDrop = "drop"
+)
+
+// The formats, into which MetadataCoerce can convert values.
+const (
+	MetadataLowercase = "lowercase"
+	MetadataUppercase = "uppercase"
+	MetadataTrim      = "trim"
+	// MetadataBoolean accepts the values understood by strconv.ParseBool as
+	// well as yes, no, on and off, and converts them to "true" or "false".
+	MetadataBoolean = "boolean"
+	// MetadataInteger accepts decimal integers, e.g. "007", and removes leading
+	// zeros and plus signs.
+	MetadataInteger = "integer"
+)
+
+// MetadataRule transforms the metadata of new uploads before the pre-create
+// hook is invoked, see Config.MetadataRules. This allows simple normalization
+// without running a hook service, for example lowercasing the filetype or
+// marking uploads as private by default.
+type MetadataRule struct {
+	// Action is one of MetadataRename, MetadataDefault, MetadataCoerce or
+	// MetadataDrop.
+	Action string `json:"action"`
+	// Key is the metadata key, which the rule applies to.
+	Key string `json:"key"`
+	// To is the new key for MetadataRename.
+	To string `json:"to,omitempty"`
+	// Value is the default value for MetadataDefault.
+	Value string `json:"value,omitempty"`
+	// Format is the format for MetadataCoerce, e.g. MetadataLowercase.
+	Format string `json:"format,omitempty"`
+}
+
+// validateMetadataRules checks that the rules are complete.
+func validateMetadataRules(rules []MetadataRule) error {
+	for i, rule := range rules {
+		if rule.Key == "" {
+			return fmt.Errorf("tusd: metadata rule %d has no key", i)
+		}
+
+		switch rule.Action {
+		case MetadataRename:
+			if rule.To == "" {
+				return fmt.Errorf("tusd: metadata rule %d renames %s without target key", i, rule.Key)
+			}
+		case MetadataDefault, MetadataDrop:
+		case MetadataCoerce:
+			switch rule.Format {
+			case MetadataLowercase, MetadataUppercase, MetadataTrim, MetadataBoolean, MetadataInteger:
+			default:
+				return fmt.Errorf("tusd: metadata rule %d has unknown format %q", i, rule.Format)
+			}
+		default:
+			return fmt.Errorf("tusd: metadata rule %d has unknown action %q", i, rule.Action)
+		}
+	}
+
+	return nil
+}
+
+// applyMetadataRules transforms meta in place according to Config.MetadataRules,
+// in the order of the rules.
+func (handler *UnroutedHandler) applyMetadataRules(meta MetaData) error {
+	for _, rule := range handler.config.MetadataRules {
+		value, ok := meta[rule.Key]
+
+		switch rule.Action {
+		case MetadataRename:
+			if !ok {
+				continue
+			}
+			if _, exists := meta[rule.To]; !exists {
+				meta[rule.To] = value
+			}
+			delete(meta, rule.Key)
+		case MetadataDefault:
+			if value == "" {
+				meta[rule.Key] = rule.Value
+			}
+		case MetadataCoerce:
+			if !ok {
+				continue
+			}
+			coerced, err := coerceMetadataValue(value, rule.Format)
+			if err != nil {
+				return NewError(ErrInvalidMetadata.ErrorCode, fmt.Sprintf("metadata %s must be %s", rule.Key, rule.Format), http.StatusBadRequest)
+			}
+			meta[rule.Key] = coerced
+		case MetadataDrop:
+			delete(meta, rule.Key)
+		}
+	}
+
+	return nil
+}
+
+func coerceMetadataValue(value string, format string) (string, error) {
+	switch format {
+	case MetadataLowercase:
+		return strings.ToLower(value), nil
+	case MetadataUppercase:
+		return strings.ToUpper(value), nil
+	case MetadataTrim:
+		return strings.TrimSpace(value), nil
+	case MetadataBoolean:
+		value = strings.TrimSpace(value)
+		switch strings.ToLower(value) {
+		case "yes", "on":
+			return "true", nil
+		case "no", "off":
+			return "false", nil
+		}
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatBool(b), nil
+	case MetadataInteger:
+		i, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatInt(i, 10), nil
+	default:
+		return "", fmt.Errorf("unknown format %q", format)
+	}
+}
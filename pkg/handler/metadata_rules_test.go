@@ -0,0 +1,88 @@
+package handler_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/tus/tusd/v2/pkg/handler"
+)
+
+func TestMetadataRules(t *testing.T) {
+	rules := []MetadataRule{
+		{Action: MetadataRename, Key: "type", To: "filetype"},
+		{Action: MetadataCoerce, Key: "filetype", Format: MetadataLowercase},
+		{Action: MetadataDefault, Key: "visibility", Value: "private"},
+		{Action: MetadataCoerce, Key: "public", Format: MetadataBoolean},
+		{Action: MetadataDrop, Key: "internal"},
+	}
+
+	SubTest(t, "Apply", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().NewUpload(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, info FileInfo) (Upload, error) {
+				assert.Equal(t, MetaData{
+					"filetype":   "image/png",
+					"visibility": "private",
+					"public":     "true",
+				}, info.MetaData)
+				return upload, nil
+			}),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:   "foo",
+				Size: 300,
+			}, nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+			BasePath:      "/files/",
+			MetadataRules: rules,
+		})
+
+		(&httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Upload-Length": "300",
+				// type: IMAGE/PNG, public: yes, internal: x
+				"Upload-Metadata": "type SU1BR0UvUE5H,public eWVz,internal eA==",
+			},
+			Code: http.StatusCreated,
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "RejectInvalidValue", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+			BasePath:      "/files/",
+			MetadataRules: rules,
+		})
+
+		(&httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Upload-Length": "300",
+				// public: maybe
+				"Upload-Metadata": "public bWF5YmU=",
+			},
+			Code:    http.StatusBadRequest,
+			ResBody: "ERR_INVALID_METADATA: metadata public must be boolean\n",
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "InvalidRule", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		_, err := NewHandler(Config{
+			StoreComposer: composer,
+			MetadataRules: []MetadataRule{{Action: MetadataCoerce, Key: "filetype", Format: "snakecase"}},
+		})
+		assert.EqualError(t, err, `tusd: metadata rule 0 has unknown format "snakecase"`)
+	})
+}
@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+)
+
+// MetadataStore keeps the FileInfo of uploads apart from their data, for
+// example in a database, while the data is saved in object storage. Data
+// stores, which support it, use a MetadataStore instead of their own files or
+// objects for the info, e.g. S3Store.MetadataStore. The key is chosen by the
+// data store and does not need to match FileInfo.ID.
+type MetadataStore interface {
+	// GetInfo returns the info stored under key or ErrNotFound.
+	GetInfo(ctx context.Context, key string) (FileInfo, error)
+	// PutInfo stores info under key, replacing any info stored before.
+	PutInfo(ctx context.Context, key string, info FileInfo) error
+	// UpdateInfo applies update to the info stored under key and stores the
+	// result. Concurrent updates of the same key must not overwrite each other,
+	// so update may be called again with the latest info if another update
+	// interfered. If update returns an error, nothing is stored. ErrNotFound is
+	// returned if no info is stored under key.
+	UpdateInfo(ctx context.Context, key string, update func(info *FileInfo) error) (FileInfo, error)
+	// DeleteInfo removes the info stored under key. It is not an error if no
+	// info is stored.
+	DeleteInfo(ctx context.Context, key string) error
+}
+
+// MemoryMetadataStore is a MetadataStore which keeps the info in memory. It is
+// only suitable if a single tusd instance handles all requests and the uploads
+// do not need to survive a restart, for example in tests.
+type MemoryMetadataStore struct {
+	mutex sync.Mutex
+	// infos contains the JSON encoded info, so that callers cannot modify the
+	// stored maps and slices.
+	infos map[string][]byte
+}
+
+// NewMemoryMetadataStore creates a new, empty in-memory metadata store.
+func NewMemoryMetadataStore() *MemoryMetadataStore {
+	return &MemoryMetadataStore{
+		infos: make(map[string][]byte),
+	}
+}
+
+func (store *MemoryMetadataStore) GetInfo(ctx context.Context, key string) (FileInfo, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	return store.get(key)
+}
+
+func (store *MemoryMetadataStore) PutInfo(ctx context.Context, key string, info FileInfo) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	return store.put(key, info)
+}
+
+func (store *MemoryMetadataStore) UpdateInfo(ctx context.Context, key string, update func(info *FileInfo) error) (FileInfo, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	info, err := store.get(key)
+	if err != nil {
+		return FileInfo{}, err
+	}
+	if err := update(&info); err != nil {
+		return FileInfo{}, err
+	}
+
+	return info, store.put(key, info)
+}
+
+func (store *MemoryMetadataStore) DeleteInfo(ctx context.Context, key string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	delete(store.infos, key)
+	return nil
+}
+
+// get decodes the info stored under key. The mutex must be held.
+func (store *MemoryMetadataStore) get(key string) (info FileInfo, err error) {
+	data, ok := store.infos[key]
+	if !ok {
+		return info, ErrNotFound
+	}
+
+	err = json.Unmarshal(data, &info)
+	return info, err
+}
+
+// put encodes and stores info under key. The mutex must be held.
+func (store *MemoryMetadataStore) put(key string, info FileInfo) error {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+
+	store.infos[key] = data
+	return nil
+}
@@ -0,0 +1,65 @@
+package handler_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/tus/tusd/v2/pkg/handler"
+)
+
+func TestMemoryMetadataStore(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	store := NewMemoryMetadataStore()
+
+	_, err := store.GetInfo(ctx, "foo")
+	a.ErrorIs(err, ErrNotFound)
+	_, err = store.UpdateInfo(ctx, "foo", func(info *FileInfo) error { return nil })
+	a.ErrorIs(err, ErrNotFound)
+
+	a.NoError(store.PutInfo(ctx, "foo", FileInfo{ID: "foo", MetaData: MetaData{"filename": "a.txt"}}))
+
+	// Changes to the returned info must not affect the stored info.
+	info, err := store.GetInfo(ctx, "foo")
+	a.NoError(err)
+	info.MetaData["filename"] = "b.txt"
+	info, err = store.GetInfo(ctx, "foo")
+	a.NoError(err)
+	a.Equal("a.txt", info.MetaData["filename"])
+
+	// Concurrent updates must not overwrite each other.
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := store.UpdateInfo(ctx, "foo", func(info *FileInfo) error {
+				info.PartialUploads = append(info.PartialUploads, "bar")
+				return nil
+			})
+			a.NoError(err)
+		}()
+	}
+	wg.Wait()
+
+	errFailed := errors.New("failed")
+	_, err = store.UpdateInfo(ctx, "foo", func(info *FileInfo) error {
+		info.Size = 100
+		return errFailed
+	})
+	a.ErrorIs(err, errFailed)
+
+	info, err = store.GetInfo(ctx, "foo")
+	a.NoError(err)
+	a.Len(info.PartialUploads, 10)
+	a.Equal(int64(0), info.Size)
+
+	a.NoError(store.DeleteInfo(ctx, "foo"))
+	a.NoError(store.DeleteInfo(ctx, "foo"))
+	_, err = store.GetInfo(ctx, "foo")
+	a.ErrorIs(err, ErrNotFound)
+}
@@ -1,8 +1,11 @@
 package handler
 
 import (
+	"path"
+	"reflect"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 // Metrics provides numbers about the usage of the tusd handler. Since these may
@@ -19,8 +22,39 @@ type Metrics struct {
 	UploadsFinished   *uint64
 	UploadsCreated    *uint64
 	UploadsTerminated *uint64
+	// Store is the name of the data store's package, such as "s3store". It is
+	// used to label the following upload metrics.
+	Store string
+	// UploadSizes records the sizes of finished uploads in bytes.
+	UploadSizes *Histogram
+	// UploadDurations records the wall-clock durations in seconds between the
+	// creation and the completion of uploads. Only uploads which have been
+	// created by this handler less than UploadTrackingPeriod ago are included.
+	UploadDurations *Histogram
+	// UploadThroughput records the effective throughput of finished uploads in
+	// bytes per second, i.e. the size divided by the wall-clock duration.
+	UploadThroughput *Histogram
+	// UploadRetries counts the requests which continue transferring data to an
+	// upload after a previous request for the same upload has been interrupted.
+	UploadRetries *uint64
+	// ExtensionsTotal counts the requests using a tus extension by the
+	// extension's name, such as creation-with-upload or concatenation.
+	ExtensionsTotal *CounterMap
+	// ProtocolVersionsTotal counts the requests by the protocol version sent
+	// in the Tus-Resumable header, see protocolVersionLabel.
+	ProtocolVersionsTotal *CounterMap
+	// ClientsTotal counts the requests by the family of the client's
+	// User-Agent header, see clientFamily.
+	ClientsTotal *CounterMap
+
+	uploads *uploadTracker
 }
 
+// UploadTrackingPeriod is the time for which the handler remembers the creation
+// of an upload and whether its last request has been interrupted, in order to
+// calculate the upload metrics.
+const UploadTrackingPeriod = 24 * time.Hour
+
 // incRequestsTotal increases the counter for this request method atomically by
 // one. The method must be one of GET, HEAD, POST, PATCH, DELETE.
 func (m Metrics) incRequestsTotal(method string) {
@@ -56,6 +90,76 @@ func (m Metrics) incUploadsTerminated() {
 	atomic.AddUint64(m.UploadsTerminated, 1)
 }
 
+// trackUploadCreated remembers the creation time of the upload.
+func (m Metrics) trackUploadCreated(id string) {
+	m.uploads.update(id, func(u *trackedUpload) {
+		u.createdAt = time.Now()
+	})
+}
+
+// trackUploadRequest counts a retry if the previous request transferring data
+// to the upload has been interrupted.
+func (m Metrics) trackUploadRequest(id string) {
+	retry := false
+	m.uploads.update(id, func(u *trackedUpload) {
+		retry = u.interrupted
+		u.interrupted = false
+	})
+
+	if retry {
+		atomic.AddUint64(m.UploadRetries, 1)
+	}
+}
+
+// trackUploadInterrupted remembers that a request transferring data to the
+// upload has been interrupted.
+func (m Metrics) trackUploadInterrupted(id string) {
+	m.uploads.update(id, func(u *trackedUpload) {
+		u.interrupted = true
+	})
+}
+
+// trackUploadFinished records the size, duration and throughput of the finished
+// upload and forgets about it.
+func (m Metrics) trackUploadFinished(id string, size int64) {
+	m.UploadSizes.observe(float64(size))
+
+	u, ok := m.uploads.remove(id)
+	if !ok || u.createdAt.IsZero() {
+		return
+	}
+
+	duration := time.Since(u.createdAt).Seconds()
+	m.UploadDurations.observe(duration)
+	if duration > 0 {
+		m.UploadThroughput.observe(float64(size) / duration)
+	}
+}
+
+// trackUploadTerminated forgets about the terminated upload.
+func (m Metrics) trackUploadTerminated(id string) {
+	m.uploads.remove(id)
+}
+
+// storeName returns the name of the package, which implements the data store.
+// Stores wrapping other stores can report the name of the wrapped store by
+// implementing a StoreName method.
+func storeName(core DataStore) string {
+	if core == nil {
+		return ""
+	}
+
+	if named, ok := core.(interface{ StoreName() string }); ok {
+		return named.StoreName()
+	}
+
+	t := reflect.TypeOf(core)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return path.Base(t.PkgPath())
+}
+
 func newMetrics() Metrics {
 	return Metrics{
 		RequestsTotal: map[string]*uint64{
@@ -66,12 +170,140 @@ func newMetrics() Metrics {
 			"DELETE":  new(uint64),
 			"OPTIONS": new(uint64),
 		},
-		ErrorsTotal:       newErrorsTotalMap(),
-		BytesReceived:     new(uint64),
-		UploadsFinished:   new(uint64),
-		UploadsCreated:    new(uint64),
-		UploadsTerminated: new(uint64),
+		ErrorsTotal:           newErrorsTotalMap(),
+		BytesReceived:         new(uint64),
+		UploadsFinished:       new(uint64),
+		UploadsCreated:        new(uint64),
+		UploadsTerminated:     new(uint64),
+		UploadSizes:           newHistogram(uploadSizeBuckets),
+		UploadDurations:       newHistogram(uploadDurationBuckets),
+		UploadThroughput:      newHistogram(uploadThroughputBuckets),
+		UploadRetries:         new(uint64),
+		ExtensionsTotal:       newCounterMap(),
+		ProtocolVersionsTotal: newCounterMap(),
+		ClientsTotal:          newCounterMap(),
+		uploads:               newUploadTracker(UploadTrackingPeriod),
+	}
+}
+
+var (
+	// uploadSizeBuckets ranges from 1KiB to 64GiB in steps of factor 4.
+	uploadSizeBuckets = []float64{1 << 10, 1 << 12, 1 << 14, 1 << 16, 1 << 18, 1 << 20, 1 << 22, 1 << 24, 1 << 26, 1 << 28, 1 << 30, 1 << 32, 1 << 34, 1 << 36}
+	// uploadDurationBuckets ranges from one second to one day.
+	uploadDurationBuckets = []float64{1, 5, 15, 30, 60, 300, 900, 1800, 3600, 3 * 3600, 6 * 3600, 24 * 3600}
+	// uploadThroughputBuckets ranges from 64KiB/s to 1GiB/s in steps of factor 4.
+	uploadThroughputBuckets = []float64{1 << 16, 1 << 18, 1 << 20, 1 << 22, 1 << 24, 1 << 26, 1 << 28, 1 << 30}
+)
+
+// Histogram counts observations in buckets. Unlike the other metrics, it is
+// protected by a lock and must be read using Load.
+type Histogram struct {
+	lock    sync.Mutex
+	buckets []float64
+	counts  []uint64
+	count   uint64
+	sum     float64
+}
+
+func newHistogram(buckets []float64) *Histogram {
+	return &Histogram{
+		buckets: buckets,
+		counts:  make([]uint64, len(buckets)),
+	}
+}
+
+func (h *Histogram) observe(value float64) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.count++
+	h.sum += value
+	for i, upperBound := range h.buckets {
+		if value <= upperBound {
+			h.counts[i]++
+			break
+		}
+	}
+}
+
+// Load returns the number of observations, their sum and the cumulative number
+// of observations per upper bound of the buckets, as expected by Prometheus.
+func (h *Histogram) Load() (count uint64, sum float64, buckets map[float64]uint64) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	buckets = make(map[float64]uint64, len(h.buckets))
+	var cumulative uint64
+	for i, upperBound := range h.buckets {
+		cumulative += h.counts[i]
+		buckets[upperBound] = cumulative
+	}
+
+	return h.count, h.sum, buckets
+}
+
+// uploadTracker remembers the uploads, for which metrics are calculated once
+// they are finished. Entries are removed once the upload is finished or
+// terminated, or if they have not been updated within the tracking period.
+type uploadTracker struct {
+	lock      sync.Mutex
+	period    time.Duration
+	entries   map[string]*trackedUpload
+	lastPrune time.Time
+}
+
+type trackedUpload struct {
+	createdAt   time.Time
+	interrupted bool
+	updatedAt   time.Time
+}
+
+func newUploadTracker(period time.Duration) *uploadTracker {
+	return &uploadTracker{
+		period:    period,
+		entries:   make(map[string]*trackedUpload),
+		lastPrune: time.Now(),
+	}
+}
+
+func (t *uploadTracker) update(id string, fn func(u *trackedUpload)) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	now := time.Now()
+	u, ok := t.entries[id]
+	if !ok {
+		u = &trackedUpload{}
+		t.entries[id] = u
+	}
+	fn(u)
+	u.updatedAt = now
+
+	// Prune stale entries at most once per tracking period.
+	if now.Sub(t.lastPrune) > t.period {
+		for id, u := range t.entries {
+			if now.Sub(u.updatedAt) > t.period {
+				delete(t.entries, id)
+			}
+		}
+		t.lastPrune = now
+	}
+}
+
+func (t *uploadTracker) remove(id string) (trackedUpload, bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	u, ok := t.entries[id]
+	if !ok {
+		return trackedUpload{}, false
+	}
+	delete(t.entries, id)
+
+	if time.Since(u.createdAt) > t.period {
+		u.createdAt = time.Time{}
 	}
+	return *u, true
 }
 
 // ErrorsTotalMap stores the counters for the different HTTP errors.
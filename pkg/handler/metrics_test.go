@@ -0,0 +1,161 @@
+package handler_test
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/tus/tusd/v2/pkg/handler"
+)
+
+func TestUploadMetrics(t *testing.T) {
+	SubTest(t, "Finished", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().NewUpload(gomock.Any(), gomock.Any()).Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:   "foo",
+				Size: 5,
+			}, nil),
+			store.EXPECT().GetUpload(gomock.Any(), "foo").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:   "foo",
+				Size: 5,
+			}, nil),
+			upload.EXPECT().WriteChunk(gomock.Any(), int64(0), NewReaderMatcher("hello")).Return(int64(5), nil),
+			upload.EXPECT().FinishUpload(gomock.Any()),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+			BasePath:      "/files/",
+		})
+
+		(&httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Upload-Length": "5",
+			},
+			Code: http.StatusCreated,
+		}).Run(handler, t)
+
+		(&httpTest{
+			Method: "PATCH",
+			URL:    "foo",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": "0",
+			},
+			ReqBody: strings.NewReader("hello"),
+			Code:    http.StatusNoContent,
+		}).Run(handler, t)
+
+		a := assert.New(t)
+		a.Equal("handler_test", handler.Metrics.Store)
+
+		count, sum, buckets := handler.Metrics.UploadSizes.Load()
+		a.Equal(uint64(1), count)
+		a.Equal(float64(5), sum)
+		a.Equal(uint64(1), buckets[1024])
+
+		count, _, _ = handler.Metrics.UploadDurations.Load()
+		a.Equal(uint64(1), count)
+		a.Equal(uint64(0), atomic.LoadUint64(handler.Metrics.UploadRetries))
+	})
+
+	SubTest(t, "Retries", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "foo").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:   "foo",
+				Size: 10,
+			}, nil),
+			upload.EXPECT().WriteChunk(gomock.Any(), int64(0), NewReaderMatcher("hello")).Return(int64(0), errors.New("connection lost")),
+			store.EXPECT().GetUpload(gomock.Any(), "foo").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:   "foo",
+				Size: 10,
+			}, nil),
+			upload.EXPECT().WriteChunk(gomock.Any(), int64(0), NewReaderMatcher("hello")).Return(int64(5), nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+			BasePath:      "/files/",
+		})
+
+		for _, code := range []int{http.StatusInternalServerError, http.StatusNoContent} {
+			(&httpTest{
+				Method: "PATCH",
+				URL:    "foo",
+				ReqHeader: map[string]string{
+					"Tus-Resumable": "1.0.0",
+					"Content-Type":  "application/offset+octet-stream",
+					"Upload-Offset": "0",
+				},
+				ReqBody: strings.NewReader("hello"),
+				Code:    code,
+			}).Run(handler, t)
+		}
+
+		a := assert.New(t)
+		a.Equal(uint64(1), atomic.LoadUint64(handler.Metrics.UploadRetries))
+
+		// The upload is not finished, so no sizes are recorded.
+		count, _, _ := handler.Metrics.UploadSizes.Load()
+		a.Equal(uint64(0), count)
+	})
+
+	SubTest(t, "Usage", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().NewUpload(gomock.Any(), gomock.Any()).Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:             "foo",
+				SizeIsDeferred: true,
+			}, nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+			BasePath:      "/files/",
+		})
+
+		(&httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable":       "1.0.0",
+				"Upload-Defer-Length": "1",
+				"User-Agent":          "tus-js-client/4.1.0",
+			},
+			Code: http.StatusCreated,
+		}).Run(handler, t)
+
+		(&httpTest{
+			Method: "OPTIONS",
+			Code:   http.StatusOK,
+		}).Run(handler, t)
+
+		a := assert.New(t)
+		a.Equal(map[string]uint64{"creation": 1, "creation-defer-length": 1}, handler.Metrics.ExtensionsTotal.Load())
+		a.Equal(map[string]uint64{"1.0.0": 1, "none": 1}, handler.Metrics.ProtocolVersionsTotal.Load())
+		a.Equal(uint64(1), handler.Metrics.ClientsTotal.Load()["tus-js-client"])
+	})
+}
@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"net/http"
+)
+
+// MiddlewareStage determines at which point during the request handling a
+// middleware, which is registered using UnroutedHandler.Use, is invoked.
+type MiddlewareStage int
+
+const (
+	// PreRoutingStage middlewares are invoked for every incoming request before
+	// tusd inspects it. They may modify the request, for example by attaching
+	// values to its context. These values are then available to the data store
+	// and hooks using HookEvent.Context.
+	PreRoutingStage MiddlewareStage = iota
+	// PostAuthStage middlewares are invoked after the request has passed tusd's
+	// own checks, such as the CORS origin and protocol version validation, and
+	// right before it is handed to the respective handler, e.g. PostFile. They are
+	// not invoked for OPTIONS requests. The request's context must not be replaced
+	// in this stage, as it carries the handler's internal state. Use the
+	// PreRoutingStage for attaching values instead.
+	PostAuthStage
+)
+
+// RequestInfo contains details about an incoming request as parsed by the handler.
+type RequestInfo struct {
+	// UploadID is the ID of the upload which the request targets. It is empty for
+	// requests which do not target an existing upload, such as creation requests.
+	UploadID string
+	// RequestID is the value of the X-Request-ID header, truncated to 36 characters.
+	RequestID string
+	// IsResumableUploadDraft is true if the request uses the IETF's resumable
+	// upload draft instead of the tus v1 protocol.
+	IsResumableUploadDraft bool
+}
+
+// Use registers a middleware for the given stage. Middlewares of the same stage
+// are invoked in the order in which they are registered. A middleware may stop
+// the request handling by not invoking the next handler, for example to reject
+// unauthorized requests. Use must not be called while requests are handled.
+func (handler *UnroutedHandler) Use(stage MiddlewareStage, middleware func(http.Handler) http.Handler) {
+	handler.middlewares[stage] = append(handler.middlewares[stage], middleware)
+}
+
+// ParseRequest extracts details about the request, which can be used by
+// middlewares for making decisions, for example based on the upload ID.
+func (handler *UnroutedHandler) ParseRequest(r *http.Request) RequestInfo {
+	id, err := extractIDFromRequest(r)
+	if err != nil {
+		id = ""
+	}
+
+	return RequestInfo{
+		UploadID:               id,
+		RequestID:              getRequestId(r),
+		IsResumableUploadDraft: handler.isResumableUploadDraftRequest(r),
+	}
+}
+
+// applyMiddlewares wraps the handler with the middlewares registered for the stage,
+// so that the first registered middleware is invoked first.
+func (handler *UnroutedHandler) applyMiddlewares(stage MiddlewareStage, h http.Handler) http.Handler {
+	middlewares := handler.middlewares[stage]
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+
+	return h
+}
@@ -0,0 +1,111 @@
+package handler_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/tus/tusd/v2/pkg/handler"
+)
+
+type tenantKey struct{}
+
+func TestMiddleware(t *testing.T) {
+	SubTest(t, "PreRouting", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().NewUpload(gomock.Any(), FileInfo{
+				Size:     300,
+				MetaData: map[string]string{},
+			}).Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:   "foo",
+				Size: 300,
+			}, nil),
+		)
+
+		var tenant any
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+			BasePath:      "/files/",
+			PreUploadCreateCallback: func(hook HookEvent) (HTTPResponse, FileInfoChanges, error) {
+				tenant = hook.Context.Value(tenantKey{})
+				return HTTPResponse{}, FileInfoChanges{}, nil
+			},
+		})
+
+		var calls []string
+		handler.Use(PreRoutingStage, func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls = append(calls, "first")
+				ctx := context.WithValue(r.Context(), tenantKey{}, r.Header.Get("X-Tenant-Id"))
+				next.ServeHTTP(w, r.WithContext(ctx))
+			})
+		})
+		handler.Use(PreRoutingStage, func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls = append(calls, "second")
+				next.ServeHTTP(w, r)
+			})
+		})
+
+		(&httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Upload-Length": "300",
+				"X-Tenant-Id":   "acme",
+			},
+			Code: http.StatusCreated,
+		}).Run(handler, t)
+
+		a := assert.New(t)
+		a.Equal([]string{"first", "second"}, calls)
+		a.Equal("acme", tenant)
+	})
+
+	SubTest(t, "PostAuth", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+		})
+
+		var info RequestInfo
+		handler.Use(PostAuthStage, func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				info = handler.ParseRequest(r)
+				w.WriteHeader(http.StatusForbidden)
+			})
+		})
+
+		// Requests with an unsupported version are rejected before reaching the middleware
+		(&httpTest{
+			Method: "DELETE",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "0.0.1",
+			},
+			Code: http.StatusPreconditionFailed,
+		}).Run(handler, t)
+		assert.Equal(t, RequestInfo{}, info)
+
+		(&httpTest{
+			Method: "DELETE",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"X-Request-ID":  "request-123",
+			},
+			Code: http.StatusForbidden,
+		}).Run(handler, t)
+		assert.Equal(t, RequestInfo{
+			UploadID:  "yes",
+			RequestID: "request-123",
+		}, info)
+	})
+}
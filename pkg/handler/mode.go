@@ -0,0 +1,43 @@
+package handler
+
+import "fmt"
+
+// HandlerMode restricts the endpoints served by a handler, so that handlers
+// receiving uploads and handlers serving downloads can be run, scaled and
+// secured independently of each other against the same data store.
+type HandlerMode string
+
+const (
+	// ModeReadWrite serves all endpoints. It is the default mode.
+	ModeReadWrite HandlerMode = "read-write"
+	// ModeWriteOnly serves the endpoints for creating, resuming and terminating
+	// uploads, but not for downloading them. HEAD requests are still answered,
+	// since clients need them to resume uploads.
+	ModeWriteOnly HandlerMode = "write-only"
+	// ModeReadOnly only serves the HEAD and GET requests for inspecting and
+	// downloading uploads. No tus extensions are advertised.
+	ModeReadOnly HandlerMode = "read-only"
+)
+
+// ParseHandlerMode returns the mode with the given name. An empty name refers
+// to ModeReadWrite.
+func ParseHandlerMode(name string) (HandlerMode, error) {
+	switch mode := HandlerMode(name); mode {
+	case "":
+		return ModeReadWrite, nil
+	case ModeReadWrite, ModeWriteOnly, ModeReadOnly:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("tusd: invalid handler mode %q, must be %s, %s or %s", name, ModeReadWrite, ModeWriteOnly, ModeReadOnly)
+	}
+}
+
+// allowsWrites returns whether uploads can be created, resumed and terminated.
+func (mode HandlerMode) allowsWrites() bool {
+	return mode != ModeReadOnly
+}
+
+// allowsReads returns whether uploads can be downloaded.
+func (mode HandlerMode) allowsReads() bool {
+	return mode != ModeWriteOnly
+}
@@ -0,0 +1,131 @@
+package handler_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/tus/tusd/v2/pkg/handler"
+)
+
+func TestHandlerMode(t *testing.T) {
+	SubTest(t, "ReadOnlyRoutes", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		handler, _ := NewUnroutedHandler(Config{
+			StoreComposer:           composer,
+			Mode:                    ModeReadOnly,
+			EnableDirectPartUploads: true,
+		})
+
+		var routes []string
+		for _, route := range handler.Routes(RouteOptions{IDPattern: "{id}"}) {
+			routes = append(routes, route.Method+" "+route.Pattern)
+		}
+
+		assert.Equal(t, []string{
+			"HEAD {id}",
+			"GET {id}",
+			"POST {id}",
+			"OPTIONS {id}",
+		}, routes)
+	})
+
+	SubTest(t, "WriteOnlyRoutes", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		handler, _ := NewUnroutedHandler(Config{
+			StoreComposer: composer,
+			Mode:          ModeWriteOnly,
+		})
+
+		var routes []string
+		for _, route := range handler.Routes(RouteOptions{IDPattern: "{id}"}) {
+			routes = append(routes, route.Method+" "+route.Pattern)
+		}
+
+		assert.Equal(t, []string{
+			"POST ",
+			"HEAD {id}",
+			"PATCH {id}",
+			"DELETE {id}",
+			"POST {id}",
+			"OPTIONS ",
+			"OPTIONS {id}",
+		}, routes)
+	})
+
+	SubTest(t, "ReadOnlyRejectsWrites", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 5,
+				Size:   5,
+			}, nil),
+			upload.EXPECT().GetReader(gomock.Any()).Return(io.NopCloser(strings.NewReader("hello")), nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+			BasePath:      "/files/",
+			Mode:          ModeReadOnly,
+		})
+
+		(&httpTest{
+			Method:  "GET",
+			URL:     "yes",
+			Code:    http.StatusOK,
+			ResBody: "hello",
+		}).Run(handler, t)
+
+		a := assert.New(t)
+		for _, method := range []string{"PATCH", "DELETE"} {
+			req, _ := http.NewRequest(method, "yes", strings.NewReader("hello"))
+			req.Header.Set("Tus-Resumable", "1.0.0")
+			req.Header.Set("Upload-Offset", "0")
+			req.Header.Set("Content-Type", "application/offset+octet-stream")
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			a.Equal(http.StatusMethodNotAllowed, w.Code, method)
+		}
+
+		req, _ := http.NewRequest("POST", "", nil)
+		req.Header.Set("Tus-Resumable", "1.0.0")
+		req.Header.Set("Upload-Length", "5")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		a.Equal(http.StatusNotFound, w.Code)
+
+		req, _ = http.NewRequest("OPTIONS", "", nil)
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		a.Equal(http.StatusOK, w.Code)
+		a.Empty(w.Header().Get("Tus-Extension"))
+	})
+
+	SubTest(t, "WriteOnlyRejectsDownloads", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+			Mode:          ModeWriteOnly,
+		})
+
+		req, _ := http.NewRequest("GET", "yes", nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	})
+
+	SubTest(t, "InvalidMode", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		_, err := NewHandler(Config{
+			StoreComposer: composer,
+			Mode:          "download-only",
+		})
+		assert.ErrorContains(t, err, "invalid handler mode")
+	})
+}
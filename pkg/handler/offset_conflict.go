@@ -0,0 +1,174 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// lastWriteTTL is the duration for which the last write to an upload is
+// remembered for diagnosing offset conflicts.
+const lastWriteTTL = time.Hour
+
+// lastWrite describes the request, which most recently wrote data to an upload.
+type lastWrite struct {
+	at         time.Time
+	requestID  string
+	remoteAddr string
+}
+
+// lastWriteRegistry remembers the last write to each upload on this instance,
+// so that offset conflicts can be attributed to the request, which previously
+// held the upload's lock. It is safe for concurrent use.
+type lastWriteRegistry struct {
+	lock      sync.Mutex
+	entries   map[string]lastWrite
+	lastPrune time.Time
+}
+
+func newLastWriteRegistry() *lastWriteRegistry {
+	return &lastWriteRegistry{
+		entries:   make(map[string]lastWrite),
+		lastPrune: time.Now(),
+	}
+}
+
+func (registry *lastWriteRegistry) record(id string, c *httpContext) {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+
+	now := time.Now()
+	registry.entries[id] = lastWrite{
+		at:         now,
+		requestID:  getRequestId(c.req),
+		remoteAddr: c.req.RemoteAddr,
+	}
+
+	if now.Sub(registry.lastPrune) > lastWriteTTL {
+		for k, e := range registry.entries {
+			if now.Sub(e.at) > lastWriteTTL {
+				delete(registry.entries, k)
+			}
+		}
+		registry.lastPrune = now
+	}
+}
+
+func (registry *lastWriteRegistry) get(id string) (lastWrite, bool) {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+
+	entry, ok := registry.entries[id]
+	if !ok || time.Since(entry.at) > lastWriteTTL {
+		return lastWrite{}, false
+	}
+
+	return entry, true
+}
+
+// offsetConflictBody is the JSON representation of a 409 Conflict response to
+// a PATCH request with a mismatching Upload-Offset header.
+type offsetConflictBody struct {
+	jsonErrorBody
+	RequestedOffset int64  `json:"requested_offset"`
+	CurrentOffset   int64  `json:"current_offset"`
+	LastModified    string `json:"last_modified,omitempty"`
+	LastRequestID   string `json:"last_request_id,omitempty"`
+}
+
+// sendOffsetConflict responds with ErrMismatchOffset, extended by the upload's
+// current offset and, if known, when and by which request it has last been
+// written to. Clients sending the same data twice can be debugged this way.
+// The last writer's address is only logged, since it may belong to another
+// client.
+func (handler *UnroutedHandler) sendOffsetConflict(c *httpContext, info FileInfo, offset int64) {
+	last, hasLast := handler.lastWrites.get(info.ID)
+
+	logArgs := []interface{}{"requestedOffset", offset, "currentOffset", info.Offset}
+	if hasLast {
+		logArgs = append(logArgs, "lastModified", last.at.UTC().Format(time.RFC3339), "lastRequestId", last.requestID, "lastRemoteAddr", last.remoteAddr)
+	}
+	c.log.Warn("OffsetConflict", logArgs...)
+
+	err := ErrMismatchOffset
+	err.HTTPResponse = err.HTTPResponse.MergeWith(HTTPResponse{
+		Header: HTTPHeader{
+			"Upload-Offset": strconv.FormatInt(info.Offset, 10),
+		},
+	})
+
+	if acceptsJSON(c.req) {
+		body := offsetConflictBody{
+			jsonErrorBody: jsonErrorBody{
+				Code:      err.ErrorCode,
+				Message:   err.Message,
+				Retryable: err.Retryable(),
+				RequestID: getRequestId(c.req),
+			},
+			RequestedOffset: offset,
+			CurrentOffset:   info.Offset,
+		}
+		if hasLast {
+			body.LastModified = last.at.UTC().Format(time.RFC3339)
+			body.LastRequestID = last.requestID
+		}
+
+		if encoded, jsonErr := json.Marshal(body); jsonErr == nil {
+			err.HTTPResponse.Body = string(encoded) + "\n"
+			err.HTTPResponse.Header["Content-Type"] = "application/json"
+		}
+	} else {
+		err.HTTPResponse.Body += "requested offset: " + strconv.FormatInt(offset, 10) + "\n" +
+			"current offset: " + strconv.FormatInt(info.Offset, 10) + "\n"
+		if hasLast {
+			err.HTTPResponse.Body += "last modified: " + last.at.UTC().Format(time.RFC3339) + "\n"
+			if last.requestID != "" {
+				err.HTTPResponse.Body += "last request ID: " + last.requestID + "\n"
+			}
+		}
+	}
+
+	handler.sendResp(c, err.HTTPResponse)
+	handler.Metrics.incErrorsTotal(err)
+}
+
+// skipReceivedPrefix discards the beginning of a PATCH request's body, whose
+// offset lies before the upload's offset, up to the upload's offset, see
+// Config.SkipReceivedPrefix. The remaining body, if any, can then be written at
+// the upload's offset.
+func (handler *UnroutedHandler) skipReceivedPrefix(c *httpContext, info FileInfo, offset int64) error {
+	received := info.Offset - offset
+	if c.req.Body == nil {
+		c.req.ContentLength = 0
+		return nil
+	}
+
+	body := &bodyReader{
+		ctx:        c,
+		reader:     io.NopCloser(io.LimitReader(c.req.Body, received)),
+		onReadDone: func() { handler.extendNetworkDeadlines(c) },
+	}
+
+	if _, err := io.Copy(io.Discard, body); err != nil {
+		return err
+	}
+	if err := body.hasError(); err != nil {
+		return err
+	}
+
+	skipped := body.bytesRead()
+	c.log.Info("ReceivedPrefixSkipped", "offset", offset, "size", skipped)
+
+	// The whole body has already been received.
+	if skipped < received || c.req.ContentLength == skipped {
+		c.req.ContentLength = 0
+		return nil
+	}
+
+	if c.req.ContentLength > 0 {
+		c.req.ContentLength -= skipped
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/tus/tusd/v2/pkg/handler"
+)
+
+func TestOffsetConflict(t *testing.T) {
+	SubTest(t, "Diagnostics", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{ID: "yes", Offset: 5, Size: 20}, nil),
+			upload.EXPECT().WriteChunk(gomock.Any(), int64(5), NewReaderMatcher("hello")).Return(int64(5), nil),
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{ID: "yes", Offset: 10, Size: 20}, nil),
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{ID: "yes", Offset: 10, Size: 20}, nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+		})
+
+		(&httpTest{
+			Method: "PATCH",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": "5",
+				"X-Request-ID":  "first",
+			},
+			ReqBody: strings.NewReader("hello"),
+			Code:    http.StatusNoContent,
+		}).Run(handler, t)
+
+		// The client sends the same chunk again.
+		res := (&httpTest{
+			Method: "PATCH",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": "5",
+			},
+			ReqBody: strings.NewReader("hello"),
+			Code:    http.StatusConflict,
+			ResHeader: map[string]string{
+				"Upload-Offset": "10",
+			},
+		}).Run(handler, t)
+
+		a := assert.New(t)
+		body := res.Body.String()
+		a.Contains(body, "ERR_MISMATCHED_OFFSET")
+		a.Contains(body, "requested offset: 5\n")
+		a.Contains(body, "current offset: 10\n")
+		a.Contains(body, "last modified: ")
+		a.Contains(body, "last request ID: first\n")
+
+		res = (&httpTest{
+			Method: "PATCH",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": "5",
+				"Accept":        "application/json",
+			},
+			ReqBody: strings.NewReader("hello"),
+			Code:    http.StatusConflict,
+			ResHeader: map[string]string{
+				"Content-Type": "application/json",
+			},
+		}).Run(handler, t)
+
+		var conflict struct {
+			Code            string `json:"code"`
+			RequestedOffset int64  `json:"requested_offset"`
+			CurrentOffset   int64  `json:"current_offset"`
+			LastModified    string `json:"last_modified"`
+			LastRequestID   string `json:"last_request_id"`
+		}
+		a.NoError(json.Unmarshal(res.Body.Bytes(), &conflict))
+		a.Equal("ERR_MISMATCHED_OFFSET", conflict.Code)
+		a.EqualValues(5, conflict.RequestedOffset)
+		a.EqualValues(10, conflict.CurrentOffset)
+		a.NotEmpty(conflict.LastModified)
+		a.Equal("first", conflict.LastRequestID)
+	})
+
+	SubTest(t, "SkipReceivedPrefix", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{ID: "yes", Offset: 5, Size: 20}, nil),
+			// Only the data after the upload's offset is written.
+			upload.EXPECT().WriteChunk(gomock.Any(), int64(5), NewReaderMatcher(" world")).Return(int64(6), nil),
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{ID: "yes", Offset: 11, Size: 20}, nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:      composer,
+			SkipReceivedPrefix: true,
+		})
+
+		(&httpTest{
+			Method: "PATCH",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": "0",
+			},
+			ReqBody: strings.NewReader("hello world"),
+			Code:    http.StatusNoContent,
+			ResHeader: map[string]string{
+				"Upload-Offset": "11",
+			},
+		}).Run(handler, t)
+
+		// The upload already contains the entire body.
+		(&httpTest{
+			Method: "PATCH",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": "6",
+			},
+			ReqBody: strings.NewReader("world"),
+			Code:    http.StatusNoContent,
+			ResHeader: map[string]string{
+				"Upload-Offset": "11",
+			},
+		}).Run(handler, t)
+	})
+}
@@ -0,0 +1,120 @@
+package handler_test
+
+import (
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	. "github.com/tus/tusd/v2/pkg/handler"
+)
+
+// timeoutError is returned by the request body if reading it timed out.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestPartialBody(t *testing.T) {
+	// patch sends a PATCH request, whose body fails with bodyErr after "first ".
+	patch := func(t *testing.T, composer *StoreComposer, config Config, bodyErr error, code int, resHeader map[string]string) {
+		config.StoreComposer = composer
+		handler, _ := NewHandler(config)
+
+		reader, writer := io.Pipe()
+		go func() {
+			writer.Write([]byte("first "))
+			writer.CloseWithError(bodyErr)
+		}()
+
+		(&httpTest{
+			Method: "PATCH",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": "5",
+			},
+			ReqBody:   reader,
+			Code:      code,
+			ResHeader: resHeader,
+		}).Run(handler, t)
+	}
+
+	expectWrite := func(ctrl *gomock.Controller, store *MockFullDataStore) {
+		upload := NewMockFullUpload(ctrl)
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 5,
+				Size:   100,
+			}, nil),
+			upload.EXPECT().WriteChunk(gomock.Any(), int64(5), NewReaderMatcher("first ")).Return(int64(6), nil),
+		)
+	}
+
+	SubTest(t, "AcceptTimeout", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		expectWrite(ctrl, store)
+
+		patch(t, composer, Config{
+			AcceptPartialBodies: true,
+		}, timeoutError{}, http.StatusNoContent, map[string]string{
+			"Upload-Offset":   "11",
+			"Upload-Received": "6",
+		})
+	})
+
+	SubTest(t, "AcceptTruncatedBody", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		expectWrite(ctrl, store)
+
+		patch(t, composer, Config{
+			AcceptPartialBodies:    true,
+			ClientAbortStatusCodes: true,
+		}, io.ErrUnexpectedEOF, http.StatusNoContent, map[string]string{
+			"Upload-Offset":   "11",
+			"Upload-Received": "6",
+		})
+	})
+
+	SubTest(t, "ClientClosedRequest", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		expectWrite(ctrl, store)
+
+		patch(t, composer, Config{
+			ClientAbortStatusCodes: true,
+		}, io.ErrUnexpectedEOF, StatusClientClosedRequest, map[string]string{
+			"Upload-Offset": "11",
+		})
+	})
+
+	SubTest(t, "NetworkReadTimeout", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		expectWrite(ctrl, store)
+
+		patch(t, composer, Config{
+			ClientAbortStatusCodes: true,
+		}, timeoutError{}, StatusNetworkReadTimeout, map[string]string{
+			"Upload-Offset": "11",
+		})
+	})
+
+	SubTest(t, "Disabled", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		expectWrite(ctrl, store)
+
+		patch(t, composer, Config{}, timeoutError{}, http.StatusInternalServerError, map[string]string{
+			"Upload-Offset":   "",
+			"Upload-Received": "",
+		})
+	})
+}
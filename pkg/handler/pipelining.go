@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"sync"
+	"time"
+)
+
+// pendingPatch is a PATCH request, which is writing to an upload on this
+// instance and will end at the given offset if all of its data is stored.
+type pendingPatch struct {
+	end  int64
+	done chan struct{}
+}
+
+// patchPipeline keeps track of the PATCH requests in progress for each upload,
+// so that a request continuing where another one ends can wait for it instead
+// of failing with an offset mismatch. It is safe for concurrent use.
+type patchPipeline struct {
+	lock    sync.Mutex
+	pending map[string][]*pendingPatch
+}
+
+func newPatchPipeline() *patchPipeline {
+	return &patchPipeline{
+		pending: make(map[string][]*pendingPatch),
+	}
+}
+
+// enqueue registers a PATCH request writing to the upload from offset until
+// end. If end is negative, because the length of the request's body is
+// unknown, no later request can wait for it. previous is closed once the
+// request, which ends at offset, is done, or nil if there is no such request.
+// The returned done function must be called once the request is done.
+func (p *patchPipeline) enqueue(id string, offset int64, end int64) (previous <-chan struct{}, done func()) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for _, patch := range p.pending[id] {
+		if patch.end == offset {
+			previous = patch.done
+			break
+		}
+	}
+
+	if end < 0 {
+		return previous, func() {}
+	}
+
+	patch := &pendingPatch{
+		end:  end,
+		done: make(chan struct{}),
+	}
+	p.pending[id] = append(p.pending[id], patch)
+
+	return previous, func() {
+		p.lock.Lock()
+		defer p.lock.Unlock()
+
+		patches := p.pending[id]
+		for i, other := range patches {
+			if other == patch {
+				patches = append(patches[:i], patches[i+1:]...)
+				break
+			}
+		}
+		if len(patches) == 0 {
+			delete(p.pending, id)
+		} else {
+			p.pending[id] = patches
+		}
+
+		close(patch.done)
+	}
+}
+
+// awaitPreviousPatch waits until the PATCH request on this instance, which
+// ends at the offset where r begins, has been handled, see
+// Config.EnablePipelinedPatches. It waits at most for AcquireLockTimeout,
+// after which the request is handled anyway and likely fails with an offset
+// mismatch. The returned function must be called once r has been handled.
+func (handler *UnroutedHandler) awaitPreviousPatch(c *httpContext, id string, offset int64) func() {
+	// The length of compressed bodies does not tell how much data they contain.
+	end := int64(-1)
+	if c.req.ContentLength > 0 && c.req.Header.Get("Content-Encoding") == "" {
+		end = offset + c.req.ContentLength
+	}
+
+	previous, done := handler.pipeline.enqueue(id, offset, end)
+	if previous == nil {
+		return done
+	}
+
+	c.log.Info("PatchQueued", "offset", offset)
+
+	timer := time.NewTimer(handler.config.AcquireLockTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-previous:
+	case <-timer.C:
+		c.log.Warn("PatchQueueTimeout", "offset", offset)
+	case <-c.Done():
+	}
+
+	return done
+}
@@ -0,0 +1,121 @@
+package handler_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/tus/tusd/v2/pkg/handler"
+)
+
+func TestPipelinedPatches(t *testing.T) {
+	SubTest(t, "QueueUntilCommitted", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		writing := make(chan struct{})
+		release := make(chan struct{})
+
+		store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil).Times(2)
+		gomock.InOrder(
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 0,
+				Size:   10,
+			}, nil),
+			upload.EXPECT().WriteChunk(gomock.Any(), int64(0), NewReaderMatcher("hello")).DoAndReturn(func(ctx context.Context, offset int64, src io.Reader) (int64, error) {
+				close(writing)
+				<-release
+				return 5, nil
+			}),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 5,
+				Size:   10,
+			}, nil),
+			upload.EXPECT().WriteChunk(gomock.Any(), int64(5), NewReaderMatcher("world")).Return(int64(5), nil),
+			upload.EXPECT().FinishUpload(gomock.Any()),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:          composer,
+			EnablePipelinedPatches: true,
+		})
+
+		patch := func(offset string, body string) *httptest.ResponseRecorder {
+			req, _ := http.NewRequest("PATCH", "yes", strings.NewReader(body))
+			req.Header.Set("Tus-Resumable", "1.0.0")
+			req.Header.Set("Content-Type", "application/offset+octet-stream")
+			req.Header.Set("Upload-Offset", offset)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			return w
+		}
+
+		first := make(chan *httptest.ResponseRecorder)
+		go func() {
+			first <- patch("0", "hello")
+		}()
+		<-writing
+
+		second := make(chan *httptest.ResponseRecorder)
+		go func() {
+			second <- patch("5", "world")
+		}()
+
+		select {
+		case <-second:
+			t.Fatal("pipelined request was handled before the previous one")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		close(release)
+
+		w := <-first
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.Equal(t, "5", w.Header().Get("Upload-Offset"))
+
+		w = <-second
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.Equal(t, "10", w.Header().Get("Upload-Offset"))
+	})
+
+	SubTest(t, "Disabled", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 0,
+				Size:   10,
+			}, nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+		})
+
+		(&httpTest{
+			Method: "PATCH",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": "5",
+			},
+			ReqBody: strings.NewReader("world"),
+			Code:    http.StatusConflict,
+		}).Run(handler, t)
+	})
+}
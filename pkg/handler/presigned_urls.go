@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+)
+
+// PresignedURLs are pre-signed URLs for reading the content of a completed
+// upload, which are included in the notifications about completed uploads if
+// Config.PresignCompletedUploads is enabled. Each URL is only valid for its
+// method and the upload's object, so consumers of these notifications do not
+// need credentials for the entire storage.
+type PresignedURLs struct {
+	// GET is the URL for downloading the upload's content.
+	GET string
+	// HEAD is the URL for retrieving the upload's size and headers.
+	HEAD string
+	// ExpiresAt is the time after which the URLs are no longer valid.
+	ExpiresAt time.Time
+}
+
+// completedUploadEvent returns the event for notifying about the completion of
+// the upload, including pre-signed URLs for reading it if enabled. Failing to
+// create the URLs does not fail the upload, since it has been stored already.
+func (handler *UnroutedHandler) completedUploadEvent(c *httpContext, upload Upload, info FileInfo) HookEvent {
+	event := newHookEvent(c, info)
+	if !handler.config.PresignCompletedUploads || !handler.composer.UsesPresigner {
+		return event
+	}
+
+	expiry := handler.config.CompletedUploadURLExpiry
+	presignable := handler.composer.Presigner.AsPresignableUpload(upload)
+	urls := &PresignedURLs{
+		ExpiresAt: time.Now().Add(expiry).UTC(),
+	}
+	for _, presign := range []struct {
+		method string
+		url    *string
+	}{
+		{http.MethodGet, &urls.GET},
+		{http.MethodHead, &urls.HEAD},
+	} {
+		url, err := presignable.PresignDownloadURL(c, PresignOptions{
+			Method: presign.method,
+			Expiry: expiry,
+		})
+		if err != nil {
+			c.log.Warn("PresignCompletedUploadError", "presignMethod", presign.method, "error", err)
+			return event
+		}
+		*presign.url = url
+	}
+
+	event.PresignedURLs = urls
+	return event
+}
@@ -0,0 +1,117 @@
+package handler_test
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/tus/tusd/v2/pkg/handler"
+)
+
+func TestPresignedURLs(t *testing.T) {
+	SubTest(t, "Included", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 0,
+				Size:   5,
+			}, nil),
+			upload.EXPECT().WriteChunk(gomock.Any(), int64(0), NewReaderMatcher("hello")).Return(int64(5), nil),
+			upload.EXPECT().FinishUpload(gomock.Any()),
+			store.EXPECT().AsPresignableUpload(upload).Return(upload),
+			upload.EXPECT().PresignDownloadURL(gomock.Any(), PresignOptions{
+				Method: "GET",
+				Expiry: 5 * time.Minute,
+			}).Return("https://bucket.example.com/yes?signature=get", nil),
+			upload.EXPECT().PresignDownloadURL(gomock.Any(), PresignOptions{
+				Method: "HEAD",
+				Expiry: 5 * time.Minute,
+			}).Return("https://bucket.example.com/yes?signature=head", nil),
+		)
+
+		composer.UsePresigner(store)
+		handler, _ := NewHandler(Config{
+			StoreComposer:            composer,
+			NotifyCompleteUploads:    true,
+			PresignCompletedUploads:  true,
+			CompletedUploadURLExpiry: 5 * time.Minute,
+		})
+
+		c := make(chan HookEvent, 1)
+		handler.CompleteUploads = c
+
+		(&httpTest{
+			Method: "PATCH",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": "0",
+			},
+			ReqBody: strings.NewReader("hello"),
+			Code:    http.StatusNoContent,
+		}).Run(handler, t)
+
+		event := <-c
+		a := assert.New(t)
+		a.NotNil(event.PresignedURLs)
+		a.Equal("https://bucket.example.com/yes?signature=get", event.PresignedURLs.GET)
+		a.Equal("https://bucket.example.com/yes?signature=head", event.PresignedURLs.HEAD)
+		a.WithinDuration(time.Now().Add(5*time.Minute), event.PresignedURLs.ExpiresAt, time.Minute)
+	})
+
+	SubTest(t, "PresignError", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 0,
+				Size:   5,
+			}, nil),
+			upload.EXPECT().WriteChunk(gomock.Any(), int64(0), NewReaderMatcher("hello")).Return(int64(5), nil),
+			upload.EXPECT().FinishUpload(gomock.Any()),
+			store.EXPECT().AsPresignableUpload(upload).Return(upload),
+			upload.EXPECT().PresignDownloadURL(gomock.Any(), gomock.Any()).Return("", errors.New("no credentials")),
+		)
+
+		composer.UsePresigner(store)
+		handler, _ := NewHandler(Config{
+			StoreComposer:           composer,
+			NotifyCompleteUploads:   true,
+			PresignCompletedUploads: true,
+		})
+
+		c := make(chan HookEvent, 1)
+		handler.CompleteUploads = c
+
+		// The upload is still completed, but without the URLs.
+		(&httpTest{
+			Method: "PATCH",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": "0",
+			},
+			ReqBody: strings.NewReader("hello"),
+			Code:    http.StatusNoContent,
+		}).Run(handler, t)
+
+		event := <-c
+		assert.Nil(t, event.PresignedURLs)
+	})
+}
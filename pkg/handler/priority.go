@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"context"
+	"strconv"
+)
+
+type uploadPriorityKey struct{}
+
+// WithUploadPriority returns a copy of ctx, which carries the upload's priority.
+// The handler uses it for the contexts passed to Upload.WriteChunk.
+func WithUploadPriority(ctx context.Context, priority int) context.Context {
+	if priority == 0 {
+		return ctx
+	}
+
+	return context.WithValue(ctx, uploadPriorityKey{}, priority)
+}
+
+// UploadPriority returns the priority of the upload, whose data is written
+// using ctx, see FileInfo.Priority. Data stores can use it to prefer uploads
+// with a higher priority when distributing limited resources, such as
+// concurrent requests to the storage backend. It is zero by default.
+func UploadPriority(ctx context.Context) int {
+	priority, _ := ctx.Value(uploadPriorityKey{}).(int)
+	return priority
+}
+
+// priorityFromMetadata returns the priority of a new upload as requested by
+// the client in the metadata key Config.PriorityMetadataKey. Clients can only
+// lower the priority of their uploads this way, for example for batch
+// transfers. Higher priorities must be assigned using FileInfoChanges.Priority
+// in the pre-create hook.
+func (handler *UnroutedHandler) priorityFromMetadata(meta MetaData) int {
+	if handler.config.PriorityMetadataKey == "" {
+		return 0
+	}
+
+	priority, err := strconv.Atoi(meta[handler.config.PriorityMetadataKey])
+	if err != nil || priority > 0 {
+		return 0
+	}
+
+	return priority
+}
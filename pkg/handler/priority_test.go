@@ -0,0 +1,174 @@
+package handler_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/tus/tusd/v2/pkg/handler"
+)
+
+func TestPriority(t *testing.T) {
+	SubTest(t, "FromMetadata", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		for _, test := range []struct {
+			value    string
+			priority int
+		}{
+			// "-5"
+			{"LTU=", -5},
+			// Clients can not raise the priority of their uploads: "5"
+			{"NQ==", 0},
+			// "high"
+			{"aGlnaA==", 0},
+		} {
+			ctrl := gomock.NewController(t)
+			upload := NewMockFullUpload(ctrl)
+
+			gomock.InOrder(
+				store.EXPECT().NewUpload(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, info FileInfo) (Upload, error) {
+					assert.Equal(t, test.priority, info.Priority)
+					return upload, nil
+				}),
+				upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+					ID:   "foo",
+					Size: 300,
+				}, nil),
+			)
+
+			handler, _ := NewHandler(Config{
+				StoreComposer:       composer,
+				BasePath:            "/files/",
+				PriorityMetadataKey: "priority",
+			})
+
+			(&httpTest{
+				Method: "POST",
+				ReqHeader: map[string]string{
+					"Tus-Resumable":   "1.0.0",
+					"Upload-Length":   "300",
+					"Upload-Metadata": "priority " + test.value,
+				},
+				Code: http.StatusCreated,
+			}).Run(handler, t)
+
+			ctrl.Finish()
+		}
+	})
+
+	SubTest(t, "MetadataKeyNotConfigured", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().NewUpload(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, info FileInfo) (Upload, error) {
+				assert.Equal(t, 0, info.Priority)
+				return upload, nil
+			}),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:   "foo",
+				Size: 300,
+			}, nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+			BasePath:      "/files/",
+		})
+
+		(&httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Upload-Length": "300",
+				// "-5"
+				"Upload-Metadata": "priority LTU=",
+			},
+			Code: http.StatusCreated,
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "FromHook", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().NewUpload(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, info FileInfo) (Upload, error) {
+				assert.Equal(t, 10, info.Priority)
+				return upload, nil
+			}),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:   "foo",
+				Size: 300,
+			}, nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:       composer,
+			BasePath:            "/files/",
+			PriorityMetadataKey: "priority",
+			PreUploadCreateCallback: func(hook HookEvent) (HTTPResponse, FileInfoChanges, error) {
+				// The hook sees the priority requested by the client and can
+				// replace it.
+				assert.Equal(t, -5, hook.Upload.Priority)
+				priority := 10
+				return HTTPResponse{}, FileInfoChanges{Priority: &priority}, nil
+			},
+		})
+
+		(&httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Upload-Length": "300",
+				// "-5"
+				"Upload-Metadata": "priority LTU=",
+			},
+			Code: http.StatusCreated,
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "WriteChunk", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:       "yes",
+				Offset:   5,
+				Size:     10,
+				Priority: -5,
+			}, nil),
+			upload.EXPECT().WriteChunk(gomock.Any(), int64(5), NewReaderMatcher("hello")).DoAndReturn(func(ctx context.Context, offset int64, src io.Reader) (int64, error) {
+				// The data store receives the priority of the upload.
+				assert.Equal(t, -5, UploadPriority(ctx))
+				return 5, nil
+			}),
+			upload.EXPECT().FinishUpload(gomock.Any()),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+		})
+
+		(&httpTest{
+			Method: "PATCH",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": "5",
+			},
+			ReqBody: strings.NewReader("hello"),
+			Code:    http.StatusNoContent,
+		}).Run(handler, t)
+	})
+}
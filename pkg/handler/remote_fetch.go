@@ -0,0 +1,565 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// RemoteFetchStatusFetching is the value of the Upload-Source-Status header
+	// while the content of an upload is downloaded from its source URL.
+	RemoteFetchStatusFetching = "fetching"
+	// RemoteFetchStatusFailed is the value of the Upload-Source-Status header if
+	// the content could not be downloaded. Upload-Source-Error contains the reason.
+	RemoteFetchStatusFailed = "failed"
+)
+
+// remoteFetchSegmentSize is the amount of data written to the data store while
+// holding the upload's lock. Between segments, other requests, such as HEAD
+// requests for the progress, can acquire the lock.
+const remoteFetchSegmentSize = 8 * 1024 * 1024
+
+// remoteFetchLockAttempts is the number of attempts to acquire the lock of an
+// upload for writing a segment, before the fetch fails.
+const remoteFetchLockAttempts = 5
+
+// failedFetchTTL is the duration for which failed fetches are reported in
+// responses to HEAD requests.
+const failedFetchTTL = 1 * time.Hour
+
+// remoteFetch is the state of an upload, whose content is downloaded from a
+// source URL by this instance.
+type remoteFetch struct {
+	source *url.URL
+
+	lock   sync.Mutex
+	offset int64
+	size   int64
+	err    error
+	done   chan struct{}
+}
+
+func (f *remoteFetch) progress() (offset, size int64, err error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	return f.offset, f.size, f.err
+}
+
+func (f *remoteFetch) setProgress(offset, size int64) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.offset = offset
+	f.size = size
+}
+
+// remoteFetchRegistry keeps track of the fetches running on this instance and
+// of recently failed ones. It is safe for concurrent use.
+type remoteFetchRegistry struct {
+	lock    sync.Mutex
+	fetches map[string]*remoteFetch
+}
+
+func newRemoteFetchRegistry() *remoteFetchRegistry {
+	return &remoteFetchRegistry{
+		fetches: make(map[string]*remoteFetch),
+	}
+}
+
+func (reg *remoteFetchRegistry) add(id string, fetch *remoteFetch) {
+	reg.lock.Lock()
+	defer reg.lock.Unlock()
+
+	reg.fetches[id] = fetch
+}
+
+func (reg *remoteFetchRegistry) get(id string) *remoteFetch {
+	reg.lock.Lock()
+	defer reg.lock.Unlock()
+
+	return reg.fetches[id]
+}
+
+// finish removes a successful fetch or, if err is not nil, records its failure
+// for failedFetchTTL.
+func (reg *remoteFetchRegistry) finish(id string, fetch *remoteFetch, err error) {
+	fetch.lock.Lock()
+	fetch.err = err
+	fetch.lock.Unlock()
+	close(fetch.done)
+
+	if err == nil {
+		reg.remove(id, fetch)
+		return
+	}
+
+	time.AfterFunc(failedFetchTTL, func() {
+		reg.remove(id, fetch)
+	})
+}
+
+func (reg *remoteFetchRegistry) remove(id string, fetch *remoteFetch) {
+	reg.lock.Lock()
+	defer reg.lock.Unlock()
+
+	// The upload might have been fetched again in the meantime.
+	if reg.fetches[id] == fetch {
+		delete(reg.fetches, id)
+	}
+}
+
+// newRemoteFetchClient returns the default client for fetching remote sources,
+// which refuses to connect to loopback, private, link-local and unspecified
+// addresses. The check is applied to the resolved address of every connection,
+// including those made for redirects, so it cannot be bypassed using DNS.
+func newRemoteFetchClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control: func(network, address string, conn syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+
+			ip := net.ParseIP(host)
+			if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified() {
+				return fmt.Errorf("tusd: connecting to %s is not allowed", host)
+			}
+			return nil
+		},
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// A proxy would be subject to the address check instead of the source.
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{Transport: transport}
+}
+
+// remoteFetchClient returns a copy of Config.RemoteFetchClient, which checks
+// the targets of redirects using Config.RemoteFetchAllowURL as well.
+func (handler *UnroutedHandler) remoteFetchClient() *http.Client {
+	client := *handler.config.RemoteFetchClient
+	checkRedirect := client.CheckRedirect
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if err := handler.allowSourceURL(req.URL); err != nil {
+			return err
+		}
+
+		if checkRedirect != nil {
+			return checkRedirect(req, via)
+		}
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		return nil
+	}
+
+	return &client
+}
+
+// allowSourceURL checks that content may be fetched from u.
+func (handler *UnroutedHandler) allowSourceURL(u *url.URL) error {
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ErrInvalidSourceURL
+	}
+
+	if handler.config.RemoteFetchAllowURL != nil {
+		if err := handler.config.RemoteFetchAllowURL(u); err != nil {
+			return ErrRemoteSourceNotAllowed
+		}
+	}
+
+	return nil
+}
+
+// parseSourceURL returns the URL from the Upload-Source-Url header, if remote
+// fetching is enabled. Otherwise, the header is ignored and nil is returned.
+func (handler *UnroutedHandler) parseSourceURL(r *http.Request) (*url.URL, error) {
+	header := r.Header.Get("Upload-Source-Url")
+	if !handler.config.EnableRemoteFetch || header == "" {
+		return nil, nil
+	}
+
+	u, err := url.Parse(header)
+	if err != nil {
+		return nil, ErrInvalidSourceURL
+	}
+
+	if err := handler.allowSourceURL(u); err != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
+
+// openSource sends a GET request for the content of source starting at offset.
+// If the server ignores the Range header, the data before offset is skipped.
+// The returned size is the total size of the content or -1 if it is unknown.
+func (handler *UnroutedHandler) openSource(ctx context.Context, source *url.URL, offset int64) (body io.ReadCloser, size int64, err error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", source.String(), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", "bytes="+strconv.FormatInt(offset, 10)+"-")
+	}
+
+	res, err := handler.remoteFetchClient().Do(req)
+	if err != nil {
+		// Rejected redirects are reported as such.
+		var detailedErr Error
+		if errors.As(err, &detailedErr) {
+			return nil, 0, detailedErr
+		}
+		return nil, 0, fmt.Errorf("%w: %s", ErrRemoteSourceUnavailable, err)
+	}
+
+	switch {
+	case res.StatusCode == http.StatusPartialContent && offset > 0:
+		size = -1
+		if res.ContentLength >= 0 {
+			size = offset + res.ContentLength
+		}
+		return res.Body, size, nil
+	case res.StatusCode == http.StatusOK:
+		if offset > 0 {
+			if _, err := io.CopyN(io.Discard, res.Body, offset); err != nil {
+				res.Body.Close()
+				return nil, 0, fmt.Errorf("%w: %s", ErrRemoteSourceUnavailable, err)
+			}
+		}
+		return res.Body, res.ContentLength, nil
+	default:
+		res.Body.Close()
+		return nil, 0, fmt.Errorf("%w: unexpected status %d", ErrRemoteSourceUnavailable, res.StatusCode)
+	}
+}
+
+// startRemoteFetch downloads the content of the new upload from source in the
+// background, starting with the already opened body. The fetch outlives the
+// creation request, so it uses a context, which is not cancelled with the
+// request and does not write to its response, but keeps its values, e.g. for
+// hooks and data stores.
+func (handler *UnroutedHandler) startRemoteFetch(c *httpContext, upload Upload, info FileInfo, source *url.URL, body io.ReadCloser) {
+	fetch := &remoteFetch{
+		source: source,
+		size:   info.Size,
+		done:   make(chan struct{}),
+	}
+	if info.SizeIsDeferred {
+		fetch.size = -1
+	}
+	handler.remoteFetches.add(info.ID, fetch)
+
+	ctx, cancel := context.WithCancelCause(context.WithoutCancel(c.req.Context()))
+	req := c.req.Clone(ctx)
+	req.Body = http.NoBody
+	fc := handler.newContext(detachedResponseWriter{header: make(http.Header)}, req)
+	fc.log = c.log
+
+	go func() {
+		defer cancel(nil)
+
+		err := handler.runRemoteFetch(fc, fetch, upload, info, body)
+		if err != nil {
+			fc.log.Warn("RemoteFetchFailed", "source", source.Redacted(), "error", err)
+		}
+		handler.remoteFetches.finish(info.ID, fetch, err)
+	}()
+}
+
+// runRemoteFetch copies the content from body into the upload and finishes it.
+// Interrupted downloads are resumed up to Config.RemoteFetchRetries times.
+func (handler *UnroutedHandler) runRemoteFetch(c *httpContext, fetch *remoteFetch, upload Upload, info FileInfo, body io.ReadCloser) error {
+	retries := 0
+	for {
+		err := handler.copyFromSource(c, fetch, upload, &info, body)
+		body.Close()
+		if err == nil {
+			break
+		}
+
+		// Resume the download, retrying if the source cannot be opened again.
+		for {
+			var readErr sourceReadError
+			if !errors.As(err, &readErr) && !errors.Is(err, ErrRemoteSourceUnavailable) {
+				return err
+			}
+			if retries >= handler.config.RemoteFetchRetries {
+				return err
+			}
+			retries++
+
+			c.log.Info("RemoteFetchRetry", "offset", info.Offset, "error", err)
+			select {
+			case <-time.After(time.Duration(retries) * time.Second):
+			case <-c.Done():
+				return c.Err()
+			}
+
+			body, _, err = handler.openSource(c, fetch.source, info.Offset)
+			if err == nil {
+				break
+			}
+		}
+	}
+
+	if info.SizeIsDeferred {
+		if err := handler.composer.LengthDeferrer.AsLengthDeclarableUpload(upload).DeclareLength(c, info.Offset); err != nil {
+			return err
+		}
+		info.Size = info.Offset
+		info.SizeIsDeferred = false
+		fetch.setProgress(info.Offset, info.Size)
+	}
+
+	_, err := handler.finishUploadIfComplete(c, HTTPResponse{}, upload, info)
+	return err
+}
+
+// copyFromSource writes the data from body to the upload in segments, updating
+// info.Offset after each one. It returns once the upload's size or, if it is
+// deferred, the end of the source has been reached.
+func (handler *UnroutedHandler) copyFromSource(c *httpContext, fetch *remoteFetch, upload Upload, info *FileInfo, body io.Reader) error {
+	for {
+		// remaining is the amount of data the upload may still receive or -1 if
+		// there is no limit.
+		remaining := int64(-1)
+		if !info.SizeIsDeferred {
+			remaining = info.Size - info.Offset
+		} else if handler.config.MaxSize > 0 {
+			remaining = handler.config.MaxSize - info.Offset
+		}
+
+		if remaining == 0 {
+			if !info.SizeIsDeferred {
+				return nil
+			}
+
+			// The upload has reached the maximum size, so the source must end here.
+			n, _ := body.Read(make([]byte, 1))
+			if n > 0 {
+				return ErrMaxSizeExceeded
+			}
+			return nil
+		}
+
+		limit := int64(remoteFetchSegmentSize)
+		if remaining >= 0 && remaining < limit {
+			limit = remaining
+		}
+		segment := &sourceReader{r: io.LimitReader(body, limit)}
+
+		var lock Lock
+		if handler.composer.UsesLocker {
+			var err error
+			lock, err = handler.lockRemoteFetch(c, info.ID)
+			if err != nil {
+				return err
+			}
+		}
+
+		n, err := upload.WriteChunk(c, info.Offset, segment)
+		if lock != nil {
+			lock.Unlock()
+		}
+		info.Offset += n
+
+		size := info.Size
+		if info.SizeIsDeferred {
+			size = -1
+		}
+		fetch.setProgress(info.Offset, size)
+
+		if err != nil {
+			return segment.wrapError(err)
+		}
+		handler.updateIndexedUpload(c, c.log, info.ID, info.Offset, UploadStateInProgress)
+
+		if segment.n < limit {
+			if !info.SizeIsDeferred {
+				return fmt.Errorf("%w: source ended after %d of %d bytes", ErrRemoteSourceUnavailable, info.Offset, info.Size)
+			}
+			return nil
+		}
+	}
+}
+
+// lockRemoteFetch acquires the upload's lock for writing a segment of a fetch.
+// Requests for the lock are ignored. They only have to wait for the current
+// segment, which is short enough to not hit their timeout. Since no client
+// retries the fetch, acquiring the lock is retried up to
+// remoteFetchLockAttempts times if other requests hold it for too long.
+func (handler *UnroutedHandler) lockRemoteFetch(c *httpContext, id string) (Lock, error) {
+	for attempt := 1; ; attempt++ {
+		lock, err := handler.acquireLock(c, id, func() {})
+		if !errors.Is(err, ErrLockTimeout) || attempt >= remoteFetchLockAttempts {
+			return lock, err
+		}
+
+		c.log.Info("RemoteFetchLockRetry", "attempt", attempt, "error", err)
+		select {
+		case <-time.After(time.Duration(attempt) * time.Second):
+		case <-c.Done():
+			return nil, c.Err()
+		}
+	}
+}
+
+// detachedResponseWriter is the http.ResponseWriter of fetches, which continue
+// after the response to the creation request has been sent. It discards
+// everything written to it.
+type detachedResponseWriter struct {
+	header http.Header
+}
+
+func (w detachedResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w detachedResponseWriter) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func (w detachedResponseWriter) WriteHeader(statusCode int) {}
+
+// sourceReadError is an error returned while reading from the source, after
+// which the download can be resumed.
+type sourceReadError struct {
+	err error
+}
+
+func (e sourceReadError) Error() string {
+	return "tusd: failed to read from source: " + e.err.Error()
+}
+
+func (e sourceReadError) Unwrap() error {
+	return e.err
+}
+
+// sourceReader counts the data read from the source and remembers whether a
+// read failed, so that such failures can be told apart from errors of the data
+// store.
+type sourceReader struct {
+	r       io.Reader
+	n       int64
+	readErr error
+}
+
+func (r *sourceReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	if err != nil && err != io.EOF {
+		r.readErr = err
+	}
+	return n, err
+}
+
+// wrapError marks err as a read error if reading from the source failed.
+func (r *sourceReader) wrapError(err error) error {
+	if r.readErr != nil {
+		return sourceReadError{r.readErr}
+	}
+	return err
+}
+
+// setRemoteFetchHeaders adds the Upload-Source-Status and Upload-Source-Error
+// headers to the response, if the upload is fetched by this instance.
+func (handler *UnroutedHandler) setRemoteFetchHeaders(resp HTTPResponse, id string) {
+	fetch := handler.remoteFetches.get(id)
+	if fetch == nil {
+		return
+	}
+
+	if _, _, err := fetch.progress(); err != nil {
+		resp.Header["Upload-Source-Status"] = RemoteFetchStatusFailed
+		resp.Header["Upload-Source-Error"] = err.Error()
+	} else {
+		resp.Header["Upload-Source-Status"] = RemoteFetchStatusFetching
+	}
+}
+
+// remoteFetchEvent is the data of a server-sent event about a fetch.
+type remoteFetchEvent struct {
+	Offset int64  `json:"offset"`
+	Size   int64  `json:"size"`
+	Error  string `json:"error,omitempty"`
+}
+
+// sendRemoteFetchEvents streams the progress of an upload's fetch to the client
+// as server-sent events. A progress event is sent every UploadProgressInterval
+// and a final finished or failed event once the fetch has ended. For uploads,
+// which are not fetched by this instance, only the final event is sent, based
+// on the upload's state in the data store.
+func (handler *UnroutedHandler) sendRemoteFetchEvents(c *httpContext, id string) {
+	fetch := handler.remoteFetches.get(id)
+	if fetch == nil {
+		_, info, err := handler.getUpload(c, id)
+		if err != nil {
+			handler.sendError(c, err)
+			return
+		}
+
+		fetch = &remoteFetch{offset: info.Offset, size: info.Size, done: make(chan struct{})}
+		if info.SizeIsDeferred || info.Offset != info.Size {
+			fetch.size = -1
+			fetch.err = errors.New("upload is not being fetched")
+		}
+		close(fetch.done)
+	}
+
+	header := c.res.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-store")
+	c.res.WriteHeader(http.StatusOK)
+	c.log.Info("ResponseOutgoing", "status", http.StatusOK)
+
+	ticker := time.NewTicker(handler.config.UploadProgressInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-fetch.done:
+			offset, size, err := fetch.progress()
+			if err != nil {
+				writeRemoteFetchEvent(c, "failed", remoteFetchEvent{Offset: offset, Size: size, Error: err.Error()})
+			} else {
+				writeRemoteFetchEvent(c, "finished", remoteFetchEvent{Offset: offset, Size: size})
+			}
+			return
+		case <-ticker.C:
+			offset, size, _ := fetch.progress()
+			if err := writeRemoteFetchEvent(c, "progress", remoteFetchEvent{Offset: offset, Size: size}); err != nil {
+				return
+			}
+		case <-c.Done():
+			return
+		}
+	}
+}
+
+func writeRemoteFetchEvent(c *httpContext, name string, event remoteFetchEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintf(c.res, "event: %s\ndata: %s\n\n", name, data); err != nil {
+		return err
+	}
+	return c.resC.Flush()
+}
@@ -0,0 +1,196 @@
+package handler_test
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tus/tusd/v2/pkg/filestore"
+	. "github.com/tus/tusd/v2/pkg/handler"
+	"github.com/tus/tusd/v2/pkg/memorylocker"
+)
+
+// newSourceServer serves content and supports Range requests. If interrupt is
+// set, the connection is closed after half of the content for requests without
+// a Range header.
+func newSourceServer(content string, interrupt bool) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		offset := 0
+		if header := r.Header.Get("Range"); header != "" {
+			offset, _ = strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(header, "bytes="), "-"))
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)-offset))
+			w.WriteHeader(http.StatusPartialContent)
+			io.WriteString(w, content[offset:])
+			return
+		}
+
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		if !interrupt {
+			io.WriteString(w, content)
+			return
+		}
+
+		io.WriteString(w, content[:len(content)/2])
+		w.(http.Flusher).Flush()
+		conn, _, _ := w.(http.Hijacker).Hijack()
+		conn.Close()
+	}))
+}
+
+func TestRemoteFetch(t *testing.T) {
+	content := strings.Repeat("0123456789", 1000)
+
+	newHandler := func(t *testing.T, config Config) (*Handler, string) {
+		dir := t.TempDir()
+		composer := NewStoreComposer()
+		filestore.New(dir).UseIn(composer)
+		memorylocker.New().UseIn(composer)
+
+		config.StoreComposer = composer
+		config.BasePath = "/files/"
+		config.EnableRemoteFetch = true
+		// The default client does not connect to the test server on localhost.
+		config.RemoteFetchClient = http.DefaultClient
+
+		handler, err := NewHandler(config)
+		assert.NoError(t, err)
+		return handler, dir
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		source := newSourceServer(content, true)
+		defer source.Close()
+
+		handler, dir := newHandler(t, Config{
+			NotifyCompleteUploads: true,
+		})
+		completions := make(chan HookEvent, 1)
+		handler.CompleteUploads = completions
+
+		res := (&httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable":     "1.0.0",
+				"Upload-Source-Url": source.URL + "/file.txt",
+			},
+			Code: http.StatusCreated,
+			ResHeader: map[string]string{
+				"Upload-Source-Status": "fetching",
+			},
+		}).Run(handler, t)
+
+		select {
+		case event := <-completions:
+			assert.EqualValues(t, len(content), event.Upload.Size)
+			assert.EqualValues(t, len(content), event.Upload.Offset)
+		case <-time.After(10 * time.Second):
+			t.Fatal("upload has not been finished")
+		}
+
+		// The download has been resumed after the interruption.
+		id := filepath.Base(res.Header().Get("Location"))
+		data, err := os.ReadFile(filepath.Join(dir, id))
+		assert.NoError(t, err)
+		assert.Equal(t, content, string(data))
+	})
+
+	t.Run("NotAllowed", func(t *testing.T) {
+		handler, _ := newHandler(t, Config{
+			RemoteFetchAllowURL: func(u *url.URL) error {
+				if u.Hostname() != "example.com" {
+					return errors.New("host not allowed")
+				}
+				return nil
+			},
+		})
+
+		(&httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable":     "1.0.0",
+				"Upload-Source-Url": "https://internal.example/file.txt",
+			},
+			Code: http.StatusForbidden,
+		}).Run(handler, t)
+
+		(&httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable":     "1.0.0",
+				"Upload-Source-Url": "file:///etc/passwd",
+			},
+			Code: http.StatusBadRequest,
+		}).Run(handler, t)
+	})
+
+	t.Run("RejectedByHook", func(t *testing.T) {
+		requested := false
+		source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requested = true
+		}))
+		defer source.Close()
+
+		handler, _ := newHandler(t, Config{
+			PreUploadCreateCallback: func(hook HookEvent) (HTTPResponse, FileInfoChanges, error) {
+				assert.True(t, hook.Upload.SizeIsDeferred)
+				return HTTPResponse{}, FileInfoChanges{}, NewError("ERR_REJECTED", "rejected", http.StatusForbidden)
+			},
+		})
+
+		(&httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable":     "1.0.0",
+				"Upload-Source-Url": source.URL,
+			},
+			Code: http.StatusForbidden,
+		}).Run(handler, t)
+
+		// The source is not requested for rejected uploads.
+		assert.False(t, requested)
+	})
+
+	t.Run("SourceUnavailable", func(t *testing.T) {
+		source := httptest.NewServer(http.NotFoundHandler())
+		defer source.Close()
+
+		handler, _ := newHandler(t, Config{})
+
+		(&httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable":     "1.0.0",
+				"Upload-Source-Url": source.URL,
+			},
+			Code: http.StatusBadGateway,
+		}).Run(handler, t)
+	})
+
+	t.Run("MaxSizeExceeded", func(t *testing.T) {
+		source := newSourceServer(content, false)
+		defer source.Close()
+
+		handler, _ := newHandler(t, Config{
+			MaxSize: 100,
+		})
+
+		(&httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable":     "1.0.0",
+				"Upload-Source-Url": source.URL,
+			},
+			Code: http.StatusRequestEntityTooLarge,
+		}).Run(handler, t)
+	})
+}
@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ResponseHeaderConfig contains additional headers, which are included in the
+// handler's responses, for example security headers or a header identifying
+// the service, see Config.ResponseHeaders. Headers set by the handler itself,
+// such as Upload-Offset or the CORS headers, take precedence.
+type ResponseHeaderConfig struct {
+	// All is added to every response, including OPTIONS requests.
+	All HTTPHeader `json:"all,omitempty"`
+	// Creation is added to the responses of POST requests.
+	Creation HTTPHeader `json:"creation,omitempty"`
+	// Upload is added to the responses of HEAD, PATCH and DELETE requests.
+	Upload HTTPHeader `json:"upload,omitempty"`
+	// Download is added to the responses of GET requests.
+	Download HTTPHeader `json:"download,omitempty"`
+}
+
+// forMethod returns the group of headers for requests using method, or nil
+// for methods without a group.
+func (config ResponseHeaderConfig) forMethod(method string) HTTPHeader {
+	switch method {
+	case http.MethodPost:
+		return config.Creation
+	case http.MethodHead, http.MethodPatch, http.MethodDelete:
+		return config.Upload
+	case http.MethodGet:
+		return config.Download
+	default:
+		return nil
+	}
+}
+
+// apply sets the headers for requests using method in header.
+func (config ResponseHeaderConfig) apply(header http.Header, method string) {
+	for key, value := range config.All {
+		header.Set(key, value)
+	}
+	for key, value := range config.forMethod(method) {
+		header.Set(key, value)
+	}
+}
+
+// validateResponseHeaders checks that the headers can be sent in a response.
+func validateResponseHeaders(config ResponseHeaderConfig) error {
+	for _, headers := range []HTTPHeader{config.All, config.Creation, config.Upload, config.Download} {
+		if err := ValidateHeaders(headers); err != nil {
+			return fmt.Errorf("tusd: invalid response header: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// ValidateHeaders checks that the names of the headers only consist of the
+// characters allowed by RFC 9110 and that the values do not contain line
+// breaks, which would allow injecting additional headers.
+func ValidateHeaders(headers HTTPHeader) error {
+	for key, value := range headers {
+		if key == "" || strings.IndexFunc(key, func(r rune) bool { return !isTokenChar(r) }) != -1 {
+			return fmt.Errorf("header name %q is not valid", key)
+		}
+		if strings.ContainsAny(value, "\r\n\x00") {
+			return fmt.Errorf("value of header %s must not contain line breaks", key)
+		}
+	}
+
+	return nil
+}
+
+// isTokenChar reports whether r may be used in a header name.
+func isTokenChar(r rune) bool {
+	if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+		return true
+	}
+	return strings.ContainsRune("!#$%&'*+-.^_`|~", r)
+}
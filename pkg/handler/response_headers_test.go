@@ -0,0 +1,101 @@
+package handler_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/tus/tusd/v2/pkg/handler"
+)
+
+func TestResponseHeaders(t *testing.T) {
+	responseHeaders := ResponseHeaderConfig{
+		All: HTTPHeader{
+			"X-Served-By": "tusd-1",
+			// Headers of the handler take precedence.
+			"Tus-Resumable": "0.2.0",
+		},
+		Upload: HTTPHeader{
+			"X-Frame-Options": "DENY",
+		},
+		Download: HTTPHeader{
+			"Content-Security-Policy": "default-src 'none'",
+		},
+	}
+
+	SubTest(t, "Options", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		handler, _ := NewHandler(Config{
+			StoreComposer:   composer,
+			ResponseHeaders: responseHeaders,
+		})
+
+		(&httpTest{
+			Method: "OPTIONS",
+			Code:   http.StatusOK,
+			ResHeader: map[string]string{
+				"X-Served-By":             "tusd-1",
+				"Tus-Resumable":           "1.0.0",
+				"X-Frame-Options":         "",
+				"Content-Security-Policy": "",
+			},
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "Head", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				Offset: 11,
+				Size:   44,
+			}, nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:   composer,
+			ResponseHeaders: responseHeaders,
+		})
+
+		(&httpTest{
+			Method: "HEAD",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+			},
+			Code: http.StatusOK,
+			ResHeader: map[string]string{
+				"X-Served-By":             "tusd-1",
+				"X-Frame-Options":         "DENY",
+				"Content-Security-Policy": "",
+				"Upload-Offset":           "11",
+			},
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "InvalidHeader", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		_, err := NewHandler(Config{
+			StoreComposer: composer,
+			ResponseHeaders: ResponseHeaderConfig{
+				Download: HTTPHeader{
+					"X-Injected": "value\r\nSet-Cookie: session=1",
+				},
+			},
+		})
+		assert.Error(t, err)
+
+		_, err = NewHandler(Config{
+			StoreComposer: composer,
+			ResponseHeaders: ResponseHeaderConfig{
+				All: HTTPHeader{
+					"X Served By": "tusd",
+				},
+			},
+		})
+		assert.Error(t, err)
+	})
+}
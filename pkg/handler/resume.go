@@ -0,0 +1,133 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+)
+
+// PrincipalTagPrefix is prepended to the principal's ID to form the tag, with
+// which uploads are attributed to their creator in the UploadIndex, e.g.
+// "principal:user-42". See Config.ResolvePrincipal.
+const PrincipalTagPrefix = "principal:"
+
+// maxFingerprintSize limits the size of request bodies for resume discovery.
+const maxFingerprintSize = 64 * 1024
+
+// Fingerprint identifies the file, whose upload a client wants to resume.
+type Fingerprint struct {
+	// Filename must equal the upload's "filename" metadata.
+	Filename string `json:"filename"`
+	// Size must equal the upload's size.
+	Size int64 `json:"size"`
+	// Hash must equal the upload's metadata under Config.ResumeHashMetadataKey.
+	Hash string `json:"hash"`
+}
+
+// resumableUpload describes an upload found by resume discovery.
+type resumableUpload struct {
+	URL    string `json:"url"`
+	Offset int64  `json:"offset"`
+	Size   int64  `json:"size"`
+}
+
+// resumeResponse is the body of responses to resume discovery requests. The
+// fingerprint is echoed, so clients can associate the response with the file.
+type resumeResponse struct {
+	Fingerprint Fingerprint       `json:"fingerprint"`
+	Uploads     []resumableUpload `json:"uploads"`
+}
+
+// PostResume handles requests for resume discovery, see Config.EnableResumeDiscovery.
+// This is not part of the specification.
+//
+// The client sends the fingerprint of a file as JSON object with the filename,
+// size and hash properties. The response contains the URLs of the unfinished
+// uploads of this file, which have been created by the same principal, with
+// the most recent first. This allows clients to resume uploads after they
+// lost their local state, e.g. after being reinstalled.
+func (handler *UnroutedHandler) PostResume(w http.ResponseWriter, r *http.Request) {
+	c := handler.getContext(w, r)
+
+	if !handler.config.EnableResumeDiscovery {
+		handler.sendError(c, ErrNotImplemented)
+		return
+	}
+
+	principal, err := handler.config.ResolvePrincipal(r)
+	if err != nil || principal == "" {
+		handler.sendError(c, ErrPrincipalMissing)
+		return
+	}
+	c.log = c.log.With("principal", principal)
+
+	var fingerprint Fingerprint
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxFingerprintSize)).Decode(&fingerprint); err != nil {
+		handler.sendError(c, ErrInvalidFingerprint)
+		return
+	}
+	if fingerprint.Filename == "" || fingerprint.Size <= 0 || fingerprint.Hash == "" {
+		handler.sendError(c, ErrInvalidFingerprint)
+		return
+	}
+
+	entries, _, err := handler.config.UploadIndex.SearchUploads(c, IndexQuery{
+		Tags: []string{PrincipalTagPrefix + principal},
+		MetaData: MetaData{
+			"filename":                           fingerprint.Filename,
+			handler.config.ResumeHashMetadataKey: fingerprint.Hash,
+		},
+		State: UploadStateInProgress,
+	})
+	if err != nil {
+		handler.sendError(c, err)
+		return
+	}
+
+	resp := resumeResponse{
+		Fingerprint: fingerprint,
+		Uploads:     []resumableUpload{},
+	}
+	for _, entry := range entries {
+		if entry.Size != fingerprint.Size {
+			continue
+		}
+
+		resp.Uploads = append(resp.Uploads, resumableUpload{
+			URL:    handler.absFileURL(r, entry.ID),
+			Offset: entry.Offset,
+			Size:   entry.Size,
+		})
+	}
+
+	body, err := json.Marshal(resp)
+	if err != nil {
+		handler.sendError(c, err)
+		return
+	}
+
+	c.log.Info("ResumeDiscovered", "uploads", len(resp.Uploads))
+
+	handler.sendResp(c, HTTPResponse{
+		StatusCode: http.StatusOK,
+		Header: HTTPHeader{
+			"Content-Type": "application/json",
+		},
+		Body: string(body),
+	})
+}
+
+// principalTag returns the tag attributing a new upload to the principal, who
+// created it, or an empty string if the principal is unknown.
+func (handler *UnroutedHandler) principalTag(c *httpContext) string {
+	if handler.config.ResolvePrincipal == nil {
+		return ""
+	}
+
+	principal, err := handler.config.ResolvePrincipal(c.req)
+	if err != nil || principal == "" {
+		return ""
+	}
+
+	return PrincipalTagPrefix + principal
+}
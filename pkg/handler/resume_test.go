@@ -0,0 +1,167 @@
+package handler_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/tus/tusd/v2/pkg/handler"
+)
+
+func principalFromHeader(r *http.Request) (string, error) {
+	principal := r.Header.Get("X-User")
+	if principal == "" {
+		return "", errors.New("no user")
+	}
+	return principal, nil
+}
+
+func TestResumeDiscovery(t *testing.T) {
+	SubTest(t, "TagOnCreate", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().NewUpload(gomock.Any(), gomock.Any()).Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:   "foo",
+				Size: 300,
+			}, nil),
+		)
+
+		index := NewMemoryUploadIndex()
+		handler, _ := NewHandler(Config{
+			StoreComposer:    composer,
+			BasePath:         "/files/",
+			UploadIndex:      index,
+			ResolvePrincipal: principalFromHeader,
+		})
+
+		(&httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Upload-Length": "300",
+				"X-User":        "alice",
+			},
+			Code: http.StatusCreated,
+		}).Run(handler, t)
+
+		entries, _, err := index.SearchUploads(context.Background(), IndexQuery{})
+		a := assert.New(t)
+		a.NoError(err)
+		a.Len(entries, 1)
+		a.Equal([]string{"principal:alice"}, entries[0].Tags)
+	})
+
+	SubTest(t, "Discover", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		index := NewMemoryUploadIndex()
+		start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		for i, entry := range []IndexEntry{
+			{ID: "a", Size: 100, Offset: 20, Tags: []string{"principal:alice"}},
+			{ID: "b", Size: 100, Offset: 40, Tags: []string{"principal:alice"}},
+			// Uploads of other principals, finished uploads and uploads of other
+			// files are not returned.
+			{ID: "c", Size: 100, Tags: []string{"principal:bob"}},
+			{ID: "d", Size: 100, Offset: 100, Tags: []string{"principal:alice"}, State: UploadStateFinished},
+			{ID: "e", Size: 200, Tags: []string{"principal:alice"}},
+		} {
+			entry.MetaData = MetaData{"filename": "a.txt", "filehash": "abc"}
+			if entry.State == "" {
+				entry.State = UploadStateInProgress
+			}
+			entry.CreatedAt = start.Add(time.Duration(i) * time.Hour)
+			entry.UpdatedAt = entry.CreatedAt
+			index.AddUpload(context.Background(), entry)
+		}
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:         composer,
+			BasePath:              "https://tus.io/files/",
+			UploadIndex:           index,
+			ResolvePrincipal:      principalFromHeader,
+			EnableResumeDiscovery: true,
+		})
+
+		(&httpTest{
+			Method: "POST",
+			URL:    "resume",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"X-User":        "alice",
+			},
+			ReqBody: strings.NewReader(`{"filename":"a.txt","size":100,"hash":"abc"}`),
+			Code:    http.StatusOK,
+			ResHeader: map[string]string{
+				"Content-Type": "application/json",
+			},
+			ResBody: `{"fingerprint":{"filename":"a.txt","size":100,"hash":"abc"},"uploads":[{"url":"https://tus.io/files/b","offset":40,"size":100},{"url":"https://tus.io/files/a","offset":20,"size":100}]}`,
+		}).Run(handler, t)
+
+		(&httpTest{
+			Method: "POST",
+			URL:    "resume",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"X-User":        "carol",
+			},
+			ReqBody: strings.NewReader(`{"filename":"a.txt","size":100,"hash":"abc"}`),
+			Code:    http.StatusOK,
+			ResBody: `{"fingerprint":{"filename":"a.txt","size":100,"hash":"abc"},"uploads":[]}`,
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "MissingPrincipal", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		handler, _ := NewHandler(Config{
+			StoreComposer:         composer,
+			UploadIndex:           NewMemoryUploadIndex(),
+			ResolvePrincipal:      principalFromHeader,
+			EnableResumeDiscovery: true,
+		})
+
+		(&httpTest{
+			Method: "POST",
+			URL:    "resume",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+			},
+			ReqBody: strings.NewReader(`{"filename":"a.txt","size":100,"hash":"abc"}`),
+			Code:    http.StatusUnauthorized,
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "InvalidFingerprint", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		handler, _ := NewHandler(Config{
+			StoreComposer:         composer,
+			UploadIndex:           NewMemoryUploadIndex(),
+			ResolvePrincipal:      principalFromHeader,
+			EnableResumeDiscovery: true,
+		})
+
+		(&httpTest{
+			Method: "POST",
+			URL:    "resume",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"X-User":        "alice",
+			},
+			ReqBody: strings.NewReader(`{"filename":"a.txt"}`),
+			Code:    http.StatusBadRequest,
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "RequiresIndex", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		_, err := NewHandler(Config{
+			StoreComposer:         composer,
+			EnableResumeDiscovery: true,
+		})
+		assert.Error(t, err)
+	})
+}
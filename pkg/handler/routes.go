@@ -0,0 +1,186 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Route is an endpoint of the handler, which can be registered in an existing
+// router, see UnroutedHandler.Routes.
+type Route struct {
+	// Method is the HTTP method, e.g. PATCH.
+	Method string
+	// Pattern is the path relative to the handler's base path, e.g. "" for
+	// creating uploads or RouteOptions.IDPattern for an upload's URL.
+	Pattern string
+	// Handler serves the requests.
+	Handler http.Handler
+}
+
+// RouteOptions adjusts the routes returned by UnroutedHandler.Routes to the
+// syntax of a router.
+type RouteOptions struct {
+	// IDPattern is the router's syntax for the path parameter containing the
+	// upload ID, e.g. "{id}" for chi and gorilla/mux or ":id" for gin and echo.
+	IDPattern string
+	// UploadID extracts the upload ID from the request, for example using
+	// chi.URLParam or mux.Vars. If nil, the last segment of the request's path
+	// is used, which is sufficient if the routes are registered with their
+	// patterns appended to the base path.
+	UploadID func(r *http.Request) string
+}
+
+type uploadIDKey struct{}
+
+// WithUploadID returns a shallow copy of the request, for which the handler
+// uses id as upload ID instead of the last segment of the request's path.
+// This allows serving uploads from URLs, where the ID is followed by further
+// segments, or reading it from the path parameters of routers, whose context
+// is not attached to the request, such as gin or echo.
+func WithUploadID(r *http.Request, id string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), uploadIDKey{}, id))
+}
+
+// extractIDFromRequest returns the upload ID set using WithUploadID or the
+// last segment of the request's path otherwise.
+func extractIDFromRequest(r *http.Request) (string, error) {
+	if id, _ := r.Context().Value(uploadIDKey{}).(string); id != "" {
+		return id, nil
+	}
+
+	return extractIDFromPath(r.URL.Path)
+}
+
+// routes returns the endpoints served by the handler without the handler's
+// Middleware, in the order in which they must be registered in routers, which
+// match routes in the order of their registration.
+func (handler *UnroutedHandler) routes(idPattern string) []Route {
+	config := handler.config
+
+	writes := config.Mode.allowsWrites()
+
+	var routes []Route
+	if writes {
+		routes = append(routes, Route{"POST", "", http.HandlerFunc(handler.PostFile)})
+	}
+	routes = append(routes, Route{"HEAD", idPattern, http.HandlerFunc(handler.HeadFile)})
+	if writes {
+		routes = append(routes, Route{"PATCH", idPattern, http.HandlerFunc(handler.PatchFile)})
+	}
+	if config.Mode.allowsReads() && !config.DisableDownload {
+		routes = append(routes, Route{"GET", idPattern, http.HandlerFunc(handler.GetFile)})
+	}
+
+	// The resume discovery endpoint must be registered before the direct part
+	// uploads, which would otherwise handle it as an upload's URL.
+	if writes && config.EnableResumeDiscovery {
+		routes = append(routes, Route{"POST", "resume", http.HandlerFunc(handler.PostResume)})
+	}
+
+	if writes && config.EnableDirectPartUploads {
+		routes = append(routes, Route{"POST", idPattern, http.HandlerFunc(handler.PostPart)})
+	}
+
+	// Only attach the DELETE handler if the Terminate() method is provided
+	if writes && config.StoreComposer.UsesTerminater && !config.DisableTermination {
+		routes = append(routes, Route{"DELETE", idPattern, http.HandlerFunc(handler.DelFile)})
+	}
+
+	return routes
+}
+
+// Routes returns the endpoints, which NewHandler registers, so that the handler
+// can be mounted into an existing router, such as chi, gorilla/mux, gin or echo,
+// under the handler's base path. The endpoints respect options like
+// Config.DisableDownload and Config.Mode and are listed in the order, in which they must be
+// registered in routers, which match routes in the order of their registration.
+// In addition, OPTIONS routes are included for CORS preflight requests and a
+// POST route for upload URLs, which receives requests using the
+// X-HTTP-Method-Override header.
+//
+// Each handler includes the handler's Middleware, so that the middlewares
+// registered using Use are invoked in the same order as with NewHandler. Since
+// the method may be overridden by the Middleware, all handlers of a pattern
+// dispatch the request based on its final method.
+//
+// For example, using chi:
+//
+//	routes := handler.Routes(tusd.RouteOptions{IDPattern: "{id}"})
+//	for _, route := range routes {
+//		router.Method(route.Method, "/files/"+route.Pattern, route.Handler)
+//	}
+//
+// Using gin, whose path parameters are not available from the request:
+//
+//	routes := handler.Routes(tusd.RouteOptions{IDPattern: ":id"})
+//	for _, route := range routes {
+//		route := route
+//		router.Handle(route.Method, "/files/"+route.Pattern, func(c *gin.Context) {
+//			route.Handler.ServeHTTP(c.Writer, tusd.WithUploadID(c.Request, c.Param("id")))
+//		})
+//	}
+func (handler *UnroutedHandler) Routes(options RouteOptions) []Route {
+	routes := handler.routes(options.IDPattern)
+
+	// methods maps each pattern to the handlers for its methods.
+	methods := make(map[string]map[string]http.Handler)
+	var patterns []string
+	for _, route := range routes {
+		if methods[route.Pattern] == nil {
+			methods[route.Pattern] = make(map[string]http.Handler)
+			patterns = append(patterns, route.Pattern)
+		}
+		methods[route.Pattern][route.Method] = route.Handler
+	}
+
+	if _, ok := methods[options.IDPattern]["POST"]; !ok {
+		routes = append(routes, Route{Method: "POST", Pattern: options.IDPattern})
+	}
+	for _, pattern := range patterns {
+		routes = append(routes, Route{Method: "OPTIONS", Pattern: pattern})
+	}
+
+	dispatchers := make(map[string]http.Handler, len(patterns))
+	for _, pattern := range patterns {
+		dispatchers[pattern] = handler.Middleware(methodDispatcher(methods[pattern]))
+	}
+
+	for i := range routes {
+		h := dispatchers[routes[i].Pattern]
+		if options.UploadID != nil {
+			// The upload ID is attached before the middlewares are invoked, so
+			// that ParseRequest reports it.
+			next := h
+			h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				next.ServeHTTP(w, WithUploadID(r, options.UploadID(r)))
+			})
+		}
+		routes[i].Handler = h
+	}
+
+	return routes
+}
+
+// methodDispatcher passes requests to the handler for their method or responds
+// with 405 Method Not Allowed.
+func methodDispatcher(handlers map[string]http.Handler) http.Handler {
+	allowed := make([]string, 0, len(handlers))
+	for method := range handlers {
+		allowed = append(allowed, method)
+	}
+	sort.Strings(allowed)
+	allow := strings.Join(allowed, ", ")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h, ok := handlers[r.Method]
+		if !ok {
+			w.Header().Set("Allow", allow)
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,110 @@
+package handler_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/tus/tusd/v2/pkg/handler"
+)
+
+func TestRoutes(t *testing.T) {
+	SubTest(t, "List", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		handler, _ := NewUnroutedHandler(Config{
+			StoreComposer:   composer,
+			DisableDownload: true,
+		})
+
+		var routes []string
+		for _, route := range handler.Routes(RouteOptions{IDPattern: "{id}"}) {
+			routes = append(routes, route.Method+" "+route.Pattern)
+		}
+
+		assert.Equal(t, []string{
+			"POST ",
+			"HEAD {id}",
+			"PATCH {id}",
+			"DELETE {id}",
+			"POST {id}",
+			"OPTIONS ",
+			"OPTIONS {id}",
+		}, routes)
+	})
+
+	SubTest(t, "UploadID", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				Offset: 11,
+				Size:   44,
+			}, nil),
+		)
+
+		handler, _ := NewUnroutedHandler(Config{
+			StoreComposer: composer,
+		})
+
+		routes := handler.Routes(RouteOptions{
+			IDPattern: ":id",
+			// The upload's URL is /uploads/:id/content in this example.
+			UploadID: func(r *http.Request) string {
+				return strings.Split(r.URL.Path, "/")[2]
+			},
+		})
+
+		var head http.Handler
+		for _, route := range routes {
+			if route.Method == "HEAD" {
+				head = route.Handler
+			}
+		}
+
+		req := httptest.NewRequest("HEAD", "/uploads/yes/content", nil)
+		req.Header.Set("Tus-Resumable", "1.0.0")
+		w := httptest.NewRecorder()
+		head.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "11", w.Header().Get("Upload-Offset"))
+	})
+
+	SubTest(t, "MethodOverride", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			store.EXPECT().AsTerminatableUpload(upload).Return(upload),
+			upload.EXPECT().Terminate(gomock.Any()).Return(nil),
+		)
+
+		handler, _ := NewUnroutedHandler(Config{
+			StoreComposer: composer,
+		})
+
+		// The router selects the POST route before the method is overridden.
+		var post http.Handler
+		for _, route := range handler.Routes(RouteOptions{IDPattern: ":id"}) {
+			if route.Method == "POST" && route.Pattern == ":id" {
+				post = route.Handler
+			}
+		}
+
+		req := httptest.NewRequest("POST", "/files/yes", nil)
+		req.Header.Set("Tus-Resumable", "1.0.0")
+		req.Header.Set("X-HTTP-Method-Override", "DELETE")
+		w := httptest.NewRecorder()
+		post.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNoContent, w.Code)
+	})
+}
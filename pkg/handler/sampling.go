@@ -0,0 +1,68 @@
+package handler
+
+// UploadSampler receives copies of the data at the beginning of selected
+// uploads, for example to classify their content in a separate pipeline. The
+// data is copied while it is read from the request body, so sampling does not
+// delay writing it to the data store.
+type UploadSampler interface {
+	// SampleBytes returns how many bytes from the beginning of the upload are
+	// sampled. Zero means that the upload is not sampled. It is called for every
+	// request writing data to an upload, so the decision should not change
+	// between requests for the same upload.
+	SampleBytes(info FileInfo) int64
+	// Sample receives the data read from a request for a sampled upload, as
+	// long as the request's data starts before the number of bytes returned by
+	// SampleBytes. Since the beginning of an upload may be sent in multiple
+	// requests, Sample may be called multiple times for an upload. It is called
+	// before the response is sent and must not block.
+	Sample(sample UploadSample)
+}
+
+// UploadSample is a copy of data received for an upload.
+type UploadSample struct {
+	// Upload is the upload before the data was written.
+	Upload FileInfo
+	// Offset is the position of the data in the upload.
+	Offset int64
+	// Data is the copied data, which is owned by the sampler.
+	Data []byte
+}
+
+// sampleBuffer collects data read from a request body for an UploadSampler.
+type sampleBuffer struct {
+	data  []byte
+	limit int64
+}
+
+func (b *sampleBuffer) write(p []byte) {
+	if remaining := b.limit - int64(len(b.data)); remaining < int64(len(p)) {
+		p = p[:remaining]
+	}
+	b.data = append(b.data, p...)
+}
+
+// startSampling lets the request body copy data for the sampler, if the upload
+// is sampled and the request's data starts within the sampled range.
+func (handler *UnroutedHandler) startSampling(c *httpContext, info FileInfo) {
+	sampler := handler.config.UploadSampler
+	if sampler == nil {
+		return
+	}
+
+	if n := sampler.SampleBytes(info); n > info.Offset {
+		c.body.sample = &sampleBuffer{limit: n - info.Offset}
+	}
+}
+
+// finishSampling passes the data copied from the request body to the sampler.
+func (handler *UnroutedHandler) finishSampling(c *httpContext, info FileInfo) {
+	if c.body.sample == nil || len(c.body.sample.data) == 0 {
+		return
+	}
+
+	handler.config.UploadSampler.Sample(UploadSample{
+		Upload: info,
+		Offset: info.Offset,
+		Data:   c.body.sample.data,
+	})
+}
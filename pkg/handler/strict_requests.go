@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"net/http"
+	"net/textproto"
+)
+
+// strictHeaders are the headers, which are interpreted by the handler and must
+// therefore have a single value in strict mode. Otherwise, tusd and a proxy in
+// front of it might act on different values.
+var strictHeaders = []string{
+	"Tus-Resumable",
+	"Upload-Offset",
+	"Upload-Length",
+	"Upload-Defer-Length",
+	"Upload-Metadata",
+	"Upload-Concat",
+	"Upload-Checksum",
+	"Upload-Incomplete",
+	"Upload-Draft-Interop-Version",
+	"Content-Type",
+	"X-HTTP-Method-Override",
+}
+
+// checkHeaders enforces Config.MaxHeaderSize and, if Config.StrictRequests is
+// enabled, the framing of the body and the uniqueness of tus headers. Duplicate
+// headers with identical values are reduced to one value in r.Header.
+func (handler *UnroutedHandler) checkHeaders(r *http.Request) error {
+	if limit := handler.config.MaxHeaderSize; limit > 0 && headerSize(r.Header) > limit {
+		return ErrHeadersTooLarge
+	}
+
+	if !handler.config.StrictRequests {
+		return nil
+	}
+
+	// Go's HTTP server ignores Transfer-Encoding in HTTP/1.0 requests and
+	// reads the body according to Content-Length, while a proxy might have
+	// followed the Transfer-Encoding header instead. Since the header is
+	// removed before the request reaches the handler, all HTTP/1.0 requests
+	// with a body are rejected.
+	if !r.ProtoAtLeast(1, 1) && r.ContentLength != 0 {
+		return ErrAmbiguousRequestBody
+	}
+
+	switch r.Method {
+	case "GET", "HEAD", "DELETE", "OPTIONS":
+		if r.ContentLength != 0 || len(r.TransferEncoding) > 0 {
+			return ErrAmbiguousRequestBody
+		}
+	}
+
+	for _, name := range strictHeaders {
+		key := textproto.CanonicalMIMEHeaderKey(name)
+		values := r.Header[key]
+		if len(values) < 2 {
+			continue
+		}
+
+		for _, value := range values[1:] {
+			if value != values[0] {
+				return ErrConflictingHeaders
+			}
+		}
+		r.Header[key] = values[:1]
+	}
+
+	return nil
+}
+
+// headerSize returns the size of the header as sent over HTTP/1.1, i.e. each
+// field including the colon, the space and the line break.
+func headerSize(header http.Header) int {
+	size := 0
+	for name, values := range header {
+		for _, value := range values {
+			size += len(name) + len(value) + 4
+		}
+	}
+
+	return size
+}
@@ -0,0 +1,110 @@
+package handler_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/tus/tusd/v2/pkg/handler"
+)
+
+func TestStrictRequests(t *testing.T) {
+	serve := func(handler http.Handler, req *http.Request) *httptest.ResponseRecorder {
+		req.Host = "tus.io"
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	SubTest(t, "IdenticalDuplicates", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				Offset: 11,
+				Size:   44,
+			}, nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:  composer,
+			StrictRequests: true,
+		})
+
+		req, _ := http.NewRequest("HEAD", "yes", nil)
+		req.Header.Add("Tus-Resumable", "1.0.0")
+		req.Header.Add("Tus-Resumable", "1.0.0")
+		res := serve(handler, req)
+		assert.Equal(t, http.StatusOK, res.Code)
+		assert.Equal(t, "11", res.Header().Get("Upload-Offset"))
+	})
+
+	SubTest(t, "ConflictingDuplicates", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		handler, _ := NewHandler(Config{
+			StoreComposer:  composer,
+			StrictRequests: true,
+		})
+
+		req, _ := http.NewRequest("PATCH", "yes", strings.NewReader("hello"))
+		req.Header.Set("Tus-Resumable", "1.0.0")
+		req.Header.Set("Content-Type", "application/offset+octet-stream")
+		req.Header.Add("Upload-Offset", "5")
+		req.Header.Add("Upload-Offset", "0")
+		res := serve(handler, req)
+		assert.Equal(t, http.StatusBadRequest, res.Code)
+		assert.Contains(t, res.Body.String(), "ERR_CONFLICTING_HEADERS")
+	})
+
+	SubTest(t, "BodyNotAllowed", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		handler, _ := NewHandler(Config{
+			StoreComposer:  composer,
+			StrictRequests: true,
+		})
+
+		req, _ := http.NewRequest("DELETE", "yes", strings.NewReader("PATCH /files/other HTTP/1.1"))
+		req.Header.Set("Tus-Resumable", "1.0.0")
+		res := serve(handler, req)
+		assert.Equal(t, http.StatusBadRequest, res.Code)
+		assert.Contains(t, res.Body.String(), "ERR_AMBIGUOUS_REQUEST_BODY")
+	})
+
+	SubTest(t, "HTTP10Body", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		handler, _ := NewHandler(Config{
+			StoreComposer:  composer,
+			StrictRequests: true,
+		})
+
+		req, _ := http.NewRequest("PATCH", "yes", strings.NewReader("hello"))
+		req.Proto, req.ProtoMajor, req.ProtoMinor = "HTTP/1.0", 1, 0
+		req.Header.Set("Tus-Resumable", "1.0.0")
+		req.Header.Set("Content-Type", "application/offset+octet-stream")
+		req.Header.Set("Upload-Offset", "0")
+		res := serve(handler, req)
+		assert.Equal(t, http.StatusBadRequest, res.Code)
+		assert.Contains(t, res.Body.String(), "ERR_AMBIGUOUS_REQUEST_BODY")
+	})
+
+	SubTest(t, "MaxHeaderSize", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+			MaxHeaderSize: 1024,
+		})
+
+		(&httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable":   "1.0.0",
+				"Upload-Length":   "5",
+				"Upload-Metadata": "filename " + strings.Repeat("a", 1024),
+			},
+			Code: http.StatusRequestHeaderFieldsTooLarge,
+		}).Run(handler, t)
+	})
+}
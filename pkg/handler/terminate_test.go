@@ -1,8 +1,11 @@
 package handler_test
 
 import (
+	"context"
+	"io"
 	"net/http"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	. "github.com/tus/tusd/v2/pkg/handler"
@@ -100,4 +103,191 @@ func TestTerminate(t *testing.T) {
 			Code: http.StatusNotImplemented,
 		}).Run(http.HandlerFunc(handler.DelFile), t)
 	})
+
+	SubTest(t, "ServerSideNotProvided", func(t *testing.T, store *MockFullDataStore, _ *StoreComposer) {
+		composer := NewStoreComposer()
+		composer.UseCore(store)
+
+		handler, _ := NewUnroutedHandler(Config{
+			StoreComposer: composer,
+		})
+
+		err := handler.TerminateUpload(context.Background(), "foo")
+		assert.Equal(t, ErrNotImplemented, err)
+	})
+
+	SubTest(t, "ServerSide", func(t *testing.T, store *MockFullDataStore, _ *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		locker := NewMockFullLocker(ctrl)
+		lock := NewMockFullLock(ctrl)
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			locker.EXPECT().NewLock("foo").Return(lock, nil),
+			lock.EXPECT().Lock(gomock.Any(), gomock.Any()).Return(nil),
+			store.EXPECT().GetUpload(gomock.Any(), "foo").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:   "foo",
+				Size: 10,
+			}, nil),
+			store.EXPECT().AsTerminatableUpload(upload).Return(upload),
+			upload.EXPECT().Terminate(gomock.Any()).Return(nil),
+			lock.EXPECT().Unlock().Return(nil),
+		)
+
+		composer := NewStoreComposer()
+		composer.UseCore(store)
+		composer.UseTerminater(store)
+		composer.UseLocker(locker)
+
+		handler, _ := NewUnroutedHandler(Config{
+			StoreComposer:           composer,
+			NotifyTerminatedUploads: true,
+		})
+
+		c := make(chan HookEvent, 1)
+		handler.TerminatedUploads = c
+
+		a := assert.New(t)
+		a.NoError(handler.TerminateUpload(context.Background(), "foo"))
+
+		event := <-c
+		a.Equal("foo", event.Upload.ID)
+		a.Equal(int64(10), event.Upload.Size)
+		a.Equal("", event.HTTPRequest.Method)
+	})
+
+	SubTest(t, "ServerSideInterruptsRequest", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		// The PATCH request and the termination run concurrently, so only the
+		// calls of the PATCH request can be expected in order.
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 0,
+				Size:   100,
+			}, nil),
+			upload.EXPECT().WriteChunk(gomock.Any(), int64(0), NewReaderMatcher("first ")).Return(int64(6), nil),
+		)
+		store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil)
+		store.EXPECT().AsTerminatableUpload(upload).Return(upload)
+		upload.EXPECT().Terminate(gomock.Any()).Return(nil)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+		})
+
+		reader, writer := io.Pipe()
+		a := assert.New(t)
+		done := make(chan struct{})
+
+		go func() {
+			defer close(done)
+			writer.Write([]byte("first "))
+
+			// Wait until the received data has been accounted for.
+			var active []ActiveUpload
+			for i := 0; i < 100; i++ {
+				active = handler.ActiveUploads()
+				if len(active) == 1 && active[0].BytesReceived == 6 {
+					break
+				}
+				<-time.After(time.Millisecond)
+			}
+
+			a.Len(active, 1)
+			a.Equal("yes", active[0].ID)
+			a.Equal(int64(6), active[0].Offset)
+			a.Equal(int64(100), active[0].Size)
+
+			a.NoError(handler.TerminateUpload(context.Background(), "yes"))
+
+			// Wait a short time to ensure that the goroutine in the PATCH
+			// handler has received and processed the interruption.
+			<-time.After(10 * time.Millisecond)
+
+			// Assert that the "request body" has been closed.
+			_, err := writer.Write([]byte("second "))
+			a.Equal(err, io.ErrClosedPipe)
+		}()
+
+		(&httpTest{
+			Method: "PATCH",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": "0",
+			},
+			ReqBody: reader,
+			Code:    http.StatusBadRequest,
+			ResHeader: map[string]string{
+				"Upload-Offset": "",
+			},
+			ResBody: "ERR_UPLOAD_INTERRUPTED: upload has been interrupted by another request for this upload resource\n",
+		}).Run(handler, t)
+
+		<-done
+		a.Empty(handler.ActiveUploads())
+	})
+
+	SubTest(t, "ServerSideByMetaDataNotProvided", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		handler, _ := NewUnroutedHandler(Config{
+			StoreComposer: composer,
+		})
+
+		_, err := handler.TerminateUploadsByMetaData(context.Background(), MetaData{"user": "alice"})
+		assert.Equal(t, ErrNotImplemented, err)
+	})
+
+	SubTest(t, "ServerSideByMetaData", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload1 := NewMockFullUpload(ctrl)
+		upload2 := NewMockFullUpload(ctrl)
+		upload3 := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().ListUploads(gomock.Any(), "").Return([]string{"foo", "bar"}, "next", nil),
+			store.EXPECT().GetUpload(gomock.Any(), "foo").Return(upload1, nil),
+			upload1.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:       "foo",
+				MetaData: MetaData{"user": "alice", "filename": "a.txt"},
+			}, nil),
+			store.EXPECT().GetUpload(gomock.Any(), "foo").Return(upload1, nil),
+			store.EXPECT().AsTerminatableUpload(upload1).Return(upload1),
+			upload1.EXPECT().Terminate(gomock.Any()).Return(nil),
+			store.EXPECT().GetUpload(gomock.Any(), "bar").Return(upload2, nil),
+			upload2.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:       "bar",
+				MetaData: MetaData{"user": "bob"},
+			}, nil),
+			store.EXPECT().ListUploads(gomock.Any(), "next").Return([]string{"baz", "gone"}, "", nil),
+			store.EXPECT().GetUpload(gomock.Any(), "baz").Return(upload3, nil),
+			upload3.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:       "baz",
+				MetaData: MetaData{"user": "alice"},
+			}, nil),
+			store.EXPECT().GetUpload(gomock.Any(), "baz").Return(upload3, nil),
+			store.EXPECT().AsTerminatableUpload(upload3).Return(upload3),
+			upload3.EXPECT().Terminate(gomock.Any()).Return(nil),
+			store.EXPECT().GetUpload(gomock.Any(), "gone").Return(nil, ErrNotFound),
+		)
+
+		composer.UseLister(store)
+		handler, _ := NewUnroutedHandler(Config{
+			StoreComposer: composer,
+		})
+
+		ids, err := handler.TerminateUploadsByMetaData(context.Background(), MetaData{"user": "alice"})
+
+		a := assert.New(t)
+		a.NoError(err)
+		a.Equal([]string{"foo", "baz"}, ids)
+	})
 }
@@ -0,0 +1,306 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TestScenarioHeader is the request header, using which clients select the
+// failures simulated by the handler if Config.EnableTestScenarios is set. Its
+// value is a list of semicolon-separated directives:
+//
+//	id=<string>       - identifies the sequence of requests, to which the status
+//	                    directive applies. Defaults to the header's entire value.
+//	status=<list>     - comma-separated list of status codes between 400 and 599,
+//	                    or "pass". The n-th matching request in the sequence is
+//	                    answered with the n-th status instead of being handled.
+//	                    Once the list is exhausted, requests are handled normally.
+//	delay=<duration>  - delay handling the request, e.g. 500ms. At most 30s.
+//	drop-at=<offset>  - close the connection without a response once the upload
+//	                    has received the data up to this offset in a PATCH or
+//	                    creation request. The received data is stored.
+//	methods=<list>    - comma-separated list of methods, to which the other
+//	                    directives apply. Defaults to all methods.
+//
+// For example, "id=run-1; methods=PATCH; status=423,409,500" lets the first
+// three PATCH requests of the sequence fail, while "drop-at=1048576" drops the
+// connection after the first MiB of every upload.
+const TestScenarioHeader = "Tusd-Test"
+
+// maxTestDelay limits the delay directive, so that requests cannot occupy the
+// server indefinitely.
+const maxTestDelay = 30 * time.Second
+
+// testSequenceTTL is the time after the last request, after which a sequence
+// of requests is forgotten.
+const testSequenceTTL = 1 * time.Hour
+
+// testScenario is the parsed value of the TestScenarioHeader.
+type testScenario struct {
+	id string
+	// statuses contains the status codes for the requests of the sequence,
+	// with zero representing "pass".
+	statuses []int
+	delay    time.Duration
+	// dropAt is the offset, at which the connection is dropped, or -1.
+	dropAt  int64
+	methods []string
+}
+
+// parseTestScenario parses the value of the TestScenarioHeader.
+func parseTestScenario(value string) (testScenario, error) {
+	scenario := testScenario{
+		id:     value,
+		dropAt: -1,
+	}
+
+	for _, directive := range strings.Split(value, ";") {
+		directive = strings.TrimSpace(directive)
+		if directive == "" {
+			continue
+		}
+
+		key, arg, ok := strings.Cut(directive, "=")
+		if !ok {
+			return scenario, ErrInvalidTestScenario
+		}
+		key = strings.TrimSpace(key)
+		arg = strings.TrimSpace(arg)
+
+		switch key {
+		case "id":
+			scenario.id = arg
+		case "status":
+			for _, s := range strings.Split(arg, ",") {
+				s = strings.TrimSpace(s)
+				if s == "pass" {
+					scenario.statuses = append(scenario.statuses, 0)
+					continue
+				}
+
+				status, err := strconv.Atoi(s)
+				if err != nil || status < 400 || status > 599 {
+					return scenario, ErrInvalidTestScenario
+				}
+				scenario.statuses = append(scenario.statuses, status)
+			}
+		case "delay":
+			delay, err := time.ParseDuration(arg)
+			if err != nil || delay < 0 || delay > maxTestDelay {
+				return scenario, ErrInvalidTestScenario
+			}
+			scenario.delay = delay
+		case "drop-at":
+			offset, err := strconv.ParseInt(arg, 10, 64)
+			if err != nil || offset < 0 {
+				return scenario, ErrInvalidTestScenario
+			}
+			scenario.dropAt = offset
+		case "methods":
+			for _, method := range strings.Split(arg, ",") {
+				scenario.methods = append(scenario.methods, strings.ToUpper(strings.TrimSpace(method)))
+			}
+		default:
+			return scenario, ErrInvalidTestScenario
+		}
+	}
+
+	return scenario, nil
+}
+
+// appliesTo reports whether the scenario affects requests using method.
+func (scenario testScenario) appliesTo(method string) bool {
+	if len(scenario.methods) == 0 {
+		return true
+	}
+
+	for _, m := range scenario.methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// testSequenceRegistry counts the requests of each sequence, so that the
+// status directive can answer them in order.
+type testSequenceRegistry struct {
+	mutex     sync.Mutex
+	sequences map[string]*testSequence
+}
+
+type testSequence struct {
+	requests int
+	lastUsed time.Time
+}
+
+func newTestSequenceRegistry() *testSequenceRegistry {
+	return &testSequenceRegistry{
+		sequences: make(map[string]*testSequence),
+	}
+}
+
+// next returns the number of requests, which have been made in the sequence
+// with the given ID before this one.
+func (registry *testSequenceRegistry) next(id string) int {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	now := time.Now()
+	for key, sequence := range registry.sequences {
+		if now.Sub(sequence.lastUsed) > testSequenceTTL {
+			delete(registry.sequences, key)
+		}
+	}
+
+	sequence, ok := registry.sequences[id]
+	if !ok {
+		sequence = &testSequence{}
+		registry.sequences[id] = sequence
+	}
+
+	n := sequence.requests
+	sequence.requests++
+	sequence.lastUsed = now
+	return n
+}
+
+// applyTestScenario prepares the request for the failures selected using the
+// TestScenarioHeader, if Config.EnableTestScenarios is set. It delays the
+// request and wraps the body and response writer, if the connection should be
+// dropped. The returned error is sent instead of handling the request, either
+// because the header is invalid or because the request should fail.
+func (handler *UnroutedHandler) applyTestScenario(w http.ResponseWriter, r *http.Request) (http.ResponseWriter, *http.Request, error) {
+	value := r.Header.Get(TestScenarioHeader)
+	if !handler.config.EnableTestScenarios || value == "" {
+		return w, r, nil
+	}
+
+	scenario, err := parseTestScenario(value)
+	if err != nil {
+		return w, r, err
+	}
+
+	// X-HTTP-Method-Override has not been applied yet.
+	method := r.Method
+	if override := r.Header.Get("X-HTTP-Method-Override"); method == "POST" && override != "" {
+		method = override
+	}
+	if method == "OPTIONS" || !scenario.appliesTo(method) {
+		return w, r, nil
+	}
+
+	if scenario.delay > 0 {
+		select {
+		case <-time.After(scenario.delay):
+		case <-r.Context().Done():
+		}
+	}
+
+	if len(scenario.statuses) > 0 {
+		n := handler.testSequences.next(scenario.id)
+		if n < len(scenario.statuses) && scenario.statuses[n] != 0 {
+			return w, r, NewError("ERR_TEST_FAILURE", "failure simulated for testing", scenario.statuses[n])
+		}
+	}
+
+	if scenario.dropAt >= 0 && (method == "PATCH" || method == "POST") && r.Body != nil && r.Body != http.NoBody {
+		// Creation requests with data start at offset zero.
+		offset := int64(0)
+		if method == "PATCH" {
+			offset, err = strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+			if err != nil {
+				// The handler rejects the request itself.
+				return w, r, nil
+			}
+		}
+
+		if offset < scenario.dropAt {
+			tw := &testResponseWriter{ResponseWriter: w}
+			r.Body = &testDropReader{
+				ReadCloser: r.Body,
+				remaining:  scenario.dropAt - offset,
+				writer:     tw,
+			}
+			return tw, r, nil
+		}
+	}
+
+	return w, r, nil
+}
+
+// testDropReader ends the request body as if the connection had been closed
+// by the client, once the remaining bytes have been read.
+type testDropReader struct {
+	io.ReadCloser
+	remaining int64
+	writer    *testResponseWriter
+}
+
+func (r *testDropReader) Read(p []byte) (int, error) {
+	if r.remaining <= 0 {
+		r.writer.drop()
+		return 0, io.ErrUnexpectedEOF
+	}
+
+	if int64(len(p)) > r.remaining {
+		p = p[:r.remaining]
+	}
+	n, err := r.ReadCloser.Read(p)
+	r.remaining -= int64(n)
+	return n, err
+}
+
+// testResponseWriter discards the response once the connection is dropped,
+// so that the client does not receive any response.
+type testResponseWriter struct {
+	http.ResponseWriter
+
+	mutex   sync.Mutex
+	dropped bool
+}
+
+func (w *testResponseWriter) drop() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.dropped = true
+}
+
+func (w *testResponseWriter) isDropped() bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return w.dropped
+}
+
+func (w *testResponseWriter) WriteHeader(statusCode int) {
+	if w.isDropped() {
+		return
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *testResponseWriter) Write(p []byte) (int, error) {
+	if w.isDropped() {
+		return len(p), nil
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Unwrap allows http.ResponseController to access the underlying writer.
+func (w *testResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// abortIfDropped closes the connection without sending a response, if it has
+// been dropped. It must be called after the request has been handled.
+func (w *testResponseWriter) abortIfDropped() {
+	if w.isDropped() {
+		panic(http.ErrAbortHandler)
+	}
+}
@@ -0,0 +1,190 @@
+package handler_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/tus/tusd/v2/pkg/handler"
+)
+
+func TestTestScenarios(t *testing.T) {
+	SubTest(t, "StatusSequence", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil).Times(2)
+		upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+			Offset: 11,
+			Size:   44,
+		}, nil).Times(2)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:       composer,
+			EnableTestScenarios: true,
+		})
+
+		for _, code := range []int{http.StatusLocked, http.StatusOK, http.StatusInternalServerError, http.StatusOK} {
+			(&httpTest{
+				Method: "HEAD",
+				URL:    "yes",
+				ReqHeader: map[string]string{
+					"Tus-Resumable": "1.0.0",
+					"Tusd-Test":     "id=run-1; status=423,pass,500",
+				},
+				Code: code,
+			}).Run(handler, t)
+		}
+	})
+
+	SubTest(t, "MethodFilter", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				Offset: 11,
+				Size:   44,
+			}, nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:       composer,
+			EnableTestScenarios: true,
+		})
+
+		(&httpTest{
+			Method: "HEAD",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Tusd-Test":     "status=500; methods=PATCH",
+			},
+			Code: http.StatusOK,
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "InvalidHeader", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		handler, _ := NewHandler(Config{
+			StoreComposer:       composer,
+			EnableTestScenarios: true,
+		})
+
+		(&httpTest{
+			Method: "HEAD",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Tusd-Test":     "status=200",
+			},
+			Code: http.StatusBadRequest,
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "Disabled", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				Offset: 11,
+				Size:   44,
+			}, nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+		})
+
+		(&httpTest{
+			Method: "HEAD",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Tusd-Test":     "status=500",
+			},
+			Code: http.StatusOK,
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "DropConnection", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 0,
+				Size:   11,
+			}, nil),
+			upload.EXPECT().WriteChunk(gomock.Any(), int64(0), NewReaderMatcher("hello")).Return(int64(5), nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:       composer,
+			EnableTestScenarios: true,
+		})
+
+		req, _ := http.NewRequest("PATCH", "yes", strings.NewReader("hello world"))
+		req.Header.Set("Tus-Resumable", "1.0.0")
+		req.Header.Set("Content-Type", "application/offset+octet-stream")
+		req.Header.Set("Upload-Offset", "0")
+		req.Header.Set("Tusd-Test", "drop-at=5")
+		w := httptest.NewRecorder()
+
+		assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+			handler.ServeHTTP(w, req)
+		})
+		assert.Equal(t, 0, w.Body.Len())
+		assert.False(t, w.Flushed)
+	})
+
+	SubTest(t, "ResumeAfterDrop", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 5,
+				Size:   11,
+			}, nil),
+			upload.EXPECT().WriteChunk(gomock.Any(), int64(5), NewReaderMatcher(" world")).Return(int64(6), nil),
+			upload.EXPECT().FinishUpload(gomock.Any()),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:       composer,
+			EnableTestScenarios: true,
+		})
+
+		(&httpTest{
+			Method: "PATCH",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": "5",
+				"Tusd-Test":     "drop-at=5",
+			},
+			ReqBody: strings.NewReader(" world"),
+			Code:    http.StatusNoContent,
+			ResHeader: map[string]string{
+				"Upload-Offset": "11",
+			},
+		}).Run(handler, t)
+	})
+}
@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// throughputWindow is the duration over which the transfer rate of an upload is
+// averaged. Data received earlier contributes less and less to the estimate.
+const throughputWindow = 10 * time.Second
+
+// throughputTTL is the duration after the last write, for which the transfer
+// rate of an upload is still reported. An upload which has not received data
+// for longer is considered paused and no estimate is made.
+const throughputTTL = time.Minute
+
+type uploadThroughput struct {
+	// rate is the exponentially weighted average of the transfer rate in bytes
+	// per second.
+	rate      float64
+	updatedAt time.Time
+}
+
+// throughputRegistry keeps the recent transfer rate of each upload, which has
+// received data on this instance, see Config.EstimateUploadRate. It is safe for
+// concurrent use.
+type throughputRegistry struct {
+	lock      sync.Mutex
+	entries   map[string]uploadThroughput
+	lastPrune time.Time
+}
+
+func newThroughputRegistry() *throughputRegistry {
+	return &throughputRegistry{
+		entries:   make(map[string]uploadThroughput),
+		lastPrune: time.Now(),
+	}
+}
+
+// record adds a write of the given number of bytes, which took duration, to the
+// transfer rate of the upload.
+func (registry *throughputRegistry) record(id string, bytes int64, duration time.Duration) {
+	if duration < time.Millisecond {
+		duration = time.Millisecond
+	}
+	sample := float64(bytes) / duration.Seconds()
+
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+
+	now := time.Now()
+	entry, ok := registry.entries[id]
+	if ok && now.Sub(entry.updatedAt) <= throughputTTL {
+		// Longer writes replace more of the previous estimate.
+		weight := 1 - math.Exp(-duration.Seconds()/throughputWindow.Seconds())
+		entry.rate += weight * (sample - entry.rate)
+	} else {
+		entry.rate = sample
+	}
+	entry.updatedAt = now
+	registry.entries[id] = entry
+
+	if now.Sub(registry.lastPrune) > throughputTTL {
+		for k, e := range registry.entries {
+			if now.Sub(e.updatedAt) > throughputTTL {
+				delete(registry.entries, k)
+			}
+		}
+		registry.lastPrune = now
+	}
+}
+
+// rate returns the recent transfer rate of the upload in bytes per second, or
+// false if it has not received data on this instance recently.
+func (registry *throughputRegistry) rate(id string) (float64, bool) {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+
+	entry, ok := registry.entries[id]
+	if !ok || time.Since(entry.updatedAt) > throughputTTL || entry.rate <= 0 {
+		return 0, false
+	}
+
+	return entry.rate, true
+}
+
+// remove forgets the transfer rate of the upload.
+func (registry *throughputRegistry) remove(id string) {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+
+	delete(registry.entries, id)
+}
+
+// recordThroughput adds the data written to the upload by the current request
+// to its transfer rate, if enabled. The rate of finished uploads is discarded.
+func (handler *UnroutedHandler) recordThroughput(info FileInfo, bytesWritten int64, duration time.Duration) {
+	if !handler.config.EstimateUploadRate {
+		return
+	}
+
+	if !info.SizeIsDeferred && info.Offset == info.Size {
+		handler.throughput.remove(info.ID)
+		return
+	}
+
+	if bytesWritten > 0 {
+		handler.throughput.record(info.ID, bytesWritten, duration)
+	}
+}
+
+// setThroughputHeaders adds the Upload-Rate header with the recent transfer rate
+// of an unfinished upload in bytes per second and, if its size is known, the
+// Upload-Estimated-Completion header with the time at which the upload will be
+// complete at this rate.
+func (handler *UnroutedHandler) setThroughputHeaders(resp HTTPResponse, info FileInfo) {
+	if !handler.config.EstimateUploadRate {
+		return
+	}
+
+	if !info.SizeIsDeferred && info.Offset == info.Size {
+		return
+	}
+
+	rate, ok := handler.throughput.rate(info.ID)
+	if !ok {
+		return
+	}
+
+	resp.Header["Upload-Rate"] = strconv.FormatInt(int64(math.Round(rate)), 10)
+
+	// Estimates beyond the range of time.Duration are not sent.
+	seconds := float64(info.Size-info.Offset) / rate
+	if !info.SizeIsDeferred && seconds < math.MaxInt64/float64(time.Second) {
+		remaining := time.Duration(seconds * float64(time.Second))
+		// Upload-Estimated-Completion only has a precision of seconds.
+		completion := time.Now().Add(remaining).UTC().Truncate(time.Second)
+		resp.Header["Upload-Estimated-Completion"] = completion.Format(http.TimeFormat)
+	}
+}
@@ -0,0 +1,117 @@
+package handler_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/tus/tusd/v2/pkg/handler"
+)
+
+func TestThroughput(t *testing.T) {
+	SubTest(t, "PatchAndHead", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 0,
+				Size:   1000,
+			}, nil),
+			upload.EXPECT().WriteChunk(gomock.Any(), int64(0), NewReaderMatcher("hello")).DoAndReturn(func(ctx context.Context, offset int64, src io.Reader) (int64, error) {
+				time.Sleep(10 * time.Millisecond)
+				return 5, nil
+			}),
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 5,
+				Size:   1000,
+			}, nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:      composer,
+			EstimateUploadRate: true,
+		})
+
+		res := (&httpTest{
+			Method: "PATCH",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": "0",
+			},
+			ReqBody: strings.NewReader("hello"),
+			Code:    http.StatusNoContent,
+		}).Run(handler, t)
+
+		a := assert.New(t)
+		rate, err := strconv.ParseInt(res.Header().Get("Upload-Rate"), 10, 64)
+		a.NoError(err)
+		a.Greater(rate, int64(0))
+		a.LessOrEqual(rate, int64(500))
+
+		completion, err := http.ParseTime(res.Header().Get("Upload-Estimated-Completion"))
+		a.NoError(err)
+		a.True(completion.After(time.Now()))
+
+		res = (&httpTest{
+			Method: "HEAD",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+			},
+			Code: http.StatusOK,
+		}).Run(handler, t)
+
+		a.Equal(strconv.FormatInt(rate, 10), res.Header().Get("Upload-Rate"))
+		a.NotEmpty(res.Header().Get("Upload-Estimated-Completion"))
+	})
+
+	SubTest(t, "Disabled", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 0,
+				Size:   1000,
+			}, nil),
+			upload.EXPECT().WriteChunk(gomock.Any(), int64(0), NewReaderMatcher("hello")).Return(int64(5), nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+		})
+
+		res := (&httpTest{
+			Method: "PATCH",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": "0",
+			},
+			ReqBody: strings.NewReader("hello"),
+			Code:    http.StatusNoContent,
+		}).Run(handler, t)
+
+		assert.Empty(t, res.Header().Get("Upload-Rate"))
+		assert.Empty(t, res.Header().Get("Upload-Estimated-Completion"))
+	})
+}
@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+type traceIDKey struct{}
+
+// TraceID returns the ID of the trace, which the request associated with the
+// context is part of, or an empty string if the request did not include a
+// valid traceparent header (see https://www.w3.org/TR/trace-context/). It can
+// be used by data stores to link their metrics and logs to the trace.
+func TraceID(ctx context.Context) string {
+	traceId, _ := ctx.Value(traceIDKey{}).(string)
+	return traceId
+}
+
+// captureTraceID attaches the trace ID from the request's traceparent header
+// to its context, so it can be retrieved using TraceID.
+func (handler *UnroutedHandler) captureTraceID(r *http.Request) *http.Request {
+	traceId := parseTraceParent(r.Header.Get("Traceparent"))
+	if traceId == "" {
+		return r
+	}
+
+	return r.WithContext(context.WithValue(r.Context(), traceIDKey{}, traceId))
+}
+
+// parseTraceParent returns the trace ID from a traceparent header value, which
+// has the form version-traceid-parentid-flags, for example
+// 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01.
+func parseTraceParent(value string) string {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return ""
+	}
+
+	traceId := parts[1]
+	if len(traceId) != 32 || !isLowerHex(traceId) || traceId == strings.Repeat("0", 32) {
+		return ""
+	}
+	if len(parts[2]) != 16 || !isLowerHex(parts[2]) {
+		return ""
+	}
+
+	return traceId
+}
+
+func isLowerHex(s string) bool {
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
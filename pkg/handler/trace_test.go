@@ -0,0 +1,88 @@
+package handler_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/tus/tusd/v2/pkg/handler"
+)
+
+func TestTraceID(t *testing.T) {
+	SubTest(t, "Valid", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		var traceId string
+		gomock.InOrder(
+			store.EXPECT().NewUpload(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, info FileInfo) (Upload, error) {
+				traceId = TraceID(ctx)
+				return upload, nil
+			}),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:   "foo",
+				Size: 300,
+			}, nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+			BasePath:      "/files/",
+		})
+
+		(&httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Upload-Length": "300",
+				"Traceparent":   "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			},
+			Code: http.StatusCreated,
+		}).Run(handler, t)
+
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", traceId)
+	})
+
+	SubTest(t, "Invalid", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		traceIds := []string{}
+		store.EXPECT().NewUpload(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, info FileInfo) (Upload, error) {
+			traceIds = append(traceIds, TraceID(ctx))
+			return upload, nil
+		}).Times(3)
+		upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+			ID:   "foo",
+			Size: 300,
+		}, nil).Times(3)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+			BasePath:      "/files/",
+		})
+
+		for _, value := range []string{
+			"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+			"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+			"garbage",
+		} {
+			(&httpTest{
+				Method: "POST",
+				ReqHeader: map[string]string{
+					"Tus-Resumable": "1.0.0",
+					"Upload-Length": "300",
+					"Traceparent":   value,
+				},
+				Code: http.StatusCreated,
+			}).Run(handler, t)
+		}
+
+		assert.Equal(t, []string{"", "", ""}, traceIds)
+	})
+}
@@ -2,7 +2,9 @@ package handler
 
 import (
 	"context"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"io"
 	"math"
@@ -13,6 +15,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/tus/tusd/v2/internal/bufferpool"
 	"golang.org/x/exp/slog"
 )
 
@@ -47,7 +50,44 @@ var (
 	ErrUploadRejectedByServer           = NewError("ERR_UPLOAD_REJECTED", "upload creation has been rejected by server", http.StatusBadRequest)
 	ErrUploadInterrupted                = NewError("ERR_UPLOAD_INTERRUPTED", "upload has been interrupted by another request for this upload resource", http.StatusBadRequest)
 	ErrServerShutdown                   = NewError("ERR_SERVER_SHUTDOWN", "request has been interrupted because the server is shutting down", http.StatusServiceUnavailable)
+	ErrClientDisconnected               = NewError("ERR_CLIENT_DISCONNECTED", "request has been interrupted because the client disconnected", http.StatusBadRequest)
 	ErrOriginNotAllowed                 = NewError("ERR_ORIGIN_NOT_ALLOWED", "request origin is not allowed", http.StatusForbidden)
+	ErrInvalidIdempotencyKey            = NewError("ERR_INVALID_IDEMPOTENCY_KEY", "invalid Idempotency-Key header", http.StatusBadRequest)
+	ErrIdempotencyKeyInUse              = NewError("ERR_IDEMPOTENCY_KEY_IN_USE", "another request with this Idempotency-Key header is still being processed", http.StatusConflict)
+	ErrInvalidPartOffset                = NewError("ERR_INVALID_PART_OFFSET", "missing or invalid Upload-Part-Offset header", http.StatusBadRequest)
+	ErrPartUploadDeferredLength         = NewError("ERR_PART_UPLOAD_DEFERRED_LENGTH", "upload length must be declared before parts can be uploaded", http.StatusBadRequest)
+	ErrUploadExpired                    = NewError("ERR_UPLOAD_EXPIRED", "upload has expired", http.StatusGone)
+	ErrUploadIncomplete                 = NewError("ERR_UPLOAD_INCOMPLETE", "not all parts of the upload have been received", http.StatusConflict)
+	ErrInvalidIndexCursor               = NewError("ERR_INVALID_INDEX_CURSOR", "invalid cursor for searching the upload index", http.StatusBadRequest)
+	ErrPrincipalMissing                 = NewError("ERR_PRINCIPAL_MISSING", "request does not identify a principal", http.StatusUnauthorized)
+	ErrInvalidFingerprint               = NewError("ERR_INVALID_FINGERPRINT", "missing or invalid fingerprint in request body", http.StatusBadRequest)
+	ErrZipNotConcatenated               = NewError("ERR_ZIP_NOT_CONCATENATED", "only final uploads can be downloaded as zip archive", http.StatusBadRequest)
+	ErrDownloadNotFinished              = NewError("ERR_DOWNLOAD_NOT_FINISHED", "only finished uploads can be shared using download tokens", http.StatusBadRequest)
+	ErrDownloadTokenRequired            = NewError("ERR_DOWNLOAD_TOKEN_REQUIRED", "download requires a token", http.StatusForbidden)
+	ErrInvalidDownloadToken             = NewError("ERR_INVALID_DOWNLOAD_TOKEN", "download token is invalid", http.StatusForbidden)
+	ErrDownloadTokenExpired             = NewError("ERR_DOWNLOAD_TOKEN_EXPIRED", "download token has expired", http.StatusForbidden)
+	ErrDownloadTokenUsed                = NewError("ERR_DOWNLOAD_TOKEN_USED", "download token has already been used", http.StatusForbidden)
+	ErrInvalidCheckpoint                = NewError("ERR_INVALID_CHECKPOINT", "checkpoint is invalid or does not match the data in the storage", http.StatusBadRequest)
+	ErrIngestSourceNotFound             = NewError("ERR_INGEST_SOURCE_NOT_FOUND", "source object for ingestion not found", http.StatusNotFound)
+	ErrInvalidSourceURL                 = NewError("ERR_INVALID_SOURCE_URL", "invalid Upload-Source-Url header", http.StatusBadRequest)
+	ErrRemoteSourceNotAllowed           = NewError("ERR_REMOTE_SOURCE_NOT_ALLOWED", "fetching from the source URL is not allowed", http.StatusForbidden)
+	ErrRemoteSourceUnavailable          = NewError("ERR_REMOTE_SOURCE_UNAVAILABLE", "source URL could not be fetched", http.StatusBadGateway)
+	ErrInvalidUploadWait                = NewError("ERR_INVALID_UPLOAD_WAIT", "invalid Upload-Wait header", http.StatusBadRequest)
+	ErrInvalidMetadata                  = NewError("ERR_INVALID_METADATA", "invalid Upload-Metadata header", http.StatusBadRequest)
+	ErrInvalidConcatManifest            = NewError("ERR_INVALID_CONCAT_MANIFEST", "invalid manifest of partial uploads in request body", http.StatusBadRequest)
+	ErrInvalidEncryptionKey             = NewError("ERR_INVALID_ENCRYPTION_KEY", "invalid Upload-Encryption-Key or Upload-Encryption-Algorithm header", http.StatusBadRequest)
+	ErrEncryptionKeyNotAccepted         = NewError("ERR_ENCRYPTION_KEY_NOT_ACCEPTED", "server does not accept encryption keys from clients", http.StatusBadRequest)
+	ErrUnsupportedContentEncoding       = NewError("ERR_UNSUPPORTED_CONTENT_ENCODING", "unsupported Content-Encoding", http.StatusUnsupportedMediaType)
+	ErrInvalidCompressedBody            = NewError("ERR_INVALID_COMPRESSED_BODY", "request body could not be decompressed", http.StatusBadRequest)
+	ErrDecompressionRatioExceeded       = NewError("ERR_DECOMPRESSION_RATIO_EXCEEDED", "decompressed request body exceeds the allowed compression ratio", http.StatusRequestEntityTooLarge)
+	ErrAmbiguousRequestBody             = NewError("ERR_AMBIGUOUS_REQUEST_BODY", "request body is framed ambiguously or not allowed for this method", http.StatusBadRequest)
+	ErrConflictingHeaders               = NewError("ERR_CONFLICTING_HEADERS", "header has been sent multiple times with different values", http.StatusBadRequest)
+	ErrHeadersTooLarge                  = NewError("ERR_HEADERS_TOO_LARGE", "request headers are too large", http.StatusRequestHeaderFieldsTooLarge)
+	ErrInvalidTestScenario              = NewError("ERR_INVALID_TEST_SCENARIO", "invalid Tusd-Test header", http.StatusBadRequest)
+	ErrMaintenance                      = NewError("ERR_MAINTENANCE", "new uploads are not accepted during maintenance, please retry later", http.StatusServiceUnavailable)
+	ErrByteBudgetExceeded               = NewError("ERR_BYTE_BUDGET_EXCEEDED", "monthly transfer budget has been exhausted, new uploads are not accepted", http.StatusTooManyRequests)
+	ErrInvalidChecksum                  = NewError("ERR_INVALID_CHECKSUM", "invalid or unsupported checksum in upload metadata", http.StatusBadRequest)
+	ErrChecksumMismatch                 = NewError("ERR_CHECKSUM_MISMATCH", "upload does not match the declared checksum", StatusChecksumMismatch)
 
 	// These two responses are 500 for backwards compatability. Clients might receive a timeout response
 	// when the upload got interrupted. Most clients will not retry 4XX but only 5XX, so we responsd with 500 here.
@@ -64,7 +104,18 @@ type UnroutedHandler struct {
 	isBasePathAbs bool
 	basePath      string
 	logger        *slog.Logger
-	extensions    string
+	extensionList []extension
+	activeUploads *activeUploadRegistry
+	usedTokens    *usedTokenRegistry
+	chunkHashes   *chunkHashCache
+	lastWrites    *lastWriteRegistry
+	completions   *completionWaiters
+	remoteFetches *remoteFetchRegistry
+	testSequences *testSequenceRegistry
+	pipeline      *patchPipeline
+	digests       *digestRegistry
+	throughput    *throughputRegistry
+	middlewares   map[MiddlewareStage][]func(http.Handler) http.Handler
 
 	// CompleteUploads is used to send notifications whenever an upload is
 	// completed by a user. The HookEvent will contain information about this
@@ -94,6 +145,13 @@ type UnroutedHandler struct {
 	// this channel will only happen if the NotifyCreatedUploads field is set to
 	// true in the Config structure.
 	CreatedUploads chan HookEvent
+	// ByteBudgetWarnings is used to send notifications once the bytes
+	// transferred to and from the bucket exceed the soft limit of
+	// Config.ByteBudget. The HookEvent contains the upload, whose transfer
+	// exceeded the limit, and the budget's usage. Sending to this channel will
+	// only happen if the NotifyByteBudgetWarnings field is set to true in the
+	// Config structure.
+	ByteBudgetWarnings chan HookEvent
 	// Metrics provides numbers of the usage for this handler.
 	Metrics Metrics
 }
@@ -108,30 +166,52 @@ func NewUnroutedHandler(config Config) (*UnroutedHandler, error) {
 	}
 
 	// Only promote extesions using the Tus-Extension header which are implemented
-	extensions := "creation,creation-with-upload"
+	extensions := []extension{
+		{"creation", ProtocolVersion1_0},
+		{"creation-with-upload", ProtocolVersion1_0},
+	}
 	if config.StoreComposer.UsesTerminater {
-		extensions += ",termination"
+		extensions = append(extensions, extension{"termination", ProtocolVersion1_0})
 	}
 	if config.StoreComposer.UsesConcater {
-		extensions += ",concatenation"
+		extensions = append(extensions, extension{"concatenation", ProtocolVersion1_0})
 	}
 	if config.StoreComposer.UsesLengthDeferrer {
-		extensions += ",creation-defer-length"
+		extensions = append(extensions, extension{"creation-defer-length", ProtocolVersion1_0})
+	}
+	if config.UploadExpiry > 0 {
+		extensions = append(extensions, extension{"expiration", ProtocolVersion1_0})
+	}
+	if config.EnableDirectPartUploads && config.StoreComposer.UsesPartPresigner {
+		extensions = append(extensions, extension{"parts", ProtocolVersion1_1})
 	}
 
 	handler := &UnroutedHandler{
-		config:            config,
-		composer:          config.StoreComposer,
-		basePath:          config.BasePath,
-		isBasePathAbs:     config.isAbs,
-		CompleteUploads:   make(chan HookEvent),
-		TerminatedUploads: make(chan HookEvent),
-		UploadProgress:    make(chan HookEvent),
-		CreatedUploads:    make(chan HookEvent),
-		logger:            config.Logger,
-		extensions:        extensions,
-		Metrics:           newMetrics(),
-	}
+		config:             config,
+		composer:           config.StoreComposer,
+		basePath:           config.BasePath,
+		isBasePathAbs:      config.isAbs,
+		CompleteUploads:    make(chan HookEvent),
+		TerminatedUploads:  make(chan HookEvent),
+		UploadProgress:     make(chan HookEvent),
+		CreatedUploads:     make(chan HookEvent),
+		ByteBudgetWarnings: make(chan HookEvent),
+		logger:             config.Logger,
+		extensionList:      extensions,
+		activeUploads:      newActiveUploadRegistry(),
+		usedTokens:         newUsedTokenRegistry(),
+		chunkHashes:        newChunkHashCache(config.DeduplicationTTL),
+		lastWrites:         newLastWriteRegistry(),
+		completions:        newCompletionWaiters(),
+		remoteFetches:      newRemoteFetchRegistry(),
+		testSequences:      newTestSequenceRegistry(),
+		pipeline:           newPatchPipeline(),
+		digests:            newDigestRegistry(),
+		throughput:         newThroughputRegistry(),
+		middlewares:        make(map[MiddlewareStage][]func(http.Handler) http.Handler),
+		Metrics:            newMetrics(),
+	}
+	handler.Metrics.Store = storeName(config.StoreComposer.Core)
 
 	return handler, nil
 }
@@ -140,21 +220,55 @@ func NewUnroutedHandler(config Config) (*UnroutedHandler, error) {
 // The availability of an extension usually depends on whether the provided data store
 // implements some additional interfaces.
 func (handler *UnroutedHandler) SupportedExtensions() string {
-	return handler.extensions
+	return handler.extensionsFor("")
 }
 
 // Middleware checks various aspects of the request and ensures that it
 // conforms with the spec. Also handles method overriding for clients which
 // cannot make PATCH AND DELETE requests. If you are using the tusd handlers
 // directly you will need to wrap at least the POST and PATCH endpoints in
-// this middleware.
+// this middleware. Middlewares registered using Use are invoked from here.
 func (handler *UnroutedHandler) Middleware(h http.Handler) http.Handler {
+	checked := handler.checkRequest(h)
+
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.applyMiddlewares(PreRoutingStage, checked).ServeHTTP(w, r)
+	})
+}
+
+// checkRequest performs the request validation for Middleware before routing
+// the request to h.
+func (handler *UnroutedHandler) checkRequest(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		method := r.Method
+
+		// The test scenario is applied first, so that a dropped connection
+		// looks to the rest of the handler like a client going away.
+		w, r, testErr := handler.applyTestScenario(w, r)
+		if tw, ok := w.(*testResponseWriter); ok {
+			defer tw.abortIfDropped()
+		}
+
+		var accessWriter *accessLogWriter
+		if handler.config.AccessLogger != nil {
+			accessWriter = &accessLogWriter{ResponseWriter: w}
+			w = accessWriter
+		}
+
 		// Construct our own context and make it available in the request. Successive logic
 		// should use handler.getContext to retrieve it
+		r, keyErr := handler.captureEncryptionKey(r)
+		r = handler.captureHeaders(r)
+		r = handler.captureTraceID(r)
+		r = handler.captureClientNetwork(r)
 		c := handler.newContext(w, r)
 		r = r.WithContext(c)
 
+		if accessWriter != nil {
+			defer handler.logAccess(c, accessWriter, method, start)
+		}
+
 		// Set the initial read deadline for consuming the request body. All headers have already been read,
 		// so this is only for reading the request body. While reading, we regularly update the read deadline
 		// so this deadline is usually not final. See the bodyReader and writeChunk.
@@ -174,12 +288,18 @@ func (handler *UnroutedHandler) Middleware(h http.Handler) http.Handler {
 			r.Method = newMethod
 		}
 
+		headerErr := handler.checkHeaders(r)
+
 		c.log.Info("RequestIncoming")
 
 		handler.Metrics.incRequestsTotal(r.Method)
 
 		header := w.Header()
 
+		// The configured headers are added first, so that they are overwritten by
+		// the handler's own headers.
+		handler.config.ResponseHeaders.apply(header, r.Method)
+
 		cors := handler.config.Cors
 		if origin := r.Header.Get("Origin"); !cors.Disable && origin != "" {
 			originIsAllowed := cors.AllowOrigin.MatchString(origin)
@@ -209,14 +329,35 @@ func (handler *UnroutedHandler) Middleware(h http.Handler) http.Handler {
 		// Detect requests with tus v1 protocol vs the IETF resumable upload draft
 		isTusV1 := !handler.isResumableUploadDraftRequest(r)
 
+		// Negotiate the version used for this request. A version sent by the client
+		// must be supported by the handler.
+		requestedVersion := r.Header.Get("Tus-Resumable")
+		version, versionSupported := handler.negotiateVersion(requestedVersion)
+		handler.Metrics.incClient(r, isTusV1, versionSupported)
 		if isTusV1 {
 			// Set current version used by the server
-			header.Set("Tus-Resumable", "1.0.0")
+			header.Set("Tus-Resumable", version)
+			c.version = version
 		}
 
 		// Add nosniff to all responses https://golang.org/src/net/http/server.go#L1429
 		header.Set("X-Content-Type-Options", "nosniff")
 
+		if keyErr != nil {
+			handler.sendError(c, keyErr)
+			return
+		}
+
+		if headerErr != nil {
+			handler.sendError(c, headerErr)
+			return
+		}
+
+		if testErr != nil {
+			handler.sendError(c, testErr)
+			return
+		}
+
 		// Set appropriated headers in case of OPTIONS method allowing protocol
 		// discovery and end with an 204 No Content
 		if r.Method == "OPTIONS" {
@@ -224,8 +365,17 @@ func (handler *UnroutedHandler) Middleware(h http.Handler) http.Handler {
 				header.Set("Tus-Max-Size", strconv.FormatInt(handler.config.MaxSize, 10))
 			}
 
-			header.Set("Tus-Version", "1.0.0")
-			header.Set("Tus-Extension", handler.extensions)
+			// Only advertise the extensions available for the client's version, if
+			// it told us which one it uses.
+			extensionVersion := ""
+			if requestedVersion != "" && versionSupported {
+				extensionVersion = version
+			}
+
+			header.Set("Tus-Version", strings.Join(handler.config.ProtocolVersions, ","))
+			if extensions := handler.extensionsFor(extensionVersion); extensions != "" {
+				header.Set("Tus-Extension", extensions)
+			}
 
 			// Although the 204 No Content status code is a better fit in this case,
 			// since we do not have a response body included, we cannot use it here
@@ -243,13 +393,12 @@ func (handler *UnroutedHandler) Middleware(h http.Handler) http.Handler {
 		// Test if the version sent by the client is supported
 		// GET and HEAD methods are not checked since a browser may visit this URL and does
 		// not include this header. GET requests are not part of the specification.
-		if r.Method != "GET" && r.Method != "HEAD" && r.Header.Get("Tus-Resumable") != "1.0.0" && isTusV1 {
-			handler.sendError(c, ErrUnsupportedVersion)
+		if r.Method != "GET" && r.Method != "HEAD" && (requestedVersion == "" || !versionSupported) && isTusV1 {
+			handler.sendVersionError(c)
 			return
 		}
-
 		// Proceed with routing the request
-		h.ServeHTTP(w, r)
+		handler.applyMiddlewares(PostAuthStage, h).ServeHTTP(w, r)
 	})
 }
 
@@ -263,6 +412,48 @@ func (handler *UnroutedHandler) PostFile(w http.ResponseWriter, r *http.Request)
 
 	c := handler.getContext(w, r)
 
+	if err := handler.checkMaintenance(); err != nil {
+		handler.sendError(c, err)
+		return
+	}
+
+	if err := handler.checkByteBudget(); err != nil {
+		handler.sendError(c, err)
+		return
+	}
+
+	// If the client retries a creation request, respond with the upload that
+	// has already been created for this idempotency key. Otherwise the key is
+	// reserved until the upload has been created, so that concurrent retries
+	// do not create further uploads.
+	idempotencyKey, err := handler.idempotencyKey(c)
+	if err != nil {
+		handler.sendError(c, err)
+		return
+	}
+
+	if idempotencyKey != "" {
+		resp, reserved, err := handler.reserveIdempotencyKey(c, idempotencyKey)
+		if err != nil {
+			handler.sendError(c, err)
+			return
+		}
+
+		if !reserved {
+			handler.sendResp(c, resp)
+			return
+		}
+
+		// The reservation is released if the upload is not created.
+		defer func() {
+			if idempotencyKey != "" {
+				if err := handler.config.IdempotencyCache.Release(context.Background(), idempotencyKey); err != nil {
+					c.log.Warn("IdempotencyKeyNotReleased", "error", err)
+				}
+			}
+		}()
+	}
+
 	// Check for presence of application/offset+octet-stream. If another content
 	// type is defined, it will be ignored and treated as none was set because
 	// some HTTP clients may enforce a default value for this header.
@@ -282,12 +473,25 @@ func (handler *UnroutedHandler) PostFile(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// The content of the upload can be fetched from a URL instead of being sent
+	// by the client, see Config.EnableRemoteFetch.
+	source, err := handler.parseSourceURL(r)
+	if err != nil {
+		handler.sendError(c, err)
+		return
+	}
+	if source != nil && (containsChunk || isPartial || isFinal) {
+		handler.sendError(c, ErrInvalidSourceURL)
+		return
+	}
+
 	// If the upload is a final upload created by concatenation multiple partial
 	// uploads the size is sum of all sizes of these files (no need for
 	// Upload-Length header)
 	var size int64
 	var sizeIsDeferred bool
 	var partialUploads []Upload
+	var sourceBody io.ReadCloser
 	if isFinal {
 		// A final upload must not contain a chunk within the creation request
 		if containsChunk {
@@ -295,11 +499,28 @@ func (handler *UnroutedHandler) PostFile(w http.ResponseWriter, r *http.Request)
 			return
 		}
 
-		partialUploads, size, err = handler.sizeOfUploads(c, partialUploadIDs)
-		if err != nil {
-			handler.sendError(c, err)
-			return
+		if len(partialUploadIDs) == 0 {
+			// The partial uploads are attached later using a ConcatManifest,
+			// which requires the data store to record them and declare the
+			// size of the final upload afterwards.
+			if !handler.composer.UsesPartialAppender || !handler.composer.UsesLengthDeferrer {
+				handler.sendError(c, ErrInvalidConcat)
+				return
+			}
+			sizeIsDeferred = true
+		} else {
+			partialUploads, size, err = handler.sizeOfUploads(c, partialUploadIDs)
+			if err != nil {
+				handler.sendError(c, err)
+				return
+			}
 		}
+	} else if source != nil {
+		// The size is taken from the source, so the Upload-Length and
+		// Upload-Defer-Length headers are ignored. The source is only requested
+		// after the pre-create hook has accepted the upload, so the size is
+		// still unknown to the hook.
+		sizeIsDeferred = true
 	} else {
 		uploadLengthHeader := r.Header.Get("Upload-Length")
 		uploadDeferLengthHeader := r.Header.Get("Upload-Defer-Length")
@@ -318,6 +539,10 @@ func (handler *UnroutedHandler) PostFile(w http.ResponseWriter, r *http.Request)
 
 	// Parse metadata
 	meta := ParseMetadataHeader(r.Header.Get("Upload-Metadata"))
+	if err := handler.applyMetadataRules(meta); err != nil {
+		handler.sendError(c, err)
+		return
+	}
 
 	info := FileInfo{
 		Size:           size,
@@ -326,13 +551,18 @@ func (handler *UnroutedHandler) PostFile(w http.ResponseWriter, r *http.Request)
 		IsPartial:      isPartial,
 		IsFinal:        isFinal,
 		PartialUploads: partialUploadIDs,
+		ExpiresAt:      handler.newExpiration(),
+		Priority:       handler.priorityFromMetadata(meta),
 	}
+	handler.storeCapturedHeaders(c, info.MetaData)
 
 	resp := HTTPResponse{
 		StatusCode: http.StatusCreated,
 		Header:     HTTPHeader{},
 	}
 
+	// tags are assigned to the upload in Config.UploadIndex.
+	var tags []string
 	if handler.config.PreUploadCreateCallback != nil {
 		resp2, changes, err := handler.config.PreUploadCreateCallback(newHookEvent(c, info))
 		if err != nil {
@@ -353,8 +583,67 @@ func (handler *UnroutedHandler) PostFile(w http.ResponseWriter, r *http.Request)
 		if changes.Storage != nil {
 			info.Storage = changes.Storage
 		}
+
+		if changes.ExpiresAt != nil && info.ExpiresAt != nil {
+			expiresAt := changes.ExpiresAt.UTC()
+			info.ExpiresAt = &expiresAt
+		}
+
+		if changes.Priority != nil {
+			info.Priority = *changes.Priority
+		}
+
+		tags = changes.Tags
 	}
 
+	if source != nil {
+		body, sourceSize, err := handler.openSource(c, source, 0)
+		if err != nil {
+			c.log.Warn("RemoteSourceUnavailable", "source", source.Redacted(), "error", err)
+			var detailedErr Error
+			if errors.As(err, &detailedErr) {
+				err = detailedErr
+			}
+			handler.sendError(c, err)
+			return
+		}
+
+		// The body is handed over to the fetch once the upload has been created.
+		sourceBody = body
+		defer func() {
+			if sourceBody != nil {
+				sourceBody.Close()
+			}
+		}()
+
+		if sourceSize < 0 {
+			if !handler.composer.UsesLengthDeferrer {
+				handler.sendError(c, ErrRemoteSourceUnavailable)
+				return
+			}
+		} else {
+			if handler.config.MaxSize > 0 && sourceSize > handler.config.MaxSize {
+				handler.sendError(c, ErrMaxSizeExceeded)
+				return
+			}
+			size = sourceSize
+			sizeIsDeferred = false
+			info.Size = size
+			info.SizeIsDeferred = false
+		}
+	}
+
+	// Final uploads are not verified, see Config.ChecksumMetadataKey.
+	if !info.IsFinal {
+		checksum, err := handler.checksumFromMetadata(info.MetaData)
+		if err != nil {
+			handler.sendError(c, err)
+			return
+		}
+		info.Checksum = checksum
+	}
+
+	storeStart := time.Now()
 	upload, err := handler.composer.Core.NewUpload(c, info)
 	if err != nil {
 		handler.sendError(c, err)
@@ -362,6 +651,7 @@ func (handler *UnroutedHandler) PostFile(w http.ResponseWriter, r *http.Request)
 	}
 
 	info, err = upload.GetInfo(c)
+	c.trackStore(storeStart)
 	if err != nil {
 		handler.sendError(c, err)
 		return
@@ -373,29 +663,52 @@ func (handler *UnroutedHandler) PostFile(w http.ResponseWriter, r *http.Request)
 	// include it in cases of failure when an error is returned
 	url := handler.absFileURL(r, id)
 	resp.Header["Location"] = url
+	handler.setChunkSizeHint(resp, info)
+	handler.setExpiresHeader(resp, info)
 
 	handler.Metrics.incUploadsCreated()
+	handler.Metrics.trackUploadCreated(id)
+	handler.countCreationExtensions(info, containsChunk)
 	c.log = c.log.With("id", id)
 	c.log.Info("UploadCreated", "id", id, "size", size, "url", url)
 
+	if idempotencyKey != "" {
+		// Failing to remember the key only means that a retried request would
+		// create another upload, so the current request can still succeed. The
+		// reservation is released in this case.
+		if err := handler.config.IdempotencyCache.Set(c, idempotencyKey, id); err != nil {
+			c.log.Warn("IdempotencyKeyNotSaved", "error", err)
+		} else {
+			idempotencyKey = ""
+		}
+	}
+
 	if handler.config.NotifyCreatedUploads {
 		handler.CreatedUploads <- newHookEvent(c, info)
 	}
 
-	if isFinal {
+	if isFinal && !sizeIsDeferred {
 		concatableUpload := handler.composer.Concater.AsConcatableUpload(upload)
 		if err := concatableUpload.ConcatUploads(c, partialUploads); err != nil {
 			handler.sendError(c, err)
 			return
 		}
 		info.Offset = size
+		handler.completions.notify(info.ID)
 
 		if handler.config.NotifyCompleteUploads {
-			handler.CompleteUploads <- newHookEvent(c, info)
+			handler.CompleteUploads <- handler.completedUploadEvent(c, upload, info)
 		}
 	}
 
-	if containsChunk {
+	handler.indexUpload(c, info, tags)
+
+	if source != nil {
+		handler.startRemoteFetch(c, upload, info, source, sourceBody)
+		sourceBody = nil
+		resp.Header["Upload-Source-Status"] = RemoteFetchStatusFetching
+		c.log.Info("RemoteFetchStarted", "source", source.Redacted())
+	} else if containsChunk {
 		if handler.composer.UsesLocker {
 			lock, err := handler.lockUpload(c, id)
 			if err != nil {
@@ -426,18 +739,143 @@ func (handler *UnroutedHandler) PostFile(w http.ResponseWriter, r *http.Request)
 	handler.sendResp(c, resp)
 }
 
+// idempotencyKey returns the key for the request's Idempotency-Key header in
+// the IdempotencyCache, or an empty string if the header is missing or no
+// cache is configured. The key is derived from the header, the principal making
+// the request and the headers describing the upload, so that clients can
+// neither look up the uploads of other principals using their keys nor receive
+// an upload created with different parameters.
+func (handler *UnroutedHandler) idempotencyKey(c *httpContext) (string, error) {
+	if handler.config.IdempotencyCache == nil {
+		return "", nil
+	}
+
+	r := c.req
+	key := r.Header.Get("Idempotency-Key")
+	if len(key) > 255 {
+		return "", ErrInvalidIdempotencyKey
+	}
+	if key == "" {
+		return "", nil
+	}
+
+	var principal string
+	if handler.config.ResolvePrincipal != nil {
+		// Errors are treated as an unknown principal, like for principalTag.
+		principal, _ = handler.config.ResolvePrincipal(r)
+	}
+
+	h := sha256.New()
+	for _, value := range []string{
+		principal,
+		key,
+		r.Header.Get("Upload-Length"),
+		r.Header.Get("Upload-Defer-Length"),
+		r.Header.Get("Upload-Metadata"),
+		r.Header.Get("Upload-Concat"),
+	} {
+		io.WriteString(h, value)
+		h.Write([]byte{0})
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// reserveIdempotencyKey reserves the key for creating a new upload. If an upload
+// has already been created for the key, reserved is false and the response for
+// the creation request is returned instead. If another request currently holds
+// the reservation, ErrIdempotencyKeyInUse is returned.
+func (handler *UnroutedHandler) reserveIdempotencyKey(c *httpContext, key string) (resp HTTPResponse, reserved bool, err error) {
+	cache := handler.config.IdempotencyCache
+
+	// The upload recorded for the key may have been removed in the meantime,
+	// in which case the key is released and reserved again once.
+	for attempt := 0; attempt < 2; attempt++ {
+		id, reserved, err := cache.Reserve(c, key)
+		if err != nil || reserved {
+			return resp, reserved, err
+		}
+		if id == "" {
+			return resp, false, ErrIdempotencyKeyInUse
+		}
+
+		resp, ok, err := handler.replayCreation(c, key, id)
+		if err != nil || ok {
+			return resp, false, err
+		}
+
+		if err := cache.Release(c, key); err != nil {
+			return resp, false, err
+		}
+	}
+
+	return resp, false, ErrIdempotencyKeyInUse
+}
+
+// replayCreation returns the response for the creation request, which created
+// the upload with the given ID for the idempotency key. If the upload does not
+// exist anymore, ok is false and a new upload should be created.
+func (handler *UnroutedHandler) replayCreation(c *httpContext, key string, id string) (resp HTTPResponse, ok bool, err error) {
+	if handler.composer.UsesLocker {
+		lock, err := handler.lockUpload(c, id)
+		if err != nil {
+			return resp, false, err
+		}
+
+		defer lock.Unlock()
+	}
+
+	upload, err := handler.composer.Core.GetUpload(c, id)
+	if errors.Is(err, ErrNotFound) {
+		return resp, false, nil
+	}
+	if err != nil {
+		return resp, false, err
+	}
+
+	info, err := upload.GetInfo(c)
+	if errors.Is(err, ErrNotFound) {
+		return resp, false, nil
+	}
+	if err != nil {
+		return resp, false, err
+	}
+
+	c.log = c.log.With("id", id)
+	c.log.Info("UploadCreationReplayed", "idempotencyKey", key)
+
+	return HTTPResponse{
+		StatusCode: http.StatusCreated,
+		Header: HTTPHeader{
+			"Location":      handler.absFileURL(c.req, id),
+			"Upload-Offset": strconv.FormatInt(info.Offset, 10),
+		},
+	}, true, nil
+}
+
 // PostFile creates a new file upload using the datastore after validating the
 // length and parsing the metadata.
 func (handler *UnroutedHandler) PostFileV2(w http.ResponseWriter, r *http.Request) {
 	c := handler.getContext(w, r)
 
+	if err := handler.checkMaintenance(); err != nil {
+		handler.sendError(c, err)
+		return
+	}
+
+	if err := handler.checkByteBudget(); err != nil {
+		handler.sendError(c, err)
+		return
+	}
+
 	// Parse headers
 	contentType := r.Header.Get("Content-Type")
 	contentDisposition := r.Header.Get("Content-Disposition")
 	isComplete := r.Header.Get("Upload-Incomplete") == "?0"
 
 	info := FileInfo{
-		MetaData: make(MetaData),
+		MetaData:  make(MetaData),
+		ExpiresAt: handler.newExpiration(),
 	}
 	if isComplete && r.ContentLength != -1 {
 		// If the client wants to perform the upload in one request with Content-Length, we know the final upload size.
@@ -474,6 +912,11 @@ func (handler *UnroutedHandler) PostFileV2(w http.ResponseWriter, r *http.Reques
 			info.MetaData["filename"] = values["filename"]
 		}
 	}
+	if err := handler.applyMetadataRules(info.MetaData); err != nil {
+		handler.sendError(c, err)
+		return
+	}
+	handler.storeCapturedHeaders(c, info.MetaData)
 
 	resp := HTTPResponse{
 		StatusCode: http.StatusCreated,
@@ -481,6 +924,8 @@ func (handler *UnroutedHandler) PostFileV2(w http.ResponseWriter, r *http.Reques
 	}
 
 	// 1. Create upload resource
+	// tags are assigned to the upload in Config.UploadIndex.
+	var tags []string
 	if handler.config.PreUploadCreateCallback != nil {
 		resp2, changes, err := handler.config.PreUploadCreateCallback(newHookEvent(c, info))
 		if err != nil {
@@ -501,8 +946,30 @@ func (handler *UnroutedHandler) PostFileV2(w http.ResponseWriter, r *http.Reques
 		if changes.Storage != nil {
 			info.Storage = changes.Storage
 		}
+
+		if changes.ExpiresAt != nil && info.ExpiresAt != nil {
+			expiresAt := changes.ExpiresAt.UTC()
+			info.ExpiresAt = &expiresAt
+		}
+
+		if changes.Priority != nil {
+			info.Priority = *changes.Priority
+		}
+
+		tags = changes.Tags
 	}
 
+	// Final uploads are not verified, see Config.ChecksumMetadataKey.
+	if !info.IsFinal {
+		checksum, err := handler.checksumFromMetadata(info.MetaData)
+		if err != nil {
+			handler.sendError(c, err)
+			return
+		}
+		info.Checksum = checksum
+	}
+
+	storeStart := time.Now()
 	upload, err := handler.composer.Core.NewUpload(c, info)
 	if err != nil {
 		handler.sendError(c, err)
@@ -510,6 +977,7 @@ func (handler *UnroutedHandler) PostFileV2(w http.ResponseWriter, r *http.Reques
 	}
 
 	info, err = upload.GetInfo(c)
+	c.trackStore(storeStart)
 	if err != nil {
 		handler.sendError(c, err)
 		return
@@ -518,6 +986,8 @@ func (handler *UnroutedHandler) PostFileV2(w http.ResponseWriter, r *http.Reques
 	id := info.ID
 	url := handler.absFileURL(r, id)
 	resp.Header["Location"] = url
+	handler.setChunkSizeHint(resp, info)
+	handler.setExpiresHeader(resp, info)
 
 	// Send 104 response
 	w.Header().Set("Location", url)
@@ -525,6 +995,7 @@ func (handler *UnroutedHandler) PostFileV2(w http.ResponseWriter, r *http.Reques
 	w.WriteHeader(104)
 
 	handler.Metrics.incUploadsCreated()
+	handler.Metrics.trackUploadCreated(id)
 	c.log = c.log.With("id", id)
 	c.log.Info("UploadCreated", "size", info.Size, "url", url)
 
@@ -532,6 +1003,8 @@ func (handler *UnroutedHandler) PostFileV2(w http.ResponseWriter, r *http.Reques
 		handler.CreatedUploads <- newHookEvent(c, info)
 	}
 
+	handler.indexUpload(c, info, tags)
+
 	// 2. Lock upload
 	if handler.composer.UsesLocker {
 		lock, err := handler.lockUpload(c, id)
@@ -584,13 +1057,20 @@ func (handler *UnroutedHandler) PostFileV2(w http.ResponseWriter, r *http.Reques
 func (handler *UnroutedHandler) HeadFile(w http.ResponseWriter, r *http.Request) {
 	c := handler.getContext(w, r)
 
-	id, err := extractIDFromPath(r.URL.Path)
+	id, err := extractIDFromRequest(r)
 	if err != nil {
 		handler.sendError(c, err)
 		return
 	}
 	c.log = c.log.With("id", id)
 
+	// The lock is only acquired after waiting, so that the upload can be
+	// finished in the meantime.
+	if err := handler.waitForCompletion(c, id); err != nil {
+		handler.sendError(c, err)
+		return
+	}
+
 	if handler.composer.UsesLocker {
 		lock, err := handler.lockUpload(c, id)
 		if err != nil {
@@ -601,15 +1081,14 @@ func (handler *UnroutedHandler) HeadFile(w http.ResponseWriter, r *http.Request)
 		defer lock.Unlock()
 	}
 
-	upload, err := handler.composer.Core.GetUpload(c, id)
+	_, info, err := handler.getUpload(c, id)
 	if err != nil {
 		handler.sendError(c, err)
 		return
 	}
 
-	info, err := upload.GetInfo(c)
-	if err != nil {
-		handler.sendError(c, err)
+	if handler.isExpired(info) {
+		handler.sendError(c, ErrUploadExpired)
 		return
 	}
 
@@ -619,6 +1098,10 @@ func (handler *UnroutedHandler) HeadFile(w http.ResponseWriter, r *http.Request)
 			"Upload-Offset": strconv.FormatInt(info.Offset, 10),
 		},
 	}
+	handler.setChunkSizeHint(resp, info)
+	handler.setExpiresHeader(resp, info)
+	handler.setThroughputHeaders(resp, info)
+	handler.setRemoteFetchHeaders(resp, id)
 
 	if !handler.isResumableUploadDraftRequest(r) {
 		// Add Upload-Concat header if possible
@@ -627,14 +1110,7 @@ func (handler *UnroutedHandler) HeadFile(w http.ResponseWriter, r *http.Request)
 		}
 
 		if info.IsFinal {
-			v := "final;"
-			for _, uploadID := range info.PartialUploads {
-				v += handler.absFileURL(r, uploadID) + " "
-			}
-			// Remove trailing space
-			v = v[:len(v)-1]
-
-			resp.Header["Upload-Concat"] = v
+			resp.Header["Upload-Concat"] = handler.concatHeader(r, info)
 		}
 
 		if len(info.MetaData) != 0 {
@@ -673,6 +1149,13 @@ func (handler *UnroutedHandler) PatchFile(w http.ResponseWriter, r *http.Request
 
 	isTusV1 := !handler.isResumableUploadDraftRequest(r)
 
+	// Final uploads, whose partial uploads have been deferred, receive a
+	// manifest of partial uploads instead of a chunk.
+	if isTusV1 && handler.composer.UsesPartialAppender && r.Header.Get("Content-Type") == ConcatManifestContentType {
+		handler.attachPartialUploads(c)
+		return
+	}
+
 	// Check for presence of application/offset+octet-stream
 	if isTusV1 && r.Header.Get("Content-Type") != "application/offset+octet-stream" {
 		handler.sendError(c, ErrInvalidContentType)
@@ -686,13 +1169,27 @@ func (handler *UnroutedHandler) PatchFile(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	id, err := extractIDFromPath(r.URL.Path)
+	if handler.config.DecompressRequestBodies {
+		if err := handler.decompressRequestBody(c); err != nil {
+			handler.sendError(c, err)
+			return
+		}
+	}
+
+	id, err := extractIDFromRequest(r)
 	if err != nil {
 		handler.sendError(c, err)
 		return
 	}
 	c.log = c.log.With("id", id)
 
+	// Wait for a pipelined request before locking the upload, which would
+	// otherwise interrupt it. Deferred calls run in reverse order, so
+	// the lock is released before queued requests continue.
+	if handler.config.EnablePipelinedPatches {
+		defer handler.awaitPreviousPatch(c, id, offset)()
+	}
+
 	if handler.composer.UsesLocker {
 		lock, err := handler.lockUpload(c, id)
 		if err != nil {
@@ -703,13 +1200,7 @@ func (handler *UnroutedHandler) PatchFile(w http.ResponseWriter, r *http.Request
 		defer lock.Unlock()
 	}
 
-	upload, err := handler.composer.Core.GetUpload(c, id)
-	if err != nil {
-		handler.sendError(c, err)
-		return
-	}
-
-	info, err := upload.GetInfo(c)
+	upload, info, err := handler.getUpload(c, id)
 	if err != nil {
 		handler.sendError(c, err)
 		return
@@ -721,8 +1212,44 @@ func (handler *UnroutedHandler) PatchFile(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	if handler.isExpired(info) {
+		handler.sendError(c, ErrUploadExpired)
+		return
+	}
+
+	if (handler.config.SkipReceivedPrefix || handler.config.DeduplicateChunks) && isTusV1 && offset < info.Offset {
+		var err error
+		if handler.config.SkipReceivedPrefix {
+			err = handler.skipReceivedPrefix(c, info, offset)
+		} else {
+			err = handler.skipRetransmission(c, info, offset)
+		}
+		if errors.Is(err, ErrMismatchOffset) {
+			handler.sendOffsetConflict(c, info, offset)
+			return
+		}
+		if err != nil {
+			handler.sendError(c, err)
+			return
+		}
+		offset = info.Offset
+
+		// The request only contained data which has already been written.
+		if c.req.ContentLength == 0 {
+			resp := HTTPResponse{
+				StatusCode: http.StatusNoContent,
+				Header: HTTPHeader{
+					"Upload-Offset": strconv.FormatInt(offset, 10),
+				},
+			}
+			handler.setExpiresHeader(resp, info)
+			handler.sendResp(c, resp)
+			return
+		}
+	}
+
 	if offset != info.Offset {
-		handler.sendError(c, ErrMismatchOffset)
+		handler.sendOffsetConflict(c, info, offset)
 		return
 	}
 
@@ -735,8 +1262,21 @@ func (handler *UnroutedHandler) PatchFile(w http.ResponseWriter, r *http.Request
 		Header:     make(HTTPHeader, 1), // Initialize map, so writeChunk can set the Upload-Offset header.
 	}
 
+	if err := handler.renewExpiration(c, upload, &info); err != nil {
+		handler.sendError(c, err)
+		return
+	}
+	handler.setExpiresHeader(resp, info)
+
 	// Do not proxy the call to the data store if the upload is already completed
 	if !info.SizeIsDeferred && info.Offset == info.Size {
+		// Retrying the request must not complete an upload, which did not
+		// match its checksum.
+		if checksumMismatched(info) {
+			handler.sendError(c, ErrChecksumMismatch)
+			return
+		}
+
 		resp.Header["Upload-Offset"] = strconv.FormatInt(offset, 10)
 		handler.sendResp(c, resp)
 		return
@@ -808,6 +1348,9 @@ func (handler *UnroutedHandler) PatchFile(w http.ResponseWriter, r *http.Request
 func (handler *UnroutedHandler) writeChunk(c *httpContext, resp HTTPResponse, upload Upload, info FileInfo) (HTTPResponse, error) {
 	// Get Content-Length if possible
 	r := c.req
+	if r.Header.Get("Upload-Checksum") != "" {
+		handler.Metrics.incExtension("checksum")
+	}
 	length := r.ContentLength
 	offset := info.Offset
 
@@ -836,6 +1379,7 @@ func (handler *UnroutedHandler) writeChunk(c *httpContext, resp HTTPResponse, up
 	c.log.Info("ChunkWriteStart", "maxSize", maxSize, "offset", offset)
 
 	var bytesWritten int64
+	var writeDuration time.Duration
 	var err error
 	// Prevent a nil pointer dereference when accessing the body which may not be
 	// available in the case of a malicious request.
@@ -844,19 +1388,13 @@ func (handler *UnroutedHandler) writeChunk(c *httpContext, resp HTTPResponse, up
 		// http.MaxBytesReader instead of io.LimitedReader because it returns an error
 		// if too much data is provided (handled in bodyReader) and also stops the server
 		// from reading the remaining request body.
-		c.body = newBodyReader(c, maxSize)
-		c.body.onReadDone = func() {
-			// Update the read deadline for every successful read operation. This ensures that the request handler
-			// keeps going while data is transmitted but that dead connections can also time out and be cleaned up.
-			if err := c.resC.SetReadDeadline(time.Now().Add(handler.config.NetworkTimeout)); err != nil {
-				c.log.Warn("NetworkTimeoutError", "error", err)
-			}
-
-			// The write deadline is updated accordingly to ensure that we can also write responses.
-			if err := c.resC.SetWriteDeadline(time.Now().Add(2 * handler.config.NetworkTimeout)); err != nil {
-				c.log.Warn("NetworkTimeoutError", "error", err)
-			}
+		c.setBody(newBodyReader(c, maxSize))
+		c.body.onReadDone = func() { handler.extendNetworkDeadlines(c) }
+		if handler.config.DeduplicateChunks {
+			c.body.hash = sha256.New()
 		}
+		handler.startDigest(c, info)
+		handler.startSampling(c, info)
 
 		// We use a callback to allow the hook system to cancel an upload. The callback
 		// cancels the request context causing the request body to be closed with the
@@ -867,15 +1405,32 @@ func (handler *UnroutedHandler) writeChunk(c *httpContext, resp HTTPResponse, up
 			c.cancel(cause)
 		}
 
+		stopProgress := func() {}
 		if handler.config.NotifyUploadProgress {
-			handler.sendProgressMessages(c, info)
+			stopProgress = handler.sendProgressMessages(c, info)
 		}
 
-		bytesWritten, err = upload.WriteChunk(c, offset, c.body)
+		handler.Metrics.trackUploadRequest(info.ID)
+		writeStart := time.Now()
+		bytesWritten, err = handler.writeToStore(c, upload, info)
+		writeDuration = time.Since(writeStart)
+		// The final progress notification must be sent before the upload is
+		// finished or terminated below, so that the post-receive hook is not
+		// delivered after the post-finish or post-terminate hook.
+		stopProgress()
+		handler.finishSampling(c, info)
+		if bytesWritten > 0 {
+			handler.lastWrites.record(info.ID, c)
+		}
+		if err == nil && c.body.hasError() == nil {
+			handler.recordChunkHash(c, info.ID, offset, bytesWritten)
+		}
+		handler.saveDigest(c, info, offset, bytesWritten)
 
 		// If we encountered an error while reading the body from the HTTP request, log it, but only include
 		// it in the response, if the store did not also return an error.
 		bodyErr := c.body.hasError()
+		storeFailed := err != nil
 		if bodyErr != nil {
 			c.log.Error("BodyReadError", "error", bodyErr.Error())
 			if err == nil {
@@ -883,6 +1438,24 @@ func (handler *UnroutedHandler) writeChunk(c *httpContext, resp HTTPResponse, up
 			}
 		}
 
+		// A body which ended prematurely can be acknowledged like a complete one,
+		// since the received data has been stored nevertheless.
+		endedEarly := c.body.truncated || errors.Is(bodyErr, ErrConnectionReset) || errors.Is(bodyErr, ErrReadTimeout)
+		if endedEarly && !storeFailed {
+			if handler.config.AcceptPartialBodies {
+				c.log.Info("PartialBodyAccepted", "bytesReceived", c.body.bytesRead())
+				err = nil
+			} else if handler.config.ClientAbortStatusCodes {
+				if err == nil {
+					err = ErrClientDisconnected
+				}
+				err = clientAbortError(err, offset+bytesWritten)
+			}
+		}
+		if err != nil {
+			handler.Metrics.trackUploadInterrupted(info.ID)
+		}
+
 		// Terminate the upload if it was stopped, as indicated by the ErrUploadStoppedByServer error.
 		terminateUpload := errors.Is(bodyErr, ErrUploadStoppedByServer)
 		if terminateUpload && handler.composer.UsesTerminater {
@@ -899,8 +1472,19 @@ func (handler *UnroutedHandler) writeChunk(c *httpContext, resp HTTPResponse, up
 	// Send new offset to client
 	newOffset := offset + bytesWritten
 	resp.Header["Upload-Offset"] = strconv.FormatInt(newOffset, 10)
+	if handler.config.AcceptPartialBodies {
+		resp.Header["Upload-Received"] = strconv.FormatInt(bytesWritten, 10)
+	}
 	handler.Metrics.incBytesReceived(uint64(bytesWritten))
+	handler.recordByteBudget(c, info, bytesWritten, 0)
 	info.Offset = newOffset
+	handler.recordThroughput(info, bytesWritten, writeDuration)
+	handler.setThroughputHeaders(resp, info)
+
+	// Finished uploads are recorded in the index by finishUploadIfComplete.
+	if bytesWritten > 0 && (info.SizeIsDeferred || newOffset != info.Size) {
+		handler.updateIndexedUpload(c, c.log, info.ID, newOffset, UploadStateInProgress)
+	}
 
 	// We try to finish the upload, even if an error occurred. If we have a previous error,
 	// we return it and its HTTP response.
@@ -912,17 +1496,87 @@ func (handler *UnroutedHandler) writeChunk(c *httpContext, resp HTTPResponse, up
 	return finishResp, finishErr
 }
 
+// clientAbortError changes the status code of errors caused by the client
+// aborting a PATCH request or its body not arriving in time to the non-standard
+// codes used by CDNs, see Config.ClientAbortStatusCodes. The response includes
+// the upload's offset, so that the request can be resumed without a HEAD request.
+func clientAbortError(err error, offset int64) error {
+	var detailedErr Error
+	if !errors.As(err, &detailedErr) {
+		return err
+	}
+
+	switch {
+	case errors.Is(err, ErrClientDisconnected), errors.Is(err, ErrConnectionReset):
+		detailedErr.HTTPResponse.StatusCode = StatusClientClosedRequest
+	case errors.Is(err, ErrReadTimeout):
+		detailedErr.HTTPResponse.StatusCode = StatusNetworkReadTimeout
+	default:
+		return err
+	}
+
+	detailedErr.HTTPResponse = detailedErr.HTTPResponse.MergeWith(HTTPResponse{
+		Header: HTTPHeader{
+			"Upload-Offset": strconv.FormatInt(offset, 10),
+		},
+	})
+	return detailedErr
+}
+
+// extendNetworkDeadlines is called for every successful read operation from the
+// request body. This ensures that the request handler keeps going while data is
+// transmitted but that dead connections can also time out and be cleaned up.
+func (handler *UnroutedHandler) extendNetworkDeadlines(c *httpContext) {
+	if err := c.resC.SetReadDeadline(time.Now().Add(handler.config.NetworkTimeout)); err != nil {
+		c.log.Warn("NetworkTimeoutError", "error", err)
+	}
+
+	// The write deadline is updated accordingly to ensure that we can also write responses.
+	if err := c.resC.SetWriteDeadline(time.Now().Add(2 * handler.config.NetworkTimeout)); err != nil {
+		c.log.Warn("NetworkTimeoutError", "error", err)
+	}
+}
+
+// writeToStore passes the request body to the data store. The request is listed
+// as an active upload while the data store is receiving its body.
+func (handler *UnroutedHandler) writeToStore(c *httpContext, upload Upload, info FileInfo) (int64, error) {
+	handler.activeUploads.add(c, info)
+	defer handler.activeUploads.remove(c)
+
+	return upload.WriteChunk(WithUploadPriority(c, info.Priority), info.Offset, c.body)
+}
+
 // finishUploadIfComplete checks whether an upload is completed (i.e. upload offset
 // matches upload size) and if so, it will call the data store's FinishUpload
 // function and send the necessary message on the CompleteUpload channel.
 func (handler *UnroutedHandler) finishUploadIfComplete(c *httpContext, resp HTTPResponse, upload Upload, info FileInfo) (HTTPResponse, error) {
 	// If the upload is completed, ...
 	if !info.SizeIsDeferred && info.Offset == info.Size {
+		// ... compare the data with the checksum declared by the client. If the
+		// digest of the data is known, this happens before the upload is
+		// finished. Otherwise, the data is read once the upload is finished,
+		// since not all data stores can read unfinished uploads.
+		digest := handler.uploadDigest(info)
+		if digest != nil {
+			if err := handler.verifyChecksum(c, upload, &info, digest); err != nil {
+				return resp, err
+			}
+		}
+
 		// ... allow the data storage to finish and cleanup the upload
-		if err := upload.FinishUpload(c); err != nil {
+		storeStart := time.Now()
+		err := upload.FinishUpload(c)
+		c.trackStore(storeStart)
+		if err != nil {
 			return resp, err
 		}
 
+		if digest == nil {
+			if err := handler.verifyChecksum(c, upload, &info, nil); err != nil {
+				return resp, err
+			}
+		}
+
 		// ... allow the hook callback to run before sending the response
 		if handler.config.PreFinishResponseCallback != nil {
 			resp2, err := handler.config.PreFinishResponseCallback(newHookEvent(c, info))
@@ -934,10 +1588,13 @@ func (handler *UnroutedHandler) finishUploadIfComplete(c *httpContext, resp HTTP
 
 		c.log.Info("UploadFinished", "size", info.Size)
 		handler.Metrics.incUploadsFinished()
+		handler.Metrics.trackUploadFinished(info.ID, info.Size)
+		handler.updateIndexedUpload(c, c.log, info.ID, info.Offset, UploadStateFinished)
+		handler.completions.notify(info.ID)
 
 		// ... send the info out to the channel
 		if handler.config.NotifyCompleteUploads {
-			handler.CompleteUploads <- newHookEvent(c, info)
+			handler.CompleteUploads <- handler.completedUploadEvent(c, upload, info)
 		}
 	}
 
@@ -945,17 +1602,33 @@ func (handler *UnroutedHandler) finishUploadIfComplete(c *httpContext, resp HTTP
 }
 
 // GetFile handles requests to download a file using a GET request. This is not
-// part of the specification.
+// part of the specification. Final uploads can also be downloaded as zip archive
+// of their partial uploads using the format=zip query parameter. If remote
+// fetching is enabled, requests accepting text/event-stream receive the progress
+// of the upload's download from its source URL as server-sent events instead.
 func (handler *UnroutedHandler) GetFile(w http.ResponseWriter, r *http.Request) {
 	c := handler.getContext(w, r)
 
-	id, err := extractIDFromPath(r.URL.Path)
+	id, err := extractIDFromRequest(r)
 	if err != nil {
 		handler.sendError(c, err)
 		return
 	}
 	c.log = c.log.With("id", id)
 
+	// Progress of remote fetches is streamed as server-sent events, which do
+	// not reveal the upload's content.
+	if handler.config.EnableRemoteFetch && r.Header.Get("Accept") == "text/event-stream" {
+		handler.sendRemoteFetchEvents(c, id)
+		return
+	}
+
+	token, err := handler.checkDownloadToken(c, id)
+	if err != nil {
+		handler.sendError(c, err)
+		return
+	}
+
 	if handler.composer.UsesLocker {
 		lock, err := handler.lockUpload(c, id)
 		if err != nil {
@@ -966,19 +1639,48 @@ func (handler *UnroutedHandler) GetFile(w http.ResponseWriter, r *http.Request)
 		defer lock.Unlock()
 	}
 
-	upload, err := handler.composer.Core.GetUpload(c, id)
+	upload, info, err := handler.getUpload(c, id)
 	if err != nil {
 		handler.sendError(c, err)
 		return
 	}
 
-	info, err := upload.GetInfo(c)
-	if err != nil {
-		handler.sendError(c, err)
+	// Final uploads can be downloaded as a zip archive of their partial uploads
+	if r.URL.Query().Get("format") == "zip" {
+		handler.sendZipArchive(c, info, token)
+		return
+	}
+
+	contentType, contentDisposition := filterContentType(info, handler.config.FilenamePolicy)
+
+	// Only finished uploads are redirected, since the storage might not be able
+	// to serve the content of unfinished uploads.
+	isFinished := !info.SizeIsDeferred && info.Offset == info.Size
+	if handler.config.RedirectDownloads && handler.composer.UsesPresigner && isFinished {
+		url, err := handler.composer.Presigner.AsPresignableUpload(upload).PresignDownloadURL(c, PresignOptions{
+			Expiry:             handler.config.DownloadURLExpiry,
+			ContentType:        contentType,
+			ContentDisposition: contentDisposition,
+		})
+		if err != nil {
+			handler.sendError(c, err)
+			return
+		}
+
+		if err := handler.useDownloadToken(token); err != nil {
+			handler.sendError(c, err)
+			return
+		}
+
+		handler.sendResp(c, HTTPResponse{
+			StatusCode: http.StatusFound,
+			Header: HTTPHeader{
+				"Location": url,
+			},
+		})
 		return
 	}
 
-	contentType, contentDisposition := filterContentType(info)
 	resp := HTTPResponse{
 		StatusCode: http.StatusOK,
 		Header: HTTPHeader{
@@ -991,6 +1693,11 @@ func (handler *UnroutedHandler) GetFile(w http.ResponseWriter, r *http.Request)
 
 	// If no data has been uploaded yet, respond with an empty "204 No Content" status.
 	if info.Offset == 0 {
+		if err := handler.useDownloadToken(token); err != nil {
+			handler.sendError(c, err)
+			return
+		}
+
 		resp.StatusCode = http.StatusNoContent
 		handler.sendResp(c, resp)
 		return
@@ -1002,10 +1709,22 @@ func (handler *UnroutedHandler) GetFile(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// The token is only used up once the content can be sent.
+	if err := handler.useDownloadToken(token); err != nil {
+		src.Close()
+		handler.sendError(c, err)
+		return
+	}
+
 	handler.sendResp(c, resp)
-	io.Copy(w, src)
+
+	// io.CopyBuffer still allows the ResponseWriter to use sendfile for files.
+	buf := bufferpool.GetCopyBuffer()
+	n, _ := io.CopyBuffer(w, src, *buf)
+	bufferpool.PutCopyBuffer(buf)
 
 	src.Close()
+	handler.recordByteBudget(c, info, 0, n)
 }
 
 // mimeInlineBrowserWhitelist is a map containing MIME types which should be
@@ -1039,9 +1758,9 @@ var mimeInlineBrowserWhitelist = map[string]struct{}{
 // Content-Disposition headers for a given upload. These values should be used
 // in responses for GET requests to ensure that only non-malicious file types
 // are shown directly in the browser. It will extract the file name and type
-// from the "fileame" and "filetype".
+// from the "fileame" and "filetype". The file name is sanitized using the policy.
 // See https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/Content-Disposition
-func filterContentType(info FileInfo) (contentType string, contentDisposition string) {
+func filterContentType(info FileInfo, policy FilenamePolicy) (contentType string, contentDisposition string) {
 	filetype := info.MetaData["filetype"]
 
 	if reMimeType.MatchString(filetype) {
@@ -1063,7 +1782,7 @@ func filterContentType(info FileInfo) (contentType string, contentDisposition st
 
 	// Add a filename to Content-Disposition if one is available in the metadata
 	if filename, ok := info.MetaData["filename"]; ok {
-		contentDisposition += ";filename=" + strconv.Quote(filename)
+		contentDisposition = ContentDisposition(contentDisposition, policy.Sanitize(filename))
 	}
 
 	return contentType, contentDisposition
@@ -1079,7 +1798,7 @@ func (handler *UnroutedHandler) DelFile(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	id, err := extractIDFromPath(r.URL.Path)
+	id, err := extractIDFromRequest(r)
 	if err != nil {
 		handler.sendError(c, err)
 		return
@@ -1117,6 +1836,7 @@ func (handler *UnroutedHandler) DelFile(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	handler.Metrics.incExtension("termination")
 	handler.sendResp(c, HTTPResponse{
 		StatusCode: http.StatusNoContent,
 	})
@@ -1128,25 +1848,38 @@ func (handler *UnroutedHandler) DelFile(w http.ResponseWriter, r *http.Request)
 // Note the the info argument is only needed if the terminated uploads
 // notifications are enabled.
 func (handler *UnroutedHandler) terminateUpload(c *httpContext, upload Upload, info FileInfo) error {
+	return handler.terminate(c, c.log, upload, newHookEvent(c, info))
+}
+
+// terminate contains the logic shared by terminateUpload and TerminateUpload,
+// which do not necessarily have an HTTP request at hand. The event is only
+// emitted if the terminated uploads notifications are enabled.
+func (handler *UnroutedHandler) terminate(ctx context.Context, logger *slog.Logger, upload Upload, event HookEvent) error {
 	terminatableUpload := handler.composer.Terminater.AsTerminatableUpload(upload)
 
-	err := terminatableUpload.Terminate(c)
+	err := terminatableUpload.Terminate(ctx)
 	if err != nil {
 		return err
 	}
 
 	if handler.config.NotifyTerminatedUploads {
-		handler.TerminatedUploads <- newHookEvent(c, info)
+		handler.TerminatedUploads <- event
 	}
 
-	c.log.Info("UploadTerminated")
+	logger.Info("UploadTerminated")
 	handler.Metrics.incUploadsTerminated()
+	handler.updateIndexedUpload(ctx, logger, event.Upload.ID, event.Upload.Offset, UploadStateTerminated)
+	handler.Metrics.trackUploadTerminated(event.Upload.ID)
+	handler.digests.remove(event.Upload.ID)
+	handler.throughput.remove(event.Upload.ID)
+	handler.completions.notify(event.Upload.ID)
 
 	return nil
 }
 
 // Send the error in the response body. The status code will be looked up in
 // ErrStatusCodes. If none is found 500 Internal Error will be used.
+// Clients accepting application/json receive the error details as a JSON object.
 func (handler *UnroutedHandler) sendError(c *httpContext, err error) {
 	r := c.req
 
@@ -1156,6 +1889,10 @@ func (handler *UnroutedHandler) sendError(c *httpContext, err error) {
 		detailedErr = NewError("ERR_INTERNAL_SERVER_ERROR", err.Error(), http.StatusInternalServerError)
 	}
 
+	if acceptsJSON(r) {
+		detailedErr.HTTPResponse = detailedErr.jsonResponse(getRequestId(r))
+	}
+
 	// If we are sending the response for a HEAD request, ensure that we are not including
 	// any response body.
 	if r.Method == "HEAD" {
@@ -1171,6 +1908,8 @@ func (handler *UnroutedHandler) sendResp(c *httpContext, resp HTTPResponse) {
 	resp.writeTo(c.res)
 
 	c.log.Info("ResponseOutgoing", "status", resp.StatusCode, "body", resp.Body)
+
+	handler.logAudit(c, resp)
 }
 
 // Make an absolute URLs to the given upload id. If the base path is absolute
@@ -1190,9 +1929,13 @@ func (handler *UnroutedHandler) absFileURL(r *http.Request, id string) string {
 
 // sendProgressMessage will send a notification over the UploadProgress channel
 // indicating how much data has been transfered to the server.
-// It will stop sending these instances once the provided context is done.
-func (handler *UnroutedHandler) sendProgressMessages(c *httpContext, info FileInfo) {
+// It will stop sending these instances once the provided context is done or
+// the returned function is called, which waits until the final notification
+// has been sent.
+func (handler *UnroutedHandler) sendProgressMessages(c *httpContext, info FileInfo) (stop func()) {
 	hook := newHookEvent(c, info)
+	stopC := make(chan struct{})
+	doneC := make(chan struct{})
 
 	previousOffset := int64(0)
 	originalOffset := hook.Upload.Offset
@@ -1206,16 +1949,25 @@ func (handler *UnroutedHandler) sendProgressMessages(c *httpContext, info FileIn
 	}
 
 	go func() {
+		defer close(doneC)
 		for {
 			select {
 			case <-c.Done():
 				emitProgress()
 				return
+			case <-stopC:
+				emitProgress()
+				return
 			case <-time.After(handler.config.UploadProgressInterval):
 				emitProgress()
 			}
 		}
 	}()
+
+	return func() {
+		close(stopC)
+		<-doneC
+	}
 }
 
 // getHostAndProtocol extracts the host and used protocol (either HTTP or HTTPS)
@@ -1313,20 +2065,27 @@ func (handler *UnroutedHandler) validateNewUploadLengthHeaders(uploadLengthHeade
 // lockUpload creates a new lock for the given upload ID and attempts to lock it.
 // The created lock is returned if it was aquired successfully.
 func (handler *UnroutedHandler) lockUpload(c *httpContext, id string) (Lock, error) {
+	// No need to wrap this in a sync.OnceFunc because c.cancel will be a noop after the first call.
+	releaseLock := func() {
+		c.log.Info("UploadInterrupted")
+		c.cancel(ErrUploadInterrupted)
+	}
+
+	return handler.acquireLock(c, id, releaseLock)
+}
+
+// acquireLock obtains the lock for the given upload ID, waiting at most for
+// the configured AcquireLockTimeout. releaseLock is invoked if another party
+// requests the lock while it is held.
+func (handler *UnroutedHandler) acquireLock(ctx context.Context, id string, releaseLock func()) (Lock, error) {
 	lock, err := handler.composer.Locker.NewLock(id)
 	if err != nil {
 		return nil, err
 	}
 
-	ctx, cancelContext := context.WithTimeout(c, handler.config.AcquireLockTimeout)
+	ctx, cancelContext := context.WithTimeout(ctx, handler.config.AcquireLockTimeout)
 	defer cancelContext()
 
-	// No need to wrap this in a sync.OnceFunc because c.cancel will be a noop after the first call.
-	releaseLock := func() {
-		c.log.Info("UploadInterrupted")
-		c.cancel(ErrUploadInterrupted)
-	}
-
 	if err := lock.Lock(ctx, releaseLock); err != nil {
 		return nil, err
 	}
@@ -1398,6 +2157,9 @@ func SerializeMetadataHeader(meta map[string]string) string {
 // Parse the Upload-Concat header, e.g.
 // Upload-Concat: partial
 // Upload-Concat: final;http://tus.io/files/a /files/b/
+// Upload-Concat: final
+// The last form creates a final upload, whose partial uploads are attached
+// later using a ConcatManifest. It does not return any partial uploads.
 func parseConcat(header string) (isPartial bool, isFinal bool, partialUploads []string, err error) {
 	if len(header) == 0 {
 		return
@@ -1408,6 +2170,11 @@ func parseConcat(header string) (isPartial bool, isFinal bool, partialUploads []
 		return
 	}
 
+	if header == "final" {
+		isFinal = true
+		return
+	}
+
 	l := len("final;")
 	if strings.HasPrefix(header, "final;") && len(header) > l {
 		isFinal = true
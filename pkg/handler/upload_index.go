@@ -0,0 +1,337 @@
+package handler
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slices"
+	"golang.org/x/exp/slog"
+)
+
+// UploadState describes the progress of an upload in an UploadIndex.
+type UploadState string
+
+const (
+	// UploadStateInProgress is the state of uploads, which have been created,
+	// but not finished yet. This includes uploads whose transfer has stalled.
+	UploadStateInProgress UploadState = "in-progress"
+	// UploadStateFinished is the state of uploads, which have received all data.
+	UploadStateFinished UploadState = "finished"
+	// UploadStateTerminated is the state of uploads, which have been terminated.
+	UploadStateTerminated UploadState = "terminated"
+)
+
+// IndexEntry is the record of an upload in an UploadIndex.
+type IndexEntry struct {
+	// ID is the upload's identifier.
+	ID string
+	// Size is the upload's total size. It is zero if the size is deferred.
+	Size int64
+	// Offset is the number of bytes saved by the data store as of UpdatedAt.
+	Offset int64
+	// MetaData is the upload's metadata as supplied at creation.
+	MetaData MetaData
+	// Tags are labels for finding the upload, such as the user's ID. They are
+	// assigned using FileInfoChanges.Tags in the pre-create hook or using
+	// UploadIndex.SetUploadTags.
+	Tags []string
+	// State is the upload's progress.
+	State UploadState
+	// CreatedAt is the time at which the upload was created.
+	CreatedAt time.Time
+	// UpdatedAt is the time at which the upload last received data or changed
+	// its state.
+	UpdatedAt time.Time
+	// ExpiresAt is the time at which the upload expires, unless it is finished
+	// before. It is zero if the upload does not expire. Only indexes
+	// implementing ExpiringUploadIndex keep it up to date.
+	ExpiresAt time.Time
+}
+
+// IndexQuery selects uploads from an UploadIndex. All conditions must be met.
+// Empty conditions are ignored.
+type IndexQuery struct {
+	// Tags must all be assigned to the upload.
+	Tags []string
+	// MetaData must all be contained in the upload's metadata with the same values.
+	MetaData MetaData
+	// State must be the upload's state.
+	State UploadState
+	// CreatedAfter and CreatedBefore limit the range of the uploads' creation time.
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	// UpdatedBefore only selects uploads, which have not received data or
+	// changed their state since then. Combined with UploadStateInProgress, it
+	// finds stalled uploads.
+	UpdatedBefore time.Time
+	// Limit is the maximum number of uploads returned at once. Defaults to 100.
+	Limit int
+	// Cursor is the next cursor returned by a previous search with the same
+	// conditions to retrieve the next page. It is empty for the first page.
+	Cursor string
+}
+
+// UploadIndex keeps a searchable record of the uploads handled by tusd, so that,
+// for example, support teams can locate the upload of a user quickly. The
+// handler records uploads once they are created and updates them after every
+// request, which transferred data, and once they are finished or terminated.
+// Errors from the index are logged, but do not fail the request.
+type UploadIndex interface {
+	// AddUpload records a new upload.
+	AddUpload(ctx context.Context, entry IndexEntry) error
+	// UpdateUpload changes the offset and state of the upload with the given ID
+	// and sets its UpdatedAt to at.
+	UpdateUpload(ctx context.Context, id string, offset int64, state UploadState, at time.Time) error
+	// SetUploadTags replaces the tags of the upload with the given ID. ErrNotFound
+	// is returned if the upload is not recorded in the index.
+	SetUploadTags(ctx context.Context, id string, tags []string) error
+	// SearchUploads returns the uploads matching query, with the most recently
+	// created uploads first. If more uploads match, a cursor for retrieving the
+	// next page is returned as well.
+	SearchUploads(ctx context.Context, query IndexQuery) (entries []IndexEntry, nextCursor string, err error)
+}
+
+// ExpiringUploadIndex is an UploadIndex, which also keeps track of when the
+// unfinished uploads expire, so that expired uploads can be found without
+// inspecting every upload in the data store, see TerminateExpiredUploads. The
+// handler reports extended expirations to it.
+type ExpiringUploadIndex interface {
+	UploadIndex
+	// SetUploadExpiration changes the expiration of the upload with the given
+	// ID. ErrNotFound is returned if the upload is not recorded in the index.
+	SetUploadExpiration(ctx context.Context, id string, expiresAt time.Time) error
+	// ExpiredUploads returns the IDs of unfinished uploads, which expire before
+	// the given time.
+	ExpiredUploads(ctx context.Context, before time.Time) ([]string, error)
+}
+
+// defaultIndexQueryLimit is used for queries without a limit.
+const defaultIndexQueryLimit = 100
+
+// MemoryUploadIndex is an UploadIndex which keeps the entries in memory. It is
+// only suitable if a single tusd instance handles all requests and the
+// entries do not need to survive a restart.
+type MemoryUploadIndex struct {
+	mutex   sync.Mutex
+	entries map[string]*IndexEntry
+}
+
+// NewMemoryUploadIndex creates a new, empty in-memory index.
+func NewMemoryUploadIndex() *MemoryUploadIndex {
+	return &MemoryUploadIndex{
+		entries: make(map[string]*IndexEntry),
+	}
+}
+
+func (index *MemoryUploadIndex) AddUpload(ctx context.Context, entry IndexEntry) error {
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+
+	entry.Tags = slices.Clone(entry.Tags)
+	index.entries[entry.ID] = &entry
+	return nil
+}
+
+func (index *MemoryUploadIndex) UpdateUpload(ctx context.Context, id string, offset int64, state UploadState, at time.Time) error {
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+
+	entry, ok := index.entries[id]
+	if !ok {
+		return ErrNotFound
+	}
+
+	entry.Offset = offset
+	entry.State = state
+	entry.UpdatedAt = at
+	return nil
+}
+
+func (index *MemoryUploadIndex) SetUploadTags(ctx context.Context, id string, tags []string) error {
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+
+	entry, ok := index.entries[id]
+	if !ok {
+		return ErrNotFound
+	}
+
+	entry.Tags = slices.Clone(tags)
+	return nil
+}
+
+func (index *MemoryUploadIndex) SetUploadExpiration(ctx context.Context, id string, expiresAt time.Time) error {
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+
+	entry, ok := index.entries[id]
+	if !ok {
+		return ErrNotFound
+	}
+
+	entry.ExpiresAt = expiresAt
+	return nil
+}
+
+func (index *MemoryUploadIndex) ExpiredUploads(ctx context.Context, before time.Time) ([]string, error) {
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+
+	var ids []string
+	for id, entry := range index.entries {
+		if entry.State == UploadStateInProgress && !entry.ExpiresAt.IsZero() && entry.ExpiresAt.Before(before) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	return ids, nil
+}
+
+func (index *MemoryUploadIndex) SearchUploads(ctx context.Context, query IndexQuery) ([]IndexEntry, string, error) {
+	start := 0
+	if query.Cursor != "" {
+		var err error
+		start, err = strconv.Atoi(query.Cursor)
+		if err != nil || start < 0 {
+			return nil, "", ErrInvalidIndexCursor
+		}
+	}
+
+	limit := query.Limit
+	if limit <= 0 {
+		limit = defaultIndexQueryLimit
+	}
+
+	index.mutex.Lock()
+	var matches []IndexEntry
+	for _, entry := range index.entries {
+		if query.Matches(*entry) {
+			match := *entry
+			match.Tags = slices.Clone(entry.Tags)
+			matches = append(matches, match)
+		}
+	}
+	index.mutex.Unlock()
+
+	sort.Slice(matches, func(i, j int) bool {
+		if !matches[i].CreatedAt.Equal(matches[j].CreatedAt) {
+			return matches[i].CreatedAt.After(matches[j].CreatedAt)
+		}
+		return matches[i].ID < matches[j].ID
+	})
+
+	if start >= len(matches) {
+		return []IndexEntry{}, "", nil
+	}
+
+	end := start + limit
+	if end >= len(matches) {
+		return matches[start:], "", nil
+	}
+
+	return matches[start:end], strconv.Itoa(end), nil
+}
+
+// Matches reports whether entry meets all conditions of the query. Limit and
+// Cursor are not considered.
+func (query IndexQuery) Matches(entry IndexEntry) bool {
+	for _, tag := range query.Tags {
+		if !slices.Contains(entry.Tags, tag) {
+			return false
+		}
+	}
+
+	for key, value := range query.MetaData {
+		if actual, ok := entry.MetaData[key]; !ok || actual != value {
+			return false
+		}
+	}
+
+	if query.State != "" && entry.State != query.State {
+		return false
+	}
+
+	if !query.CreatedAfter.IsZero() && entry.CreatedAt.Before(query.CreatedAfter) {
+		return false
+	}
+
+	if !query.CreatedBefore.IsZero() && !entry.CreatedAt.Before(query.CreatedBefore) {
+		return false
+	}
+
+	if !query.UpdatedBefore.IsZero() && !entry.UpdatedAt.Before(query.UpdatedBefore) {
+		return false
+	}
+
+	return true
+}
+
+// indexUpload records a new upload in Config.UploadIndex, if configured.
+func (handler *UnroutedHandler) indexUpload(c *httpContext, info FileInfo, tags []string) {
+	if handler.config.UploadIndex == nil {
+		return
+	}
+
+	if tag := handler.principalTag(c); tag != "" {
+		tags = append(slices.Clone(tags), tag)
+	}
+
+	now := time.Now().UTC()
+	state := UploadStateInProgress
+	if !info.SizeIsDeferred && info.Offset == info.Size {
+		state = UploadStateFinished
+	}
+
+	err := handler.config.UploadIndex.AddUpload(c, IndexEntry{
+		ID:        info.ID,
+		Size:      info.Size,
+		Offset:    info.Offset,
+		MetaData:  info.MetaData,
+		Tags:      tags,
+		State:     state,
+		CreatedAt: now,
+		UpdatedAt: now,
+		ExpiresAt: indexedExpiration(info),
+	})
+	if err != nil {
+		c.log.Warn("UploadIndexError", "error", err)
+	}
+}
+
+// indexedExpiration returns the value of IndexEntry.ExpiresAt for the upload.
+func indexedExpiration(info FileInfo) time.Time {
+	if info.ExpiresAt == nil {
+		return time.Time{}
+	}
+
+	return info.ExpiresAt.UTC()
+}
+
+// updateIndexedUpload records the offset and state of an upload in
+// Config.UploadIndex, if configured.
+func (handler *UnroutedHandler) updateIndexedUpload(ctx context.Context, log *slog.Logger, id string, offset int64, state UploadState) {
+	if handler.config.UploadIndex == nil {
+		return
+	}
+
+	if err := handler.config.UploadIndex.UpdateUpload(ctx, id, offset, state, time.Now().UTC()); err != nil {
+		log.Warn("UploadIndexError", "error", err)
+	}
+}
+
+// updateIndexedExpiration records the new expiration of an upload in
+// Config.UploadIndex, if it keeps track of expirations.
+func (handler *UnroutedHandler) updateIndexedExpiration(ctx context.Context, log *slog.Logger, id string, expiresAt time.Time) {
+	index, ok := handler.config.UploadIndex.(ExpiringUploadIndex)
+	if !ok {
+		return
+	}
+
+	if err := index.SetUploadExpiration(ctx, id, expiresAt.UTC()); err != nil {
+		log.Warn("UploadIndexError", "error", err)
+	}
+}
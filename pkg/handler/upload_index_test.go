@@ -0,0 +1,169 @@
+package handler_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/tus/tusd/v2/pkg/handler"
+)
+
+func TestMemoryUploadIndex(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	index := NewMemoryUploadIndex()
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, entry := range []IndexEntry{
+		{ID: "a", Size: 100, MetaData: MetaData{"filename": "a.txt"}, Tags: []string{"user:alice"}},
+		{ID: "b", Size: 100, MetaData: MetaData{"filename": "b.txt"}, Tags: []string{"user:alice", "project:x"}},
+		{ID: "c", Size: 100, MetaData: MetaData{"filename": "a.txt"}, Tags: []string{"user:bob"}},
+	} {
+		entry.State = UploadStateInProgress
+		entry.CreatedAt = start.Add(time.Duration(i) * time.Hour)
+		entry.UpdatedAt = entry.CreatedAt
+		a.NoError(index.AddUpload(ctx, entry))
+	}
+
+	a.NoError(index.UpdateUpload(ctx, "a", 100, UploadStateFinished, start.Add(5*time.Hour)))
+	a.NoError(index.SetUploadTags(ctx, "c", []string{"user:bob", "project:x"}))
+	a.ErrorIs(index.SetUploadTags(ctx, "d", nil), ErrNotFound)
+
+	search := func(query IndexQuery) []string {
+		entries, _, err := index.SearchUploads(ctx, query)
+		a.NoError(err)
+		ids := []string{}
+		for _, entry := range entries {
+			ids = append(ids, entry.ID)
+		}
+		return ids
+	}
+
+	a.Equal([]string{"c", "b", "a"}, search(IndexQuery{}))
+	a.Equal([]string{"b", "a"}, search(IndexQuery{Tags: []string{"user:alice"}}))
+	a.Equal([]string{"c", "b"}, search(IndexQuery{Tags: []string{"project:x"}}))
+	a.Equal([]string{"c", "a"}, search(IndexQuery{MetaData: MetaData{"filename": "a.txt"}}))
+	a.Equal([]string{"a"}, search(IndexQuery{State: UploadStateFinished}))
+	a.Equal([]string{"c", "b"}, search(IndexQuery{CreatedAfter: start.Add(time.Hour)}))
+	a.Equal([]string{"a"}, search(IndexQuery{CreatedBefore: start.Add(time.Hour)}))
+	// Stalled uploads have not been updated for a while.
+	a.Equal([]string{"b"}, search(IndexQuery{State: UploadStateInProgress, UpdatedBefore: start.Add(2 * time.Hour)}))
+
+	entries, cursor, err := index.SearchUploads(ctx, IndexQuery{Limit: 2})
+	a.NoError(err)
+	a.Len(entries, 2)
+	a.NotEmpty(cursor)
+
+	entries, cursor, err = index.SearchUploads(ctx, IndexQuery{Limit: 2, Cursor: cursor})
+	a.NoError(err)
+	a.Len(entries, 1)
+	a.Equal("a", entries[0].ID)
+	a.Empty(cursor)
+
+	_, _, err = index.SearchUploads(ctx, IndexQuery{Cursor: "invalid"})
+	a.ErrorIs(err, ErrInvalidIndexCursor)
+}
+
+func TestUploadIndex(t *testing.T) {
+	SubTest(t, "TagsFromHook", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().NewUpload(gomock.Any(), gomock.Any()).Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:       "foo",
+				Size:     300,
+				MetaData: MetaData{"filename": "a.txt"},
+			}, nil),
+		)
+
+		index := NewMemoryUploadIndex()
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+			BasePath:      "/files/",
+			UploadIndex:   index,
+			PreUploadCreateCallback: func(hook HookEvent) (HTTPResponse, FileInfoChanges, error) {
+				return HTTPResponse{}, FileInfoChanges{Tags: []string{"user:alice"}}, nil
+			},
+		})
+
+		(&httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Upload-Length": "300",
+				// "a.txt"
+				"Upload-Metadata": "filename YS50eHQ=",
+			},
+			Code: http.StatusCreated,
+		}).Run(handler, t)
+
+		entries, _, err := index.SearchUploads(context.Background(), IndexQuery{Tags: []string{"user:alice"}})
+		a := assert.New(t)
+		a.NoError(err)
+		a.Len(entries, 1)
+		a.Equal("foo", entries[0].ID)
+		a.Equal(UploadStateInProgress, entries[0].State)
+		a.Equal("a.txt", entries[0].MetaData["filename"])
+	})
+
+	SubTest(t, "Write", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 5,
+				Size:   20,
+			}, nil),
+			upload.EXPECT().WriteChunk(gomock.Any(), int64(5), NewReaderMatcher("hello")).Return(int64(5), nil),
+		)
+
+		index := NewMemoryUploadIndex()
+		created := time.Now().Add(-time.Hour)
+		index.AddUpload(context.Background(), IndexEntry{
+			ID:        "yes",
+			Size:      20,
+			Offset:    5,
+			State:     UploadStateInProgress,
+			CreatedAt: created,
+			UpdatedAt: created,
+		})
+
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+			BasePath:      "/files/",
+			UploadIndex:   index,
+		})
+
+		(&httpTest{
+			Method: "PATCH",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": "5",
+			},
+			ReqBody: strings.NewReader("hello"),
+			Code:    http.StatusNoContent,
+		}).Run(handler, t)
+
+		entries, _, err := index.SearchUploads(context.Background(), IndexQuery{})
+		a := assert.New(t)
+		a.NoError(err)
+		a.Len(entries, 1)
+		a.Equal(int64(10), entries[0].Offset)
+		a.Equal(UploadStateInProgress, entries[0].State)
+		a.True(entries[0].UpdatedAt.After(created))
+	})
+}
@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// CounterMap stores counters by a label, such as the name of an extension. The
+// labels are chosen by the handler from a bounded set, so that the number of
+// counters does not grow with the number of requests.
+type CounterMap struct {
+	lock    sync.RWMutex
+	counter map[string]*uint64
+}
+
+func newCounterMap() *CounterMap {
+	return &CounterMap{
+		counter: make(map[string]*uint64),
+	}
+}
+
+// inc increases the counter for the label atomically by one.
+func (m *CounterMap) inc(label string) {
+	m.lock.RLock()
+	ptr, ok := m.counter[label]
+	m.lock.RUnlock()
+
+	if !ok {
+		m.lock.Lock()
+		if ptr, ok = m.counter[label]; !ok {
+			ptr = new(uint64)
+			m.counter[label] = ptr
+		}
+		m.lock.Unlock()
+	}
+
+	atomic.AddUint64(ptr, 1)
+}
+
+// Load returns the current value of each counter.
+func (m *CounterMap) Load() map[string]uint64 {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	values := make(map[string]uint64, len(m.counter))
+	for label, ptr := range m.counter {
+		values[label] = atomic.LoadUint64(ptr)
+	}
+
+	return values
+}
+
+// incExtension counts a request using the tus extension.
+func (m Metrics) incExtension(name string) {
+	m.ExtensionsTotal.inc(name)
+}
+
+// incClient counts a request by the protocol version and the client family.
+func (m Metrics) incClient(r *http.Request, isTusV1 bool, versionSupported bool) {
+	m.ProtocolVersionsTotal.inc(protocolVersionLabel(r.Header.Get("Tus-Resumable"), isTusV1, versionSupported))
+	m.ClientsTotal.inc(clientFamily(r.UserAgent()))
+}
+
+// protocolVersionLabel returns the label under which a request is counted in
+// ProtocolVersionsTotal. Supported versions are counted by their value, while
+// unsupported ones are combined, so that clients cannot create new counters.
+// Requests without a Tus-Resumable header, such as downloads from browsers,
+// are counted as "none".
+func protocolVersionLabel(requestedVersion string, isTusV1 bool, versionSupported bool) string {
+	switch {
+	case !isTusV1:
+		return "ietf-draft"
+	case requestedVersion == "":
+		return "none"
+	case !versionSupported:
+		return "unsupported"
+	default:
+		return requestedVersion
+	}
+}
+
+// clientFamilies maps substrings of User-Agent headers to the client family,
+// under which the requests are counted. The first match wins, so the official
+// tus clients are listed before the libraries they may be built on.
+var clientFamilies = []struct {
+	substring string
+	family    string
+}{
+	{"tus-js-client", "tus-js-client"},
+	{"uppy", "uppy"},
+	{"tus-java-client", "tus-java-client"},
+	{"tus-android-client", "tus-android-client"},
+	{"tuskit", "tuskit"},
+	{"tus-py-client", "tus-py-client"},
+	{"tuspy", "tus-py-client"},
+	{"tusdotnet", "tusdotnet"},
+	{"go-tus", "go-tus"},
+	{"okhttp", "okhttp"},
+	{"curl", "curl"},
+	{"go-http-client", "go-http-client"},
+	{"python-requests", "python-requests"},
+	{"mozilla", "browser"},
+}
+
+// clientFamily returns the family of the client sending the User-Agent header.
+// Unknown clients are counted as "other" and requests without the header as
+// "none".
+func clientFamily(userAgent string) string {
+	if userAgent == "" {
+		return "none"
+	}
+
+	userAgent = strings.ToLower(userAgent)
+	for _, client := range clientFamilies {
+		if strings.Contains(userAgent, client.substring) {
+			return client.family
+		}
+	}
+
+	return "other"
+}
+
+// countCreationExtensions counts the extensions used for creating the upload.
+func (handler *UnroutedHandler) countCreationExtensions(info FileInfo, containsChunk bool) {
+	m := handler.Metrics
+	m.incExtension("creation")
+	if containsChunk {
+		m.incExtension("creation-with-upload")
+	}
+	if info.SizeIsDeferred {
+		m.incExtension("creation-defer-length")
+	}
+	if info.IsPartial || info.IsFinal {
+		m.incExtension("concatenation")
+	}
+	if info.ExpiresAt != nil {
+		m.incExtension("expiration")
+	}
+}
@@ -0,0 +1,38 @@
+package handler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientFamily(t *testing.T) {
+	a := assert.New(t)
+
+	a.Equal("none", clientFamily(""))
+	a.Equal("tus-js-client", clientFamily("tus-js-client/4.1.0 (Node.js v20.10.0)"))
+	a.Equal("tus-java-client", clientFamily("tus-java-client/0.5.0"))
+	a.Equal("tuskit", clientFamily("TUSKit/3.4.3 CFNetwork/1494.0.7 Darwin/23.4.0"))
+	a.Equal("curl", clientFamily("curl/8.5.0"))
+	a.Equal("browser", clientFamily("Mozilla/5.0 (X11; Linux x86_64; rv:125.0) Gecko/20100101 Firefox/125.0"))
+	a.Equal("other", clientFamily("my-uploader/1.0"))
+}
+
+func TestProtocolVersionLabel(t *testing.T) {
+	a := assert.New(t)
+
+	a.Equal("1.0.0", protocolVersionLabel("1.0.0", true, true))
+	a.Equal("none", protocolVersionLabel("", true, false))
+	a.Equal("unsupported", protocolVersionLabel("0.2.2", true, false))
+	a.Equal("ietf-draft", protocolVersionLabel("", false, false))
+}
+
+func TestCounterMap(t *testing.T) {
+	a := assert.New(t)
+
+	m := newCounterMap()
+	m.inc("creation")
+	m.inc("creation")
+	m.inc("checksum")
+	a.Equal(map[string]uint64{"creation": 2, "checksum": 1}, m.Load())
+}
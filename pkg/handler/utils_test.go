@@ -26,6 +26,16 @@ type FullDataStore interface {
 	handler.TerminaterDataStore
 	handler.ConcaterDataStore
 	handler.LengthDeferrerDataStore
+	handler.PresignerDataStore
+	handler.PartPresignerDataStore
+	handler.ChunkSizeHinterDataStore
+	handler.ExpirerDataStore
+	handler.ListableDataStore
+	handler.InspectorDataStore
+	handler.ImporterDataStore
+	handler.IngesterDataStore
+	handler.PartialAppenderDataStore
+	handler.ChecksumRecorderDataStore
 }
 
 type FullUpload interface {
@@ -33,6 +43,12 @@ type FullUpload interface {
 	handler.TerminatableUpload
 	handler.LengthDeclarableUpload
 	handler.ConcatableUpload
+	handler.PresignableUpload
+	handler.PartPresignableUpload
+	handler.ExpirableUpload
+	handler.InspectableUpload
+	handler.PartialAppendableUpload
+	handler.ChecksumRecordableUpload
 }
 
 type FullLocker interface {
@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/exp/slices"
+)
+
+const (
+	// ProtocolVersion1_0 is the tus protocol version 1.0.0, which is supported
+	// by all tus clients.
+	ProtocolVersion1_0 = "1.0.0"
+	// ProtocolVersion1_1 is the draft of the upcoming tus protocol version 1.1.0.
+	// Experimental extensions, such as direct part uploads, are only available
+	// to clients using this version, so that they do not affect clients which
+	// only implement 1.0.0. The draft may still change in incompatible ways.
+	ProtocolVersion1_1 = "1.1.0"
+)
+
+// knownProtocolVersions lists the protocol versions implemented by the handler,
+// ordered from the oldest to the newest.
+var knownProtocolVersions = []string{ProtocolVersion1_0, ProtocolVersion1_1}
+
+// extension is a tus extension, which is advertised in the Tus-Extension header.
+type extension struct {
+	name string
+	// minVersion is the oldest protocol version, for which the extension is
+	// available to clients.
+	minVersion string
+}
+
+// versionAtLeast returns whether the protocol version is equal to or newer
+// than minVersion.
+func versionAtLeast(version, minVersion string) bool {
+	return versionIndex(version) >= versionIndex(minVersion)
+}
+
+func versionIndex(version string) int {
+	for i, known := range knownProtocolVersions {
+		if known == version {
+			return i
+		}
+	}
+	return -1
+}
+
+// validateProtocolVersions ensures that the handler only claims support for
+// versions which it implements.
+func validateProtocolVersions(versions []string) error {
+	for _, version := range versions {
+		if versionIndex(version) == -1 {
+			return fmt.Errorf("tusd: unknown protocol version %q in ProtocolVersions", version)
+		}
+	}
+	return nil
+}
+
+// supportsVersion returns whether the handler is configured to accept
+// requests using the protocol version.
+func (handler *UnroutedHandler) supportsVersion(version string) bool {
+	return slices.Contains(handler.config.ProtocolVersions, version)
+}
+
+// negotiateVersion returns the protocol version used for responding to the
+// request, and false if the version requested by the client is not supported.
+// Requests without a Tus-Resumable header, such as GET requests from browsers,
+// are answered using 1.0.0, if it is supported. Otherwise, the handler's
+// preferred version is used.
+func (handler *UnroutedHandler) negotiateVersion(requested string) (string, bool) {
+	if requested != "" && handler.supportsVersion(requested) {
+		return requested, true
+	}
+
+	if handler.supportsVersion(ProtocolVersion1_0) {
+		return ProtocolVersion1_0, requested == ""
+	}
+	return handler.config.ProtocolVersions[0], requested == ""
+}
+
+// extensionsFor returns the comma-separated list of extensions, which are
+// available to clients using the protocol version. If version is empty, the
+// extensions for all supported versions are returned. Read-only handlers do
+// not offer any extensions.
+func (handler *UnroutedHandler) extensionsFor(version string) string {
+	if !handler.config.Mode.allowsWrites() {
+		return ""
+	}
+
+	names := make([]string, 0, len(handler.extensionList))
+	for _, ext := range handler.extensionList {
+		if version == "" {
+			if handler.supportsVersionAtLeast(ext.minVersion) {
+				names = append(names, ext.name)
+			}
+		} else if versionAtLeast(version, ext.minVersion) {
+			names = append(names, ext.name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// supportsVersionAtLeast returns whether the handler accepts any protocol
+// version equal to or newer than minVersion.
+func (handler *UnroutedHandler) supportsVersionAtLeast(minVersion string) bool {
+	for _, supported := range handler.config.ProtocolVersions {
+		if versionAtLeast(supported, minVersion) {
+			return true
+		}
+	}
+	return false
+}
+
+// sendVersionError rejects a request, whose protocol version is not supported,
+// and tells the client which versions it can use instead.
+func (handler *UnroutedHandler) sendVersionError(c *httpContext) {
+	c.res.Header().Set("Tus-Version", strings.Join(handler.config.ProtocolVersions, ","))
+	handler.sendError(c, ErrUnsupportedVersion)
+}
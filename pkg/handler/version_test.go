@@ -0,0 +1,128 @@
+package handler_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/tus/tusd/v2/pkg/handler"
+)
+
+func TestProtocolVersions(t *testing.T) {
+	SubTest(t, "Discovery", func(t *testing.T, store *MockFullDataStore, _ *StoreComposer) {
+		composer := NewStoreComposer()
+		composer.UseCore(store)
+		composer.UsePartPresigner(store)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:           composer,
+			EnableDirectPartUploads: true,
+		})
+
+		// Without a version, the extensions for all versions are advertised.
+		(&httpTest{
+			Method: "OPTIONS",
+			ResHeader: map[string]string{
+				"Tus-Extension": "creation,creation-with-upload,parts",
+				"Tus-Version":   "1.0.0,1.1.0",
+				"Tus-Resumable": "1.0.0",
+			},
+			Code: http.StatusOK,
+		}).Run(handler, t)
+
+		(&httpTest{
+			Method: "OPTIONS",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+			},
+			ResHeader: map[string]string{
+				"Tus-Extension": "creation,creation-with-upload",
+				"Tus-Version":   "1.0.0,1.1.0",
+				"Tus-Resumable": "1.0.0",
+			},
+			Code: http.StatusOK,
+		}).Run(handler, t)
+
+		(&httpTest{
+			Method: "OPTIONS",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.1.0",
+			},
+			ResHeader: map[string]string{
+				"Tus-Extension": "creation,creation-with-upload,parts",
+				"Tus-Version":   "1.0.0,1.1.0",
+				"Tus-Resumable": "1.1.0",
+			},
+			Code: http.StatusOK,
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "UnsupportedVersion", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+		})
+
+		(&httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.1.0",
+			},
+			ResHeader: map[string]string{
+				"Tus-Version":   "1.0.0",
+				"Tus-Resumable": "1.0.0",
+			},
+			Code: http.StatusPreconditionFailed,
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "DraftOnly", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		handler, _ := NewHandler(Config{
+			StoreComposer:    composer,
+			ProtocolVersions: []string{ProtocolVersion1_1},
+		})
+
+		// 1.0 clients are rejected and informed about the supported version.
+		(&httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+			},
+			ResHeader: map[string]string{
+				"Tus-Version":   "1.1.0",
+				"Tus-Resumable": "1.1.0",
+			},
+			Code: http.StatusPreconditionFailed,
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "DirectPartsRequireDraft", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		composer.UsePartPresigner(store)
+		handler, _ := NewHandler(Config{
+			StoreComposer:           composer,
+			EnableDirectPartUploads: true,
+		})
+
+		// The upload is not even looked up for 1.0 clients.
+		(&httpTest{
+			Method: "POST",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable":      "1.0.0",
+				"Upload-Part-Offset": "5",
+			},
+			ResHeader: map[string]string{
+				"Tus-Version": "1.0.0,1.1.0",
+			},
+			Code: http.StatusPreconditionFailed,
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "UnknownVersion", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		_, err := NewHandler(Config{
+			StoreComposer:    composer,
+			ProtocolVersions: []string{"2.0.0"},
+		})
+		assert.Error(t, err)
+	})
+}
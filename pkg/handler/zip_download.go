@@ -0,0 +1,144 @@
+package handler
+
+import (
+	"archive/zip"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/tus/tusd/v2/internal/bufferpool"
+)
+
+// zipEntry is a partial upload, which is added to a zip archive.
+type zipEntry struct {
+	name   string
+	upload Upload
+	info   FileInfo
+}
+
+// sendZipArchive responds to a GET request with format=zip for a finished final
+// upload. Instead of the concatenated content, a zip archive is streamed, which
+// contains every partial upload as a separate file named after its filename
+// metadata. The archive is assembled while it is sent, so it is neither stored
+// nor held in memory. The download token is only used up once all partial
+// uploads have been found.
+func (handler *UnroutedHandler) sendZipArchive(c *httpContext, info FileInfo, token *downloadTokenClaims) {
+	if !info.IsFinal || len(info.PartialUploads) == 0 {
+		handler.sendError(c, ErrZipNotConcatenated)
+		return
+	}
+
+	if info.SizeIsDeferred || info.Offset != info.Size {
+		handler.sendError(c, ErrUploadNotFinished)
+		return
+	}
+
+	// Look up all partial uploads before sending the response, so that missing
+	// ones can still be reported to the client.
+	entries := make([]zipEntry, 0, len(info.PartialUploads))
+	names := make(map[string]bool, len(info.PartialUploads))
+	for i, id := range info.PartialUploads {
+		upload, err := handler.composer.Core.GetUpload(c, id)
+		if err != nil {
+			handler.sendError(c, err)
+			return
+		}
+
+		partialInfo, err := upload.GetInfo(c)
+		if err != nil {
+			handler.sendError(c, err)
+			return
+		}
+
+		name := handler.config.FilenamePolicy.Sanitize(partialInfo.MetaData["filename"])
+		if name == "" {
+			name = "part-" + strconv.Itoa(i+1)
+		}
+		name = uniqueZipEntryName(name, names)
+		names[name] = true
+
+		entries = append(entries, zipEntry{
+			name:   name,
+			upload: upload,
+			info:   partialInfo,
+		})
+	}
+
+	archiveName := handler.config.FilenamePolicy.Sanitize(info.MetaData["filename"])
+	if archiveName == "" {
+		archiveName = info.ID
+	}
+	archiveName = strings.TrimSuffix(archiveName, ".zip") + ".zip"
+
+	if err := handler.useDownloadToken(token); err != nil {
+		handler.sendError(c, err)
+		return
+	}
+
+	handler.sendResp(c, HTTPResponse{
+		StatusCode: http.StatusOK,
+		Header: HTTPHeader{
+			"Content-Type":        "application/zip",
+			"Content-Disposition": ContentDisposition("attachment", archiveName),
+		},
+	})
+
+	// Errors can no longer be reported to the client once the response has
+	// started. The archive's central directory is then missing, so that clients
+	// detect the archive as incomplete.
+	archive := zip.NewWriter(c.res)
+	buf := bufferpool.GetCopyBuffer()
+	defer bufferpool.PutCopyBuffer(buf)
+
+	for _, entry := range entries {
+		dst, err := archive.CreateHeader(&zip.FileHeader{
+			Name:   entry.name,
+			Method: zip.Deflate,
+		})
+		if err != nil {
+			c.log.Error("ZipArchiveError", "error", err)
+			return
+		}
+
+		if entry.info.Offset == 0 {
+			continue
+		}
+
+		src, err := entry.upload.GetReader(c)
+		if err != nil {
+			c.log.Error("ZipArchiveError", "partialId", entry.info.ID, "error", err)
+			return
+		}
+
+		n, err := io.CopyBuffer(dst, src, *buf)
+		src.Close()
+		handler.recordByteBudget(c, entry.info, 0, n)
+		if err != nil {
+			c.log.Error("ZipArchiveError", "partialId", entry.info.ID, "error", err)
+			return
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		c.log.Error("ZipArchiveError", "error", err)
+	}
+}
+
+// uniqueZipEntryName appends a counter to name, e.g. "photo (2).jpg", if an
+// entry with this name is already contained in the archive.
+func uniqueZipEntryName(name string, names map[string]bool) string {
+	if !names[name] {
+		return name
+	}
+
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for i := 2; ; i++ {
+		candidate := base + " (" + strconv.Itoa(i) + ")" + ext
+		if !names[candidate] {
+			return candidate
+		}
+	}
+}
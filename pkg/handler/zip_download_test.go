@@ -0,0 +1,148 @@
+package handler_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/tus/tusd/v2/pkg/handler"
+)
+
+func TestZipDownload(t *testing.T) {
+	SubTest(t, "Archive", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		final := NewMockFullUpload(ctrl)
+		partialA := NewMockFullUpload(ctrl)
+		partialB := NewMockFullUpload(ctrl)
+		partialC := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "final").Return(final, nil),
+			final.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:             "final",
+				Size:           11,
+				Offset:         11,
+				IsFinal:        true,
+				PartialUploads: []string{"a", "b", "c"},
+				MetaData:       MetaData{"filename": "photos"},
+			}, nil),
+			store.EXPECT().GetUpload(gomock.Any(), "a").Return(partialA, nil),
+			partialA.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:       "a",
+				Size:     5,
+				Offset:   5,
+				MetaData: MetaData{"filename": "../cat.jpg"},
+			}, nil),
+			store.EXPECT().GetUpload(gomock.Any(), "b").Return(partialB, nil),
+			partialB.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:       "b",
+				Size:     6,
+				Offset:   6,
+				MetaData: MetaData{"filename": "cat.jpg"},
+			}, nil),
+			store.EXPECT().GetUpload(gomock.Any(), "c").Return(partialC, nil),
+			partialC.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID: "c",
+			}, nil),
+			partialA.EXPECT().GetReader(gomock.Any()).Return(io.NopCloser(strings.NewReader("hello")), nil),
+			partialB.EXPECT().GetReader(gomock.Any()).Return(io.NopCloser(strings.NewReader(" world")), nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+		})
+
+		res := (&httpTest{
+			Method: "GET",
+			URL:    "final?format=zip",
+			Code:   http.StatusOK,
+			ResHeader: map[string]string{
+				"Content-Type":        "application/zip",
+				"Content-Disposition": `attachment;filename="photos.zip"`,
+			},
+		}).Run(handler, t)
+
+		a := assert.New(t)
+		body := res.Body.Bytes()
+		archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+		a.NoError(err)
+
+		contents := map[string]string{}
+		names := []string{}
+		for _, file := range archive.File {
+			names = append(names, file.Name)
+			src, err := file.Open()
+			a.NoError(err)
+			content, err := io.ReadAll(src)
+			a.NoError(err)
+			contents[file.Name] = string(content)
+		}
+
+		// Names are sanitized, made unique and partial uploads without a name
+		// are numbered.
+		a.Equal([]string{"cat.jpg", "cat (2).jpg", "part-3"}, names)
+		a.Equal("hello", contents["cat.jpg"])
+		a.Equal(" world", contents["cat (2).jpg"])
+		a.Equal("", contents["part-3"])
+	})
+
+	SubTest(t, "NotFinal", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:     "yes",
+				Size:   5,
+				Offset: 5,
+			}, nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+		})
+
+		(&httpTest{
+			Method: "GET",
+			URL:    "yes?format=zip",
+			Code:   http.StatusBadRequest,
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "MissingPartial", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "final").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:             "final",
+				Size:           5,
+				Offset:         5,
+				IsFinal:        true,
+				PartialUploads: []string{"a"},
+			}, nil),
+			store.EXPECT().GetUpload(gomock.Any(), "a").Return(nil, ErrNotFound),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+		})
+
+		(&httpTest{
+			Method: "GET",
+			URL:    "final?format=zip",
+			Code:   http.StatusNotFound,
+		}).Run(handler, t)
+	})
+}
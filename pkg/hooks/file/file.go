@@ -8,7 +8,6 @@ package file
 
 import (
 	"bytes"
-	"encoding/json"
 	"fmt"
 	"os"
 	"os/exec"
@@ -19,6 +18,11 @@ import (
 
 type FileHook struct {
 	Directory string
+	// PayloadVersion is the version of the JSON payload on stdin and stdout,
+	// see hooks.PayloadV1 and hooks.PayloadV2. If zero, version 1 is used. It
+	// is passed to the hook in the TUS_HOOK_PAYLOAD_VERSION environment
+	// variable.
+	PayloadVersion int
 }
 
 func (FileHook) Setup() error {
@@ -33,7 +37,13 @@ func (h FileHook) InvokeHook(req hooks.HookRequest) (res hooks.HookResponse, err
 	env = append(env, "TUS_SIZE="+strconv.FormatInt(req.Event.Upload.Size, 10))
 	env = append(env, "TUS_OFFSET="+strconv.FormatInt(req.Event.Upload.Offset, 10))
 
-	jsonReq, err := json.Marshal(req)
+	version := h.PayloadVersion
+	if version == 0 {
+		version = hooks.PayloadV1
+	}
+	env = append(env, "TUS_HOOK_PAYLOAD_VERSION="+strconv.Itoa(version))
+
+	jsonReq, err := hooks.MarshalRequest(req, version)
 	if err != nil {
 		return res, err
 	}
@@ -65,7 +75,7 @@ func (h FileHook) InvokeHook(req hooks.HookRequest) (res hooks.HookResponse, err
 	// Do not parse the output as JSON, if we received no output to reduce possible
 	// errors.
 	if len(output) > 0 {
-		if err = json.Unmarshal(output, &res); err != nil {
+		if res, err = hooks.UnmarshalResponse(output, version); err != nil {
 			return res, fmt.Errorf("failed to parse hook response: %w, response was: %s", err, string(output))
 		}
 	}
@@ -19,6 +19,8 @@ package hooks
 
 import (
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/tus/tusd/v2/pkg/handler"
@@ -91,10 +93,14 @@ const (
 	HookPostCreate    HookType = "post-create"
 	HookPreCreate     HookType = "pre-create"
 	HookPreFinish     HookType = "pre-finish"
+	// HookByteBudgetExceeded is invoked once per month when the bytes
+	// transferred to and from the bucket exceed the soft limit of the
+	// handler's ByteBudget. The request's ByteBudget field contains the usage.
+	HookByteBudgetExceeded HookType = "budget-exceeded"
 )
 
 // AvailableHooks is a slice of all hooks that are implemented by tusd.
-var AvailableHooks []HookType = []HookType{HookPreCreate, HookPostCreate, HookPostReceive, HookPostTerminate, HookPostFinish, HookPreFinish}
+var AvailableHooks []HookType = []HookType{HookPreCreate, HookPostCreate, HookPostReceive, HookPostTerminate, HookPostFinish, HookPreFinish, HookByteBudgetExceeded}
 
 func preCreateCallback(event handler.HookEvent, hookHandler HookHandler) (handler.HTTPResponse, handler.FileInfoChanges, error) {
 	ok, hookRes, err := invokeHookSync(HookPreCreate, event, hookHandler)
@@ -159,6 +165,50 @@ var MetricsHookInvocationsTotal = prometheus.NewCounterVec(
 	[]string{"hooktype"},
 )
 
+// HookError describes a hook invocation which failed to complete.
+type HookError struct {
+	// Type is the name of the failed hook.
+	Type HookType
+	// UploadID is the ID of the upload involved in the hook, if available.
+	UploadID string
+	// Error is the message of the error returned from the hook handler.
+	Error string
+	// Time is the point in time at which the failure occurred.
+	Time time.Time
+}
+
+// maxRecentHookErrors is the number of failures that are kept for inspection
+// using RecentHookErrors.
+const maxRecentHookErrors = 100
+
+var recentHookErrors struct {
+	sync.Mutex
+	errors []HookError
+}
+
+func recordHookError(hookErr HookError) {
+	recentHookErrors.Lock()
+	defer recentHookErrors.Unlock()
+
+	recentHookErrors.errors = append(recentHookErrors.errors, hookErr)
+	if len(recentHookErrors.errors) > maxRecentHookErrors {
+		recentHookErrors.errors = recentHookErrors.errors[1:]
+	}
+}
+
+// RecentHookErrors returns the most recent failed hook invocations, newest first.
+// At most 100 failures are retained.
+func RecentHookErrors() []HookError {
+	recentHookErrors.Lock()
+	defer recentHookErrors.Unlock()
+
+	result := make([]HookError, len(recentHookErrors.errors))
+	for i, hookErr := range recentHookErrors.errors {
+		result[len(result)-1-i] = hookErr
+	}
+	return result
+}
+
 func SetupHookMetrics() {
 	MetricsHookErrorsTotal.WithLabelValues(string(HookPostFinish)).Add(0)
 	MetricsHookErrorsTotal.WithLabelValues(string(HookPostTerminate)).Add(0)
@@ -166,19 +216,39 @@ func SetupHookMetrics() {
 	MetricsHookErrorsTotal.WithLabelValues(string(HookPostCreate)).Add(0)
 	MetricsHookErrorsTotal.WithLabelValues(string(HookPreCreate)).Add(0)
 	MetricsHookErrorsTotal.WithLabelValues(string(HookPreFinish)).Add(0)
+	MetricsHookErrorsTotal.WithLabelValues(string(HookByteBudgetExceeded)).Add(0)
 	MetricsHookInvocationsTotal.WithLabelValues(string(HookPostFinish)).Add(0)
 	MetricsHookInvocationsTotal.WithLabelValues(string(HookPostTerminate)).Add(0)
 	MetricsHookInvocationsTotal.WithLabelValues(string(HookPostReceive)).Add(0)
 	MetricsHookInvocationsTotal.WithLabelValues(string(HookPostCreate)).Add(0)
 	MetricsHookInvocationsTotal.WithLabelValues(string(HookPreCreate)).Add(0)
 	MetricsHookInvocationsTotal.WithLabelValues(string(HookPreFinish)).Add(0)
+	MetricsHookInvocationsTotal.WithLabelValues(string(HookByteBudgetExceeded)).Add(0)
 }
 
-func invokeHookAsync(typ HookType, event handler.HookEvent, hookHandler HookHandler) {
-	go func() {
+func invokeHookAsync(queue *orderedQueue, typ HookType, event handler.HookEvent, hookHandler HookHandler) {
+	ok := queue.enqueue(event.Upload.ID, func() {
 		// Error handling is taken care by the function.
 		_, _, _ = invokeHookSync(typ, event, hookHandler)
-	}()
+	})
+	if !ok {
+		dropHook(typ, event)
+	}
+}
+
+// dropHook records that a hook is not invoked, because too many hooks are
+// queued for the upload.
+func dropHook(typ HookType, event handler.HookEvent) {
+	id := event.Upload.ID
+
+	slog.Error("HookDropped", "type", typ, "id", id)
+	MetricsHookErrorsTotal.WithLabelValues(string(typ)).Add(1)
+	recordHookError(HookError{
+		Type:     typ,
+		UploadID: id,
+		Error:    "too many hooks are queued for the upload",
+		Time:     time.Now(),
+	})
 }
 
 // invokeHookSync executes a hook of the given type with the given event data. If
@@ -203,6 +273,12 @@ func invokeHookSync(typ HookType, event handler.HookEvent, hookHandler HookHandl
 		// return a hook response.
 		slog.Error("HookInvocationError", "type", typ, "id", id, "error", err.Error())
 		MetricsHookErrorsTotal.WithLabelValues(string(typ)).Add(1)
+		recordHookError(HookError{
+			Type:     typ,
+			UploadID: id,
+			Error:    err.Error(),
+			Time:     time.Now(),
+		})
 		return false, HookResponse{}, err
 	}
 
@@ -223,7 +299,10 @@ func invokeHookSync(typ HookType, event handler.HookEvent, hookHandler HookHandl
 //
 // Note: NewHandlerWithHooks sets up a goroutine to consume the notfication channels (CompleteUploads, TerminatedUploads,
 // CreatedUploads, UploadProgress) on the created handler. These channels must not be consumed by the caller or otherwise
-// events might not be passed to the hook handler.
+// events might not be passed to the hook handler. The post-* hooks of an upload are invoked one after another in the
+// order the events occurred, so a hook is only invoked once the previous hook for the same upload has returned.
+// Consecutive post-receive hooks, which are still waiting, are collapsed into the latest one. A limited number of
+// hooks is invoked concurrently and, if too many hooks are waiting for an upload, further hooks are dropped.
 func NewHandlerWithHooks(config *handler.Config, hookHandler HookHandler, enabledHooks []HookType) (*handler.Handler, error) {
 	if err := hookHandler.Setup(); err != nil {
 		return nil, fmt.Errorf("unable to setup hooks for handler: %s", err)
@@ -234,6 +313,7 @@ func NewHandlerWithHooks(config *handler.Config, hookHandler HookHandler, enable
 	config.NotifyTerminatedUploads = slices.Contains(enabledHooks, HookPostTerminate)
 	config.NotifyUploadProgress = slices.Contains(enabledHooks, HookPostReceive)
 	config.NotifyCreatedUploads = slices.Contains(enabledHooks, HookPostCreate)
+	config.NotifyByteBudgetWarnings = slices.Contains(enabledHooks, HookByteBudgetExceeded)
 
 	// Install callbacks for pre-* hooks
 	if slices.Contains(enabledHooks, HookPreCreate) {
@@ -253,18 +333,29 @@ func NewHandlerWithHooks(config *handler.Config, hookHandler HookHandler, enable
 		return nil, err
 	}
 
-	// Listen for notifications for post-* hooks
+	// Listen for notifications for post-* hooks. The hooks of one upload are
+	// delivered in the order of the notifications, while hooks of different
+	// uploads are invoked concurrently.
+	queue := newOrderedQueue(orderedQueueWorkers, orderedQueueMaxPending)
 	go func() {
 		for {
 			select {
 			case event := <-handler.CompleteUploads:
-				invokeHookAsync(HookPostFinish, event, hookHandler)
+				invokeHookAsync(queue, HookPostFinish, event, hookHandler)
 			case event := <-handler.TerminatedUploads:
-				invokeHookAsync(HookPostTerminate, event, hookHandler)
+				invokeHookAsync(queue, HookPostTerminate, event, hookHandler)
 			case event := <-handler.CreatedUploads:
-				invokeHookAsync(HookPostCreate, event, hookHandler)
+				invokeHookAsync(queue, HookPostCreate, event, hookHandler)
+			case event := <-handler.ByteBudgetWarnings:
+				invokeHookAsync(queue, HookByteBudgetExceeded, event, hookHandler)
 			case event := <-handler.UploadProgress:
-				go postReceiveCallback(event, hookHandler)
+				// Progress events, which are still queued, are outdated by a newer one.
+				ok := queue.enqueueLatest(event.Upload.ID, func() {
+					postReceiveCallback(event, hookHandler)
+				})
+				if !ok {
+					dropHook(HookPostReceive, event)
+				}
 			}
 		}
 	}()
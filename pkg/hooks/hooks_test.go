@@ -3,6 +3,7 @@ package hooks
 import (
 	"errors"
 	"net/http"
+	"strconv"
 	"testing"
 	"time"
 
@@ -157,3 +158,22 @@ func TestNewHandlerWithHooks(t *testing.T) {
 	// Wait a short amount for all goroutines to settle
 	<-time.After(100 * time.Millisecond)
 }
+
+func TestRecentHookErrors(t *testing.T) {
+	a := assert.New(t)
+	recentHookErrors.errors = nil
+
+	for i := 0; i < maxRecentHookErrors+5; i++ {
+		recordHookError(HookError{
+			Type:     HookPostReceive,
+			UploadID: strconv.Itoa(i),
+			Error:    "oh no",
+		})
+	}
+
+	errs := RecentHookErrors()
+	a.Len(errs, maxRecentHookErrors)
+	// The newest failure comes first and the five oldest ones have been dropped.
+	a.Equal(strconv.Itoa(maxRecentHookErrors+4), errs[0].UploadID)
+	a.Equal("5", errs[len(errs)-1].UploadID)
+}
@@ -0,0 +1,60 @@
+package http
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+
+	"github.com/tus/tusd/v2/pkg/hooks"
+	"golang.org/x/exp/slices"
+)
+
+// placeholderRegexp matches the placeholders in endpoint URLs, e.g. {{tenant}}.
+var placeholderRegexp = regexp.MustCompile(`\{\{\s*([^{}\s]+)\s*\}\}`)
+
+// EndpointFor returns the URL to which the hook request is sent. The URL
+// from Endpoints for the request's hook type takes precedence over Endpoint.
+// Each placeholder {{key}} in the URL is replaced with the path-escaped value
+// of the metadata key of the same name. An error is returned if the upload's
+// metadata does not contain the key. An empty URL indicates that no request
+// should be sent.
+func (h HttpHook) EndpointFor(hookReq hooks.HookRequest) (string, error) {
+	endpoint, ok := h.Endpoints[hookReq.Type]
+	if !ok {
+		endpoint = h.Endpoint
+	}
+
+	var err error
+	endpoint = placeholderRegexp.ReplaceAllStringFunc(endpoint, func(placeholder string) string {
+		key := placeholderRegexp.FindStringSubmatch(placeholder)[1]
+		value, ok := hookReq.Event.Upload.MetaData[key]
+		if !ok && err == nil {
+			err = fmt.Errorf("metadata %s for endpoint of %s hook is missing", key, hookReq.Type)
+		}
+		return url.PathEscape(value)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return endpoint, nil
+}
+
+// ValidateEndpoints checks that Endpoints only contains known hook types and
+// that the URLs, apart from their placeholders, can be parsed.
+func ValidateEndpoints(endpoints map[hooks.HookType]string) error {
+	for hookType, endpoint := range endpoints {
+		if !slices.Contains(hooks.AvailableHooks, hookType) {
+			return fmt.Errorf("unknown hook type %q", hookType)
+		}
+
+		if endpoint == "" {
+			continue
+		}
+		if _, err := url.Parse(placeholderRegexp.ReplaceAllString(endpoint, "x")); err != nil {
+			return fmt.Errorf("invalid endpoint for %s hook: %w", hookType, err)
+		}
+	}
+
+	return nil
+}
@@ -2,14 +2,20 @@
 // POST request to the specified endpoint. The body is a JSON-formatted object including
 // the hook type, upload and request information.
 // By responding with a JSON object, the response from tusd can be controlled.
+//
+// If a secret is configured, each request is signed, so that the endpoint can
+// verify that it originates from tusd, see VerifySignature. Using a TLS
+// configuration with a client certificate, tusd can also authenticate itself
+// to the endpoint using mutual TLS.
 package http
 
 import (
 	"bytes"
-	"encoding/json"
+	"crypto/tls"
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/sethgrid/pester"
@@ -17,11 +23,27 @@ import (
 )
 
 type HttpHook struct {
-	Endpoint       string
+	Endpoint string
+	// Endpoints overrides Endpoint for individual hook types. The URLs may
+	// contain placeholders, such as {{tenant}}, which are replaced with the
+	// upload's metadata, see EndpointFor. An empty URL disables the hook type,
+	// in which case no request is sent and an empty response is returned.
+	Endpoints      map[hooks.HookType]string
 	MaxRetries     int
 	Backoff        time.Duration
 	ForwardHeaders []string
 
+	// Secret is used to sign each request using HMAC-SHA256. If empty, requests
+	// are not signed.
+	Secret []byte
+	// TLSConfig is used for connections to the endpoint, for example to present
+	// a client certificate or to trust a private CA. If nil, the default
+	// configuration is used.
+	TLSConfig *tls.Config
+	// PayloadVersion is the version of the JSON payload, see hooks.PayloadV1 and
+	// hooks.PayloadV2. If zero, version 1 is used.
+	PayloadVersion int
+
 	client *pester.Client
 }
 
@@ -33,6 +55,11 @@ func (h *HttpHook) Setup() error {
 	client.Backoff = func(_ int) time.Duration {
 		return h.Backoff
 	}
+	if h.TLSConfig != nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = h.TLSConfig
+		client.Transport = transport
+	}
 
 	h.client = client
 
@@ -40,12 +67,25 @@ func (h *HttpHook) Setup() error {
 }
 
 func (h HttpHook) InvokeHook(hookReq hooks.HookRequest) (hookRes hooks.HookResponse, err error) {
-	jsonInfo, err := json.Marshal(hookReq)
+	version := h.PayloadVersion
+	if version == 0 {
+		version = hooks.PayloadV1
+	}
+
+	jsonInfo, err := hooks.MarshalRequest(hookReq, version)
+	if err != nil {
+		return hookRes, err
+	}
+
+	endpoint, err := h.EndpointFor(hookReq)
 	if err != nil {
 		return hookRes, err
 	}
+	if endpoint == "" {
+		return hookRes, nil
+	}
 
-	httpReq, err := http.NewRequest("POST", h.Endpoint, bytes.NewBuffer(jsonInfo))
+	httpReq, err := http.NewRequest("POST", endpoint, bytes.NewBuffer(jsonInfo))
 	if err != nil {
 		return hookRes, err
 	}
@@ -59,6 +99,13 @@ func (h HttpHook) InvokeHook(hookReq hooks.HookRequest) (hookRes hooks.HookRespo
 	}
 
 	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set(hooks.PayloadVersionHeader, strconv.Itoa(version))
+
+	// The signature is only computed once, so retries by pester carry the
+	// same timestamp.
+	if len(h.Secret) > 0 {
+		signRequest(httpReq, h.Secret, jsonInfo, time.Now())
+	}
 
 	httpRes, err := h.client.Do(httpReq)
 	if err != nil {
@@ -76,7 +123,16 @@ func (h HttpHook) InvokeHook(hookReq hooks.HookRequest) (hookRes hooks.HookRespo
 		return hookRes, fmt.Errorf("unexpected response code from hook endpoint (%d): %s", httpRes.StatusCode, string(httpBody))
 	}
 
-	if err = json.Unmarshal(httpBody, &hookRes); err != nil {
+	// The receiver may respond using another payload version, e.g. if it has
+	// not been migrated to the announced version yet.
+	if header := httpRes.Header.Get(hooks.PayloadVersionHeader); header != "" {
+		version, err = strconv.Atoi(header)
+		if err != nil {
+			return hookRes, fmt.Errorf("invalid %s header in hook response: %s", hooks.PayloadVersionHeader, header)
+		}
+	}
+
+	if hookRes, err = hooks.UnmarshalResponse(httpBody, version); err != nil {
 		return hookRes, fmt.Errorf("failed to parse hook response: %w", err)
 	}
 
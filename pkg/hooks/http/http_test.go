@@ -0,0 +1,187 @@
+package http
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tus/tusd/v2/pkg/handler"
+	"github.com/tus/tusd/v2/pkg/hooks"
+)
+
+func newHookRequest() hooks.HookRequest {
+	return hooks.HookRequest{
+		Type: hooks.HookPreCreate,
+		Event: handler.HookEvent{
+			Upload: handler.FileInfo{ID: "yes", Size: 100},
+			HTTPRequest: handler.HTTPRequest{
+				Method: "POST",
+				URI:    "/files/",
+				Header: http.Header{},
+			},
+		},
+	}
+}
+
+func TestSignedRequest(t *testing.T) {
+	a := assert.New(t)
+	secret := []byte("secret")
+
+	var verifyErr error
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		verifyErr = VerifySignature(secret, r.Header, body, time.Minute)
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	hook := &HttpHook{
+		Endpoint: server.URL,
+		Secret:   secret,
+	}
+	a.NoError(hook.Setup())
+
+	_, err := hook.InvokeHook(newHookRequest())
+	a.NoError(err)
+	a.NoError(verifyErr)
+}
+
+func TestVerifySignature(t *testing.T) {
+	a := assert.New(t)
+	secret := []byte("secret")
+	body := []byte(`{"Type":"pre-create"}`)
+
+	sign := func(now time.Time) http.Header {
+		req := httptest.NewRequest("POST", "/", nil)
+		signRequest(req, secret, body, now)
+		return req.Header
+	}
+
+	a.NoError(VerifySignature(secret, sign(time.Now()), body, time.Minute))
+	a.Equal(ErrMissingSignature, VerifySignature(secret, http.Header{}, body, time.Minute))
+	a.Equal(ErrInvalidSignature, VerifySignature([]byte("other"), sign(time.Now()), body, time.Minute))
+	a.Equal(ErrInvalidSignature, VerifySignature(secret, sign(time.Now()), []byte(`{"Type":"post-finish"}`), time.Minute))
+	a.Equal(ErrExpiredSignature, VerifySignature(secret, sign(time.Now().Add(-time.Hour)), body, time.Minute))
+
+	// The timestamp is covered by the signature.
+	header := sign(time.Now().Add(-time.Hour))
+	header.Set(TimestampHeader, strconv.FormatInt(time.Now().Unix(), 10))
+	a.Equal(ErrInvalidSignature, VerifySignature(secret, header, body, time.Minute))
+}
+
+func TestClientCertificate(t *testing.T) {
+	a := assert.New(t)
+
+	var peerCertificates int
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		peerCertificates = len(r.TLS.PeerCertificates)
+		w.Write([]byte(`{}`))
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	// The server's certificate doubles as client certificate.
+	hook := &HttpHook{
+		Endpoint: server.URL,
+		TLSConfig: &tls.Config{
+			Certificates: server.TLS.Certificates,
+			RootCAs:      server.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs,
+		},
+	}
+	a.NoError(hook.Setup())
+
+	_, err := hook.InvokeHook(newHookRequest())
+	a.NoError(err)
+	a.Equal(1, peerCertificates)
+}
+
+func TestPayloadVersion(t *testing.T) {
+	a := assert.New(t)
+
+	var version string
+	var body map[string]interface{}
+	respondWith := "2"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		version = r.Header.Get(hooks.PayloadVersionHeader)
+		body = nil
+		json.NewDecoder(r.Body).Decode(&body)
+
+		w.Header().Set(hooks.PayloadVersionHeader, respondWith)
+		if respondWith == "1" {
+			w.Write([]byte(`{"RejectUpload":true}`))
+		} else {
+			w.Write([]byte(`{"reject_upload":true}`))
+		}
+	}))
+	defer server.Close()
+
+	hook := &HttpHook{
+		Endpoint:       server.URL,
+		PayloadVersion: hooks.PayloadV2,
+	}
+	a.NoError(hook.Setup())
+
+	res, err := hook.InvokeHook(newHookRequest())
+	a.NoError(err)
+	a.Equal("2", version)
+	a.EqualValues(2, body["version"])
+	a.True(res.RejectUpload)
+
+	// The receiver can still answer using version 1.
+	respondWith = "1"
+	res, err = hook.InvokeHook(newHookRequest())
+	a.NoError(err)
+	a.True(res.RejectUpload)
+}
+
+func TestEndpoints(t *testing.T) {
+	a := assert.New(t)
+
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	hook := &HttpHook{
+		Endpoint: server.URL + "/default",
+		Endpoints: map[hooks.HookType]string{
+			hooks.HookPostFinish:  server.URL + "/tenants/{{tenant}}/uploads",
+			hooks.HookPostReceive: "",
+		},
+	}
+	a.NoError(hook.Setup())
+
+	req := newHookRequest()
+	req.Event.Upload.MetaData = handler.MetaData{"tenant": "a/b"}
+
+	_, err := hook.InvokeHook(req)
+	a.NoError(err)
+
+	req.Type = hooks.HookPostFinish
+	_, err = hook.InvokeHook(req)
+	a.NoError(err)
+
+	// Disabled hook types do not send a request.
+	req.Type = hooks.HookPostReceive
+	_, err = hook.InvokeHook(req)
+	a.NoError(err)
+
+	a.Equal([]string{"/default", "/tenants/a/b/uploads"}, paths)
+
+	req.Type = hooks.HookPostFinish
+	req.Event.Upload.MetaData = handler.MetaData{}
+	_, err = hook.InvokeHook(req)
+	a.EqualError(err, "metadata tenant for endpoint of post-finish hook is missing")
+
+	a.NoError(ValidateEndpoints(hook.Endpoints))
+	a.Error(ValidateEndpoints(map[hooks.HookType]string{"pre-upload": server.URL}))
+}
@@ -0,0 +1,88 @@
+package http
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Headers, which are added to hook requests if HttpHook.Secret is set.
+const (
+	// TimestampHeader contains the time at which the request was signed as
+	// seconds since the Unix epoch.
+	TimestampHeader = "Tusd-Hook-Timestamp"
+	// ContentHashHeader contains the hex-encoded SHA-256 hash of the body.
+	ContentHashHeader = "Tusd-Hook-Content-Sha256"
+	// SignatureHeader contains the hex-encoded HMAC-SHA256 of the timestamp and
+	// the body hash, separated by a newline, prefixed with the signature
+	// version "v1=".
+	SignatureHeader = "Tusd-Hook-Signature"
+)
+
+var (
+	ErrMissingSignature = errors.New("hook request is not signed")
+	ErrInvalidSignature = errors.New("hook request signature does not match")
+	ErrExpiredSignature = errors.New("hook request signature is too old")
+)
+
+// signRequest adds the timestamp, content hash and signature headers to a hook
+// request with the given body.
+func signRequest(req *http.Request, secret []byte, body []byte, now time.Time) {
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	hash := sha256.Sum256(body)
+	contentHash := hex.EncodeToString(hash[:])
+
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(ContentHashHeader, contentHash)
+	req.Header.Set(SignatureHeader, "v1="+computeSignature(secret, timestamp, contentHash))
+}
+
+func computeSignature(secret []byte, timestamp string, contentHash string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp + "\n" + contentHash))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature checks that a hook request has been signed by tusd using the
+// given secret and that the body has not been modified. Requests signed more
+// than maxAge ago are rejected, so that recorded requests cannot be replayed
+// later. It can be used by hook receivers written in Go:
+//
+//	body, _ := io.ReadAll(r.Body)
+//	if err := http.VerifySignature(secret, r.Header, body, 5*time.Minute); err != nil {
+//		w.WriteHeader(http.StatusUnauthorized)
+//		return
+//	}
+func VerifySignature(secret []byte, header http.Header, body []byte, maxAge time.Duration) error {
+	timestamp := header.Get(TimestampHeader)
+	signature := header.Get(SignatureHeader)
+	if timestamp == "" || signature == "" {
+		return ErrMissingSignature
+	}
+
+	hash := sha256.Sum256(body)
+	contentHash := hex.EncodeToString(hash[:])
+	if !hmac.Equal([]byte(header.Get(ContentHashHeader)), []byte(contentHash)) {
+		return ErrInvalidSignature
+	}
+
+	expected := "v1=" + computeSignature(secret, timestamp, contentHash)
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return ErrInvalidSignature
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	age := time.Since(time.Unix(seconds, 0))
+	if age > maxAge || age < -maxAge {
+		return ErrExpiredSignature
+	}
+
+	return nil
+}
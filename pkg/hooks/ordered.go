@@ -0,0 +1,137 @@
+package hooks
+
+import "sync"
+
+// orderedQueueWorkers is the number of hooks, which are invoked concurrently
+// for different uploads.
+const orderedQueueWorkers = 32
+
+// orderedQueueMaxPending is the number of functions, which may be queued for a
+// single upload. Further functions are rejected until the queue has drained.
+// Since consecutive post-receive events are collapsed, this limit is only
+// reached if hooks for an upload are stuck.
+const orderedQueueMaxPending = 64
+
+// orderedQueue runs functions in the background, while functions sharing the
+// same key are run one after another in the order they were enqueued. It is
+// used to deliver the post-* hooks of an upload in the order the events
+// occurred, e.g. post-create before post-receive before post-finish, without
+// letting a slow hook delay the hooks of other uploads.
+//
+// The functions are run by a fixed number of workers. A worker takes the next
+// function of a key, which is ready, and no other worker runs functions of
+// this key until it has returned. Keys take turns, so a key with many queued
+// functions does not starve the others. Both the number of goroutines and the
+// number of queued functions per key are bounded.
+type orderedQueue struct {
+	mu         sync.Mutex
+	cond       *sync.Cond
+	maxPending int
+	// pending holds the queued functions of each key, which has queued or
+	// running functions. Keys are removed once all their functions have run.
+	pending map[string]*keyQueue
+	// ready holds the keys, which have queued functions and are not run by a
+	// worker at the moment, in the order they became ready.
+	ready []string
+}
+
+type keyQueue struct {
+	entries []queueEntry
+	running bool
+}
+
+type queueEntry struct {
+	fn func()
+	// latestOnly indicates that the entry may be replaced by a newer one, which
+	// was enqueued using enqueueLatest, see there.
+	latestOnly bool
+}
+
+func newOrderedQueue(workers, maxPending int) *orderedQueue {
+	q := &orderedQueue{
+		maxPending: maxPending,
+		pending:    make(map[string]*keyQueue),
+	}
+	q.cond = sync.NewCond(&q.mu)
+
+	for i := 0; i < workers; i++ {
+		go q.work()
+	}
+
+	return q
+}
+
+// enqueue schedules fn to run after all functions previously enqueued for key.
+// It never blocks, so the handler's notification channels are consumed even
+// while hooks are slow. If too many functions are queued for key, fn is
+// dropped and false is returned.
+func (q *orderedQueue) enqueue(key string, fn func()) bool {
+	return q.push(key, queueEntry{fn: fn})
+}
+
+// enqueueLatest schedules fn like enqueue, but if the last function queued for
+// key was also enqueued using enqueueLatest and has not started yet, it is
+// replaced by fn. This is used for events, of which only the latest one is of
+// interest, such as the progress reported in post-receive hooks.
+func (q *orderedQueue) enqueueLatest(key string, fn func()) bool {
+	return q.push(key, queueEntry{fn: fn, latestOnly: true})
+}
+
+func (q *orderedQueue) push(key string, entry queueEntry) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	kq, ok := q.pending[key]
+	if !ok {
+		kq = &keyQueue{}
+		q.pending[key] = kq
+	}
+
+	n := len(kq.entries)
+	if entry.latestOnly && n > 0 && kq.entries[n-1].latestOnly {
+		kq.entries[n-1] = entry
+		return true
+	}
+	if n >= q.maxPending {
+		return false
+	}
+
+	kq.entries = append(kq.entries, entry)
+	if !kq.running && n == 0 {
+		q.ready = append(q.ready, key)
+		q.cond.Signal()
+	}
+
+	return true
+}
+
+func (q *orderedQueue) work() {
+	q.mu.Lock()
+	for {
+		for len(q.ready) == 0 {
+			q.cond.Wait()
+		}
+
+		key := q.ready[0]
+		q.ready[0] = ""
+		q.ready = q.ready[1:]
+
+		kq := q.pending[key]
+		entry := kq.entries[0]
+		kq.entries[0] = queueEntry{}
+		kq.entries = kq.entries[1:]
+		kq.running = true
+		q.mu.Unlock()
+
+		entry.fn()
+
+		q.mu.Lock()
+		kq.running = false
+		if len(kq.entries) == 0 {
+			delete(q.pending, key)
+		} else {
+			// Let other keys take their turn before running the next function.
+			q.ready = append(q.ready, key)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package hooks
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrderedQueue(t *testing.T) {
+	a := assert.New(t)
+	queue := newOrderedQueue(2, 10)
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	order := map[string][]int{}
+	record := func(key string, i int) func() {
+		wg.Add(1)
+		return func() {
+			defer wg.Done()
+			// Delay the first function, so later ones would overtake it if
+			// they were not serialized.
+			if i == 0 {
+				time.Sleep(20 * time.Millisecond)
+			}
+			mu.Lock()
+			order[key] = append(order[key], i)
+			mu.Unlock()
+		}
+	}
+
+	// A blocked upload must not delay the functions of other uploads.
+	blocked := make(chan struct{})
+	wg.Add(1)
+	a.True(queue.enqueue("blocked", func() {
+		defer wg.Done()
+		<-blocked
+	}))
+
+	for i := 0; i < 5; i++ {
+		a.True(queue.enqueue("a", record("a", i)))
+		a.True(queue.enqueue("b", record("b", i)))
+	}
+
+	a.Eventually(func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(order["a"]) == 5 && len(order["b"]) == 5
+	}, time.Second, time.Millisecond)
+	close(blocked)
+	wg.Wait()
+
+	a.Equal([]int{0, 1, 2, 3, 4}, order["a"])
+	a.Equal([]int{0, 1, 2, 3, 4}, order["b"])
+
+	// Keys are removed once their queue is empty.
+	a.Eventually(func() bool {
+		queue.mu.Lock()
+		defer queue.mu.Unlock()
+		return len(queue.pending) == 0
+	}, time.Second, time.Millisecond)
+}
+
+func TestOrderedQueueLimits(t *testing.T) {
+	a := assert.New(t)
+	queue := newOrderedQueue(1, 3)
+
+	var mu sync.Mutex
+	var calls []string
+	record := func(name string) func() {
+		return func() {
+			mu.Lock()
+			calls = append(calls, name)
+			mu.Unlock()
+		}
+	}
+
+	// Occupy the only worker, so all further functions remain queued.
+	started := make(chan struct{})
+	blocked := make(chan struct{})
+	a.True(queue.enqueue("a", func() {
+		close(started)
+		<-blocked
+	}))
+	<-started
+
+	// Functions of other keys wait for a free worker.
+	a.True(queue.enqueue("b", record("b")))
+
+	// Queued progress functions are collapsed into the latest one.
+	a.True(queue.enqueue("a", record("create")))
+	a.True(queue.enqueueLatest("a", record("progress 1")))
+	a.True(queue.enqueueLatest("a", record("progress 2")))
+	a.True(queue.enqueueLatest("a", record("progress 3")))
+	a.True(queue.enqueue("a", record("finish")))
+
+	// The backlog of a key is limited.
+	a.False(queue.enqueue("a", record("dropped")))
+	a.False(queue.enqueueLatest("a", record("dropped")))
+
+	mu.Lock()
+	a.Empty(calls)
+	mu.Unlock()
+
+	close(blocked)
+	a.Eventually(func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(calls) == 4
+	}, time.Second, time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	a.Equal([]string{"b", "create", "progress 3", "finish"}, calls)
+}
@@ -0,0 +1,335 @@
+package hooks
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/tus/tusd/v2/internal/jsonschema"
+	"github.com/tus/tusd/v2/pkg/handler"
+)
+
+// Versions of the JSON payload, which is sent to HTTP and file hooks and read
+// from their responses.
+const (
+	// PayloadV1 is the original payload, which mirrors the HookRequest and
+	// HookResponse types including their Go field names. It is the default, so
+	// that existing hook receivers keep working.
+	PayloadV1 = 1
+	// PayloadV2 is the documented payload, which uses snake_case field names and
+	// carries its version, see HookRequestV2 and HookResponseV2.
+	PayloadV2 = 2
+)
+
+// PayloadVersionHeader is the HTTP header, in which tusd announces the version
+// of a hook request's payload. A hook receiver can respond with a different
+// version by setting the same header in its response, e.g. to answer in version
+// 1 while being migrated.
+const PayloadVersionHeader = "Tusd-Hook-Payload-Version"
+
+// HookRequestV2 is version 2 of the payload describing a hook event.
+type HookRequestV2 struct {
+	// Version is always 2.
+	Version int `json:"version"`
+	// Type is the name of the hook, e.g. pre-create.
+	Type HookType `json:"type"`
+	// Upload is the upload, which caused the hook to be fired.
+	Upload UploadV2 `json:"upload"`
+	// HTTPRequest is the request, which reached tusd.
+	HTTPRequest HTTPRequestV2 `json:"http_request"`
+	// ByteBudget is the usage of the bucket's transfer budget. It is only
+	// included in budget-exceeded hooks.
+	ByteBudget *ByteBudgetV2 `json:"byte_budget,omitempty"`
+	// PresignedURLs allow reading the upload's content. They are only included
+	// in post-finish hooks if -presign-completed-uploads is enabled.
+	PresignedURLs *PresignedURLsV2 `json:"presigned_urls,omitempty"`
+}
+
+// UploadV2 describes an upload in version 2 of the hook payload. See
+// handler.FileInfo for details on its fields.
+type UploadV2 struct {
+	ID             string            `json:"id"`
+	Size           int64             `json:"size"`
+	SizeIsDeferred bool              `json:"size_is_deferred"`
+	Offset         int64             `json:"offset"`
+	MetaData       map[string]string `json:"metadata"`
+	IsPartial      bool              `json:"is_partial"`
+	IsFinal        bool              `json:"is_final"`
+	PartialUploads []string          `json:"partial_uploads"`
+	ExpiresAt      *time.Time        `json:"expires_at,omitempty"`
+	Priority       int               `json:"priority,omitempty"`
+	Checksum       *ChecksumV2       `json:"checksum,omitempty"`
+	Storage        map[string]string `json:"storage"`
+}
+
+// ChecksumV2 describes the checksum declared for an upload in version 2 of the
+// hook payload. See handler.UploadChecksum for details on its fields.
+type ChecksumV2 struct {
+	Algorithm string `json:"algorithm"`
+	Expected  string `json:"expected"`
+	Actual    string `json:"actual,omitempty"`
+	Verified  bool   `json:"verified"`
+}
+
+// PresignedURLsV2 describes the pre-signed URLs for reading a completed upload
+// in version 2 of the hook payload. See handler.PresignedURLs for details on
+// its fields.
+type PresignedURLsV2 struct {
+	GET       string    `json:"get"`
+	HEAD      string    `json:"head"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// ByteBudgetV2 describes the usage of a bucket's transfer budget in version 2
+// of the hook payload. See handler.ByteBudgetUsage for details on its fields.
+type ByteBudgetV2 struct {
+	Bucket       string `json:"bucket"`
+	Month        string `json:"month"`
+	BytesWritten int64  `json:"bytes_written"`
+	BytesRead    int64  `json:"bytes_read"`
+	SoftLimit    int64  `json:"soft_limit"`
+	HardLimit    int64  `json:"hard_limit"`
+}
+
+// HTTPRequestV2 describes the request from the client in version 2 of the hook
+// payload. Header contains all request headers, including Host.
+type HTTPRequestV2 struct {
+	Method     string              `json:"method"`
+	URI        string              `json:"uri"`
+	RemoteAddr string              `json:"remote_addr"`
+	Header     map[string][]string `json:"header"`
+}
+
+// HookResponseV2 is version 2 of the payload, with which a hook receiver can
+// influence the handling of the upload. All fields are optional and have the
+// same meaning as in HookResponse.
+type HookResponseV2 struct {
+	HTTPResponse   *HTTPResponseV2    `json:"http_response,omitempty"`
+	RejectUpload   bool               `json:"reject_upload,omitempty"`
+	ChangeFileInfo *FileInfoChangesV2 `json:"change_file_info,omitempty"`
+	StopUpload     bool               `json:"stop_upload,omitempty"`
+}
+
+// HTTPResponseV2 modifies the response to the client, see handler.HTTPResponse.
+type HTTPResponseV2 struct {
+	StatusCode int               `json:"status_code,omitempty"`
+	Body       string            `json:"body,omitempty"`
+	Header     map[string]string `json:"header,omitempty"`
+}
+
+// FileInfoChangesV2 changes properties of an upload before it is created, see
+// handler.FileInfoChanges.
+type FileInfoChangesV2 struct {
+	ID        string            `json:"id,omitempty"`
+	MetaData  map[string]string `json:"metadata,omitempty"`
+	Storage   map[string]string `json:"storage,omitempty"`
+	ExpiresAt *time.Time        `json:"expires_at,omitempty"`
+	Priority  *int              `json:"priority,omitempty"`
+}
+
+// ValidatePayloadVersion returns an error if version is not supported.
+func ValidatePayloadVersion(version int) error {
+	if version != PayloadV1 && version != PayloadV2 {
+		return fmt.Errorf("unsupported hook payload version %d, must be %d or %d", version, PayloadV1, PayloadV2)
+	}
+	return nil
+}
+
+// MarshalRequest encodes the hook request using the given payload version. A
+// version of 0 is treated as PayloadV1.
+func MarshalRequest(req HookRequest, version int) ([]byte, error) {
+	switch version {
+	case 0, PayloadV1:
+		return json.Marshal(req)
+	case PayloadV2:
+		return json.Marshal(newHookRequestV2(req))
+	default:
+		return nil, ValidatePayloadVersion(version)
+	}
+}
+
+// UnmarshalResponse decodes a hook response, which has been encoded using the
+// given payload version. A version of 0 is treated as PayloadV1.
+func UnmarshalResponse(data []byte, version int) (HookResponse, error) {
+	switch version {
+	case 0, PayloadV1:
+		var res HookResponse
+		err := json.Unmarshal(data, &res)
+		return res, err
+	case PayloadV2:
+		var res HookResponseV2
+		if err := json.Unmarshal(data, &res); err != nil {
+			return HookResponse{}, err
+		}
+		return res.toHookResponse(), nil
+	default:
+		return HookResponse{}, ValidatePayloadVersion(version)
+	}
+}
+
+func newHookRequestV2(req HookRequest) HookRequestV2 {
+	info := req.Event.Upload
+	httpReq := req.Event.HTTPRequest
+
+	// Version 2 encodes missing collections as empty objects and arrays
+	// instead of null.
+	if info.MetaData == nil {
+		info.MetaData = handler.MetaData{}
+	}
+	if info.PartialUploads == nil {
+		info.PartialUploads = []string{}
+	}
+	if info.Storage == nil {
+		info.Storage = map[string]string{}
+	}
+	if httpReq.Header == nil {
+		httpReq.Header = http.Header{}
+	}
+
+	var checksum *ChecksumV2
+	if info.Checksum != nil {
+		checksum = &ChecksumV2{
+			Algorithm: info.Checksum.Algorithm,
+			Expected:  info.Checksum.Expected,
+			Actual:    info.Checksum.Actual,
+			Verified:  info.Checksum.Verified,
+		}
+	}
+
+	var byteBudget *ByteBudgetV2
+	if usage := req.Event.ByteBudget; usage != nil {
+		byteBudget = &ByteBudgetV2{
+			Bucket:       usage.Bucket,
+			Month:        usage.Month,
+			BytesWritten: usage.BytesWritten,
+			BytesRead:    usage.BytesRead,
+			SoftLimit:    usage.SoftLimit,
+			HardLimit:    usage.HardLimit,
+		}
+	}
+
+	var presignedURLs *PresignedURLsV2
+	if urls := req.Event.PresignedURLs; urls != nil {
+		presignedURLs = &PresignedURLsV2{
+			GET:       urls.GET,
+			HEAD:      urls.HEAD,
+			ExpiresAt: urls.ExpiresAt,
+		}
+	}
+
+	return HookRequestV2{
+		Version: PayloadV2,
+		Type:    req.Type,
+		Upload: UploadV2{
+			ID:             info.ID,
+			Size:           info.Size,
+			SizeIsDeferred: info.SizeIsDeferred,
+			Offset:         info.Offset,
+			MetaData:       info.MetaData,
+			IsPartial:      info.IsPartial,
+			IsFinal:        info.IsFinal,
+			PartialUploads: info.PartialUploads,
+			ExpiresAt:      info.ExpiresAt,
+			Priority:       info.Priority,
+			Checksum:       checksum,
+			Storage:        info.Storage,
+		},
+		HTTPRequest: HTTPRequestV2{
+			Method:     httpReq.Method,
+			URI:        httpReq.URI,
+			RemoteAddr: httpReq.RemoteAddr,
+			Header:     httpReq.Header,
+		},
+		ByteBudget:    byteBudget,
+		PresignedURLs: presignedURLs,
+	}
+}
+
+func (res HookResponseV2) toHookResponse() HookResponse {
+	hookRes := HookResponse{
+		RejectUpload: res.RejectUpload,
+		StopUpload:   res.StopUpload,
+	}
+
+	if res.HTTPResponse != nil {
+		hookRes.HTTPResponse = handler.HTTPResponse{
+			StatusCode: res.HTTPResponse.StatusCode,
+			Body:       res.HTTPResponse.Body,
+			Header:     res.HTTPResponse.Header,
+		}
+	}
+
+	if res.ChangeFileInfo != nil {
+		hookRes.ChangeFileInfo = handler.FileInfoChanges{
+			ID:        res.ChangeFileInfo.ID,
+			MetaData:  res.ChangeFileInfo.MetaData,
+			Storage:   res.ChangeFileInfo.Storage,
+			ExpiresAt: res.ChangeFileInfo.ExpiresAt,
+			Priority:  res.ChangeFileInfo.Priority,
+		}
+	}
+
+	return hookRes
+}
+
+// RequestSchema returns the JSON Schema of hook requests in the given payload
+// version. The schemas are published in the docs/schemas directory.
+func RequestSchema(version int) ([]byte, error) {
+	var schema *jsonschema.Schema
+	switch version {
+	case PayloadV1:
+		schema = jsonschema.Generate(HookRequest{})
+	case PayloadV2:
+		schema = jsonschema.Generate(HookRequestV2{})
+		schema.Properties["version"].Const = PayloadV2
+	default:
+		return nil, ValidatePayloadVersion(version)
+	}
+
+	schema.ID = schemaID("request", version)
+	schema.Title = fmt.Sprintf("tusd hook request (version %d)", version)
+
+	typeProperty := "Type"
+	if version == PayloadV2 {
+		typeProperty = "type"
+	}
+	for _, hookType := range AvailableHooks {
+		schema.Properties[typeProperty].Enum = append(schema.Properties[typeProperty].Enum, string(hookType))
+	}
+
+	return schema.Marshal()
+}
+
+// ResponseSchema returns the JSON Schema of hook responses in the given payload
+// version.
+func ResponseSchema(version int) ([]byte, error) {
+	var schema *jsonschema.Schema
+	switch version {
+	case PayloadV1:
+		schema = jsonschema.Generate(HookResponse{})
+		// Hook receivers may omit any field of the response, although the Go
+		// types do not use omitempty.
+		makeOptional(schema)
+	case PayloadV2:
+		schema = jsonschema.Generate(HookResponseV2{})
+	default:
+		return nil, ValidatePayloadVersion(version)
+	}
+
+	schema.ID = schemaID("response", version)
+	schema.Title = fmt.Sprintf("tusd hook response (version %d)", version)
+
+	return schema.Marshal()
+}
+
+func makeOptional(schema *jsonschema.Schema) {
+	schema.Required = nil
+	for _, property := range schema.Properties {
+		makeOptional(property)
+	}
+}
+
+func schemaID(kind string, version int) string {
+	return fmt.Sprintf("https://github.com/tus/tusd/blob/main/docs/schemas/hook-%s-v%d.json", kind, version)
+}
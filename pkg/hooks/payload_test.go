@@ -0,0 +1,95 @@
+package hooks
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tus/tusd/v2/pkg/handler"
+)
+
+func newPayloadRequest() HookRequest {
+	return HookRequest{
+		Type: HookPreCreate,
+		Event: handler.HookEvent{
+			Upload: handler.FileInfo{
+				ID:       "id",
+				Size:     100,
+				MetaData: handler.MetaData{"filename": "a.txt"},
+			},
+			HTTPRequest: handler.HTTPRequest{
+				Method:     "POST",
+				URI:        "/files/",
+				RemoteAddr: "203.0.113.7:1234",
+				Header:     http.Header{"Upload-Length": []string{"100"}},
+			},
+		},
+	}
+}
+
+func TestMarshalRequest(t *testing.T) {
+	a := assert.New(t)
+	req := newPayloadRequest()
+
+	v1, err := MarshalRequest(req, PayloadV1)
+	a.NoError(err)
+	legacy, _ := json.Marshal(req)
+	a.Equal(legacy, v1)
+
+	v2, err := MarshalRequest(req, PayloadV2)
+	a.NoError(err)
+	var decoded map[string]interface{}
+	a.NoError(json.Unmarshal(v2, &decoded))
+	a.EqualValues(2, decoded["version"])
+	a.Equal("pre-create", decoded["type"])
+	a.Equal("id", decoded["upload"].(map[string]interface{})["id"])
+	a.Equal("203.0.113.7:1234", decoded["http_request"].(map[string]interface{})["remote_addr"])
+
+	_, err = MarshalRequest(req, 3)
+	a.Error(err)
+}
+
+func TestUnmarshalResponse(t *testing.T) {
+	a := assert.New(t)
+
+	res, err := UnmarshalResponse([]byte(`{"RejectUpload":true,"HTTPResponse":{"StatusCode":400}}`), PayloadV1)
+	a.NoError(err)
+	a.True(res.RejectUpload)
+	a.Equal(400, res.HTTPResponse.StatusCode)
+
+	res, err = UnmarshalResponse([]byte(`{"reject_upload":true,"http_response":{"status_code":400,"header":{"X-Reason":"quota"}},"change_file_info":{"id":"custom","priority":5}}`), PayloadV2)
+	a.NoError(err)
+	a.True(res.RejectUpload)
+	a.Equal(handler.HTTPResponse{StatusCode: 400, Header: handler.HTTPHeader{"X-Reason": "quota"}}, res.HTTPResponse)
+	a.Equal("custom", res.ChangeFileInfo.ID)
+	a.Equal(5, *res.ChangeFileInfo.Priority)
+
+	// Fields of version 1 are not recognized in version 2.
+	res, err = UnmarshalResponse([]byte(`{"RejectUpload":true}`), PayloadV2)
+	a.NoError(err)
+	a.False(res.RejectUpload)
+}
+
+// TestPublishedSchemas ensures that the schemas in docs/schemas match the Go
+// types. Run `tusd hook-schemas -dir docs/schemas` to update them.
+func TestPublishedSchemas(t *testing.T) {
+	for _, version := range []int{PayloadV1, PayloadV2} {
+		request, err := RequestSchema(version)
+		assert.NoError(t, err)
+		response, err := ResponseSchema(version)
+		assert.NoError(t, err)
+
+		for name, schema := range map[string][]byte{
+			fmt.Sprintf("hook-request-v%d.json", version):  request,
+			fmt.Sprintf("hook-response-v%d.json", version): response,
+		} {
+			published, err := os.ReadFile(filepath.Join("..", "..", "docs", "schemas", name))
+			assert.NoError(t, err)
+			assert.Equal(t, string(published), string(schema), name)
+		}
+	}
+}
@@ -0,0 +1,366 @@
+// Package instrumentedstore provides a wrapper for data stores, which records
+// the latency and errors of their operations as Prometheus metrics.
+//
+// Every store wrapped by InstrumentedStore exposes the same metrics, labeled
+// with the store's name and the operation, so that stores without their own
+// instrumentation can be monitored and different stores can be compared using
+// the same dashboards:
+//
+//   - tusd_store_operations_total counts the operations.
+//   - tusd_store_operation_errors_total counts the failed operations. Errors
+//     caused by clients, such as requests for missing uploads or interrupted
+//     transfers, are not counted.
+//   - tusd_store_operation_duration_seconds is a histogram of the operations'
+//     durations. The transfers of upload data in WriteChunk, ConcatUploads
+//     and IngestObject are not included, since their durations depend on the
+//     size of the data and on the client.
+//
+// The operations are named after the methods of the handler's interfaces,
+// e.g. "NewUpload" or "GetInfo". The wrapped store is passed as composer, so
+// that all of its extensions are preserved:
+//
+//	inner := handler.NewStoreComposer()
+//	store := filestore.New("./uploads")
+//	store.UseIn(inner)
+//
+//	instrumented := instrumentedstore.New(inner, "")
+//	instrumented.RegisterMetrics(prometheus.DefaultRegisterer)
+//
+//	composer := handler.NewStoreComposer()
+//	instrumented.UseIn(composer)
+package instrumentedstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path"
+	"reflect"
+	"time"
+
+	"github.com/tus/tusd/v2/pkg/handler"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// InstrumentedStore wraps a data store and records metrics about its
+// operations. It must be created using New.
+type InstrumentedStore struct {
+	inner *handler.StoreComposer
+	name  string
+
+	operationsMetric *prometheus.CounterVec
+	errorsMetric     *prometheus.CounterVec
+	durationMetric   *prometheus.HistogramVec
+}
+
+// New creates a store, which forwards all operations to the store in inner and
+// records their metrics labeled with name. If name is empty, the name of the
+// package implementing the inner store is used, such as "filestore".
+func New(inner *handler.StoreComposer, name string) *InstrumentedStore {
+	if name == "" {
+		name = packageName(inner.Core)
+	}
+
+	labels := prometheus.Labels{"store": name}
+	return &InstrumentedStore{
+		inner: inner,
+		name:  name,
+		operationsMetric: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:        "tusd_store_operations_total",
+			Help:        "Total number of operations of the data store.",
+			ConstLabels: labels,
+		}, []string{"operation"}),
+		errorsMetric: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:        "tusd_store_operation_errors_total",
+			Help:        "Total number of failed operations of the data store, excluding errors caused by clients.",
+			ConstLabels: labels,
+		}, []string{"operation"}),
+		durationMetric: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:        "tusd_store_operation_duration_seconds",
+			Help:        "Duration of the data store's operations in seconds, excluding transfers of upload data.",
+			Buckets:     []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+			ConstLabels: labels,
+		}, []string{"operation"}),
+	}
+}
+
+// UseIn sets this store as the core data store in the passed composer and adds
+// all extensions, which are provided by the wrapped store.
+func (store *InstrumentedStore) UseIn(composer *handler.StoreComposer) {
+	handler.UseWrapper(composer, store, store.inner)
+}
+
+// RegisterMetrics registers the store's metrics with registry.
+func (store *InstrumentedStore) RegisterMetrics(registry prometheus.Registerer) {
+	registry.MustRegister(store.operationsMetric)
+	registry.MustRegister(store.errorsMetric)
+	registry.MustRegister(store.durationMetric)
+}
+
+// StoreName returns the name, with which the metrics are labeled. The handler
+// uses it to label its upload metrics with the name of the wrapped store
+// instead of this package's name.
+func (store *InstrumentedStore) StoreName() string {
+	return store.name
+}
+
+// observe records an operation, which started at start.
+func (store *InstrumentedStore) observe(operation string, start time.Time, err error) {
+	store.durationMetric.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	store.count(operation, isFailure(err))
+}
+
+// count records an operation without its duration.
+func (store *InstrumentedStore) count(operation string, failed bool) {
+	store.operationsMetric.WithLabelValues(operation).Inc()
+	if failed {
+		store.errorsMetric.WithLabelValues(operation).Inc()
+	}
+}
+
+// isFailure reports whether err indicates a problem of the store. Errors
+// caused by clients or by tusd interrupting a request are not counted.
+func isFailure(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var detailedErr handler.Error
+	if errors.As(err, &detailedErr) {
+		if detailedErr.HTTPResponse.StatusCode < 500 {
+			return false
+		}
+
+		switch {
+		case errors.Is(err, handler.ErrServerShutdown), errors.Is(err, handler.ErrReadTimeout), errors.Is(err, handler.ErrConnectionReset):
+			return false
+		}
+	}
+
+	return true
+}
+
+// packageName returns the name of the package, which implements the store.
+func packageName(core handler.DataStore) string {
+	if core == nil {
+		return ""
+	}
+
+	if named, ok := core.(interface{ StoreName() string }); ok {
+		return named.StoreName()
+	}
+
+	t := reflect.TypeOf(core)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return path.Base(t.PkgPath())
+}
+
+func (store *InstrumentedStore) NewUpload(ctx context.Context, info handler.FileInfo) (handler.Upload, error) {
+	start := time.Now()
+	upload, err := store.inner.Core.NewUpload(ctx, info)
+	store.observe("NewUpload", start, err)
+	if err != nil {
+		return nil, err
+	}
+
+	return &instrumentedUpload{store: store, upload: upload}, nil
+}
+
+func (store *InstrumentedStore) GetUpload(ctx context.Context, id string) (handler.Upload, error) {
+	start := time.Now()
+	upload, err := store.inner.Core.GetUpload(ctx, id)
+	store.observe("GetUpload", start, err)
+	if err != nil {
+		return nil, err
+	}
+
+	return &instrumentedUpload{store: store, upload: upload}, nil
+}
+
+func (store *InstrumentedStore) ListUploads(ctx context.Context, cursor string) ([]string, string, error) {
+	start := time.Now()
+	ids, next, err := store.inner.Lister.ListUploads(ctx, cursor)
+	store.observe("ListUploads", start, err)
+	return ids, next, err
+}
+
+func (store *InstrumentedStore) ImportUpload(ctx context.Context, info handler.FileInfo) (handler.Upload, error) {
+	start := time.Now()
+	upload, err := store.inner.Importer.ImportUpload(ctx, info)
+	store.observe("ImportUpload", start, err)
+	if err != nil {
+		return nil, err
+	}
+
+	return &instrumentedUpload{store: store, upload: upload}, nil
+}
+
+func (store *InstrumentedStore) IngestObject(ctx context.Context, info handler.FileInfo, source handler.IngestSource) (handler.Upload, error) {
+	// The duration depends on the size of the object, so it is not timed.
+	upload, err := store.inner.Ingester.IngestObject(ctx, info, source)
+	store.count("IngestObject", isFailure(err))
+	if err != nil {
+		return nil, err
+	}
+
+	return &instrumentedUpload{store: store, upload: upload}, nil
+}
+
+func (store *InstrumentedStore) AsTerminatableUpload(upload handler.Upload) handler.TerminatableUpload {
+	return upload.(*instrumentedUpload)
+}
+
+func (store *InstrumentedStore) AsConcatableUpload(upload handler.Upload) handler.ConcatableUpload {
+	return upload.(*instrumentedUpload)
+}
+
+func (store *InstrumentedStore) AsLengthDeclarableUpload(upload handler.Upload) handler.LengthDeclarableUpload {
+	return upload.(*instrumentedUpload)
+}
+
+func (store *InstrumentedStore) AsPresignableUpload(upload handler.Upload) handler.PresignableUpload {
+	return upload.(*instrumentedUpload)
+}
+
+func (store *InstrumentedStore) AsPartPresignableUpload(upload handler.Upload) handler.PartPresignableUpload {
+	return upload.(*instrumentedUpload)
+}
+
+func (store *InstrumentedStore) AsExpirableUpload(upload handler.Upload) handler.ExpirableUpload {
+	return upload.(*instrumentedUpload)
+}
+
+func (store *InstrumentedStore) AsInspectableUpload(upload handler.Upload) handler.InspectableUpload {
+	return upload.(*instrumentedUpload)
+}
+
+func (store *InstrumentedStore) AsPartialAppendableUpload(upload handler.Upload) handler.PartialAppendableUpload {
+	return upload.(*instrumentedUpload)
+}
+
+func (store *InstrumentedStore) AsChecksumRecordableUpload(upload handler.Upload) handler.ChecksumRecordableUpload {
+	return upload.(*instrumentedUpload)
+}
+
+// instrumentedUpload wraps an upload of the inner store. The extensions of the
+// inner store expect their own uploads, so the wrapped upload is passed to them.
+type instrumentedUpload struct {
+	store  *InstrumentedStore
+	upload handler.Upload
+}
+
+func (upload *instrumentedUpload) WriteChunk(ctx context.Context, offset int64, src io.Reader) (int64, error) {
+	reader := &trackingReader{src: src}
+	n, err := upload.upload.WriteChunk(ctx, offset, reader)
+
+	// Failures to receive the data from the client are not the store's fault.
+	// The duration depends on the client, so it is not timed either.
+	upload.store.count("WriteChunk", reader.err == nil && isFailure(err))
+	return n, err
+}
+
+func (upload *instrumentedUpload) GetInfo(ctx context.Context) (handler.FileInfo, error) {
+	start := time.Now()
+	info, err := upload.upload.GetInfo(ctx)
+	upload.store.observe("GetInfo", start, err)
+	return info, err
+}
+
+func (upload *instrumentedUpload) GetReader(ctx context.Context) (io.ReadCloser, error) {
+	start := time.Now()
+	reader, err := upload.upload.GetReader(ctx)
+	upload.store.observe("GetReader", start, err)
+	return reader, err
+}
+
+func (upload *instrumentedUpload) FinishUpload(ctx context.Context) error {
+	start := time.Now()
+	err := upload.upload.FinishUpload(ctx)
+	upload.store.observe("FinishUpload", start, err)
+	return err
+}
+
+func (upload *instrumentedUpload) Terminate(ctx context.Context) error {
+	start := time.Now()
+	err := upload.store.inner.Terminater.AsTerminatableUpload(upload.upload).Terminate(ctx)
+	upload.store.observe("Terminate", start, err)
+	return err
+}
+
+func (upload *instrumentedUpload) ConcatUploads(ctx context.Context, partialUploads []handler.Upload) error {
+	innerUploads := make([]handler.Upload, len(partialUploads))
+	for i, partialUpload := range partialUploads {
+		innerUploads[i] = partialUpload.(*instrumentedUpload).upload
+	}
+
+	// The duration depends on the size of the partial uploads, so it is not timed.
+	err := upload.store.inner.Concater.AsConcatableUpload(upload.upload).ConcatUploads(ctx, innerUploads)
+	upload.store.count("ConcatUploads", isFailure(err))
+	return err
+}
+
+func (upload *instrumentedUpload) DeclareLength(ctx context.Context, length int64) error {
+	start := time.Now()
+	err := upload.store.inner.LengthDeferrer.AsLengthDeclarableUpload(upload.upload).DeclareLength(ctx, length)
+	upload.store.observe("DeclareLength", start, err)
+	return err
+}
+
+func (upload *instrumentedUpload) PresignDownloadURL(ctx context.Context, options handler.PresignOptions) (string, error) {
+	start := time.Now()
+	url, err := upload.store.inner.Presigner.AsPresignableUpload(upload.upload).PresignDownloadURL(ctx, options)
+	upload.store.observe("PresignDownloadURL", start, err)
+	return url, err
+}
+
+func (upload *instrumentedUpload) PresignPart(ctx context.Context, offset int64, expiry time.Duration) (string, int64, error) {
+	start := time.Now()
+	url, size, err := upload.store.inner.PartPresigner.AsPartPresignableUpload(upload.upload).PresignPart(ctx, offset, expiry)
+	upload.store.observe("PresignPart", start, err)
+	return url, size, err
+}
+
+func (upload *instrumentedUpload) SetExpiration(ctx context.Context, expiresAt time.Time) error {
+	start := time.Now()
+	err := upload.store.inner.Expirer.AsExpirableUpload(upload.upload).SetExpiration(ctx, expiresAt)
+	upload.store.observe("SetExpiration", start, err)
+	return err
+}
+
+func (upload *instrumentedUpload) AppendPartialUploads(ctx context.Context, ids []string) error {
+	start := time.Now()
+	err := upload.store.inner.PartialAppender.AsPartialAppendableUpload(upload.upload).AppendPartialUploads(ctx, ids)
+	upload.store.observe("AppendPartialUploads", start, err)
+	return err
+}
+
+func (upload *instrumentedUpload) RecordChecksum(ctx context.Context, checksum handler.UploadChecksum) error {
+	start := time.Now()
+	err := upload.store.inner.ChecksumRecorder.AsChecksumRecordableUpload(upload.upload).RecordChecksum(ctx, checksum)
+	upload.store.observe("RecordChecksum", start, err)
+	return err
+}
+
+func (upload *instrumentedUpload) Inspect(ctx context.Context) (handler.UploadInspection, error) {
+	start := time.Now()
+	inspection, err := upload.store.inner.Inspector.AsInspectableUpload(upload.upload).Inspect(ctx)
+	upload.store.observe("Inspect", start, err)
+	return inspection, err
+}
+
+// trackingReader remembers whether reading from src failed.
+type trackingReader struct {
+	src io.Reader
+	err error
+}
+
+func (r *trackingReader) Read(p []byte) (int, error) {
+	n, err := r.src.Read(p)
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return n, err
+}
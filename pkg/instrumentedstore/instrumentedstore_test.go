@@ -0,0 +1,155 @@
+package instrumentedstore
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tus/tusd/v2/pkg/filestore"
+	"github.com/tus/tusd/v2/pkg/handler"
+	"github.com/tus/tusd/v2/pkg/storetest"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Test interface implementation of InstrumentedStore
+var _ handler.DataStore = &InstrumentedStore{}
+var _ handler.TerminaterDataStore = &InstrumentedStore{}
+var _ handler.ConcaterDataStore = &InstrumentedStore{}
+var _ handler.LengthDeferrerDataStore = &InstrumentedStore{}
+var _ handler.ListableDataStore = &InstrumentedStore{}
+var _ handler.PresignerDataStore = &InstrumentedStore{}
+var _ handler.PartPresignerDataStore = &InstrumentedStore{}
+var _ handler.ExpirerDataStore = &InstrumentedStore{}
+var _ handler.InspectorDataStore = &InstrumentedStore{}
+var _ handler.ImporterDataStore = &InstrumentedStore{}
+var _ handler.IngesterDataStore = &InstrumentedStore{}
+
+func newStore(t *testing.T, name string) (*InstrumentedStore, *handler.StoreComposer) {
+	inner := handler.NewStoreComposer()
+	filestore.New(t.TempDir()).UseIn(inner)
+
+	composer := handler.NewStoreComposer()
+	store := New(inner, name)
+	store.UseIn(composer)
+	return store, composer
+}
+
+// TestConformance checks that the wrapped store behaves like the inner one.
+func TestConformance(t *testing.T) {
+	_, composer := newStore(t, "")
+	storetest.Run(t, composer, storetest.Options{})
+}
+
+func TestUseIn(t *testing.T) {
+	_, composer := newStore(t, "")
+
+	a := assert.New(t)
+	a.True(composer.UsesTerminater)
+	a.True(composer.UsesConcater)
+	a.True(composer.UsesLengthDeferrer)
+	a.True(composer.UsesLister)
+	a.True(composer.UsesExpirer)
+	a.False(composer.UsesPresigner)
+	a.False(composer.UsesInspector)
+	a.False(composer.UsesImporter)
+}
+
+func TestStoreName(t *testing.T) {
+	a := assert.New(t)
+
+	store, _ := newStore(t, "")
+	a.Equal("filestore", store.StoreName())
+
+	store, _ = newStore(t, "webdav")
+	a.Equal("webdav", store.StoreName())
+
+	// Wrapping the store again keeps the name of the innermost store.
+	inner := handler.NewStoreComposer()
+	store.UseIn(inner)
+	a.Equal("webdav", New(inner, "").StoreName())
+}
+
+func TestMetrics(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	store, composer := newStore(t, "")
+
+	registry := prometheus.NewRegistry()
+	store.RegisterMetrics(registry)
+
+	upload, err := composer.Core.NewUpload(ctx, handler.FileInfo{Size: 5})
+	a.NoError(err)
+	_, err = upload.WriteChunk(ctx, 0, strings.NewReader("hello"))
+	a.NoError(err)
+	_, err = upload.GetInfo(ctx)
+	a.NoError(err)
+
+	// Client errors are counted as operations, but not as errors.
+	_, err = composer.Core.GetUpload(ctx, "missing")
+	a.ErrorIs(err, handler.ErrNotFound)
+
+	families, err := registry.Gather()
+	a.NoError(err)
+
+	operations := findFamily(families, "tusd_store_operations_total")
+	a.EqualValues(1, counterValue(operations, "NewUpload"))
+	a.EqualValues(1, counterValue(operations, "WriteChunk"))
+	a.EqualValues(1, counterValue(operations, "GetInfo"))
+	a.EqualValues(1, counterValue(operations, "GetUpload"))
+	a.Equal("filestore", labelValue(operations.Metric[0], "store"))
+
+	a.Nil(findFamily(families, "tusd_store_operation_errors_total"))
+
+	durations := findFamily(families, "tusd_store_operation_duration_seconds")
+	a.NotNil(findMetric(durations, "GetInfo"))
+	// Transfers of upload data are not timed.
+	a.Nil(findMetric(durations, "WriteChunk"))
+}
+
+func TestIsFailure(t *testing.T) {
+	a := assert.New(t)
+	a.False(isFailure(nil))
+	a.False(isFailure(context.Canceled))
+	a.False(isFailure(handler.ErrNotFound))
+	a.False(isFailure(handler.ErrReadTimeout))
+	a.False(isFailure(handler.ErrServerShutdown))
+	a.True(isFailure(errors.New("connection refused")))
+	a.True(isFailure(context.DeadlineExceeded))
+	a.True(isFailure(handler.NewError("ERR_BACKEND", "backend failed", http.StatusInternalServerError)))
+}
+
+func findFamily(families []*dto.MetricFamily, name string) *dto.MetricFamily {
+	for _, family := range families {
+		if family.GetName() == name {
+			return family
+		}
+	}
+	return nil
+}
+
+func findMetric(family *dto.MetricFamily, operation string) *dto.Metric {
+	for _, metric := range family.GetMetric() {
+		if labelValue(metric, "operation") == operation {
+			return metric
+		}
+	}
+	return nil
+}
+
+func counterValue(family *dto.MetricFamily, operation string) float64 {
+	return findMetric(family, operation).GetCounter().GetValue()
+}
+
+func labelValue(metric *dto.Metric, name string) string {
+	for _, label := range metric.GetLabel() {
+		if label.GetName() == name {
+			return label.GetValue()
+		}
+	}
+	return ""
+}
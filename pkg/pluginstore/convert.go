@@ -0,0 +1,62 @@
+package pluginstore
+
+import (
+	"errors"
+
+	"github.com/tus/tusd/v2/pkg/handler"
+	pb "github.com/tus/tusd/v2/pkg/pluginstore/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func marshalFileInfo(info handler.FileInfo) *pb.FileInfo {
+	return &pb.FileInfo{
+		Id:             info.ID,
+		Size:           info.Size,
+		SizeIsDeferred: info.SizeIsDeferred,
+		Offset:         info.Offset,
+		MetaData:       info.MetaData,
+		IsPartial:      info.IsPartial,
+		IsFinal:        info.IsFinal,
+		PartialUploads: info.PartialUploads,
+		Storage:        info.Storage,
+	}
+}
+
+func unmarshalFileInfo(info *pb.FileInfo) handler.FileInfo {
+	return handler.FileInfo{
+		ID:             info.GetId(),
+		Size:           info.GetSize(),
+		SizeIsDeferred: info.GetSizeIsDeferred(),
+		Offset:         info.GetOffset(),
+		MetaData:       info.GetMetaData(),
+		IsPartial:      info.GetIsPartial(),
+		IsFinal:        info.GetIsFinal(),
+		PartialUploads: info.GetPartialUploads(),
+		Storage:        info.GetStorage(),
+	}
+}
+
+// toStatus converts an error from the data store into a gRPC status, so that
+// a missing upload can be recognized by tusd.
+func toStatus(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if errors.Is(err, handler.ErrNotFound) {
+		return status.Error(codes.NotFound, err.Error())
+	}
+
+	return status.Error(codes.Unknown, err.Error())
+}
+
+// fromStatus converts an error returned by the plugin back into
+// handler.ErrNotFound, if the upload does not exist.
+func fromStatus(err error) error {
+	if status.Code(err) == codes.NotFound {
+		return handler.ErrNotFound
+	}
+
+	return err
+}
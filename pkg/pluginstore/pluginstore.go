@@ -0,0 +1,296 @@
+// Package pluginstore runs a data store implementation in a separate process,
+// which communicates with tusd over gRPC using Hashicorp's plugin system
+// (https://github.com/hashicorp/go-plugin). This allows attaching proprietary
+// storage backends to the tusd binary without forking the repository.
+//
+// A plugin is an executable which configures its data store using a
+// StoreComposer and passes it to Serve:
+//
+//	func main() {
+//		composer := handler.NewStoreComposer()
+//		mystore.New(...).UseIn(composer)
+//		pluginstore.Serve(composer)
+//	}
+//
+// tusd then loads the plugin using New. Plugins can also be written in other
+// languages by implementing the DataStore service from
+// github.com/tus/tusd/v2/pkg/pluginstore/proto/store.proto and the go-plugin
+// handshake, see https://github.com/hashicorp/go-plugin/blob/main/docs/guide-plugin-write-non-go.md.
+//
+// The core data store as well as the termination, deferred length and
+// concatenation extensions are supported. The plugin reports which extensions it
+// implements when it is loaded. Locking is not performed by the plugin, so a
+// separate locker, such as memorylocker, must be used.
+package pluginstore
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/exec"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-plugin"
+	"github.com/tus/tusd/v2/pkg/handler"
+	pb "github.com/tus/tusd/v2/pkg/pluginstore/proto"
+)
+
+// chunkSize is the maximum number of bytes sent in a single message when
+// streaming an upload's data. It is well below gRPC's default message limit
+// of 4MiB.
+const chunkSize = 1024 * 1024
+
+// handshakeConfig is used for a basic handshake between tusd and the plugin. It
+// prevents a hook plugin from being loaded as a store plugin and vice versa.
+// It is a UX feature, not a security feature.
+var handshakeConfig = plugin.HandshakeConfig{
+	ProtocolVersion:  1,
+	MagicCookieKey:   "TUSD_STORE_PLUGIN",
+	MagicCookieValue: "yes",
+}
+
+// pluginMap is the map of plugins we can dispense.
+var pluginMap = map[string]plugin.Plugin{
+	"dataStore": &DataStorePlugin{},
+}
+
+// PluginStore is a data store which forwards all calls to a plugin process.
+type PluginStore struct {
+	client       pb.DataStoreClient
+	capabilities *pb.GetCapabilitiesResponse
+}
+
+// New launches the plugin executable at the given path and connects to it.
+// Since the plugin process is managed by go-plugin, plugin.CleanupClients must
+// be called when tusd exits to stop it.
+func New(path string) (*PluginStore, error) {
+	client := plugin.NewClient(&plugin.ClientConfig{
+		HandshakeConfig:  handshakeConfig,
+		Plugins:          pluginMap,
+		Cmd:              exec.Command(path),
+		AllowedProtocols: []plugin.Protocol{plugin.ProtocolGRPC},
+		SyncStdout:       os.Stdout,
+		SyncStderr:       os.Stderr,
+		Managed:          true,
+		Logger: hclog.New(&hclog.LoggerOptions{
+			Name:       "storeplugin",
+			Level:      hclog.Info,
+			Output:     os.Stdout,
+			TimeFormat: "2006/01/02 03:04:05.000000",
+		}),
+	})
+
+	rpcClient, err := client.Client()
+	if err != nil {
+		client.Kill()
+		return nil, err
+	}
+
+	raw, err := rpcClient.Dispense("dataStore")
+	if err != nil {
+		client.Kill()
+		return nil, err
+	}
+
+	store := &PluginStore{
+		client: raw.(pb.DataStoreClient),
+	}
+
+	store.capabilities, err = store.client.GetCapabilities(context.Background(), &pb.GetCapabilitiesRequest{})
+	if err != nil {
+		client.Kill()
+		return nil, fromStatus(err)
+	}
+
+	return store, nil
+}
+
+// UseIn sets this store as the core data store in the passed composer and adds
+// all extensions which the plugin supports.
+func (store *PluginStore) UseIn(composer *handler.StoreComposer) {
+	composer.UseCore(store)
+	if store.capabilities.Terminater {
+		composer.UseTerminater(store)
+	}
+	if store.capabilities.LengthDeferrer {
+		composer.UseLengthDeferrer(store)
+	}
+	if store.capabilities.Concater {
+		composer.UseConcater(store)
+	}
+}
+
+func (store *PluginStore) NewUpload(ctx context.Context, info handler.FileInfo) (handler.Upload, error) {
+	res, err := store.client.NewUpload(ctx, &pb.NewUploadRequest{
+		Info: marshalFileInfo(info),
+	})
+	if err != nil {
+		return nil, fromStatus(err)
+	}
+
+	return &pluginUpload{
+		store: store,
+		id:    res.Info.GetId(),
+	}, nil
+}
+
+// GetUpload does not contact the plugin. If the upload does not exist, the
+// error is returned by the upload's methods instead.
+func (store *PluginStore) GetUpload(ctx context.Context, id string) (handler.Upload, error) {
+	return &pluginUpload{
+		store: store,
+		id:    id,
+	}, nil
+}
+
+func (store *PluginStore) AsTerminatableUpload(upload handler.Upload) handler.TerminatableUpload {
+	return upload.(*pluginUpload)
+}
+
+func (store *PluginStore) AsLengthDeclarableUpload(upload handler.Upload) handler.LengthDeclarableUpload {
+	return upload.(*pluginUpload)
+}
+
+func (store *PluginStore) AsConcatableUpload(upload handler.Upload) handler.ConcatableUpload {
+	return upload.(*pluginUpload)
+}
+
+type pluginUpload struct {
+	store *PluginStore
+	id    string
+}
+
+func (upload *pluginUpload) GetInfo(ctx context.Context) (handler.FileInfo, error) {
+	res, err := upload.store.client.GetInfo(ctx, &pb.GetInfoRequest{Id: upload.id})
+	if err != nil {
+		return handler.FileInfo{}, fromStatus(err)
+	}
+
+	return unmarshalFileInfo(res.Info), nil
+}
+
+func (upload *pluginUpload) WriteChunk(ctx context.Context, offset int64, src io.Reader) (int64, error) {
+	stream, err := upload.store.client.WriteChunk(ctx)
+	if err != nil {
+		return 0, fromStatus(err)
+	}
+
+	// The ID and offset are only included in the first message, which is
+	// sent even if the request body is empty.
+	req := &pb.WriteChunkRequest{
+		Id:     upload.id,
+		Offset: offset,
+	}
+	sent := false
+
+	var readErr error
+	for {
+		buf := make([]byte, chunkSize)
+		n, err := io.ReadFull(src, buf)
+		if n > 0 {
+			req.Data = buf[:n]
+			if err := stream.Send(req); err != nil {
+				// The cause is returned by CloseAndRecv.
+				break
+			}
+			req = &pb.WriteChunkRequest{}
+			sent = true
+		}
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			// The data received so far is still written by the plugin, just
+			// like other data stores do when the request body is interrupted.
+			readErr = err
+			break
+		}
+	}
+
+	if !sent {
+		stream.Send(req)
+	}
+
+	res, err := stream.CloseAndRecv()
+	if err != nil {
+		return 0, fromStatus(err)
+	}
+
+	return res.BytesWritten, readErr
+}
+
+func (upload *pluginUpload) GetReader(ctx context.Context) (io.ReadCloser, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	stream, err := upload.store.client.GetReader(ctx, &pb.GetReaderRequest{Id: upload.id})
+	if err != nil {
+		cancel()
+		return nil, fromStatus(err)
+	}
+
+	return &streamReader{
+		stream: stream,
+		cancel: cancel,
+	}, nil
+}
+
+func (upload *pluginUpload) FinishUpload(ctx context.Context) error {
+	_, err := upload.store.client.FinishUpload(ctx, &pb.FinishUploadRequest{Id: upload.id})
+	return fromStatus(err)
+}
+
+func (upload *pluginUpload) Terminate(ctx context.Context) error {
+	_, err := upload.store.client.Terminate(ctx, &pb.TerminateRequest{Id: upload.id})
+	return fromStatus(err)
+}
+
+func (upload *pluginUpload) DeclareLength(ctx context.Context, length int64) error {
+	_, err := upload.store.client.DeclareLength(ctx, &pb.DeclareLengthRequest{
+		Id:     upload.id,
+		Length: length,
+	})
+	return fromStatus(err)
+}
+
+func (upload *pluginUpload) ConcatUploads(ctx context.Context, partialUploads []handler.Upload) error {
+	partialIds := make([]string, len(partialUploads))
+	for i, partialUpload := range partialUploads {
+		partialIds[i] = partialUpload.(*pluginUpload).id
+	}
+
+	_, err := upload.store.client.ConcatUploads(ctx, &pb.ConcatUploadsRequest{
+		Id:         upload.id,
+		PartialIds: partialIds,
+	})
+	return fromStatus(err)
+}
+
+// streamReader reads the upload's data from the messages of a GetReader call.
+type streamReader struct {
+	stream pb.DataStore_GetReaderClient
+	cancel context.CancelFunc
+	data   []byte
+}
+
+func (r *streamReader) Read(p []byte) (int, error) {
+	for len(r.data) == 0 {
+		res, err := r.stream.Recv()
+		if err == io.EOF {
+			return 0, io.EOF
+		}
+		if err != nil {
+			return 0, fromStatus(err)
+		}
+		r.data = res.Data
+	}
+
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+// Close stops the transfer, if the data has not been read completely.
+func (r *streamReader) Close() error {
+	r.cancel()
+	return nil
+}
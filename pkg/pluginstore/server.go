@@ -0,0 +1,223 @@
+package pluginstore
+
+import (
+	"context"
+	"io"
+
+	"github.com/hashicorp/go-plugin"
+	"github.com/tus/tusd/v2/pkg/handler"
+	pb "github.com/tus/tusd/v2/pkg/pluginstore/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Serve runs the data store from the composer as a plugin. It must be called
+// from the main function of the plugin's executable and only returns once tusd
+// stops the plugin. Do not write to stdout in the plugin, as it is used for the
+// communication with tusd.
+func Serve(composer *handler.StoreComposer) {
+	plugin.Serve(&plugin.ServeConfig{
+		HandshakeConfig: handshakeConfig,
+		Plugins: map[string]plugin.Plugin{
+			"dataStore": &DataStorePlugin{Composer: composer},
+		},
+		GRPCServer: plugin.DefaultGRPCServer,
+	})
+}
+
+// DataStorePlugin is the implementation of plugin.GRPCPlugin, which registers
+// the data store on the plugin's side and creates the client on tusd's side.
+type DataStorePlugin struct {
+	plugin.NetRPCUnsupportedPlugin
+
+	// Composer contains the data store served by the plugin.
+	Composer *handler.StoreComposer
+}
+
+func (p *DataStorePlugin) GRPCServer(broker *plugin.GRPCBroker, s *grpc.Server) error {
+	pb.RegisterDataStoreServer(s, &server{composer: p.Composer})
+	return nil
+}
+
+func (p *DataStorePlugin) GRPCClient(ctx context.Context, broker *plugin.GRPCBroker, c *grpc.ClientConn) (interface{}, error) {
+	return pb.NewDataStoreClient(c), nil
+}
+
+// server implements the DataStore service on top of a StoreComposer.
+type server struct {
+	pb.UnimplementedDataStoreServer
+
+	composer *handler.StoreComposer
+}
+
+func (s *server) GetCapabilities(ctx context.Context, req *pb.GetCapabilitiesRequest) (*pb.GetCapabilitiesResponse, error) {
+	return &pb.GetCapabilitiesResponse{
+		Terminater:     s.composer.UsesTerminater,
+		LengthDeferrer: s.composer.UsesLengthDeferrer,
+		Concater:       s.composer.UsesConcater,
+	}, nil
+}
+
+func (s *server) NewUpload(ctx context.Context, req *pb.NewUploadRequest) (*pb.NewUploadResponse, error) {
+	upload, err := s.composer.Core.NewUpload(ctx, unmarshalFileInfo(req.Info))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	info, err := upload.GetInfo(ctx)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &pb.NewUploadResponse{Info: marshalFileInfo(info)}, nil
+}
+
+func (s *server) GetInfo(ctx context.Context, req *pb.GetInfoRequest) (*pb.GetInfoResponse, error) {
+	upload, err := s.composer.Core.GetUpload(ctx, req.Id)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	info, err := upload.GetInfo(ctx)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &pb.GetInfoResponse{Info: marshalFileInfo(info)}, nil
+}
+
+func (s *server) WriteChunk(stream pb.DataStore_WriteChunkServer) error {
+	req, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+
+	ctx := stream.Context()
+	upload, err := s.composer.Core.GetUpload(ctx, req.Id)
+	if err != nil {
+		return toStatus(err)
+	}
+
+	src := &chunkReader{
+		stream: stream,
+		data:   req.Data,
+	}
+	bytesWritten, err := upload.WriteChunk(ctx, req.Offset, src)
+	if err != nil {
+		return toStatus(err)
+	}
+
+	return stream.SendAndClose(&pb.WriteChunkResponse{BytesWritten: bytesWritten})
+}
+
+func (s *server) GetReader(req *pb.GetReaderRequest, stream pb.DataStore_GetReaderServer) error {
+	ctx := stream.Context()
+	upload, err := s.composer.Core.GetUpload(ctx, req.Id)
+	if err != nil {
+		return toStatus(err)
+	}
+
+	src, err := upload.GetReader(ctx)
+	if err != nil {
+		return toStatus(err)
+	}
+	defer src.Close()
+
+	for {
+		buf := make([]byte, chunkSize)
+		n, err := io.ReadFull(src, buf)
+		if n > 0 {
+			if err := stream.Send(&pb.GetReaderResponse{Data: buf[:n]}); err != nil {
+				return err
+			}
+		}
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			return toStatus(err)
+		}
+	}
+}
+
+func (s *server) FinishUpload(ctx context.Context, req *pb.FinishUploadRequest) (*pb.FinishUploadResponse, error) {
+	upload, err := s.composer.Core.GetUpload(ctx, req.Id)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &pb.FinishUploadResponse{}, toStatus(upload.FinishUpload(ctx))
+}
+
+func (s *server) Terminate(ctx context.Context, req *pb.TerminateRequest) (*pb.TerminateResponse, error) {
+	if !s.composer.UsesTerminater {
+		return nil, status.Error(codes.Unimplemented, "data store does not support termination")
+	}
+
+	upload, err := s.composer.Core.GetUpload(ctx, req.Id)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	err = s.composer.Terminater.AsTerminatableUpload(upload).Terminate(ctx)
+	return &pb.TerminateResponse{}, toStatus(err)
+}
+
+func (s *server) DeclareLength(ctx context.Context, req *pb.DeclareLengthRequest) (*pb.DeclareLengthResponse, error) {
+	if !s.composer.UsesLengthDeferrer {
+		return nil, status.Error(codes.Unimplemented, "data store does not support deferring the length")
+	}
+
+	upload, err := s.composer.Core.GetUpload(ctx, req.Id)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	err = s.composer.LengthDeferrer.AsLengthDeclarableUpload(upload).DeclareLength(ctx, req.Length)
+	return &pb.DeclareLengthResponse{}, toStatus(err)
+}
+
+func (s *server) ConcatUploads(ctx context.Context, req *pb.ConcatUploadsRequest) (*pb.ConcatUploadsResponse, error) {
+	if !s.composer.UsesConcater {
+		return nil, status.Error(codes.Unimplemented, "data store does not support concatenation")
+	}
+
+	upload, err := s.composer.Core.GetUpload(ctx, req.Id)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	partialUploads := make([]handler.Upload, len(req.PartialIds))
+	for i, id := range req.PartialIds {
+		partialUploads[i], err = s.composer.Core.GetUpload(ctx, id)
+		if err != nil {
+			return nil, toStatus(err)
+		}
+	}
+
+	err = s.composer.Concater.AsConcatableUpload(upload).ConcatUploads(ctx, partialUploads)
+	return &pb.ConcatUploadsResponse{}, toStatus(err)
+}
+
+// chunkReader reads the data from the messages of a WriteChunk call. It
+// returns io.EOF once tusd has sent all data.
+type chunkReader struct {
+	stream pb.DataStore_WriteChunkServer
+	data   []byte
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for len(r.data) == 0 {
+		req, err := r.stream.Recv()
+		if err != nil {
+			return 0, err
+		}
+		r.data = req.Data
+	}
+
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
@@ -42,6 +42,34 @@ var (
 		"tusd_uploads_terminated",
 		"Number of terminated uploads.",
 		nil, nil)
+	uploadSizeDesc = prometheus.NewDesc(
+		"tusd_upload_size_bytes",
+		"Size of finished uploads in bytes.",
+		[]string{"store"}, nil)
+	uploadDurationDesc = prometheus.NewDesc(
+		"tusd_upload_duration_seconds",
+		"Wall-clock duration between creation and completion of finished uploads in seconds.",
+		[]string{"store"}, nil)
+	uploadThroughputDesc = prometheus.NewDesc(
+		"tusd_upload_throughput_bytes_per_second",
+		"Effective throughput of finished uploads in bytes per second.",
+		[]string{"store"}, nil)
+	uploadRetriesDesc = prometheus.NewDesc(
+		"tusd_upload_retries_total",
+		"Number of requests continuing an upload after an interrupted request.",
+		[]string{"store"}, nil)
+	extensionRequestsDesc = prometheus.NewDesc(
+		"tusd_extension_requests_total",
+		"Number of requests using a tus extension per extension.",
+		[]string{"extension"}, nil)
+	protocolVersionRequestsDesc = prometheus.NewDesc(
+		"tusd_protocol_version_requests_total",
+		"Number of requests per protocol version sent by the client.",
+		[]string{"version"}, nil)
+	clientRequestsDesc = prometheus.NewDesc(
+		"tusd_client_requests_total",
+		"Number of requests per client family derived from the User-Agent header.",
+		[]string{"client"}, nil)
 )
 
 type Collector struct {
@@ -62,6 +90,13 @@ func (Collector) Describe(descs chan<- *prometheus.Desc) {
 	descs <- uploadsCreatedDesc
 	descs <- uploadsFinishedDesc
 	descs <- uploadsTerminatedDesc
+	descs <- uploadSizeDesc
+	descs <- uploadDurationDesc
+	descs <- uploadThroughputDesc
+	descs <- uploadRetriesDesc
+	descs <- extensionRequestsDesc
+	descs <- protocolVersionRequestsDesc
+	descs <- clientRequestsDesc
 }
 
 func (c Collector) Collect(metrics chan<- prometheus.Metric) {
@@ -107,4 +142,41 @@ func (c Collector) Collect(metrics chan<- prometheus.Metric) {
 		prometheus.CounterValue,
 		float64(atomic.LoadUint64(c.metrics.UploadsTerminated)),
 	)
+
+	for desc, histogram := range map[*prometheus.Desc]*handler.Histogram{
+		uploadSizeDesc:       c.metrics.UploadSizes,
+		uploadDurationDesc:   c.metrics.UploadDurations,
+		uploadThroughputDesc: c.metrics.UploadThroughput,
+	} {
+		count, sum, buckets := histogram.Load()
+		metrics <- prometheus.MustNewConstHistogram(
+			desc,
+			count,
+			sum,
+			buckets,
+			c.metrics.Store,
+		)
+	}
+
+	metrics <- prometheus.MustNewConstMetric(
+		uploadRetriesDesc,
+		prometheus.CounterValue,
+		float64(atomic.LoadUint64(c.metrics.UploadRetries)),
+		c.metrics.Store,
+	)
+
+	for desc, counters := range map[*prometheus.Desc]*handler.CounterMap{
+		extensionRequestsDesc:       c.metrics.ExtensionsTotal,
+		protocolVersionRequestsDesc: c.metrics.ProtocolVersionsTotal,
+		clientRequestsDesc:          c.metrics.ClientsTotal,
+	} {
+		for label, value := range counters.Load() {
+			metrics <- prometheus.MustNewConstMetric(
+				desc,
+				prometheus.CounterValue,
+				float64(value),
+				label,
+			)
+		}
+	}
 }
@@ -6,6 +6,7 @@ import (
 
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
+	"github.com/tus/tusd/v2/pkg/handler"
 )
 
 const enableTestDebugOutput = false
@@ -170,3 +171,22 @@ func TestCalcOptimalPartSize_ExceedingMaxPartSize(t *testing.T) {
 	assert.NotNil(err)
 	assert.EqualError(err, fmt.Sprintf("calcOptimalPartSize: to upload %v bytes optimalPartSize %v must exceed MaxPartSize %v", size, optimalPartSize, store.MaxPartSize))
 }
+
+func TestPreferredChunkSize(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	s3obj := NewMockS3API(mockCtrl)
+	store := New("bucket", s3obj)
+
+	assert.Equal(store.PreferredPartSize, store.PreferredChunkSize(handler.FileInfo{Size: 100}))
+	assert.Equal(store.PreferredPartSize, store.PreferredChunkSize(handler.FileInfo{SizeIsDeferred: true}))
+
+	size := store.PreferredPartSize*store.MaxMultipartParts + 1
+	optimalPartSize, _ := store.calcOptimalPartSize(size)
+	assert.Equal(optimalPartSize, store.PreferredChunkSize(handler.FileInfo{Size: size}))
+
+	// Uploads which are too large have no preference
+	assert.Equal(int64(0), store.PreferredChunkSize(handler.FileInfo{Size: store.MaxPartSize*store.MaxMultipartParts + 1}))
+}
@@ -12,18 +12,29 @@
 //	s3:ListMultipartUploadParts
 //	s3:PutObject
 //
+// Listing unfinished uploads using ListUploads additionally requires the
+// s3:ListBucketMultipartUploads permission. For buckets with versioning enabled,
+// the s3:GetObjectVersion and s3:DeleteObjectVersion permissions are needed as well.
+//
 // While this package uses the official AWS SDK for Go, S3Store is able
 // to work with any S3-compatible service such as Riak CS. In order to change
 // the HTTP endpoint used for sending requests to, consult the AWS Go SDK
 // (http://docs.aws.amazon.com/sdk-for-go/api/aws/Config.html#WithEndpoint-instance_method).
 //
+// If the client's region does not match the bucket's region, S3 rejects
+// requests with a PermanentRedirect or AuthorizationHeaderMalformed error. In
+// this case, S3Store remembers the region named in the error and retries the
+// request in the bucket's region, so the client's region does not have to be
+// configured exactly.
+//
 // # Implementation
 //
 // Once a new tus upload is initiated, multiple objects in S3 are created:
 //
 // First of all, a new info object is stored which contains a JSON-encoded blob
 // of general information about the upload including its size and meta data.
-// This kind of objects have the suffix ".info" in their key.
+// This kind of objects have the suffix ".info" in their key. If a MetadataStore
+// is configured, the information is kept there instead.
 //
 // In addition a new multipart upload
 // (http://docs.aws.amazon.com/AmazonS3/latest/dev/uploadobjusingmpu.html) is
@@ -40,15 +51,96 @@
 // Therefore, HEAD responses will always contain the unchanged metadata, Base64-
 // encoded, even if it contains non-ASCII characters.
 //
+// S3 limits the size of the object metadata, to 2 KiB for AWS S3. Uploads whose
+// metadata exceeds S3Store.MaxObjectMetadataSize, if set, are rejected with
+// ErrMetadataTooLarge when they are created, instead of failing once the
+// object is written. With S3Store.MetadataOverflow, such uploads are accepted
+// and the complete metadata is only stored in the info object, while the final
+// object receives a subset of it.
+//
 // Once the upload is finished, the multipart upload is completed, resulting in
 // the entire file being stored in the bucket. The info object, containing
 // meta data is not deleted. It is recommended to copy the finished upload to
 // another bucket to avoid it being deleted by the Termination extension.
+// If the request for completing the multipart upload fails or times out, the
+// parts are listed again and compared to the uploaded ones before the completion
+// is retried. If the multipart upload does not exist anymore because a previous
+// attempt succeeded, the upload is considered finished.
+//
+// If S3Store.ObjectHeadersFromMetadata is enabled, the Cache-Control,
+// Content-Disposition and Content-Encoding headers of the final object are
+// derived from the upload's metadata when the multipart upload is created, so
+// that the object can be served directly from the bucket. A default value for
+// Cache-Control can be configured using S3Store.CacheControl.
+//
+// If S3Store.PointerObjectKey is set, a small JSON object naming the final
+// object is written under a key derived from the metadata once the upload is
+// finished, so that uploads can be found by readable names in the bucket.
+//
+// If S3Store.PreventOverwrite is enabled, creating an upload fails if the object
+// key is already in use. This is intended for setups where the pre-create hook
+// assigns upload IDs, for example based on the file name. The final object is
+// also checked for existence right before it is written.
+//
+// If the bucket has versioning enabled, the version ID of the final object is
+// recorded in the info object and exposed as "VersionId" in FileInfo.Storage.
+// Subsequent reads and terminations then operate on this exact version instead
+// of the latest version of the object key.
+//
+// If S3Store.SkipMultipartForSmallUploads is enabled, uploads with a known size
+// below MinPartSize do not use a multipart upload. Their data is collected in
+// the ".part" object until all bytes have been received and the final object
+// is then stored using a single PutObject request. Their upload ID ends in
+// "+none" instead of a multipart upload ID. If the entire file is contained
+// in the creation request, only the info object and the final object are written.
+//
+// If S3Store.StorageClass is set, the final objects are written directly to
+// this storage class, while the info and .part objects remain in the bucket's
+// default class. With GLACIER or DEEP_ARCHIVE, finished uploads cannot be read
+// until the object has been restored using S3's RestoreObject; GetReader and
+// PresignDownloadURL return ErrUploadArchived until then. Terminating such a
+// finished upload fails with ErrArchivedUploadTermination, while unfinished
+// uploads can still be terminated. Partial uploads for the concatenation
+// extension always use the default class, since they are read again.
+//
+// Downloads of finished uploads can be redirected to a pre-signed URL of the
+// final object using handler.Config.RedirectDownloads, so that the content is
+// not passed through tusd. This requires Service to be an instance of s3.Client.
+//
+// Similarly, the experimental handler.Config.EnableDirectPartUploads lets clients
+// upload the parts of the multipart upload directly to S3 using pre-signed
+// URLs. The parts are numbered by their offset and have the optimal part size
+// for the upload's size, except for the last one. Since the offset is computed
+// from the parts stored in S3, it reflects the size of all parts received so
+// far, even if they have been uploaded out of order. Uploads without a
+// multipart upload, see SkipMultipartForSmallUploads, do not support this.
+//
+// The optimal part size for an upload is advertised to clients as the preferred
+// chunk size, so that each PATCH request can be stored as a single part without
+// collecting data in the ".part" object.
 //
 // If an upload is about to being terminated, the multipart upload is aborted
 // which removes all of the uploaded parts from the bucket. In addition, the
 // info object is also deleted. If the upload has been finished already, the
 // finished object containing the entire upload is also removed.
+// The objects are removed using DeleteObjects requests of up to 1000 keys. The
+// number of concurrent delete requests across all terminations is limited by
+// SetConcurrentDeletes, so that cleaning up many uploads at once does not run
+// into S3's request rate limits. Objects whose deletion failed temporarily,
+// for example because S3 asked to slow down, are retried with a backoff.
+//
+// # Directory buckets
+//
+// Directory buckets of the S3 Express One Zone storage class, whose names end in
+// "--x-s3", can be used as well. They authenticate requests using short-lived
+// sessions instead of the client's credentials. Since the AWS SDK used by tusd
+// does not create these sessions on its own, the S3 client must be configured
+// with UseDirectoryBucketSessions. The parts of multipart uploads in directory
+// buckets must be numbered consecutively, which is the case for all uploads
+// created by tusd. When uploading parts directly using pre-signed URLs, clients
+// must upload all parts before the upload can be completed. Pre-signed URLs are
+// only valid until the session used for signing them expires, which is after
+// five minutes at the latest.
 //
 // # Considerations
 //
@@ -77,13 +169,13 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"os"
 	"regexp"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tus/tusd/v2/internal/bufferpool"
 	"github.com/tus/tusd/v2/internal/semaphore"
 	"github.com/tus/tusd/v2/internal/uid"
 	"github.com/tus/tusd/v2/pkg/handler"
@@ -99,6 +191,15 @@ import (
 // considered valid into a header value according to RFC2616.
 var nonPrintableRegexp = regexp.MustCompile(`[^\x09\x20-\x7E]`)
 
+// ErrSlowDown is returned if S3 asks to reduce the request rate, for example
+// because too many requests are sent for the same prefix. The request can be
+// retried after a short while.
+var ErrSlowDown = handler.NewError("ERR_STORE_SLOW_DOWN", "storage backend is throttling requests, please retry later", http.StatusServiceUnavailable)
+
+// ErrUploadExists is returned if PreventOverwrite is enabled and the object key
+// for an upload is already in use.
+var ErrUploadExists = handler.NewError("ERR_UPLOAD_EXISTS", "an upload with this ID already exists", http.StatusConflict)
+
 // See the handler.DataStore interface for documentation about the different
 // methods.
 type S3Store struct {
@@ -111,9 +212,39 @@ type S3Store struct {
 	// MetadataObjectPrefix is prepended to the name of each .info and .part S3
 	// object that is created. If it is not set, then ObjectPrefix is used.
 	MetadataObjectPrefix string
+	// PrefixShards distributes the objects of the uploads across this many
+	// prefixes below ObjectPrefix and MetadataObjectPrefix, e.g. 16 prefixes
+	// from "0/" to "f/", so that high creation rates do not exceed the request
+	// rate limits, which S3 applies per prefix. The shard of a new upload is
+	// derived from a hash of its ID and recorded in FileInfo.Storage["Shard"].
+	// Later operations use the recorded shard, so the number of shards can be
+	// changed while uploads exist if a MetadataStore is used. With .info
+	// objects, the info must be found before its shard is known, so it is
+	// looked up in the shard derived from the upload's ID and, if it does not
+	// exist there, without a shard. After changing the number of shards, only
+	// uploads created without sharding are therefore found. Values below 2
+	// disable sharding.
+	PrefixShards int
+	// MetadataStore, if set, keeps the FileInfo of uploads, for example in a
+	// database, instead of .info objects in the bucket. The info is stored
+	// under the upload's object ID. Changes to the info, such as declaring the
+	// length or setting the expiration, are applied atomically, so concurrent
+	// requests cannot overwrite each other's changes, as it can happen with
+	// .info objects.
+	MetadataStore handler.MetadataStore
+	// ConditionalInfoWrites, if true, replaces .info objects only if they have
+	// not changed since they were read, using If-Match with the object's ETag.
+	// If two requests for the same upload race, for example because the lock
+	// was not exclusive, the second write fails with ErrInfoConflict instead of
+	// silently discarding the changes of the first one. The S3 server must
+	// support conditional writes, as AWS S3 does. It has no effect if a
+	// MetadataStore is used.
+	ConditionalInfoWrites bool
 	// Service specifies an interface used to communicate with the S3 backend.
 	// Usually, this is an instance of github.com/aws/aws-sdk-go-v2/service/s3.Client
 	// (https://pkg.go.dev/github.com/aws/aws-sdk-go-v2/service/s3#Client).
+	// If an s3.Client is passed to New, it is wrapped, so that requests are
+	// sent to the bucket's region if it differs from the client's region.
 	Service S3API
 	// MaxPartSize specifies the maximum size of a single part uploaded to S3
 	// in bytes. This value must be bigger than MinPartSize! In order to
@@ -153,19 +284,130 @@ type S3Store struct {
 	// on disk during the upload. An empty string ("", the default value) will
 	// cause S3Store to use the operating system's default temporary directory.
 	TemporaryDirectory string
+	// MaxTemporaryBytes limits the total size of the temporary files, which
+	// are staged on disk while waiting to be uploaded to S3. If the limit is
+	// reached, reading further data from clients is paused until staged parts
+	// have been uploaded. This prevents the disk from running full if S3 is
+	// slower than the clients. A value of zero, the default, disables the limit.
+	MaxTemporaryBytes int64
+	// MaxTemporaryFiles limits the number of temporary files in the same way
+	// as MaxTemporaryBytes. A value of zero, the default, disables the limit.
+	MaxTemporaryFiles int64
 	// DisableContentHashes instructs the S3Store to not calculate the MD5 and SHA256
 	// hashes when uploading data to S3. These hashes are used for file integrity checks
 	// and for authentication. However, these hashes also consume a significant amount of
 	// CPU, so it might be desirable to disable them.
 	// Note that this property is experimental and might be removed in the future!
 	DisableContentHashes bool
+	// ChecksumAlgorithm selects the checksum, which the AWS SDK calculates for each
+	// part while sending it and transmits in a trailing header over HTTPS. S3
+	// verifies the checksum before storing the part. This avoids calculating the
+	// SHA256 hash of the part before it is sent and CRC32C in particular requires
+	// much less CPU. The multipart upload is created with the algorithm, so the
+	// checksums of the parts are recorded and passed to CompleteMultipartUpload,
+	// which lets S3 verify that the final object is assembled from the parts we
+	// uploaded. If empty, the default, the SHA256 hash is used for signing the
+	// requests instead, unless Compatibility.TrailingChecksums is set.
+	// DisableContentHashes has no effect on parts if an algorithm is selected.
+	ChecksumAlgorithm types.ChecksumAlgorithm
+	// SkipMultipartForSmallUploads instructs the S3Store to not create a multipart
+	// upload for uploads whose size is known and smaller than MinPartSize. Instead,
+	// the data is buffered in the incomplete part object until the upload is complete
+	// and then stored using a single PutObject request. If the entire file is sent
+	// in the creation request, this avoids the requests for creating, uploading
+	// and completing the multipart upload.
+	// Note that this property is experimental and might be removed in the future!
+	SkipMultipartForSmallUploads bool
+	// PreventOverwrite instructs the S3Store to not overwrite existing objects.
+	// This is useful if upload IDs are not generated by tusd, but assigned by the
+	// pre-create hook, for example to derive the object key from the file name.
+	// Creating an upload with an ID whose final or info object already exists fails
+	// with ErrUploadExists. In addition, the existence of the final object is checked
+	// again right before it is written, so that an upload created concurrently
+	// under the same ID cannot replace an object that has been finished meanwhile.
+	PreventOverwrite bool
+	// ObjectHeadersFromMetadata instructs the S3Store to set the Cache-Control,
+	// Content-Disposition and Content-Encoding headers of the final object from
+	// the "cache-control", "content-disposition" and "content-encoding" metadata
+	// keys. If no Content-Disposition is provided, but a "filename", the object is
+	// marked as an attachment with this file name. This allows finished uploads to
+	// be downloaded directly from the bucket.
+	ObjectHeadersFromMetadata bool
+	// CacheControl is used as the Cache-Control header of the final object, unless
+	// one is provided by the metadata. If empty, no header is set.
+	CacheControl string
+	// FilenamePolicy controls how the "filename" metadata is sanitized before it
+	// is used for the Content-Disposition header of the final object.
+	FilenamePolicy handler.FilenamePolicy
+	// StorageClass is the storage class of the final objects, e.g. GLACIER or
+	// DEEP_ARCHIVE for writing uploads directly to archival storage. The info
+	// and .part objects as well as partial uploads for concatenation are stored
+	// in the bucket's default class. If empty, the bucket's default class is
+	// used for all objects.
+	StorageClass types.StorageClass
+	// MaxObjectMetadataSize is the maximum size of the object metadata in bytes,
+	// counted as the sum of the lengths of all keys and values. AWS S3 accepts
+	// up to 2 KiB. Creating an upload with larger metadata fails with
+	// ErrMetadataTooLarge, unless MetadataOverflow is enabled. A value of zero
+	// disables the check, which is the default, so that such uploads keep
+	// failing only once the object is written.
+	MaxObjectMetadataSize int
+	// MetadataOverflow instructs the S3Store to accept uploads whose metadata
+	// exceeds MaxObjectMetadataSize. The complete metadata is kept in the info
+	// object, while the final object only receives as many keys as fit into the
+	// limit and the "tusd-metadata-truncated" key. Such uploads are marked with
+	// "MetadataTruncated" in FileInfo.Storage.
+	MetadataOverflow bool
+	// Compatibility adjusts the requests to the behavior of S3-compatible servers.
+	// Use one of the predefined profiles, such as CompatibilityMinIO, when not
+	// using AWS S3.
+	// Defaults to CompatibilityAWS.
+	Compatibility Compatibility
+	// ConcurrentDownloadRanges is the number of ranges of a finished object,
+	// which are fetched concurrently using ranged GetObject requests ahead of
+	// the client when downloading the upload through tusd. This improves the
+	// throughput if the latency to S3 is high. Up to ConcurrentDownloadRanges
+	// times DownloadRangeSize bytes are buffered in memory per download. A value
+	// of zero or one disables concurrent downloads.
+	ConcurrentDownloadRanges int
+	// DownloadRangeSize is the size of the ranges in bytes, which are fetched
+	// concurrently, see ConcurrentDownloadRanges.
+	DownloadRangeSize int64
+	// PointerObjectKey, if set, is the key below ObjectPrefix of a small JSON
+	// object, which is written once an upload is finished and names the bucket,
+	// key and version of the final object. This allows browsing the uploads by
+	// readable names, while the objects themselves keep their upload IDs. Each
+	// placeholder {{key}}, e.g. "by-name/{{user}}/{{filename}}", is replaced
+	// with the value of the metadata key of the same name, sanitized using
+	// FilenamePolicy. If a value is missing, no pointer object is written. A
+	// later upload with the same values replaces the pointer object, and it is
+	// not removed when the upload is terminated.
+	PointerObjectKey string
 
 	// uploadSemaphore limits the number of concurrent multipart part uploads to S3.
-	uploadSemaphore semaphore.Semaphore
+	uploadSemaphore *uploadLimiter
+
+	// adaptiveConcurrency adjusts the limit of uploadSemaphore, if enabled using
+	// SetAdaptiveConcurrentPartUploads.
+	adaptiveConcurrency *adaptiveConcurrency
+
+	// deleteSemaphore limits the number of concurrent delete requests to S3.
+	deleteSemaphore semaphore.Semaphore
 
 	// requestDurationMetric holds the prometheus instance for storing the request durations.
 	requestDurationMetric *prometheus.SummaryVec
 
+	// requestDurationHistogram also holds the request durations. Unlike the
+	// summary, its observations can carry exemplars with the trace ID.
+	requestDurationHistogram *prometheus.HistogramVec
+
+	// requestErrorsMetric holds the prometheus instance for counting failed requests
+	// per operation and error class.
+	requestErrorsMetric *prometheus.CounterVec
+
+	// temporaryFiles keeps track of the temporary files staged on disk.
+	temporaryFiles *temporaryFiles
+
 	// diskWriteDurationMetric holds the prometheus instance for storing the time it takes to write chunks to disk.
 	diskWriteDurationMetric prometheus.Summary
 
@@ -180,14 +422,21 @@ type S3Store struct {
 const (
 	metricGetInfoObject           = "get_info_object"
 	metricPutInfoObject           = "put_info_object"
+	metricPutObject               = "put_object"
+	metricPutPointerObject        = "put_pointer_object"
+	metricHeadObject              = "head_object"
 	metricCreateMultipartUpload   = "create_multipart_upload"
 	metricCompleteMultipartUpload = "complete_multipart_upload"
 	metricUploadPart              = "upload_part"
+	metricUploadPartCopy          = "upload_part_copy"
 	metricListParts               = "list_parts"
+	metricListMultipartUploads    = "list_multipart_uploads"
 	metricHeadPartObject          = "head_part_object"
 	metricGetPartObject           = "get_part_object"
 	metricPutPartObject           = "put_part_object"
 	metricDeletePartObject        = "delete_part_object"
+	metricDeleteObject            = "delete_object"
+	metricDeleteObjects           = "delete_objects"
 )
 
 type S3API interface {
@@ -202,6 +451,7 @@ type S3API interface {
 	DeleteObjects(ctx context.Context, input *s3.DeleteObjectsInput, opt ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error)
 	CompleteMultipartUpload(ctx context.Context, input *s3.CompleteMultipartUploadInput, opt ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error)
 	UploadPartCopy(ctx context.Context, input *s3.UploadPartCopyInput, opt ...func(*s3.Options)) (*s3.UploadPartCopyOutput, error)
+	ListMultipartUploads(ctx context.Context, input *s3.ListMultipartUploadsInput, opt ...func(*s3.Options)) (*s3.ListMultipartUploadsOutput, error)
 }
 
 // New constructs a new storage using the supplied bucket and service object.
@@ -212,6 +462,17 @@ func New(bucket string, service S3API) S3Store {
 		Objectives: map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001},
 	}, []string{"operation"})
 
+	requestDurationHistogram := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "tusd_s3_request_duration_seconds",
+		Help:    "Duration of requests sent to S3 in seconds per operation, with the trace ID as exemplar",
+		Buckets: []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"operation"})
+
+	requestErrorsMetric := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "tusd_s3_request_errors_total",
+		Help: "Number of failed requests sent to S3 per operation and error class",
+	}, []string{"operation", "class"})
+
 	diskWriteDurationMetric := prometheus.NewSummary(prometheus.SummaryOpts{
 		Name:       "tusd_s3_disk_write_duration_ms",
 		Help:       "Duration of chunk writes to disk in milliseconds",
@@ -237,23 +498,48 @@ func New(bucket string, service S3API) S3Store {
 		MaxMultipartParts:           10000,
 		MaxObjectSize:               5 * 1024 * 1024 * 1024 * 1024,
 		MaxBufferedParts:            20,
+		MaxObjectMetadataSize:       0,
+		DownloadRangeSize:           16 * 1024 * 1024,
 		TemporaryDirectory:          "",
+		temporaryFiles:              newTemporaryFiles(),
 		requestDurationMetric:       requestDurationMetric,
+		requestDurationHistogram:    requestDurationHistogram,
+		requestErrorsMetric:         requestErrorsMetric,
 		diskWriteDurationMetric:     diskWriteDurationMetric,
 		uploadSemaphoreDemandMetric: uploadSemaphoreDemandMetric,
 		uploadSemaphoreLimitMetric:  uploadSemaphoreLimitMetric,
 	}
 
+	// Discover the bucket's region if the client is configured for a different
+	// one. Directory buckets are excluded, since their sessions are bound to the
+	// client's region.
+	if _, ok := service.(*s3.Client); ok && !IsDirectoryBucket(bucket) {
+		store.Service = newRegionDiscoveryService(service)
+	}
+
 	store.SetConcurrentPartUploads(10)
+	store.SetConcurrentDeletes(4)
 	return store
 }
 
 // SetConcurrentPartUploads changes the limit on how many concurrent part uploads to S3 are allowed.
 func (store *S3Store) SetConcurrentPartUploads(limit int) {
-	store.uploadSemaphore = semaphore.New(limit)
+	store.uploadSemaphore = newUploadLimiter(limit)
+	store.adaptiveConcurrency = nil
 	store.uploadSemaphoreLimitMetric.Set(float64(limit))
 }
 
+// SetAdaptiveConcurrentPartUploads replaces the fixed limit on concurrent part
+// uploads with a limit between min and max, which is adjusted based on the
+// observed speed and errors of the part uploads. Starting at min, the limit is
+// raised while part uploads succeed at a steady speed and halved when they
+// fail or slow down, so that the throughput is maximized without tuning the
+// limit for each region or S3-compatible server.
+func (store *S3Store) SetAdaptiveConcurrentPartUploads(min, max int) {
+	store.adaptiveConcurrency = newAdaptiveConcurrency(min, max, store.uploadSemaphoreLimitMetric)
+	store.uploadSemaphore = store.adaptiveConcurrency.limiter
+}
+
 // UseIn sets this store as the core data store in the passed composer and adds
 // all possible extension to it.
 func (store S3Store) UseIn(composer *handler.StoreComposer) {
@@ -261,20 +547,50 @@ func (store S3Store) UseIn(composer *handler.StoreComposer) {
 	composer.UseTerminater(store)
 	composer.UseConcater(store)
 	composer.UseLengthDeferrer(store)
+	composer.UseLister(store)
+	composer.UsePresigner(store)
+	composer.UsePartPresigner(store)
+	composer.UseChunkSizeHinter(store)
+	composer.UseExpirer(store)
+	composer.UseInspector(store)
+	composer.UseImporter(store)
+	composer.UseIngester(store)
+	composer.UsePartialAppender(store)
+	composer.UseChecksumRecorder(store)
 }
 
 func (store S3Store) RegisterMetrics(registry prometheus.Registerer) {
 	registry.MustRegister(store.requestDurationMetric)
+	registry.MustRegister(store.requestDurationHistogram)
+	registry.MustRegister(store.requestErrorsMetric)
 	registry.MustRegister(store.diskWriteDurationMetric)
 	registry.MustRegister(store.uploadSemaphoreDemandMetric)
 	registry.MustRegister(store.uploadSemaphoreLimitMetric)
+	registry.MustRegister(store.temporaryFiles.bytesMetric)
+	registry.MustRegister(store.temporaryFiles.filesMetric)
 }
 
-func (store S3Store) observeRequestDuration(start time.Time, label string) {
+// observeRequest records the duration of a request to S3 and, if it failed,
+// the class of the error.
+func (store S3Store) observeRequest(ctx context.Context, start time.Time, label string, err error) {
+	store.observeRequestError(label, err)
+
 	elapsed := time.Since(start)
 	ms := float64(elapsed.Nanoseconds() / int64(time.Millisecond))
 
 	store.requestDurationMetric.WithLabelValues(label).Observe(ms)
+
+	observer := store.requestDurationHistogram.WithLabelValues(label)
+	// Link the observation to the trace of the request, if available, so that
+	// a latency spike can be traced back to the causing request.
+	if traceId := handler.TraceID(ctx); traceId != "" {
+		if exemplarObserver, ok := observer.(prometheus.ExemplarObserver); ok {
+			exemplarObserver.ObserveWithExemplar(elapsed.Seconds(), prometheus.Labels{"trace_id": traceId})
+			return
+		}
+	}
+
+	observer.Observe(elapsed.Seconds())
 }
 
 type s3Upload struct {
@@ -282,6 +598,10 @@ type s3Upload struct {
 	objectId string
 	// multipartId is the ID given by S3 to us for the multipart upload
 	multipartId string
+	// shard is the prefix below ObjectPrefix under which the upload's objects
+	// are stored, e.g. "0a/", or empty if they are not sharded. It is resolved
+	// from the upload's info, see resolveShard.
+	shard string
 
 	store *S3Store
 
@@ -294,13 +614,23 @@ type s3Upload struct {
 	parts []*s3Part
 	// incompletePartSize is the size of an incomplete part object, if one exists. It will be 0 if info is nil as well.
 	incompletePartSize int64
+	// infoETag is the ETag of the .info object as last read or written. It is
+	// used for conditional writes, see ConditionalInfoWrites.
+	infoETag string
 }
 
+// noMultipartId is used in place of the multipart ID for uploads which are
+// stored using a single PutObject request. See SkipMultipartForSmallUploads.
+const noMultipartId = "none"
+
 // s3Part represents a single part of a S3 multipart upload.
 type s3Part struct {
 	number int32
 	size   int64
 	etag   string
+	// checksum is the part's checksum using S3Store.ChecksumAlgorithm, if one
+	// is selected and S3 reported it.
+	checksum *string
 }
 
 func (store S3Store) NewUpload(ctx context.Context, info handler.FileInfo) (handler.Upload, error) {
@@ -309,50 +639,180 @@ func (store S3Store) NewUpload(ctx context.Context, info handler.FileInfo) (hand
 		return nil, fmt.Errorf("s3store: upload size of %v bytes exceeds MaxObjectSize of %v bytes", info.Size, store.MaxObjectSize)
 	}
 
+	metadataTruncated, err := store.checkMetadataSize(info.MetaData)
+	if err != nil {
+		return nil, err
+	}
+
 	var objectId string
 	if info.ID == "" {
 		objectId = uid.Uid()
 	} else {
 		// certain tests set info.ID in advance
 		objectId = info.ID
-	}
 
-	// Convert meta data into a map of pointers for AWS Go SDK, sigh.
-	metadata := make(map[string]string, len(info.MetaData))
-	for key, value := range info.MetaData {
-		metadata[key] = nonPrintableRegexp.ReplaceAllString(value, "?")
+		if store.PreventOverwrite {
+			if err := store.checkKeyAvailable(ctx, objectId); err != nil {
+				return nil, err
+			}
+		}
 	}
 
-	// Create the actual multipart upload
-	t := time.Now()
-	res, err := store.Service.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
-		Bucket:   aws.String(store.Bucket),
-		Key:      store.keyWithPrefix(objectId),
-		Metadata: metadata,
-	})
-	store.observeRequestDuration(t, metricCreateMultipartUpload)
-	if err != nil {
-		return nil, fmt.Errorf("s3store: unable to create multipart upload:\n%s", err)
+	var multipartId string
+	if store.usesSingleObject(info) {
+		multipartId = noMultipartId
+	} else {
+		// Create the actual multipart upload
+		headers := store.objectHeaders(info.MetaData)
+		sse := customerKeyFromContext(ctx)
+		t := time.Now()
+		res, err := store.Service.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+			Bucket:               aws.String(store.Bucket),
+			Key:                  store.keyWithPrefix(store.location(objectId)),
+			Metadata:             store.objectMetadata(info.MetaData),
+			CacheControl:         headers.CacheControl,
+			ContentDisposition:   headers.ContentDisposition,
+			ContentEncoding:      headers.ContentEncoding,
+			StorageClass:         store.storageClass(info),
+			ChecksumAlgorithm:    store.ChecksumAlgorithm,
+			SSECustomerAlgorithm: sse.algorithm,
+			SSECustomerKey:       sse.key,
+			SSECustomerKeyMD5:    sse.keyMD5,
+		})
+		store.observeRequest(ctx, t, metricCreateMultipartUpload, err)
+		if err != nil {
+			if converted := convertError(err); converted != err {
+				return nil, converted
+			}
+			return nil, fmt.Errorf("s3store: unable to create multipart upload:\n%s", err)
+		}
+
+		multipartId = *res.UploadId
 	}
 
-	multipartId := *res.UploadId
 	info.ID = objectId + "+" + multipartId
 
 	info.Storage = map[string]string{
 		"Type":   "s3store",
 		"Bucket": store.Bucket,
-		"Key":    *store.keyWithPrefix(objectId),
+		"Key":    *store.keyWithPrefix(store.location(objectId)),
+	}
+	if class := store.storageClass(info); class != "" {
+		info.Storage["StorageClass"] = string(class)
+	}
+	if metadataTruncated {
+		info.Storage["MetadataTruncated"] = "true"
+	}
+	if shard := store.shardOf(objectId); shard != "" {
+		info.Storage["Shard"] = strings.TrimSuffix(shard, "/")
 	}
 
-	upload := &s3Upload{objectId, multipartId, &store, nil, []*s3Part{}, 0}
+	upload := &s3Upload{objectId, multipartId, store.shardOf(objectId), &store, nil, []*s3Part{}, 0, ""}
 	err = upload.writeInfo(ctx, info)
 	if err != nil {
 		return nil, fmt.Errorf("s3store: unable to create info file:\n%s", err)
 	}
 
+	if err := store.waitForInfoObject(ctx, store.location(objectId)); err != nil {
+		return nil, err
+	}
+
 	return upload, nil
 }
 
+// objectHeaders contains the HTTP headers that are stored with the final object
+// and returned by S3 when the object is downloaded.
+type objectHeaders struct {
+	CacheControl       *string
+	ContentDisposition *string
+	ContentEncoding    *string
+}
+
+// objectHeaders determines the headers for the final object of an upload with
+// the given metadata. Since S3 only accepts ASCII characters in these headers,
+// non-printable characters are replaced, similar to objectMetadata. File names
+// are encoded according to RFC 5987 instead.
+func (store S3Store) objectHeaders(metaData handler.MetaData) (headers objectHeaders) {
+	header := func(value string) *string {
+		if value == "" {
+			return nil
+		}
+		return aws.String(nonPrintableRegexp.ReplaceAllString(value, "?"))
+	}
+
+	headers.CacheControl = header(store.CacheControl)
+	if !store.ObjectHeadersFromMetadata {
+		return headers
+	}
+
+	if cacheControl := header(metaData["cache-control"]); cacheControl != nil {
+		headers.CacheControl = cacheControl
+	}
+	headers.ContentEncoding = header(metaData["content-encoding"])
+	headers.ContentDisposition = header(metaData["content-disposition"])
+	if headers.ContentDisposition == nil {
+		if filename := store.FilenamePolicy.Sanitize(metaData["filename"]); filename != "" {
+			headers.ContentDisposition = aws.String(handler.ContentDisposition("attachment", filename))
+		}
+	}
+
+	return headers
+}
+
+// checkKeyAvailable returns ErrUploadExists if the final object or the info
+// object for the given object ID already exists.
+func (store S3Store) checkKeyAvailable(ctx context.Context, objectId string) error {
+	keys := []*string{store.keyWithPrefix(store.location(objectId))}
+	if store.MetadataStore != nil {
+		_, err := store.MetadataStore.GetInfo(ctx, objectId)
+		if err == nil {
+			return ErrUploadExists
+		}
+		if !errors.Is(err, handler.ErrNotFound) {
+			return err
+		}
+	} else {
+		keys = append(keys, store.metadataKeyWithPrefix(store.location(objectId)+".info"))
+	}
+
+	for _, key := range keys {
+		exists, err := store.keyExists(ctx, key)
+		if err != nil {
+			return convertError(err)
+		}
+		if exists {
+			return ErrUploadExists
+		}
+	}
+
+	return nil
+}
+
+// checkOverwrite returns ErrUploadExists if PreventOverwrite is enabled and the
+// final object already exists. It must be called before the final object is written.
+func (upload s3Upload) checkOverwrite(ctx context.Context) error {
+	store := upload.store
+	if !store.PreventOverwrite {
+		return nil
+	}
+
+	exists, err := store.objectExists(ctx, upload.location())
+	if err != nil {
+		return convertError(err)
+	}
+	if exists {
+		return ErrUploadExists
+	}
+
+	return nil
+}
+
+// usesSingleObject checks whether the upload can be stored using a single
+// PutObject request instead of a multipart upload.
+func (store S3Store) usesSingleObject(info handler.FileInfo) bool {
+	return store.SkipMultipartForSmallUploads && !info.SizeIsDeferred && !info.IsPartial && !info.IsFinal && info.Size < store.MinPartSize
+}
+
 func (store S3Store) GetUpload(ctx context.Context, id string) (handler.Upload, error) {
 	objectId, multipartId := splitIds(id)
 	if objectId == "" || multipartId == "" {
@@ -360,7 +820,69 @@ func (store S3Store) GetUpload(ctx context.Context, id string) (handler.Upload,
 		return nil, handler.ErrNotFound
 	}
 
-	return &s3Upload{objectId, multipartId, &store, nil, []*s3Part{}, 0}, nil
+	return &s3Upload{objectId, multipartId, store.shardOf(objectId), &store, nil, []*s3Part{}, 0, ""}, nil
+}
+
+// ListUploads returns the IDs of unfinished uploads by listing the multipart
+// uploads in the bucket whose key begins with ObjectPrefix. The cursor is the
+// last ID of the previous page. Uploads which are stored without a multipart
+// upload (see SkipMultipartForSmallUploads) are not included.
+func (store S3Store) ListUploads(ctx context.Context, cursor string) ([]string, string, error) {
+	_, ids, nextCursor, err := store.listMultipartUploads(ctx, cursor)
+	return ids, nextCursor, err
+}
+
+// listMultipartUploads returns a page of the multipart uploads in the bucket
+// whose key begins with ObjectPrefix, together with the IDs of their uploads.
+// See ListUploads for the cursor.
+func (store S3Store) listMultipartUploads(ctx context.Context, cursor string) ([]types.MultipartUpload, []string, string, error) {
+	prefix := *store.keyWithPrefix("")
+
+	input := &s3.ListMultipartUploadsInput{
+		Bucket: aws.String(store.Bucket),
+		Prefix: aws.String(prefix),
+	}
+
+	// Directory buckets only accept prefixes ending in a slash, which is the
+	// case for non-empty prefixes, and return an opaque marker for the next page.
+	isDirectoryBucket := IsDirectoryBucket(store.Bucket)
+	if isDirectoryBucket && prefix == "" {
+		input.Prefix = nil
+	}
+
+	if isDirectoryBucket {
+		if cursor != "" {
+			input.KeyMarker = aws.String(cursor)
+		}
+	} else if cursor != "" {
+		objectId, multipartId := splitIds(cursor)
+		input.KeyMarker = store.keyWithPrefix(store.location(objectId))
+		input.UploadIdMarker = aws.String(multipartId)
+	}
+
+	t := time.Now()
+	res, err := store.Service.ListMultipartUploads(ctx, input)
+	store.observeRequest(ctx, t, metricListMultipartUploads, err)
+	if err != nil {
+		return nil, nil, "", convertError(err)
+	}
+
+	ids := make([]string, 0, len(res.Uploads))
+	for _, upload := range res.Uploads {
+		objectId := store.objectIdFromKey(*upload.Key, prefix)
+		ids = append(ids, objectId+"+"+*upload.UploadId)
+	}
+
+	nextCursor := ""
+	if isDirectoryBucket {
+		if aws.ToBool(res.IsTruncated) {
+			nextCursor = aws.ToString(res.NextKeyMarker)
+		}
+	} else if aws.ToBool(res.IsTruncated) && len(ids) > 0 {
+		nextCursor = ids[len(ids)-1]
+	}
+
+	return res.Uploads, ids, nextCursor, nil
 }
 
 func (store S3Store) AsTerminatableUpload(upload handler.Upload) handler.TerminatableUpload {
@@ -375,11 +897,55 @@ func (store S3Store) AsConcatableUpload(upload handler.Upload) handler.Concatabl
 	return upload.(*s3Upload)
 }
 
+func (store S3Store) AsPresignableUpload(upload handler.Upload) handler.PresignableUpload {
+	return upload.(*s3Upload)
+}
+
+func (store S3Store) AsPartPresignableUpload(upload handler.Upload) handler.PartPresignableUpload {
+	return upload.(*s3Upload)
+}
+
+func (store S3Store) AsExpirableUpload(upload handler.Upload) handler.ExpirableUpload {
+	return upload.(*s3Upload)
+}
+
+func (store S3Store) AsInspectableUpload(upload handler.Upload) handler.InspectableUpload {
+	return upload.(*s3Upload)
+}
+
+func (store S3Store) AsPartialAppendableUpload(upload handler.Upload) handler.PartialAppendableUpload {
+	return upload.(*s3Upload)
+}
+
+func (store S3Store) AsChecksumRecordableUpload(upload handler.Upload) handler.ChecksumRecordableUpload {
+	return upload.(*s3Upload)
+}
+
+// PreferredChunkSize returns the size of the parts into which the upload is
+// split, so that every PATCH request results in exactly one part. For uploads
+// with a deferred length, the PreferredPartSize is used.
+func (store S3Store) PreferredChunkSize(info handler.FileInfo) int64 {
+	if info.SizeIsDeferred {
+		return store.PreferredPartSize
+	}
+
+	partSize, err := store.calcOptimalPartSize(info.Size)
+	if err != nil {
+		return 0
+	}
+
+	return partSize
+}
+
 func (upload *s3Upload) writeInfo(ctx context.Context, info handler.FileInfo) error {
 	store := upload.store
 
 	upload.info = &info
 
+	if store.MetadataStore != nil {
+		return store.MetadataStore.PutInfo(ctx, upload.objectId, info)
+	}
+
 	infoJson, err := json.Marshal(info)
 	if err != nil {
 		return err
@@ -387,39 +953,55 @@ func (upload *s3Upload) writeInfo(ctx context.Context, info handler.FileInfo) er
 
 	// Create object on S3 containing information about the file
 	t := time.Now()
-	_, err = store.Service.PutObject(ctx, &s3.PutObjectInput{
+	res, err := store.Service.PutObject(ctx, &s3.PutObjectInput{
 		Bucket:        aws.String(store.Bucket),
-		Key:           store.metadataKeyWithPrefix(upload.objectId + ".info"),
+		Key:           store.metadataKeyWithPrefix(upload.location() + ".info"),
 		Body:          bytes.NewReader(infoJson),
-		ContentLength: int64(len(infoJson)),
-	})
-	store.observeRequestDuration(t, metricPutInfoObject)
+		ContentLength: aws.Int64(int64(len(infoJson))),
+	}, upload.infoWriteOptions()...)
+	store.observeRequest(ctx, t, metricPutInfoObject, err)
+	if err != nil {
+		if store.ConditionalInfoWrites && isInfoConflict(err) {
+			upload.info = nil
+			upload.infoETag = ""
+			return ErrInfoConflict
+		}
+		return err
+	}
 
-	return err
+	if res != nil {
+		upload.infoETag = aws.ToString(res.ETag)
+	}
+
+	return nil
 }
 
 func (upload *s3Upload) WriteChunk(ctx context.Context, offset int64, src io.Reader) (int64, error) {
 	store := upload.store
 
+	if upload.multipartId == noMultipartId {
+		return upload.writeSingleObjectChunk(ctx, offset, src)
+	}
+
 	// Get the total size of the current upload, number of parts to generate next number and whether
 	// an incomplete part exists
 	_, _, incompletePartSize, err := upload.getInternalInfo(ctx)
 	if err != nil {
-		return 0, err
+		return 0, convertError(err)
 	}
 
 	if incompletePartSize > 0 {
-		incompletePartFile, err := store.downloadIncompletePartForUpload(ctx, upload.objectId)
+		incompletePartFile, err := store.downloadIncompletePartForUpload(ctx, upload.location())
 		if err != nil {
-			return 0, err
+			return 0, convertError(err)
 		}
 		if incompletePartFile == nil {
 			return 0, fmt.Errorf("s3store: Expected an incomplete part file but did not get any")
 		}
-		defer cleanUpTempFile(incompletePartFile)
+		defer incompletePartFile.remove()
 
-		if err := store.deleteIncompletePartForUpload(ctx, upload.objectId); err != nil {
-			return 0, err
+		if err := store.deleteIncompletePartForUpload(ctx, upload.location()); err != nil {
+			return 0, convertError(err)
 		}
 
 		// Prepend an incomplete part, if necessary and adapt the offset
@@ -438,11 +1020,97 @@ func (upload *s3Upload) WriteChunk(ctx context.Context, offset int64, src io.Rea
 
 	upload.info.Offset += bytesUploaded
 
-	return bytesUploaded, err
+	return bytesUploaded, convertError(err)
+}
+
+// writeSingleObjectChunk appends the data to the incomplete part object. Once
+// all data has been received, the upload is stored using a single PutObject
+// request and the incomplete part is removed.
+func (upload *s3Upload) writeSingleObjectChunk(ctx context.Context, offset int64, src io.Reader) (int64, error) {
+	store := upload.store
+
+	info, _, incompletePartSize, err := upload.getInternalInfo(ctx)
+	if err != nil {
+		return 0, convertError(err)
+	}
+
+	// The upload is smaller than MinPartSize, so it can be buffered in memory.
+	buf := new(bytes.Buffer)
+	if incompletePartSize > 0 {
+		incompletePart, err := store.getIncompletePartForUpload(ctx, upload.location())
+		if err != nil {
+			return 0, convertError(err)
+		}
+		if incompletePart == nil {
+			return 0, fmt.Errorf("s3store: Expected an incomplete part file but did not get any")
+		}
+		_, err = io.Copy(buf, incompletePart.Body)
+		incompletePart.Body.Close()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	// Data that has been read before an error occurred is still saved, so that
+	// the client can resume the upload from there.
+	bytesReceived, readErr := io.Copy(buf, io.LimitReader(src, info.Size-offset))
+	if bytesReceived == 0 {
+		return 0, readErr
+	}
+
+	if int64(buf.Len()) == info.Size {
+		if err := upload.checkOverwrite(ctx); err != nil {
+			return 0, err
+		}
+
+		headers := store.objectHeaders(info.MetaData)
+		sse := customerKeyFromContext(ctx)
+		t := time.Now()
+		res, err := store.Service.PutObject(ctx, &s3.PutObjectInput{
+			Bucket:               aws.String(store.Bucket),
+			Key:                  store.keyWithPrefix(upload.location()),
+			Body:                 bytes.NewReader(buf.Bytes()),
+			ContentLength:        aws.Int64(int64(buf.Len())),
+			ChecksumAlgorithm:    store.ChecksumAlgorithm,
+			Metadata:             store.objectMetadata(info.MetaData),
+			CacheControl:         headers.CacheControl,
+			ContentDisposition:   headers.ContentDisposition,
+			ContentEncoding:      headers.ContentEncoding,
+			StorageClass:         store.storageClass(info),
+			SSECustomerAlgorithm: sse.algorithm,
+			SSECustomerKey:       sse.key,
+			SSECustomerKeyMD5:    sse.keyMD5,
+		})
+		store.observeRequest(ctx, t, metricPutObject, err)
+		if err != nil {
+			return 0, convertError(err)
+		}
+
+		if err := upload.recordVersionId(ctx, res.VersionId); err != nil {
+			return 0, convertError(err)
+		}
+
+		if incompletePartSize > 0 {
+			if err := store.deleteIncompletePartForUpload(ctx, upload.location()); err != nil {
+				return 0, convertError(err)
+			}
+		}
+		upload.incompletePartSize = 0
+	} else {
+		if err := store.putIncompletePartForUpload(ctx, upload.location(), bytes.NewReader(buf.Bytes())); err != nil {
+			return 0, convertError(err)
+		}
+		upload.incompletePartSize = int64(buf.Len())
+	}
+
+	upload.info.Offset += bytesReceived
+
+	return bytesReceived, readErr
 }
 
 func (upload *s3Upload) uploadParts(ctx context.Context, offset int64, src io.Reader) (int64, error) {
 	store := upload.store
+	sse := customerKeyFromContext(ctx)
 
 	// Get the total size of the current upload and number of parts to generate next number
 	info, parts, _, err := upload.getInternalInfo(ctx)
@@ -461,8 +1129,16 @@ func (upload *s3Upload) uploadParts(ctx context.Context, offset int64, src io.Re
 	nextPartNum := int32(numParts + 1)
 
 	partProducer, fileChan := newS3PartProducer(src, store.MaxBufferedParts, store.TemporaryDirectory, store.diskWriteDurationMetric)
+	partProducer.temporaryFiles = store.temporaryFiles
+	partProducer.maxTemporaryBytes = store.MaxTemporaryBytes
+	partProducer.maxTemporaryFiles = store.MaxTemporaryFiles
 
-	producerCtx, cancelProducer := context.WithCancel(ctx)
+	// Parts are staged and uploaded until the body has been read, even if the
+	// client disconnects, so that all received data is saved.
+	partCtx, cancelParts := partUploadContext(ctx)
+	defer cancelParts()
+
+	producerCtx, cancelProducer := context.WithCancel(partCtx)
 	defer func() {
 		cancelProducer()
 		partProducer.closeUnreadFiles()
@@ -470,14 +1146,29 @@ func (upload *s3Upload) uploadParts(ctx context.Context, offset int64, src io.Re
 	go partProducer.produce(producerCtx, optimalPartSize)
 
 	var wg sync.WaitGroup
+	var uploadErrLock sync.Mutex
 	var uploadErr error
+	setUploadErr := func(err error) {
+		uploadErrLock.Lock()
+		defer uploadErrLock.Unlock()
+		if uploadErr == nil {
+			uploadErr = err
+		}
+	}
+
+	// chunks holds the chunks in the order in which they were read from src.
+	// Their uploaded field is only accessed after wg.Wait returns.
+	var chunks []*uploadChunk
+
+	// Waiting part uploads of uploads with a higher priority are started first.
+	priority := handler.UploadPriority(ctx)
 
 	for {
 		// We acquire the semaphore before starting the goroutine to avoid
 		// starting many goroutines, most of which are just waiting for the lock.
 		// We also acquire the semaphore before reading from the channel to reduce
 		// the number of part files are laying around on disk without being used.
-		upload.store.acquireUploadSemaphore()
+		upload.store.acquireUploadSemaphore(priority)
 		fileChunk, more := <-fileChan
 		if !more {
 			upload.store.releaseUploadSemaphore()
@@ -488,6 +1179,9 @@ func (upload *s3Upload) uploadParts(ctx context.Context, offset int64, src io.Re
 		partsize := fileChunk.size
 		closePart := fileChunk.closeReader
 
+		chunk := &uploadChunk{size: partsize}
+		chunks = append(chunks, chunk)
+
 		isFinalChunk := !info.SizeIsDeferred && (size == offset+bytesUploaded+partsize)
 		if partsize >= store.MinPartSize || isFinalChunk {
 			part := &s3Part{
@@ -504,20 +1198,26 @@ func (upload *s3Upload) uploadParts(ctx context.Context, offset int64, src io.Re
 
 				t := time.Now()
 				uploadPartInput := &s3.UploadPartInput{
-					Bucket:     aws.String(store.Bucket),
-					Key:        store.keyWithPrefix(upload.objectId),
-					UploadId:   aws.String(upload.multipartId),
-					PartNumber: part.number,
+					Bucket:               aws.String(store.Bucket),
+					Key:                  store.keyWithPrefix(upload.location()),
+					UploadId:             aws.String(upload.multipartId),
+					PartNumber:           aws.Int32(part.number),
+					SSECustomerAlgorithm: sse.algorithm,
+					SSECustomerKey:       sse.key,
+					SSECustomerKeyMD5:    sse.keyMD5,
 				}
-				etag, err := upload.putPartForUpload(ctx, uploadPartInput, file, part.size)
-				store.observeRequestDuration(t, metricUploadPart)
+				etag, checksum, err := upload.putPartForUpload(partCtx, uploadPartInput, file, part.size)
+				store.observeRequest(ctx, t, metricUploadPart, err)
+				store.observePartUpload(t, part.size, part.size == optimalPartSize, err)
 				if err != nil {
-					uploadErr = err
+					setUploadErr(err)
 				} else {
 					part.etag = etag
+					part.checksum = checksum
+					chunk.uploaded = true
 				}
-				if cerr := closePart(); cerr != nil && uploadErr == nil {
-					uploadErr = cerr
+				if cerr := closePart(); cerr != nil {
+					setUploadErr(cerr)
 				}
 			}(partfile, part, closePart)
 		} else {
@@ -526,11 +1226,13 @@ func (upload *s3Upload) uploadParts(ctx context.Context, offset int64, src io.Re
 				defer upload.store.releaseUploadSemaphore()
 				defer wg.Done()
 
-				if err := store.putIncompletePartForUpload(ctx, upload.objectId, file); err != nil {
-					uploadErr = err
+				if err := store.putIncompletePartForUpload(partCtx, upload.location(), file); err != nil {
+					setUploadErr(err)
+				} else {
+					chunk.uploaded = true
 				}
-				if cerr := closePart(); cerr != nil && uploadErr == nil {
-					uploadErr = cerr
+				if cerr := closePart(); cerr != nil {
+					setUploadErr(cerr)
 				}
 				upload.incompletePartSize = partsize
 			}(partfile, closePart)
@@ -543,73 +1245,90 @@ func (upload *s3Upload) uploadParts(ctx context.Context, offset int64, src io.Re
 	wg.Wait()
 
 	if uploadErr != nil {
-		return 0, uploadErr
+		// The client has to resume the upload from the first chunk which could
+		// not be uploaded, so only the chunks before it are reported.
+		return uploadedBytes(chunks), uploadErr
 	}
 
 	return bytesUploaded, partProducer.err
 }
 
-func cleanUpTempFile(file *os.File) {
-	file.Close()
-	os.Remove(file.Name())
+// uploadChunk is a chunk read from the request body, which is uploaded as a
+// part or as the incomplete part.
+type uploadChunk struct {
+	size     int64
+	uploaded bool
+}
+
+// uploadedBytes returns the number of bytes in the chunks up to the first
+// chunk which has not been uploaded.
+func uploadedBytes(chunks []*uploadChunk) int64 {
+	n := int64(0)
+	for _, chunk := range chunks {
+		if !chunk.uploaded {
+			break
+		}
+		n += chunk.size
+	}
+	return n
 }
 
-func (upload *s3Upload) putPartForUpload(ctx context.Context, uploadPartInput *s3.UploadPartInput, file io.ReadSeeker, size int64) (string, error) {
-	if !upload.store.DisableContentHashes {
+func (upload *s3Upload) putPartForUpload(ctx context.Context, uploadPartInput *s3.UploadPartInput, file io.ReadSeeker, size int64) (string, *string, error) {
+	if !upload.store.DisableContentHashes || upload.store.ChecksumAlgorithm != "" {
 		// By default, use the traditional approach to upload data
 		uploadPartInput.Body = file
+		uploadPartInput.ChecksumAlgorithm = upload.store.checksumAlgorithm()
 		res, err := upload.store.Service.UploadPart(ctx, uploadPartInput)
 		if err != nil {
-			return "", err
+			return "", nil, err
 		}
-		return *res.ETag, nil
+		return *res.ETag, selectChecksum(upload.store.ChecksumAlgorithm, res.ChecksumCRC32, res.ChecksumCRC32C, res.ChecksumSHA1, res.ChecksumSHA256), nil
 	} else {
 		// Experimental feature to prevent the AWS SDK from calculating the SHA256 hash
 		// for the parts we upload to S3.
 		// We compute the presigned URL without the body attached and then send the request
 		// on our own. This way, the body is not included in the SHA256 calculation.
-		s3Client, ok := upload.store.Service.(*s3.Client)
-		if !ok {
-			return "", fmt.Errorf("s3store: failed to cast S3 service for presigning")
+		presignClient, err := upload.store.newPresignClient()
+		if err != nil {
+			return "", nil, err
 		}
 
-		presignClient := s3.NewPresignClient(s3Client)
-
 		s3Req, err := presignClient.PresignUploadPart(ctx, uploadPartInput, func(opts *s3.PresignOptions) {
 			opts.Expires = 15 * time.Minute
 		})
 		if err != nil {
-			return "", fmt.Errorf("s3store: failed to presign UploadPart: %s", err)
+			return "", nil, fmt.Errorf("s3store: failed to presign UploadPart: %s", err)
 		}
 
 		req, err := http.NewRequest("PUT", s3Req.URL, file)
 		if err != nil {
-			return "", err
+			return "", nil, err
 		}
 
 		// Set the Content-Length manually to prevent the usage of Transfer-Encoding: chunked,
 		// which is not supported by AWS S3.
 		req.ContentLength = size
+		customerKeyFromContext(ctx).setHeaders(req.Header)
 
 		res, err := http.DefaultClient.Do(req)
 		if err != nil {
-			return "", err
+			return "", nil, err
 		}
 		defer res.Body.Close()
 
 		if res.StatusCode != 200 {
 			buf := new(strings.Builder)
 			io.Copy(buf, res.Body)
-			return "", fmt.Errorf("s3store: unexpected response code %d for presigned upload: %s", res.StatusCode, buf.String())
+			return "", nil, fmt.Errorf("s3store: unexpected response code %d for presigned upload: %s", res.StatusCode, buf.String())
 		}
 
-		return res.Header.Get("ETag"), nil
+		return res.Header.Get("ETag"), nil, nil
 	}
 }
 
 func (upload *s3Upload) GetInfo(ctx context.Context) (info handler.FileInfo, err error) {
 	info, _, _, err = upload.getInternalInfo(ctx)
-	return info, err
+	return info, convertError(err)
 }
 
 func (upload *s3Upload) getInternalInfo(ctx context.Context) (info handler.FileInfo, parts []*s3Part, incompletePartSize int64, err error) {
@@ -617,7 +1336,12 @@ func (upload *s3Upload) getInternalInfo(ctx context.Context) (info handler.FileI
 		return *upload.info, upload.parts, upload.incompletePartSize, nil
 	}
 
-	info, parts, incompletePartSize, err = upload.fetchInfo(ctx)
+	info, parts, incompletePartSize, infoETag, err := upload.fetchInfo(ctx)
+	if upload.resolveShard(info, err) {
+		// The upload's objects are stored under a different shard than the one
+		// derived from its ID, so they are fetched again from there.
+		info, parts, incompletePartSize, infoETag, err = upload.fetchInfo(ctx)
+	}
 	if err != nil {
 		return info, parts, incompletePartSize, err
 	}
@@ -625,10 +1349,11 @@ func (upload *s3Upload) getInternalInfo(ctx context.Context) (info handler.FileI
 	upload.info = &info
 	upload.parts = parts
 	upload.incompletePartSize = incompletePartSize
+	upload.infoETag = infoETag
 	return info, parts, incompletePartSize, nil
 }
 
-func (upload s3Upload) fetchInfo(ctx context.Context) (info handler.FileInfo, parts []*s3Part, incompletePartSize int64, err error) {
+func (upload s3Upload) fetchInfo(ctx context.Context) (info handler.FileInfo, parts []*s3Part, incompletePartSize int64, infoETag string, err error) {
 	store := upload.store
 
 	var wg sync.WaitGroup
@@ -639,35 +1364,33 @@ func (upload s3Upload) fetchInfo(ctx context.Context) (info handler.FileInfo, pa
 	var infoErr error
 	var partsErr error
 	var incompletePartSizeErr error
+	var objectExists bool
 
 	go func() {
 		defer wg.Done()
-		t := time.Now()
 
 		// Get file info stored in separate object
-		var res *s3.GetObjectOutput
-		res, infoErr = store.Service.GetObject(ctx, &s3.GetObjectInput{
-			Bucket: aws.String(store.Bucket),
-			Key:    store.metadataKeyWithPrefix(upload.objectId + ".info"),
-		})
-		store.observeRequestDuration(t, metricGetInfoObject)
-		if infoErr == nil {
-			infoErr = json.NewDecoder(res.Body).Decode(&info)
-		}
+		info, infoETag, infoErr = store.readInfoObject(ctx, upload.objectId, upload.location())
 	}()
 
 	go func() {
 		defer wg.Done()
 
+		if upload.multipartId == noMultipartId {
+			// Without a multipart upload, the upload is finished once the object exists
+			objectExists, partsErr = store.objectExists(ctx, upload.location())
+			return
+		}
+
 		// Get uploaded parts and their offset
-		parts, partsErr = store.listAllParts(ctx, upload.objectId, upload.multipartId)
+		parts, partsErr = store.listAllParts(ctx, upload.location(), upload.multipartId)
 	}()
 
 	go func() {
 		defer wg.Done()
 
 		// Get size of optional incomplete part file.
-		incompletePartSize, incompletePartSizeErr = store.headIncompletePartForUpload(ctx, upload.objectId)
+		incompletePartSize, incompletePartSizeErr = store.headIncompletePartForUpload(ctx, upload.location())
 	}()
 
 	wg.Wait()
@@ -706,6 +1429,11 @@ func (upload s3Upload) fetchInfo(ctx context.Context) (info handler.FileInfo, pa
 		return
 	}
 
+	if objectExists {
+		info.Offset = info.Size
+		return info, nil, 0, infoETag, nil
+	}
+
 	// The offset is the sum of all part sizes and the size of the incomplete part file.
 	offset := incompletePartSize
 	for _, part := range parts {
@@ -714,36 +1442,232 @@ func (upload s3Upload) fetchInfo(ctx context.Context) (info handler.FileInfo, pa
 
 	info.Offset = offset
 
-	return info, parts, incompletePartSize, nil
+	return info, parts, incompletePartSize, infoETag, nil
 }
 
-func (upload s3Upload) GetReader(ctx context.Context) (io.ReadCloser, error) {
-	store := upload.store
+// readInfoObject returns the info of the upload and the ETag of its .info
+// object, which is stored at the given location. The ETag is empty if a
+// MetadataStore is used.
+func (store S3Store) readInfoObject(ctx context.Context, objectId string, location string) (info handler.FileInfo, etag string, err error) {
+	if store.MetadataStore != nil {
+		info, err = store.MetadataStore.GetInfo(ctx, objectId)
+		return info, "", err
+	}
 
-	// Attempt to get upload content
+	t := time.Now()
 	res, err := store.Service.GetObject(ctx, &s3.GetObjectInput{
 		Bucket: aws.String(store.Bucket),
-		Key:    store.keyWithPrefix(upload.objectId),
+		Key:    store.metadataKeyWithPrefix(location + ".info"),
+	})
+	store.observeRequest(ctx, t, metricGetInfoObject, err)
+	if err != nil {
+		return info, "", err
+	}
+
+	err = json.NewDecoder(res.Body).Decode(&info)
+	return info, aws.ToString(res.ETag), err
+}
+
+// recordVersionId stores the version of the final object in the upload's
+// storage details, if the bucket has versioning enabled. GetReader and Terminate
+// then access this version instead of the latest one. Since the Storage map is
+// shared with the FileInfo returned by GetInfo, the version is also visible to
+// hooks which are emitted once the upload is finished.
+func (upload *s3Upload) recordVersionId(ctx context.Context, versionId *string) error {
+	if versionId == nil || *versionId == "" || upload.info == nil {
+		return nil
+	}
+
+	info := *upload.info
+	if info.Storage == nil {
+		info.Storage = make(map[string]string)
+	}
+	info.Storage["VersionId"] = *versionId
+
+	return upload.writeInfo(ctx, info)
+}
+
+// cachedVersionId returns the version of the final object, if the upload's
+// info has already been fetched and contains a version.
+func (upload s3Upload) cachedVersionId() *string {
+	if upload.info == nil || upload.info.Storage["VersionId"] == "" {
+		return nil
+	}
+
+	return aws.String(upload.info.Storage["VersionId"])
+}
+
+// PresignDownloadURL returns a pre-signed URL for downloading the final object,
+// or for retrieving its headers if options.Method is HEAD. Presigning requires
+// that Service is an instance of s3.Client.
+func (upload s3Upload) PresignDownloadURL(ctx context.Context, options handler.PresignOptions) (string, error) {
+	store := upload.store
+
+	// Archived objects can only be downloaded once they have been restored.
+	if err := upload.checkRestored(ctx); err != nil {
+		return "", err
+	}
+
+	presignClient, err := store.newPresignClient()
+	if err != nil {
+		return "", err
+	}
+
+	if options.Method == http.MethodHead {
+		req, err := presignClient.PresignHeadObject(ctx, &s3.HeadObjectInput{
+			Bucket:    aws.String(store.Bucket),
+			Key:       store.keyWithPrefix(upload.location()),
+			VersionId: upload.cachedVersionId(),
+		}, func(opts *s3.PresignOptions) {
+			opts.Expires = options.Expiry
+		})
+		if err != nil {
+			return "", fmt.Errorf("s3store: failed to presign HeadObject: %s", err)
+		}
+
+		return req.URL, nil
+	}
+
+	input := &s3.GetObjectInput{
+		Bucket:    aws.String(store.Bucket),
+		Key:       store.keyWithPrefix(upload.location()),
+		VersionId: upload.cachedVersionId(),
+	}
+	if options.ContentType != "" {
+		input.ResponseContentType = aws.String(options.ContentType)
+	}
+	if options.ContentDisposition != "" {
+		input.ResponseContentDisposition = aws.String(options.ContentDisposition)
+	}
+
+	req, err := presignClient.PresignGetObject(ctx, input, func(opts *s3.PresignOptions) {
+		opts.Expires = options.Expiry
 	})
+	if err != nil {
+		return "", fmt.Errorf("s3store: failed to presign GetObject: %s", err)
+	}
+
+	return req.URL, nil
+}
+
+// PresignPart returns a pre-signed URL for uploading the part starting at the
+// given offset directly to the multipart upload. All parts, except for the last
+// one, have the optimal part size for the upload's size, so that the part number
+// can be derived from the offset. Presigning requires that Service is an
+// instance of s3.Client.
+func (upload *s3Upload) PresignPart(ctx context.Context, offset int64, expiry time.Duration) (string, int64, error) {
+	store := upload.store
+
+	// Uploads stored using a single PutObject request have no parts
+	if upload.multipartId == noMultipartId {
+		return "", 0, handler.ErrNotImplemented
+	}
+
+	info, err := upload.GetInfo(ctx)
+	if err != nil {
+		return "", 0, err
+	}
+
+	partSize, err := store.calcOptimalPartSize(info.Size)
+	if err != nil {
+		return "", 0, err
+	}
+
+	if offset%partSize != 0 {
+		return "", 0, handler.ErrInvalidPartOffset
+	}
+
+	length := info.Size - offset
+	if length > partSize {
+		length = partSize
+	}
+
+	presignClient, err := store.newPresignClient()
+	if err != nil {
+		return "", 0, err
+	}
+
+	req, err := presignClient.PresignUploadPart(ctx, &s3.UploadPartInput{
+		Bucket:        aws.String(store.Bucket),
+		Key:           store.keyWithPrefix(upload.location()),
+		UploadId:      aws.String(upload.multipartId),
+		PartNumber:    aws.Int32(int32(offset/partSize) + 1),
+		ContentLength: aws.Int64(length),
+	}, func(opts *s3.PresignOptions) {
+		opts.Expires = expiry
+	})
+	if err != nil {
+		return "", 0, fmt.Errorf("s3store: failed to presign UploadPart: %s", err)
+	}
+
+	return req.URL, length, nil
+}
+
+func (upload s3Upload) GetReader(ctx context.Context) (io.ReadCloser, error) {
+	store := upload.store
+
+	// Attempt to get upload content. The handler fetches the upload's info
+	// before reading it, so the version is known for versioned buckets.
+	sse := customerKeyFromContext(ctx)
+	input := s3.GetObjectInput{
+		Bucket:               aws.String(store.Bucket),
+		Key:                  store.keyWithPrefix(upload.location()),
+		VersionId:            upload.cachedVersionId(),
+		SSECustomerAlgorithm: sse.algorithm,
+		SSECustomerKey:       sse.key,
+		SSECustomerKeyMD5:    sse.keyMD5,
+	}
+	parallel := store.ConcurrentDownloadRanges > 1 && store.DownloadRangeSize > 0
+	if parallel {
+		// Only request the first range, so that the remaining ones can be
+		// fetched concurrently once the object's size is known.
+		input.Range = aws.String(fmt.Sprintf("bytes=0-%d", store.DownloadRangeSize-1))
+	}
+	res, err := store.Service.GetObject(ctx, &input)
+	if parallel && isAwsErrorCode(err, "InvalidRange") {
+		// Empty objects cannot be requested using a range.
+		input.Range = nil
+		res, err = store.Service.GetObject(ctx, &input)
+	}
 	if err == nil {
 		// No error occurred, and we are able to stream the object
+		if parallel {
+			input.Range = nil
+			if size, ok := objectSizeFromContentRange(res.ContentRange); ok && size > store.DownloadRangeSize {
+				return store.newParallelReader(ctx, input, res, size), nil
+			}
+		}
 		return res.Body, nil
 	}
 
+	// Objects in archival storage classes must be restored before reading.
+	if isAwsErrorCode(err, "InvalidObjectState") {
+		return nil, ErrUploadArchived
+	}
+
 	// If the file cannot be found, we ignore this error and continue since the
 	// upload may not have been finished yet. In this case we do not want to
 	// return a ErrNotFound but a more meaning-full message.
 	if !isAwsError[*types.NoSuchKey](err) {
-		return nil, err
+		return nil, convertError(err)
+	}
+
+	if upload.multipartId == noMultipartId {
+		// The object is only created once all data has been received, so the
+		// upload is unfinished if its info object exists.
+		if _, _, _, _, err := upload.fetchInfo(ctx); err != nil {
+			return nil, convertError(err)
+		}
+		return nil, handler.NewError("ERR_INCOMPLETE_UPLOAD", "cannot stream non-finished upload", http.StatusBadRequest)
 	}
 
 	// Test whether the multipart upload exists to find out if the upload
 	// never existsted or just has not been finished yet
 	_, err = store.Service.ListParts(ctx, &s3.ListPartsInput{
 		Bucket:   aws.String(store.Bucket),
-		Key:      store.keyWithPrefix(upload.objectId),
+		Key:      store.keyWithPrefix(upload.location()),
 		UploadId: aws.String(upload.multipartId),
-		MaxParts: 0,
+		MaxParts: aws.Int32(0),
 	})
 	if err == nil {
 		// The multipart upload still exists, which means we cannot download it yet
@@ -758,23 +1682,64 @@ func (upload s3Upload) GetReader(ctx context.Context) (io.ReadCloser, error) {
 		return nil, handler.ErrNotFound
 	}
 
-	return nil, err
+	return nil, convertError(err)
 }
 
 func (upload s3Upload) Terminate(ctx context.Context) error {
 	store := upload.store
 
+	// Determine the version of the final object, so that it is deleted instead
+	// of being hidden behind a delete marker in versioned buckets.
+	versionId := upload.cachedVersionId()
+	info := upload.info
+	if info == nil {
+		stored, _, err := store.readInfoObject(ctx, upload.objectId, upload.location())
+		if upload.resolveShard(stored, err) {
+			stored, _, err = store.readInfoObject(ctx, upload.objectId, upload.location())
+		}
+		if err != nil && !isAwsError[*types.NoSuchKey](err) && !errors.Is(err, handler.ErrNotFound) {
+			return convertError(err)
+		}
+		if stored.Storage["VersionId"] != "" {
+			versionId = aws.String(stored.Storage["VersionId"])
+		}
+		info = &stored
+	}
+
+	if err := upload.checkArchivedTermination(ctx, *info); err != nil {
+		return err
+	}
+
 	var wg sync.WaitGroup
 	wg.Add(2)
 	errs := make([]error, 0, 3)
 
+	objects := []types.ObjectIdentifier{
+		{
+			Key:       store.keyWithPrefix(upload.location()),
+			VersionId: versionId,
+		},
+		{
+			Key: store.metadataKeyWithPrefix(upload.location() + ".part"),
+		},
+	}
+	if store.MetadataStore == nil {
+		objects = append(objects, types.ObjectIdentifier{
+			Key: store.metadataKeyWithPrefix(upload.location() + ".info"),
+		})
+	}
+
 	go func() {
 		defer wg.Done()
 
+		if upload.multipartId == noMultipartId {
+			return
+		}
+
 		// Abort the multipart upload
 		_, err := store.Service.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
 			Bucket:   aws.String(store.Bucket),
-			Key:      store.keyWithPrefix(upload.objectId),
+			Key:      store.keyWithPrefix(upload.location()),
 			UploadId: aws.String(upload.multipartId),
 		})
 		if err != nil && !isAwsError[*types.NoSuchUpload](err) {
@@ -786,38 +1751,20 @@ func (upload s3Upload) Terminate(ctx context.Context) error {
 		defer wg.Done()
 
 		// Delete the info and content files
-		res, err := store.Service.DeleteObjects(ctx, &s3.DeleteObjectsInput{
-			Bucket: aws.String(store.Bucket),
-			Delete: &types.Delete{
-				Objects: []types.ObjectIdentifier{
-					{
-						Key: store.keyWithPrefix(upload.objectId),
-					},
-					{
-						Key: store.metadataKeyWithPrefix(upload.objectId + ".part"),
-					},
-					{
-						Key: store.metadataKeyWithPrefix(upload.objectId + ".info"),
-					},
-				},
-				Quiet: true,
-			},
-		})
-
-		if err != nil {
-			errs = append(errs, err)
-			return
-		}
-
-		for _, s3Err := range res.Errors {
-			if *s3Err.Code != "NoSuchKey" {
-				errs = append(errs, fmt.Errorf("AWS S3 Error (%s) for object %s: %s", *s3Err.Code, *s3Err.Key, *s3Err.Message))
-			}
-		}
+		deleteErrs := store.deleteObjects(ctx, objects)
+		errs = append(errs, deleteErrs...)
 	}()
 
 	wg.Wait()
 
+	// The info is deleted last, so that the upload can still be found if
+	// deleting its objects failed.
+	if store.MetadataStore != nil && len(errs) == 0 {
+		if err := store.MetadataStore.DeleteInfo(ctx, upload.objectId); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
 	if len(errs) > 0 {
 		return newMultiError(errs)
 	}
@@ -826,62 +1773,185 @@ func (upload s3Upload) Terminate(ctx context.Context) error {
 }
 
 func (upload s3Upload) FinishUpload(ctx context.Context) error {
+	if err := upload.finishObject(ctx); err != nil {
+		return err
+	}
+
+	return upload.writePointerObject(ctx)
+}
+
+// finishObject stores the final object of the upload, by completing the
+// multipart upload or, for uploads without one, writing the object if it does
+// not exist yet.
+func (upload *s3Upload) finishObject(ctx context.Context) error {
 	store := upload.store
 
 	// Get uploaded parts
-	_, parts, _, err := upload.getInternalInfo(ctx)
+	info, parts, _, err := upload.getInternalInfo(ctx)
 	if err != nil {
-		return err
+		return convertError(err)
+	}
+
+	if upload.multipartId == noMultipartId {
+		// The object has already been stored in WriteChunk, unless the upload is
+		// empty and WriteChunk has never been called.
+		if info.Size > 0 {
+			return nil
+		}
+
+		if err := upload.checkOverwrite(ctx); err != nil {
+			return err
+		}
+
+		headers := store.objectHeaders(info.MetaData)
+		sse := customerKeyFromContext(ctx)
+		t := time.Now()
+		res, err := store.Service.PutObject(ctx, &s3.PutObjectInput{
+			Bucket:               aws.String(store.Bucket),
+			Key:                  store.keyWithPrefix(upload.location()),
+			Body:                 bytes.NewReader([]byte{}),
+			Metadata:             store.objectMetadata(info.MetaData),
+			CacheControl:         headers.CacheControl,
+			ContentDisposition:   headers.ContentDisposition,
+			ContentEncoding:      headers.ContentEncoding,
+			StorageClass:         store.storageClass(info),
+			SSECustomerAlgorithm: sse.algorithm,
+			SSECustomerKey:       sse.key,
+			SSECustomerKeyMD5:    sse.keyMD5,
+		})
+		store.observeRequest(ctx, t, metricPutObject, err)
+		if err != nil {
+			return convertError(err)
+		}
+
+		return convertError(upload.recordVersionId(ctx, res.VersionId))
 	}
 
 	if len(parts) == 0 {
 		// AWS expects at least one part to be present when completing the multipart
 		// upload. So if the tus upload has a size of 0, we create an empty part
 		// and use that for completing the multipart upload.
+		sse := customerKeyFromContext(ctx)
 		res, err := store.Service.UploadPart(ctx, &s3.UploadPartInput{
-			Bucket:     aws.String(store.Bucket),
-			Key:        store.keyWithPrefix(upload.objectId),
-			UploadId:   aws.String(upload.multipartId),
-			PartNumber: 1,
-			Body:       bytes.NewReader([]byte{}),
+			Bucket:               aws.String(store.Bucket),
+			Key:                  store.keyWithPrefix(upload.location()),
+			UploadId:             aws.String(upload.multipartId),
+			PartNumber:           aws.Int32(1),
+			Body:                 bytes.NewReader([]byte{}),
+			ChecksumAlgorithm:    store.ChecksumAlgorithm,
+			SSECustomerAlgorithm: sse.algorithm,
+			SSECustomerKey:       sse.key,
+			SSECustomerKeyMD5:    sse.keyMD5,
 		})
 		if err != nil {
-			return err
+			return convertError(err)
 		}
 
 		parts = []*s3Part{
 			{
-				etag:   *res.ETag,
-				number: 1,
-				size:   0,
+				etag:     *res.ETag,
+				number:   1,
+				size:     0,
+				checksum: selectChecksum(store.ChecksumAlgorithm, res.ChecksumCRC32, res.ChecksumCRC32C, res.ChecksumSHA1, res.ChecksumSHA256),
 			},
 		}
 
 	}
 
+	if err := upload.checkOverwrite(ctx); err != nil {
+		return err
+	}
+
+	versionId, err := upload.completeMultipartUpload(ctx, parts)
+	for attempt := 0; err != nil && attempt < completeMultipartUploadRetries && ctx.Err() == nil; attempt++ {
+		// The request might have failed or timed out although S3 completed the
+		// multipart upload, or the parts known to us might be out of date. Compare
+		// them with the parts stored in S3 before trying again.
+		remoteParts, listErr := store.listAllParts(ctx, upload.location(), upload.multipartId)
+		if isAwsError[*types.NoSuchUpload](listErr) || isAwsErrorCode(listErr, "NoSuchUpload") {
+			// The multipart upload is gone, which is fine if it has been completed.
+			if exists, headErr := store.objectExists(ctx, upload.location()); headErr == nil && exists {
+				return nil
+			}
+			return convertError(err)
+		}
+		if listErr != nil {
+			return convertError(err)
+		}
+
+		if reconcileErr := store.reconcileParts(parts, remoteParts); reconcileErr != nil {
+			return reconcileErr
+		}
+
+		parts = remoteParts
+		versionId, err = upload.completeMultipartUpload(ctx, parts)
+	}
+	if err != nil {
+		return convertError(err)
+	}
+
+	return convertError(upload.recordVersionId(ctx, versionId))
+}
+
+// completeMultipartUploadRetries is the number of times a failed
+// CompleteMultipartUpload request is retried in FinishUpload.
+const completeMultipartUploadRetries = 2
+
+// completeMultipartUpload completes the multipart upload using the given parts
+// and returns the version of the final object if the bucket is versioned.
+func (upload s3Upload) completeMultipartUpload(ctx context.Context, parts []*s3Part) (versionId *string, err error) {
+	store := upload.store
+
 	// Transform the []*s3.Part slice to a []*s3.CompletedPart slice for the next
 	// request.
 	completedParts := make([]types.CompletedPart, len(parts))
 
 	for index, part := range parts {
-		completedParts[index] = types.CompletedPart{
-			ETag:       aws.String(part.etag),
-			PartNumber: part.number,
-		}
+		completedParts[index] = store.completedPart(part)
 	}
 
+	sse := customerKeyFromContext(ctx)
 	t := time.Now()
-	_, err = store.Service.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+	res, err := store.Service.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
 		Bucket:   aws.String(store.Bucket),
-		Key:      store.keyWithPrefix(upload.objectId),
+		Key:      store.keyWithPrefix(upload.location()),
 		UploadId: aws.String(upload.multipartId),
 		MultipartUpload: &types.CompletedMultipartUpload{
 			Parts: completedParts,
 		},
+		SSECustomerAlgorithm: sse.algorithm,
+		SSECustomerKey:       sse.key,
+		SSECustomerKeyMD5:    sse.keyMD5,
 	})
-	store.observeRequestDuration(t, metricCompleteMultipartUpload)
+	store.observeRequest(ctx, t, metricCompleteMultipartUpload, err)
+	if err != nil {
+		return nil, err
+	}
 
-	return err
+	return res.VersionId, nil
+}
+
+// reconcileParts checks that the parts which S3 reports for a multipart upload
+// are the parts we uploaded, so that completing the multipart upload with the
+// reported parts does not assemble a different file.
+func (store S3Store) reconcileParts(local, remote []*s3Part) error {
+	if len(local) != len(remote) {
+		return fmt.Errorf("s3store: multipart upload has %d parts in S3, but %d were uploaded", len(remote), len(local))
+	}
+
+	for i, part := range local {
+		if part.number != remote[i].number || part.size != remote[i].size {
+			return fmt.Errorf("s3store: part %d of multipart upload does not match the part in S3", part.number)
+		}
+		if !store.etagsEqual(part.etag, remote[i].etag) {
+			return fmt.Errorf("s3store: ETag of part %d does not match the part in S3", part.number)
+		}
+		if !checksumsEqual(part.checksum, remote[i].checksum) {
+			return fmt.Errorf("s3store: checksum of part %d does not match the part in S3", part.number)
+		}
+	}
+
+	return nil
 }
 
 func (upload *s3Upload) ConcatUploads(ctx context.Context, partialUploads []handler.Upload) error {
@@ -899,9 +1969,9 @@ func (upload *s3Upload) ConcatUploads(ctx context.Context, partialUploads []hand
 
 	// If one partial upload is smaller than the the minimum part size for an S3
 	// Multipart Upload, we cannot use S3 Multipart Uploads for concatenating all
-	// the files.
+	// the files. The same applies if the server requires parts of equal size.
 	// So instead we have to download them and concat them on disk.
-	if hasSmallPart {
+	if hasSmallPart || upload.store.Compatibility.UniformPartSizes {
 		return upload.concatUsingDownload(ctx, partialUploads)
 	} else {
 		return upload.concatUsingMultipart(ctx, partialUploads)
@@ -910,40 +1980,53 @@ func (upload *s3Upload) ConcatUploads(ctx context.Context, partialUploads []hand
 
 func (upload *s3Upload) concatUsingDownload(ctx context.Context, partialUploads []handler.Upload) error {
 	store := upload.store
+	sse := customerKeyFromContext(ctx)
 
 	// Create a temporary file for holding the concatenated data
-	file, err := os.CreateTemp(store.TemporaryDirectory, "tusd-s3-concat-tmp-")
+	file, err := store.createTemporaryFile(ctx, "tusd-s3-concat-tmp-", 0)
 	if err != nil {
 		return err
 	}
-	defer cleanUpTempFile(file)
+	defer file.remove()
 
 	// Download each part and append it to the temporary file
 	for _, partialUpload := range partialUploads {
 		partialS3Upload := partialUpload.(*s3Upload)
 
 		res, err := store.Service.GetObject(ctx, &s3.GetObjectInput{
-			Bucket: aws.String(store.Bucket),
-			Key:    store.keyWithPrefix(partialS3Upload.objectId),
+			Bucket:               aws.String(store.Bucket),
+			Key:                  store.keyWithPrefix(partialS3Upload.location()),
+			SSECustomerAlgorithm: sse.algorithm,
+			SSECustomerKey:       sse.key,
+			SSECustomerKeyMD5:    sse.keyMD5,
 		})
 		if err != nil {
 			return err
 		}
 		defer res.Body.Close()
 
-		if _, err := io.Copy(file, res.Body); err != nil {
+		if _, err := bufferpool.Copy(file, res.Body); err != nil {
 			return err
 		}
 	}
 
+	if size, err := file.Seek(0, io.SeekCurrent); err == nil {
+		file.setSize(size)
+	}
+
 	// Seek to the beginning of the file, so the entire file is being uploaded
 	file.Seek(0, 0)
 
 	// Upload the entire file to S3
 	_, err = store.Service.PutObject(ctx, &s3.PutObjectInput{
-		Bucket: aws.String(store.Bucket),
-		Key:    store.keyWithPrefix(upload.objectId),
-		Body:   file,
+		Bucket:               aws.String(store.Bucket),
+		Key:                  store.keyWithPrefix(upload.location()),
+		Body:                 file,
+		StorageClass:         store.StorageClass,
+		ChecksumAlgorithm:    store.ChecksumAlgorithm,
+		SSECustomerAlgorithm: sse.algorithm,
+		SSECustomerKey:       sse.key,
+		SSECustomerKeyMD5:    sse.keyMD5,
 	})
 	if err != nil {
 		return err
@@ -956,16 +2039,18 @@ func (upload *s3Upload) concatUsingDownload(ctx context.Context, partialUploads
 	go func() {
 		store.Service.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
 			Bucket:   aws.String(store.Bucket),
-			Key:      store.keyWithPrefix(upload.objectId),
+			Key:      store.keyWithPrefix(upload.location()),
 			UploadId: aws.String(upload.multipartId),
 		})
 	}()
 
-	return nil
+	// FinishUpload is not called for the concatenated object.
+	return upload.writePointerObject(ctx)
 }
 
 func (upload *s3Upload) concatUsingMultipart(ctx context.Context, partialUploads []handler.Upload) error {
 	store := upload.store
+	sse := customerKeyFromContext(ctx)
 
 	numPartialUploads := len(partialUploads)
 	errs := make([]error, 0, numPartialUploads)
@@ -985,23 +2070,31 @@ func (upload *s3Upload) concatUsingMultipart(ctx context.Context, partialUploads
 			etag:   "",
 		})
 
-		go func(partNumber int32, sourceObject string) {
+		go func(partNumber int32, sourceLocation string) {
 			defer wg.Done()
 
 			res, err := store.Service.UploadPartCopy(ctx, &s3.UploadPartCopyInput{
-				Bucket:     aws.String(store.Bucket),
-				Key:        store.keyWithPrefix(upload.objectId),
-				UploadId:   aws.String(upload.multipartId),
-				PartNumber: partNumber,
-				CopySource: aws.String(store.Bucket + "/" + *store.keyWithPrefix(sourceObject)),
+				Bucket:                         aws.String(store.Bucket),
+				Key:                            store.keyWithPrefix(upload.location()),
+				UploadId:                       aws.String(upload.multipartId),
+				PartNumber:                     aws.Int32(partNumber),
+				CopySource:                     aws.String(store.Bucket + "/" + *store.keyWithPrefix(sourceLocation)),
+				SSECustomerAlgorithm:           sse.algorithm,
+				SSECustomerKey:                 sse.key,
+				SSECustomerKeyMD5:              sse.keyMD5,
+				CopySourceSSECustomerAlgorithm: sse.algorithm,
+				CopySourceSSECustomerKey:       sse.key,
+				CopySourceSSECustomerKeyMD5:    sse.keyMD5,
 			})
 			if err != nil {
 				errs = append(errs, err)
 				return
 			}
 
-			upload.parts[partNumber-1].etag = *res.CopyPartResult.ETag
-		}(partNumber, partialS3Upload.objectId)
+			result := res.CopyPartResult
+			upload.parts[partNumber-1].etag = *result.ETag
+			upload.parts[partNumber-1].checksum = selectChecksum(store.ChecksumAlgorithm, result.ChecksumCRC32, result.ChecksumCRC32C, result.ChecksumSHA1, result.ChecksumSHA256)
+		}(partNumber, partialS3Upload.location())
 	}
 
 	wg.Wait()
@@ -1014,17 +2107,107 @@ func (upload *s3Upload) concatUsingMultipart(ctx context.Context, partialUploads
 }
 
 func (upload *s3Upload) DeclareLength(ctx context.Context, length int64) error {
+	return upload.updateInfo(ctx, func(info *handler.FileInfo) {
+		info.Size = length
+		info.SizeIsDeferred = false
+	})
+}
+
+func (upload *s3Upload) SetExpiration(ctx context.Context, expiresAt time.Time) error {
+	return upload.updateInfo(ctx, func(info *handler.FileInfo) {
+		info.ExpiresAt = &expiresAt
+	})
+}
+
+func (upload *s3Upload) AppendPartialUploads(ctx context.Context, ids []string) error {
+	return upload.updateInfo(ctx, func(info *handler.FileInfo) {
+		info.PartialUploads = append(info.PartialUploads, ids...)
+	})
+}
+
+func (upload *s3Upload) RecordChecksum(ctx context.Context, checksum handler.UploadChecksum) error {
+	return upload.updateInfo(ctx, func(info *handler.FileInfo) {
+		info.Checksum = &checksum
+	})
+}
+
+// updateInfo applies update to the upload's info and stores the result. With a
+// MetadataStore, the info is updated atomically. Otherwise, the .info object is
+// replaced, which overwrites concurrent changes.
+func (upload *s3Upload) updateInfo(ctx context.Context, update func(info *handler.FileInfo)) error {
 	info, err := upload.GetInfo(ctx)
 	if err != nil {
 		return err
 	}
-	info.Size = length
-	info.SizeIsDeferred = false
 
-	return upload.writeInfo(ctx, info)
+	store := upload.store
+	if store.MetadataStore == nil {
+		update(&info)
+		return upload.writeInfo(ctx, info)
+	}
+
+	updated, err := store.MetadataStore.UpdateInfo(ctx, upload.objectId, func(stored *handler.FileInfo) error {
+		update(stored)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// The offset is derived from the parts, not from the stored info.
+	updated.Offset = info.Offset
+	upload.info = &updated
+	return nil
 }
 
-func (store S3Store) listAllParts(ctx context.Context, objectId string, multipartId string) (parts []*s3Part, err error) {
+func (store S3Store) listAllParts(ctx context.Context, location string, multipartId string) (parts []*s3Part, err error) {
+	parts, err = store.listParts(ctx, location, multipartId)
+	for attempt := 0; err == nil && attempt < store.Compatibility.ListPartsRetries && hasMissingParts(parts); attempt++ {
+		// The listing might not include all uploaded parts yet. Wait before
+		// listing them again.
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(store.Compatibility.ListPartsRetryDelay):
+		}
+
+		parts, err = store.listParts(ctx, location, multipartId)
+	}
+	return parts, err
+}
+
+// waitForInfoObject checks whether the .info object of the upload at the given
+// location is visible, for servers which are not read-after-write consistent
+// for new objects.
+func (store S3Store) waitForInfoObject(ctx context.Context, location string) error {
+	checks := store.Compatibility.InfoObjectChecks
+	if checks <= 0 || store.MetadataStore != nil {
+		return nil
+	}
+
+	key := store.metadataKeyWithPrefix(location + ".info")
+	for attempt := 0; attempt < checks; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(store.Compatibility.InfoObjectCheckDelay):
+			}
+		}
+
+		exists, err := store.keyExists(ctx, key)
+		if err != nil {
+			return fmt.Errorf("s3store: unable to check info file:\n%s", err)
+		}
+		if exists {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("s3store: info file is not visible after %d checks", checks)
+}
+
+func (store S3Store) listParts(ctx context.Context, location string, multipartId string) (parts []*s3Part, err error) {
 	var partMarker *string
 	for {
 		t := time.Now()
@@ -1032,11 +2215,11 @@ func (store S3Store) listAllParts(ctx context.Context, objectId string, multipar
 		// Get uploaded parts
 		listPtr, err := store.Service.ListParts(ctx, &s3.ListPartsInput{
 			Bucket:           aws.String(store.Bucket),
-			Key:              store.keyWithPrefix(objectId),
+			Key:              store.keyWithPrefix(location),
 			UploadId:         aws.String(multipartId),
 			PartNumberMarker: partMarker,
 		})
-		store.observeRequestDuration(t, metricListParts)
+		store.observeRequest(ctx, t, metricListParts, err)
 		if err != nil {
 			return nil, err
 		}
@@ -1044,14 +2227,15 @@ func (store S3Store) listAllParts(ctx context.Context, objectId string, multipar
 		parts = slices.Grow(parts, len(parts)+len((*listPtr).Parts))
 		for _, part := range (*listPtr).Parts {
 			parts = append(parts, &s3Part{
-				number: part.PartNumber,
-				size:   part.Size,
-				etag:   *part.ETag,
+				number:   aws.ToInt32(part.PartNumber),
+				size:     aws.ToInt64(part.Size),
+				etag:     *part.ETag,
+				checksum: selectChecksum(store.ChecksumAlgorithm, part.ChecksumCRC32, part.ChecksumCRC32C, part.ChecksumSHA1, part.ChecksumSHA256),
 			})
 		}
 
-		if listPtr.IsTruncated {
-			partMarker = listPtr.NextPartNumberMarker
+		if aws.ToBool(listPtr.IsTruncated) {
+			partMarker = store.nextPartNumberMarker(listPtr, partMarker)
 		} else {
 			break
 		}
@@ -1059,7 +2243,40 @@ func (store S3Store) listAllParts(ctx context.Context, objectId string, multipar
 	return parts, nil
 }
 
-func (store S3Store) downloadIncompletePartForUpload(ctx context.Context, uploadId string) (*os.File, error) {
+func (store S3Store) objectExists(ctx context.Context, location string) (bool, error) {
+	sse := customerKeyFromContext(ctx)
+	return store.headExists(ctx, &s3.HeadObjectInput{
+		Bucket:               aws.String(store.Bucket),
+		Key:                  store.keyWithPrefix(location),
+		SSECustomerAlgorithm: sse.algorithm,
+		SSECustomerKey:       sse.key,
+		SSECustomerKeyMD5:    sse.keyMD5,
+	})
+}
+
+func (store S3Store) keyExists(ctx context.Context, key *string) (bool, error) {
+	return store.headExists(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(store.Bucket),
+		Key:    key,
+	})
+}
+
+func (store S3Store) headExists(ctx context.Context, input *s3.HeadObjectInput) (bool, error) {
+	t := time.Now()
+	_, err := store.Service.HeadObject(ctx, input)
+	store.observeRequest(ctx, t, metricHeadObject, err)
+
+	if err != nil {
+		if isAwsError[*types.NoSuchKey](err) || isAwsError[*types.NotFound](err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (store S3Store) downloadIncompletePartForUpload(ctx context.Context, uploadId string) (*temporaryFile, error) {
 	t := time.Now()
 	incompleteUploadObject, err := store.getIncompletePartForUpload(ctx, uploadId)
 	if err != nil {
@@ -1071,22 +2288,25 @@ func (store S3Store) downloadIncompletePartForUpload(ctx context.Context, upload
 	}
 	defer incompleteUploadObject.Body.Close()
 
-	partFile, err := os.CreateTemp(store.TemporaryDirectory, "tusd-s3-tmp-")
+	partFile, err := store.createTemporaryFile(ctx, "tusd-s3-tmp-", aws.ToInt64(incompleteUploadObject.ContentLength))
 	if err != nil {
 		return nil, err
 	}
 
-	n, err := io.Copy(partFile, incompleteUploadObject.Body)
-	store.observeRequestDuration(t, metricGetPartObject)
+	n, err := bufferpool.Copy(partFile, incompleteUploadObject.Body)
+	store.observeRequest(ctx, t, metricGetPartObject, err)
 	if err != nil {
+		partFile.remove()
 		return nil, err
 	}
-	if n < incompleteUploadObject.ContentLength {
+	if n < aws.ToInt64(incompleteUploadObject.ContentLength) {
+		partFile.remove()
 		return nil, errors.New("short read of incomplete upload")
 	}
 
 	_, err = partFile.Seek(0, 0)
 	if err != nil {
+		partFile.remove()
 		return nil, err
 	}
 
@@ -1094,9 +2314,13 @@ func (store S3Store) downloadIncompletePartForUpload(ctx context.Context, upload
 }
 
 func (store S3Store) getIncompletePartForUpload(ctx context.Context, uploadId string) (*s3.GetObjectOutput, error) {
+	sse := customerKeyFromContext(ctx)
 	obj, err := store.Service.GetObject(ctx, &s3.GetObjectInput{
-		Bucket: aws.String(store.Bucket),
-		Key:    store.metadataKeyWithPrefix(uploadId + ".part"),
+		Bucket:               aws.String(store.Bucket),
+		Key:                  store.metadataKeyWithPrefix(uploadId + ".part"),
+		SSECustomerAlgorithm: sse.algorithm,
+		SSECustomerKey:       sse.key,
+		SSECustomerKeyMD5:    sse.keyMD5,
 	})
 
 	if err != nil && (isAwsError[*types.NoSuchKey](err) || isAwsError[*types.NotFound](err) || isAwsErrorCode(err, "AccessDenied")) {
@@ -1107,12 +2331,16 @@ func (store S3Store) getIncompletePartForUpload(ctx context.Context, uploadId st
 }
 
 func (store S3Store) headIncompletePartForUpload(ctx context.Context, uploadId string) (int64, error) {
+	sse := customerKeyFromContext(ctx)
 	t := time.Now()
 	obj, err := store.Service.HeadObject(ctx, &s3.HeadObjectInput{
-		Bucket: aws.String(store.Bucket),
-		Key:    store.metadataKeyWithPrefix(uploadId + ".part"),
+		Bucket:               aws.String(store.Bucket),
+		Key:                  store.metadataKeyWithPrefix(uploadId + ".part"),
+		SSECustomerAlgorithm: sse.algorithm,
+		SSECustomerKey:       sse.key,
+		SSECustomerKeyMD5:    sse.keyMD5,
 	})
-	store.observeRequestDuration(t, metricHeadPartObject)
+	store.observeRequest(ctx, t, metricHeadPartObject, err)
 
 	if err != nil {
 		if isAwsError[*types.NoSuchKey](err) || isAwsError[*types.NotFound](err) || isAwsErrorCode(err, "AccessDenied") {
@@ -1121,17 +2349,22 @@ func (store S3Store) headIncompletePartForUpload(ctx context.Context, uploadId s
 		return 0, err
 	}
 
-	return obj.ContentLength, nil
+	return aws.ToInt64(obj.ContentLength), nil
 }
 
 func (store S3Store) putIncompletePartForUpload(ctx context.Context, uploadId string, file io.ReadSeeker) error {
+	sse := customerKeyFromContext(ctx)
 	t := time.Now()
 	_, err := store.Service.PutObject(ctx, &s3.PutObjectInput{
-		Bucket: aws.String(store.Bucket),
-		Key:    store.metadataKeyWithPrefix(uploadId + ".part"),
-		Body:   file,
+		Bucket:               aws.String(store.Bucket),
+		Key:                  store.metadataKeyWithPrefix(uploadId + ".part"),
+		Body:                 file,
+		ChecksumAlgorithm:    store.ChecksumAlgorithm,
+		SSECustomerAlgorithm: sse.algorithm,
+		SSECustomerKey:       sse.key,
+		SSECustomerKeyMD5:    sse.keyMD5,
 	})
-	store.observeRequestDuration(t, metricPutPartObject)
+	store.observeRequest(ctx, t, metricPutPartObject, err)
 	return err
 }
 
@@ -1141,7 +2374,7 @@ func (store S3Store) deleteIncompletePartForUpload(ctx context.Context, uploadId
 		Bucket: aws.String(store.Bucket),
 		Key:    store.metadataKeyWithPrefix(uploadId + ".part"),
 	})
-	store.observeRequestDuration(t, metricPutPartObject)
+	store.observeRequest(ctx, t, metricPutPartObject, err)
 	return err
 }
 
@@ -1171,6 +2404,22 @@ func isAwsErrorCode(err error, code string) bool {
 	return false
 }
 
+// convertError maps S3 errors that clients can react to onto errors with
+// documented error codes. All other errors are returned unchanged.
+func convertError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case isAwsErrorCode(err, "SlowDown"):
+		return ErrSlowDown
+	// See fetchInfo for why the error code is also checked.
+	case isAwsError[*types.NoSuchUpload](err) || isAwsErrorCode(err, "NoSuchUpload"):
+		return handler.ErrNotFound
+	default:
+		return err
+	}
+}
+
 func (store S3Store) calcOptimalPartSize(size int64) (optimalPartSize int64, err error) {
 	switch {
 	// When upload is smaller or equal to PreferredPartSize, we upload in just one part.
@@ -1236,12 +2485,28 @@ func (store S3Store) metadataKeyWithPrefix(key string) *string {
 	return aws.String(prefix + key)
 }
 
-func (store S3Store) acquireUploadSemaphore() {
+func (store S3Store) acquireUploadSemaphore(priority int) {
 	store.uploadSemaphoreDemandMetric.Inc()
-	store.uploadSemaphore.Acquire()
+	store.uploadSemaphore.Acquire(priority)
 }
 
 func (store S3Store) releaseUploadSemaphore() {
 	store.uploadSemaphore.Release()
 	store.uploadSemaphoreDemandMetric.Dec()
 }
+
+// observePartUpload reports the outcome of a part upload to the adaptive limit
+// on concurrent part uploads, if it is used. The speed is only considered for
+// parts of the optimal size, since the overhead of the request outweighs the
+// time to transfer the bytes of smaller parts, such as the final one.
+func (store S3Store) observePartUpload(start time.Time, size int64, isOptimalSize bool, err error) {
+	adaptive := store.adaptiveConcurrency
+	if adaptive == nil {
+		return
+	}
+
+	if !isOptimalSize {
+		size = 0
+	}
+	adaptive.observe(start, size, err)
+}
@@ -0,0 +1,116 @@
+package s3store
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// adaptiveLatencyTolerance is the factor by which the time to upload a byte
+// may exceed the fastest observed time before the part uploads are considered
+// to congest the connection to S3.
+const adaptiveLatencyTolerance = 2
+
+// adaptiveBaselineDrift controls how quickly the fastest observed time per
+// byte follows slower observations, so that the baseline adapts to changed
+// network conditions.
+const adaptiveBaselineDrift = 0.01
+
+// adaptiveConcurrency adjusts the limit on concurrent part uploads using additive increase/multiplicative decrease (AIMD), similar to
+// TCP congestion control. Starting at the minimum, the limit grows by one for
+// every successful part upload until the first congestion (slow start) and
+// afterwards by one for every limit part uploads. If a part upload fails or
+// transfers its bytes considerably slower than the fastest observed part
+// upload, the limit is halved. Only part uploads started after the previous
+// decrease can decrease the limit again, so that the part uploads, which were
+// in flight at that time, are not counted twice.
+type adaptiveConcurrency struct {
+	min float64
+	max float64
+	// limiter enforces the limit on the part uploads.
+	limiter *uploadLimiter
+
+	lock      sync.Mutex
+	limit     float64
+	slowStart bool
+	// baseline is the fastest observed time per byte in seconds.
+	baseline     float64
+	lastDecrease time.Time
+
+	limitMetric prometheus.Gauge
+}
+
+func newAdaptiveConcurrency(min, max int, limitMetric prometheus.Gauge) *adaptiveConcurrency {
+	if min < 1 {
+		min = 1
+	}
+	if max < min {
+		max = min
+	}
+
+	a := &adaptiveConcurrency{
+		min:         float64(min),
+		max:         float64(max),
+		limiter:     newUploadLimiter(min),
+		limit:       float64(min),
+		slowStart:   true,
+		limitMetric: limitMetric,
+	}
+	a.limitMetric.Set(a.limit)
+
+	return a
+}
+
+// observe adjusts the limit based on the outcome of a part upload of size bytes,
+// which was started at start.
+func (a *adaptiveConcurrency) observe(start time.Time, size int64, err error) {
+	// Uploads are canceled if the client disconnects, which does not tell
+	// anything about the connection to S3.
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	congested := err != nil
+	if err == nil && size > 0 {
+		perByte := time.Since(start).Seconds() / float64(size)
+		switch {
+		case a.baseline == 0 || perByte < a.baseline:
+			a.baseline = perByte
+		case perByte > a.baseline*adaptiveLatencyTolerance:
+			congested = true
+		default:
+			a.baseline += (perByte - a.baseline) * adaptiveBaselineDrift
+		}
+	}
+
+	previousLimit := a.currentLimit()
+	if congested {
+		if start.Before(a.lastDecrease) {
+			return
+		}
+		a.slowStart = false
+		a.lastDecrease = time.Now()
+		a.limit = math.Max(a.min, a.limit/2)
+	} else if a.slowStart {
+		a.limit = math.Min(a.max, a.limit+1)
+	} else {
+		a.limit = math.Min(a.max, a.limit+1/a.limit)
+	}
+
+	if limit := a.currentLimit(); limit != previousLimit {
+		a.limitMetric.Set(float64(limit))
+		a.limiter.setLimit(limit)
+	}
+}
+
+// currentLimit returns the limit as number of part uploads. The lock must be held.
+func (a *adaptiveConcurrency) currentLimit() int {
+	return int(a.limit)
+}
@@ -0,0 +1,117 @@
+package s3store
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestAdaptiveConcurrency(min, max int) *adaptiveConcurrency {
+	return newAdaptiveConcurrency(min, max, prometheus.NewGauge(prometheus.GaugeOpts{}))
+}
+
+func TestAdaptiveConcurrencyIncrease(t *testing.T) {
+	assert := assert.New(t)
+
+	a := newTestAdaptiveConcurrency(2, 10)
+	assert.Equal(2, a.currentLimit())
+
+	// The part uploads are reported without sizes, so that their speed does
+	// not affect the limit.
+
+	// During slow start, every successful part upload raises the limit by one.
+	for i := 0; i < 3; i++ {
+		a.observe(time.Now(), 0, nil)
+	}
+	assert.Equal(5, a.currentLimit())
+
+	// The limit never exceeds the maximum.
+	for i := 0; i < 20; i++ {
+		a.observe(time.Now(), 0, nil)
+	}
+	assert.Equal(10, a.currentLimit())
+}
+
+func TestAdaptiveConcurrencyDecrease(t *testing.T) {
+	assert := assert.New(t)
+
+	a := newTestAdaptiveConcurrency(1, 16)
+	for i := 0; i < 7; i++ {
+		a.observe(time.Now(), 0, nil)
+	}
+	assert.Equal(8, a.currentLimit())
+
+	start := time.Now()
+	a.observe(start, 100, errors.New("SlowDown"))
+	assert.Equal(4, a.currentLimit())
+	assert.False(a.slowStart)
+
+	// Part uploads, which were in flight during the decrease, do not decrease
+	// the limit again.
+	a.observe(start, 100, errors.New("SlowDown"))
+	assert.Equal(4, a.currentLimit())
+
+	// Canceled part uploads are ignored.
+	a.observe(time.Now(), 100, context.Canceled)
+	assert.Equal(4, a.currentLimit())
+
+	// After slow start, the limit grows by about one for every limit part uploads.
+	for i := 0; i < 5; i++ {
+		a.observe(time.Now(), 0, nil)
+	}
+	assert.Equal(5, a.currentLimit())
+
+	// The limit never falls below the minimum.
+	for i := 0; i < 5; i++ {
+		a.observe(time.Now(), 100, errors.New("SlowDown"))
+	}
+	assert.Equal(1, a.currentLimit())
+}
+
+func TestAdaptiveConcurrencySlowUploads(t *testing.T) {
+	assert := assert.New(t)
+
+	a := newTestAdaptiveConcurrency(1, 16)
+	a.limit = 4
+	a.baseline = time.Millisecond.Seconds()
+
+	// A part upload, which takes much longer per byte than the baseline,
+	// indicates congestion.
+	a.observe(time.Now().Add(-time.Second), 100, nil)
+	assert.Equal(2, a.currentLimit())
+
+	// Without a size, only errors are considered.
+	a.observe(time.Now().Add(-time.Second), 0, nil)
+	assert.Equal(2, a.currentLimit())
+}
+
+func TestAdaptiveConcurrencyAcquire(t *testing.T) {
+	assert := assert.New(t)
+
+	a := newTestAdaptiveConcurrency(1, 2)
+	a.limiter.Acquire(0)
+
+	acquired := make(chan struct{})
+	go func() {
+		a.limiter.Acquire(0)
+		close(acquired)
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("slot must not be acquired while the limit is reached")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Raising the limit wakes up the waiting goroutine.
+	a.observe(time.Now(), 0, nil)
+	<-acquired
+
+	a.limiter.Release()
+	a.limiter.Release()
+	assert.Equal(0, a.limiter.inFlight)
+}
@@ -0,0 +1,103 @@
+package s3store
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/tus/tusd/v2/pkg/handler"
+)
+
+// ErrUploadArchived is returned when reading a finished upload, whose object is
+// stored in the GLACIER or DEEP_ARCHIVE storage class and has not been restored.
+var ErrUploadArchived = handler.NewError("ERR_UPLOAD_ARCHIVED", "upload is stored in archival storage and must be restored before it can be downloaded, e.g. using `aws s3api restore-object`, which can take several hours", http.StatusConflict)
+
+// ErrArchivedUploadTermination is returned when terminating a finished upload,
+// whose object is stored in the GLACIER or DEEP_ARCHIVE storage class.
+var ErrArchivedUploadTermination = handler.NewError("ERR_ARCHIVED_UPLOAD_TERMINATION", "finished uploads in archival storage cannot be terminated", http.StatusConflict)
+
+// isArchivalStorageClass reports whether objects in the storage class must be
+// restored before they can be read.
+func isArchivalStorageClass(class types.StorageClass) bool {
+	return class == types.StorageClassGlacier || class == types.StorageClassDeepArchive
+}
+
+// storageClass returns the storage class of the final object for the upload.
+// Partial uploads are kept in the bucket's default class, since they are read
+// again when they are concatenated.
+func (store S3Store) storageClass(info handler.FileInfo) types.StorageClass {
+	if info.IsPartial {
+		return ""
+	}
+
+	return store.StorageClass
+}
+
+// checkRestored returns ErrUploadArchived unless the final object has been
+// restored from archival storage, so that it can be downloaded.
+func (upload s3Upload) checkRestored(ctx context.Context) error {
+	store := upload.store
+
+	info := upload.info
+	if info == nil {
+		stored, _, err := store.readInfoObject(ctx, upload.objectId, upload.location())
+		if upload.resolveShard(stored, err) {
+			stored, _, err = store.readInfoObject(ctx, upload.objectId, upload.location())
+		}
+		if err != nil {
+			return convertError(err)
+		}
+		info = &stored
+	}
+
+	if !isArchivalStorageClass(types.StorageClass(info.Storage["StorageClass"])) {
+		return nil
+	}
+
+	sse := customerKeyFromContext(ctx)
+	t := time.Now()
+	res, err := store.Service.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket:               aws.String(store.Bucket),
+		Key:                  store.keyWithPrefix(upload.location()),
+		VersionId:            upload.cachedVersionId(),
+		SSECustomerAlgorithm: sse.algorithm,
+		SSECustomerKey:       sse.key,
+		SSECustomerKeyMD5:    sse.keyMD5,
+	})
+	store.observeRequest(ctx, t, metricHeadObject, err)
+	if err != nil {
+		return convertError(err)
+	}
+
+	// A restored copy is available once S3 reports the restoration as finished,
+	// e.g. `ongoing-request="false", expiry-date="..."`.
+	if res.Restore == nil || !strings.Contains(*res.Restore, `ongoing-request="false"`) {
+		return ErrUploadArchived
+	}
+
+	return nil
+}
+
+// checkArchivedTermination returns ErrArchivedUploadTermination if the upload
+// has been finished and its final object is stored in archival storage. Such
+// uploads are meant to be retained and deleting them early is charged for the
+// storage class's minimum storage duration. Unfinished uploads can be terminated.
+func (upload s3Upload) checkArchivedTermination(ctx context.Context, info handler.FileInfo) error {
+	if !isArchivalStorageClass(types.StorageClass(info.Storage["StorageClass"])) {
+		return nil
+	}
+
+	exists, err := upload.store.objectExists(ctx, upload.location())
+	if err != nil {
+		return convertError(err)
+	}
+	if exists {
+		return ErrArchivedUploadTermination
+	}
+
+	return nil
+}
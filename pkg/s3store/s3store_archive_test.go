@@ -0,0 +1,144 @@
+package s3store
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/tus/tusd/v2/pkg/handler"
+)
+
+const archivedInfo = `{"ID":"uploadId+multipartId","Size":500,"Offset":0,"MetaData":{},"Storage":{"Bucket":"bucket","Key":"uploadId","StorageClass":"DEEP_ARCHIVE","Type":"s3store"}}`
+
+func TestNewUploadWithStorageClass(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	s3obj := NewMockS3API(mockCtrl)
+	store := New("bucket", s3obj)
+	store.StorageClass = types.StorageClassDeepArchive
+
+	gomock.InOrder(
+		s3obj.EXPECT().CreateMultipartUpload(context.Background(), &s3.CreateMultipartUploadInput{
+			Bucket:       aws.String("bucket"),
+			Key:          aws.String("uploadId"),
+			Metadata:     map[string]string{},
+			StorageClass: types.StorageClassDeepArchive,
+		}).Return(&s3.CreateMultipartUploadOutput{
+			UploadId: aws.String("multipartId"),
+		}, nil),
+		s3obj.EXPECT().PutObject(context.Background(), gomock.Any()),
+		// Partial uploads are read again for concatenation and therefore not archived.
+		s3obj.EXPECT().CreateMultipartUpload(context.Background(), &s3.CreateMultipartUploadInput{
+			Bucket:   aws.String("bucket"),
+			Key:      aws.String("partialId"),
+			Metadata: map[string]string{},
+		}).Return(&s3.CreateMultipartUploadOutput{
+			UploadId: aws.String("multipartId"),
+		}, nil),
+		s3obj.EXPECT().PutObject(context.Background(), gomock.Any()),
+	)
+
+	upload, err := store.NewUpload(context.Background(), handler.FileInfo{ID: "uploadId", Size: 500})
+	assert.Nil(err)
+	info, err := upload.GetInfo(context.Background())
+	assert.Nil(err)
+	assert.Equal("DEEP_ARCHIVE", info.Storage["StorageClass"])
+
+	upload, err = store.NewUpload(context.Background(), handler.FileInfo{ID: "partialId", Size: 500, IsPartial: true})
+	assert.Nil(err)
+	info, err = upload.GetInfo(context.Background())
+	assert.Nil(err)
+	assert.Equal("", info.Storage["StorageClass"])
+}
+
+func TestGetReaderArchived(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	s3obj := NewMockS3API(mockCtrl)
+	store := New("bucket", s3obj)
+
+	s3obj.EXPECT().GetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("uploadId"),
+	}).Return(nil, &smithy.GenericAPIError{Code: "InvalidObjectState", Message: "The operation is not valid for the object's storage class"})
+
+	upload, err := store.GetUpload(context.Background(), "uploadId+multipartId")
+	assert.Nil(err)
+
+	_, err = upload.GetReader(context.Background())
+	assert.Equal(ErrUploadArchived, err)
+}
+
+func TestPresignDownloadURLArchived(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	s3obj := NewMockS3API(mockCtrl)
+	store := New("bucket", s3obj)
+
+	gomock.InOrder(
+		s3obj.EXPECT().GetObject(context.Background(), &s3.GetObjectInput{
+			Bucket: aws.String("bucket"),
+			Key:    aws.String("uploadId.info"),
+		}).Return(&s3.GetObjectOutput{
+			Body: io.NopCloser(bytes.NewReader([]byte(archivedInfo))),
+		}, nil),
+		s3obj.EXPECT().HeadObject(context.Background(), &s3.HeadObjectInput{
+			Bucket: aws.String("bucket"),
+			Key:    aws.String("uploadId"),
+		}).Return(&s3.HeadObjectOutput{
+			StorageClass: types.StorageClassDeepArchive,
+			Restore:      aws.String(`ongoing-request="true"`),
+		}, nil),
+	)
+
+	upload, err := store.GetUpload(context.Background(), "uploadId+multipartId")
+	assert.Nil(err)
+
+	_, err = store.AsPresignableUpload(upload).PresignDownloadURL(context.Background(), handler.PresignOptions{})
+	assert.Equal(ErrUploadArchived, err)
+}
+
+func TestTerminateArchived(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	s3obj := NewMockS3API(mockCtrl)
+	store := New("bucket", s3obj)
+
+	gomock.InOrder(
+		s3obj.EXPECT().GetObject(context.Background(), &s3.GetObjectInput{
+			Bucket: aws.String("bucket"),
+			Key:    aws.String("uploadId.info"),
+		}).Return(&s3.GetObjectOutput{
+			Body: io.NopCloser(bytes.NewReader([]byte(archivedInfo))),
+		}, nil),
+		// The final object exists, so the upload has been finished.
+		s3obj.EXPECT().HeadObject(context.Background(), &s3.HeadObjectInput{
+			Bucket: aws.String("bucket"),
+			Key:    aws.String("uploadId"),
+		}).Return(&s3.HeadObjectOutput{
+			StorageClass: types.StorageClassDeepArchive,
+		}, nil),
+	)
+
+	upload, err := store.GetUpload(context.Background(), "uploadId+multipartId")
+	assert.Nil(err)
+
+	err = store.AsTerminatableUpload(upload).Terminate(context.Background())
+	assert.Equal(ErrArchivedUploadTermination, err)
+}
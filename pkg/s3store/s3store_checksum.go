@@ -0,0 +1,87 @@
+package s3store
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// ParseChecksumAlgorithm returns the checksum algorithm with the given name,
+// which is either "crc32", "crc32c", "sha1" or "sha256". An empty name selects
+// no algorithm, see S3Store.ChecksumAlgorithm.
+func ParseChecksumAlgorithm(name string) (types.ChecksumAlgorithm, error) {
+	if name == "" {
+		return "", nil
+	}
+
+	for _, algorithm := range types.ChecksumAlgorithm("").Values() {
+		if strings.EqualFold(name, string(algorithm)) {
+			return algorithm, nil
+		}
+	}
+
+	return "", fmt.Errorf("s3store: unknown checksum algorithm %q, must be crc32, crc32c, sha1 or sha256", name)
+}
+
+// checksumAlgorithm returns the algorithm for the checksums of parts and objects,
+// which the AWS SDK calculates while sending the data.
+func (store S3Store) checksumAlgorithm() types.ChecksumAlgorithm {
+	if store.ChecksumAlgorithm != "" {
+		return store.ChecksumAlgorithm
+	}
+	if store.Compatibility.TrailingChecksums {
+		return types.ChecksumAlgorithmCrc32
+	}
+	return ""
+}
+
+// selectChecksum returns the checksum calculated using the given algorithm out
+// of the checksums included in a response from S3.
+func selectChecksum(algorithm types.ChecksumAlgorithm, crc32, crc32c, sha1, sha256 *string) *string {
+	switch algorithm {
+	case types.ChecksumAlgorithmCrc32:
+		return crc32
+	case types.ChecksumAlgorithmCrc32c:
+		return crc32c
+	case types.ChecksumAlgorithmSha1:
+		return sha1
+	case types.ChecksumAlgorithmSha256:
+		return sha256
+	default:
+		return nil
+	}
+}
+
+// completedPart returns the part for completing the multipart upload. If the
+// multipart upload has been created with a checksum algorithm, the part's
+// checksum is included, so that S3 verifies that the part it has stored is the
+// one we uploaded.
+func (store S3Store) completedPart(part *s3Part) types.CompletedPart {
+	completed := types.CompletedPart{
+		ETag:       aws.String(part.etag),
+		PartNumber: aws.Int32(part.number),
+	}
+	if store.ChecksumAlgorithm == "" || part.checksum == nil {
+		return completed
+	}
+
+	switch store.ChecksumAlgorithm {
+	case types.ChecksumAlgorithmCrc32:
+		completed.ChecksumCRC32 = part.checksum
+	case types.ChecksumAlgorithmCrc32c:
+		completed.ChecksumCRC32C = part.checksum
+	case types.ChecksumAlgorithmSha1:
+		completed.ChecksumSHA1 = part.checksum
+	case types.ChecksumAlgorithmSha256:
+		completed.ChecksumSHA256 = part.checksum
+	}
+	return completed
+}
+
+// checksumsEqual reports whether two checksums of a part match. Checksums,
+// which are not known, are considered equal.
+func checksumsEqual(a, b *string) bool {
+	return a == nil || b == nil || *a == *b
+}
@@ -0,0 +1,111 @@
+package s3store
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+func TestWriteChunkAndFinishWithChecksumAlgorithm(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	s3obj := NewMockS3API(mockCtrl)
+	store := New("bucket", s3obj)
+	store.MinPartSize = 4
+	store.PreferredPartSize = 4
+	store.ChecksumAlgorithm = types.ChecksumAlgorithmCrc32c
+
+	s3obj.EXPECT().GetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("uploadId.info"),
+	}).Return(&s3.GetObjectOutput{
+		Body: io.NopCloser(bytes.NewReader([]byte(`{"ID":"uploadId","Size":8,"Offset":0,"MetaData":null,"IsPartial":false,"IsFinal":false,"PartialUploads":null,"Storage":null}`))),
+	}, nil)
+	s3obj.EXPECT().ListParts(context.Background(), &s3.ListPartsInput{
+		Bucket:   aws.String("bucket"),
+		Key:      aws.String("uploadId"),
+		UploadId: aws.String("multipartId"),
+	}).Return(&s3.ListPartsOutput{
+		Parts: []types.Part{
+			{
+				Size:           aws.Int64(4),
+				ETag:           aws.String("etag-1"),
+				PartNumber:     aws.Int32(1),
+				ChecksumCRC32C: aws.String("crc-1"),
+			},
+		},
+	}, nil)
+	s3obj.EXPECT().HeadObject(context.Background(), &s3.HeadObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("uploadId.part"),
+	}).Return(nil, &types.NotFound{})
+
+	s3obj.EXPECT().UploadPart(context.Background(), NewUploadPartInputMatcher(&s3.UploadPartInput{
+		Bucket:            aws.String("bucket"),
+		Key:               aws.String("uploadId"),
+		UploadId:          aws.String("multipartId"),
+		PartNumber:        aws.Int32(2),
+		Body:              bytes.NewReader([]byte("5678")),
+		ChecksumAlgorithm: types.ChecksumAlgorithmCrc32c,
+	})).Return(&s3.UploadPartOutput{
+		ETag:           aws.String("etag-2"),
+		ChecksumCRC32C: aws.String("crc-2"),
+	}, nil)
+
+	// The checksums of the listed and the uploaded part are used for completing
+	// the multipart upload.
+	s3obj.EXPECT().CompleteMultipartUpload(context.Background(), &s3.CompleteMultipartUploadInput{
+		Bucket:   aws.String("bucket"),
+		Key:      aws.String("uploadId"),
+		UploadId: aws.String("multipartId"),
+		MultipartUpload: &types.CompletedMultipartUpload{
+			Parts: []types.CompletedPart{
+				{
+					ETag:           aws.String("etag-1"),
+					PartNumber:     aws.Int32(1),
+					ChecksumCRC32C: aws.String("crc-1"),
+				},
+				{
+					ETag:           aws.String("etag-2"),
+					PartNumber:     aws.Int32(2),
+					ChecksumCRC32C: aws.String("crc-2"),
+				},
+			},
+		},
+	}).Return(&s3.CompleteMultipartUploadOutput{}, nil)
+
+	upload, err := store.GetUpload(context.Background(), "uploadId+multipartId")
+	assert.Nil(err)
+
+	bytesRead, err := upload.WriteChunk(context.Background(), 4, bytes.NewReader([]byte("5678")))
+	assert.Nil(err)
+	assert.Equal(int64(4), bytesRead)
+
+	err = upload.FinishUpload(context.Background())
+	assert.Nil(err)
+}
+
+func TestParseChecksumAlgorithm(t *testing.T) {
+	assert := assert.New(t)
+
+	algorithm, err := ParseChecksumAlgorithm("crc32c")
+	assert.Nil(err)
+	assert.Equal(types.ChecksumAlgorithmCrc32c, algorithm)
+
+	algorithm, err = ParseChecksumAlgorithm("")
+	assert.Nil(err)
+	assert.Equal(types.ChecksumAlgorithm(""), algorithm)
+
+	_, err = ParseChecksumAlgorithm("md5")
+	assert.NotNil(err)
+}
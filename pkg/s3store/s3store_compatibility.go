@@ -0,0 +1,160 @@
+package s3store
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// Compatibility adjusts the requests of the S3Store to S3-compatible servers,
+// which implement some details of the S3 API differently than AWS S3 or not
+// at all. Instead of configuring each adjustment individually, one of the
+// predefined profiles, such as CompatibilityMinIO, can be used.
+type Compatibility struct {
+	// TrailingChecksums instructs the S3Store to let the AWS SDK calculate a
+	// CRC32 checksum of each part while it is being sent and transmit it in a
+	// trailing header. Otherwise, the SHA256 hash of the part is calculated
+	// before it is sent, which requires reading the part twice. Trailing
+	// checksums are only used over HTTPS and are supported by AWS S3 and
+	// recent versions of MinIO, but not by many other servers.
+	TrailingChecksums bool
+	// SingleObjectDeletes instructs the S3Store to delete objects using one
+	// DeleteObject request per object instead of a single DeleteObjects request,
+	// for servers which do not implement multi-object deletes or mishandle the
+	// keys contained in them.
+	SingleObjectDeletes bool
+	// IgnoreETagQuotes instructs the S3Store to ignore the surrounding quotes
+	// when comparing the ETags of parts, since some servers return quoted ETags
+	// in one response and unquoted ETags in another.
+	IgnoreETagQuotes bool
+	// PartNumberMarkerFromParts instructs the S3Store to continue listing the
+	// parts of a multipart upload after the highest part number it has received,
+	// if the server does not return a NextPartNumberMarker for truncated results.
+	PartNumberMarkerFromParts bool
+	// UniformPartSizes indicates that the server requires all parts of a
+	// multipart upload, except for the last one, to have the same size. Since
+	// the partial uploads of a concatenation usually have different sizes, they
+	// are downloaded and concatenated on disk instead of being copied as parts.
+	UniformPartSizes bool
+	// ListPartsRetries is the number of times the parts of a multipart upload
+	// are listed again, if the listed part numbers contain a gap. Servers whose
+	// ListParts responses are eventually consistent might not include parts
+	// which have been uploaded just before, in particular if parts are uploaded
+	// concurrently. Between the attempts, the S3Store waits for ListPartsRetryDelay.
+	ListPartsRetries    int
+	ListPartsRetryDelay time.Duration
+	// InfoObjectChecks is the number of times the S3Store checks whether the
+	// .info object of a new upload can be read, before the creation of the upload
+	// is reported as successful. Servers which are only eventually consistent for
+	// new objects might otherwise respond to a HEAD request sent right after the
+	// creation with 404 Not Found. Between the checks, the S3Store waits for
+	// InfoObjectCheckDelay. If zero, no checks are performed.
+	InfoObjectChecks     int
+	InfoObjectCheckDelay time.Duration
+	// MaxMultipartParts and MaxObjectSize override the corresponding limits of
+	// the S3Store, if they are not zero. They are applied by SetCompatibility.
+	MaxMultipartParts int64
+	MaxObjectSize     int64
+}
+
+var (
+	// CompatibilityAWS is the default profile for AWS S3 and servers which
+	// closely follow its behavior.
+	CompatibilityAWS = Compatibility{}
+	// CompatibilityMinIO is the profile for MinIO. It uses trailing checksums,
+	// which MinIO supports, and works around the differences in ETags and the
+	// pagination of parts found in some versions.
+	CompatibilityMinIO = Compatibility{
+		TrailingChecksums:         true,
+		IgnoreETagQuotes:          true,
+		PartNumberMarkerFromParts: true,
+	}
+	// CompatibilityGeneric is a conservative profile for other S3-compatible
+	// servers, such as Ceph RGW or the S3 APIs of other cloud providers.
+	CompatibilityGeneric = Compatibility{
+		SingleObjectDeletes:       true,
+		IgnoreETagQuotes:          true,
+		PartNumberMarkerFromParts: true,
+	}
+	// CompatibilityR2 is the profile for Cloudflare R2. R2 does not support
+	// checksum headers, requires parts of equal size and limits objects to
+	// 4.995 TiB. Its ListParts responses might lag behind recently uploaded parts.
+	CompatibilityR2 = Compatibility{
+		IgnoreETagQuotes:          true,
+		PartNumberMarkerFromParts: true,
+		UniformPartSizes:          true,
+		ListPartsRetries:          3,
+		ListPartsRetryDelay:       500 * time.Millisecond,
+		MaxMultipartParts:         10000,
+		MaxObjectSize:             5*1024*1024*1024*1024 - 5*1024*1024*1024,
+	}
+)
+
+// CompatibilityProfile returns the predefined profile with the given name,
+// which is either "aws", "minio", "r2" or "generic".
+func CompatibilityProfile(name string) (Compatibility, error) {
+	switch name {
+	case "aws":
+		return CompatibilityAWS, nil
+	case "minio":
+		return CompatibilityMinIO, nil
+	case "r2":
+		return CompatibilityR2, nil
+	case "generic":
+		return CompatibilityGeneric, nil
+	default:
+		return Compatibility{}, fmt.Errorf("s3store: unknown compatibility profile %q", name)
+	}
+}
+
+// SetCompatibility sets the compatibility profile of the store and applies
+// the limits contained in it.
+func (store *S3Store) SetCompatibility(compatibility Compatibility) {
+	store.Compatibility = compatibility
+	if compatibility.MaxMultipartParts > 0 {
+		store.MaxMultipartParts = compatibility.MaxMultipartParts
+	}
+	if compatibility.MaxObjectSize > 0 {
+		store.MaxObjectSize = compatibility.MaxObjectSize
+	}
+}
+
+// etagsEqual compares the ETags of parts according to the compatibility profile.
+func (store S3Store) etagsEqual(a string, b string) bool {
+	if store.Compatibility.IgnoreETagQuotes {
+		return strings.Trim(a, `"`) == strings.Trim(b, `"`)
+	}
+
+	return a == b
+}
+
+// nextPartNumberMarker returns the marker for listing the next page of parts
+// after the given, truncated result.
+func (store S3Store) nextPartNumberMarker(res *s3.ListPartsOutput, previous *string) *string {
+	marker := res.NextPartNumberMarker
+	if !store.Compatibility.PartNumberMarkerFromParts || len(res.Parts) == 0 {
+		return marker
+	}
+
+	if marker == nil || *marker == "" || *marker == "0" || aws.ToString(marker) == aws.ToString(previous) {
+		lastPart := res.Parts[len(res.Parts)-1]
+		marker = aws.String(strconv.FormatInt(int64(aws.ToInt32(lastPart.PartNumber)), 10))
+	}
+
+	return marker
+}
+
+// hasMissingParts reports whether the part numbers of the listed parts contain
+// a gap, which indicates that the listing is not consistent yet.
+func hasMissingParts(parts []*s3Part) bool {
+	for i, part := range parts {
+		if part.number != int32(i+1) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,308 @@
+package s3store
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/tus/tusd/v2/pkg/handler"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+func TestCompatibilityProfile(t *testing.T) {
+	assert := assert.New(t)
+
+	profile, err := CompatibilityProfile("minio")
+	assert.Nil(err)
+	assert.Equal(CompatibilityMinIO, profile)
+
+	_, err = CompatibilityProfile("unknown")
+	assert.NotNil(err)
+}
+
+func TestTerminateSingleObjectDeletes(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	s3obj := NewMockS3API(mockCtrl)
+	store := New("bucket", s3obj)
+	store.Compatibility = CompatibilityGeneric
+
+	// Order is not important in this situation.
+	s3obj.EXPECT().GetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("uploadId.info"),
+	}).Return(nil, &types.NoSuchKey{})
+
+	s3obj.EXPECT().AbortMultipartUpload(context.Background(), &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String("bucket"),
+		Key:      aws.String("uploadId"),
+		UploadId: aws.String("multipartId"),
+	}).Return(nil, nil)
+
+	s3obj.EXPECT().DeleteObject(context.Background(), &s3.DeleteObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("uploadId"),
+	}).Return(&s3.DeleteObjectOutput{}, nil)
+	s3obj.EXPECT().DeleteObject(context.Background(), &s3.DeleteObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("uploadId.part"),
+	}).Return(nil, &types.NoSuchKey{})
+	s3obj.EXPECT().DeleteObject(context.Background(), &s3.DeleteObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("uploadId.info"),
+	}).Return(&s3.DeleteObjectOutput{}, nil)
+
+	upload, err := store.GetUpload(context.Background(), "uploadId+multipartId")
+	assert.Nil(err)
+
+	err = store.AsTerminatableUpload(upload).Terminate(context.Background())
+	assert.Nil(err)
+}
+
+func TestGetInfoPartNumberMarkerFromParts(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	s3obj := NewMockS3API(mockCtrl)
+	store := New("bucket", s3obj)
+	store.Compatibility = CompatibilityMinIO
+
+	s3obj.EXPECT().GetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("uploadId.info"),
+	}).Return(&s3.GetObjectOutput{
+		Body: io.NopCloser(bytes.NewReader([]byte(`{"ID":"uploadId+multipartId","Size":500,"Offset":0,"MetaData":null,"IsPartial":false,"IsFinal":false,"PartialUploads":null,"Storage":null}`))),
+	}, nil)
+	s3obj.EXPECT().ListParts(context.Background(), &s3.ListPartsInput{
+		Bucket:   aws.String("bucket"),
+		Key:      aws.String("uploadId"),
+		UploadId: aws.String("multipartId"),
+	}).Return(&s3.ListPartsOutput{
+		Parts: []types.Part{
+			{
+				PartNumber: aws.Int32(1),
+				Size:       aws.Int64(100),
+				ETag:       aws.String("etag-1"),
+			},
+			{
+				PartNumber: aws.Int32(2),
+				Size:       aws.Int64(200),
+				ETag:       aws.String("etag-2"),
+			},
+		},
+		// The server does not include the marker for the next page.
+		IsTruncated: aws.Bool(true),
+	}, nil)
+	s3obj.EXPECT().ListParts(context.Background(), &s3.ListPartsInput{
+		Bucket:           aws.String("bucket"),
+		Key:              aws.String("uploadId"),
+		UploadId:         aws.String("multipartId"),
+		PartNumberMarker: aws.String("2"),
+	}).Return(&s3.ListPartsOutput{
+		Parts: []types.Part{
+			{
+				PartNumber: aws.Int32(3),
+				Size:       aws.Int64(100),
+				ETag:       aws.String("etag-3"),
+			},
+		},
+	}, nil)
+	s3obj.EXPECT().HeadObject(context.Background(), &s3.HeadObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("uploadId.part"),
+	}).Return(nil, &types.NoSuchKey{})
+
+	upload, err := store.GetUpload(context.Background(), "uploadId+multipartId")
+	assert.Nil(err)
+
+	info, err := upload.GetInfo(context.Background())
+	assert.Nil(err)
+	assert.Equal(int64(400), info.Offset)
+}
+
+func TestETagsEqual(t *testing.T) {
+	assert := assert.New(t)
+
+	store := New("bucket", nil)
+	assert.False(store.etagsEqual(`"etag"`, "etag"))
+
+	store.Compatibility = CompatibilityMinIO
+	assert.True(store.etagsEqual(`"etag"`, "etag"))
+	assert.False(store.etagsEqual(`"etag"`, "other"))
+}
+
+func TestSetCompatibility(t *testing.T) {
+	assert := assert.New(t)
+
+	store := New("bucket", nil)
+	store.SetCompatibility(CompatibilityR2)
+	assert.Equal(CompatibilityR2, store.Compatibility)
+	assert.Equal(int64(10000), store.MaxMultipartParts)
+	assert.Equal(CompatibilityR2.MaxObjectSize, store.MaxObjectSize)
+
+	store = New("bucket", nil)
+	store.SetCompatibility(CompatibilityMinIO)
+	assert.Equal(int64(5*1024*1024*1024*1024), store.MaxObjectSize)
+}
+
+func TestListAllPartsRetriesMissingParts(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	s3obj := NewMockS3API(mockCtrl)
+	store := New("bucket", s3obj)
+	store.Compatibility = CompatibilityR2
+	store.Compatibility.ListPartsRetryDelay = 0
+
+	input := &s3.ListPartsInput{
+		Bucket:   aws.String("bucket"),
+		Key:      aws.String("uploadId"),
+		UploadId: aws.String("multipartId"),
+	}
+
+	gomock.InOrder(
+		s3obj.EXPECT().ListParts(context.Background(), input).Return(&s3.ListPartsOutput{
+			Parts: []types.Part{
+				{PartNumber: aws.Int32(1), Size: aws.Int64(100), ETag: aws.String("etag-1")},
+				{PartNumber: aws.Int32(3), Size: aws.Int64(100), ETag: aws.String("etag-3")},
+			},
+		}, nil),
+		s3obj.EXPECT().ListParts(context.Background(), input).Return(&s3.ListPartsOutput{
+			Parts: []types.Part{
+				{PartNumber: aws.Int32(1), Size: aws.Int64(100), ETag: aws.String("etag-1")},
+				{PartNumber: aws.Int32(2), Size: aws.Int64(100), ETag: aws.String("etag-2")},
+				{PartNumber: aws.Int32(3), Size: aws.Int64(100), ETag: aws.String("etag-3")},
+			},
+		}, nil),
+	)
+
+	parts, err := store.listAllParts(context.Background(), "uploadId", "multipartId")
+	assert.Nil(err)
+	assert.Len(parts, 3)
+	assert.Equal("etag-2", parts[1].etag)
+}
+
+func TestConcatUploadsUniformPartSizes(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	s3obj := NewMockS3API(mockCtrl)
+	store := New("bucket", s3obj)
+	store.MinPartSize = 2
+	store.Compatibility = CompatibilityR2
+
+	gomock.InOrder(
+		s3obj.EXPECT().GetObject(context.Background(), &s3.GetObjectInput{
+			Bucket: aws.String("bucket"),
+			Key:    aws.String("aaa"),
+		}).Return(&s3.GetObjectOutput{
+			Body: io.NopCloser(bytes.NewReader([]byte("aaa"))),
+		}, nil),
+		s3obj.EXPECT().GetObject(context.Background(), &s3.GetObjectInput{
+			Bucket: aws.String("bucket"),
+			Key:    aws.String("bbb"),
+		}).Return(&s3.GetObjectOutput{
+			Body: io.NopCloser(bytes.NewReader([]byte("bbbb"))),
+		}, nil),
+		s3obj.EXPECT().PutObject(context.Background(), NewPutObjectInputMatcher(&s3.PutObjectInput{
+			Bucket: aws.String("bucket"),
+			Key:    aws.String("uploadId"),
+			Body:   bytes.NewReader([]byte("aaabbbb")),
+		})),
+		s3obj.EXPECT().AbortMultipartUpload(context.Background(), &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String("bucket"),
+			Key:      aws.String("uploadId"),
+			UploadId: aws.String("multipartId"),
+		}).Return(nil, nil),
+	)
+
+	upload, err := store.GetUpload(context.Background(), "uploadId+multipartId")
+	assert.Nil(err)
+
+	uploadA, err := store.GetUpload(context.Background(), "aaa+AAA")
+	assert.Nil(err)
+	uploadB, err := store.GetUpload(context.Background(), "bbb+BBB")
+	assert.Nil(err)
+
+	// Both uploads are larger than the MinPartSize, but have different sizes, so
+	// they are downloaded for concatenation.
+	uploadA.(*s3Upload).info = &handler.FileInfo{Size: 3}
+	uploadB.(*s3Upload).info = &handler.FileInfo{Size: 4}
+
+	err = store.AsConcatableUpload(upload).ConcatUploads(context.Background(), []handler.Upload{
+		uploadA,
+		uploadB,
+	})
+	assert.Nil(err)
+
+	// Wait a short delay until the call to AbortMultipartUpload also occurs.
+	<-time.After(10 * time.Millisecond)
+}
+
+func TestNewUploadWaitsForInfoObject(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	s3obj := NewMockS3API(mockCtrl)
+	store := New("bucket", s3obj)
+	store.Compatibility.InfoObjectChecks = 3
+
+	headInput := &s3.HeadObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("uploadId.info"),
+	}
+
+	gomock.InOrder(
+		s3obj.EXPECT().CreateMultipartUpload(context.Background(), gomock.Any()).Return(&s3.CreateMultipartUploadOutput{
+			UploadId: aws.String("multipartId"),
+		}, nil),
+		s3obj.EXPECT().PutObject(context.Background(), gomock.Any()).Return(&s3.PutObjectOutput{}, nil),
+		s3obj.EXPECT().HeadObject(context.Background(), headInput).Return(nil, &types.NotFound{}),
+		s3obj.EXPECT().HeadObject(context.Background(), headInput).Return(&s3.HeadObjectOutput{}, nil),
+	)
+
+	upload, err := store.NewUpload(context.Background(), handler.FileInfo{
+		ID:   "uploadId",
+		Size: 500,
+	})
+	assert.Nil(err)
+	assert.NotNil(upload)
+}
+
+func TestNewUploadInfoObjectNotVisible(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	s3obj := NewMockS3API(mockCtrl)
+	store := New("bucket", s3obj)
+	store.Compatibility.InfoObjectChecks = 2
+
+	gomock.InOrder(
+		s3obj.EXPECT().CreateMultipartUpload(context.Background(), gomock.Any()).Return(&s3.CreateMultipartUploadOutput{
+			UploadId: aws.String("multipartId"),
+		}, nil),
+		s3obj.EXPECT().PutObject(context.Background(), gomock.Any()).Return(&s3.PutObjectOutput{}, nil),
+		s3obj.EXPECT().HeadObject(context.Background(), gomock.Any()).Return(nil, &types.NoSuchKey{}).Times(2),
+	)
+
+	upload, err := store.NewUpload(context.Background(), handler.FileInfo{
+		ID:   "uploadId",
+		Size: 500,
+	})
+	assert.Nil(upload)
+	assert.EqualError(err, "s3store: info file is not visible after 2 checks")
+}
@@ -0,0 +1,39 @@
+package s3store
+
+import (
+	"net/http"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/tus/tusd/v2/pkg/handler"
+)
+
+// ErrInfoConflict is returned if ConditionalInfoWrites is enabled and the .info
+// object of an upload was changed by another request since it was read. This
+// means that the lock for the upload was not exclusive, e.g. because it expired
+// or the locker is not shared by all instances. Nothing is overwritten and the
+// cached info is dropped, so that a retried request reads the current info
+// after acquiring the lock again.
+var ErrInfoConflict = handler.NewError("ERR_INFO_CONFLICT", "upload was modified by a concurrent request, please retry", http.StatusConflict)
+
+// infoWriteOptions returns the options for writing the .info object of upload.
+// If ConditionalInfoWrites is enabled and the ETag of the .info object is known,
+// the write only succeeds if the object has not changed since.
+func (upload s3Upload) infoWriteOptions() []func(*s3.Options) {
+	if !upload.store.ConditionalInfoWrites || upload.infoETag == "" {
+		return nil
+	}
+
+	return []func(*s3.Options){
+		func(o *s3.Options) {
+			o.APIOptions = append(o.APIOptions, smithyhttp.SetHeaderValue("If-Match", upload.infoETag))
+		},
+	}
+}
+
+// isInfoConflict reports whether a conditional write of an .info object failed
+// because the object has changed. S3 responds with 412 Precondition Failed or,
+// if another conditional write is in progress, with 409 Conflict.
+func isInfoConflict(err error) bool {
+	return isAwsErrorCode(err, "PreconditionFailed") || isAwsErrorCode(err, "ConditionalRequestConflict")
+}
@@ -0,0 +1,103 @@
+package s3store
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+func TestConditionalInfoWrites(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	s3obj := NewMockS3API(mockCtrl)
+	store := New("bucket", s3obj)
+	store.ConditionalInfoWrites = true
+
+	expectFetchInfo := func(etag string) {
+		s3obj.EXPECT().GetObject(context.Background(), &s3.GetObjectInput{
+			Bucket: aws.String("bucket"),
+			Key:    aws.String("uploadId.info"),
+		}).Return(&s3.GetObjectOutput{
+			Body: io.NopCloser(bytes.NewReader([]byte(`{"ID":"uploadId+multipartId","Size":0,"SizeIsDeferred":true,"Offset":0,"MetaData":{},"IsPartial":false,"IsFinal":false,"PartialUploads":null,"Storage":{"Bucket":"bucket","Key":"uploadId","Type":"s3store"}}`))),
+			ETag: aws.String(etag),
+		}, nil)
+		s3obj.EXPECT().ListParts(context.Background(), &s3.ListPartsInput{
+			Bucket:           aws.String("bucket"),
+			Key:              aws.String("uploadId"),
+			UploadId:         aws.String("multipartId"),
+			PartNumberMarker: nil,
+		}).Return(&s3.ListPartsOutput{
+			Parts: []types.Part{},
+		}, nil)
+		s3obj.EXPECT().HeadObject(context.Background(), &s3.HeadObjectInput{
+			Bucket: aws.String("bucket"),
+			Key:    aws.String("uploadId.part"),
+		}).Return(nil, &types.NotFound{})
+	}
+
+	putInfo := func(etag string, err error) func(ctx context.Context, input *s3.PutObjectInput, opts ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+		return func(ctx context.Context, input *s3.PutObjectInput, opts ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+			assert.Equal("uploadId.info", *input.Key)
+			assert.Len(opts, 1)
+			if err != nil {
+				return nil, err
+			}
+			return &s3.PutObjectOutput{ETag: aws.String(etag)}, nil
+		}
+	}
+
+	// Both writes are conditional. The first one uses the ETag which was read,
+	// the second one the ETag returned by the first write.
+	expectFetchInfo(`"info-1"`)
+	s3obj.EXPECT().PutObject(context.Background(), gomock.Any(), gomock.Any()).DoAndReturn(putInfo(`"info-2"`, nil))
+	s3obj.EXPECT().PutObject(context.Background(), gomock.Any(), gomock.Any()).DoAndReturn(putInfo("", &smithy.GenericAPIError{Code: "PreconditionFailed", Message: "At least one of the pre-conditions you specified did not hold"}))
+	expectFetchInfo(`"info-3"`)
+
+	upload, err := store.GetUpload(context.Background(), "uploadId+multipartId")
+	assert.Nil(err)
+
+	err = store.AsLengthDeclarableUpload(upload).DeclareLength(context.Background(), 500)
+	assert.Nil(err)
+	assert.Equal(`"info-2"`, upload.(*s3Upload).infoETag)
+
+	err = store.AsExpirableUpload(upload).SetExpiration(context.Background(), time.Now())
+	assert.ErrorIs(err, ErrInfoConflict)
+
+	// The cached info is dropped, so it is read again.
+	info, err := upload.GetInfo(context.Background())
+	assert.Nil(err)
+	assert.True(info.SizeIsDeferred)
+	assert.Equal(`"info-3"`, upload.(*s3Upload).infoETag)
+}
+
+func TestConditionalInfoWritesWithoutETag(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	s3obj := NewMockS3API(mockCtrl)
+	store := New("bucket", s3obj)
+	store.ConditionalInfoWrites = true
+
+	// New uploads have no ETag yet, so the .info object is written unconditionally.
+	upload := &s3Upload{"uploadId", "multipartId", "", &store, nil, []*s3Part{}, 0, ""}
+	assert.Nil(upload.infoWriteOptions())
+
+	upload.infoETag = `"info-1"`
+	assert.Len(upload.infoWriteOptions(), 1)
+
+	store.ConditionalInfoWrites = false
+	assert.Nil(upload.infoWriteOptions())
+}
@@ -0,0 +1,56 @@
+package s3store
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/tus/tusd/v2/pkg/handler"
+	"github.com/tus/tusd/v2/pkg/storetest"
+)
+
+// TestConformance runs the conformance suite against an S3-compatible service,
+// such as MinIO or localstack. It is skipped unless the TUSD_TEST_S3_ENDPOINT
+// and TUSD_TEST_S3_BUCKET environment variables are set. The bucket must exist
+// and credentials are read from AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY.
+func TestConformance(t *testing.T) {
+	endpoint := os.Getenv("TUSD_TEST_S3_ENDPOINT")
+	bucket := os.Getenv("TUSD_TEST_S3_BUCKET")
+	if endpoint == "" || bucket == "" {
+		t.Skip("TUSD_TEST_S3_ENDPOINT and TUSD_TEST_S3_BUCKET are not set")
+	}
+
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	client := s3.New(s3.Options{
+		Region:       region,
+		BaseEndpoint: aws.String(endpoint),
+		UsePathStyle: true,
+		Credentials: aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+			return aws.Credentials{
+				AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+				SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			}, nil
+		}),
+	})
+
+	store := New(bucket, client)
+	// Separate the objects of every run, so that the bucket can be reused.
+	store.ObjectPrefix = "storetest/" + strconv.FormatInt(time.Now().UnixNano(), 36) + "/"
+
+	composer := handler.NewStoreComposer()
+	store.UseIn(composer)
+
+	// The large upload spans multiple parts of the default part size.
+	storetest.Run(t, composer, storetest.Options{
+		LargeUploadSize: 64 * 1024 * 1024,
+		LargeChunkSize:  20 * 1024 * 1024,
+	})
+}
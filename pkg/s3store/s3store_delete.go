@@ -0,0 +1,174 @@
+package s3store
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/tus/tusd/v2/internal/semaphore"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// deleteObjectsBatchSize is the maximum number of keys S3 accepts in a single
+// DeleteObjects request.
+const deleteObjectsBatchSize = 1000
+
+// deleteRetries is the number of times the deletion of objects is retried
+// after a transient failure, such as S3 asking to slow down.
+const deleteRetries = 3
+
+// deleteRetryBackoff is the delay before the first retry. It is doubled for
+// each further retry.
+var deleteRetryBackoff = 200 * time.Millisecond
+
+// retryableDeleteErrors are the error codes for which the deletion of an object
+// is retried.
+var retryableDeleteErrors = map[string]bool{
+	"SlowDown":           true,
+	"InternalError":      true,
+	"ServiceUnavailable": true,
+	"RequestTimeout":     true,
+}
+
+// SetConcurrentDeletes changes the limit on how many delete requests are sent
+// to S3 concurrently. The limit is shared by all terminations, so that cleaning
+// up many uploads at once does not exceed S3's request rate.
+func (store *S3Store) SetConcurrentDeletes(limit int) {
+	store.deleteSemaphore = semaphore.New(limit)
+}
+
+// deleteObjects deletes the given objects and returns the errors for objects
+// which could not be deleted. Objects which do not exist are not considered
+// an error. The objects are deleted using DeleteObjects requests of up to 1000
+// keys, or one DeleteObject request per object if the server does not support
+// the former. The requests are sent concurrently, limited by
+// SetConcurrentDeletes, and objects which failed temporarily are retried.
+func (store S3Store) deleteObjects(ctx context.Context, objects []types.ObjectIdentifier) []error {
+	batchSize := deleteObjectsBatchSize
+	if store.Compatibility.SingleObjectDeletes {
+		batchSize = 1
+	}
+
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	var errs []error
+	for start := 0; start < len(objects); start += batchSize {
+		end := start + batchSize
+		if end > len(objects) {
+			end = len(objects)
+		}
+
+		wg.Add(1)
+		go func(batch []types.ObjectIdentifier) {
+			defer wg.Done()
+
+			batchErrs := store.deleteBatch(ctx, batch)
+
+			mutex.Lock()
+			errs = append(errs, batchErrs...)
+			mutex.Unlock()
+		}(objects[start:end])
+	}
+	wg.Wait()
+
+	return errs
+}
+
+// deleteBatch deletes the objects of a single request and retries the objects
+// which failed temporarily.
+func (store S3Store) deleteBatch(ctx context.Context, objects []types.ObjectIdentifier) []error {
+	var errs []error
+	backoff := deleteRetryBackoff
+	for attempt := 0; ; attempt++ {
+		retry, retryErrs, permanentErrs := store.deleteBatchOnce(ctx, objects)
+		errs = append(errs, permanentErrs...)
+		if len(retry) == 0 || attempt == deleteRetries {
+			return append(errs, retryErrs...)
+		}
+
+		select {
+		case <-ctx.Done():
+			return append(errs, retryErrs...)
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		objects = retry
+	}
+}
+
+// deleteBatchOnce sends a single request for deleting the objects. It returns
+// the objects which can be retried together with the errors for them, and the
+// errors for the objects which cannot be deleted.
+func (store S3Store) deleteBatchOnce(ctx context.Context, objects []types.ObjectIdentifier) (retry []types.ObjectIdentifier, retryErrs []error, errs []error) {
+	if store.deleteSemaphore != nil {
+		store.deleteSemaphore.Acquire()
+		defer store.deleteSemaphore.Release()
+	}
+
+	if store.Compatibility.SingleObjectDeletes {
+		object := objects[0]
+		t := time.Now()
+		_, err := store.Service.DeleteObject(ctx, &s3.DeleteObjectInput{
+			Bucket:    aws.String(store.Bucket),
+			Key:       object.Key,
+			VersionId: object.VersionId,
+		})
+		store.observeRequest(ctx, t, metricDeleteObject, err)
+		if err == nil || isAwsError[*types.NoSuchKey](err) {
+			return nil, nil, nil
+		}
+		if isRetryableDeleteError(err) {
+			return objects, []error{err}, nil
+		}
+		return nil, nil, []error{err}
+	}
+
+	t := time.Now()
+	res, err := store.Service.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+		Bucket: aws.String(store.Bucket),
+		Delete: &types.Delete{
+			Objects: objects,
+			Quiet:   aws.Bool(true),
+		},
+	})
+	store.observeRequest(ctx, t, metricDeleteObjects, err)
+	if err != nil {
+		if isRetryableDeleteError(err) {
+			return objects, []error{err}, nil
+		}
+		return nil, nil, []error{err}
+	}
+
+	for _, s3Err := range res.Errors {
+		if *s3Err.Code == "NoSuchKey" {
+			continue
+		}
+
+		err := fmt.Errorf("AWS S3 Error (%s) for object %s: %s", *s3Err.Code, *s3Err.Key, *s3Err.Message)
+		if retryableDeleteErrors[*s3Err.Code] {
+			retry = append(retry, types.ObjectIdentifier{
+				Key:       s3Err.Key,
+				VersionId: s3Err.VersionId,
+			})
+			retryErrs = append(retryErrs, err)
+		} else {
+			errs = append(errs, err)
+		}
+	}
+
+	return retry, retryErrs, errs
+}
+
+func isRetryableDeleteError(err error) bool {
+	for code := range retryableDeleteErrors {
+		if isAwsErrorCode(err, code) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,127 @@
+package s3store
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+func TestDeleteObjectsBatches(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	s3obj := NewMockS3API(mockCtrl)
+	store := New("bucket", s3obj)
+	store.SetConcurrentDeletes(1)
+
+	objects := make([]types.ObjectIdentifier, 2500)
+	for i := range objects {
+		objects[i] = types.ObjectIdentifier{Key: aws.String("key" + strconv.Itoa(i))}
+	}
+
+	// The requests must not overlap, since only one is allowed at a time.
+	var inFlight int32
+	var sizes []int
+	s3obj.EXPECT().DeleteObjects(context.Background(), gomock.Any()).Times(3).DoAndReturn(func(ctx context.Context, input *s3.DeleteObjectsInput, opts ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error) {
+		assert.Equal(int32(1), atomic.AddInt32(&inFlight, 1))
+		defer atomic.AddInt32(&inFlight, -1)
+
+		assert.Equal("bucket", *input.Bucket)
+		assert.True(aws.ToBool(input.Delete.Quiet))
+		sizes = append(sizes, len(input.Delete.Objects))
+		time.Sleep(5 * time.Millisecond)
+		return &s3.DeleteObjectsOutput{}, nil
+	})
+
+	errs := store.deleteObjects(context.Background(), objects)
+	assert.Empty(errs)
+	sort.Ints(sizes)
+	assert.Equal([]int{500, 1000, 1000}, sizes)
+}
+
+func TestDeleteObjectsRetry(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	deleteRetryBackoff = time.Millisecond
+	defer func() { deleteRetryBackoff = 200 * time.Millisecond }()
+
+	s3obj := NewMockS3API(mockCtrl)
+	store := New("bucket", s3obj)
+
+	gomock.InOrder(
+		s3obj.EXPECT().DeleteObjects(context.Background(), &s3.DeleteObjectsInput{
+			Bucket: aws.String("bucket"),
+			Delete: &types.Delete{
+				Objects: []types.ObjectIdentifier{
+					{Key: aws.String("a")},
+					{Key: aws.String("b")},
+					{Key: aws.String("c")},
+				},
+				Quiet: aws.Bool(true),
+			},
+		}).Return(&s3.DeleteObjectsOutput{
+			Errors: []types.Error{
+				{Code: aws.String("SlowDown"), Key: aws.String("a"), Message: aws.String("Please reduce your request rate.")},
+				{Code: aws.String("AccessDenied"), Key: aws.String("b"), Message: aws.String("Access Denied")},
+			},
+		}, nil),
+		// Only the object which failed temporarily is retried.
+		s3obj.EXPECT().DeleteObjects(context.Background(), &s3.DeleteObjectsInput{
+			Bucket: aws.String("bucket"),
+			Delete: &types.Delete{
+				Objects: []types.ObjectIdentifier{{Key: aws.String("a")}},
+				Quiet:   aws.Bool(true),
+			},
+		}).Return(nil, &smithy.GenericAPIError{Code: "SlowDown", Message: "Please reduce your request rate."}),
+		s3obj.EXPECT().DeleteObjects(context.Background(), &s3.DeleteObjectsInput{
+			Bucket: aws.String("bucket"),
+			Delete: &types.Delete{
+				Objects: []types.ObjectIdentifier{{Key: aws.String("a")}},
+				Quiet:   aws.Bool(true),
+			},
+		}).Return(&s3.DeleteObjectsOutput{}, nil),
+	)
+
+	errs := store.deleteObjects(context.Background(), []types.ObjectIdentifier{
+		{Key: aws.String("a")},
+		{Key: aws.String("b")},
+		{Key: aws.String("c")},
+	})
+	assert.Len(errs, 1)
+	assert.Equal("AWS S3 Error (AccessDenied) for object b: Access Denied", errs[0].Error())
+}
+
+func TestDeleteObjectsRetryExhausted(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	deleteRetryBackoff = time.Millisecond
+	defer func() { deleteRetryBackoff = 200 * time.Millisecond }()
+
+	s3obj := NewMockS3API(mockCtrl)
+	store := New("bucket", s3obj)
+	store.Compatibility = CompatibilityGeneric
+
+	s3obj.EXPECT().DeleteObject(context.Background(), &s3.DeleteObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("a"),
+	}).Times(deleteRetries+1).Return(nil, &smithy.GenericAPIError{Code: "InternalError", Message: "We encountered an internal error."})
+
+	errs := store.deleteObjects(context.Background(), []types.ObjectIdentifier{{Key: aws.String("a")}})
+	assert.Len(errs, 1)
+}
@@ -0,0 +1,251 @@
+package s3store
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// directoryBucketSuffix is the suffix of all names of directory buckets. The
+// full name has the form bucket-base-name--zone-id--x-s3, for example
+// my-bucket--usw2-az1--x-s3.
+const directoryBucketSuffix = "--x-s3"
+
+// directoryBucketService is the name of the service used for signing requests
+// to directory buckets.
+const directoryBucketService = "s3express"
+
+// sessionTokenHeader carries the session token in requests to directory buckets.
+// It replaces the X-Amz-Security-Token header used with temporary credentials.
+const sessionTokenHeader = "X-Amz-S3session-Token"
+
+// emptyPayloadHash is the SHA256 hash of an empty request body.
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// IsDirectoryBucket reports whether the bucket is a directory bucket used by
+// the S3 Express One Zone storage class.
+func IsDirectoryBucket(bucket string) bool {
+	return strings.HasSuffix(bucket, directoryBucketSuffix)
+}
+
+// DirectoryBucketEndpoint returns the zonal endpoint of a directory bucket in
+// the given region, for example https://s3express-usw2-az1.us-west-2.amazonaws.com
+// for the bucket my-bucket--usw2-az1--x-s3. The bucket's name is not included in
+// the endpoint, since it is added by the S3 client.
+func DirectoryBucketEndpoint(bucket string, region string) (string, error) {
+	if !IsDirectoryBucket(bucket) {
+		return "", fmt.Errorf("s3store: %s is not the name of a directory bucket", bucket)
+	}
+	if region == "" {
+		return "", fmt.Errorf("s3store: region is required for directory bucket %s", bucket)
+	}
+
+	name := strings.TrimSuffix(bucket, directoryBucketSuffix)
+	index := strings.LastIndex(name, "--")
+	if index == -1 || index+2 == len(name) {
+		return "", fmt.Errorf("s3store: directory bucket %s does not contain a zone ID", bucket)
+	}
+	zoneId := name[index+2:]
+
+	return "https://s3express-" + zoneId + "." + region + ".amazonaws.com", nil
+}
+
+// UseDirectoryBucketSessions returns an option for s3.New or s3.NewFromConfig,
+// which configures the S3 client to authenticate requests to the directory
+// bucket using sessions. The credentials configured for the client are used to
+// create the sessions, so they must grant the s3express:CreateSession
+// permission for the bucket. If no custom endpoint has been configured, the
+// bucket's zonal endpoint is used. The option must be passed after all other
+// options, which modify the credentials or endpoint.
+//
+// The client must only be used for the given bucket, since a session is only
+// valid for a single bucket.
+func UseDirectoryBucketSessions(bucket string) func(*s3.Options) {
+	return func(o *s3.Options) {
+		endpoint := aws.ToString(o.BaseEndpoint)
+		if endpoint == "" {
+			// If the endpoint cannot be derived, requests are sent to the
+			// regional endpoint, where they fail with a descriptive error.
+			endpoint, _ = DirectoryBucketEndpoint(bucket, o.Region)
+			if endpoint != "" {
+				o.BaseEndpoint = aws.String(endpoint)
+			}
+		}
+
+		o.Credentials = aws.NewCredentialsCache(&sessionProvider{
+			bucket:       bucket,
+			endpoint:     endpoint,
+			region:       o.Region,
+			usePathStyle: o.UsePathStyle,
+			credentials:  o.Credentials,
+			client:       o.HTTPClient,
+			signer:       v4.NewSigner(),
+		}, func(co *aws.CredentialsCacheOptions) {
+			// Renew the session shortly before it expires, so that requests
+			// which are being signed do not use an expired session.
+			co.ExpiryWindow = 1 * time.Minute
+		})
+		o.HTTPSignerV4 = newSessionSigner()
+	}
+}
+
+// sessionProvider creates sessions for a directory bucket using the CreateSession
+// API. It is wrapped in an aws.CredentialsCache, so that a session is reused
+// until it expires.
+type sessionProvider struct {
+	bucket       string
+	endpoint     string
+	region       string
+	usePathStyle bool
+	credentials  aws.CredentialsProvider
+	client       s3.HTTPClient
+	signer       *v4.Signer
+}
+
+// createSessionResult is the response body of the CreateSession API.
+type createSessionResult struct {
+	Credentials struct {
+		AccessKeyId     string
+		SecretAccessKey string
+		SessionToken    string
+		Expiration      time.Time
+	}
+}
+
+// Retrieve creates a new session. The session's token is returned as the
+// credentials' session token, which the sessionSigner moves into the
+// X-Amz-S3session-Token header.
+func (p *sessionProvider) Retrieve(ctx context.Context) (aws.Credentials, error) {
+	if p.credentials == nil {
+		return aws.Credentials{}, fmt.Errorf("s3store: credentials are required for creating sessions for directory bucket %s", p.bucket)
+	}
+	if p.endpoint == "" {
+		return aws.Credentials{}, fmt.Errorf("s3store: endpoint is required for creating sessions for directory bucket %s", p.bucket)
+	}
+
+	credentials, err := p.credentials.Retrieve(ctx)
+	if err != nil {
+		return aws.Credentials{}, err
+	}
+
+	sessionURL, err := url.Parse(p.endpoint)
+	if err != nil {
+		return aws.Credentials{}, fmt.Errorf("s3store: invalid endpoint for directory bucket: %w", err)
+	}
+	if p.usePathStyle {
+		sessionURL.Path = "/" + p.bucket
+	} else {
+		sessionURL.Host = p.bucket + "." + sessionURL.Host
+		sessionURL.Path = "/"
+	}
+	sessionURL.RawQuery = "session"
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, sessionURL.String(), nil)
+	if err != nil {
+		return aws.Credentials{}, err
+	}
+	req.Header.Set("X-Amz-Create-Session-Mode", "ReadWrite")
+	req.Header.Set("X-Amz-Content-Sha256", emptyPayloadHash)
+
+	if err := p.signer.SignHTTP(ctx, credentials, req, emptyPayloadHash, directoryBucketService, p.region, time.Now()); err != nil {
+		return aws.Credentials{}, err
+	}
+
+	client := p.client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return aws.Credentials{}, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		buf := new(strings.Builder)
+		io.Copy(buf, res.Body)
+		return aws.Credentials{}, fmt.Errorf("s3store: unexpected response code %d for creating session for directory bucket %s: %s", res.StatusCode, p.bucket, buf.String())
+	}
+
+	var result createSessionResult
+	if err := xml.NewDecoder(res.Body).Decode(&result); err != nil {
+		return aws.Credentials{}, fmt.Errorf("s3store: failed to parse session for directory bucket %s: %w", p.bucket, err)
+	}
+
+	return aws.Credentials{
+		AccessKeyID:     result.Credentials.AccessKeyId,
+		SecretAccessKey: result.Credentials.SecretAccessKey,
+		SessionToken:    result.Credentials.SessionToken,
+		Source:          "s3store.sessionProvider",
+		CanExpire:       true,
+		Expires:         result.Credentials.Expiration,
+	}, nil
+}
+
+// sessionSigner signs requests to directory buckets with session credentials.
+// It implements s3.HTTPSignerV4 and s3.HTTPPresignerV4.
+type sessionSigner struct {
+	signer *v4.Signer
+}
+
+func newSessionSigner() *sessionSigner {
+	return &sessionSigner{
+		signer: v4.NewSigner(func(so *v4.SignerOptions) {
+			// This matches the options of the S3 client's default signer.
+			so.DisableURIPathEscaping = true
+		}),
+	}
+}
+
+func (s *sessionSigner) SignHTTP(ctx context.Context, credentials aws.Credentials, r *http.Request, payloadHash string, service string, region string, signingTime time.Time, optFns ...func(*v4.SignerOptions)) error {
+	r.Header.Del("X-Amz-Security-Token")
+	r.Header.Set(sessionTokenHeader, credentials.SessionToken)
+	credentials.SessionToken = ""
+
+	return s.signer.SignHTTP(ctx, credentials, r, payloadHash, directoryBucketService, region, signingTime, optFns...)
+}
+
+func (s *sessionSigner) PresignHTTP(ctx context.Context, credentials aws.Credentials, r *http.Request, payloadHash string, service string, region string, signingTime time.Time, optFns ...func(*v4.SignerOptions)) (string, http.Header, error) {
+	query := r.URL.Query()
+	query.Del("X-Amz-Security-Token")
+	query.Set(sessionTokenHeader, credentials.SessionToken)
+	r.URL.RawQuery = query.Encode()
+	credentials.SessionToken = ""
+
+	return s.signer.PresignHTTP(ctx, credentials, r, payloadHash, directoryBucketService, region, signingTime, optFns...)
+}
+
+// newPresignClient returns a client for pre-signing requests, which requires
+// that Service is an instance of s3.Client. For directory buckets, the URLs are
+// signed using the session credentials, so they are only valid until the
+// session expires after a few minutes, regardless of the requested expiry.
+func (store S3Store) newPresignClient() (*s3.PresignClient, error) {
+	service := store.Service
+	var clientOptions []func(*s3.Options)
+	if regionService, ok := service.(*regionDiscoveryService); ok {
+		service = regionService.S3API
+		clientOptions = regionService.options(nil)
+	}
+
+	client, ok := service.(*s3.Client)
+	if !ok {
+		return nil, fmt.Errorf("s3store: failed to cast S3 service for presigning")
+	}
+
+	return s3.NewPresignClient(client, func(opts *s3.PresignOptions) {
+		opts.ClientOptions = clientOptions
+		if IsDirectoryBucket(store.Bucket) {
+			opts.Presigner = newSessionSigner()
+		}
+	}), nil
+}
@@ -0,0 +1,84 @@
+package s3store
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDirectoryBucketEndpoint(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(IsDirectoryBucket("bucket--usw2-az1--x-s3"))
+	assert.False(IsDirectoryBucket("bucket"))
+
+	endpoint, err := DirectoryBucketEndpoint("my--bucket--usw2-az1--x-s3", "us-west-2")
+	assert.Nil(err)
+	assert.Equal("https://s3express-usw2-az1.us-west-2.amazonaws.com", endpoint)
+
+	_, err = DirectoryBucketEndpoint("bucket", "us-west-2")
+	assert.NotNil(err)
+
+	_, err = DirectoryBucketEndpoint("bucket--x-s3", "us-west-2")
+	assert.NotNil(err)
+
+	_, err = DirectoryBucketEndpoint("bucket--usw2-az1--x-s3", "")
+	assert.NotNil(err)
+}
+
+func TestDirectoryBucketSessions(t *testing.T) {
+	assert := assert.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal("GET", r.Method)
+		assert.Equal("/bucket--usw2-az1--x-s3", r.URL.Path)
+		// The signer may normalize the query to "session=".
+		assert.Equal([]string{""}, r.URL.Query()["session"])
+		assert.Len(r.URL.Query(), 1)
+		assert.Equal("ReadWrite", r.Header.Get("X-Amz-Create-Session-Mode"))
+		assert.Contains(r.Header.Get("Authorization"), "/s3express/")
+
+		w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<CreateSessionResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/">
+	<Credentials>
+		<SessionToken>token</SessionToken>
+		<SecretAccessKey>secret</SecretAccessKey>
+		<AccessKeyId>session-key</AccessKeyId>
+		<Expiration>2099-01-02T03:04:05Z</Expiration>
+	</Credentials>
+</CreateSessionResult>`))
+	}))
+	defer server.Close()
+
+	options := s3.Options{
+		Region:       "us-west-2",
+		UsePathStyle: true,
+		BaseEndpoint: aws.String(server.URL),
+		Credentials: aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "key", SecretAccessKey: "secret"}, nil
+		}),
+	}
+	UseDirectoryBucketSessions("bucket--usw2-az1--x-s3")(&options)
+	assert.Equal(server.URL, *options.BaseEndpoint)
+
+	credentials, err := options.Credentials.Retrieve(context.Background())
+	assert.Nil(err)
+	assert.Equal("session-key", credentials.AccessKeyID)
+	assert.Equal("token", credentials.SessionToken)
+	assert.True(credentials.CanExpire)
+
+	// The session token is sent in its own header instead of X-Amz-Security-Token.
+	req, _ := http.NewRequest("PUT", server.URL+"/bucket--usw2-az1--x-s3/key", nil)
+	err = options.HTTPSignerV4.SignHTTP(context.Background(), credentials, req, emptyPayloadHash, "s3", "us-west-2", time.Now())
+	assert.Nil(err)
+	assert.Equal("token", req.Header.Get("X-Amz-S3session-Token"))
+	assert.Equal("", req.Header.Get("X-Amz-Security-Token"))
+	assert.True(strings.Contains(req.Header.Get("Authorization"), "/s3express/"))
+}
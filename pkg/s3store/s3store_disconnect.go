@@ -0,0 +1,49 @@
+package s3store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/tus/tusd/v2/pkg/handler"
+)
+
+// partUploadContext returns the context for staging and uploading parts. If the
+// client disconnects, the handler cancels the request context with
+// handler.ErrClientDisconnected. The request body then ends and the parts staged
+// so far are still uploaded, so that the data received up to the disconnect is
+// saved and the client can resume the upload from there. For other causes, such
+// as the upload being stopped or interrupted by another request, the returned
+// context is cancelled as well. The returned function must be called once the
+// part uploads are done.
+func partUploadContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	// Contexts which are never cancelled, such as context.Background, are
+	// returned unchanged.
+	if ctx.Done() == nil {
+		return ctx, func() {}
+	}
+
+	partCtx, cancel := context.WithCancelCause(detachedContext{ctx})
+	go func() {
+		select {
+		case <-ctx.Done():
+			if cause := context.Cause(ctx); !errors.Is(cause, handler.ErrClientDisconnected) {
+				cancel(cause)
+			}
+		case <-partCtx.Done():
+		}
+	}()
+
+	return partCtx, func() { cancel(context.Canceled) }
+}
+
+// detachedContext carries the values of its parent, but is not cancelled
+// together with it.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+func (c detachedContext) Value(key any) any         { return c.parent.Value(key) }
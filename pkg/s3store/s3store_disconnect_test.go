@@ -0,0 +1,237 @@
+package s3store
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tus/tusd/v2/pkg/handler"
+)
+
+type testContextKey struct{}
+
+func TestPartUploadContext(t *testing.T) {
+	assert := assert.New(t)
+
+	// Contexts without cancellation are used as they are.
+	partCtx, cancelParts := partUploadContext(context.Background())
+	assert.Equal(context.Background(), partCtx)
+	cancelParts()
+
+	// The part context is not cancelled if the client disconnects.
+	ctx, cancel := context.WithCancelCause(context.WithValue(context.Background(), testContextKey{}, "value"))
+	partCtx, cancelParts = partUploadContext(ctx)
+	cancel(handler.ErrClientDisconnected)
+
+	select {
+	case <-partCtx.Done():
+		t.Fatal("part context must not be cancelled if the client disconnects")
+	case <-time.After(50 * time.Millisecond):
+	}
+	assert.Equal("value", partCtx.Value(testContextKey{}))
+
+	cancelParts()
+	<-partCtx.Done()
+
+	// Other causes are forwarded.
+	ctx, cancel = context.WithCancelCause(context.Background())
+	partCtx, cancelParts = partUploadContext(ctx)
+	defer cancelParts()
+	cancel(handler.ErrUploadInterrupted)
+
+	<-partCtx.Done()
+	assert.ErrorIs(context.Cause(partCtx), handler.ErrUploadInterrupted)
+}
+
+// expectDisconnectUpload sets up the calls for retrieving an upload of 500 bytes
+// without any parts.
+func expectDisconnectUpload(s3obj *MockS3API) {
+	s3obj.EXPECT().GetObject(gomock.Any(), &s3.GetObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("uploadId.info"),
+	}).Return(&s3.GetObjectOutput{
+		Body: io.NopCloser(bytes.NewReader([]byte(`{"ID":"uploadId","Size":500,"Offset":0,"MetaData":null,"IsPartial":false,"IsFinal":false,"PartialUploads":null,"Storage":null}`))),
+	}, nil)
+	s3obj.EXPECT().ListParts(gomock.Any(), &s3.ListPartsInput{
+		Bucket:           aws.String("bucket"),
+		Key:              aws.String("uploadId"),
+		UploadId:         aws.String("multipartId"),
+		PartNumberMarker: nil,
+	}).Return(&s3.ListPartsOutput{
+		Parts: []types.Part{},
+	}, nil)
+	s3obj.EXPECT().HeadObject(gomock.Any(), &s3.HeadObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("uploadId.part"),
+	}).Return(nil, &types.NoSuchKey{})
+}
+
+func newDisconnectTestStore(s3obj *MockS3API) S3Store {
+	store := New("bucket", s3obj)
+	store.MaxPartSize = 8
+	store.MinPartSize = 4
+	store.PreferredPartSize = 4
+	store.MaxMultipartParts = 10000
+	store.MaxObjectSize = 5 * 1024 * 1024 * 1024 * 1024
+	// Parts are uploaded one after another, so that the disconnect happens
+	// while further parts are waiting.
+	store.SetConcurrentPartUploads(1)
+	return store
+}
+
+// disconnectingReader behaves like the request body if the client disconnects
+// after data has been sent: it ends without error and the request context is
+// cancelled with handler.ErrClientDisconnected.
+type disconnectingReader struct {
+	io.Reader
+	cancel context.CancelCauseFunc
+}
+
+func (r disconnectingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if err == io.EOF {
+		r.cancel(handler.ErrClientDisconnected)
+	}
+	return n, err
+}
+
+// TestWriteChunkClientDisconnect simulates a client disconnecting at different
+// stages of WriteChunk and asserts that the data received before is saved.
+func TestWriteChunkClientDisconnect(t *testing.T) {
+	tests := []struct {
+		name string
+		// body is sent by the client before it disconnects.
+		body string
+		// stage is the S3 request during which the client disconnects. If
+		// empty, the client disconnects while the body is read.
+		stage string
+	}{
+		{"ReadingBody", "12345678", ""},
+		{"UploadingPart", "12345678", "UploadPart"},
+		{"UploadingIncompletePart", "123456", "PutObject"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+			assert := assert.New(t)
+
+			s3obj := NewMockS3API(mockCtrl)
+			store := newDisconnectTestStore(s3obj)
+			expectDisconnectUpload(s3obj)
+
+			ctx, cancel := context.WithCancelCause(context.Background())
+			defer cancel(nil)
+
+			// disconnect is called by the S3 requests and cancels the request
+			// context during the stage under test.
+			disconnect := func(ctx context.Context, stage string) {
+				if stage == test.stage {
+					cancel(handler.ErrClientDisconnected)
+				}
+				// Give partUploadContext the chance to react to the cancellation.
+				time.Sleep(10 * time.Millisecond)
+				assert.Nil(ctx.Err())
+			}
+
+			for i, body := range []string{"1234", "5678"}[:len(test.body)/4] {
+				s3obj.EXPECT().UploadPart(gomock.Any(), NewUploadPartInputMatcher(&s3.UploadPartInput{
+					Bucket:     aws.String("bucket"),
+					Key:        aws.String("uploadId"),
+					UploadId:   aws.String("multipartId"),
+					PartNumber: aws.Int32(int32(i + 1)),
+					Body:       bytes.NewReader([]byte(body)),
+				})).DoAndReturn(func(ctx context.Context, input *s3.UploadPartInput, opts ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+					disconnect(ctx, "UploadPart")
+					return &s3.UploadPartOutput{ETag: aws.String("etag")}, nil
+				})
+			}
+			if len(test.body)%4 != 0 {
+				s3obj.EXPECT().PutObject(gomock.Any(), NewPutObjectInputMatcher(&s3.PutObjectInput{
+					Bucket: aws.String("bucket"),
+					Key:    aws.String("uploadId.part"),
+					Body:   bytes.NewReader([]byte(test.body[len(test.body)/4*4:])),
+				})).DoAndReturn(func(ctx context.Context, input *s3.PutObjectInput, opts ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+					disconnect(ctx, "PutObject")
+					return &s3.PutObjectOutput{}, nil
+				})
+			}
+
+			upload, err := store.GetUpload(ctx, "uploadId+multipartId")
+			assert.Nil(err)
+
+			var src io.Reader = bytes.NewReader([]byte(test.body))
+			if test.stage == "" {
+				src = disconnectingReader{src, cancel}
+			}
+
+			bytesRead, err := upload.WriteChunk(ctx, 0, src)
+			assert.Nil(err)
+			assert.Equal(int64(len(test.body)), bytesRead)
+			assert.ErrorIs(context.Cause(ctx), handler.ErrClientDisconnected)
+		})
+	}
+}
+
+func TestWriteChunkInterrupted(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	s3obj := NewMockS3API(mockCtrl)
+	store := newDisconnectTestStore(s3obj)
+	expectDisconnectUpload(s3obj)
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+
+	// If the upload is interrupted by another request, the part upload is
+	// cancelled.
+	s3obj.EXPECT().UploadPart(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, input *s3.UploadPartInput, opts ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+		cancel(handler.ErrUploadInterrupted)
+		<-ctx.Done()
+		return nil, context.Cause(ctx)
+	})
+
+	upload, err := store.GetUpload(ctx, "uploadId+multipartId")
+	assert.Nil(err)
+
+	bytesRead, err := upload.WriteChunk(ctx, 0, bytes.NewReader([]byte("1234")))
+	assert.ErrorIs(err, handler.ErrUploadInterrupted)
+	assert.Equal(int64(0), bytesRead)
+}
+
+func TestWriteChunkPartiallyUploaded(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	s3obj := NewMockS3API(mockCtrl)
+	store := newDisconnectTestStore(s3obj)
+	expectDisconnectUpload(s3obj)
+
+	gomock.InOrder(
+		s3obj.EXPECT().UploadPart(gomock.Any(), gomock.Any()).Return(&s3.UploadPartOutput{ETag: aws.String("etag-1")}, nil),
+		s3obj.EXPECT().UploadPart(gomock.Any(), gomock.Any()).Return(nil, errors.New("connection lost")),
+		s3obj.EXPECT().UploadPart(gomock.Any(), gomock.Any()).Return(&s3.UploadPartOutput{ETag: aws.String("etag-3")}, nil),
+	)
+
+	upload, err := store.GetUpload(context.Background(), "uploadId+multipartId")
+	assert.Nil(err)
+
+	// Only the bytes before the failed part are reported, since the client has
+	// to resume the upload from there.
+	bytesRead, err := upload.WriteChunk(context.Background(), 0, bytes.NewReader([]byte("123456789012")))
+	assert.EqualError(err, "connection lost")
+	assert.Equal(int64(4), bytesRead)
+}
@@ -0,0 +1,119 @@
+package s3store
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// The classes of errors, which are used as label for counting failed requests.
+// They allow alerting to distinguish throttling by S3 from misconfiguration,
+// such as invalid credentials, and from connectivity problems.
+const (
+	errorClassThrottled = "throttled"
+	errorClassAuth      = "auth"
+	errorClassNotFound  = "not_found"
+	errorClassNetwork   = "network"
+	errorClassTimeout   = "timeout"
+	errorClassOther     = "other"
+)
+
+// throttlingErrorCodes are the error codes, with which S3 and S3-compatible
+// servers reject requests because of a rate limit.
+var throttlingErrorCodes = map[string]bool{
+	"SlowDown":                               true,
+	"Throttling":                             true,
+	"ThrottlingException":                    true,
+	"RequestLimitExceeded":                   true,
+	"TooManyRequests":                        true,
+	"TooManyRequestsException":               true,
+	"RequestThrottled":                       true,
+	"ServiceUnavailable":                     true,
+	"ProvisionedThroughputExceededException": true,
+}
+
+// authErrorCodes are the error codes, which indicate invalid credentials or
+// missing permissions.
+var authErrorCodes = map[string]bool{
+	"AccessDenied":                true,
+	"AllAccessDisabled":           true,
+	"InvalidAccessKeyId":          true,
+	"SignatureDoesNotMatch":       true,
+	"ExpiredToken":                true,
+	"InvalidToken":                true,
+	"TokenRefreshRequired":        true,
+	"InvalidClientTokenId":        true,
+	"UnrecognizedClientException": true,
+}
+
+// notFoundErrorCodes are the error codes, which indicate that the bucket,
+// object or multipart upload does not exist.
+var notFoundErrorCodes = map[string]bool{
+	"NoSuchBucket": true,
+	"NoSuchKey":    true,
+	"NoSuchUpload": true,
+	"NotFound":     true,
+}
+
+// observeRequestError counts a failed request to S3 by operation and error
+// class. Requests, which are canceled because the client has gone away, are
+// not counted since they do not indicate a problem with S3.
+func (store S3Store) observeRequestError(label string, err error) {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return
+	}
+
+	store.requestErrorsMetric.WithLabelValues(label, classifyRequestError(err)).Inc()
+}
+
+// classifyRequestError determines the class of an error returned by the S3
+// client, preferring the error code sent by S3 over the HTTP status code.
+func classifyRequestError(err error) string {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		code := apiErr.ErrorCode()
+		switch {
+		case throttlingErrorCodes[code]:
+			return errorClassThrottled
+		case authErrorCodes[code]:
+			return errorClassAuth
+		case notFoundErrorCodes[code]:
+			return errorClassNotFound
+		}
+	}
+
+	var responseErr *smithyhttp.ResponseError
+	if errors.As(err, &responseErr) {
+		switch responseErr.HTTPStatusCode() {
+		case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+			return errorClassThrottled
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return errorClassAuth
+		case http.StatusNotFound:
+			return errorClassNotFound
+		}
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return errorClassTimeout
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		if netErr.Timeout() {
+			return errorClassTimeout
+		}
+		return errorClassNetwork
+	}
+
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+		return errorClassNetwork
+	}
+
+	return errorClassOther
+}
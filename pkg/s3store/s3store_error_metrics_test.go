@@ -0,0 +1,47 @@
+package s3store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+func newResponseError(statusCode int, err error) error {
+	return &smithyhttp.ResponseError{
+		Response: &smithyhttp.Response{Response: &http.Response{
+			StatusCode: statusCode,
+		}},
+		Err: err,
+	}
+}
+
+func TestClassifyRequestError(t *testing.T) {
+	tests := []struct {
+		err   error
+		class string
+	}{
+		{&smithy.GenericAPIError{Code: "SlowDown"}, errorClassThrottled},
+		{newResponseError(http.StatusServiceUnavailable, errors.New("unavailable")), errorClassThrottled},
+		{newResponseError(http.StatusTooManyRequests, errors.New("too many requests")), errorClassThrottled},
+		{&smithy.GenericAPIError{Code: "AccessDenied"}, errorClassAuth},
+		{newResponseError(http.StatusForbidden, &smithy.GenericAPIError{Code: "SignatureDoesNotMatch"}), errorClassAuth},
+		{&smithy.GenericAPIError{Code: "NoSuchUpload"}, errorClassNotFound},
+		{newResponseError(http.StatusNotFound, errors.New("not found")), errorClassNotFound},
+		{fmt.Errorf("operation error S3: PutObject, %w", context.DeadlineExceeded), errorClassTimeout},
+		{&net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, errorClassNetwork},
+		{&smithy.GenericAPIError{Code: "InternalError"}, errorClassOther},
+		{errors.New("unknown"), errorClassOther},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.class, classifyRequestError(test.err), test.err.Error())
+	}
+}
@@ -0,0 +1,105 @@
+package s3store
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"strconv"
+	"time"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// HTTPClientOptions tunes the connection pool and timeouts of the HTTP client
+// used for requests to S3. The defaults of the AWS SDK limit the number of idle
+// connections to each host to 10, which causes new connections to be
+// established for most part uploads on nodes with a high throughput. Zero
+// values keep the defaults of the AWS SDK.
+type HTTPClientOptions struct {
+	// MaxIdleConns limits the number of idle connections across all hosts.
+	MaxIdleConns int
+	// MaxIdleConnsPerHost limits the number of idle connections to each host.
+	MaxIdleConnsPerHost int
+	// MaxConnsPerHost limits the number of connections to each host, including
+	// connections which are in use. Requests wait until a connection is free.
+	MaxConnsPerHost int
+	// IdleConnTimeout is the duration after which idle connections are closed.
+	IdleConnTimeout time.Duration
+	// DialTimeout limits the time to establish a TCP connection.
+	DialTimeout time.Duration
+	// TLSHandshakeTimeout limits the time for the TLS handshake.
+	TLSHandshakeTimeout time.Duration
+	// DisableHTTP2 uses HTTP/1.1 for all connections, even if the server
+	// supports HTTP/2.
+	DisableHTTP2 bool
+}
+
+// HTTPClient is an HTTP client for the S3 API, which can be passed to the S3
+// client using s3.Options.HTTPClient. It records whether the requests reuse
+// pooled connections.
+type HTTPClient struct {
+	client *awshttp.BuildableClient
+
+	// connectionsMetric holds the prometheus instance for counting connections
+	// used for requests, labeled by whether they were reused.
+	connectionsMetric *prometheus.CounterVec
+}
+
+// NewHTTPClient creates an HTTP client for the S3 API, which is configured
+// using opts.
+func NewHTTPClient(opts HTTPClientOptions) *HTTPClient {
+	client := awshttp.NewBuildableClient().WithTransportOptions(func(tr *http.Transport) {
+		if opts.MaxIdleConns > 0 {
+			tr.MaxIdleConns = opts.MaxIdleConns
+		}
+		if opts.MaxIdleConnsPerHost > 0 {
+			tr.MaxIdleConnsPerHost = opts.MaxIdleConnsPerHost
+		}
+		if opts.MaxConnsPerHost > 0 {
+			tr.MaxConnsPerHost = opts.MaxConnsPerHost
+		}
+		if opts.IdleConnTimeout > 0 {
+			tr.IdleConnTimeout = opts.IdleConnTimeout
+		}
+		if opts.TLSHandshakeTimeout > 0 {
+			tr.TLSHandshakeTimeout = opts.TLSHandshakeTimeout
+		}
+		if opts.DisableHTTP2 {
+			// A non-nil, empty map prevents the upgrade to HTTP/2.
+			tr.ForceAttemptHTTP2 = false
+			tr.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+		}
+	})
+
+	if opts.DialTimeout > 0 {
+		client = client.WithDialerOptions(func(dialer *net.Dialer) {
+			dialer.Timeout = opts.DialTimeout
+		})
+	}
+
+	return &HTTPClient{
+		client: client,
+		connectionsMetric: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "tusd_s3_connections_total",
+			Help: "Total number of connections used for requests to S3, labeled by whether they were reused from the pool",
+		}, []string{"reused"}),
+	}
+}
+
+// Do sends an HTTP request to S3. It implements s3.HTTPClient.
+func (c *HTTPClient) Do(req *http.Request) (*http.Response, error) {
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			c.connectionsMetric.WithLabelValues(strconv.FormatBool(info.Reused)).Inc()
+		},
+	}
+
+	return c.client.Do(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+}
+
+// RegisterMetrics registers the metrics of the HTTP client in registry.
+func (c *HTTPClient) RegisterMetrics(registry prometheus.Registerer) {
+	registry.MustRegister(c.connectionsMetric)
+}
@@ -0,0 +1,67 @@
+package s3store
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewHTTPClient(t *testing.T) {
+	assert := assert.New(t)
+
+	client := NewHTTPClient(HTTPClientOptions{
+		MaxIdleConns:        500,
+		MaxIdleConnsPerHost: 100,
+		MaxConnsPerHost:     200,
+		IdleConnTimeout:     time.Minute,
+		DialTimeout:         5 * time.Second,
+		TLSHandshakeTimeout: 3 * time.Second,
+		DisableHTTP2:        true,
+	})
+
+	tr := client.client.GetTransport()
+	assert.Equal(500, tr.MaxIdleConns)
+	assert.Equal(100, tr.MaxIdleConnsPerHost)
+	assert.Equal(200, tr.MaxConnsPerHost)
+	assert.Equal(time.Minute, tr.IdleConnTimeout)
+	assert.Equal(3*time.Second, tr.TLSHandshakeTimeout)
+	assert.False(tr.ForceAttemptHTTP2)
+	assert.NotNil(tr.TLSNextProto)
+	assert.Equal(5*time.Second, client.client.GetDialer().Timeout)
+}
+
+func TestHTTPClientReusesConnections(t *testing.T) {
+	assert := assert.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient(HTTPClientOptions{})
+
+	// The trace of the request is kept in addition to the trace of the client.
+	var reused []bool
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			reused = append(reused, info.Reused)
+		},
+	}
+
+	for i := 0; i < 2; i++ {
+		req, err := http.NewRequest("GET", server.URL, nil)
+		assert.Nil(err)
+		req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+
+		res, err := client.Do(req)
+		assert.Nil(err)
+		assert.Equal(http.StatusOK, res.StatusCode)
+		res.Body.Close()
+	}
+
+	assert.Equal([]bool{false, true}, reused)
+}
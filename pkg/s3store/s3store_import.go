@@ -0,0 +1,55 @@
+package s3store
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/tus/tusd/v2/pkg/handler"
+)
+
+// ImportUpload takes over an upload, which has been exported from another
+// tusd instance using the same bucket, by writing its info object under this
+// store's MetadataObjectPrefix. The upload's data is not copied, so the object
+// key recorded in the checkpoint must match the key this store would use for
+// the recorded shard. If
+// the multipart upload has been aborted in the meantime and the object does
+// not exist either, the checkpoint is rejected.
+func (store S3Store) ImportUpload(ctx context.Context, info handler.FileInfo) (handler.Upload, error) {
+	objectId, multipartId := splitIds(info.ID)
+	if objectId == "" || multipartId == "" {
+		return nil, handler.ErrInvalidCheckpoint
+	}
+
+	upload := &s3Upload{objectId, multipartId, "", &store, nil, []*s3Part{}, 0, ""}
+	upload.resolveShard(info, nil)
+	if info.Storage["Bucket"] != store.Bucket || info.Storage["Key"] != *store.keyWithPrefix(upload.location()) {
+		return nil, handler.ErrInvalidCheckpoint
+	}
+
+	if multipartId != noMultipartId {
+		_, err := store.listAllParts(ctx, upload.location(), multipartId)
+		if isAwsError[*types.NoSuchUpload](err) || isAwsErrorCode(err, "NoSuchUpload") || isAwsError[*types.NoSuchKey](err) {
+			// The multipart upload might have been completed before the export.
+			exists, existsErr := store.objectExists(ctx, upload.location())
+			if existsErr != nil {
+				return nil, existsErr
+			}
+			if !exists {
+				return nil, handler.ErrInvalidCheckpoint
+			}
+		} else if err != nil {
+			return nil, convertError(err)
+		}
+	}
+
+	if err := upload.writeInfo(ctx, info); err != nil {
+		return nil, fmt.Errorf("s3store: unable to import info file:\n%s", err)
+	}
+
+	// Let the offset be determined from the parts in S3 instead of trusting
+	// the checkpoint.
+	upload.info = nil
+
+	return upload, nil
+}
@@ -0,0 +1,113 @@
+package s3store
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/tus/tusd/v2/pkg/handler"
+)
+
+func TestImportUpload(t *testing.T) {
+	info := handler.FileInfo{
+		ID:     "uploadId+multipartId",
+		Size:   500,
+		Offset: 100,
+		Storage: map[string]string{
+			"Type":   "s3store",
+			"Bucket": "bucket",
+			"Key":    "uploadId",
+		},
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+		assert := assert.New(t)
+
+		s3obj := NewMockS3API(mockCtrl)
+		store := New("bucket", s3obj)
+		store.MetadataObjectPrefix = "cluster-b/"
+
+		infoJson, err := json.Marshal(info)
+		assert.Nil(err)
+
+		gomock.InOrder(
+			s3obj.EXPECT().ListParts(context.Background(), &s3.ListPartsInput{
+				Bucket:   aws.String("bucket"),
+				Key:      aws.String("uploadId"),
+				UploadId: aws.String("multipartId"),
+			}).Return(&s3.ListPartsOutput{
+				Parts: []types.Part{
+					{PartNumber: aws.Int32(1), Size: aws.Int64(100), ETag: aws.String("etag-1")},
+				},
+			}, nil),
+			s3obj.EXPECT().PutObject(context.Background(), &s3.PutObjectInput{
+				Bucket:        aws.String("bucket"),
+				Key:           aws.String("cluster-b/uploadId.info"),
+				Body:          bytes.NewReader(infoJson),
+				ContentLength: aws.Int64(int64(len(infoJson))),
+			}),
+		)
+
+		upload, err := store.ImportUpload(context.Background(), info)
+		assert.Nil(err)
+		assert.NotNil(upload)
+	})
+
+	t.Run("KeyMismatch", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		s3obj := NewMockS3API(mockCtrl)
+		store := New("bucket", s3obj)
+		store.ObjectPrefix = "other/"
+
+		_, err := store.ImportUpload(context.Background(), info)
+		assert.Equal(t, handler.ErrInvalidCheckpoint, err)
+	})
+
+	t.Run("Aborted", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		s3obj := NewMockS3API(mockCtrl)
+		store := New("bucket", s3obj)
+
+		gomock.InOrder(
+			s3obj.EXPECT().ListParts(context.Background(), &s3.ListPartsInput{
+				Bucket:   aws.String("bucket"),
+				Key:      aws.String("uploadId"),
+				UploadId: aws.String("multipartId"),
+			}).Return(nil, &types.NoSuchUpload{}),
+			s3obj.EXPECT().HeadObject(context.Background(), &s3.HeadObjectInput{
+				Bucket: aws.String("bucket"),
+				Key:    aws.String("uploadId"),
+			}).Return(nil, &types.NotFound{}),
+		)
+
+		_, err := store.ImportUpload(context.Background(), info)
+		assert.Equal(t, handler.ErrInvalidCheckpoint, err)
+	})
+
+	t.Run("ListError", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		s3obj := NewMockS3API(mockCtrl)
+		store := New("bucket", s3obj)
+
+		s3obj.EXPECT().ListParts(context.Background(), gomock.Any()).Return(nil, errors.New("network error"))
+
+		_, err := store.ImportUpload(context.Background(), info)
+		assert.EqualError(t, err, "network error")
+	})
+}
@@ -0,0 +1,135 @@
+package s3store
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/tus/tusd/v2/pkg/handler"
+)
+
+// IngestObject creates a finished upload from an existing object, which may be
+// stored in another bucket or account, if the credentials are allowed to read
+// it. The data is copied by S3 using UploadPartCopy requests, so it is never
+// transferred through tusd. Parts are copied concurrently, limited by the same
+// semaphore as regular part uploads.
+func (store S3Store) IngestObject(ctx context.Context, info handler.FileInfo, source handler.IngestSource) (handler.Upload, error) {
+	headInput := &s3.HeadObjectInput{
+		Bucket: aws.String(source.Bucket),
+		Key:    aws.String(source.Key),
+	}
+	if source.VersionID != "" {
+		headInput.VersionId = aws.String(source.VersionID)
+	}
+	if source.ExpectedOwner != "" {
+		headInput.ExpectedBucketOwner = aws.String(source.ExpectedOwner)
+	}
+
+	t := time.Now()
+	head, err := store.Service.HeadObject(ctx, headInput)
+	store.observeRequest(ctx, t, metricHeadObject, err)
+	if err != nil {
+		if isAwsError[*types.NoSuchKey](err) || isAwsError[*types.NotFound](err) {
+			return nil, handler.ErrIngestSourceNotFound
+		}
+		return nil, fmt.Errorf("s3store: unable to read source object: %w", err)
+	}
+
+	// Parts can only be copied into a multipart upload, which is therefore also
+	// used for small objects. The store is a copy, so this has no further effect.
+	store.SkipMultipartForSmallUploads = false
+
+	info.Size = aws.ToInt64(head.ContentLength)
+	info.SizeIsDeferred = false
+	upload, err := store.NewUpload(ctx, info)
+	if err != nil {
+		return nil, err
+	}
+
+	s3Up := upload.(*s3Upload)
+	if err := s3Up.copyParts(ctx, source, info.Size, info.Priority); err != nil {
+		// Remove the multipart upload, so that the copied parts do not linger.
+		if terminateErr := s3Up.Terminate(ctx); terminateErr != nil {
+			err = newMultiError([]error{err, terminateErr})
+		}
+		return nil, err
+	}
+
+	// The cached info does not include the copied parts, so let them be listed
+	// from S3 when finishing the upload.
+	s3Up.info = nil
+
+	if err := upload.FinishUpload(ctx); err != nil {
+		return nil, err
+	}
+
+	return upload, nil
+}
+
+// copyParts copies the source object of the given size into the multipart
+// upload using parts of the optimal size.
+func (upload *s3Upload) copyParts(ctx context.Context, source handler.IngestSource, size int64, priority int) error {
+	store := upload.store
+
+	partSize, err := store.calcOptimalPartSize(size)
+	if err != nil {
+		return err
+	}
+
+	copySource := (&url.URL{Path: source.Bucket + "/" + source.Key}).EscapedPath()
+	if source.VersionID != "" {
+		copySource += "?versionId=" + url.QueryEscape(source.VersionID)
+	}
+
+	sse := customerKeyFromContext(ctx)
+	var wg sync.WaitGroup
+	var errsLock sync.Mutex
+	var errs []error
+
+	for offset, partNumber := int64(0), int32(1); offset < size; offset, partNumber = offset+partSize, partNumber+1 {
+		end := min(offset+partSize, size) - 1
+
+		store.acquireUploadSemaphore(priority)
+		wg.Add(1)
+		go func(partNumber int32, offset, end int64) {
+			defer wg.Done()
+			defer store.releaseUploadSemaphore()
+
+			input := &s3.UploadPartCopyInput{
+				Bucket:               aws.String(store.Bucket),
+				Key:                  store.keyWithPrefix(upload.location()),
+				UploadId:             aws.String(upload.multipartId),
+				PartNumber:           aws.Int32(partNumber),
+				CopySource:           aws.String(copySource),
+				CopySourceRange:      aws.String(fmt.Sprintf("bytes=%d-%d", offset, end)),
+				SSECustomerAlgorithm: sse.algorithm,
+				SSECustomerKey:       sse.key,
+				SSECustomerKeyMD5:    sse.keyMD5,
+			}
+			if source.ExpectedOwner != "" {
+				input.ExpectedSourceBucketOwner = aws.String(source.ExpectedOwner)
+			}
+
+			t := time.Now()
+			_, err := store.Service.UploadPartCopy(ctx, input)
+			store.observeRequest(ctx, t, metricUploadPartCopy, err)
+			if err != nil {
+				errsLock.Lock()
+				errs = append(errs, fmt.Errorf("s3store: unable to copy part %d: %w", partNumber, err))
+				errsLock.Unlock()
+			}
+		}(partNumber, offset, end)
+	}
+
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return newMultiError(errs)
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package s3store
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/tus/tusd/v2/pkg/handler"
+)
+
+func TestIngestObject(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	s3obj := NewMockS3API(mockCtrl)
+	store := New("bucket", s3obj)
+	store.MinPartSize = 4
+	store.PreferredPartSize = 4
+	// Small objects are ingested using a multipart upload nevertheless.
+	store.SkipMultipartForSmallUploads = true
+
+	source := handler.IngestSource{
+		Bucket:        "other bucket",
+		Key:           "videos/intro.mp4",
+		VersionID:     "v1",
+		ExpectedOwner: "123456789012",
+	}
+
+	s3obj.EXPECT().HeadObject(context.Background(), &s3.HeadObjectInput{
+		Bucket:              aws.String("other bucket"),
+		Key:                 aws.String("videos/intro.mp4"),
+		VersionId:           aws.String("v1"),
+		ExpectedBucketOwner: aws.String("123456789012"),
+	}).Return(&s3.HeadObjectOutput{
+		ContentLength: aws.Int64(10),
+	}, nil)
+	s3obj.EXPECT().CreateMultipartUpload(context.Background(), gomock.Any()).Return(&s3.CreateMultipartUploadOutput{
+		UploadId: aws.String("multipartId"),
+	}, nil)
+	s3obj.EXPECT().PutObject(context.Background(), gomock.Any()).Return(&s3.PutObjectOutput{}, nil)
+
+	for i, copyRange := range []string{"bytes=0-3", "bytes=4-7", "bytes=8-9"} {
+		s3obj.EXPECT().UploadPartCopy(context.Background(), &s3.UploadPartCopyInput{
+			Bucket:                    aws.String("bucket"),
+			Key:                       aws.String("uploadId"),
+			UploadId:                  aws.String("multipartId"),
+			PartNumber:                aws.Int32(int32(i + 1)),
+			CopySource:                aws.String("other%20bucket/videos/intro.mp4?versionId=v1"),
+			CopySourceRange:           aws.String(copyRange),
+			ExpectedSourceBucketOwner: aws.String("123456789012"),
+		}).Return(&s3.UploadPartCopyOutput{
+			CopyPartResult: &types.CopyPartResult{ETag: aws.String("etag")},
+		}, nil)
+	}
+
+	// The upload is finished using the copied parts.
+	s3obj.EXPECT().GetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("uploadId.info"),
+	}).Return(&s3.GetObjectOutput{
+		Body: io.NopCloser(bytes.NewReader([]byte(`{"ID":"uploadId+multipartId","Size":10,"Offset":0,"MetaData":{"filename":"intro.mp4"},"IsPartial":false,"IsFinal":false,"PartialUploads":null,"Storage":null}`))),
+	}, nil)
+	s3obj.EXPECT().ListParts(context.Background(), &s3.ListPartsInput{
+		Bucket:   aws.String("bucket"),
+		Key:      aws.String("uploadId"),
+		UploadId: aws.String("multipartId"),
+	}).Return(&s3.ListPartsOutput{
+		Parts: []types.Part{
+			{Size: aws.Int64(4), ETag: aws.String("etag-1"), PartNumber: aws.Int32(1)},
+			{Size: aws.Int64(4), ETag: aws.String("etag-2"), PartNumber: aws.Int32(2)},
+			{Size: aws.Int64(2), ETag: aws.String("etag-3"), PartNumber: aws.Int32(3)},
+		},
+	}, nil)
+	s3obj.EXPECT().HeadObject(context.Background(), &s3.HeadObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("uploadId.part"),
+	}).Return(nil, &types.NotFound{})
+	s3obj.EXPECT().CompleteMultipartUpload(context.Background(), &s3.CompleteMultipartUploadInput{
+		Bucket:   aws.String("bucket"),
+		Key:      aws.String("uploadId"),
+		UploadId: aws.String("multipartId"),
+		MultipartUpload: &types.CompletedMultipartUpload{
+			Parts: []types.CompletedPart{
+				{ETag: aws.String("etag-1"), PartNumber: aws.Int32(1)},
+				{ETag: aws.String("etag-2"), PartNumber: aws.Int32(2)},
+				{ETag: aws.String("etag-3"), PartNumber: aws.Int32(3)},
+			},
+		},
+	}).Return(&s3.CompleteMultipartUploadOutput{}, nil)
+
+	upload, err := store.IngestObject(context.Background(), handler.FileInfo{
+		ID:       "uploadId",
+		MetaData: handler.MetaData{"filename": "intro.mp4"},
+	}, source)
+	assert.Nil(err)
+	assert.NotNil(upload)
+}
+
+func TestIngestObjectNotFound(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	s3obj := NewMockS3API(mockCtrl)
+	store := New("bucket", s3obj)
+
+	s3obj.EXPECT().HeadObject(context.Background(), &s3.HeadObjectInput{
+		Bucket: aws.String("other-bucket"),
+		Key:    aws.String("missing"),
+	}).Return(nil, &types.NotFound{})
+
+	_, err := store.IngestObject(context.Background(), handler.FileInfo{}, handler.IngestSource{
+		Bucket: "other-bucket",
+		Key:    "missing",
+	})
+	assert.Equal(handler.ErrIngestSourceNotFound, err)
+}
@@ -0,0 +1,50 @@
+package s3store
+
+import (
+	"context"
+
+	"github.com/tus/tusd/v2/pkg/handler"
+)
+
+// Inspect lists the parts of the upload's multipart upload, which S3 has
+// received, and the size of the incomplete part object, which holds the data
+// that is not enough for another part yet. The information is always fetched
+// from S3, so that it reflects the current state even if it differs from the
+// upload's offset as seen by tusd.
+func (upload *s3Upload) Inspect(ctx context.Context) (handler.UploadInspection, error) {
+	store := upload.store
+
+	info, parts, incompletePartSize, _, err := upload.fetchInfo(ctx)
+	if upload.resolveShard(info, err) {
+		_, parts, incompletePartSize, _, err = upload.fetchInfo(ctx)
+	}
+	if err != nil {
+		return handler.UploadInspection{}, convertError(err)
+	}
+
+	inspection := handler.UploadInspection{
+		Parts:       make([]handler.InspectedPart, 0, len(parts)),
+		StagedBytes: incompletePartSize,
+		Details: map[string]string{
+			"Bucket":      store.Bucket,
+			"Key":         *store.keyWithPrefix(upload.location()),
+			"MultipartId": upload.multipartId,
+		},
+	}
+	if incompletePartSize > 0 {
+		inspection.Details["IncompletePartKey"] = *store.metadataKeyWithPrefix(upload.location() + ".part")
+	}
+
+	offset := int64(0)
+	for _, part := range parts {
+		inspection.Parts = append(inspection.Parts, handler.InspectedPart{
+			Number: int64(part.number),
+			Offset: offset,
+			Size:   part.size,
+			ETag:   part.etag,
+		})
+		offset += part.size
+	}
+
+	return inspection, nil
+}
@@ -0,0 +1,67 @@
+package s3store
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/tus/tusd/v2/pkg/handler"
+)
+
+func TestInspect(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	s3obj := NewMockS3API(mockCtrl)
+	store := New("bucket", s3obj)
+
+	s3obj.EXPECT().GetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("uploadId.info"),
+	}).Return(&s3.GetObjectOutput{
+		Body: io.NopCloser(bytes.NewReader([]byte(`{"ID":"uploadId+multipartId","Size":500,"Offset":0,"MetaData":{},"Storage":{"Bucket":"bucket","Key":"uploadId","Type":"s3store"}}`))),
+	}, nil)
+	s3obj.EXPECT().ListParts(context.Background(), &s3.ListPartsInput{
+		Bucket:   aws.String("bucket"),
+		Key:      aws.String("uploadId"),
+		UploadId: aws.String("multipartId"),
+	}).Return(&s3.ListPartsOutput{
+		Parts: []types.Part{
+			{PartNumber: aws.Int32(1), Size: aws.Int64(100), ETag: aws.String("etag-1")},
+			{PartNumber: aws.Int32(2), Size: aws.Int64(200), ETag: aws.String("etag-2")},
+		},
+	}, nil)
+	s3obj.EXPECT().HeadObject(context.Background(), &s3.HeadObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("uploadId.part"),
+	}).Return(&s3.HeadObjectOutput{
+		ContentLength: aws.Int64(50),
+	}, nil)
+
+	upload, err := store.GetUpload(context.Background(), "uploadId+multipartId")
+	assert.Nil(err)
+
+	inspection, err := store.AsInspectableUpload(upload).Inspect(context.Background())
+	assert.Nil(err)
+	assert.Equal(handler.UploadInspection{
+		Parts: []handler.InspectedPart{
+			{Number: 1, Offset: 0, Size: 100, ETag: "etag-1"},
+			{Number: 2, Offset: 100, Size: 200, ETag: "etag-2"},
+		},
+		StagedBytes: 50,
+		Details: map[string]string{
+			"Bucket":            "bucket",
+			"Key":               "uploadId",
+			"MultipartId":       "multipartId",
+			"IncompletePartKey": "uploadId.part",
+		},
+	}, inspection)
+}
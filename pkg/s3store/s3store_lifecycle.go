@@ -0,0 +1,222 @@
+package s3store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/tus/tusd/v2/pkg/handler"
+)
+
+// Actions of the recommendations in a LifecycleReport.
+const (
+	// LifecycleTerminateStaleUploads recommends terminating the stale uploads,
+	// which removes their multipart uploads and .info and .part objects. It is
+	// carried out by ApplyLifecycleReport.
+	LifecycleTerminateStaleUploads = "terminate-stale-uploads"
+	// LifecycleAddAbortRule recommends adding a lifecycle rule to the bucket,
+	// which aborts incomplete multipart uploads, so that S3 removes abandoned
+	// uploads itself. It must be carried out manually, e.g. using the
+	// init-bucket command of tusd.
+	LifecycleAddAbortRule = "add-abort-incomplete-multipart-upload-rule"
+)
+
+// LifecycleReport summarizes the unfinished uploads in the bucket and
+// recommends actions to reduce the storage costs caused by abandoned ones.
+type LifecycleReport struct {
+	Bucket       string
+	ObjectPrefix string
+	GeneratedAt  time.Time
+	// MaxAge is the age, after which unfinished uploads are considered stale.
+	MaxAge time.Duration
+	// Uploads is the number of unfinished multipart uploads.
+	Uploads int
+	// StaleUploads contains the IDs of the unfinished uploads, whose multipart
+	// upload has been initiated more than MaxAge ago.
+	StaleUploads []string
+	// OrphanedUploads is the number of stale uploads without an .info object,
+	// which can therefore not be resumed by clients.
+	OrphanedUploads int
+	// ReclaimableBytes is the estimated size of the parts and .part objects of
+	// the stale uploads.
+	ReclaimableBytes int64
+	// Recommendations lists the suggested actions. It is empty if there are
+	// no stale uploads.
+	Recommendations []LifecycleRecommendation
+}
+
+// LifecycleRecommendation is an action suggested by a LifecycleReport.
+type LifecycleRecommendation struct {
+	// Action identifies the recommendation, e.g. LifecycleTerminateStaleUploads.
+	Action string
+	// Description explains the recommendation to humans, e.g. "2,113
+	// multipart uploads older than 7 days, estimated 480.0 GiB reclaimable".
+	Description string
+	// Automatic is true if ApplyLifecycleReport carries out the action.
+	Automatic bool
+}
+
+// AnalyzeLifecycle lists the multipart uploads in the bucket whose key begins
+// with ObjectPrefix and inspects those initiated more than maxAge ago. For each
+// of them, the .info object is read and the sizes of the parts and the .part
+// object are determined, so the analysis sends multiple requests per stale
+// upload and should not be run too often.
+func (store S3Store) AnalyzeLifecycle(ctx context.Context, maxAge time.Duration) (LifecycleReport, error) {
+	now := time.Now()
+	report := LifecycleReport{
+		Bucket:       store.Bucket,
+		ObjectPrefix: store.ObjectPrefix,
+		GeneratedAt:  now,
+		MaxAge:       maxAge,
+		StaleUploads: []string{},
+	}
+
+	cursor := ""
+	for {
+		uploads, ids, nextCursor, err := store.listMultipartUploads(ctx, cursor)
+		if err != nil {
+			return report, err
+		}
+
+		for i, upload := range uploads {
+			report.Uploads++
+			if upload.Initiated == nil || now.Sub(*upload.Initiated) <= maxAge {
+				continue
+			}
+
+			size, orphaned, err := store.staleUploadSize(ctx, ids[i], *upload.Key)
+			if err != nil {
+				return report, err
+			}
+
+			report.StaleUploads = append(report.StaleUploads, ids[i])
+			report.ReclaimableBytes += size
+			if orphaned {
+				report.OrphanedUploads++
+			}
+		}
+
+		if nextCursor == "" {
+			break
+		}
+		cursor = nextCursor
+	}
+
+	if len(report.StaleUploads) > 0 {
+		description := fmt.Sprintf("%s multipart uploads older than %s, estimated %s reclaimable", formatCount(len(report.StaleUploads)), formatAge(maxAge), formatBytes(report.ReclaimableBytes))
+		if report.OrphanedUploads > 0 {
+			description += fmt.Sprintf(", of which %s have no .info object and cannot be resumed", formatCount(report.OrphanedUploads))
+		}
+
+		report.Recommendations = append(report.Recommendations, LifecycleRecommendation{
+			Action:      LifecycleTerminateStaleUploads,
+			Description: description,
+			Automatic:   true,
+		}, LifecycleRecommendation{
+			Action:      LifecycleAddAbortRule,
+			Description: fmt.Sprintf("Add a lifecycle rule aborting incomplete multipart uploads after %d days, so that the storage removes abandoned uploads itself", int(math.Ceil(maxAge.Hours()/24))),
+		})
+	}
+
+	return report, nil
+}
+
+// staleUploadSize returns the size of the upload's parts and .part object and
+// whether its .info object is missing. The objects are looked up next to the
+// key of the multipart upload, so that uploads in any shard are found.
+func (store S3Store) staleUploadSize(ctx context.Context, id string, key string) (size int64, orphaned bool, err error) {
+	objectId, multipartId := splitIds(id)
+	location := strings.TrimPrefix(key, *store.keyWithPrefix(""))
+
+	if _, _, err := store.readInfoObject(ctx, objectId, location); err != nil {
+		if !isAwsError[*types.NoSuchKey](err) && !errors.Is(err, handler.ErrNotFound) {
+			return 0, false, convertError(err)
+		}
+		orphaned = true
+	}
+
+	parts, err := store.listParts(ctx, location, multipartId)
+	if err != nil {
+		// The multipart upload may have been finished or aborted meanwhile.
+		if isAwsError[*types.NoSuchUpload](err) || isAwsErrorCode(err, "NoSuchUpload") {
+			return 0, orphaned, nil
+		}
+		return 0, false, convertError(err)
+	}
+	for _, part := range parts {
+		size += part.size
+	}
+
+	incompletePartSize, err := store.headIncompletePartForUpload(ctx, location)
+	if err != nil {
+		return 0, false, convertError(err)
+	}
+
+	return size + incompletePartSize, orphaned, nil
+}
+
+// ApplyLifecycleReport carries out the automatic recommendations of the report
+// by terminating its stale uploads. Uploads which cannot be terminated are
+// skipped and their errors are returned together after all others have been
+// terminated.
+func (store S3Store) ApplyLifecycleReport(ctx context.Context, report LifecycleReport) (terminated int, err error) {
+	var errs []error
+	for _, id := range report.StaleUploads {
+		upload, err := store.GetUpload(ctx, id)
+		if err == nil {
+			err = store.AsTerminatableUpload(upload).Terminate(ctx)
+		}
+		if err != nil && !errors.Is(err, handler.ErrNotFound) {
+			errs = append(errs, fmt.Errorf("%s: %w", id, err))
+			continue
+		}
+		terminated++
+	}
+
+	if len(errs) > 0 {
+		return terminated, newMultiError(errs)
+	}
+	return terminated, nil
+}
+
+// formatCount formats n with thousands separators, e.g. 2,113.
+func formatCount(n int) string {
+	s := strconv.Itoa(n)
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return s
+}
+
+// formatAge formats whole days as such, e.g. 7 days, and other durations
+// using time.Duration's format.
+func formatAge(d time.Duration) string {
+	day := 24 * time.Hour
+	if d >= day && d%day == 0 {
+		if d == day {
+			return "1 day"
+		}
+		return fmt.Sprintf("%d days", d/day)
+	}
+	return d.String()
+}
+
+// formatBytes formats a number of bytes using binary units, e.g. 480.0 GiB.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit && exp < 5; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,113 @@
+package s3store
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnalyzeLifecycle(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	s3obj := NewMockS3API(mockCtrl)
+	store := New("bucket", s3obj)
+
+	old := time.Now().Add(-10 * 24 * time.Hour)
+	recent := time.Now().Add(-time.Hour)
+
+	s3obj.EXPECT().ListMultipartUploads(context.Background(), &s3.ListMultipartUploadsInput{
+		Bucket: aws.String("bucket"),
+		Prefix: aws.String(""),
+	}).Return(&s3.ListMultipartUploadsOutput{
+		Uploads: []types.MultipartUpload{
+			{Key: aws.String("uploadA"), UploadId: aws.String("multipartA"), Initiated: &old},
+			{Key: aws.String("uploadB"), UploadId: aws.String("multipartB"), Initiated: &recent},
+			{Key: aws.String("uploadC"), UploadId: aws.String("multipartC"), Initiated: &old},
+		},
+	}, nil)
+
+	// uploadA has an .info object, parts and a .part object.
+	s3obj.EXPECT().GetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("uploadA.info"),
+	}).Return(&s3.GetObjectOutput{
+		Body: io.NopCloser(strings.NewReader(`{"ID":"uploadA+multipartA","Size":5000}`)),
+	}, nil)
+	s3obj.EXPECT().ListParts(context.Background(), &s3.ListPartsInput{
+		Bucket:   aws.String("bucket"),
+		Key:      aws.String("uploadA"),
+		UploadId: aws.String("multipartA"),
+	}).Return(&s3.ListPartsOutput{
+		Parts: []types.Part{
+			{Size: aws.Int64(1000), ETag: aws.String("etag-1"), PartNumber: aws.Int32(1)},
+			{Size: aws.Int64(1000), ETag: aws.String("etag-2"), PartNumber: aws.Int32(2)},
+		},
+	}, nil)
+	s3obj.EXPECT().HeadObject(context.Background(), &s3.HeadObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("uploadA.part"),
+	}).Return(&s3.HeadObjectOutput{ContentLength: aws.Int64(48)}, nil)
+
+	// uploadC has lost its .info object.
+	s3obj.EXPECT().GetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("uploadC.info"),
+	}).Return(nil, &types.NoSuchKey{})
+	s3obj.EXPECT().ListParts(context.Background(), &s3.ListPartsInput{
+		Bucket:   aws.String("bucket"),
+		Key:      aws.String("uploadC"),
+		UploadId: aws.String("multipartC"),
+	}).Return(&s3.ListPartsOutput{
+		Parts: []types.Part{
+			{Size: aws.Int64(2000), ETag: aws.String("etag-1"), PartNumber: aws.Int32(1)},
+		},
+	}, nil)
+	s3obj.EXPECT().HeadObject(context.Background(), &s3.HeadObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("uploadC.part"),
+	}).Return(nil, &types.NotFound{})
+
+	report, err := store.AnalyzeLifecycle(context.Background(), 7*24*time.Hour)
+	assert.Nil(err)
+	assert.Equal(3, report.Uploads)
+	assert.Equal([]string{"uploadA+multipartA", "uploadC+multipartC"}, report.StaleUploads)
+	assert.Equal(1, report.OrphanedUploads)
+	assert.Equal(int64(4048), report.ReclaimableBytes)
+	assert.Equal([]LifecycleRecommendation{
+		{
+			Action:      LifecycleTerminateStaleUploads,
+			Description: "2 multipart uploads older than 7 days, estimated 4.0 KiB reclaimable, of which 1 have no .info object and cannot be resumed",
+			Automatic:   true,
+		},
+		{
+			Action:      LifecycleAddAbortRule,
+			Description: "Add a lifecycle rule aborting incomplete multipart uploads after 7 days, so that the storage removes abandoned uploads itself",
+		},
+	}, report.Recommendations)
+}
+
+func TestLifecycleFormatting(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("7", formatCount(7))
+	assert.Equal("2,113", formatCount(2113))
+	assert.Equal("1,000,000", formatCount(1000000))
+
+	assert.Equal("1 day", formatAge(24*time.Hour))
+	assert.Equal("7 days", formatAge(7*24*time.Hour))
+	assert.Equal("36h0m0s", formatAge(36*time.Hour))
+
+	assert.Equal("512 B", formatBytes(512))
+	assert.Equal("1.5 KiB", formatBytes(1536))
+	assert.Equal("480.0 GiB", formatBytes(480*1024*1024*1024))
+}
@@ -0,0 +1,92 @@
+package s3store
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/tus/tusd/v2/pkg/handler"
+)
+
+// ErrMetadataTooLarge is returned when creating an upload whose metadata exceeds
+// MaxObjectMetadataSize, unless MetadataOverflow is enabled.
+var ErrMetadataTooLarge = handler.NewError("ERR_METADATA_TOO_LARGE", "upload metadata exceeds the size limit of the storage backend", http.StatusBadRequest)
+
+// truncatedMetadataKey is added to the object metadata if some of the upload's
+// metadata has been omitted, see MetadataOverflow.
+const truncatedMetadataKey = "tusd-metadata-truncated"
+
+// objectMetadata converts the upload's metadata into values which are accepted
+// by S3 as object metadata. If MetadataOverflow is enabled and the metadata
+// exceeds MaxObjectMetadataSize, only as many keys as fit into the limit are
+// included, starting with the smallest ones.
+func (store S3Store) objectMetadata(metaData handler.MetaData) map[string]string {
+	metadata := sanitizeMetadata(metaData)
+	if !store.MetadataOverflow || !store.exceedsMetadataLimit(metadata) {
+		return metadata
+	}
+
+	keys := make([]string, 0, len(metadata))
+	for key := range metadata {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		sizeI := len(keys[i]) + len(metadata[keys[i]])
+		sizeJ := len(keys[j]) + len(metadata[keys[j]])
+		if sizeI != sizeJ {
+			return sizeI < sizeJ
+		}
+		return keys[i] < keys[j]
+	})
+
+	truncated := map[string]string{truncatedMetadataKey: "true"}
+	size := metadataSize(truncated)
+	for _, key := range keys {
+		entrySize := len(key) + len(metadata[key])
+		if size+entrySize > store.MaxObjectMetadataSize {
+			break
+		}
+		truncated[key] = metadata[key]
+		size += entrySize
+	}
+
+	return truncated
+}
+
+// checkMetadataSize returns ErrMetadataTooLarge if the metadata does not fit
+// into the object metadata and MetadataOverflow is disabled. Otherwise, it
+// reports whether the object metadata is truncated.
+func (store S3Store) checkMetadataSize(metaData handler.MetaData) (truncated bool, err error) {
+	if !store.exceedsMetadataLimit(sanitizeMetadata(metaData)) {
+		return false, nil
+	}
+
+	if !store.MetadataOverflow {
+		return false, ErrMetadataTooLarge
+	}
+
+	return true, nil
+}
+
+// sanitizeMetadata replaces the characters in the metadata's values which are
+// not allowed in HTTP headers, so that it can be sent as object metadata.
+func sanitizeMetadata(metaData handler.MetaData) map[string]string {
+	metadata := make(map[string]string, len(metaData))
+	for key, value := range metaData {
+		metadata[key] = nonPrintableRegexp.ReplaceAllString(value, "?")
+	}
+	return metadata
+}
+
+func (store S3Store) exceedsMetadataLimit(metadata map[string]string) bool {
+	return store.MaxObjectMetadataSize > 0 && metadataSize(metadata) > store.MaxObjectMetadataSize
+}
+
+// metadataSize returns the size of the object metadata as counted by S3: the
+// number of bytes in the UTF-8 encoding of each key and value.
+func metadataSize(metadata map[string]string) int {
+	size := 0
+	for key, value := range metadata {
+		size += len(key) + len(value)
+	}
+	return size
+}
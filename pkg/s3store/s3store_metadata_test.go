@@ -0,0 +1,102 @@
+package s3store
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/tus/tusd/v2/pkg/handler"
+)
+
+func TestNewUploadMetadataTooLarge(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	s3obj := NewMockS3API(mockCtrl)
+	store := New("bucket", s3obj)
+	store.MaxObjectMetadataSize = 2 * 1024
+
+	// No request is sent to S3.
+	upload, err := store.NewUpload(context.Background(), handler.FileInfo{
+		ID:   "uploadId",
+		Size: 500,
+		MetaData: map[string]string{
+			"filename":    "a.txt",
+			"description": strings.Repeat("a", 2048),
+		},
+	})
+	assert.Nil(upload)
+	assert.Equal(ErrMetadataTooLarge, err)
+}
+
+func TestNewUploadMetadataOverflow(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	s3obj := NewMockS3API(mockCtrl)
+	store := New("bucket", s3obj)
+	store.MaxObjectMetadataSize = 64
+	store.MetadataOverflow = true
+
+	metaData := handler.MetaData{
+		"filename":    "a.txt",
+		"filetype":    "text/plain",
+		"description": strings.Repeat("a", 100),
+	}
+
+	gomock.InOrder(
+		s3obj.EXPECT().CreateMultipartUpload(context.Background(), &s3.CreateMultipartUploadInput{
+			Bucket: aws.String("bucket"),
+			Key:    aws.String("uploadId"),
+			// The description does not fit into the limit.
+			Metadata: map[string]string{
+				"filename":                "a.txt",
+				"filetype":                "text/plain",
+				"tusd-metadata-truncated": "true",
+			},
+		}).Return(&s3.CreateMultipartUploadOutput{
+			UploadId: aws.String("multipartId"),
+		}, nil),
+		s3obj.EXPECT().PutObject(context.Background(), gomock.Any()),
+	)
+
+	upload, err := store.NewUpload(context.Background(), handler.FileInfo{
+		ID:       "uploadId",
+		Size:     500,
+		MetaData: metaData,
+	})
+	assert.Nil(err)
+
+	// The info object contains the complete metadata.
+	info, err := upload.GetInfo(context.Background())
+	assert.Nil(err)
+	assert.Equal(metaData, info.MetaData)
+	assert.Equal("true", info.Storage["MetadataTruncated"])
+}
+
+func TestMetadataSize(t *testing.T) {
+	assert := assert.New(t)
+
+	store := New("bucket", nil)
+	store.MaxObjectMetadataSize = 10
+
+	// Non-ASCII characters are replaced before the size is measured.
+	truncated, err := store.checkMetadataSize(handler.MetaData{"name": "Menü"})
+	assert.Nil(err)
+	assert.False(truncated)
+
+	_, err = store.checkMetadataSize(handler.MetaData{"name": "Menu123"})
+	assert.Equal(ErrMetadataTooLarge, err)
+
+	store.MaxObjectMetadataSize = 0
+	truncated, err = store.checkMetadataSize(handler.MetaData{"name": strings.Repeat("a", 10000)})
+	assert.Nil(err)
+	assert.False(truncated)
+}
@@ -0,0 +1,167 @@
+package s3store
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// downloadRange is a range of the object, which has been prefetched into memory.
+type downloadRange struct {
+	data []byte
+	err  error
+}
+
+// parallelReader reads an object using concurrent ranged GetObject requests.
+// While the consumer reads one range, the following ranges are fetched in the
+// background and buffered in memory, so that up to ConcurrentDownloadRanges
+// ranges are held at once. Their content
+// is returned in order, so that the reader can be used like the body of a
+// single GetObject request.
+type parallelReader struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// current is the range, which is being read by the consumer. Initially, it
+	// is the body of the first, not prefetched range.
+	current io.Reader
+	body    io.ReadCloser
+
+	// pending contains the results of the prefetched ranges in order. It is
+	// closed once all ranges have been requested.
+	pending chan chan downloadRange
+}
+
+// newParallelReader returns a reader for the object described by input, whose
+// first range has been requested already and is available as first. It fetches
+// the remaining ranges up to size concurrently.
+func (store S3Store) newParallelReader(ctx context.Context, input s3.GetObjectInput, first *s3.GetObjectOutput, size int64) *parallelReader {
+	ctx, cancel := context.WithCancel(ctx)
+
+	// Prevent mixing the ranges of different objects, if the object is
+	// replaced while it is being read.
+	if input.VersionId == nil {
+		if first.VersionId != nil {
+			input.VersionId = first.VersionId
+		} else {
+			input.IfMatch = first.ETag
+		}
+	}
+
+	reader := &parallelReader{
+		ctx:     ctx,
+		cancel:  cancel,
+		current: first.Body,
+		body:    first.Body,
+		pending: make(chan chan downloadRange, store.ConcurrentDownloadRanges-1),
+	}
+
+	go func() {
+		defer close(reader.pending)
+
+		for start := store.DownloadRangeSize; start < size; start += store.DownloadRangeSize {
+			end := min(start+store.DownloadRangeSize, size) - 1
+			result := make(chan downloadRange, 1)
+
+			// Sending blocks while the other ranges are waiting to be read, which
+			// limits the number of concurrent requests and the memory used for
+			// buffering them.
+			select {
+			case reader.pending <- result:
+			case <-ctx.Done():
+				return
+			}
+
+			rangeInput := input
+			rangeInput.Range = aws.String(fmt.Sprintf("bytes=%d-%d", start, end))
+			length := end - start + 1
+			go func() {
+				data, err := store.fetchRange(ctx, &rangeInput, length)
+				result <- downloadRange{data, err}
+			}()
+		}
+	}()
+
+	return reader
+}
+
+func (store S3Store) fetchRange(ctx context.Context, input *s3.GetObjectInput, length int64) ([]byte, error) {
+	res, err := store.Service.GetObject(ctx, input)
+	if err != nil {
+		return nil, convertError(err)
+	}
+	defer res.Body.Close()
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(res.Body, data); err != nil {
+		return nil, fmt.Errorf("s3store: unable to read range %s: %w", aws.ToString(input.Range), err)
+	}
+
+	return data, nil
+}
+
+func (r *parallelReader) Read(p []byte) (int, error) {
+	for {
+		n, err := r.current.Read(p)
+		if err != io.EOF {
+			return n, err
+		}
+		if n > 0 {
+			return n, nil
+		}
+
+		if r.body != nil {
+			r.body.Close()
+			r.body = nil
+		}
+
+		result, ok := <-r.pending
+		if !ok {
+			// The producer stops early, if the context has been cancelled.
+			if err := r.ctx.Err(); err != nil {
+				return 0, err
+			}
+			return 0, io.EOF
+		}
+
+		select {
+		case next := <-result:
+			if next.err != nil {
+				return 0, next.err
+			}
+			r.current = bytes.NewReader(next.data)
+		case <-r.ctx.Done():
+			return 0, r.ctx.Err()
+		}
+	}
+}
+
+func (r *parallelReader) Close() error {
+	r.cancel()
+	if r.body != nil {
+		return r.body.Close()
+	}
+	return nil
+}
+
+// objectSizeFromContentRange extracts the size of the object from the
+// Content-Range header of a ranged GetObject response, e.g. "bytes 0-99/1234".
+func objectSizeFromContentRange(contentRange *string) (int64, bool) {
+	_, total, found := strings.Cut(aws.ToString(contentRange), "/")
+	if !found {
+		return 0, false
+	}
+
+	size, err := strconv.ParseInt(total, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	return size, true
+}
@@ -0,0 +1,121 @@
+package s3store
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+func TestGetReaderConcurrentRanges(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	s3obj := NewMockS3API(mockCtrl)
+	store := New("bucket", s3obj)
+	store.ConcurrentDownloadRanges = 2
+	store.DownloadRangeSize = 4
+
+	rangeInput := func(r string, ifMatch *string) *s3.GetObjectInput {
+		return &s3.GetObjectInput{
+			Bucket:  aws.String("bucket"),
+			Key:     aws.String("uploadId"),
+			Range:   aws.String(r),
+			IfMatch: ifMatch,
+		}
+	}
+	rangeOutput := func(content string) *s3.GetObjectOutput {
+		return &s3.GetObjectOutput{
+			Body: io.NopCloser(bytes.NewReader([]byte(content))),
+		}
+	}
+
+	s3obj.EXPECT().GetObject(context.Background(), rangeInput("bytes=0-3", nil)).Return(&s3.GetObjectOutput{
+		Body:         io.NopCloser(bytes.NewReader([]byte("hell"))),
+		ContentRange: aws.String("bytes 0-3/11"),
+		ETag:         aws.String(`"etag"`),
+	}, nil)
+	s3obj.EXPECT().GetObject(gomock.Any(), rangeInput("bytes=4-7", aws.String(`"etag"`))).Return(rangeOutput("o wo"), nil)
+	s3obj.EXPECT().GetObject(gomock.Any(), rangeInput("bytes=8-10", aws.String(`"etag"`))).Return(rangeOutput("rld"), nil)
+
+	upload, err := store.GetUpload(context.Background(), "uploadId+multipartId")
+	assert.Nil(err)
+
+	reader, err := upload.GetReader(context.Background())
+	assert.Nil(err)
+
+	content, err := io.ReadAll(reader)
+	assert.Nil(err)
+	assert.Equal("hello world", string(content))
+	assert.Nil(reader.Close())
+}
+
+func TestGetReaderConcurrentRangesSmallObject(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	s3obj := NewMockS3API(mockCtrl)
+	store := New("bucket", s3obj)
+	store.ConcurrentDownloadRanges = 2
+	store.DownloadRangeSize = 4
+
+	body := io.NopCloser(bytes.NewReader([]byte("hi")))
+	s3obj.EXPECT().GetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("uploadId"),
+		Range:  aws.String("bytes=0-3"),
+	}).Return(&s3.GetObjectOutput{
+		Body:         body,
+		ContentRange: aws.String("bytes 0-1/2"),
+	}, nil)
+
+	upload, err := store.GetUpload(context.Background(), "uploadId+multipartId")
+	assert.Nil(err)
+
+	reader, err := upload.GetReader(context.Background())
+	assert.Nil(err)
+	assert.Equal(body, reader)
+}
+
+func TestGetReaderConcurrentRangesFailure(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	s3obj := NewMockS3API(mockCtrl)
+	store := New("bucket", s3obj)
+	store.ConcurrentDownloadRanges = 2
+	store.DownloadRangeSize = 4
+
+	s3obj.EXPECT().GetObject(context.Background(), gomock.Any()).Return(&s3.GetObjectOutput{
+		Body:         io.NopCloser(bytes.NewReader([]byte("hell"))),
+		ContentRange: aws.String("bytes 0-3/8"),
+		VersionId:    aws.String("version"),
+	}, nil)
+	s3obj.EXPECT().GetObject(gomock.Any(), &s3.GetObjectInput{
+		Bucket:    aws.String("bucket"),
+		Key:       aws.String("uploadId"),
+		Range:     aws.String("bytes=4-7"),
+		VersionId: aws.String("version"),
+	}).Return(nil, &types.NoSuchKey{})
+
+	upload, err := store.GetUpload(context.Background(), "uploadId+multipartId")
+	assert.Nil(err)
+
+	reader, err := upload.GetReader(context.Background())
+	assert.Nil(err)
+
+	content, err := io.ReadAll(reader)
+	assert.Equal("hell", string(content))
+	assert.NotNil(err)
+	assert.Nil(reader.Close())
+}
@@ -3,12 +3,12 @@ package s3store
 import (
 	"bytes"
 	"context"
-	"errors"
 	"io"
 	"os"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tus/tusd/v2/internal/bufferpool"
 )
 
 const TEMP_DIR_USE_MEMORY = "_memory"
@@ -20,6 +20,12 @@ type s3PartProducer struct {
 	err                     error
 	r                       io.Reader
 	diskWriteDurationMetric prometheus.Summary
+
+	// temporaryFiles, if set, limits the size and number of the files on disk
+	// to maxTemporaryBytes and maxTemporaryFiles.
+	temporaryFiles    *temporaryFiles
+	maxTemporaryBytes int64
+	maxTemporaryFiles int64
 }
 
 type fileChunk struct {
@@ -58,7 +64,7 @@ func (spp *s3PartProducer) closeUnreadFiles() {
 func (spp *s3PartProducer) produce(ctx context.Context, partSize int64) {
 outerloop:
 	for {
-		file, ok, err := spp.nextPart(partSize)
+		file, ok, err := spp.nextPart(ctx, partSize)
 		if err != nil {
 			// An error occured. Stop producing.
 			spp.err = err
@@ -72,6 +78,7 @@ outerloop:
 		case spp.files <- file:
 		case <-ctx.Done():
 			// We are told to stop producing. Stop producing.
+			file.closeReader()
 			break outerloop
 		}
 	}
@@ -79,10 +86,11 @@ outerloop:
 	close(spp.files)
 }
 
-func (spp *s3PartProducer) nextPart(size int64) (fileChunk, bool, error) {
+func (spp *s3PartProducer) nextPart(ctx context.Context, size int64) (fileChunk, bool, error) {
 	if spp.tmpDir != TEMP_DIR_USE_MEMORY {
-		// Create a temporary file to store the part
-		file, err := os.CreateTemp(spp.tmpDir, "tusd-s3-tmp-")
+		// Create a temporary file to store the part. This waits if the limits
+		// on temporary files are reached.
+		file, err := spp.temporaryFiles.create(ctx, spp.tmpDir, "tusd-s3-tmp-", size, spp.maxTemporaryBytes, spp.maxTemporaryFiles)
 		if err != nil {
 			return fileChunk{}, false, err
 		}
@@ -90,9 +98,9 @@ func (spp *s3PartProducer) nextPart(size int64) (fileChunk, bool, error) {
 		limitedReader := io.LimitReader(spp.r, size)
 		start := time.Now()
 
-		n, err := io.Copy(file, limitedReader)
+		n, err := bufferpool.Copy(file, limitedReader)
 		if err != nil {
-			cleanUpTempFile(file)
+			file.remove()
 			return fileChunk{}, false, err
 		}
 
@@ -100,9 +108,10 @@ func (spp *s3PartProducer) nextPart(size int64) (fileChunk, bool, error) {
 		// io.Copy returns 0 since it is unable to read any bytes. In that
 		// case, we can close the s3PartProducer.
 		if n == 0 {
-			cleanUpTempFile(file)
+			file.remove()
 			return fileChunk{}, false, nil
 		}
+		file.setSize(n)
 
 		elapsed := time.Since(start)
 		ms := float64(elapsed.Nanoseconds() / int64(time.Millisecond))
@@ -119,22 +128,21 @@ func (spp *s3PartProducer) nextPart(size int64) (fileChunk, bool, error) {
 				// Since the file opened here are used for request bodies, it is not
 				// necessary to close them on our own, but we still do it just to be sure.
 				// However, a possible error from duplicate close operations is ignored on purpose.
-				if err := file.Close(); err != nil && !errors.Is(err, os.ErrClosed) {
-					return err
-				}
-				return os.Remove(file.Name())
+				return file.remove()
 			},
 			size: n,
 		}, true, nil
 	} else {
-		// Create a temporary buffer to store the part
-		buf := new(bytes.Buffer)
+		// Take a buffer from the pool to store the part. It is returned once
+		// the part has been uploaded.
+		buf := bufferpool.GetBuffer(size)
 
 		limitedReader := io.LimitReader(spp.r, size)
 		start := time.Now()
 
 		n, err := io.Copy(buf, limitedReader)
 		if err != nil {
+			bufferpool.PutBuffer(buf)
 			return fileChunk{}, false, err
 		}
 
@@ -142,6 +150,7 @@ func (spp *s3PartProducer) nextPart(size int64) (fileChunk, bool, error) {
 		// io.Copy returns 0 since it is unable to read any bytes. In that
 		// case, we can close the s3PartProducer.
 		if n == 0 {
+			bufferpool.PutBuffer(buf)
 			return fileChunk{}, false, nil
 		}
 
@@ -151,9 +160,12 @@ func (spp *s3PartProducer) nextPart(size int64) (fileChunk, bool, error) {
 
 		return fileChunk{
 			// buf does not get written to anymore, so we can turn it into a reader
-			reader:      bytes.NewReader(buf.Bytes()),
-			closeReader: func() error { return nil },
-			size:        n,
+			reader: bytes.NewReader(buf.Bytes()),
+			closeReader: func() error {
+				bufferpool.PutBuffer(buf)
+				return nil
+			},
+			size: n,
 		}, true, nil
 	}
 }
@@ -0,0 +1,95 @@
+package s3store
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/tus/tusd/v2/pkg/handler"
+)
+
+// pointerPlaceholderRegexp matches the placeholders in PointerObjectKey, e.g.
+// {{filename}}.
+var pointerPlaceholderRegexp = regexp.MustCompile(`\{\{\s*([^{}\s]+)\s*\}\}`)
+
+// pointerObject is the JSON encoded content of a pointer object.
+type pointerObject struct {
+	ID        string
+	Bucket    string
+	Key       string
+	VersionId string `json:",omitempty"`
+}
+
+// pointerKey returns the key of the pointer object for an upload with the
+// given metadata, or false if PointerObjectKey is not set or the metadata does
+// not contain a value for one of its placeholders.
+func (store S3Store) pointerKey(metaData handler.MetaData) (string, bool) {
+	if store.PointerObjectKey == "" {
+		return "", false
+	}
+
+	complete := true
+	key := pointerPlaceholderRegexp.ReplaceAllStringFunc(store.PointerObjectKey, func(placeholder string) string {
+		name := pointerPlaceholderRegexp.FindStringSubmatch(placeholder)[1]
+		value := store.FilenamePolicy.Sanitize(metaData[name])
+		if value == "" {
+			complete = false
+		}
+		return value
+	})
+	if !complete {
+		return "", false
+	}
+
+	prefix := store.ObjectPrefix
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	return prefix + key, true
+}
+
+// writePointerObject stores the pointer object for the finished upload, if
+// PointerObjectKey is set. An existing pointer object under the same key is
+// replaced.
+func (upload *s3Upload) writePointerObject(ctx context.Context) error {
+	store := upload.store
+	if store.PointerObjectKey == "" {
+		return nil
+	}
+
+	info, _, _, err := upload.getInternalInfo(ctx)
+	if err != nil {
+		return convertError(err)
+	}
+
+	key, ok := store.pointerKey(info.MetaData)
+	if !ok {
+		return nil
+	}
+
+	data, err := json.Marshal(pointerObject{
+		ID:        info.ID,
+		Bucket:    store.Bucket,
+		Key:       *store.keyWithPrefix(upload.location()),
+		VersionId: info.Storage["VersionId"],
+	})
+	if err != nil {
+		return err
+	}
+
+	t := time.Now()
+	_, err = store.Service.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(store.Bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String("application/json"),
+	})
+	store.observeRequest(ctx, t, metricPutPointerObject, err)
+	return convertError(err)
+}
@@ -0,0 +1,93 @@
+package s3store
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/tus/tusd/v2/pkg/handler"
+)
+
+func TestPointerKey(t *testing.T) {
+	assert := assert.New(t)
+
+	store := New("bucket", nil)
+	_, ok := store.pointerKey(handler.MetaData{"filename": "report.pdf"})
+	assert.False(ok)
+
+	store.ObjectPrefix = "uploads"
+	store.PointerObjectKey = "by-name/{{user}}/{{ filename }}"
+
+	key, ok := store.pointerKey(handler.MetaData{"user": "alice", "filename": "report.pdf"})
+	assert.True(ok)
+	assert.Equal("uploads/by-name/alice/report.pdf", key)
+
+	// Values cannot escape their path segment.
+	key, ok = store.pointerKey(handler.MetaData{"user": "../bob", "filename": "a/../report.pdf"})
+	assert.True(ok)
+	assert.Equal("uploads/by-name/bob/report.pdf", key)
+
+	_, ok = store.pointerKey(handler.MetaData{"filename": "report.pdf"})
+	assert.False(ok)
+	_, ok = store.pointerKey(handler.MetaData{"user": "..", "filename": "report.pdf"})
+	assert.False(ok)
+}
+
+func TestFinishUploadWritesPointerObject(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	s3obj := NewMockS3API(mockCtrl)
+	store := New("bucket", s3obj)
+	store.ObjectPrefix = "uploads"
+	store.PointerObjectKey = "by-name/{{user}}/{{filename}}"
+
+	s3obj.EXPECT().GetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("uploads/uploadId.info"),
+	}).Return(&s3.GetObjectOutput{
+		Body: io.NopCloser(bytes.NewReader([]byte(`{"ID":"uploadId+multipartId","Size":100,"Offset":0,"MetaData":{"filename":"report.pdf","user":"alice"},"Storage":{"Bucket":"bucket","Key":"uploads/uploadId","Type":"s3store"}}`))),
+	}, nil)
+	s3obj.EXPECT().ListParts(context.Background(), &s3.ListPartsInput{
+		Bucket:           aws.String("bucket"),
+		Key:              aws.String("uploads/uploadId"),
+		UploadId:         aws.String("multipartId"),
+		PartNumberMarker: nil,
+	}).Return(&s3.ListPartsOutput{
+		Parts: []types.Part{
+			{
+				Size:       aws.Int64(100),
+				ETag:       aws.String("etag-1"),
+				PartNumber: aws.Int32(1),
+			},
+		},
+	}, nil)
+	s3obj.EXPECT().HeadObject(context.Background(), &s3.HeadObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("uploads/uploadId.part"),
+	}).Return(nil, &types.NotFound{})
+
+	gomock.InOrder(
+		s3obj.EXPECT().CompleteMultipartUpload(context.Background(), gomock.Any()).Return(&s3.CompleteMultipartUploadOutput{}, nil),
+		s3obj.EXPECT().PutObject(context.Background(), NewPutObjectInputMatcher(&s3.PutObjectInput{
+			Bucket:      aws.String("bucket"),
+			Key:         aws.String("uploads/by-name/alice/report.pdf"),
+			Body:        bytes.NewReader([]byte(`{"ID":"uploadId+multipartId","Bucket":"bucket","Key":"uploads/uploadId"}`)),
+			ContentType: aws.String("application/json"),
+		})).Return(&s3.PutObjectOutput{}, nil),
+	)
+
+	upload, err := store.GetUpload(context.Background(), "uploadId+multipartId")
+	assert.Nil(err)
+
+	err = upload.FinishUpload(context.Background())
+	assert.Nil(err)
+}
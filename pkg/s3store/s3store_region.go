@@ -0,0 +1,185 @@
+package s3store
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"regexp"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// bucketRegionHeader is included in responses from S3 if a request has been
+// sent to the wrong region.
+const bucketRegionHeader = "X-Amz-Bucket-Region"
+
+// expectedRegionPattern extracts the bucket's region from the message of an
+// AuthorizationHeaderMalformed error, for example "the region 'us-east-1' is
+// wrong; expecting 'eu-west-1'".
+var expectedRegionPattern = regexp.MustCompile(`expecting '([a-z0-9-]+)'`)
+
+// regionDiscoveryService wraps an S3 client and sends requests to the bucket's
+// region, if it differs from the region configured for the client. S3 rejects
+// such requests with a 301 PermanentRedirect or a 400 AuthorizationHeaderMalformed
+// response, which names the bucket's region. The region is then remembered and
+// the request is retried once in the bucket's region. Requests whose body
+// cannot be rewound are not retried, but subsequent requests use the region.
+type regionDiscoveryService struct {
+	S3API
+
+	mutex  sync.RWMutex
+	region string
+}
+
+// newRegionDiscoveryService wraps the given S3 client.
+func newRegionDiscoveryService(service S3API) *regionDiscoveryService {
+	return &regionDiscoveryService{
+		S3API: service,
+	}
+}
+
+// options appends an option for using the discovered region, if any, to the
+// given options.
+func (s *regionDiscoveryService) options(opt []func(*s3.Options)) []func(*s3.Options) {
+	s.mutex.RLock()
+	region := s.region
+	s.mutex.RUnlock()
+
+	if region == "" {
+		return opt
+	}
+
+	return append(opt[:len(opt):len(opt)], func(o *s3.Options) {
+		o.Region = region
+	})
+}
+
+// discoverRegion remembers the bucket's region if the error indicates that the
+// request has been sent to the wrong region. It reports whether a different
+// region has been discovered.
+func (s *regionDiscoveryService) discoverRegion(err error) bool {
+	region := bucketRegionFromError(err)
+	if region == "" {
+		return false
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if region == s.region {
+		return false
+	}
+
+	s.region = region
+	return true
+}
+
+// bucketRegionFromError returns the bucket's region contained in a redirect or
+// region error, or an empty string for all other errors.
+func bucketRegionFromError(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	var responseErr *smithyhttp.ResponseError
+	if errors.As(err, &responseErr) && responseErr.Response != nil {
+		if region := responseErr.Response.Header.Get(bucketRegionHeader); region != "" {
+			if responseErr.Response.StatusCode == http.StatusMovedPermanently || isRegionError(err) {
+				return region
+			}
+		}
+	}
+
+	if isAwsErrorCode(err, "AuthorizationHeaderMalformed") {
+		if match := expectedRegionPattern.FindStringSubmatch(err.Error()); match != nil {
+			return match[1]
+		}
+	}
+
+	return ""
+}
+
+func isRegionError(err error) bool {
+	return isAwsErrorCode(err, "PermanentRedirect") || isAwsErrorCode(err, "AuthorizationHeaderMalformed")
+}
+
+// callInRegion calls fn with the options for the discovered region. If the
+// request has been sent to the wrong region, it is retried in the bucket's
+// region.
+func callInRegion[Input any, Output any](ctx context.Context, s *regionDiscoveryService, fn func(context.Context, Input, ...func(*s3.Options)) (Output, error), input Input, body io.Reader, opt []func(*s3.Options)) (Output, error) {
+	// Remember the position of the body, so that it can be rewound for the retry.
+	seeker, isSeeker := body.(io.Seeker)
+	var start int64
+	if isSeeker {
+		var err error
+		start, err = seeker.Seek(0, io.SeekCurrent)
+		isSeeker = err == nil
+	}
+
+	output, err := fn(ctx, input, s.options(opt)...)
+	if !s.discoverRegion(err) || ctx.Err() != nil {
+		return output, err
+	}
+
+	if body != nil {
+		if !isSeeker {
+			return output, err
+		}
+		if _, seekErr := seeker.Seek(start, io.SeekStart); seekErr != nil {
+			return output, err
+		}
+	}
+
+	return fn(ctx, input, s.options(opt)...)
+}
+
+func (s *regionDiscoveryService) PutObject(ctx context.Context, input *s3.PutObjectInput, opt ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	return callInRegion(ctx, s, s.S3API.PutObject, input, input.Body, opt)
+}
+
+func (s *regionDiscoveryService) ListParts(ctx context.Context, input *s3.ListPartsInput, opt ...func(*s3.Options)) (*s3.ListPartsOutput, error) {
+	return callInRegion(ctx, s, s.S3API.ListParts, input, nil, opt)
+}
+
+func (s *regionDiscoveryService) UploadPart(ctx context.Context, input *s3.UploadPartInput, opt ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+	return callInRegion(ctx, s, s.S3API.UploadPart, input, input.Body, opt)
+}
+
+func (s *regionDiscoveryService) GetObject(ctx context.Context, input *s3.GetObjectInput, opt ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	return callInRegion(ctx, s, s.S3API.GetObject, input, nil, opt)
+}
+
+func (s *regionDiscoveryService) HeadObject(ctx context.Context, input *s3.HeadObjectInput, opt ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	return callInRegion(ctx, s, s.S3API.HeadObject, input, nil, opt)
+}
+
+func (s *regionDiscoveryService) CreateMultipartUpload(ctx context.Context, input *s3.CreateMultipartUploadInput, opt ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	return callInRegion(ctx, s, s.S3API.CreateMultipartUpload, input, nil, opt)
+}
+
+func (s *regionDiscoveryService) AbortMultipartUpload(ctx context.Context, input *s3.AbortMultipartUploadInput, opt ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	return callInRegion(ctx, s, s.S3API.AbortMultipartUpload, input, nil, opt)
+}
+
+func (s *regionDiscoveryService) DeleteObject(ctx context.Context, input *s3.DeleteObjectInput, opt ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	return callInRegion(ctx, s, s.S3API.DeleteObject, input, nil, opt)
+}
+
+func (s *regionDiscoveryService) DeleteObjects(ctx context.Context, input *s3.DeleteObjectsInput, opt ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error) {
+	return callInRegion(ctx, s, s.S3API.DeleteObjects, input, nil, opt)
+}
+
+func (s *regionDiscoveryService) CompleteMultipartUpload(ctx context.Context, input *s3.CompleteMultipartUploadInput, opt ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	return callInRegion(ctx, s, s.S3API.CompleteMultipartUpload, input, nil, opt)
+}
+
+func (s *regionDiscoveryService) UploadPartCopy(ctx context.Context, input *s3.UploadPartCopyInput, opt ...func(*s3.Options)) (*s3.UploadPartCopyOutput, error) {
+	return callInRegion(ctx, s, s.S3API.UploadPartCopy, input, nil, opt)
+}
+
+func (s *regionDiscoveryService) ListMultipartUploads(ctx context.Context, input *s3.ListMultipartUploadsInput, opt ...func(*s3.Options)) (*s3.ListMultipartUploadsOutput, error) {
+	return callInRegion(ctx, s, s.S3API.ListMultipartUploads, input, nil, opt)
+}
@@ -0,0 +1,125 @@
+package s3store
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+func newRedirectError(region string) error {
+	return &smithyhttp.ResponseError{
+		Response: &smithyhttp.Response{Response: &http.Response{
+			StatusCode: http.StatusMovedPermanently,
+			Header:     http.Header{bucketRegionHeader: []string{region}},
+		}},
+		Err: &smithy.GenericAPIError{Code: "PermanentRedirect", Message: "The bucket you are attempting to access must be addressed using the specified endpoint."},
+	}
+}
+
+func regionFromOptions(opts []func(*s3.Options)) string {
+	var options s3.Options
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return options.Region
+}
+
+func TestRegionDiscoveryRedirect(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	s3obj := NewMockS3API(mockCtrl)
+	service := newRegionDiscoveryService(s3obj)
+
+	input := &s3.HeadObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("uploadId"),
+	}
+
+	gomock.InOrder(
+		s3obj.EXPECT().HeadObject(context.Background(), input).Return(nil, newRedirectError("eu-west-1")),
+		s3obj.EXPECT().HeadObject(context.Background(), input, gomock.Any()).DoAndReturn(func(ctx context.Context, input *s3.HeadObjectInput, opts ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+			assert.Equal("eu-west-1", regionFromOptions(opts))
+			return &s3.HeadObjectOutput{}, nil
+		}),
+		// Subsequent requests are sent to the discovered region right away.
+		s3obj.EXPECT().HeadObject(context.Background(), input, gomock.Any()).DoAndReturn(func(ctx context.Context, input *s3.HeadObjectInput, opts ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+			assert.Equal("eu-west-1", regionFromOptions(opts))
+			return &s3.HeadObjectOutput{}, nil
+		}),
+	)
+
+	_, err := service.HeadObject(context.Background(), input)
+	assert.Nil(err)
+	_, err = service.HeadObject(context.Background(), input)
+	assert.Nil(err)
+}
+
+func TestRegionDiscoveryRewindsBody(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	s3obj := NewMockS3API(mockCtrl)
+	service := newRegionDiscoveryService(s3obj)
+
+	body := bytes.NewReader([]byte("xxhello"))
+	body.Seek(2, io.SeekStart)
+	input := &s3.PutObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("uploadId"),
+		Body:   body,
+	}
+
+	gomock.InOrder(
+		s3obj.EXPECT().PutObject(context.Background(), input).DoAndReturn(func(ctx context.Context, input *s3.PutObjectInput, opts ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+			io.ReadAll(input.Body)
+			return nil, &smithy.GenericAPIError{
+				Code:    "AuthorizationHeaderMalformed",
+				Message: "The authorization header is malformed; the region 'us-east-1' is wrong; expecting 'ap-south-1'",
+			}
+		}),
+		s3obj.EXPECT().PutObject(context.Background(), input, gomock.Any()).DoAndReturn(func(ctx context.Context, input *s3.PutObjectInput, opts ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+			assert.Equal("ap-south-1", regionFromOptions(opts))
+			data, err := io.ReadAll(input.Body)
+			assert.Nil(err)
+			assert.Equal("hello", string(data))
+			return &s3.PutObjectOutput{}, nil
+		}),
+	)
+
+	_, err := service.PutObject(context.Background(), input)
+	assert.Nil(err)
+}
+
+func TestRegionDiscoveryOtherErrors(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	s3obj := NewMockS3API(mockCtrl)
+	service := newRegionDiscoveryService(s3obj)
+
+	input := &s3.GetObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("uploadId"),
+	}
+
+	s3obj.EXPECT().GetObject(context.Background(), input).Return(nil, errors.New("other error"))
+
+	_, err := service.GetObject(context.Background(), input)
+	assert.Equal("other error", err.Error())
+	assert.Equal("", regionFromOptions(service.options(nil)))
+}
@@ -0,0 +1,77 @@
+package s3store
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/tus/tusd/v2/pkg/handler"
+)
+
+// shardOf returns the prefix, under which the objects of a new upload with the
+// given object ID are stored if PrefixShards is set, e.g. "0a/", or an empty
+// string otherwise. Existing uploads are accessed using the shard recorded in
+// their info instead, see s3Upload.resolveShard.
+func (store S3Store) shardOf(objectId string) string {
+	if store.PrefixShards < 2 || objectId == "" {
+		return ""
+	}
+
+	hash := fnv.New32a()
+	hash.Write([]byte(objectId))
+
+	// All shards use the same number of hex digits, so that they are listed in
+	// order.
+	width := len(fmt.Sprintf("%x", store.PrefixShards-1))
+	return fmt.Sprintf("%0*x/", width, hash.Sum32()%uint32(store.PrefixShards))
+}
+
+// location returns the key of the object for a new upload with the given
+// object ID, relative to ObjectPrefix. The .info and .part objects use the
+// same location relative to MetadataObjectPrefix.
+func (store S3Store) location(objectId string) string {
+	return store.shardOf(objectId) + objectId
+}
+
+// location returns the key of the upload's object relative to ObjectPrefix,
+// see S3Store.location.
+func (upload *s3Upload) location() string {
+	return upload.shard + upload.objectId
+}
+
+// resolveShard sets the shard of the upload to the one recorded in its info,
+// given the result of reading the info from the upload's current location. If
+// the info is stored in .info objects and was not found, the upload may have
+// been created before sharding was enabled, so the unsharded location is tried
+// next. It returns true if the shard changed, in which case the info must be
+// read again.
+func (upload *s3Upload) resolveShard(info handler.FileInfo, err error) bool {
+	shard := upload.shard
+	switch {
+	case err == nil:
+		shard = info.Storage["Shard"]
+		if shard != "" {
+			shard += "/"
+		}
+	case errors.Is(err, handler.ErrNotFound) || isAwsError[*types.NoSuchKey](err):
+		if upload.store.MetadataStore == nil {
+			shard = ""
+		}
+	}
+
+	changed := shard != upload.shard
+	upload.shard = shard
+	return changed
+}
+
+// objectIdFromKey returns the object ID of the upload, whose object is stored
+// under key, where prefix is the result of keyWithPrefix("").
+func (store S3Store) objectIdFromKey(key string, prefix string) string {
+	objectId := strings.TrimPrefix(key, prefix)
+	if shard, rest, ok := strings.Cut(objectId, "/"); ok && store.shardOf(rest) == shard+"/" {
+		return rest
+	}
+	return objectId
+}
@@ -0,0 +1,208 @@
+package s3store
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/tus/tusd/v2/pkg/handler"
+)
+
+func TestShardOf(t *testing.T) {
+	assert := assert.New(t)
+
+	store := New("bucket", nil)
+	assert.Equal("", store.shardOf("uploadId"))
+
+	store.PrefixShards = 16
+	assert.Equal("1/", store.shardOf("uploadId"))
+	assert.Equal("c/", store.shardOf("a"))
+	assert.Equal("", store.shardOf(""))
+
+	store.PrefixShards = 256
+	assert.Equal("71/", store.shardOf("uploadId"))
+	assert.Equal("2c/", store.shardOf("a"))
+}
+
+func TestNewUploadWithPrefixShards(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	s3obj := NewMockS3API(mockCtrl)
+	store := New("bucket", s3obj)
+	store.ObjectPrefix = "uploads"
+	store.PrefixShards = 16
+
+	body := `{"ID":"uploadId+multipartId","Size":500,"SizeIsDeferred":false,"Offset":0,"MetaData":null,"IsPartial":false,"IsFinal":false,"PartialUploads":null,"Storage":{"Bucket":"bucket","Key":"uploads/1/uploadId","Shard":"1","Type":"s3store"}}`
+	gomock.InOrder(
+		s3obj.EXPECT().CreateMultipartUpload(context.Background(), &s3.CreateMultipartUploadInput{
+			Bucket:   aws.String("bucket"),
+			Key:      aws.String("uploads/1/uploadId"),
+			Metadata: map[string]string{},
+		}).Return(&s3.CreateMultipartUploadOutput{
+			UploadId: aws.String("multipartId"),
+		}, nil),
+		s3obj.EXPECT().PutObject(context.Background(), &s3.PutObjectInput{
+			Bucket:        aws.String("bucket"),
+			Key:           aws.String("uploads/1/uploadId.info"),
+			Body:          bytes.NewReader([]byte(body)),
+			ContentLength: aws.Int64(int64(len(body))),
+		}),
+	)
+
+	upload, err := store.NewUpload(context.Background(), handler.FileInfo{
+		ID:   "uploadId",
+		Size: 500,
+	})
+	assert.Nil(err)
+	assert.NotNil(upload)
+}
+
+func TestListUploadsWithPrefixShards(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	s3obj := NewMockS3API(mockCtrl)
+	store := New("bucket", s3obj)
+	store.ObjectPrefix = "uploads"
+	store.PrefixShards = 16
+
+	s3obj.EXPECT().ListMultipartUploads(context.Background(), &s3.ListMultipartUploadsInput{
+		Bucket: aws.String("bucket"),
+		Prefix: aws.String("uploads/"),
+	}).Return(&s3.ListMultipartUploadsOutput{
+		Uploads: []types.MultipartUpload{
+			{Key: aws.String("uploads/1/uploadId"), UploadId: aws.String("multipartA")},
+			{Key: aws.String("uploads/c/a"), UploadId: aws.String("multipartB")},
+		},
+	}, nil)
+
+	ids, cursor, err := store.ListUploads(context.Background(), "")
+	assert.Nil(err)
+	assert.Equal([]string{"uploadId+multipartA", "a+multipartB"}, ids)
+	assert.Equal("", cursor)
+}
+
+func TestGetInfoWithUnshardedInfoObject(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	s3obj := NewMockS3API(mockCtrl)
+	store := New("bucket", s3obj)
+	store.ObjectPrefix = "uploads"
+	store.PrefixShards = 16
+
+	// The upload was created before sharding was enabled, so its objects are
+	// not found in the shard derived from its ID.
+	s3obj.EXPECT().GetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("uploads/1/uploadId.info"),
+	}).Return(nil, &types.NoSuchKey{})
+	s3obj.EXPECT().ListParts(context.Background(), &s3.ListPartsInput{
+		Bucket:   aws.String("bucket"),
+		Key:      aws.String("uploads/1/uploadId"),
+		UploadId: aws.String("multipartId"),
+	}).Return(nil, &types.NoSuchUpload{})
+	s3obj.EXPECT().HeadObject(context.Background(), &s3.HeadObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("uploads/1/uploadId.part"),
+	}).Return(nil, &types.NotFound{})
+
+	s3obj.EXPECT().GetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("uploads/uploadId.info"),
+	}).Return(&s3.GetObjectOutput{
+		Body: io.NopCloser(bytes.NewReader([]byte(`{"ID":"uploadId+multipartId","Size":500,"Storage":{"Bucket":"bucket","Key":"uploads/uploadId","Type":"s3store"}}`))),
+	}, nil)
+	s3obj.EXPECT().ListParts(context.Background(), &s3.ListPartsInput{
+		Bucket:   aws.String("bucket"),
+		Key:      aws.String("uploads/uploadId"),
+		UploadId: aws.String("multipartId"),
+	}).Return(&s3.ListPartsOutput{
+		Parts: []types.Part{
+			{
+				Size:       aws.Int64(100),
+				ETag:       aws.String("etag-1"),
+				PartNumber: aws.Int32(1),
+			},
+		},
+	}, nil)
+	s3obj.EXPECT().HeadObject(context.Background(), &s3.HeadObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("uploads/uploadId.part"),
+	}).Return(nil, &types.NotFound{})
+
+	upload, err := store.GetUpload(context.Background(), "uploadId+multipartId")
+	assert.Nil(err)
+
+	info, err := upload.GetInfo(context.Background())
+	assert.Nil(err)
+	assert.Equal(int64(100), info.Offset)
+	assert.Equal("uploadId", upload.(*s3Upload).location())
+}
+
+func TestGetInfoWithRecordedShard(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	s3obj := NewMockS3API(mockCtrl)
+	store := New("bucket", s3obj)
+	store.ObjectPrefix = "uploads"
+	store.MetadataStore = handler.NewMemoryMetadataStore()
+
+	// The upload was created while 256 shards were used.
+	store.PrefixShards = 256
+	assert.Nil(store.MetadataStore.PutInfo(context.Background(), "uploadId", handler.FileInfo{
+		ID:      "uploadId+multipartId",
+		Size:    500,
+		Storage: map[string]string{"Bucket": "bucket", "Key": "uploads/71/uploadId", "Shard": "71", "Type": "s3store"},
+	}))
+	store.PrefixShards = 16
+
+	// The multipart upload is not found in the shard derived from the ID, which
+	// must not be mistaken for a finished upload.
+	s3obj.EXPECT().ListParts(context.Background(), &s3.ListPartsInput{
+		Bucket:   aws.String("bucket"),
+		Key:      aws.String("uploads/1/uploadId"),
+		UploadId: aws.String("multipartId"),
+	}).Return(nil, &types.NoSuchUpload{})
+	s3obj.EXPECT().HeadObject(context.Background(), &s3.HeadObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("uploads/1/uploadId.part"),
+	}).Return(nil, &types.NotFound{})
+
+	s3obj.EXPECT().ListParts(context.Background(), &s3.ListPartsInput{
+		Bucket:   aws.String("bucket"),
+		Key:      aws.String("uploads/71/uploadId"),
+		UploadId: aws.String("multipartId"),
+	}).Return(&s3.ListPartsOutput{
+		Parts: []types.Part{
+			{
+				Size:       aws.Int64(100),
+				ETag:       aws.String("etag-1"),
+				PartNumber: aws.Int32(1),
+			},
+		},
+	}, nil)
+	s3obj.EXPECT().HeadObject(context.Background(), &s3.HeadObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("uploads/71/uploadId.part"),
+	}).Return(nil, &types.NotFound{})
+
+	upload, err := store.GetUpload(context.Background(), "uploadId+multipartId")
+	assert.Nil(err)
+
+	info, err := upload.GetInfo(context.Background())
+	assert.Nil(err)
+	assert.Equal(int64(100), info.Offset)
+}
@@ -0,0 +1,51 @@
+package s3store
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/tus/tusd/v2/pkg/handler"
+)
+
+// customerKey holds the SSE-C parameters for S3 requests, which are derived
+// from the encryption key supplied by the client, see handler.EncryptionKeyFromContext.
+// All fields are nil if the client did not supply a key, so they can be assigned
+// to the inputs of S3 requests unconditionally.
+//
+// The key is only used for the object holding the upload's content and the
+// incomplete part. The .info object is not encrypted with it, so that uploads
+// can still be listed and inspected without the client's key.
+type customerKey struct {
+	algorithm *string
+	key       *string
+	keyMD5    *string
+}
+
+func customerKeyFromContext(ctx context.Context) customerKey {
+	encryptionKey, ok := handler.EncryptionKeyFromContext(ctx)
+	if !ok {
+		return customerKey{}
+	}
+
+	sum := md5.Sum(encryptionKey.Key)
+	return customerKey{
+		algorithm: aws.String(encryptionKey.Algorithm),
+		key:       aws.String(base64.StdEncoding.EncodeToString(encryptionKey.Key)),
+		keyMD5:    aws.String(base64.StdEncoding.EncodeToString(sum[:])),
+	}
+}
+
+// setHeaders adds the SSE-C headers to requests, which are sent using presigned
+// URLs. The headers are part of the signature, but not of the URL.
+func (key customerKey) setHeaders(header http.Header) {
+	if key.algorithm == nil {
+		return
+	}
+
+	header.Set("X-Amz-Server-Side-Encryption-Customer-Algorithm", *key.algorithm)
+	header.Set("X-Amz-Server-Side-Encryption-Customer-Key", *key.key)
+	header.Set("X-Amz-Server-Side-Encryption-Customer-Key-Md5", *key.keyMD5)
+}
@@ -0,0 +1,87 @@
+package s3store
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"github.com/tus/tusd/v2/pkg/handler"
+)
+
+var testEncryptionKey = handler.EncryptionKey{
+	Algorithm: "AES256",
+	Key:       bytes.Repeat([]byte{0x42}, 32),
+}
+
+func TestNewUploadWithCustomerKey(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	s3obj := NewMockS3API(mockCtrl)
+	store := New("bucket", s3obj)
+
+	ctx := handler.WithEncryptionKey(context.Background(), testEncryptionKey)
+
+	gomock.InOrder(
+		s3obj.EXPECT().CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+			Bucket:               aws.String("bucket"),
+			Key:                  aws.String("uploadId"),
+			Metadata:             map[string]string{},
+			SSECustomerAlgorithm: aws.String("AES256"),
+			SSECustomerKey:       aws.String("QkJCQkJCQkJCQkJCQkJCQkJCQkJCQkJCQkJCQkJCQkI="),
+			SSECustomerKeyMD5:    aws.String("8NB6psqPvuXCjIqE3J2m5Q=="),
+		}).Return(&s3.CreateMultipartUploadOutput{
+			UploadId: aws.String("multipartId"),
+		}, nil),
+		// The key must not be used for, nor persisted in the .info object.
+		s3obj.EXPECT().PutObject(ctx, &s3.PutObjectInput{
+			Bucket:        aws.String("bucket"),
+			Key:           aws.String("uploadId.info"),
+			Body:          bytes.NewReader([]byte(`{"ID":"uploadId+multipartId","Size":500,"SizeIsDeferred":false,"Offset":0,"MetaData":null,"IsPartial":false,"IsFinal":false,"PartialUploads":null,"Storage":{"Bucket":"bucket","Key":"uploadId","Type":"s3store"}}`)),
+			ContentLength: aws.Int64(210),
+		}),
+	)
+
+	upload, err := store.NewUpload(ctx, handler.FileInfo{
+		ID:   "uploadId",
+		Size: 500,
+	})
+	assert.Nil(err)
+	assert.NotNil(upload)
+}
+
+func TestGetReaderWithCustomerKey(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	s3obj := NewMockS3API(mockCtrl)
+	store := New("bucket", s3obj)
+
+	ctx := handler.WithEncryptionKey(context.Background(), testEncryptionKey)
+
+	s3obj.EXPECT().GetObject(ctx, &s3.GetObjectInput{
+		Bucket:               aws.String("bucket"),
+		Key:                  aws.String("uploadId"),
+		SSECustomerAlgorithm: aws.String("AES256"),
+		SSECustomerKey:       aws.String("QkJCQkJCQkJCQkJCQkJCQkJCQkJCQkJCQkJCQkJCQkI="),
+		SSECustomerKeyMD5:    aws.String("8NB6psqPvuXCjIqE3J2m5Q=="),
+	}).Return(&s3.GetObjectOutput{
+		Body: io.NopCloser(bytes.NewReader([]byte(`hello world`))),
+	}, nil)
+
+	upload, err := store.GetUpload(ctx, "uploadId+multipartId")
+	assert.Nil(err)
+
+	content, err := upload.GetReader(ctx)
+	assert.Nil(err)
+	assert.Equal(io.NopCloser(bytes.NewReader([]byte(`hello world`))), content)
+}
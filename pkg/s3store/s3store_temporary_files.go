@@ -0,0 +1,232 @@
+package s3store
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// temporaryFilePatterns are the patterns of the names of temporary files
+// created by the S3Store.
+var temporaryFilePatterns = []string{"tusd-s3-tmp-*", "tusd-s3-concat-tmp-*"}
+
+// temporaryFiles keeps track of the temporary files which are currently staged
+// on disk, so that their total size and number can be limited. It is shared by
+// all copies of an S3Store.
+type temporaryFiles struct {
+	lock  sync.Mutex
+	bytes int64
+	// inUse maps the paths of the staged files to their reserved sizes.
+	inUse map[string]int64
+	// released is closed and replaced whenever files are released, in order
+	// to wake up all goroutines waiting for space.
+	released chan struct{}
+
+	bytesMetric prometheus.Gauge
+	filesMetric prometheus.Gauge
+}
+
+func newTemporaryFiles() *temporaryFiles {
+	return &temporaryFiles{
+		inUse:    make(map[string]int64),
+		released: make(chan struct{}),
+		bytesMetric: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "tusd_s3_temporary_bytes",
+			Help: "Number of bytes staged in temporary files on disk",
+		}),
+		filesMetric: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "tusd_s3_temporary_files",
+			Help: "Number of temporary files staged on disk",
+		}),
+	}
+}
+
+// temporaryFile is a staged file, whose size is accounted for in temporaryFiles.
+type temporaryFile struct {
+	*os.File
+	files *temporaryFiles
+}
+
+// create creates a temporary file in dir and reserves size bytes for it. If
+// the limits on the total size or number of files would be exceeded, it waits
+// until other files have been removed. A single file is always allowed, so
+// that a part larger than maxBytes does not wait forever. Limits of zero are
+// not enforced. A nil temporaryFiles creates files without accounting.
+func (t *temporaryFiles) create(ctx context.Context, dir string, pattern string, size int64, maxBytes int64, maxFiles int64) (*temporaryFile, error) {
+	if t == nil {
+		file, err := os.CreateTemp(dir, pattern)
+		if err != nil {
+			return nil, err
+		}
+		return &temporaryFile{File: file}, nil
+	}
+
+	for {
+		t.lock.Lock()
+		files := int64(len(t.inUse))
+		fitsBytes := maxBytes <= 0 || t.bytes+size <= maxBytes
+		fitsFiles := maxFiles <= 0 || files < maxFiles
+		if files == 0 || (fitsBytes && fitsFiles) {
+			break
+		}
+		released := t.released
+		t.lock.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-released:
+		}
+	}
+	defer t.lock.Unlock()
+
+	file, err := os.CreateTemp(dir, pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	t.inUse[file.Name()] = size
+	t.bytes += size
+	t.updateMetrics()
+
+	return &temporaryFile{File: file, files: t}, nil
+}
+
+// setSize replaces the reserved size with the file's actual size.
+func (f *temporaryFile) setSize(size int64) {
+	t := f.files
+	if t == nil {
+		return
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if previous, ok := t.inUse[f.Name()]; ok {
+		t.inUse[f.Name()] = size
+		t.bytes += size - previous
+		t.updateMetrics()
+		if size < previous {
+			t.notifyReleased()
+		}
+	}
+}
+
+// remove closes and removes the file and releases its reserved space. It may
+// be called multiple times.
+func (f *temporaryFile) remove() error {
+	// A possible error from duplicate close operations is ignored on purpose.
+	err := f.Close()
+	if errors.Is(err, os.ErrClosed) {
+		err = nil
+	}
+	if removeErr := os.Remove(f.Name()); err == nil && !errors.Is(removeErr, os.ErrNotExist) {
+		err = removeErr
+	}
+
+	if t := f.files; t != nil {
+		t.lock.Lock()
+		if size, ok := t.inUse[f.Name()]; ok {
+			delete(t.inUse, f.Name())
+			t.bytes -= size
+			t.updateMetrics()
+			t.notifyReleased()
+		}
+		t.lock.Unlock()
+	}
+
+	return err
+}
+
+func (t *temporaryFiles) isInUse(path string) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	_, ok := t.inUse[path]
+	return ok
+}
+
+// notifyReleased wakes up all goroutines waiting for space. The lock must be held.
+func (t *temporaryFiles) notifyReleased() {
+	close(t.released)
+	t.released = make(chan struct{})
+}
+
+// updateMetrics sets the gauges to the current numbers. The lock must be held.
+func (t *temporaryFiles) updateMetrics() {
+	t.bytesMetric.Set(float64(t.bytes))
+	t.filesMetric.Set(float64(len(t.inUse)))
+}
+
+// createTemporaryFile creates a temporary file in the TemporaryDirectory within
+// the limits of MaxTemporaryBytes and MaxTemporaryFiles.
+func (store S3Store) createTemporaryFile(ctx context.Context, pattern string, size int64) (*temporaryFile, error) {
+	return store.temporaryFiles.create(ctx, store.TemporaryDirectory, pattern, size, store.MaxTemporaryBytes, store.MaxTemporaryFiles)
+}
+
+// RemoveOrphanedTemporaryFiles removes temporary files created by an S3Store
+// from the TemporaryDirectory, which are not in use by this store and have not
+// been modified for maxAge. Such files are left behind if tusd is terminated
+// while staging parts. The oldest files are removed first. It returns the
+// number of removed files. It should be called on startup and periodically.
+func (store S3Store) RemoveOrphanedTemporaryFiles(maxAge time.Duration) (int, error) {
+	if store.TemporaryDirectory == TEMP_DIR_USE_MEMORY {
+		return 0, nil
+	}
+
+	dir := store.TemporaryDirectory
+	if dir == "" {
+		dir = os.TempDir()
+	}
+
+	type orphan struct {
+		path    string
+		modTime time.Time
+	}
+	var orphans []orphan
+	for _, pattern := range temporaryFilePatterns {
+		paths, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return 0, err
+		}
+
+		for _, path := range paths {
+			if store.temporaryFiles != nil && store.temporaryFiles.isInUse(path) {
+				continue
+			}
+
+			stat, err := os.Stat(path)
+			if err != nil || !stat.Mode().IsRegular() || time.Since(stat.ModTime()) < maxAge {
+				continue
+			}
+
+			orphans = append(orphans, orphan{path, stat.ModTime()})
+		}
+	}
+
+	sort.Slice(orphans, func(i, j int) bool {
+		return orphans[i].modTime.Before(orphans[j].modTime)
+	})
+
+	removed := 0
+	var errs []error
+	for _, orphan := range orphans {
+		if err := os.Remove(orphan.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, err)
+			continue
+		}
+		removed++
+	}
+
+	if len(errs) > 0 {
+		return removed, newMultiError(errs)
+	}
+
+	return removed, nil
+}
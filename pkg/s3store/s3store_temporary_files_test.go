@@ -0,0 +1,105 @@
+package s3store
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTemporaryFilesLimits(t *testing.T) {
+	assert := assert.New(t)
+
+	files := newTemporaryFiles()
+	dir := t.TempDir()
+
+	first, err := files.create(context.Background(), dir, "tusd-s3-tmp-", 100, 150, 0)
+	assert.Nil(err)
+	assert.Equal(int64(100), files.bytes)
+
+	// The second file does not fit into the limit, so creating it waits until
+	// the first file has been removed.
+	created := make(chan *temporaryFile)
+	go func() {
+		second, err := files.create(context.Background(), dir, "tusd-s3-tmp-", 100, 150, 0)
+		assert.Nil(err)
+		created <- second
+	}()
+
+	select {
+	case <-created:
+		t.Fatal("file must not be created while the limit is reached")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Reducing the size of the first file frees enough space.
+	first.setSize(20)
+
+	second := <-created
+	assert.Equal(int64(120), files.bytes)
+
+	assert.Nil(first.remove())
+	assert.Nil(second.remove())
+	assert.Nil(second.remove())
+	assert.Equal(int64(0), files.bytes)
+	assert.Len(files.inUse, 0)
+
+	entries, err := os.ReadDir(dir)
+	assert.Nil(err)
+	assert.Len(entries, 0)
+}
+
+func TestTemporaryFilesLimitCancel(t *testing.T) {
+	assert := assert.New(t)
+
+	files := newTemporaryFiles()
+	dir := t.TempDir()
+
+	first, err := files.create(context.Background(), dir, "tusd-s3-tmp-", 0, 0, 1)
+	assert.Nil(err)
+	defer first.remove()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err = files.create(ctx, dir, "tusd-s3-tmp-", 0, 0, 1)
+	assert.Equal(context.DeadlineExceeded, err)
+}
+
+func TestRemoveOrphanedTemporaryFiles(t *testing.T) {
+	assert := assert.New(t)
+
+	store := New("bucket", nil)
+	store.TemporaryDirectory = t.TempDir()
+
+	old := time.Now().Add(-2 * time.Hour)
+	createFile := func(name string, modTime time.Time) string {
+		path := filepath.Join(store.TemporaryDirectory, name)
+		assert.Nil(os.WriteFile(path, []byte("data"), 0644))
+		assert.Nil(os.Chtimes(path, modTime, modTime))
+		return path
+	}
+
+	orphan := createFile("tusd-s3-tmp-orphan", old)
+	concatOrphan := createFile("tusd-s3-concat-tmp-orphan", old)
+	recent := createFile("tusd-s3-tmp-recent", time.Now())
+	other := createFile("other-file", old)
+
+	inUse, err := store.createTemporaryFile(context.Background(), "tusd-s3-tmp-", 0)
+	assert.Nil(err)
+	defer inUse.remove()
+	assert.Nil(os.Chtimes(inUse.Name(), old, old))
+
+	removed, err := store.RemoveOrphanedTemporaryFiles(time.Hour)
+	assert.Nil(err)
+	assert.Equal(2, removed)
+
+	assert.NoFileExists(orphan)
+	assert.NoFileExists(concatOrphan)
+	assert.FileExists(recent)
+	assert.FileExists(other)
+	assert.FileExists(inUse.Name())
+}
@@ -28,6 +28,12 @@ var _ handler.DataStore = S3Store{}
 var _ handler.TerminaterDataStore = S3Store{}
 var _ handler.ConcaterDataStore = S3Store{}
 var _ handler.LengthDeferrerDataStore = S3Store{}
+var _ handler.ListableDataStore = S3Store{}
+var _ handler.PresignerDataStore = S3Store{}
+var _ handler.PartPresignerDataStore = S3Store{}
+var _ handler.ChunkSizeHinterDataStore = S3Store{}
+var _ handler.ExpirerDataStore = S3Store{}
+var _ handler.ImporterDataStore = S3Store{}
 
 func TestNewUpload(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
@@ -55,7 +61,7 @@ func TestNewUpload(t *testing.T) {
 			Bucket:        aws.String("bucket"),
 			Key:           aws.String("uploadId.info"),
 			Body:          bytes.NewReader([]byte(`{"ID":"uploadId+multipartId","Size":500,"SizeIsDeferred":false,"Offset":0,"MetaData":{"bar":"menü\r\nhi","foo":"hello"},"IsPartial":false,"IsFinal":false,"PartialUploads":null,"Storage":{"Bucket":"bucket","Key":"uploadId","Type":"s3store"}}`)),
-			ContentLength: 241,
+			ContentLength: aws.Int64(241),
 		}),
 	)
 
@@ -100,7 +106,7 @@ func TestNewUploadWithObjectPrefix(t *testing.T) {
 			Bucket:        aws.String("bucket"),
 			Key:           aws.String("my/uploaded/files/uploadId.info"),
 			Body:          bytes.NewReader([]byte(`{"ID":"uploadId+multipartId","Size":500,"SizeIsDeferred":false,"Offset":0,"MetaData":{"bar":"menü","foo":"hello"},"IsPartial":false,"IsFinal":false,"PartialUploads":null,"Storage":{"Bucket":"bucket","Key":"my/uploaded/files/uploadId","Type":"s3store"}}`)),
-			ContentLength: 253,
+			ContentLength: aws.Int64(253),
 		}),
 	)
 
@@ -146,7 +152,7 @@ func TestNewUploadWithMetadataObjectPrefix(t *testing.T) {
 			Bucket:        aws.String("bucket"),
 			Key:           aws.String("my/metadata/uploadId.info"),
 			Body:          bytes.NewReader([]byte(`{"ID":"uploadId+multipartId","Size":500,"SizeIsDeferred":false,"Offset":0,"MetaData":{"bar":"menü","foo":"hello"},"IsPartial":false,"IsFinal":false,"PartialUploads":null,"Storage":{"Bucket":"bucket","Key":"my/uploaded/files/uploadId","Type":"s3store"}}`)),
-			ContentLength: 253,
+			ContentLength: aws.Int64(253),
 		}),
 	)
 
@@ -187,13 +193,13 @@ func TestEmptyUpload(t *testing.T) {
 			Bucket:        aws.String("bucket"),
 			Key:           aws.String("uploadId.info"),
 			Body:          bytes.NewReader([]byte(`{"ID":"uploadId+multipartId","Size":0,"SizeIsDeferred":false,"Offset":0,"MetaData":null,"IsPartial":false,"IsFinal":false,"PartialUploads":null,"Storage":{"Bucket":"bucket","Key":"uploadId","Type":"s3store"}}`)),
-			ContentLength: 208,
+			ContentLength: aws.Int64(208),
 		}),
 		s3obj.EXPECT().UploadPart(context.Background(), NewUploadPartInputMatcher(&s3.UploadPartInput{
 			Bucket:     aws.String("bucket"),
 			Key:        aws.String("uploadId"),
 			UploadId:   aws.String("multipartId"),
-			PartNumber: 1,
+			PartNumber: aws.Int32(1),
 			Body:       bytes.NewReader([]byte("")),
 		})).Return(&s3.UploadPartOutput{
 			ETag: aws.String("etag"),
@@ -206,11 +212,11 @@ func TestEmptyUpload(t *testing.T) {
 				Parts: []types.CompletedPart{
 					{
 						ETag:       aws.String("etag"),
-						PartNumber: 1,
+						PartNumber: aws.Int32(1),
 					},
 				},
 			},
-		}).Return(nil, nil),
+		}).Return(&s3.CompleteMultipartUploadOutput{}, nil),
 	)
 
 	info := handler.FileInfo{
@@ -247,6 +253,121 @@ func TestNewUploadLargerMaxObjectSize(t *testing.T) {
 	assert.Nil(upload)
 }
 
+func TestNewUploadObjectHeaders(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	s3obj := NewMockS3API(mockCtrl)
+	store := New("bucket", s3obj)
+	store.ObjectHeadersFromMetadata = true
+	store.CacheControl = "max-age=60"
+
+	gomock.InOrder(
+		s3obj.EXPECT().CreateMultipartUpload(context.Background(), &s3.CreateMultipartUploadInput{
+			Bucket: aws.String("bucket"),
+			Key:    aws.String("uploadId"),
+			Metadata: map[string]string{
+				"filename":         "men?.txt",
+				"content-encoding": "gzip",
+			},
+			CacheControl:       aws.String("max-age=60"),
+			ContentDisposition: aws.String(`attachment;filename="men_.txt";filename*=UTF-8''men%C3%BC.txt`),
+			ContentEncoding:    aws.String("gzip"),
+		}).Return(&s3.CreateMultipartUploadOutput{
+			UploadId: aws.String("multipartId"),
+		}, nil),
+		s3obj.EXPECT().PutObject(context.Background(), gomock.Any()),
+	)
+
+	upload, err := store.NewUpload(context.Background(), handler.FileInfo{
+		ID:   "uploadId",
+		Size: 500,
+		MetaData: map[string]string{
+			"filename":         "menü.txt",
+			"content-encoding": "gzip",
+		},
+	})
+	assert.Nil(err)
+	assert.NotNil(upload)
+}
+
+func TestNewUploadPreventOverwrite(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	s3obj := NewMockS3API(mockCtrl)
+	store := New("bucket", s3obj)
+	store.PreventOverwrite = true
+
+	gomock.InOrder(
+		s3obj.EXPECT().HeadObject(context.Background(), &s3.HeadObjectInput{
+			Bucket: aws.String("bucket"),
+			Key:    aws.String("uploadId"),
+		}).Return(nil, &types.NotFound{}),
+		s3obj.EXPECT().HeadObject(context.Background(), &s3.HeadObjectInput{
+			Bucket: aws.String("bucket"),
+			Key:    aws.String("uploadId.info"),
+		}).Return(&s3.HeadObjectOutput{}, nil),
+	)
+
+	upload, err := store.NewUpload(context.Background(), handler.FileInfo{
+		ID:   "uploadId",
+		Size: 500,
+	})
+	assert.Nil(upload)
+	assert.Equal(ErrUploadExists, err)
+}
+
+func TestFinishUploadPreventOverwrite(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	s3obj := NewMockS3API(mockCtrl)
+	store := New("bucket", s3obj)
+	store.PreventOverwrite = true
+
+	s3obj.EXPECT().GetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("uploadId.info"),
+	}).Return(&s3.GetObjectOutput{
+		Body: io.NopCloser(bytes.NewReader([]byte(`{"ID":"uploadId+multipartId","Size":100,"Offset":0,"MetaData":null,"IsPartial":false,"IsFinal":false,"PartialUploads":null,"Storage":null}`))),
+	}, nil)
+	s3obj.EXPECT().ListParts(context.Background(), &s3.ListPartsInput{
+		Bucket:           aws.String("bucket"),
+		Key:              aws.String("uploadId"),
+		UploadId:         aws.String("multipartId"),
+		PartNumberMarker: nil,
+	}).Return(&s3.ListPartsOutput{
+		Parts: []types.Part{
+			{
+				Size:       aws.Int64(100),
+				ETag:       aws.String("etag-1"),
+				PartNumber: aws.Int32(1),
+			},
+		},
+	}, nil)
+	s3obj.EXPECT().HeadObject(context.Background(), &s3.HeadObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("uploadId.part"),
+	}).Return(nil, &types.NotFound{})
+
+	// The final object has been written by another upload in the meantime, so the
+	// multipart upload must not be completed.
+	s3obj.EXPECT().HeadObject(context.Background(), &s3.HeadObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("uploadId"),
+	}).Return(&s3.HeadObjectOutput{}, nil)
+
+	upload, err := store.GetUpload(context.Background(), "uploadId+multipartId")
+	assert.Nil(err)
+
+	err = upload.FinishUpload(context.Background())
+	assert.Equal(ErrUploadExists, err)
+}
+
 func TestGetInfoNotFound(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
@@ -300,19 +421,19 @@ func TestGetInfo(t *testing.T) {
 	}).Return(&s3.ListPartsOutput{
 		Parts: []types.Part{
 			{
-				PartNumber: 1,
-				Size:       100,
+				PartNumber: aws.Int32(1),
+				Size:       aws.Int64(100),
 				ETag:       aws.String("etag-1"),
 			},
 			{
-				PartNumber: 2,
-				Size:       200,
+				PartNumber: aws.Int32(2),
+				Size:       aws.Int64(200),
 				ETag:       aws.String("etag-2"),
 			},
 		},
 		NextPartNumberMarker: aws.String("2"),
 		// Simulate a truncated response, so s3store should send a second request
-		IsTruncated: true,
+		IsTruncated: aws.Bool(true),
 	}, nil)
 	s3obj.EXPECT().ListParts(context.Background(), &s3.ListPartsInput{
 		Bucket:           aws.String("bucket"),
@@ -322,8 +443,8 @@ func TestGetInfo(t *testing.T) {
 	}).Return(&s3.ListPartsOutput{
 		Parts: []types.Part{
 			{
-				PartNumber: 3,
-				Size:       100,
+				PartNumber: aws.Int32(3),
+				Size:       aws.Int64(100),
 				ETag:       aws.String("etag-3"),
 			},
 		},
@@ -371,19 +492,19 @@ func TestGetInfoWithMetadataObjectPrefix(t *testing.T) {
 	}).Return(&s3.ListPartsOutput{
 		Parts: []types.Part{
 			{
-				PartNumber: 1,
-				Size:       100,
+				PartNumber: aws.Int32(1),
+				Size:       aws.Int64(100),
 				ETag:       aws.String("etag-1"),
 			},
 			{
-				PartNumber: 2,
-				Size:       200,
+				PartNumber: aws.Int32(2),
+				Size:       aws.Int64(200),
 				ETag:       aws.String("etag-2"),
 			},
 		},
 		NextPartNumberMarker: aws.String("2"),
 		// Simulate a truncated response, so s3store should send a second request
-		IsTruncated: true,
+		IsTruncated: aws.Bool(true),
 	}, nil)
 	s3obj.EXPECT().ListParts(context.Background(), &s3.ListPartsInput{
 		Bucket:           aws.String("bucket"),
@@ -393,8 +514,8 @@ func TestGetInfoWithMetadataObjectPrefix(t *testing.T) {
 	}).Return(&s3.ListPartsOutput{
 		Parts: []types.Part{
 			{
-				PartNumber: 3,
-				Size:       100,
+				PartNumber: aws.Int32(3),
+				Size:       aws.Int64(100),
 				ETag:       aws.String("etag-3"),
 			},
 		},
@@ -443,7 +564,7 @@ func TestGetInfoWithIncompletePart(t *testing.T) {
 		Bucket: aws.String("bucket"),
 		Key:    aws.String("uploadId.part"),
 	}).Return(&s3.HeadObjectOutput{
-		ContentLength: 10,
+		ContentLength: aws.Int64(10),
 	}, nil)
 
 	upload, err := store.GetUpload(context.Background(), "uploadId+multipartId")
@@ -529,7 +650,7 @@ func TestGetReaderNotFound(t *testing.T) {
 			Bucket:   aws.String("bucket"),
 			Key:      aws.String("uploadId"),
 			UploadId: aws.String("multipartId"),
-			MaxParts: 0,
+			MaxParts: aws.Int32(0),
 		}).Return(nil, &types.NoSuchUpload{}),
 	)
 
@@ -550,29 +671,373 @@ func TestGetReaderNotFinished(t *testing.T) {
 	store := New("bucket", s3obj)
 
 	gomock.InOrder(
-		s3obj.EXPECT().GetObject(context.Background(), &s3.GetObjectInput{
+		s3obj.EXPECT().GetObject(context.Background(), &s3.GetObjectInput{
+			Bucket: aws.String("bucket"),
+			Key:    aws.String("uploadId"),
+		}).Return(nil, &types.NoSuchKey{}),
+		s3obj.EXPECT().ListParts(context.Background(), &s3.ListPartsInput{
+			Bucket:   aws.String("bucket"),
+			Key:      aws.String("uploadId"),
+			UploadId: aws.String("multipartId"),
+			MaxParts: aws.Int32(0),
+		}).Return(&s3.ListPartsOutput{
+			Parts: []types.Part{},
+		}, nil),
+	)
+
+	upload, err := store.GetUpload(context.Background(), "uploadId+multipartId")
+	assert.Nil(err)
+
+	content, err := upload.GetReader(context.Background())
+	assert.Nil(content)
+	assert.Equal("ERR_INCOMPLETE_UPLOAD: cannot stream non-finished upload", err.Error())
+}
+
+func TestGetReaderSlowDown(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	s3obj := NewMockS3API(mockCtrl)
+	store := New("bucket", s3obj)
+
+	s3obj.EXPECT().GetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("uploadId"),
+	}).Return(nil, &smithy.GenericAPIError{Code: "SlowDown", Message: "Please reduce your request rate."})
+
+	upload, err := store.GetUpload(context.Background(), "uploadId+multipartId")
+	assert.Nil(err)
+
+	content, err := upload.GetReader(context.Background())
+	assert.Nil(content)
+	assert.Equal(ErrSlowDown, err)
+}
+
+func TestDeclareLength(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	s3obj := NewMockS3API(mockCtrl)
+	store := New("bucket", s3obj)
+
+	s3obj.EXPECT().GetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("uploadId.info"),
+	}).Return(&s3.GetObjectOutput{
+		Body: io.NopCloser(bytes.NewReader([]byte(`{"ID":"uploadId+multipartId","Size":0,"SizeIsDeferred":true,"Offset":0,"MetaData":{},"IsPartial":false,"IsFinal":false,"PartialUploads":null,"Storage":{"Bucket":"bucket","Key":"uploadId","Type":"s3store"}}`))),
+	}, nil)
+	s3obj.EXPECT().ListParts(context.Background(), &s3.ListPartsInput{
+		Bucket:           aws.String("bucket"),
+		Key:              aws.String("uploadId"),
+		UploadId:         aws.String("multipartId"),
+		PartNumberMarker: nil,
+	}).Return(&s3.ListPartsOutput{
+		Parts: []types.Part{},
+	}, nil)
+	s3obj.EXPECT().HeadObject(context.Background(), &s3.HeadObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("uploadId.part"),
+	}).Return(nil, &types.NotFound{})
+	s3obj.EXPECT().PutObject(context.Background(), &s3.PutObjectInput{
+		Bucket:        aws.String("bucket"),
+		Key:           aws.String("uploadId.info"),
+		Body:          bytes.NewReader([]byte(`{"ID":"uploadId+multipartId","Size":500,"SizeIsDeferred":false,"Offset":0,"MetaData":{},"IsPartial":false,"IsFinal":false,"PartialUploads":null,"Storage":{"Bucket":"bucket","Key":"uploadId","Type":"s3store"}}`)),
+		ContentLength: aws.Int64(208),
+	})
+
+	upload, err := store.GetUpload(context.Background(), "uploadId+multipartId")
+	assert.Nil(err)
+
+	err = store.AsLengthDeclarableUpload(upload).DeclareLength(context.Background(), 500)
+	assert.Nil(err)
+	info, err := upload.GetInfo(context.Background())
+	assert.Nil(err)
+	assert.Equal(int64(500), info.Size)
+}
+
+func TestSetExpiration(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	s3obj := NewMockS3API(mockCtrl)
+	store := New("bucket", s3obj)
+
+	s3obj.EXPECT().GetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("uploadId.info"),
+	}).Return(&s3.GetObjectOutput{
+		Body: io.NopCloser(bytes.NewReader([]byte(`{"ID":"uploadId+multipartId","Size":500,"SizeIsDeferred":false,"Offset":0,"MetaData":{},"IsPartial":false,"IsFinal":false,"PartialUploads":null,"Storage":{"Bucket":"bucket","Key":"uploadId","Type":"s3store"}}`))),
+	}, nil)
+	s3obj.EXPECT().ListParts(context.Background(), &s3.ListPartsInput{
+		Bucket:           aws.String("bucket"),
+		Key:              aws.String("uploadId"),
+		UploadId:         aws.String("multipartId"),
+		PartNumberMarker: nil,
+	}).Return(&s3.ListPartsOutput{
+		Parts: []types.Part{},
+	}, nil)
+	s3obj.EXPECT().HeadObject(context.Background(), &s3.HeadObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("uploadId.part"),
+	}).Return(nil, &types.NotFound{})
+	s3obj.EXPECT().PutObject(context.Background(), &s3.PutObjectInput{
+		Bucket:        aws.String("bucket"),
+		Key:           aws.String("uploadId.info"),
+		Body:          bytes.NewReader([]byte(`{"ID":"uploadId+multipartId","Size":500,"SizeIsDeferred":false,"Offset":0,"MetaData":{},"IsPartial":false,"IsFinal":false,"PartialUploads":null,"ExpiresAt":"2024-01-02T03:04:05Z","Storage":{"Bucket":"bucket","Key":"uploadId","Type":"s3store"}}`)),
+		ContentLength: aws.Int64(243),
+	}).Return(&s3.PutObjectOutput{}, nil)
+
+	upload, err := store.GetUpload(context.Background(), "uploadId+multipartId")
+	assert.Nil(err)
+
+	expiresAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	err = store.AsExpirableUpload(upload).SetExpiration(context.Background(), expiresAt)
+	assert.Nil(err)
+	info, err := upload.GetInfo(context.Background())
+	assert.Nil(err)
+	assert.Equal(expiresAt, *info.ExpiresAt)
+}
+
+func TestDeclareLengthWithMetadataStore(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	s3obj := NewMockS3API(mockCtrl)
+	store := New("bucket", s3obj)
+	store.MetadataStore = handler.NewMemoryMetadataStore()
+
+	err := store.MetadataStore.PutInfo(context.Background(), "uploadId", handler.FileInfo{
+		ID:             "uploadId+multipartId",
+		SizeIsDeferred: true,
+		MetaData:       handler.MetaData{},
+	})
+	assert.Nil(err)
+
+	// The info is neither read from nor written to a .info object.
+	s3obj.EXPECT().ListParts(context.Background(), &s3.ListPartsInput{
+		Bucket:           aws.String("bucket"),
+		Key:              aws.String("uploadId"),
+		UploadId:         aws.String("multipartId"),
+		PartNumberMarker: nil,
+	}).Return(&s3.ListPartsOutput{
+		Parts: []types.Part{},
+	}, nil)
+	s3obj.EXPECT().HeadObject(context.Background(), &s3.HeadObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("uploadId.part"),
+	}).Return(nil, &types.NotFound{})
+
+	upload, err := store.GetUpload(context.Background(), "uploadId+multipartId")
+	assert.Nil(err)
+
+	err = store.AsLengthDeclarableUpload(upload).DeclareLength(context.Background(), 500)
+	assert.Nil(err)
+	info, err := upload.GetInfo(context.Background())
+	assert.Nil(err)
+	assert.Equal(int64(500), info.Size)
+	assert.False(info.SizeIsDeferred)
+
+	stored, err := store.MetadataStore.GetInfo(context.Background(), "uploadId")
+	assert.Nil(err)
+	assert.Equal(int64(500), stored.Size)
+	assert.False(stored.SizeIsDeferred)
+}
+
+func TestFinishUpload(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	s3obj := NewMockS3API(mockCtrl)
+	store := New("bucket", s3obj)
+
+	s3obj.EXPECT().GetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("uploadId.info"),
+	}).Return(&s3.GetObjectOutput{
+		Body: io.NopCloser(bytes.NewReader([]byte(`{"ID":"uploadId","Size":400,"Offset":0,"MetaData":null,"IsPartial":false,"IsFinal":false,"PartialUploads":null,"Storage":null}`))),
+	}, nil)
+	s3obj.EXPECT().ListParts(context.Background(), &s3.ListPartsInput{
+		Bucket:           aws.String("bucket"),
+		Key:              aws.String("uploadId"),
+		UploadId:         aws.String("multipartId"),
+		PartNumberMarker: nil,
+	}).Return(&s3.ListPartsOutput{
+		Parts: []types.Part{
+			{
+				Size:       aws.Int64(100),
+				ETag:       aws.String("etag-1"),
+				PartNumber: aws.Int32(1),
+			},
+			{
+				Size:       aws.Int64(200),
+				ETag:       aws.String("etag-2"),
+				PartNumber: aws.Int32(2),
+			},
+		},
+		NextPartNumberMarker: aws.String("2"),
+		IsTruncated:          aws.Bool(true),
+	}, nil)
+	s3obj.EXPECT().ListParts(context.Background(), &s3.ListPartsInput{
+		Bucket:           aws.String("bucket"),
+		Key:              aws.String("uploadId"),
+		UploadId:         aws.String("multipartId"),
+		PartNumberMarker: aws.String("2"),
+	}).Return(&s3.ListPartsOutput{
+		Parts: []types.Part{
+			{
+				Size:       aws.Int64(100),
+				ETag:       aws.String("etag-3"),
+				PartNumber: aws.Int32(3),
+			},
+		},
+	}, nil)
+	s3obj.EXPECT().HeadObject(context.Background(), &s3.HeadObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("uploadId.part"),
+	}).Return(nil, &types.NotFound{})
+	s3obj.EXPECT().CompleteMultipartUpload(context.Background(), &s3.CompleteMultipartUploadInput{
+		Bucket:   aws.String("bucket"),
+		Key:      aws.String("uploadId"),
+		UploadId: aws.String("multipartId"),
+		MultipartUpload: &types.CompletedMultipartUpload{
+			Parts: []types.CompletedPart{
+				{
+					ETag:       aws.String("etag-1"),
+					PartNumber: aws.Int32(1),
+				},
+				{
+					ETag:       aws.String("etag-2"),
+					PartNumber: aws.Int32(2),
+				},
+				{
+					ETag:       aws.String("etag-3"),
+					PartNumber: aws.Int32(3),
+				},
+			},
+		},
+	}).Return(&s3.CompleteMultipartUploadOutput{}, nil)
+
+	upload, err := store.GetUpload(context.Background(), "uploadId+multipartId")
+	assert.Nil(err)
+
+	err = upload.FinishUpload(context.Background())
+	assert.Nil(err)
+}
+
+func TestFinishUploadRetriesCompletion(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	s3obj := NewMockS3API(mockCtrl)
+	store := New("bucket", s3obj)
+
+	completeInput := &s3.CompleteMultipartUploadInput{
+		Bucket:   aws.String("bucket"),
+		Key:      aws.String("uploadId"),
+		UploadId: aws.String("multipartId"),
+		MultipartUpload: &types.CompletedMultipartUpload{
+			Parts: []types.CompletedPart{
+				{
+					ETag:       aws.String("etag-1"),
+					PartNumber: aws.Int32(1),
+				},
+			},
+		},
+	}
+
+	s3obj.EXPECT().GetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("uploadId.info"),
+	}).Return(&s3.GetObjectOutput{
+		Body: io.NopCloser(bytes.NewReader([]byte(`{"ID":"uploadId","Size":100,"Offset":0,"MetaData":null,"IsPartial":false,"IsFinal":false,"PartialUploads":null,"Storage":null}`))),
+	}, nil)
+	s3obj.EXPECT().HeadObject(context.Background(), &s3.HeadObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("uploadId.part"),
+	}).Return(nil, &types.NotFound{})
+	s3obj.EXPECT().ListParts(context.Background(), &s3.ListPartsInput{
+		Bucket:           aws.String("bucket"),
+		Key:              aws.String("uploadId"),
+		UploadId:         aws.String("multipartId"),
+		PartNumberMarker: nil,
+	}).Return(&s3.ListPartsOutput{
+		Parts: []types.Part{
+			{
+				Size:       aws.Int64(100),
+				ETag:       aws.String("etag-1"),
+				PartNumber: aws.Int32(1),
+			},
+		},
+	}, nil).Times(2)
+	gomock.InOrder(
+		s3obj.EXPECT().CompleteMultipartUpload(context.Background(), completeInput).Return(nil, &smithy.GenericAPIError{Code: "InternalError", Message: "We encountered an internal error."}),
+		s3obj.EXPECT().CompleteMultipartUpload(context.Background(), completeInput).Return(&s3.CompleteMultipartUploadOutput{}, nil),
+	)
+
+	upload, err := store.GetUpload(context.Background(), "uploadId+multipartId")
+	assert.Nil(err)
+
+	err = upload.FinishUpload(context.Background())
+	assert.Nil(err)
+}
+
+func TestFinishUploadCompletedByPreviousAttempt(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	s3obj := NewMockS3API(mockCtrl)
+	store := New("bucket", s3obj)
+
+	listPartsInput := &s3.ListPartsInput{
+		Bucket:           aws.String("bucket"),
+		Key:              aws.String("uploadId"),
+		UploadId:         aws.String("multipartId"),
+		PartNumberMarker: nil,
+	}
+
+	s3obj.EXPECT().GetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("uploadId.info"),
+	}).Return(&s3.GetObjectOutput{
+		Body: io.NopCloser(bytes.NewReader([]byte(`{"ID":"uploadId","Size":100,"Offset":0,"MetaData":null,"IsPartial":false,"IsFinal":false,"PartialUploads":null,"Storage":null}`))),
+	}, nil)
+	s3obj.EXPECT().HeadObject(context.Background(), &s3.HeadObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("uploadId.part"),
+	}).Return(nil, &types.NotFound{})
+	gomock.InOrder(
+		s3obj.EXPECT().ListParts(context.Background(), listPartsInput).Return(&s3.ListPartsOutput{
+			Parts: []types.Part{
+				{
+					Size:       aws.Int64(100),
+					ETag:       aws.String("etag-1"),
+					PartNumber: aws.Int32(1),
+				},
+			},
+		}, nil),
+		s3obj.EXPECT().CompleteMultipartUpload(context.Background(), gomock.Any()).Return(nil, context.DeadlineExceeded),
+		s3obj.EXPECT().ListParts(context.Background(), listPartsInput).Return(nil, &types.NoSuchUpload{}),
+		s3obj.EXPECT().HeadObject(context.Background(), &s3.HeadObjectInput{
 			Bucket: aws.String("bucket"),
 			Key:    aws.String("uploadId"),
-		}).Return(nil, &types.NoSuchKey{}),
-		s3obj.EXPECT().ListParts(context.Background(), &s3.ListPartsInput{
-			Bucket:   aws.String("bucket"),
-			Key:      aws.String("uploadId"),
-			UploadId: aws.String("multipartId"),
-			MaxParts: 0,
-		}).Return(&s3.ListPartsOutput{
-			Parts: []types.Part{},
-		}, nil),
+		}).Return(&s3.HeadObjectOutput{ContentLength: aws.Int64(100)}, nil),
 	)
 
 	upload, err := store.GetUpload(context.Background(), "uploadId+multipartId")
 	assert.Nil(err)
 
-	content, err := upload.GetReader(context.Background())
-	assert.Nil(content)
-	assert.Equal("ERR_INCOMPLETE_UPLOAD: cannot stream non-finished upload", err.Error())
+	err = upload.FinishUpload(context.Background())
+	assert.Nil(err)
 }
 
-func TestDeclareLength(t *testing.T) {
+func TestFinishUploadPartMismatch(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
 	assert := assert.New(t)
@@ -580,42 +1045,53 @@ func TestDeclareLength(t *testing.T) {
 	s3obj := NewMockS3API(mockCtrl)
 	store := New("bucket", s3obj)
 
-	s3obj.EXPECT().GetObject(context.Background(), &s3.GetObjectInput{
-		Bucket: aws.String("bucket"),
-		Key:    aws.String("uploadId.info"),
-	}).Return(&s3.GetObjectOutput{
-		Body: io.NopCloser(bytes.NewReader([]byte(`{"ID":"uploadId+multipartId","Size":0,"SizeIsDeferred":true,"Offset":0,"MetaData":{},"IsPartial":false,"IsFinal":false,"PartialUploads":null,"Storage":{"Bucket":"bucket","Key":"uploadId","Type":"s3store"}}`))),
-	}, nil)
-	s3obj.EXPECT().ListParts(context.Background(), &s3.ListPartsInput{
+	listPartsInput := &s3.ListPartsInput{
 		Bucket:           aws.String("bucket"),
 		Key:              aws.String("uploadId"),
 		UploadId:         aws.String("multipartId"),
 		PartNumberMarker: nil,
-	}).Return(&s3.ListPartsOutput{
-		Parts: []types.Part{},
+	}
+
+	s3obj.EXPECT().GetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("uploadId.info"),
+	}).Return(&s3.GetObjectOutput{
+		Body: io.NopCloser(bytes.NewReader([]byte(`{"ID":"uploadId","Size":100,"Offset":0,"MetaData":null,"IsPartial":false,"IsFinal":false,"PartialUploads":null,"Storage":null}`))),
 	}, nil)
 	s3obj.EXPECT().HeadObject(context.Background(), &s3.HeadObjectInput{
 		Bucket: aws.String("bucket"),
 		Key:    aws.String("uploadId.part"),
 	}).Return(nil, &types.NotFound{})
-	s3obj.EXPECT().PutObject(context.Background(), &s3.PutObjectInput{
-		Bucket:        aws.String("bucket"),
-		Key:           aws.String("uploadId.info"),
-		Body:          bytes.NewReader([]byte(`{"ID":"uploadId+multipartId","Size":500,"SizeIsDeferred":false,"Offset":0,"MetaData":{},"IsPartial":false,"IsFinal":false,"PartialUploads":null,"Storage":{"Bucket":"bucket","Key":"uploadId","Type":"s3store"}}`)),
-		ContentLength: 208,
-	})
+	gomock.InOrder(
+		s3obj.EXPECT().ListParts(context.Background(), listPartsInput).Return(&s3.ListPartsOutput{
+			Parts: []types.Part{
+				{
+					Size:       aws.Int64(100),
+					ETag:       aws.String("etag-1"),
+					PartNumber: aws.Int32(1),
+				},
+			},
+		}, nil),
+		s3obj.EXPECT().CompleteMultipartUpload(context.Background(), gomock.Any()).Return(nil, &smithy.GenericAPIError{Code: "InvalidPart", Message: "One or more of the specified parts could not be found."}),
+		s3obj.EXPECT().ListParts(context.Background(), listPartsInput).Return(&s3.ListPartsOutput{
+			Parts: []types.Part{
+				{
+					Size:       aws.Int64(100),
+					ETag:       aws.String("etag-other"),
+					PartNumber: aws.Int32(1),
+				},
+			},
+		}, nil),
+	)
 
 	upload, err := store.GetUpload(context.Background(), "uploadId+multipartId")
 	assert.Nil(err)
 
-	err = store.AsLengthDeclarableUpload(upload).DeclareLength(context.Background(), 500)
-	assert.Nil(err)
-	info, err := upload.GetInfo(context.Background())
-	assert.Nil(err)
-	assert.Equal(int64(500), info.Size)
+	err = upload.FinishUpload(context.Background())
+	assert.EqualError(err, "s3store: ETag of part 1 does not match the part in S3")
 }
 
-func TestFinishUpload(t *testing.T) {
+func TestFinishUploadRecordsVersionId(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
 	assert := assert.New(t)
@@ -627,7 +1103,7 @@ func TestFinishUpload(t *testing.T) {
 		Bucket: aws.String("bucket"),
 		Key:    aws.String("uploadId.info"),
 	}).Return(&s3.GetObjectOutput{
-		Body: io.NopCloser(bytes.NewReader([]byte(`{"ID":"uploadId","Size":400,"Offset":0,"MetaData":null,"IsPartial":false,"IsFinal":false,"PartialUploads":null,"Storage":null}`))),
+		Body: io.NopCloser(bytes.NewReader([]byte(`{"ID":"uploadId+multipartId","Size":100,"Offset":0,"MetaData":null,"IsPartial":false,"IsFinal":false,"PartialUploads":null,"Storage":{"Bucket":"bucket","Key":"uploadId","Type":"s3store"}}`))),
 	}, nil)
 	s3obj.EXPECT().ListParts(context.Background(), &s3.ListPartsInput{
 		Bucket:           aws.String("bucket"),
@@ -637,30 +1113,9 @@ func TestFinishUpload(t *testing.T) {
 	}).Return(&s3.ListPartsOutput{
 		Parts: []types.Part{
 			{
-				Size:       100,
+				Size:       aws.Int64(100),
 				ETag:       aws.String("etag-1"),
-				PartNumber: 1,
-			},
-			{
-				Size:       200,
-				ETag:       aws.String("etag-2"),
-				PartNumber: 2,
-			},
-		},
-		NextPartNumberMarker: aws.String("2"),
-		IsTruncated:          true,
-	}, nil)
-	s3obj.EXPECT().ListParts(context.Background(), &s3.ListPartsInput{
-		Bucket:           aws.String("bucket"),
-		Key:              aws.String("uploadId"),
-		UploadId:         aws.String("multipartId"),
-		PartNumberMarker: aws.String("2"),
-	}).Return(&s3.ListPartsOutput{
-		Parts: []types.Part{
-			{
-				Size:       100,
-				ETag:       aws.String("etag-3"),
-				PartNumber: 3,
+				PartNumber: aws.Int32(1),
 			},
 		},
 	}, nil)
@@ -668,33 +1123,66 @@ func TestFinishUpload(t *testing.T) {
 		Bucket: aws.String("bucket"),
 		Key:    aws.String("uploadId.part"),
 	}).Return(nil, &types.NotFound{})
-	s3obj.EXPECT().CompleteMultipartUpload(context.Background(), &s3.CompleteMultipartUploadInput{
-		Bucket:   aws.String("bucket"),
-		Key:      aws.String("uploadId"),
-		UploadId: aws.String("multipartId"),
-		MultipartUpload: &types.CompletedMultipartUpload{
-			Parts: []types.CompletedPart{
+
+	gomock.InOrder(
+		s3obj.EXPECT().CompleteMultipartUpload(context.Background(), gomock.Any()).Return(&s3.CompleteMultipartUploadOutput{
+			VersionId: aws.String("version-1"),
+		}, nil),
+		s3obj.EXPECT().PutObject(context.Background(), NewPutObjectInputMatcher(&s3.PutObjectInput{
+			Bucket:        aws.String("bucket"),
+			Key:           aws.String("uploadId.info"),
+			Body:          bytes.NewReader([]byte(`{"ID":"uploadId+multipartId","Size":100,"SizeIsDeferred":false,"Offset":100,"MetaData":null,"IsPartial":false,"IsFinal":false,"PartialUploads":null,"Storage":{"Bucket":"bucket","Key":"uploadId","Type":"s3store","VersionId":"version-1"}}`)),
+			ContentLength: aws.Int64(236),
+		})).Return(&s3.PutObjectOutput{}, nil),
+		s3obj.EXPECT().GetObject(context.Background(), &s3.GetObjectInput{
+			Bucket:    aws.String("bucket"),
+			Key:       aws.String("uploadId"),
+			VersionId: aws.String("version-1"),
+		}).Return(&s3.GetObjectOutput{
+			Body: io.NopCloser(bytes.NewReader([]byte(`hello world`))),
+		}, nil),
+	)
+
+	// Calls from Terminate, which deletes the recorded version
+	s3obj.EXPECT().AbortMultipartUpload(context.Background(), gomock.Any()).Return(nil, &types.NoSuchUpload{})
+	s3obj.EXPECT().DeleteObjects(context.Background(), &s3.DeleteObjectsInput{
+		Bucket: aws.String("bucket"),
+		Delete: &types.Delete{
+			Objects: []types.ObjectIdentifier{
 				{
-					ETag:       aws.String("etag-1"),
-					PartNumber: 1,
+					Key:       aws.String("uploadId"),
+					VersionId: aws.String("version-1"),
 				},
 				{
-					ETag:       aws.String("etag-2"),
-					PartNumber: 2,
+					Key: aws.String("uploadId.part"),
 				},
 				{
-					ETag:       aws.String("etag-3"),
-					PartNumber: 3,
+					Key: aws.String("uploadId.info"),
 				},
 			},
+			Quiet: aws.Bool(true),
 		},
-	}).Return(nil, nil)
+	}).Return(&s3.DeleteObjectsOutput{}, nil)
 
 	upload, err := store.GetUpload(context.Background(), "uploadId+multipartId")
 	assert.Nil(err)
 
+	info, err := upload.GetInfo(context.Background())
+	assert.Nil(err)
+
 	err = upload.FinishUpload(context.Background())
 	assert.Nil(err)
+
+	// The version is exposed through the storage details of the FileInfo,
+	// which was handed out earlier.
+	assert.Equal("version-1", info.Storage["VersionId"])
+
+	content, err := upload.GetReader(context.Background())
+	assert.Nil(err)
+	assert.Equal(io.NopCloser(bytes.NewReader([]byte(`hello world`))), content)
+
+	err = store.AsTerminatableUpload(upload).Terminate(context.Background())
+	assert.Nil(err)
 }
 
 func TestWriteChunk(t *testing.T) {
@@ -725,14 +1213,14 @@ func TestWriteChunk(t *testing.T) {
 	}).Return(&s3.ListPartsOutput{
 		Parts: []types.Part{
 			{
-				Size:       100,
+				Size:       aws.Int64(100),
 				ETag:       aws.String("etag-1"),
-				PartNumber: 1,
+				PartNumber: aws.Int32(1),
 			},
 			{
-				Size:       200,
+				Size:       aws.Int64(200),
 				ETag:       aws.String("etag-2"),
-				PartNumber: 2,
+				PartNumber: aws.Int32(2),
 			},
 		},
 	}, nil)
@@ -746,7 +1234,7 @@ func TestWriteChunk(t *testing.T) {
 		Bucket:     aws.String("bucket"),
 		Key:        aws.String("uploadId"),
 		UploadId:   aws.String("multipartId"),
-		PartNumber: 3,
+		PartNumber: aws.Int32(3),
 		Body:       bytes.NewReader([]byte("1234")),
 	})).Return(&s3.UploadPartOutput{
 		ETag: aws.String("etag-3"),
@@ -755,7 +1243,7 @@ func TestWriteChunk(t *testing.T) {
 		Bucket:     aws.String("bucket"),
 		Key:        aws.String("uploadId"),
 		UploadId:   aws.String("multipartId"),
-		PartNumber: 4,
+		PartNumber: aws.Int32(4),
 		Body:       bytes.NewReader([]byte("5678")),
 	})).Return(&s3.UploadPartOutput{
 		ETag: aws.String("etag-4"),
@@ -764,7 +1252,7 @@ func TestWriteChunk(t *testing.T) {
 		Bucket:     aws.String("bucket"),
 		Key:        aws.String("uploadId"),
 		UploadId:   aws.String("multipartId"),
-		PartNumber: 5,
+		PartNumber: aws.Int32(5),
 		Body:       bytes.NewReader([]byte("90AB")),
 	})).Return(&s3.UploadPartOutput{
 		ETag: aws.String("etag-5"),
@@ -773,7 +1261,7 @@ func TestWriteChunk(t *testing.T) {
 		Bucket: aws.String("bucket"),
 		Key:    aws.String("uploadId.part"),
 		Body:   bytes.NewReader([]byte("CD")),
-	})).Return(nil, nil)
+	})).Return(&s3.PutObjectOutput{}, nil)
 
 	upload, err := store.GetUpload(context.Background(), "uploadId+multipartId")
 	assert.Nil(err)
@@ -805,14 +1293,14 @@ func TestWriteChunkWriteIncompletePartBecauseTooSmall(t *testing.T) {
 	}).Return(&s3.ListPartsOutput{
 		Parts: []types.Part{
 			{
-				Size:       100,
+				Size:       aws.Int64(100),
 				ETag:       aws.String("etag-1"),
-				PartNumber: 1,
+				PartNumber: aws.Int32(1),
 			},
 			{
-				Size:       200,
+				Size:       aws.Int64(200),
 				ETag:       aws.String("etag-2"),
-				PartNumber: 2,
+				PartNumber: aws.Int32(2),
 			},
 		},
 	}, nil)
@@ -825,7 +1313,7 @@ func TestWriteChunkWriteIncompletePartBecauseTooSmall(t *testing.T) {
 		Bucket: aws.String("bucket"),
 		Key:    aws.String("uploadId.part"),
 		Body:   bytes.NewReader([]byte("1234567890")),
-	})).Return(nil, nil)
+	})).Return(&s3.PutObjectOutput{}, nil)
 
 	upload, err := store.GetUpload(context.Background(), "uploadId+multipartId")
 	assert.Nil(err)
@@ -866,13 +1354,13 @@ func TestWriteChunkPrependsIncompletePart(t *testing.T) {
 		Bucket: aws.String("bucket"),
 		Key:    aws.String("uploadId.part"),
 	}).Return(&s3.HeadObjectOutput{
-		ContentLength: 3,
+		ContentLength: aws.Int64(3),
 	}, nil)
 	s3obj.EXPECT().GetObject(context.Background(), &s3.GetObjectInput{
 		Bucket: aws.String("bucket"),
 		Key:    aws.String("uploadId.part"),
 	}).Return(&s3.GetObjectOutput{
-		ContentLength: 3,
+		ContentLength: aws.Int64(3),
 		Body:          io.NopCloser(bytes.NewReader([]byte("123"))),
 	}, nil)
 	s3obj.EXPECT().DeleteObject(context.Background(), &s3.DeleteObjectInput{
@@ -884,7 +1372,7 @@ func TestWriteChunkPrependsIncompletePart(t *testing.T) {
 		Bucket:     aws.String("bucket"),
 		Key:        aws.String("uploadId"),
 		UploadId:   aws.String("multipartId"),
-		PartNumber: 1,
+		PartNumber: aws.Int32(1),
 		Body:       bytes.NewReader([]byte("1234")),
 	})).Return(&s3.UploadPartOutput{
 		ETag: aws.String("etag-1"),
@@ -893,7 +1381,7 @@ func TestWriteChunkPrependsIncompletePart(t *testing.T) {
 		Bucket:     aws.String("bucket"),
 		Key:        aws.String("uploadId"),
 		UploadId:   aws.String("multipartId"),
-		PartNumber: 2,
+		PartNumber: aws.Int32(2),
 		Body:       bytes.NewReader([]byte("5")),
 	})).Return(&s3.UploadPartOutput{
 		ETag: aws.String("etag-2"),
@@ -936,13 +1424,13 @@ func TestWriteChunkPrependsIncompletePartAndWritesANewIncompletePart(t *testing.
 		Bucket: aws.String("bucket"),
 		Key:    aws.String("uploadId.part"),
 	}).Return(&s3.HeadObjectOutput{
-		ContentLength: 3,
+		ContentLength: aws.Int64(3),
 	}, nil)
 	s3obj.EXPECT().GetObject(context.Background(), &s3.GetObjectInput{
 		Bucket: aws.String("bucket"),
 		Key:    aws.String("uploadId.part"),
 	}).Return(&s3.GetObjectOutput{
-		ContentLength: 3,
+		ContentLength: aws.Int64(3),
 		Body:          io.NopCloser(bytes.NewReader([]byte("123"))),
 	}, nil)
 	s3obj.EXPECT().DeleteObject(context.Background(), &s3.DeleteObjectInput{
@@ -954,7 +1442,7 @@ func TestWriteChunkPrependsIncompletePartAndWritesANewIncompletePart(t *testing.
 		Bucket:     aws.String("bucket"),
 		Key:        aws.String("uploadId"),
 		UploadId:   aws.String("multipartId"),
-		PartNumber: 1,
+		PartNumber: aws.Int32(1),
 		Body:       bytes.NewReader([]byte("1234")),
 	})).Return(&s3.UploadPartOutput{
 		ETag: aws.String("etag-1"),
@@ -963,7 +1451,7 @@ func TestWriteChunkPrependsIncompletePartAndWritesANewIncompletePart(t *testing.
 		Bucket: aws.String("bucket"),
 		Key:    aws.String("uploadId.part"),
 		Body:   bytes.NewReader([]byte("5")),
-	})).Return(nil, nil)
+	})).Return(&s3.PutObjectOutput{}, nil)
 
 	upload, err := store.GetUpload(context.Background(), "uploadId+multipartId")
 	assert.Nil(err)
@@ -996,13 +1484,13 @@ func TestWriteChunkAllowTooSmallLast(t *testing.T) {
 	}).Return(&s3.ListPartsOutput{
 		Parts: []types.Part{
 			{
-				PartNumber: 1,
-				Size:       400,
+				PartNumber: aws.Int32(1),
+				Size:       aws.Int64(400),
 				ETag:       aws.String("etag-1"),
 			},
 			{
-				PartNumber: 2,
-				Size:       90,
+				PartNumber: aws.Int32(2),
+				Size:       aws.Int64(90),
 				ETag:       aws.String("etag-2"),
 			},
 		},
@@ -1015,7 +1503,7 @@ func TestWriteChunkAllowTooSmallLast(t *testing.T) {
 		Bucket:     aws.String("bucket"),
 		Key:        aws.String("uploadId"),
 		UploadId:   aws.String("multipartId"),
-		PartNumber: 3,
+		PartNumber: aws.Int32(3),
 		Body:       bytes.NewReader([]byte("1234567890")),
 	})).Return(&s3.UploadPartOutput{
 		ETag: aws.String("etag-3"),
@@ -1041,6 +1529,11 @@ func TestTerminate(t *testing.T) {
 	store := New("bucket", s3obj)
 
 	// Order is not important in this situation.
+	s3obj.EXPECT().GetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("uploadId.info"),
+	}).Return(nil, &types.NoSuchKey{})
+
 	s3obj.EXPECT().AbortMultipartUpload(context.Background(), &s3.AbortMultipartUploadInput{
 		Bucket:   aws.String("bucket"),
 		Key:      aws.String("uploadId"),
@@ -1061,7 +1554,7 @@ func TestTerminate(t *testing.T) {
 					Key: aws.String("uploadId.info"),
 				},
 			},
-			Quiet: true,
+			Quiet: aws.Bool(true),
 		},
 	}).Return(&s3.DeleteObjectsOutput{}, nil)
 
@@ -1081,7 +1574,12 @@ func TestTerminateWithErrors(t *testing.T) {
 	store := New("bucket", s3obj)
 
 	// Order is not important in this situation.
-	// NoSuchUpload errors should be ignored
+	// NoSuchKey and NoSuchUpload errors should be ignored
+	s3obj.EXPECT().GetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("uploadId.info"),
+	}).Return(nil, &types.NoSuchKey{})
+
 	s3obj.EXPECT().AbortMultipartUpload(context.Background(), &s3.AbortMultipartUploadInput{
 		Bucket:   aws.String("bucket"),
 		Key:      aws.String("uploadId"),
@@ -1102,7 +1600,7 @@ func TestTerminateWithErrors(t *testing.T) {
 					Key: aws.String("uploadId.info"),
 				},
 			},
-			Quiet: true,
+			Quiet: aws.Bool(true),
 		},
 	}).Return(&s3.DeleteObjectsOutput{
 		Errors: []types.Error{
@@ -1142,7 +1640,7 @@ func TestConcatUploadsUsingMultipart(t *testing.T) {
 		Bucket:        aws.String("bucket"),
 		Key:           aws.String("uploadId.info"),
 		Body:          bytes.NewReader([]byte(`{"ID":"uploadId+multipartId","Size":0,"SizeIsDeferred":false,"Offset":0,"MetaData":null,"IsPartial":false,"IsFinal":true,"PartialUploads":["aaa+AAA","bbb+BBB","ccc+CCC"],"Storage":{"Bucket":"bucket","Key":"uploadId","Type":"s3store"}}`)),
-		ContentLength: 234,
+		ContentLength: aws.Int64(234),
 	})
 
 	// Calls from ConcatUploads
@@ -1151,7 +1649,7 @@ func TestConcatUploadsUsingMultipart(t *testing.T) {
 		Key:        aws.String("uploadId"),
 		UploadId:   aws.String("multipartId"),
 		CopySource: aws.String("bucket/aaa"),
-		PartNumber: 1,
+		PartNumber: aws.Int32(1),
 	}).Return(&s3.UploadPartCopyOutput{
 		CopyPartResult: &types.CopyPartResult{
 			ETag: aws.String("etag-1"),
@@ -1163,7 +1661,7 @@ func TestConcatUploadsUsingMultipart(t *testing.T) {
 		Key:        aws.String("uploadId"),
 		UploadId:   aws.String("multipartId"),
 		CopySource: aws.String("bucket/bbb"),
-		PartNumber: 2,
+		PartNumber: aws.Int32(2),
 	}).Return(&s3.UploadPartCopyOutput{
 		CopyPartResult: &types.CopyPartResult{
 			ETag: aws.String("etag-2"),
@@ -1175,7 +1673,7 @@ func TestConcatUploadsUsingMultipart(t *testing.T) {
 		Key:        aws.String("uploadId"),
 		UploadId:   aws.String("multipartId"),
 		CopySource: aws.String("bucket/ccc"),
-		PartNumber: 3,
+		PartNumber: aws.Int32(3),
 	}).Return(&s3.UploadPartCopyOutput{
 		CopyPartResult: &types.CopyPartResult{
 			ETag: aws.String("etag-3"),
@@ -1191,19 +1689,19 @@ func TestConcatUploadsUsingMultipart(t *testing.T) {
 			Parts: []types.CompletedPart{
 				{
 					ETag:       aws.String("etag-1"),
-					PartNumber: 1,
+					PartNumber: aws.Int32(1),
 				},
 				{
 					ETag:       aws.String("etag-2"),
-					PartNumber: 2,
+					PartNumber: aws.Int32(2),
 				},
 				{
 					ETag:       aws.String("etag-3"),
-					PartNumber: 3,
+					PartNumber: aws.Int32(3),
 				},
 			},
 		},
-	}).Return(nil, nil)
+	}).Return(&s3.CompleteMultipartUploadOutput{}, nil)
 
 	info := handler.FileInfo{
 		ID:      "uploadId",
@@ -1390,3 +1888,210 @@ func TestWriteChunkCleansUpTempFiles(t *testing.T) {
 	assert.Nil(err)
 	assert.Equal(len(files), 0)
 }
+
+func TestSkipMultipartForSmallUploads(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	s3obj := NewMockS3API(mockCtrl)
+	store := New("bucket", s3obj)
+	store.SkipMultipartForSmallUploads = true
+
+	gomock.InOrder(
+		s3obj.EXPECT().PutObject(context.Background(), &s3.PutObjectInput{
+			Bucket:        aws.String("bucket"),
+			Key:           aws.String("uploadId.info"),
+			Body:          bytes.NewReader([]byte(`{"ID":"uploadId+none","Size":11,"SizeIsDeferred":false,"Offset":0,"MetaData":{"foo":"hello"},"IsPartial":false,"IsFinal":false,"PartialUploads":null,"Storage":{"Bucket":"bucket","Key":"uploadId","Type":"s3store"}}`)),
+			ContentLength: aws.Int64(213),
+		}),
+		s3obj.EXPECT().PutObject(context.Background(), NewPutObjectInputMatcher(&s3.PutObjectInput{
+			Bucket:        aws.String("bucket"),
+			Key:           aws.String("uploadId"),
+			Body:          bytes.NewReader([]byte("hello world")),
+			ContentLength: aws.Int64(11),
+			Metadata:      map[string]string{"foo": "hello"},
+		})).Return(&s3.PutObjectOutput{}, nil),
+	)
+
+	upload, err := store.NewUpload(context.Background(), handler.FileInfo{
+		ID:       "uploadId",
+		Size:     11,
+		MetaData: map[string]string{"foo": "hello"},
+	})
+	assert.Nil(err)
+
+	bytesRead, err := upload.WriteChunk(context.Background(), 0, bytes.NewReader([]byte("hello world")))
+	assert.Nil(err)
+	assert.Equal(int64(11), bytesRead)
+
+	err = upload.FinishUpload(context.Background())
+	assert.Nil(err)
+}
+
+func TestSkipMultipartForSmallUploadsWriteIncompletePart(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	s3obj := NewMockS3API(mockCtrl)
+	store := New("bucket", s3obj)
+	store.SkipMultipartForSmallUploads = true
+
+	s3obj.EXPECT().GetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("uploadId.info"),
+	}).Return(&s3.GetObjectOutput{
+		Body: io.NopCloser(bytes.NewReader([]byte(`{"ID":"uploadId+none","Size":11,"Offset":0,"MetaData":{},"IsPartial":false,"IsFinal":false,"PartialUploads":null,"Storage":null}`))),
+	}, nil)
+	s3obj.EXPECT().HeadObject(context.Background(), &s3.HeadObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("uploadId"),
+	}).Return(nil, &types.NotFound{})
+	s3obj.EXPECT().HeadObject(context.Background(), &s3.HeadObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("uploadId.part"),
+	}).Return(&s3.HeadObjectOutput{
+		ContentLength: aws.Int64(6),
+	}, nil)
+	s3obj.EXPECT().GetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("uploadId.part"),
+	}).Return(&s3.GetObjectOutput{
+		ContentLength: aws.Int64(6),
+		Body:          io.NopCloser(bytes.NewReader([]byte("hello "))),
+	}, nil)
+	s3obj.EXPECT().PutObject(context.Background(), NewPutObjectInputMatcher(&s3.PutObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("uploadId.part"),
+		Body:   bytes.NewReader([]byte("hello wo")),
+	})).Return(&s3.PutObjectOutput{}, nil)
+
+	upload, err := store.GetUpload(context.Background(), "uploadId+none")
+	assert.Nil(err)
+
+	bytesRead, err := upload.WriteChunk(context.Background(), 6, bytes.NewReader([]byte("wo")))
+	assert.Nil(err)
+	assert.Equal(int64(2), bytesRead)
+
+	info, err := upload.GetInfo(context.Background())
+	assert.Nil(err)
+	assert.Equal(int64(8), info.Offset)
+}
+
+func TestSkipMultipartForSmallUploadsGetInfoFinished(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	s3obj := NewMockS3API(mockCtrl)
+	store := New("bucket", s3obj)
+
+	s3obj.EXPECT().GetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("uploadId.info"),
+	}).Return(&s3.GetObjectOutput{
+		Body: io.NopCloser(bytes.NewReader([]byte(`{"ID":"uploadId+none","Size":11,"Offset":0,"MetaData":{},"IsPartial":false,"IsFinal":false,"PartialUploads":null,"Storage":null}`))),
+	}, nil)
+	s3obj.EXPECT().HeadObject(context.Background(), &s3.HeadObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("uploadId"),
+	}).Return(&s3.HeadObjectOutput{
+		ContentLength: aws.Int64(11),
+	}, nil)
+	s3obj.EXPECT().HeadObject(context.Background(), &s3.HeadObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("uploadId.part"),
+	}).Return(nil, &types.NotFound{})
+
+	upload, err := store.GetUpload(context.Background(), "uploadId+none")
+	assert.Nil(err)
+
+	info, err := upload.GetInfo(context.Background())
+	assert.Nil(err)
+	assert.Equal(int64(11), info.Offset)
+}
+
+func TestListUploads(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	s3obj := NewMockS3API(mockCtrl)
+	store := New("bucket", s3obj)
+	store.ObjectPrefix = "my/uploaded/files"
+
+	gomock.InOrder(
+		s3obj.EXPECT().ListMultipartUploads(context.Background(), &s3.ListMultipartUploadsInput{
+			Bucket: aws.String("bucket"),
+			Prefix: aws.String("my/uploaded/files/"),
+		}).Return(&s3.ListMultipartUploadsOutput{
+			Uploads: []types.MultipartUpload{
+				{Key: aws.String("my/uploaded/files/uploadA"), UploadId: aws.String("multipartA")},
+				{Key: aws.String("my/uploaded/files/uploadB"), UploadId: aws.String("multipartB")},
+			},
+			IsTruncated: aws.Bool(true),
+		}, nil),
+		s3obj.EXPECT().ListMultipartUploads(context.Background(), &s3.ListMultipartUploadsInput{
+			Bucket:         aws.String("bucket"),
+			Prefix:         aws.String("my/uploaded/files/"),
+			KeyMarker:      aws.String("my/uploaded/files/uploadB"),
+			UploadIdMarker: aws.String("multipartB"),
+		}).Return(&s3.ListMultipartUploadsOutput{
+			Uploads: []types.MultipartUpload{
+				{Key: aws.String("my/uploaded/files/uploadC"), UploadId: aws.String("multipartC")},
+			},
+			IsTruncated: aws.Bool(false),
+		}, nil),
+	)
+
+	ids, nextCursor, err := store.ListUploads(context.Background(), "")
+	assert.Nil(err)
+	assert.Equal([]string{"uploadA+multipartA", "uploadB+multipartB"}, ids)
+	assert.Equal("uploadB+multipartB", nextCursor)
+
+	ids, nextCursor, err = store.ListUploads(context.Background(), nextCursor)
+	assert.Nil(err)
+	assert.Equal([]string{"uploadC+multipartC"}, ids)
+	assert.Equal("", nextCursor)
+}
+
+func TestListUploadsDirectoryBucket(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	s3obj := NewMockS3API(mockCtrl)
+	store := New("bucket--usw2-az1--x-s3", s3obj)
+
+	gomock.InOrder(
+		s3obj.EXPECT().ListMultipartUploads(context.Background(), &s3.ListMultipartUploadsInput{
+			Bucket: aws.String("bucket--usw2-az1--x-s3"),
+		}).Return(&s3.ListMultipartUploadsOutput{
+			Uploads: []types.MultipartUpload{
+				{Key: aws.String("uploadA"), UploadId: aws.String("multipartA")},
+			},
+			IsTruncated:   aws.Bool(true),
+			NextKeyMarker: aws.String("opaque-marker"),
+		}, nil),
+		s3obj.EXPECT().ListMultipartUploads(context.Background(), &s3.ListMultipartUploadsInput{
+			Bucket:    aws.String("bucket--usw2-az1--x-s3"),
+			KeyMarker: aws.String("opaque-marker"),
+		}).Return(&s3.ListMultipartUploadsOutput{
+			Uploads: []types.MultipartUpload{
+				{Key: aws.String("uploadB"), UploadId: aws.String("multipartB")},
+			},
+			IsTruncated: aws.Bool(false),
+		}, nil),
+	)
+
+	ids, nextCursor, err := store.ListUploads(context.Background(), "")
+	assert.Nil(err)
+	assert.Equal([]string{"uploadA+multipartA"}, ids)
+	assert.Equal("opaque-marker", nextCursor)
+
+	ids, nextCursor, err = store.ListUploads(context.Background(), nextCursor)
+	assert.Nil(err)
+	assert.Equal([]string{"uploadB+multipartB"}, ids)
+	assert.Equal("", nextCursor)
+}
@@ -0,0 +1,107 @@
+package s3store
+
+import (
+	"container/heap"
+	"sync"
+)
+
+// uploadLimiter limits the number of concurrent part uploads. If the limit is
+// reached, waiting part uploads are admitted in the order of their upload's
+// priority (see handler.UploadPriority) and, for equal priorities, in the order
+// in which they started waiting. Since the part uploads share the bandwidth to
+// S3, this allocates more of it to uploads with a higher priority.
+type uploadLimiter struct {
+	lock     sync.Mutex
+	limit    int
+	inFlight int
+	waiters  uploadWaiters
+	// sequence numbers the waiters in the order of their arrival.
+	sequence uint64
+}
+
+func newUploadLimiter(limit int) *uploadLimiter {
+	return &uploadLimiter{
+		limit: limit,
+	}
+}
+
+// Acquire blocks until the part upload may start.
+func (l *uploadLimiter) Acquire(priority int) {
+	l.lock.Lock()
+	if l.inFlight < l.limit && len(l.waiters) == 0 {
+		l.inFlight++
+		l.lock.Unlock()
+		return
+	}
+
+	waiter := &uploadWaiter{
+		priority: priority,
+		sequence: l.sequence,
+		ready:    make(chan struct{}),
+	}
+	l.sequence++
+	heap.Push(&l.waiters, waiter)
+	l.lock.Unlock()
+
+	<-waiter.ready
+}
+
+// Release frees the slot acquired using Acquire.
+func (l *uploadLimiter) Release() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.inFlight--
+	l.admit()
+}
+
+// setLimit changes the limit. Part uploads, which are already in flight, are
+// not affected if the limit is lowered.
+func (l *uploadLimiter) setLimit(limit int) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.limit = limit
+	l.admit()
+}
+
+// admit wakes up the waiters, for which slots are free. The lock must be held.
+func (l *uploadLimiter) admit() {
+	for l.inFlight < l.limit && len(l.waiters) > 0 {
+		waiter := heap.Pop(&l.waiters).(*uploadWaiter)
+		l.inFlight++
+		close(waiter.ready)
+	}
+}
+
+type uploadWaiter struct {
+	priority int
+	sequence uint64
+	ready    chan struct{}
+}
+
+// uploadWaiters implements heap.Interface, so that the waiter with the highest
+// priority, which has been waiting the longest, is at the top.
+type uploadWaiters []*uploadWaiter
+
+func (w uploadWaiters) Len() int { return len(w) }
+
+func (w uploadWaiters) Less(i, j int) bool {
+	if w[i].priority != w[j].priority {
+		return w[i].priority > w[j].priority
+	}
+	return w[i].sequence < w[j].sequence
+}
+
+func (w uploadWaiters) Swap(i, j int) { w[i], w[j] = w[j], w[i] }
+
+func (w *uploadWaiters) Push(x any) { *w = append(*w, x.(*uploadWaiter)) }
+
+func (w *uploadWaiters) Pop() any {
+	old := *w
+	n := len(old)
+	waiter := old[n-1]
+	old[n-1] = nil
+	*w = old[:n-1]
+	return waiter
+}
@@ -0,0 +1,95 @@
+package s3store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// waitForWaiters blocks until n goroutines are waiting in Acquire.
+func waitForWaiters(l *uploadLimiter, n int) {
+	for {
+		l.lock.Lock()
+		waiting := len(l.waiters)
+		l.lock.Unlock()
+		if waiting >= n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestUploadLimiterPriority(t *testing.T) {
+	assert := assert.New(t)
+
+	l := newUploadLimiter(1)
+	l.Acquire(0)
+
+	// Waiters are admitted by priority and, for equal priorities, in the
+	// order of their arrival.
+	order := make(chan string, 4)
+	for i, waiter := range []struct {
+		name     string
+		priority int
+	}{
+		{"low-1", -1},
+		{"normal-1", 0},
+		{"low-2", -1},
+		{"normal-2", 0},
+	} {
+		go func(name string, priority int) {
+			l.Acquire(priority)
+			order <- name
+			l.Release()
+		}(waiter.name, waiter.priority)
+		waitForWaiters(l, i+1)
+	}
+
+	l.Release()
+
+	for _, name := range []string{"normal-1", "normal-2", "low-1", "low-2"} {
+		assert.Equal(name, <-order)
+	}
+}
+
+func TestUploadLimiterSetLimit(t *testing.T) {
+	assert := assert.New(t)
+
+	l := newUploadLimiter(1)
+	l.Acquire(0)
+
+	acquired := make(chan struct{})
+	go func() {
+		l.Acquire(0)
+		close(acquired)
+	}()
+	waitForWaiters(l, 1)
+
+	// Raising the limit wakes up the waiting goroutine.
+	l.setLimit(2)
+	<-acquired
+	assert.Equal(2, l.inFlight)
+
+	// Lowering the limit does not affect part uploads in flight, but new
+	// ones have to wait until enough slots are released.
+	l.setLimit(1)
+	reacquired := make(chan struct{})
+	go func() {
+		l.Acquire(0)
+		close(reacquired)
+	}()
+	waitForWaiters(l, 1)
+
+	l.Release()
+	select {
+	case <-reacquired:
+		t.Fatal("slot must not be acquired while the limit is reached")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	l.Release()
+	<-reacquired
+	l.Release()
+	assert.Equal(0, l.inFlight)
+}
@@ -0,0 +1,165 @@
+package sqlindex
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/tus/tusd/v2/pkg/handler"
+)
+
+// maxUpdateAttempts limits how often UpdateInfo retries if concurrent updates
+// of the same info keep interfering.
+const maxUpdateAttempts = 10
+
+var metadataSchema = []string{
+	`CREATE TABLE IF NOT EXISTS tusd_upload_info (
+		id TEXT PRIMARY KEY,
+		info TEXT NOT NULL,
+		version BIGINT NOT NULL
+	)`,
+}
+
+// ErrUpdateConflict is returned by UpdateInfo if the info was changed
+// concurrently in every attempt.
+var ErrUpdateConflict = errors.New("sqlindex: too many concurrent updates of upload info")
+
+// SQLMetadataStore is a handler.MetadataStore which keeps the JSON encoded info
+// of uploads in an SQL database. Updates use optimistic locking with a version
+// column, so concurrent updates from multiple tusd instances do not overwrite
+// each other.
+type SQLMetadataStore struct {
+	db      *sql.DB
+	dialect Dialect
+}
+
+// NewMetadataStore creates a new metadata store using the given database.
+// CreateTables must have been called once before the store is used.
+func NewMetadataStore(db *sql.DB, dialect Dialect) *SQLMetadataStore {
+	return &SQLMetadataStore{
+		db:      db,
+		dialect: dialect,
+	}
+}
+
+// CreateTables creates the tables used by the store, unless they exist already.
+func (store *SQLMetadataStore) CreateTables(ctx context.Context) error {
+	for _, statement := range metadataSchema {
+		if _, err := store.db.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("sqlindex: failed to create tables: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (store *SQLMetadataStore) GetInfo(ctx context.Context, key string) (handler.FileInfo, error) {
+	info, _, err := store.get(ctx, key)
+	return info, err
+}
+
+func (store *SQLMetadataStore) PutInfo(ctx context.Context, key string, info handler.FileInfo) error {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+
+	q := store.putQuery(key, string(data))
+	_, err = store.db.ExecContext(ctx, q.String(), q.args...)
+	return err
+}
+
+func (store *SQLMetadataStore) UpdateInfo(ctx context.Context, key string, update func(info *handler.FileInfo) error) (handler.FileInfo, error) {
+	for attempt := 0; attempt < maxUpdateAttempts; attempt++ {
+		info, version, err := store.get(ctx, key)
+		if err != nil {
+			return handler.FileInfo{}, err
+		}
+
+		if err := update(&info); err != nil {
+			return handler.FileInfo{}, err
+		}
+
+		data, err := json.Marshal(info)
+		if err != nil {
+			return handler.FileInfo{}, err
+		}
+
+		q := store.updateQuery(key, string(data), version)
+		res, err := store.db.ExecContext(ctx, q.String(), q.args...)
+		if err != nil {
+			return handler.FileInfo{}, err
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return handler.FileInfo{}, err
+		}
+		if n > 0 {
+			return info, nil
+		}
+
+		// Another update changed or deleted the info since it was read, so
+		// start over with the latest info.
+	}
+
+	return handler.FileInfo{}, ErrUpdateConflict
+}
+
+func (store *SQLMetadataStore) DeleteInfo(ctx context.Context, key string) error {
+	q := store.newQuery()
+	q.write("DELETE FROM tusd_upload_info WHERE id = ")
+	q.arg(key)
+
+	_, err := store.db.ExecContext(ctx, q.String(), q.args...)
+	return err
+}
+
+// get returns the info stored under key together with its version.
+func (store *SQLMetadataStore) get(ctx context.Context, key string) (info handler.FileInfo, version int64, err error) {
+	q := store.newQuery()
+	q.write("SELECT info, version FROM tusd_upload_info WHERE id = ")
+	q.arg(key)
+
+	var data string
+	if err := store.db.QueryRowContext(ctx, q.String(), q.args...).Scan(&data, &version); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return info, 0, handler.ErrNotFound
+		}
+		return info, 0, err
+	}
+
+	err = json.Unmarshal([]byte(data), &info)
+	return info, version, err
+}
+
+// putQuery builds the statement inserting or replacing the info stored under
+// key. Both SQLite and PostgreSQL support ON CONFLICT.
+func (store *SQLMetadataStore) putQuery(key string, data string) *statement {
+	q := store.newQuery()
+	q.write("INSERT INTO tusd_upload_info (id, info, version) VALUES (")
+	q.arg(key)
+	q.write(", ")
+	q.arg(data)
+	q.write(", 1) ON CONFLICT (id) DO UPDATE SET info = excluded.info, version = tusd_upload_info.version + 1")
+	return q
+}
+
+// updateQuery builds the statement replacing the info stored under key, if it
+// still has the given version.
+func (store *SQLMetadataStore) updateQuery(key string, data string, version int64) *statement {
+	q := store.newQuery()
+	q.write("UPDATE tusd_upload_info SET info = ")
+	q.arg(data)
+	q.write(", version = version + 1 WHERE id = ")
+	q.arg(key)
+	q.write(" AND version = ")
+	q.arg(version)
+	return q
+}
+
+func (store *SQLMetadataStore) newQuery() *statement {
+	return &statement{dialect: store.dialect}
+}
@@ -0,0 +1,404 @@
+// Package sqlindex provides an UploadIndex which keeps its entries in an SQL
+// database, so that they are shared by multiple tusd instances and survive
+// restarts.
+//
+// The package uses database/sql and does not import a driver itself. Callers
+// register the driver of their choice and pass the opened database together
+// with its dialect:
+//
+//	import _ "github.com/jackc/pgx/v5/stdlib"
+//
+//	db, err := sql.Open("pgx", "postgres://tusd@localhost/tusd")
+//	if err != nil {
+//		return err
+//	}
+//	index := sqlindex.New(db, sqlindex.Postgres)
+//	if err := index.CreateTables(ctx); err != nil {
+//		return err
+//	}
+//	config.UploadIndex = index
+//
+// In addition, SQLMetadataStore keeps the info of uploads for data stores
+// supporting a handler.MetadataStore, such as s3store.S3Store.
+//
+// SQLite and PostgreSQL are supported. The tables are prefixed with tusd_.
+package sqlindex
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tus/tusd/v2/pkg/handler"
+)
+
+// Dialect is the SQL dialect spoken by the database.
+type Dialect string
+
+const (
+	SQLite   Dialect = "sqlite"
+	Postgres Dialect = "postgres"
+)
+
+// defaultQueryLimit is used for queries without a limit. It matches the
+// default of the in-memory index.
+const defaultQueryLimit = 100
+
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS tusd_uploads (
+		id TEXT PRIMARY KEY,
+		size BIGINT NOT NULL,
+		upload_offset BIGINT NOT NULL,
+		state TEXT NOT NULL,
+		created_at BIGINT NOT NULL,
+		updated_at BIGINT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS tusd_uploads_created_at ON tusd_uploads (created_at, id)`,
+	`CREATE TABLE IF NOT EXISTS tusd_upload_metadata (
+		upload_id TEXT NOT NULL REFERENCES tusd_uploads (id) ON DELETE CASCADE,
+		key TEXT NOT NULL,
+		value TEXT NOT NULL,
+		PRIMARY KEY (upload_id, key)
+	)`,
+	`CREATE TABLE IF NOT EXISTS tusd_upload_tags (
+		upload_id TEXT NOT NULL REFERENCES tusd_uploads (id) ON DELETE CASCADE,
+		tag TEXT NOT NULL,
+		PRIMARY KEY (upload_id, tag)
+	)`,
+	`CREATE INDEX IF NOT EXISTS tusd_upload_tags_tag ON tusd_upload_tags (tag)`,
+}
+
+// SQLIndex is an UploadIndex which keeps its entries in an SQL database.
+// Timestamps are stored with millisecond precision.
+type SQLIndex struct {
+	db      *sql.DB
+	dialect Dialect
+}
+
+// New creates a new index using the given database. CreateTables must have been
+// called once before the index is used.
+func New(db *sql.DB, dialect Dialect) *SQLIndex {
+	return &SQLIndex{
+		db:      db,
+		dialect: dialect,
+	}
+}
+
+// CreateTables creates the tables used by the index, unless they exist already.
+func (index *SQLIndex) CreateTables(ctx context.Context) error {
+	for _, statement := range schema {
+		if _, err := index.db.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("sqlindex: failed to create tables: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (index *SQLIndex) AddUpload(ctx context.Context, entry handler.IndexEntry) error {
+	return index.inTransaction(ctx, func(tx *sql.Tx) error {
+		q := index.newQuery()
+		q.write("INSERT INTO tusd_uploads (id, size, upload_offset, state, created_at, updated_at) VALUES (")
+		q.arg(entry.ID)
+		q.write(", ")
+		q.arg(entry.Size)
+		q.write(", ")
+		q.arg(entry.Offset)
+		q.write(", ")
+		q.arg(string(entry.State))
+		q.write(", ")
+		q.arg(entry.CreatedAt.UnixMilli())
+		q.write(", ")
+		q.arg(entry.UpdatedAt.UnixMilli())
+		q.write(")")
+		if _, err := tx.ExecContext(ctx, q.String(), q.args...); err != nil {
+			return err
+		}
+
+		for key, value := range entry.MetaData {
+			q := index.newQuery()
+			q.write("INSERT INTO tusd_upload_metadata (upload_id, key, value) VALUES (")
+			q.arg(entry.ID)
+			q.write(", ")
+			q.arg(key)
+			q.write(", ")
+			q.arg(value)
+			q.write(")")
+			if _, err := tx.ExecContext(ctx, q.String(), q.args...); err != nil {
+				return err
+			}
+		}
+
+		return index.insertTags(ctx, tx, entry.ID, entry.Tags)
+	})
+}
+
+func (index *SQLIndex) UpdateUpload(ctx context.Context, id string, offset int64, state handler.UploadState, at time.Time) error {
+	q := index.newQuery()
+	q.write("UPDATE tusd_uploads SET upload_offset = ")
+	q.arg(offset)
+	q.write(", state = ")
+	q.arg(string(state))
+	q.write(", updated_at = ")
+	q.arg(at.UnixMilli())
+	q.write(" WHERE id = ")
+	q.arg(id)
+
+	res, err := index.db.ExecContext(ctx, q.String(), q.args...)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return handler.ErrNotFound
+	}
+
+	return nil
+}
+
+func (index *SQLIndex) SetUploadTags(ctx context.Context, id string, tags []string) error {
+	return index.inTransaction(ctx, func(tx *sql.Tx) error {
+		q := index.newQuery()
+		q.write("SELECT 1 FROM tusd_uploads WHERE id = ")
+		q.arg(id)
+		var exists int
+		if err := tx.QueryRowContext(ctx, q.String(), q.args...).Scan(&exists); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return handler.ErrNotFound
+			}
+			return err
+		}
+
+		q = index.newQuery()
+		q.write("DELETE FROM tusd_upload_tags WHERE upload_id = ")
+		q.arg(id)
+		if _, err := tx.ExecContext(ctx, q.String(), q.args...); err != nil {
+			return err
+		}
+
+		return index.insertTags(ctx, tx, id, tags)
+	})
+}
+
+func (index *SQLIndex) SearchUploads(ctx context.Context, query handler.IndexQuery) ([]handler.IndexEntry, string, error) {
+	q, limit, err := index.searchQuery(query)
+	if err != nil {
+		return nil, "", err
+	}
+
+	rows, err := index.db.QueryContext(ctx, q.String(), q.args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	entries := []handler.IndexEntry{}
+	for rows.Next() {
+		var entry handler.IndexEntry
+		var state string
+		var createdAt, updatedAt int64
+		if err := rows.Scan(&entry.ID, &entry.Size, &entry.Offset, &state, &createdAt, &updatedAt); err != nil {
+			return nil, "", err
+		}
+		entry.State = handler.UploadState(state)
+		entry.CreatedAt = time.UnixMilli(createdAt).UTC()
+		entry.UpdatedAt = time.UnixMilli(updatedAt).UTC()
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	// One more entry than requested is fetched to determine whether another
+	// page exists.
+	nextCursor := ""
+	if len(entries) > limit {
+		entries = entries[:limit]
+		last := entries[limit-1]
+		nextCursor = strconv.FormatInt(last.CreatedAt.UnixMilli(), 10) + "," + last.ID
+	}
+
+	for i := range entries {
+		if err := index.loadDetails(ctx, &entries[i]); err != nil {
+			return nil, "", err
+		}
+	}
+
+	return entries, nextCursor, nil
+}
+
+// searchQuery builds the statement selecting the uploads matching query. The
+// cursor is the creation time and ID of the last entry on the previous page.
+func (index *SQLIndex) searchQuery(query handler.IndexQuery) (*statement, int, error) {
+	limit := query.Limit
+	if limit <= 0 {
+		limit = defaultQueryLimit
+	}
+
+	q := index.newQuery()
+	q.write("SELECT id, size, upload_offset, state, created_at, updated_at FROM tusd_uploads WHERE 1 = 1")
+
+	for _, tag := range query.Tags {
+		q.write(" AND EXISTS (SELECT 1 FROM tusd_upload_tags t WHERE t.upload_id = tusd_uploads.id AND t.tag = ")
+		q.arg(tag)
+		q.write(")")
+	}
+
+	for key, value := range query.MetaData {
+		q.write(" AND EXISTS (SELECT 1 FROM tusd_upload_metadata m WHERE m.upload_id = tusd_uploads.id AND m.key = ")
+		q.arg(key)
+		q.write(" AND m.value = ")
+		q.arg(value)
+		q.write(")")
+	}
+
+	if query.State != "" {
+		q.write(" AND state = ")
+		q.arg(string(query.State))
+	}
+
+	if !query.CreatedAfter.IsZero() {
+		q.write(" AND created_at >= ")
+		q.arg(query.CreatedAfter.UnixMilli())
+	}
+
+	if !query.CreatedBefore.IsZero() {
+		q.write(" AND created_at < ")
+		q.arg(query.CreatedBefore.UnixMilli())
+	}
+
+	if !query.UpdatedBefore.IsZero() {
+		q.write(" AND updated_at < ")
+		q.arg(query.UpdatedBefore.UnixMilli())
+	}
+
+	if query.Cursor != "" {
+		createdAt, id, ok := strings.Cut(query.Cursor, ",")
+		ms, err := strconv.ParseInt(createdAt, 10, 64)
+		if !ok || err != nil {
+			return nil, 0, handler.ErrInvalidIndexCursor
+		}
+
+		q.write(" AND (created_at < ")
+		q.arg(ms)
+		q.write(" OR (created_at = ")
+		q.arg(ms)
+		q.write(" AND id > ")
+		q.arg(id)
+		q.write("))")
+	}
+
+	q.write(" ORDER BY created_at DESC, id ASC LIMIT ")
+	q.arg(limit + 1)
+
+	return q, limit, nil
+}
+
+// loadDetails fills the metadata and tags of entry.
+func (index *SQLIndex) loadDetails(ctx context.Context, entry *handler.IndexEntry) error {
+	q := index.newQuery()
+	q.write("SELECT key, value FROM tusd_upload_metadata WHERE upload_id = ")
+	q.arg(entry.ID)
+	rows, err := index.db.QueryContext(ctx, q.String(), q.args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	entry.MetaData = make(handler.MetaData)
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return err
+		}
+		entry.MetaData[key] = value
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	q = index.newQuery()
+	q.write("SELECT tag FROM tusd_upload_tags WHERE upload_id = ")
+	q.arg(entry.ID)
+	q.write(" ORDER BY tag")
+	tagRows, err := index.db.QueryContext(ctx, q.String(), q.args...)
+	if err != nil {
+		return err
+	}
+	defer tagRows.Close()
+
+	for tagRows.Next() {
+		var tag string
+		if err := tagRows.Scan(&tag); err != nil {
+			return err
+		}
+		entry.Tags = append(entry.Tags, tag)
+	}
+
+	return tagRows.Err()
+}
+
+func (index *SQLIndex) insertTags(ctx context.Context, tx *sql.Tx, id string, tags []string) error {
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		if seen[tag] {
+			continue
+		}
+		seen[tag] = true
+
+		q := index.newQuery()
+		q.write("INSERT INTO tusd_upload_tags (upload_id, tag) VALUES (")
+		q.arg(id)
+		q.write(", ")
+		q.arg(tag)
+		q.write(")")
+		if _, err := tx.ExecContext(ctx, q.String(), q.args...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (index *SQLIndex) inTransaction(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := index.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// statement builds an SQL statement and collects its arguments, using the
+// placeholders of the dialect.
+type statement struct {
+	strings.Builder
+	dialect Dialect
+	args    []interface{}
+}
+
+func (index *SQLIndex) newQuery() *statement {
+	return &statement{dialect: index.dialect}
+}
+
+func (s *statement) write(sql string) {
+	s.WriteString(sql)
+}
+
+func (s *statement) arg(value interface{}) {
+	s.args = append(s.args, value)
+	if s.dialect == Postgres {
+		s.WriteString("$" + strconv.Itoa(len(s.args)))
+	} else {
+		s.WriteString("?")
+	}
+}
@@ -0,0 +1,59 @@
+package sqlindex
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tus/tusd/v2/pkg/handler"
+)
+
+func TestSearchQuery(t *testing.T) {
+	a := assert.New(t)
+
+	created := time.UnixMilli(1700000000000)
+	query := handler.IndexQuery{
+		Tags:          []string{"user:alice"},
+		State:         handler.UploadStateInProgress,
+		CreatedAfter:  created,
+		UpdatedBefore: created.Add(time.Hour),
+		Limit:         10,
+		Cursor:        "1700000005000,foo",
+	}
+
+	q, limit, err := New(nil, Postgres).searchQuery(query)
+	a.NoError(err)
+	a.Equal(10, limit)
+	a.Equal("SELECT id, size, upload_offset, state, created_at, updated_at FROM tusd_uploads WHERE 1 = 1"+
+		" AND EXISTS (SELECT 1 FROM tusd_upload_tags t WHERE t.upload_id = tusd_uploads.id AND t.tag = $1)"+
+		" AND state = $2 AND created_at >= $3 AND updated_at < $4"+
+		" AND (created_at < $5 OR (created_at = $6 AND id > $7))"+
+		" ORDER BY created_at DESC, id ASC LIMIT $8", q.String())
+	a.Equal([]interface{}{"user:alice", "in-progress", int64(1700000000000), int64(1700003600000), int64(1700000005000), int64(1700000005000), "foo", 11}, q.args)
+
+	q, limit, err = New(nil, SQLite).searchQuery(handler.IndexQuery{
+		MetaData: handler.MetaData{"filename": "a.txt"},
+	})
+	a.NoError(err)
+	a.Equal(100, limit)
+	a.Equal("SELECT id, size, upload_offset, state, created_at, updated_at FROM tusd_uploads WHERE 1 = 1"+
+		" AND EXISTS (SELECT 1 FROM tusd_upload_metadata m WHERE m.upload_id = tusd_uploads.id AND m.key = ? AND m.value = ?)"+
+		" ORDER BY created_at DESC, id ASC LIMIT ?", q.String())
+	a.Equal([]interface{}{"filename", "a.txt", 101}, q.args)
+
+	_, _, err = New(nil, SQLite).searchQuery(handler.IndexQuery{Cursor: "foo"})
+	a.ErrorIs(err, handler.ErrInvalidIndexCursor)
+}
+
+func TestMetadataStoreQueries(t *testing.T) {
+	a := assert.New(t)
+
+	q := NewMetadataStore(nil, Postgres).updateQuery("foo", "{}", 3)
+	a.Equal("UPDATE tusd_upload_info SET info = $1, version = version + 1 WHERE id = $2 AND version = $3", q.String())
+	a.Equal([]interface{}{"{}", "foo", int64(3)}, q.args)
+
+	q = NewMetadataStore(nil, SQLite).putQuery("foo", "{}")
+	a.Equal("INSERT INTO tusd_upload_info (id, info, version) VALUES (?, ?, 1)"+
+		" ON CONFLICT (id) DO UPDATE SET info = excluded.info, version = tusd_upload_info.version + 1", q.String())
+	a.Equal([]interface{}{"foo", "{}"}, q.args)
+}
@@ -0,0 +1,452 @@
+// Package storetest provides a conformance suite for data stores.
+//
+// The suite checks that a store implements the semantics, which the handler
+// relies on, for example that the offset of an upload matches the data which
+// has been written to it, even if multiple PATCH requests arrive at the same
+// time. Data stores can run it from their tests to prove compatibility with the
+// handler:
+//
+//	func TestConformance(t *testing.T) {
+//		composer := handler.NewStoreComposer()
+//		filestore.New(t.TempDir()).UseIn(composer)
+//
+//		storetest.Run(t, composer, storetest.Options{})
+//	}
+//
+// Only the extensions, which are registered in the composer, are tested. For
+// stores backed by a remote service, the suite is best run against a local
+// emulator, such as MinIO or localstack for S3.
+package storetest
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tus/tusd/v2/pkg/handler"
+	"github.com/tus/tusd/v2/pkg/memorylocker"
+)
+
+// Options configures the conformance suite.
+type Options struct {
+	// LargeUploadSize is the size of an additional upload, which is written in
+	// multiple chunks of LargeChunkSize, for example to exercise multipart
+	// uploads. The test is skipped if it is zero or if tests are run with -short.
+	LargeUploadSize int64
+	// LargeChunkSize is the size of the chunks in which the large upload is
+	// written. Defaults to 8MiB.
+	LargeChunkSize int64
+	// ConcurrentRequests is the number of PATCH requests, which are sent for
+	// the same upload at the same time. Defaults to 4.
+	ConcurrentRequests int
+}
+
+// Run executes the conformance suite against the data store registered in
+// composer as subtests of t. The composer is not modified.
+func Run(t *testing.T, composer *handler.StoreComposer, options Options) {
+	if options.LargeChunkSize <= 0 {
+		options.LargeChunkSize = 8 * 1024 * 1024
+	}
+	if options.ConcurrentRequests <= 0 {
+		options.ConcurrentRequests = 4
+	}
+
+	t.Run("Offset", func(t *testing.T) {
+		testOffset(t, composer)
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		testNotFound(t, composer)
+	})
+
+	t.Run("Termination", func(t *testing.T) {
+		if !composer.UsesTerminater {
+			t.Skip("store does not support termination")
+		}
+		testTermination(t, composer)
+	})
+
+	t.Run("LengthDeferral", func(t *testing.T) {
+		if !composer.UsesLengthDeferrer {
+			t.Skip("store does not support deferring the upload length")
+		}
+		testLengthDeferral(t, composer)
+	})
+
+	t.Run("Concatenation", func(t *testing.T) {
+		if !composer.UsesConcater {
+			t.Skip("store does not support concatenation")
+		}
+		testConcatenation(t, composer)
+	})
+
+	t.Run("ConcurrentPatch", func(t *testing.T) {
+		testConcurrentPatch(t, composer, options.ConcurrentRequests)
+	})
+
+	t.Run("LargeUpload", func(t *testing.T) {
+		if options.LargeUploadSize <= 0 {
+			t.Skip("LargeUploadSize is not set")
+		}
+		if testing.Short() {
+			t.Skip("skipping large upload in short mode")
+		}
+		testLargeUpload(t, composer, options.LargeUploadSize, options.LargeChunkSize)
+	})
+}
+
+// testOffset checks that the offset grows with every written chunk and that
+// the information is persisted, so that it is also available when the upload
+// is fetched again.
+func testOffset(t *testing.T, composer *handler.StoreComposer) {
+	a := assert.New(t)
+	ctx := context.Background()
+	store := composer.Core
+
+	upload, err := store.NewUpload(ctx, handler.FileInfo{
+		Size:     11,
+		MetaData: handler.MetaData{"filename": "hello.txt"},
+	})
+	if !a.NoError(err) {
+		return
+	}
+
+	info, err := upload.GetInfo(ctx)
+	a.NoError(err)
+	a.NotEmpty(info.ID)
+	a.EqualValues(11, info.Size)
+	a.EqualValues(0, info.Offset)
+	a.Equal("hello.txt", info.MetaData["filename"])
+
+	n, err := upload.WriteChunk(ctx, 0, bytes.NewReader([]byte("hello ")))
+	a.NoError(err)
+	a.EqualValues(6, n)
+
+	// Chunks are written to a freshly fetched upload, as the handler does for
+	// every request.
+	upload, err = store.GetUpload(ctx, info.ID)
+	if !a.NoError(err) {
+		return
+	}
+
+	info, err = upload.GetInfo(ctx)
+	a.NoError(err)
+	a.EqualValues(6, info.Offset)
+
+	n, err = upload.WriteChunk(ctx, 6, bytes.NewReader([]byte("world")))
+	a.NoError(err)
+	a.EqualValues(5, n)
+
+	a.NoError(upload.FinishUpload(ctx))
+
+	upload, err = store.GetUpload(ctx, info.ID)
+	if !a.NoError(err) {
+		return
+	}
+
+	info, err = upload.GetInfo(ctx)
+	a.NoError(err)
+	a.EqualValues(11, info.Size)
+	a.EqualValues(11, info.Offset)
+	a.Equal("hello.txt", info.MetaData["filename"])
+	a.Equal("hello world", readContent(t, upload))
+}
+
+// testNotFound checks that missing uploads are reported using ErrNotFound, so
+// that the handler responds with 404 Not Found.
+func testNotFound(t *testing.T, composer *handler.StoreComposer) {
+	_, err := composer.Core.GetUpload(context.Background(), "storetest-missing-upload")
+	assert.ErrorIs(t, err, handler.ErrNotFound)
+}
+
+// testTermination checks that terminated uploads can no longer be found.
+func testTermination(t *testing.T, composer *handler.StoreComposer) {
+	a := assert.New(t)
+	ctx := context.Background()
+
+	upload, err := composer.Core.NewUpload(ctx, handler.FileInfo{Size: 5})
+	if !a.NoError(err) {
+		return
+	}
+
+	_, err = upload.WriteChunk(ctx, 0, bytes.NewReader([]byte("hel")))
+	a.NoError(err)
+
+	info, err := upload.GetInfo(ctx)
+	a.NoError(err)
+
+	a.NoError(composer.Terminater.AsTerminatableUpload(upload).Terminate(ctx))
+
+	_, err = composer.Core.GetUpload(ctx, info.ID)
+	a.ErrorIs(err, handler.ErrNotFound)
+}
+
+// testLengthDeferral checks that data can be written before the upload's
+// length is declared.
+func testLengthDeferral(t *testing.T, composer *handler.StoreComposer) {
+	a := assert.New(t)
+	ctx := context.Background()
+
+	upload, err := composer.Core.NewUpload(ctx, handler.FileInfo{SizeIsDeferred: true})
+	if !a.NoError(err) {
+		return
+	}
+
+	info, err := upload.GetInfo(ctx)
+	a.NoError(err)
+	a.True(info.SizeIsDeferred)
+
+	_, err = upload.WriteChunk(ctx, 0, bytes.NewReader([]byte("hello ")))
+	a.NoError(err)
+
+	a.NoError(composer.LengthDeferrer.AsLengthDeclarableUpload(upload).DeclareLength(ctx, 11))
+
+	upload, err = composer.Core.GetUpload(ctx, info.ID)
+	if !a.NoError(err) {
+		return
+	}
+
+	info, err = upload.GetInfo(ctx)
+	a.NoError(err)
+	a.False(info.SizeIsDeferred)
+	a.EqualValues(11, info.Size)
+	a.EqualValues(6, info.Offset)
+
+	_, err = upload.WriteChunk(ctx, 6, bytes.NewReader([]byte("world")))
+	a.NoError(err)
+	a.NoError(upload.FinishUpload(ctx))
+	a.Equal("hello world", readContent(t, upload))
+}
+
+// testConcatenation checks that a final upload contains the data of its
+// partial uploads in order.
+func testConcatenation(t *testing.T, composer *handler.StoreComposer) {
+	a := assert.New(t)
+	ctx := context.Background()
+
+	contents := []string{"abc", "def", "ghi"}
+	partialUploads := make([]handler.Upload, 0, len(contents))
+	partialIDs := make([]string, 0, len(contents))
+	for _, content := range contents {
+		upload, err := composer.Core.NewUpload(ctx, handler.FileInfo{
+			Size:      int64(len(content)),
+			IsPartial: true,
+		})
+		if !a.NoError(err) {
+			return
+		}
+
+		_, err = upload.WriteChunk(ctx, 0, bytes.NewReader([]byte(content)))
+		a.NoError(err)
+		a.NoError(upload.FinishUpload(ctx))
+
+		info, err := upload.GetInfo(ctx)
+		a.NoError(err)
+
+		partialUploads = append(partialUploads, upload)
+		partialIDs = append(partialIDs, info.ID)
+	}
+
+	final, err := composer.Core.NewUpload(ctx, handler.FileInfo{
+		Size:           9,
+		IsFinal:        true,
+		PartialUploads: partialIDs,
+	})
+	if !a.NoError(err) {
+		return
+	}
+
+	a.NoError(composer.Concater.AsConcatableUpload(final).ConcatUploads(ctx, partialUploads))
+
+	info, err := final.GetInfo(ctx)
+	a.NoError(err)
+
+	final, err = composer.Core.GetUpload(ctx, info.ID)
+	if !a.NoError(err) {
+		return
+	}
+
+	info, err = final.GetInfo(ctx)
+	a.NoError(err)
+	a.EqualValues(9, info.Offset)
+	a.Equal("abcdefghi", readContent(t, final))
+}
+
+// testConcurrentPatch sends multiple PATCH requests for the same upload through
+// the handler at the same time. Depending on the timing, requests interrupt
+// each other or are rejected because of a mismatching offset. In any case, the
+// stored data must match the upload's offset afterwards.
+func testConcurrentPatch(t *testing.T, composer *handler.StoreComposer, requests int) {
+	a := assert.New(t)
+	ctx := context.Background()
+
+	// Copy the composer, so that a locker can be added without affecting the
+	// caller.
+	lockedComposer := *composer
+	if !lockedComposer.UsesLocker {
+		memorylocker.New().UseIn(&lockedComposer)
+	}
+
+	tusHandler, err := handler.NewHandler(handler.Config{
+		StoreComposer:      &lockedComposer,
+		BasePath:           "/files/",
+		AcquireLockTimeout: 5 * time.Second,
+	})
+	if !a.NoError(err) {
+		return
+	}
+	server := http.StripPrefix("/files/", tusHandler)
+
+	body := make([]byte, 64*1024)
+	rand.New(rand.NewSource(1)).Read(body)
+
+	upload, err := composer.Core.NewUpload(ctx, handler.FileInfo{Size: int64(len(body))})
+	if !a.NoError(err) {
+		return
+	}
+
+	info, err := upload.GetInfo(ctx)
+	if !a.NoError(err) {
+		return
+	}
+
+	var wg sync.WaitGroup
+	statuses := make([]int, requests)
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			req := httptest.NewRequest("PATCH", "/files/"+info.ID, &slowReader{data: body})
+			req.Header.Set("Tus-Resumable", "1.0.0")
+			req.Header.Set("Content-Type", "application/offset+octet-stream")
+			req.Header.Set("Upload-Offset", "0")
+			req.Header.Set("Content-Length", strconv.Itoa(len(body)))
+
+			res := httptest.NewRecorder()
+			server.ServeHTTP(res, req)
+			statuses[i] = res.Code
+		}(i)
+	}
+	wg.Wait()
+
+	for _, status := range statuses {
+		// Besides successful requests, requests may be interrupted by others
+		// (400), have an outdated offset (409) or find the upload locked (423).
+		a.Contains([]int{http.StatusNoContent, http.StatusBadRequest, http.StatusConflict, http.StatusLocked}, status)
+	}
+
+	upload, err = composer.Core.GetUpload(ctx, info.ID)
+	if !a.NoError(err) {
+		return
+	}
+
+	info, err = upload.GetInfo(ctx)
+	a.NoError(err)
+	a.Greater(info.Offset, int64(0))
+	if a.LessOrEqual(info.Offset, int64(len(body))) {
+		// All requests send the same data, so the stored data must be the
+		// beginning of it, regardless of which requests have been written.
+		a.True(bytes.Equal(body[:info.Offset], []byte(readContent(t, upload))), "stored data does not match the upload's offset")
+	}
+}
+
+// testLargeUpload writes an upload in multiple chunks and compares the stored
+// data with the written data.
+func testLargeUpload(t *testing.T, composer *handler.StoreComposer, size int64, chunkSize int64) {
+	a := assert.New(t)
+	ctx := context.Background()
+
+	upload, err := composer.Core.NewUpload(ctx, handler.FileInfo{Size: size})
+	if !a.NoError(err) {
+		return
+	}
+
+	info, err := upload.GetInfo(ctx)
+	if !a.NoError(err) {
+		return
+	}
+
+	// The data is generated while it is written, so it is not held in memory.
+	hash := sha256.New()
+	src := io.TeeReader(io.LimitReader(rand.New(rand.NewSource(1)), size), hash)
+	for offset := int64(0); offset < size; {
+		upload, err = composer.Core.GetUpload(ctx, info.ID)
+		if !a.NoError(err) {
+			return
+		}
+
+		n, err := upload.WriteChunk(ctx, offset, io.LimitReader(src, chunkSize))
+		if !a.NoError(err) {
+			return
+		}
+		offset += n
+	}
+	a.NoError(upload.FinishUpload(ctx))
+
+	upload, err = composer.Core.GetUpload(ctx, info.ID)
+	if !a.NoError(err) {
+		return
+	}
+
+	info, err = upload.GetInfo(ctx)
+	a.NoError(err)
+	a.Equal(size, info.Offset)
+
+	reader, err := upload.GetReader(ctx)
+	if !a.NoError(err) {
+		return
+	}
+	defer reader.Close()
+
+	stored := sha256.New()
+	_, err = io.Copy(stored, reader)
+	a.NoError(err)
+	a.Equal(hash.Sum(nil), stored.Sum(nil))
+}
+
+// readContent returns the entire content of an upload.
+func readContent(t *testing.T, upload handler.Upload) string {
+	reader, err := upload.GetReader(context.Background())
+	if !assert.NoError(t, err) {
+		return ""
+	}
+	defer reader.Close()
+
+	content, err := io.ReadAll(reader)
+	assert.NoError(t, err)
+	return string(content)
+}
+
+// slowReader returns its data in small pieces with a delay, so that concurrent
+// requests overlap.
+type slowReader struct {
+	data []byte
+}
+
+func (r *slowReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, io.EOF
+	}
+
+	time.Sleep(time.Millisecond)
+	n := copy(p[:minInt(len(p), 4096)], r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,273 @@
+package tenant
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/tus/tusd/v2/pkg/handler"
+)
+
+var (
+	ErrRateLimited    = handler.NewError("ERR_RATE_LIMITED", "tenant has exceeded its request rate", http.StatusTooManyRequests)
+	ErrTooManyUploads = handler.NewError("ERR_TOO_MANY_UPLOADS", "tenant has reached its limit of concurrent uploads", http.StatusTooManyRequests)
+
+	ErrClientRateLimited    = handler.NewError("ERR_CLIENT_RATE_LIMITED", "client has exceeded its request rate", http.StatusTooManyRequests)
+	ErrTooManyClientUploads = handler.NewError("ERR_TOO_MANY_CLIENT_UPLOADS", "client has reached its limit of concurrent uploads", http.StatusTooManyRequests)
+)
+
+// clientPruneInterval is the minimum duration between the removal of idle
+// clients from a Limiter.
+const clientPruneInterval = time.Minute
+
+// Limits restricts the resources, which a tenant may use.
+type Limits struct {
+	// RequestsPerSecond is the sustained rate of requests, which are accepted
+	// from the tenant. Requests exceeding the rate are rejected with
+	// ErrRateLimited. Zero disables the limit.
+	RequestsPerSecond float64
+	// Burst is the number of requests, which may exceed RequestsPerSecond for a
+	// short time. Defaults to RequestsPerSecond, but at least one.
+	Burst int
+	// MaxConcurrentUploads is the number of POST and PATCH requests of the
+	// tenant, which may be handled at the same time. Further requests are
+	// rejected with ErrTooManyUploads. Zero disables the limit.
+	MaxConcurrentUploads int
+	// ClientRequestsPerSecond, ClientBurst and MaxConcurrentUploadsPerClient
+	// limit the requests of each client of the tenant in the same way.
+	// Clients are identified by handler.ClientNetwork, so that IPv6 clients are
+	// combined by their prefix, see handler.Config.IPv6PrefixLength. Zero
+	// disables the limits.
+	ClientRequestsPerSecond       float64
+	ClientBurst                   int
+	MaxConcurrentUploadsPerClient int
+}
+
+// Limiter enforces the Limits of a tenant. It is used as middleware of the
+// tenant's handler in the handler.PostAuthStage, so that OPTIONS requests and
+// requests rejected by the handler itself are not counted.
+type Limiter struct {
+	id     string
+	limits Limits
+
+	lock sync.Mutex
+	// tokens is the number of requests, which can currently be accepted
+	// according to RequestsPerSecond.
+	tokens     float64
+	lastRefill time.Time
+	uploads    int
+
+	// clients holds the state of the clients, which have recently sent
+	// requests, if per-client limits are configured.
+	clients   map[string]*clientState
+	lastPrune time.Time
+}
+
+// clientState tracks the requests of a single client.
+type clientState struct {
+	tokens     float64
+	lastRefill time.Time
+	uploads    int
+}
+
+// NewLimiter creates a limiter for the tenant with the given ID.
+func NewLimiter(id string, limits Limits) *Limiter {
+	if limits.RequestsPerSecond > 0 && limits.Burst < 1 {
+		limits.Burst = int(math.Max(1, math.Ceil(limits.RequestsPerSecond)))
+	}
+	if limits.ClientRequestsPerSecond > 0 && limits.ClientBurst < 1 {
+		limits.ClientBurst = int(math.Max(1, math.Ceil(limits.ClientRequestsPerSecond)))
+	}
+
+	now := time.Now()
+	return &Limiter{
+		id:         id,
+		limits:     limits,
+		tokens:     float64(limits.Burst),
+		lastRefill: now,
+		clients:    make(map[string]*clientState),
+		lastPrune:  now,
+	}
+}
+
+// Middleware rejects the requests, which exceed the limits, and passes all
+// other requests to next.
+func (l *Limiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if retryAfter, ok := l.allowRequest(time.Now()); !ok {
+			MetricsRequestsRejectedTotal.WithLabelValues(l.id, "rate").Inc()
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			writeError(w, ErrRateLimited)
+			return
+		}
+
+		client := handler.ClientNetwork(r.Context())
+		if retryAfter, ok := l.allowClientRequest(client, time.Now()); !ok {
+			MetricsRequestsRejectedTotal.WithLabelValues(l.id, "client-rate").Inc()
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			writeError(w, ErrClientRateLimited)
+			return
+		}
+
+		if r.Method == http.MethodPost || r.Method == http.MethodPatch {
+			if !l.acquireUpload() {
+				MetricsRequestsRejectedTotal.WithLabelValues(l.id, "uploads").Inc()
+				writeError(w, ErrTooManyUploads)
+				return
+			}
+			defer l.releaseUpload()
+
+			if !l.acquireClientUpload(client) {
+				MetricsRequestsRejectedTotal.WithLabelValues(l.id, "client-uploads").Inc()
+				writeError(w, ErrTooManyClientUploads)
+				return
+			}
+			defer l.releaseClientUpload(client)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// allowRequest reports whether a request may be handled at now according to
+// RequestsPerSecond. If not, it also returns the duration after which the next
+// request will be accepted.
+func (l *Limiter) allowRequest(now time.Time) (time.Duration, bool) {
+	if l.limits.RequestsPerSecond <= 0 {
+		return 0, true
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return takeToken(&l.tokens, &l.lastRefill, now, l.limits.RequestsPerSecond, l.limits.Burst)
+}
+
+// allowClientRequest is the equivalent of allowRequest for the requests of
+// the client according to ClientRequestsPerSecond.
+func (l *Limiter) allowClientRequest(client string, now time.Time) (time.Duration, bool) {
+	if l.limits.ClientRequestsPerSecond <= 0 || client == "" {
+		return 0, true
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.pruneClients(now)
+	state := l.client(client, now)
+	return takeToken(&state.tokens, &state.lastRefill, now, l.limits.ClientRequestsPerSecond, l.limits.ClientBurst)
+}
+
+// takeToken refills the tokens of a token bucket according to the time passed
+// since lastRefill and takes one token, if available. Otherwise, it returns
+// the duration after which the next token will be available.
+func takeToken(tokens *float64, lastRefill *time.Time, now time.Time, rate float64, burst int) (time.Duration, bool) {
+	elapsed := now.Sub(*lastRefill).Seconds()
+	if elapsed > 0 {
+		*tokens = math.Min(float64(burst), *tokens+elapsed*rate)
+		*lastRefill = now
+	}
+
+	if *tokens < 1 {
+		missing := 1 - *tokens
+		return time.Duration(missing / rate * float64(time.Second)), false
+	}
+
+	*tokens--
+	return 0, true
+}
+
+func (l *Limiter) acquireUpload() bool {
+	if l.limits.MaxConcurrentUploads <= 0 {
+		return true
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.uploads >= l.limits.MaxConcurrentUploads {
+		return false
+	}
+
+	l.uploads++
+	return true
+}
+
+func (l *Limiter) releaseUpload() {
+	if l.limits.MaxConcurrentUploads <= 0 {
+		return
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.uploads--
+}
+
+func (l *Limiter) acquireClientUpload(client string) bool {
+	if l.limits.MaxConcurrentUploadsPerClient <= 0 || client == "" {
+		return true
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	state := l.client(client, time.Now())
+	if state.uploads >= l.limits.MaxConcurrentUploadsPerClient {
+		return false
+	}
+
+	state.uploads++
+	return true
+}
+
+func (l *Limiter) releaseClientUpload(client string) {
+	if l.limits.MaxConcurrentUploadsPerClient <= 0 || client == "" {
+		return
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if state, ok := l.clients[client]; ok {
+		state.uploads--
+		// Without a rate limit, the state is not needed anymore.
+		if state.uploads == 0 && l.limits.ClientRequestsPerSecond <= 0 {
+			delete(l.clients, client)
+		}
+	}
+}
+
+// client returns the state of the client, creating it if necessary. The
+// caller must hold l.lock.
+func (l *Limiter) client(client string, now time.Time) *clientState {
+	state, ok := l.clients[client]
+	if !ok {
+		state = &clientState{
+			tokens:     float64(l.limits.ClientBurst),
+			lastRefill: now,
+		}
+		l.clients[client] = state
+	}
+
+	return state
+}
+
+// pruneClients removes the clients, which have no running uploads and whose
+// tokens have been refilled completely, since their state is identical to the
+// one of a new client. The caller must hold l.lock.
+func (l *Limiter) pruneClients(now time.Time) {
+	if now.Sub(l.lastPrune) < clientPruneInterval {
+		return
+	}
+	l.lastPrune = now
+
+	refillDuration := time.Duration(float64(l.limits.ClientBurst) / l.limits.ClientRequestsPerSecond * float64(time.Second))
+	for client, state := range l.clients {
+		if state.uploads == 0 && now.Sub(state.lastRefill) >= refillDuration {
+			delete(l.clients, client)
+		}
+	}
+}
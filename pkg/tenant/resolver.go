@@ -0,0 +1,130 @@
+package tenant
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Resolver returns the ID of the tenant, to which a request belongs. If the
+// request does not specify a tenant, ErrTenantMissing is returned.
+type Resolver func(r *http.Request) (string, error)
+
+// FromHeader returns a resolver, which reads the tenant's ID from the header
+// with the given name.
+func FromHeader(name string) Resolver {
+	return func(r *http.Request) (string, error) {
+		id := r.Header.Get(name)
+		if id == "" {
+			return "", ErrTenantMissing
+		}
+
+		return id, nil
+	}
+}
+
+// ErrUnverifiedJWT is returned by ParseResolver for a jwt-claim resolver, unless
+// unverified tokens are allowed explicitly.
+var ErrUnverifiedJWT = errors.New("tenant: jwt-claim does not verify the token's signature and must be allowed explicitly")
+
+// FromUnverifiedJWTClaim returns a resolver, which reads the tenant's ID from
+// the given claim of the JSON Web Token in the Authorization header using the
+// Bearer scheme. The claim's value must be a string or a number. The token's
+// signature is NOT verified, so anyone can choose the tenant unless a proxy in
+// front of tusd verifies the token and rejects requests with invalid tokens.
+func FromUnverifiedJWTClaim(claim string) Resolver {
+	return func(r *http.Request) (string, error) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			return "", ErrTenantMissing
+		}
+
+		// A JWT consists of the header, payload and signature, which are
+		// separated by dots. The payload contains the claims.
+		parts := strings.Split(strings.TrimSpace(token), ".")
+		if len(parts) != 3 {
+			return "", ErrTenantMissing
+		}
+
+		payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+		if err != nil {
+			return "", ErrTenantMissing
+		}
+
+		var claims map[string]interface{}
+		decoder := json.NewDecoder(bytes.NewReader(payload))
+		decoder.UseNumber()
+		if err := decoder.Decode(&claims); err != nil {
+			return "", ErrTenantMissing
+		}
+
+		switch value := claims[claim].(type) {
+		case string:
+			if value == "" {
+				return "", ErrTenantMissing
+			}
+			return value, nil
+		case json.Number:
+			return value.String(), nil
+		default:
+			return "", ErrTenantMissing
+		}
+	}
+}
+
+// FromHost returns a resolver, which derives the tenant's ID from the host
+// name of the request. The host name must end with suffix, which is removed,
+// so that, for example, the suffix ".uploads.example.com" maps the host name
+// "acme.uploads.example.com" to the tenant "acme". If suffix is empty, the
+// whole host name is used as the ID. The port and letter case are ignored.
+func FromHost(suffix string) Resolver {
+	suffix = strings.ToLower(suffix)
+
+	return func(r *http.Request) (string, error) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		host = strings.ToLower(host)
+
+		id, ok := strings.CutSuffix(host, suffix)
+		if !ok || id == "" {
+			return "", ErrTenantMissing
+		}
+
+		return id, nil
+	}
+}
+
+// ParseResolver creates a resolver from a textual description, which is one
+// of "header:<name>", "jwt-claim:<claim>" or "host:<suffix>". The suffix may
+// be empty. Since jwt-claim does not verify the token, see
+// FromUnverifiedJWTClaim, it is only accepted if allowUnverifiedJWT is set.
+// Otherwise, ErrUnverifiedJWT is returned.
+func ParseResolver(description string, allowUnverifiedJWT bool) (Resolver, error) {
+	kind, value, _ := strings.Cut(description, ":")
+	switch kind {
+	case "header":
+		if value == "" {
+			return nil, fmt.Errorf("tenant: header name must not be empty")
+		}
+		return FromHeader(value), nil
+	case "jwt-claim":
+		if value == "" {
+			return nil, fmt.Errorf("tenant: claim must not be empty")
+		}
+		if !allowUnverifiedJWT {
+			return nil, ErrUnverifiedJWT
+		}
+		return FromUnverifiedJWTClaim(value), nil
+	case "host":
+		return FromHost(value), nil
+	default:
+		return nil, fmt.Errorf("tenant: unknown resolver %q, must be header, jwt-claim or host", kind)
+	}
+}
@@ -0,0 +1,131 @@
+// Package tenant allows a single tusd instance to be shared by multiple tenants.
+//
+// For every request, a Resolver determines the tenant, for example from a
+// header set by an authenticating proxy. The Router then passes the request to
+// the handler configured for this tenant, so that each tenant can use its own
+// storage location, hooks and limits. The tenant's ID is attached to the
+// request's context and can be retrieved using FromContext:
+//
+//	router := tenant.NewRouter(tenant.FromHeader("X-Tenant-Id"))
+//	for id, config := range tenantConfigs {
+//		h, err := handler.NewHandler(config)
+//		if err != nil {
+//			return err
+//		}
+//		limiter := tenant.NewLimiter(id, tenant.Limits{RequestsPerSecond: 10, Burst: 20})
+//		h.Use(handler.PostAuthStage, limiter.Middleware)
+//		router.Add(id, h)
+//	}
+//	http.Handle("/files/", http.StripPrefix("/files/", router))
+//
+// Resolvers trust the request. Unless the tenant is derived from the host name,
+// tusd must therefore be run behind a proxy which authenticates the requests
+// and ensures that clients can not choose another tenant.
+package tenant
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/tus/tusd/v2/pkg/handler"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	ErrTenantMissing  = handler.NewError("ERR_TENANT_MISSING", "request does not specify a tenant", http.StatusBadRequest)
+	ErrTenantNotFound = handler.NewError("ERR_TENANT_NOT_FOUND", "tenant not found", http.StatusNotFound)
+)
+
+// MetricsRequestsRejectedTotal counts the requests, which have been rejected
+// because of the limits of a tenant, per tenant and reason.
+var MetricsRequestsRejectedTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "tusd_tenant_requests_rejected_total",
+		Help: "Total number of requests rejected because of the limits of a tenant.",
+	},
+	[]string{"tenant", "reason"},
+)
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx, which carries the ID of the tenant.
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the ID of the tenant, to which the request with the
+// given context belongs. The boolean is false if the request has not been
+// passed through a Router.
+func FromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(contextKey{}).(string)
+	return id, ok
+}
+
+// Router passes requests to the handler of their tenant.
+type Router struct {
+	resolve  Resolver
+	handlers map[string]http.Handler
+	// fallback receives OPTIONS requests, whose tenant can not be resolved.
+	fallback http.Handler
+}
+
+// NewRouter creates a router, which determines the tenant of requests using resolve.
+func NewRouter(resolve Resolver) *Router {
+	return &Router{
+		resolve:  resolve,
+		handlers: make(map[string]http.Handler),
+	}
+}
+
+// Add registers the handler for the tenant with the given ID. Add must not be
+// called while requests are handled.
+func (router *Router) Add(id string, h http.Handler) {
+	router.handlers[id] = h
+	if router.fallback == nil {
+		router.fallback = h
+	}
+}
+
+func (router *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id, err := router.resolve(r)
+	if err != nil {
+		// Browsers do not include credentials or custom headers in CORS preflight
+		// requests, so their tenant is usually unknown. Since they do not access
+		// any upload, any tenant's handler can answer them.
+		if r.Method == http.MethodOptions && router.fallback != nil {
+			router.fallback.ServeHTTP(w, r)
+			return
+		}
+
+		writeError(w, err)
+		return
+	}
+
+	h, ok := router.handlers[id]
+	if !ok {
+		writeError(w, ErrTenantNotFound)
+		return
+	}
+
+	h.ServeHTTP(w, r.WithContext(NewContext(r.Context(), id)))
+}
+
+// writeError sends err to the client. Errors, which are not a handler.Error,
+// are sent as internal server errors.
+func writeError(w http.ResponseWriter, err error) {
+	var detailedErr handler.Error
+	if !errors.As(err, &detailedErr) {
+		detailedErr = handler.NewError("ERR_INTERNAL_SERVER_ERROR", err.Error(), http.StatusInternalServerError)
+	}
+
+	resp := detailedErr.HTTPResponse
+	for key, value := range resp.Header {
+		w.Header().Set(key, value)
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(resp.Body)))
+	w.WriteHeader(resp.StatusCode)
+	w.Write([]byte(resp.Body))
+}
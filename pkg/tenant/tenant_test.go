@@ -0,0 +1,216 @@
+package tenant
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newJWT returns an unsigned token with the given payload.
+func newJWT(payload string) string {
+	return "eyJhbGciOiJub25lIn0." + base64.RawURLEncoding.EncodeToString([]byte(payload)) + ".signature"
+}
+
+func TestResolvers(t *testing.T) {
+	a := assert.New(t)
+
+	tests := []struct {
+		resolver string
+		host     string
+		header   http.Header
+		id       string
+	}{
+		{"header:X-Tenant-Id", "", http.Header{"X-Tenant-Id": {"acme"}}, "acme"},
+		{"header:X-Tenant-Id", "", http.Header{}, ""},
+		{"jwt-claim:tenant", "", http.Header{"Authorization": {"Bearer " + newJWT(`{"sub":"alice","tenant":"acme"}`)}}, "acme"},
+		{"jwt-claim:org", "", http.Header{"Authorization": {"Bearer " + newJWT(`{"org":12345678901234567890}`)}}, "12345678901234567890"},
+		{"jwt-claim:tenant", "", http.Header{"Authorization": {"Bearer " + newJWT(`{"sub":"alice"}`)}}, ""},
+		{"jwt-claim:tenant", "", http.Header{"Authorization": {"Bearer invalid"}}, ""},
+		{"jwt-claim:tenant", "", http.Header{"Authorization": {"Basic YWxpY2U6c2VjcmV0"}}, ""},
+		{"host:.uploads.example.com", "ACME.uploads.example.com:8080", http.Header{}, "acme"},
+		{"host:.uploads.example.com", "uploads.example.com", http.Header{}, ""},
+		{"host:", "acme.example.com", http.Header{}, "acme.example.com"},
+	}
+
+	for _, test := range tests {
+		resolve, err := ParseResolver(test.resolver, true)
+		a.NoError(err)
+
+		r := httptest.NewRequest("POST", "/files/", nil)
+		r.Host = test.host
+		r.Header = test.header
+
+		id, err := resolve(r)
+		if test.id == "" {
+			a.ErrorIs(err, ErrTenantMissing, test.resolver)
+		} else {
+			a.NoError(err, test.resolver)
+			a.Equal(test.id, id, test.resolver)
+		}
+	}
+
+	_, err := ParseResolver("cookie:tenant", false)
+	a.Error(err)
+	_, err = ParseResolver("header:", false)
+	a.Error(err)
+	_, err = ParseResolver("jwt-claim:tenant", false)
+	a.ErrorIs(err, ErrUnverifiedJWT)
+}
+
+func TestRouter(t *testing.T) {
+	a := assert.New(t)
+
+	router := NewRouter(FromHeader("X-Tenant-Id"))
+	for _, id := range []string{"acme", "globex"} {
+		id := id
+		router.Add(id, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if tenant, ok := FromContext(r.Context()); ok {
+				a.Equal(id, tenant)
+			}
+			w.Write([]byte(id))
+		}))
+	}
+
+	serve := func(method string, tenant string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/files/", nil)
+		if tenant != "" {
+			r.Header.Set("X-Tenant-Id", tenant)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	w := serve("POST", "globex")
+	a.Equal(http.StatusOK, w.Code)
+	a.Equal("globex", w.Body.String())
+
+	w = serve("POST", "initech")
+	a.Equal(http.StatusNotFound, w.Code)
+	a.Equal("ERR_TENANT_NOT_FOUND: tenant not found\n", w.Body.String())
+
+	w = serve("POST", "")
+	a.Equal(http.StatusBadRequest, w.Code)
+	a.Equal("ERR_TENANT_MISSING: request does not specify a tenant\n", w.Body.String())
+
+	// CORS preflight requests are answered by the first tenant's handler.
+	w = serve("OPTIONS", "")
+	a.Equal(http.StatusOK, w.Code)
+	a.Equal("acme", w.Body.String())
+}
+
+func TestLimiterRequestsPerSecond(t *testing.T) {
+	a := assert.New(t)
+
+	l := NewLimiter("acme", Limits{RequestsPerSecond: 2, Burst: 3})
+	now := l.lastRefill
+
+	// The burst is available immediately ...
+	for i := 0; i < 3; i++ {
+		_, ok := l.allowRequest(now)
+		a.True(ok)
+	}
+
+	// ... after which requests are accepted at the configured rate.
+	retryAfter, ok := l.allowRequest(now)
+	a.False(ok)
+	a.Equal(500*time.Millisecond, retryAfter)
+
+	_, ok = l.allowRequest(now.Add(500 * time.Millisecond))
+	a.True(ok)
+	_, ok = l.allowRequest(now.Add(500 * time.Millisecond))
+	a.False(ok)
+
+	// The tokens do not exceed the burst.
+	for i := 0; i < 3; i++ {
+		_, ok := l.allowRequest(now.Add(time.Hour))
+		a.True(ok)
+	}
+	_, ok = l.allowRequest(now.Add(time.Hour))
+	a.False(ok)
+}
+
+func TestLimiterMiddleware(t *testing.T) {
+	a := assert.New(t)
+
+	l := NewLimiter("acme", Limits{RequestsPerSecond: 1, MaxConcurrentUploads: 1})
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	handler := l.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPatch {
+			close(started)
+			<-release
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	serve := func(method string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(method, "/files/foo", strings.NewReader("")))
+		return w
+	}
+
+	// The burst defaults to one request.
+	go serve("PATCH")
+	<-started
+
+	w := serve("HEAD")
+	a.Equal(http.StatusTooManyRequests, w.Code)
+	a.Equal("1", w.Header().Get("Retry-After"))
+	a.Equal("ERR_RATE_LIMITED: tenant has exceeded its request rate\n", w.Body.String())
+
+	// Refill the tokens, so that only the limit of concurrent uploads applies.
+	l.limits.RequestsPerSecond = 1000
+	l.limits.Burst = 10
+	time.Sleep(10 * time.Millisecond)
+
+	w = serve("PATCH")
+	a.Equal(http.StatusTooManyRequests, w.Code)
+	a.Equal("ERR_TOO_MANY_UPLOADS: tenant has reached its limit of concurrent uploads\n", w.Body.String())
+
+	w = serve("HEAD")
+	a.Equal(http.StatusNoContent, w.Code)
+
+	close(release)
+}
+
+func TestLimiterClients(t *testing.T) {
+	a := assert.New(t)
+
+	l := NewLimiter("acme", Limits{ClientRequestsPerSecond: 1, MaxConcurrentUploadsPerClient: 1})
+	now := time.Now()
+
+	// Each client has its own tokens.
+	_, ok := l.allowClientRequest("2001:db8:1:2::/64", now)
+	a.True(ok)
+	retryAfter, ok := l.allowClientRequest("2001:db8:1:2::/64", now)
+	a.False(ok)
+	a.Equal(time.Second, retryAfter)
+	_, ok = l.allowClientRequest("2001:db8:1:3::/64", now)
+	a.True(ok)
+
+	// Requests without a known client are not limited.
+	_, ok = l.allowClientRequest("", now)
+	a.True(ok)
+	_, ok = l.allowClientRequest("", now)
+	a.True(ok)
+
+	a.True(l.acquireClientUpload("2001:db8:1:2::/64"))
+	a.False(l.acquireClientUpload("2001:db8:1:2::/64"))
+	a.True(l.acquireClientUpload("2001:db8:1:3::/64"))
+	l.releaseClientUpload("2001:db8:1:3::/64")
+
+	// Idle clients are removed, unless they have running uploads.
+	l.pruneClients(now.Add(time.Hour))
+	a.Len(l.clients, 1)
+	a.Contains(l.clients, "2001:db8:1:2::/64")
+
+	l.releaseClientUpload("2001:db8:1:2::/64")
+	a.True(l.acquireClientUpload("2001:db8:1:2::/64"))
+}
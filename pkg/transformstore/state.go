@@ -0,0 +1,133 @@
+package transformstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// State describes an unfinished upload, whose data is transformed.
+type State struct {
+	// Size is the size of the upload as declared by the client.
+	Size int64
+	// SizeIsDeferred indicates that the client has not declared the size yet.
+	SizeIsDeferred bool
+	// Offset is the number of bytes received from the client.
+	Offset int64
+	// StoredOffset is the number of transformed bytes, which correspond to the
+	// received bytes. The wrapped upload may hold a few more bytes if a write
+	// failed.
+	StoredOffset int64
+}
+
+// StateStore keeps the state of unfinished uploads, whose data is transformed.
+type StateStore interface {
+	// Get returns the state of the upload. If the upload is unknown, ok is
+	// false.
+	Get(ctx context.Context, id string) (state State, ok bool, err error)
+	// Set records the state of the upload.
+	Set(ctx context.Context, id string, state State) error
+	// Delete removes the state of the upload. Unknown uploads are ignored.
+	Delete(ctx context.Context, id string) error
+}
+
+// MemoryStateStore is a StateStore which keeps the states in memory. It is only
+// suitable if a single tusd instance handles all requests and uploads do not
+// need to be resumed after a restart.
+type MemoryStateStore struct {
+	mutex  sync.Mutex
+	states map[string]State
+}
+
+// NewMemoryStateStore creates a new in-memory state store.
+func NewMemoryStateStore() *MemoryStateStore {
+	return &MemoryStateStore{
+		states: make(map[string]State),
+	}
+}
+
+func (store *MemoryStateStore) Get(ctx context.Context, id string) (State, bool, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	state, ok := store.states[id]
+	return state, ok, nil
+}
+
+func (store *MemoryStateStore) Set(ctx context.Context, id string, state State) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	store.states[id] = state
+	return nil
+}
+
+func (store *MemoryStateStore) Delete(ctx context.Context, id string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	delete(store.states, id)
+	return nil
+}
+
+// FileStateStore is a StateStore which keeps the state of each upload in a
+// JSON file named after the upload's ID with the .transform extension. The
+// directory can be the one of a FileStore.
+type FileStateStore struct {
+	// Path is the directory in which the files are stored. It must exist.
+	Path string
+}
+
+// NewFileStateStore creates a state store, which keeps the states in the
+// directory at path.
+func NewFileStateStore(path string) FileStateStore {
+	return FileStateStore{Path: path}
+}
+
+func (store FileStateStore) Get(ctx context.Context, id string) (State, bool, error) {
+	var state State
+
+	data, err := os.ReadFile(store.statePath(id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return state, false, nil
+	}
+	if err != nil {
+		return state, false, err
+	}
+
+	if err := json.Unmarshal(data, &state); err != nil {
+		return state, false, err
+	}
+	return state, true, nil
+}
+
+// Set replaces the file atomically, so that the state is not lost if tusd is
+// stopped while writing it.
+func (store FileStateStore) Set(ctx context.Context, id string, state State) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	path := store.statePath(id)
+	if err := os.WriteFile(path+".tmp", data, 0664); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+func (store FileStateStore) Delete(ctx context.Context, id string) error {
+	err := os.Remove(store.statePath(id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (store FileStateStore) statePath(id string) string {
+	return filepath.Join(store.Path, id+".transform")
+}
@@ -0,0 +1,35 @@
+package transformstore
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/tus/tusd/v2/pkg/handler"
+)
+
+// NormalizeLineEndings converts Windows line endings to Unix ones by removing
+// all carriage returns. Since lone carriage returns are removed as well, the
+// result does not depend on where blocks end.
+var NormalizeLineEndings Transform = TransformFunc(func(info handler.FileInfo, offset int64, p []byte) ([]byte, error) {
+	if bytes.IndexByte(p, '\r') == -1 {
+		return p, nil
+	}
+
+	return bytes.ReplaceAll(p, []byte{'\r'}, nil), nil
+})
+
+// ForFileTypes restricts transform to uploads, whose filetype metadata starts
+// with one of the given prefixes, e.g. "text/" or "image/jpeg". Other uploads
+// are stored unchanged.
+func ForFileTypes(transform Transform, prefixes ...string) Transform {
+	return TransformFunc(func(info handler.FileInfo, offset int64, p []byte) ([]byte, error) {
+		filetype := info.MetaData["filetype"]
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(filetype, prefix) {
+				return transform.Transform(info, offset, p)
+			}
+		}
+
+		return p, nil
+	})
+}
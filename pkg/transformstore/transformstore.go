@@ -0,0 +1,406 @@
+// Package transformstore provides a wrapper for data stores, which transforms
+// the data of uploads before it is stored.
+//
+// Transforms can scrub personal information or normalize the uploaded data,
+// for example by stripping location data from images or by converting line
+// endings. The data is transformed while it is streamed to the wrapped store,
+// in blocks of up to BlockSize bytes, so uploads of any size are supported.
+//
+// Transforms may change the size of the data. Clients still see the offset of
+// the data they have sent, while the wrapped store holds the transformed data.
+// The mapping between both offsets is kept in a StateStore until the upload is
+// finished. Afterwards, the upload's size and offset are those of the
+// transformed data, which is also served for downloads. Therefore, the wrapped
+// store must support deferring the upload length.
+//
+// The wrapped store is passed as composer, so that its extensions are
+// preserved where possible:
+//
+//	inner := handler.NewStoreComposer()
+//	filestore.New("./uploads").UseIn(inner)
+//	memorylocker.New().UseIn(inner)
+//
+//	composer := handler.NewStoreComposer()
+//	transformstore.New(inner, transformstore.Config{
+//		Transforms: []transformstore.Transform{transformstore.NormalizeLineEndings},
+//		State:      transformstore.NewFileStateStore("./uploads"),
+//	}).UseIn(composer)
+//
+// The concatenation, part presigning, import and partial appending extensions
+// are not provided, since they bypass the transforms or rely on the offsets
+// of the stored data matching those sent by clients. Uploads, which have been
+// created before the store was wrapped, are not transformed.
+package transformstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/tus/tusd/v2/pkg/handler"
+)
+
+// Transform modifies a block of an upload's data before it is stored.
+type Transform interface {
+	// Transform returns the data to store instead of p, which starts at the
+	// given offset in the data sent by the client. The returned slice may be
+	// p itself, but p must not be kept after returning. Returning an error
+	// fails the request, and the block is sent again if the client resumes
+	// the upload.
+	//
+	// Blocks end at arbitrary positions, for example where a request ended,
+	// so transforms should not depend on data of neighbouring blocks. The
+	// same block may be transformed multiple times, in which case the result
+	// must be the same.
+	Transform(info handler.FileInfo, offset int64, p []byte) ([]byte, error)
+}
+
+// TransformFunc is an adapter to allow the use of functions as Transform.
+type TransformFunc func(info handler.FileInfo, offset int64, p []byte) ([]byte, error)
+
+func (f TransformFunc) Transform(info handler.FileInfo, offset int64, p []byte) ([]byte, error) {
+	return f(info, offset, p)
+}
+
+// Config controls how uploads are transformed.
+type Config struct {
+	// Transforms are applied to every block in order.
+	Transforms []Transform
+	// State keeps the offsets of unfinished uploads. It must be shared by all
+	// instances, which serve the same uploads.
+	State StateStore
+	// BlockSize is the maximum number of bytes passed to a transform at once.
+	// Defaults to 64KiB.
+	BlockSize int
+}
+
+// TransformStore wraps a data store and transforms the data written to it. It
+// must be created using New.
+type TransformStore struct {
+	inner  *handler.StoreComposer
+	config Config
+}
+
+// New creates a store, which forwards all operations to the store in inner
+// and transforms the data written to it as described by config. The store in
+// inner must provide the LengthDeferrer extension.
+func New(inner *handler.StoreComposer, config Config) *TransformStore {
+	if config.BlockSize <= 0 {
+		config.BlockSize = 64 * 1024
+	}
+
+	return &TransformStore{
+		inner:  inner,
+		config: config,
+	}
+}
+
+// UseIn sets this store as the core data store in the passed composer and adds
+// the extensions, which are provided by the wrapped store and compatible with
+// transforms.
+func (store *TransformStore) UseIn(composer *handler.StoreComposer) {
+	handler.UseWrapper(composer, store, store.inner, "Concater", "PartPresigner", "Importer", "Ingester", "PartialAppender")
+	composer.UseLengthDeferrer(store)
+}
+
+func (store *TransformStore) NewUpload(ctx context.Context, info handler.FileInfo) (handler.Upload, error) {
+	if !store.inner.UsesLengthDeferrer {
+		return nil, errors.New("transformstore: wrapped store does not support deferring the upload length")
+	}
+
+	// The size of the transformed data is only known once all data has been
+	// received, so it is declared when the upload is finished.
+	state := &State{
+		Size:           info.Size,
+		SizeIsDeferred: info.SizeIsDeferred,
+	}
+	info.Size = 0
+	info.SizeIsDeferred = true
+
+	upload, err := store.inner.Core.NewUpload(ctx, info)
+	if err != nil {
+		return nil, err
+	}
+
+	// The store may have assigned the upload's ID.
+	info, err = upload.GetInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := store.config.State.Set(ctx, info.ID, *state); err != nil {
+		return nil, err
+	}
+
+	return &transformUpload{store: store, upload: upload, id: info.ID, state: state}, nil
+}
+
+func (store *TransformStore) GetUpload(ctx context.Context, id string) (handler.Upload, error) {
+	upload, err := store.inner.Core.GetUpload(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	state, ok, err := store.config.State.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Finished uploads and uploads created before the store was wrapped have
+	// no state and are passed through.
+	transformed := &transformUpload{store: store, upload: upload, id: id}
+	if ok {
+		transformed.state = &state
+	}
+	return transformed, nil
+}
+
+func (store *TransformStore) AsTerminatableUpload(upload handler.Upload) handler.TerminatableUpload {
+	return upload.(*transformUpload)
+}
+
+func (store *TransformStore) AsLengthDeclarableUpload(upload handler.Upload) handler.LengthDeclarableUpload {
+	return upload.(*transformUpload)
+}
+
+func (store *TransformStore) AsPresignableUpload(upload handler.Upload) handler.PresignableUpload {
+	return upload.(*transformUpload)
+}
+
+func (store *TransformStore) AsExpirableUpload(upload handler.Upload) handler.ExpirableUpload {
+	return upload.(*transformUpload)
+}
+
+func (store *TransformStore) AsInspectableUpload(upload handler.Upload) handler.InspectableUpload {
+	return upload.(*transformUpload)
+}
+
+func (store *TransformStore) AsChecksumRecordableUpload(upload handler.Upload) handler.ChecksumRecordableUpload {
+	return upload.(*transformUpload)
+}
+
+// transformUpload wraps an upload of the inner store. The extensions of the
+// inner store expect their own uploads, so the wrapped upload is passed to them.
+type transformUpload struct {
+	store  *TransformStore
+	upload handler.Upload
+	id     string
+	// state is nil if the upload's data is not transformed.
+	state *State
+	// info is the upload's info as last returned by GetInfo.
+	info handler.FileInfo
+	// storedOffset is the offset of the wrapped upload, as last seen in
+	// GetInfo or after writing.
+	storedOffset int64
+}
+
+func (upload *transformUpload) GetInfo(ctx context.Context) (handler.FileInfo, error) {
+	info, err := upload.upload.GetInfo(ctx)
+	if err != nil {
+		return info, err
+	}
+
+	upload.storedOffset = info.Offset
+	if upload.state != nil {
+		info.Size = upload.state.Size
+		info.SizeIsDeferred = upload.state.SizeIsDeferred
+		info.Offset = upload.state.Offset
+	}
+	upload.info = info
+	return info, nil
+}
+
+func (upload *transformUpload) WriteChunk(ctx context.Context, offset int64, src io.Reader) (int64, error) {
+	if upload.state == nil {
+		return upload.upload.WriteChunk(ctx, offset, src)
+	}
+
+	// The handler fetches the info before writing, so it is usually known.
+	if upload.info.ID == "" {
+		if _, err := upload.GetInfo(ctx); err != nil {
+			return 0, err
+		}
+	}
+	if upload.storedOffset < upload.state.StoredOffset {
+		return 0, errors.New("transformstore: wrapped upload holds less data than recorded")
+	}
+
+	// If an earlier write failed in the middle of a block, the wrapped upload
+	// already holds the beginning of the transformed block. It is skipped when
+	// the block is transformed again.
+	state := *upload.state
+	r := &transformReader{
+		transforms: upload.store.config.Transforms,
+		info:       upload.info,
+		src:        src,
+		block:      make([]byte, upload.store.config.BlockSize),
+		offset:     offset,
+		skip:       upload.storedOffset - state.StoredOffset,
+	}
+
+	n, writeErr := upload.upload.WriteChunk(ctx, upload.storedOffset, r)
+	upload.storedOffset += n
+
+	// Only blocks, which have been stored completely, count as received.
+	received, stored := r.completed(r.skip + n)
+	state.Offset += received
+	state.StoredOffset += stored
+	if err := upload.store.config.State.Set(ctx, upload.id, state); err != nil {
+		return 0, err
+	}
+	upload.state = &state
+
+	return received, writeErr
+}
+
+func (upload *transformUpload) GetReader(ctx context.Context) (io.ReadCloser, error) {
+	return upload.upload.GetReader(ctx)
+}
+
+func (upload *transformUpload) FinishUpload(ctx context.Context) error {
+	if upload.state == nil {
+		return upload.upload.FinishUpload(ctx)
+	}
+
+	// From now on, the upload has the size of the transformed data.
+	lengthDeclarable := upload.store.inner.LengthDeferrer.AsLengthDeclarableUpload(upload.upload)
+	if err := lengthDeclarable.DeclareLength(ctx, upload.state.StoredOffset); err != nil {
+		return err
+	}
+	if err := upload.upload.FinishUpload(ctx); err != nil {
+		return err
+	}
+
+	upload.state = nil
+	return upload.store.config.State.Delete(ctx, upload.id)
+}
+
+func (upload *transformUpload) DeclareLength(ctx context.Context, length int64) error {
+	if upload.state == nil {
+		return upload.store.inner.LengthDeferrer.AsLengthDeclarableUpload(upload.upload).DeclareLength(ctx, length)
+	}
+
+	state := *upload.state
+	state.Size = length
+	state.SizeIsDeferred = false
+	if err := upload.store.config.State.Set(ctx, upload.id, state); err != nil {
+		return err
+	}
+
+	upload.state = &state
+	return nil
+}
+
+func (upload *transformUpload) Terminate(ctx context.Context) error {
+	if err := upload.store.inner.Terminater.AsTerminatableUpload(upload.upload).Terminate(ctx); err != nil {
+		return err
+	}
+
+	return upload.store.config.State.Delete(ctx, upload.id)
+}
+
+func (upload *transformUpload) PresignDownloadURL(ctx context.Context, options handler.PresignOptions) (string, error) {
+	return upload.store.inner.Presigner.AsPresignableUpload(upload.upload).PresignDownloadURL(ctx, options)
+}
+
+func (upload *transformUpload) SetExpiration(ctx context.Context, expiresAt time.Time) error {
+	return upload.store.inner.Expirer.AsExpirableUpload(upload.upload).SetExpiration(ctx, expiresAt)
+}
+
+func (upload *transformUpload) Inspect(ctx context.Context) (handler.UploadInspection, error) {
+	return upload.store.inner.Inspector.AsInspectableUpload(upload.upload).Inspect(ctx)
+}
+
+func (upload *transformUpload) RecordChecksum(ctx context.Context, checksum handler.UploadChecksum) error {
+	return upload.store.inner.ChecksumRecorder.AsChecksumRecordableUpload(upload.upload).RecordChecksum(ctx, checksum)
+}
+
+// transformReader reads the data sent by the client in blocks and yields the
+// transformed blocks. It records where each block ends in both streams, so that
+// the offsets can be updated after the transformed data has been stored.
+type transformReader struct {
+	transforms []Transform
+	info       handler.FileInfo
+	src        io.Reader
+	block      []byte
+	// offset is the position of the next block in the data sent by the client.
+	offset int64
+	// skip is the number of transformed bytes, which have already been stored.
+	skip int64
+
+	out  []byte
+	ends []blockEnd
+	err  error
+}
+
+// blockEnd is the position after a block in the data sent by the client and in
+// the transformed data, relative to the beginning of the write.
+type blockEnd struct {
+	received int64
+	stored   int64
+}
+
+func (r *transformReader) Read(p []byte) (int, error) {
+	for len(r.out) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		r.err = r.next()
+	}
+
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
+
+// next reads and transforms the next block. Incomplete blocks are discarded if
+// the request body fails, since the client sends them again when resuming.
+func (r *transformReader) next() error {
+	n, err := io.ReadFull(r.src, r.block)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	} else if err != nil {
+		return err
+	}
+	if n == 0 {
+		return err
+	}
+
+	out := r.block[:n]
+	for _, transform := range r.transforms {
+		var transformErr error
+		out, transformErr = transform.Transform(r.info, r.offset, out)
+		if transformErr != nil {
+			return transformErr
+		}
+	}
+
+	var end blockEnd
+	if len(r.ends) > 0 {
+		end = r.ends[len(r.ends)-1]
+	}
+	end.received += int64(n)
+	end.stored += int64(len(out))
+	r.ends = append(r.ends, end)
+	r.offset += int64(n)
+
+	if start := end.stored - int64(len(out)); r.skip > start {
+		out = out[min(int64(len(out)), r.skip-start):]
+	}
+	r.out = out
+	return err
+}
+
+// completed returns the number of received and stored bytes of the blocks,
+// whose transformed data is contained in the first stored bytes.
+func (r *transformReader) completed(stored int64) (int64, int64) {
+	var end blockEnd
+	for _, e := range r.ends {
+		if e.stored > stored {
+			break
+		}
+		end = e
+	}
+	return end.received, end.stored
+}
@@ -0,0 +1,201 @@
+package transformstore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tus/tusd/v2/pkg/filestore"
+	"github.com/tus/tusd/v2/pkg/handler"
+	"github.com/tus/tusd/v2/pkg/storetest"
+)
+
+// Test interface implementation of TransformStore
+var _ handler.DataStore = &TransformStore{}
+var _ handler.TerminaterDataStore = &TransformStore{}
+var _ handler.LengthDeferrerDataStore = &TransformStore{}
+var _ handler.PresignerDataStore = &TransformStore{}
+var _ handler.ExpirerDataStore = &TransformStore{}
+var _ handler.InspectorDataStore = &TransformStore{}
+
+var _ StateStore = &MemoryStateStore{}
+var _ StateStore = FileStateStore{}
+
+func newComposer(t *testing.T, config Config) *handler.StoreComposer {
+	dir := t.TempDir()
+	inner := handler.NewStoreComposer()
+	filestore.New(dir).UseIn(inner)
+
+	if config.State == nil {
+		config.State = NewFileStateStore(dir)
+	}
+
+	composer := handler.NewStoreComposer()
+	New(inner, config).UseIn(composer)
+	return composer
+}
+
+// TestConformance checks that the wrapped store behaves like the inner one if
+// the data is not changed.
+func TestConformance(t *testing.T) {
+	composer := newComposer(t, Config{})
+
+	// The concatenation test is skipped, since the extension is not provided.
+	storetest.Run(t, composer, storetest.Options{})
+}
+
+func TestUseIn(t *testing.T) {
+	composer := newComposer(t, Config{})
+
+	a := assert.New(t)
+	a.True(composer.UsesTerminater)
+	a.True(composer.UsesLengthDeferrer)
+	a.True(composer.UsesLister)
+	a.True(composer.UsesExpirer)
+	a.False(composer.UsesConcater)
+	a.False(composer.UsesPartialAppender)
+	a.False(composer.UsesPartPresigner)
+}
+
+func TestSizeChangingTransform(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	composer := newComposer(t, Config{
+		Transforms: []Transform{NormalizeLineEndings},
+		BlockSize:  4,
+	})
+	store := composer.Core
+
+	data := "one\r\ntwo\r\nthree\r\n"
+	upload, err := store.NewUpload(ctx, handler.FileInfo{Size: int64(len(data))})
+	a.NoError(err)
+	info, err := upload.GetInfo(ctx)
+	a.NoError(err)
+
+	// Offsets refer to the data sent by the client.
+	n, err := upload.WriteChunk(ctx, 0, strings.NewReader(data[:7]))
+	a.NoError(err)
+	a.EqualValues(7, n)
+
+	upload, err = store.GetUpload(ctx, info.ID)
+	a.NoError(err)
+	info, err = upload.GetInfo(ctx)
+	a.NoError(err)
+	a.EqualValues(7, info.Offset)
+	a.EqualValues(len(data), info.Size)
+	a.False(info.SizeIsDeferred)
+
+	n, err = upload.WriteChunk(ctx, 7, strings.NewReader(data[7:]))
+	a.NoError(err)
+	a.EqualValues(len(data)-7, n)
+	a.NoError(upload.FinishUpload(ctx))
+
+	// Finished uploads have the size of the transformed data.
+	upload, err = store.GetUpload(ctx, info.ID)
+	a.NoError(err)
+	info, err = upload.GetInfo(ctx)
+	a.NoError(err)
+	a.EqualValues(14, info.Size)
+	a.EqualValues(14, info.Offset)
+
+	reader, err := upload.GetReader(ctx)
+	a.NoError(err)
+	content, err := io.ReadAll(reader)
+	reader.Close()
+	a.NoError(err)
+	a.Equal("one\ntwo\nthree\n", string(content))
+}
+
+func TestInterruptedWrite(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	composer := newComposer(t, Config{
+		Transforms: []Transform{NormalizeLineEndings},
+		BlockSize:  4,
+	})
+	store := composer.Core
+
+	data := "ab\r\ncd\r\nef"
+	upload, err := store.NewUpload(ctx, handler.FileInfo{Size: int64(len(data))})
+	a.NoError(err)
+	info, err := upload.GetInfo(ctx)
+	a.NoError(err)
+
+	// The connection drops in the middle of the second block, which is
+	// discarded and has to be sent again.
+	src := io.MultiReader(strings.NewReader(data[:6]), failingReader{errors.New("connection reset")})
+	n, _ := upload.WriteChunk(ctx, 0, src)
+	a.EqualValues(4, n)
+
+	upload, err = store.GetUpload(ctx, info.ID)
+	a.NoError(err)
+	info, err = upload.GetInfo(ctx)
+	a.NoError(err)
+	a.EqualValues(4, info.Offset)
+
+	n, err = upload.WriteChunk(ctx, 4, strings.NewReader(data[4:]))
+	a.NoError(err)
+	a.EqualValues(6, n)
+	a.NoError(upload.FinishUpload(ctx))
+
+	reader, err := upload.GetReader(ctx)
+	a.NoError(err)
+	content, err := io.ReadAll(reader)
+	reader.Close()
+	a.NoError(err)
+	a.Equal("ab\ncd\nef", string(content))
+}
+
+// TestPartiallyStoredBlock checks that a block, whose transformed data has only
+// been stored partially, is completed when it is sent again.
+func TestPartiallyStoredBlock(t *testing.T) {
+	a := assert.New(t)
+
+	upper := TransformFunc(func(info handler.FileInfo, offset int64, p []byte) ([]byte, error) {
+		return bytes.ToUpper(p), nil
+	})
+	r := &transformReader{
+		transforms: []Transform{upper},
+		src:        strings.NewReader("abcdefgh"),
+		block:      make([]byte, 4),
+		skip:       2,
+	}
+
+	out, err := io.ReadAll(r)
+	a.NoError(err)
+	a.Equal("CDEFGH", string(out))
+
+	// Only the complete blocks are counted.
+	received, stored := r.completed(5)
+	a.EqualValues(4, received)
+	a.EqualValues(4, stored)
+	received, stored = r.completed(8)
+	a.EqualValues(8, received)
+	a.EqualValues(8, stored)
+}
+
+func TestForFileTypes(t *testing.T) {
+	a := assert.New(t)
+	transform := ForFileTypes(NormalizeLineEndings, "text/")
+
+	out, err := transform.Transform(handler.FileInfo{MetaData: handler.MetaData{"filetype": "text/plain"}}, 0, []byte("a\r\nb"))
+	a.NoError(err)
+	a.Equal("a\nb", string(out))
+
+	out, err = transform.Transform(handler.FileInfo{MetaData: handler.MetaData{"filetype": "application/octet-stream"}}, 0, []byte("a\r\nb"))
+	a.NoError(err)
+	a.Equal("a\r\nb", string(out))
+}
+
+// failingReader is a reader, which fails with the given error.
+type failingReader struct {
+	err error
+}
+
+func (r failingReader) Read(p []byte) (int, error) {
+	return 0, r.err
+}